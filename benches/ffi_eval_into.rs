@@ -0,0 +1,100 @@
+//! 对比 `aether_eval` 与 `aether_eval_into` 在小脚本上的分配次数和耗时
+//!
+//! 模拟绑定层的热路径：`aether_eval` 每次调用都要为代码分配一个 C 字符串，
+//! 结果也以新分配的 C 字符串返回后再释放；`aether_eval_into` 按指针 + 长度传入代码，
+//! 结果复制到调用方复用的缓冲区中。
+//!
+//! 基准开始前会打印每次调用的平均分配次数（通过计数的全局分配器统计），
+//! 之后由 criterion 测量耗时。
+//!
+//! 运行：`cargo bench --bench ffi_eval_into`
+
+use std::alloc::{GlobalAlloc, Layout, System};
+use std::ffi::{CString, c_char};
+use std::hint::black_box;
+use std::sync::atomic::{AtomicUsize, Ordering};
+
+use aether::ffi::{aether_eval, aether_eval_into, aether_free, aether_free_string, aether_new};
+use criterion::{Criterion, criterion_group, criterion_main};
+
+/// 统计分配次数的全局分配器
+struct CountingAlloc;
+
+static ALLOCATIONS: AtomicUsize = AtomicUsize::new(0);
+
+unsafe impl GlobalAlloc for CountingAlloc {
+    unsafe fn alloc(&self, layout: Layout) -> *mut u8 {
+        ALLOCATIONS.fetch_add(1, Ordering::Relaxed);
+        unsafe { System.alloc(layout) }
+    }
+
+    unsafe fn dealloc(&self, ptr: *mut u8, layout: Layout) {
+        unsafe { System.dealloc(ptr, layout) }
+    }
+
+    unsafe fn realloc(&self, ptr: *mut u8, layout: Layout, new_size: usize) -> *mut u8 {
+        ALLOCATIONS.fetch_add(1, Ordering::Relaxed);
+        unsafe { System.realloc(ptr, layout, new_size) }
+    }
+}
+
+#[global_allocator]
+static GLOBAL: CountingAlloc = CountingAlloc;
+
+const CODE: &str = "(40 + 2)";
+const ROUNDS: usize = 10_000;
+
+/// 每次调用的平均分配次数
+fn allocations_per_op(mut op: impl FnMut()) -> f64 {
+    op(); // 预热：首次调用会填充 AST 缓存
+    let before = ALLOCATIONS.load(Ordering::Relaxed);
+    for _ in 0..ROUNDS {
+        op();
+    }
+    (ALLOCATIONS.load(Ordering::Relaxed) - before) as f64 / ROUNDS as f64
+}
+
+fn bench_eval_into(c: &mut Criterion) {
+    let handle = aether_new();
+    let mut buf = [0 as c_char; 256];
+    let mut written: usize = 0;
+    let mut overflow: *mut c_char = std::ptr::null_mut();
+
+    let mut eval = || {
+        let code = CString::new(black_box(CODE)).unwrap();
+        let mut result: *mut c_char = std::ptr::null_mut();
+        let mut error: *mut c_char = std::ptr::null_mut();
+        aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+        aether_free_string(result);
+        aether_free_string(error);
+    };
+    let mut eval_into = || {
+        let code = black_box(CODE);
+        aether_eval_into(
+            handle,
+            code.as_ptr() as *const c_char,
+            code.len(),
+            buf.as_mut_ptr(),
+            buf.len(),
+            &mut written,
+            &mut overflow,
+        );
+        aether_free_string(overflow);
+    };
+
+    println!(
+        "allocations per op: eval = {:.1}, eval_into = {:.1}",
+        allocations_per_op(&mut eval),
+        allocations_per_op(&mut eval_into)
+    );
+
+    let mut group = c.benchmark_group("eval_small_script");
+    group.bench_function("eval", |b| b.iter(&mut eval));
+    group.bench_function("eval_into", |b| b.iter(&mut eval_into));
+    group.finish();
+
+    aether_free(handle);
+}
+
+criterion_group!(benches, bench_eval_into);
+criterion_main!(benches);
@@ -0,0 +1,47 @@
+//! 对比通过 JSON 与通过数值数组注入大数组的开销
+//!
+//! 模拟宿主注入 100_000 个浮点数：`aether_set_global` 需要先把数组序列化为 JSON
+//! 再在引擎中解析；`aether_set_float_array` 直接读取宿主的 `double` 数组，一次调用完成复制。
+//!
+//! 运行：`cargo bench --bench ffi_numeric_array`
+
+use std::ffi::CString;
+use std::hint::black_box;
+
+use aether::ffi::{aether_free, aether_new, aether_set_float_array, aether_set_global};
+use criterion::{Criterion, criterion_group, criterion_main};
+
+const LEN: usize = 100_000;
+
+fn bench_numeric_array(c: &mut Criterion) {
+    let handle = aether_new();
+    let name = CString::new("DATA").unwrap();
+    let data: Vec<f64> = (0..LEN).map(|i| i as f64 * 0.25).collect();
+    let mut error = std::ptr::null_mut();
+    let mut group = c.benchmark_group("set_100k_floats");
+
+    group.bench_function("set_global_json", |b| {
+        b.iter(|| {
+            let json = CString::new(serde_json::to_string(&data).unwrap()).unwrap();
+            unsafe { aether_set_global(handle, name.as_ptr(), json.as_ptr()) }
+        })
+    });
+
+    group.bench_function("set_float_array", |b| {
+        b.iter(|| {
+            aether_set_float_array(
+                handle,
+                name.as_ptr(),
+                black_box(data.as_ptr()),
+                data.len(),
+                &mut error,
+            )
+        })
+    });
+
+    group.finish();
+    aether_free(handle);
+}
+
+criterion_group!(benches, bench_numeric_array);
+criterion_main!(benches);
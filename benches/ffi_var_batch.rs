@@ -0,0 +1,56 @@
+//! 对比逐个设置变量与批量设置变量的开销
+//!
+//! 模拟宿主在每次求值前注入 20 个变量：`aether_set_global` 每个变量都要分配
+//! 名称和 JSON 字符串并解析 JSON；`AetherVarBatch` 复用名称和内部缓冲区，
+//! 一次调用完成注入。
+//!
+//! 运行：`cargo bench --bench ffi_var_batch`
+
+use std::ffi::CString;
+use std::hint::black_box;
+
+use aether::ffi::{
+    aether_free, aether_new, aether_set_global, aether_set_var_batch, aether_var_batch_clear,
+    aether_var_batch_free, aether_var_batch_new, aether_var_batch_set_number,
+};
+use criterion::{Criterion, criterion_group, criterion_main};
+
+const VARS: usize = 20;
+
+fn bench_var_setup(c: &mut Criterion) {
+    let handle = aether_new();
+    let names: Vec<String> = (0..VARS).map(|i| format!("V{}", i)).collect();
+    let mut group = c.benchmark_group("set_20_vars");
+
+    group.bench_function("set_global", |b| {
+        b.iter(|| {
+            for (i, name) in names.iter().enumerate() {
+                let name = CString::new(name.as_str()).unwrap();
+                let value = CString::new((i as f64 * 1.5).to_string()).unwrap();
+                unsafe { aether_set_global(handle, name.as_ptr(), value.as_ptr()) };
+            }
+        })
+    });
+
+    let batch = aether_var_batch_new();
+    let c_names: Vec<CString> = names
+        .iter()
+        .map(|n| CString::new(n.as_str()).unwrap())
+        .collect();
+    group.bench_function("var_batch", |b| {
+        b.iter(|| {
+            aether_var_batch_clear(batch);
+            for (i, name) in c_names.iter().enumerate() {
+                aether_var_batch_set_number(batch, name.as_ptr(), black_box(i as f64 * 1.5));
+            }
+            aether_set_var_batch(handle, batch)
+        })
+    });
+
+    group.finish();
+    aether_var_batch_free(batch);
+    aether_free(handle);
+}
+
+criterion_group!(benches, bench_var_setup);
+criterion_main!(benches);
@@ -31,30 +31,2073 @@ typedef struct AetherCacheStats {
   int size;
 } AetherCacheStats;
 
+/**
+ * Resource usage of a single evaluation
+ *
+ * Counted the same way as the corresponding execution limits; values that do
+ * not fit in an `int` are clamped to `INT_MAX`.
+ */
+typedef struct AetherEvalStats {
+  int steps;
+  int peak_call_depth;
+  int peak_array_length;
+} AetherEvalStats;
+
+/**
+ * IO permission state of an engine
+ */
+typedef struct AetherPermissions {
+  int filesystem_enabled;
+  int network_enabled;
+} AetherPermissions;
+
+/**
+ * Opaque handle that interrupts an engine's evaluation from any thread
+ */
+typedef struct AetherInterrupt {
+  uint8_t _opaque[0];
+} AetherInterrupt;
+
+/**
+ * Opaque handle for a shared host function registry
+ */
+typedef struct AetherRegistry {
+  uint8_t _opaque[0];
+} AetherRegistry;
+
+/**
+ * Opaque handle for read-only data shared by several engines (see `aether_shared_data_new`)
+ */
+typedef struct AetherSharedData {
+  uint8_t _opaque[0];
+} AetherSharedData;
+
+/**
+ * Opaque handle for a reusable batch of variable assignments (see `aether_var_batch_new`)
+ */
+typedef struct AetherVarBatch {
+  uint8_t _opaque[0];
+} AetherVarBatch;
+
+/**
+ * Opaque handle for a script function value (see `aether_eval_function`)
+ */
+typedef struct AetherFunction {
+  uint8_t _opaque[0];
+} AetherFunction;
+
+/**
+ * Host function callback
+ *
+ * Receives `user_data` and the call arguments as a JSON array, and returns the
+ * JSON-encoded result. On failure, set `*is_error` to non-zero and return the
+ * error message instead. The returned string must be allocated with `malloc`;
+ * the engine releases it with `free`. Returning NULL yields `null` (or a generic
+ * error message when `*is_error` is set).
+ *
+ * The callback may be invoked from any thread that evaluates code.
+ */
+typedef char *(*AetherHostCallback)(void *user_data, const char *args_json, int *is_error);
+
+/**
+ * Context-aware host function callback
+ *
+ * Same contract as `AetherHostCallback`, but additionally receives the
+ * `context` pointer passed to `aether_eval_with_context` (NULL when the code
+ * was evaluated without a context).
+ */
+typedef char *(*AetherHostContextCallback)(void *user_data,
+                                           void *context,
+                                           const char *args_json,
+                                           int *is_error);
+
+/**
+ * Output callback
+ *
+ * Receives `user_data` and a chunk of PRINT/PRINTLN output (`len` bytes, not
+ * NUL-terminated). Return 0 to accept the chunk; any other value rejects it and
+ * aborts the running evaluation with an output error.
+ */
+typedef int (*AetherOutputCallback)(void *user_data, const char *data, uintptr_t len);
+
+/**
+ * File read callback
+ *
+ * Receives `user_data` and the path passed to `READ_FILE`, and returns the file
+ * content. On failure (e.g. the file does not exist), set `*is_error` to
+ * non-zero and return the error message instead. The returned string must be
+ * allocated with `malloc`; the engine releases it with `free`.
+ */
+typedef char *(*AetherReadFileCallback)(void *user_data, const char *path, int *is_error);
+
+/**
+ * File write callback
+ *
+ * Receives `user_data`, the path and the full new content of the file.
+ * Return 0 on success; any other value fails the write with a runtime error.
+ */
+typedef int (*AetherWriteFileCallback)(void *user_data, const char *path, const char *content);
+
+/**
+ * Limit warning callback
+ *
+ * Receives `user_data`, the limit kind (`"steps"`, `"recursion_depth"`,
+ * `"duration_ms"` or `"array_length"`, a static string), the current usage and
+ * the configured limit. Called on the evaluating thread; it cannot stop the
+ * evaluation.
+ */
+typedef void (*AetherLimitWarningCallback)(void *user_data, const char *kind, uint64_t used, uint64_t limit);
+
+/**
+ * Progress callback
+ *
+ * Receives `user_data` and the number of steps executed so far in the current
+ * evaluation. Called on the evaluating thread; call `aether_interrupt` on an
+ * interrupt handle to stop the evaluation.
+ */
+typedef void (*AetherProgressCallback)(void *user_data, uint64_t steps);
+
+/**
+ * Call hook callback
+ *
+ * Receives `user_data`, the name of the function being called (`"<lambda>"`
+ * for anonymous functions) and its arguments as a JSON array. Both strings
+ * are only valid during the call. Called on the evaluating thread before
+ * each user-function, builtin and host-function call.
+ */
+typedef void (*AetherCallHookCallback)(void *user_data, const char *name, const char *args_json);
+
+/**
+ * Per-element result callback
+ *
+ * Receives `user_data`, the element index and the element encoded as JSON
+ * (only valid during the call). Return 0 to continue; any other value stops
+ * the iteration.
+ */
+typedef int (*AetherForEachCallback)(void *user_data, uintptr_t index, const char *value_json);
+
 #ifdef __cplusplus
 extern "C" {
 #endif // __cplusplus
 
 /**
- * Create a new Aether engine instance
+ * Create a new Aether engine instance
+ *
+ * Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+ * if construction panicked
+ */
+struct AetherHandle *aether_new(void);
+
+/**
+ * Create a new Aether engine with all IO permissions enabled
+ *
+ * Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+ * if construction panicked
+ */
+struct AetherHandle *aether_new_with_permissions(void);
+
+/**
+ * Create a new Aether engine configured for untrusted scripts
+ *
+ * Applies the same bundle as `Aether::with_safe_defaults`: no IO permissions,
+ * at most 100,000 steps, recursion depth 100, 5 seconds of execution time,
+ * a 1 MiB cap on the top-level result, at most 100,000 elements per array
+ * and at most 256 levels of parser nesting.
+ *
+ * Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+ * if construction panicked
+ */
+struct AetherHandle *aether_new_safe(void);
+
+/**
+ * Evaluate Aether code
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - ParseError (1) or RuntimeError (2) if evaluation failed, decided by the kind
+ *   of error rather than its message
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_eval(struct AetherHandle *handle, const char *code, char **result, char **error);
+
+/**
+ * Evaluate Aether code and capture everything it prints
+ *
+ * `PRINT`/`PRINTLN` output is captured in memory instead of being written to
+ * stdout, and returned as a JSON array of lines. The output is returned even
+ * when evaluation fails, so hosts can show partial progress.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - output_json: Output parameter for printed lines as JSON array (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_verbose(struct AetherHandle *handle,
+                        const char *code,
+                        char **result,
+                        char **output_json,
+                        char **error);
+
+/**
+ * Evaluate Aether code and return only the last `n` lines it printed
+ *
+ * Like `aether_eval_verbose`, but the engine keeps just the most recent `n`
+ * lines in a ring buffer, so a script that prints a lot does not grow the
+ * captured output without bound.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - n: Number of printed lines to keep
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - output_json: Output parameter for the last printed lines as JSON array (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_tail(struct AetherHandle *handle,
+                     const char *code,
+                     uintptr_t n,
+                     char **result,
+                     char **output_json,
+                     char **error);
+
+/**
+ * Evaluate Aether code and report the global variables it changed
+ *
+ * `changes_json` receives a JSON array sorted by variable name, with one
+ * entry per added, removed or changed global, e.g.
+ * `{"name": "X", "kind": "changed", "before": 1, "after": 2}`. Added and
+ * removed entries carry a single `value`. Changes are reported even when
+ * evaluation fails.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - changes_json: Output parameter for the changes as JSON array (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_diff(struct AetherHandle *handle,
+                     const char *code,
+                     char **result,
+                     char **changes_json,
+                     char **error);
+
+/**
+ * Evaluate Aether code and report how long the interpreter spent on it
+ *
+ * The elapsed time is measured inside the engine (parse + optimize + evaluate)
+ * and excludes any marshaling overhead on the caller side.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - elapsed_ns: Output parameter for elapsed time in nanoseconds (set on success and on error)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_timed(struct AetherHandle *handle,
+                      const char *code,
+                      char **result,
+                      uint64_t *elapsed_ns,
+                      char **error);
+
+/**
+ * Evaluate Aether code and report parse and evaluation time separately
+ *
+ * Both phases are measured inside the engine. When the code is already in the
+ * AST cache nothing is parsed and `parse_ns` is just the cache lookup; a
+ * workload dominated by `parse_ns` benefits from `aether_compile`.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - parse_ns: Output parameter for parse and optimize time in nanoseconds (set on success and on error)
+ * - eval_ns: Output parameter for evaluation time in nanoseconds (0 if parsing failed)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_phases(struct AetherHandle *handle,
+                       const char *code,
+                       char **result,
+                       uint64_t *parse_ns,
+                       uint64_t *eval_ns,
+                       char **error);
+
+/**
+ * Evaluate Aether code and report how much of the engine's resources it used
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - stats: Output parameter for resource usage (set on success and on error)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_with_stats(struct AetherHandle *handle,
+                           const char *code,
+                           char **result,
+                           struct AetherEvalStats *stats,
+                           char **error);
+
+/**
+ * Evaluate a predicate and return its boolean result
+ *
+ * A non-boolean result is a runtime error; it is never coerced.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter set to 1 (true) or 0 (false) on success
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded and produced a Boolean
+ * - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+ * - Non-zero error code otherwise
+ */
+int aether_eval_bool(struct AetherHandle *handle,
+                     const char *code,
+                     int *result,
+                     char **error);
+
+/**
+ * Evaluate code and return its integer result
+ *
+ * The result must be a whole number within the range of a 64-bit integer.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for the integer result
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded and produced an integer
+ * - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+ * - Non-zero error code otherwise
+ */
+int aether_eval_int(struct AetherHandle *handle,
+                    const char *code,
+                    int64_t *result,
+                    char **error);
+
+/**
+ * Evaluate code and return its numeric result as a double
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for the numeric result
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded and produced a Number
+ * - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+ * - Non-zero error code otherwise
+ */
+int aether_eval_float(struct AetherHandle *handle,
+                      const char *code,
+                      double *result,
+                      char **error);
+
+/**
+ * Evaluate code and return its integer result as a decimal string
+ *
+ * Unlike `aether_eval_int`, the result may exceed 64 bits; use it together with
+ * overflow mode 3 (BigInt) for exact arbitrary-precision integer math.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for the decimal digits, with a leading `-` if
+ *   negative (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded and produced an integer
+ * - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+ * - Non-zero error code otherwise
+ */
+int aether_eval_bigint(struct AetherHandle *handle,
+                       const char *code,
+                       char **result,
+                       char **error);
+
+/**
+ * Report whether the most recent evaluation modified global state
+ *
+ * Global state is modified when a script sets a global variable or defines a
+ * function at the top level, even if it failed afterwards. Changes made by
+ * the host (e.g. `aether_set_global`) and locals inside functions do not count.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - side_effects: Output parameter, 1 if the last evaluation modified globals, 0 otherwise
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_last_eval_had_side_effects(struct AetherHandle *handle, int *side_effects);
+
+/**
+ * Report which host functions the most recent evaluation invoked
+ *
+ * Host functions are those added with `aether_register_function` or an
+ * attached registry; builtins are not listed. The list is cleared when each
+ * evaluation starts and includes calls made before a failure.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - names_json: Output parameter for a JSON array of function names in the
+ *   order of their first call (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_last_eval_called_hosts(struct AetherHandle *handle, char **names_json);
+
+/**
+ * Serialize the engine's global variables and functions to bytes
+ *
+ * The bytes carry a format version and can be cached and passed to
+ * `aether_load_state` later, e.g. to skip re-running a setup script on a cold
+ * start. Builtins and host constants are not saved. Closures over local
+ * variables, generators and lazy values cannot be saved.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - out: Output parameter for the state bytes (must be freed with aether_free_bytes)
+ * - out_len: Output parameter for the number of bytes in `out`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the state was saved
+ * - RuntimeError (2) if a global cannot be saved
+ */
+int aether_save_state(struct AetherHandle *handle,
+                      uint8_t **out,
+                      uintptr_t *out_len,
+                      char **error);
+
+/**
+ * Restore globals and functions saved by `aether_save_state`
+ *
+ * Existing globals with the same names are replaced. Corrupt bytes or bytes
+ * from an incompatible format version are rejected without changing the engine.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - data: Pointer to the state bytes
+ * - len: Length of `data` in bytes
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the state was restored
+ * - InvalidArgument (7) if the bytes are not a compatible engine state
+ */
+int aether_load_state(struct AetherHandle *handle,
+                      const uint8_t *data,
+                      uintptr_t len,
+                      char **error);
+
+/**
+ * Compile Aether code and serialize the compiled program to bytes
+ *
+ * The bytes can be stored or shipped to other processes and loaded with
+ * `aether_import_program`, which skips parsing. They carry a format version,
+ * a checksum, the source code and the settings they were compiled with
+ * (deny list, nesting limit, warnings as errors, rational division,
+ * no recursion).
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - out: Output parameter for the program bytes (must be freed with aether_free_bytes)
+ * - out_len: Output parameter for the number of bytes in `out`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the program was compiled and serialized
+ * - ParseError (1) if the code cannot be parsed
+ */
+int aether_export_program(struct AetherHandle *handle,
+                          const char *code,
+                          uint8_t **out,
+                          uintptr_t *out_len,
+                          char **error);
+
+/**
+ * Load a program serialized by `aether_export_program` into the AST cache
+ *
+ * `source` receives the program's source code; evaluating exactly that code
+ * afterwards uses the loaded program without parsing. Corrupt bytes, a
+ * checksum mismatch, an incompatible format version or different parse
+ * settings are rejected without changing the engine. The checksum detects
+ * corruption only, so load bytes from trusted sources.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - data: Pointer to the program bytes
+ * - len: Length of `data` in bytes
+ * - source: Output parameter for the source code (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the program was loaded
+ * - InvalidArgument (7) if the bytes are not a compatible compiled program
+ */
+int aether_import_program(struct AetherHandle *handle,
+                          const uint8_t *data,
+                          uintptr_t len,
+                          char **source,
+                          char **error);
+
+/**
+ * Report the approximate memory held by the engine's global scope
+ *
+ * Counts global variables, constants and user-defined functions, including
+ * the contents of strings, arrays and dicts, so the figure grows with large
+ * arrays. It is an estimate; use it to decide when to call `aether_reset_env`
+ * on a long-lived engine.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - bytes: Output parameter for the approximate size in bytes
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_memory_usage(struct AetherHandle *handle, uint64_t *bytes);
+
+/**
+ * Evaluate Aether code using a caller-owned scratch buffer
+ *
+ * Avoids per-call allocations for small scripts: `code` is passed as a
+ * pointer + length (no NUL terminator required), and the result text (or the
+ * error message on failure) is copied into `buf` as a NUL-terminated string.
+ * If the text does not fit, it is returned through `overflow` instead. A result
+ * containing a NUL byte is reported as an error, and NUL bytes are dropped
+ * from error messages, as in `aether_eval`.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: Pointer to UTF-8 Aether code
+ * - code_len: Length of `code` in bytes
+ * - buf: Caller-owned output buffer
+ * - buf_cap: Capacity of `buf` in bytes (including room for the NUL terminator)
+ * - written: Output parameter for the length of the text in bytes (excluding NUL)
+ * - overflow: Output parameter set to a newly allocated copy of the text when it
+ *   does not fit in `buf` (must be freed with aether_free_string), otherwise NULL
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded (`buf`/`overflow` holds the result)
+ * - Non-zero error code if evaluation failed (`buf`/`overflow` holds the error message)
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_eval_into(struct AetherHandle *handle,
+                     const char *code,
+                     uintptr_t code_len,
+                     char *buf,
+                     uintptr_t buf_cap,
+                     uintptr_t *written,
+                     char **overflow);
+
+/**
+ * Evaluate Aether code and return the result as raw bytes
+ *
+ * Unlike `aether_eval`, the result is returned as a pointer + length instead
+ * of a NUL-terminated string, so results containing NUL bytes are preserved.
+ * `code` is also passed as pointer + length.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: Pointer to UTF-8 Aether code
+ * - code_len: Length of `code` in bytes
+ * - out: Output parameter for the result bytes (must be freed with aether_free_bytes)
+ * - out_len: Output parameter for the number of bytes in `out`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_bytes(struct AetherHandle *handle,
+                      const char *code,
+                      uintptr_t code_len,
+                      uint8_t **out,
+                      uintptr_t *out_len,
+                      char **error);
+
+/**
+ * Free bytes returned by `aether_eval_bytes`, `aether_save_state` or `aether_export_program`
+ *
+ * # Parameters
+ * - ptr: Pointer returned through `out`
+ * - len: Length returned through `out_len`
+ */
+void aether_free_bytes(uint8_t *ptr, uintptr_t len);
+
+/**
+ * Parse and optimize Aether code ahead of time without running it
+ *
+ * The compiled AST is cached, so a later `aether_eval` of the same code skips
+ * parsing. Parsing a huge script can be cancelled from another thread with
+ * `aether_interrupt` on this engine's interrupt handle; interrupts requested
+ * before the call starts are ignored.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code compiled
+ * - ParseError (1) if the code could not be parsed or parsing was interrupted
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_compile(struct AetherHandle *handle, const char *code, char **error);
+
+/**
+ * Parse Aether code and return its AST as JSON
+ *
+ * Every statement and expression node has a `kind` and the 1-based `line`
+ * and `column` where it starts. Invalid code yields a parse error, never a
+ * partial tree.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - ast_json: Output parameter for the JSON AST (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_parse_ast(struct AetherHandle *handle,
+                     const char *code,
+                     char **ast_json,
+                     char **error);
+
+/**
+ * Parse Aether code and return its comments as JSON
+ *
+ * Comments are not part of the AST. They are returned in source order as
+ * `{"text": ..., "line": ..., "column": ...}`, where `text` includes the
+ * comment delimiters and the 1-based position is that of the first
+ * character. Invalid code yields a parse error.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - comments_json: Output parameter for the JSON comments (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_parse_comments(struct AetherHandle *handle,
+                          const char *code,
+                          char **comments_json,
+                          char **error);
+
+/**
+ * Validate Aether code without executing it and collect warnings
+ *
+ * Warnings are returned as a JSON array of
+ * `{"severity": "warning", "code": ..., "message": ..., "line": ..., "column": ...}`
+ * (plus `end_line`/`end_column`, see `aether_diagnostics`).
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - warnings_json: Output parameter for the warnings (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed (there may still be warnings)
+ * - ParseError (1) if the code could not be parsed
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_validate(struct AetherHandle *handle,
+                    const char *code,
+                    char **warnings_json,
+                    char **error);
+
+/**
+ * Check that Aether code is a pure boolean predicate, without executing it
+ *
+ * The code must be a single expression whose inferred type is Boolean, with no
+ * statements, definitions, or calls to functions that may have side effects
+ * (see `Aether::validate_predicate`).
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code is a valid predicate
+ * - ParseError (1) if the code could not be parsed
+ * - InvalidArgument (7) if the code is not a pure boolean predicate
+ */
+int aether_validate_predicate(struct AetherHandle *handle, const char *code, char **error);
+
+/**
+ * Collect structured diagnostics for editor integration, without executing code
+ *
+ * Diagnostics are returned as a JSON array of
+ * `{"severity": "error"|"warning", "code": ..., "message": ..., "line": ...,
+ * "column": ..., "end_line": ..., "end_column": ...}` combining parse errors,
+ * undefined identifiers and unused variables. Malformed code is not an error:
+ * its parse error is one of the diagnostics.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - diagnostics_json: Output parameter for the diagnostics (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if any pointer is NULL
+ * - InvalidArgument (7) if `code` is not valid UTF-8
+ */
+int aether_diagnostics(struct AetherHandle *handle,
+                       const char *code,
+                       char **diagnostics_json);
+
+/**
+ * Check whether Aether code fails to parse only because it ends too early
+ *
+ * Interactive shells use this to decide whether to read another line (for
+ * example after an unclosed `{` or a trailing operator) instead of reporting
+ * a parse error. Complete code, and code with an error before its end, are
+ * not incomplete.
+ *
+ * # Parameters
+ * - code: C string containing Aether code
+ * - incomplete: Output parameter, 1 if more input is needed, 0 otherwise
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_is_incomplete(const char *code, int *incomplete);
+
+/**
+ * List every operator with the precedence and associativity the parser uses
+ *
+ * `table_json` receives a JSON array sorted from loosest to tightest binding,
+ * e.g. `{"symbol": "+", "kind": "binary", "precedence": 5, "associativity": "left"}`.
+ * `kind` is `binary`, `prefix` or `postfix`; a higher precedence binds tighter.
+ *
+ * # Parameters
+ * - table_json: Output parameter for the table (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if `table_json` is NULL
+ */
+int aether_operator_table(char **table_json);
+
+/**
+ * Tell Aether code that ends too early apart from malformed code
+ *
+ * Like `aether_is_incomplete`, but code that can never parse is reported as
+ * a ParseError with its message, so a shell can show the error right away
+ * instead of waiting for more lines.
+ *
+ * # Parameters
+ * - code: C string containing Aether code
+ * - incomplete: Output parameter, 1 if more input is needed, 0 otherwise
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parses or only needs more input
+ * - ParseError (1) if the code is malformed
+ * - NullPointer (3) if a pointer is NULL
+ */
+int aether_check_incomplete(const char *code, int *incomplete, char **error);
+
+/**
+ * Infer the type of the value Aether code would produce, without executing it
+ *
+ * Globals already set on the engine take part in inference by the type of
+ * their current value.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - kind: Output parameter for the type name, one of `Int`, `Float`, `Number`,
+ *   `Fraction`, `String`, `Boolean`, `Null`, `Array`, `Dict`, `Function` or
+ *   `Unknown` (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ */
+int aether_infer_type(struct AetherHandle *handle,
+                      const char *code,
+                      char **kind,
+                      char **error);
+
+/**
+ * Estimate the cost of running Aether code from its syntax, without executing it
+ *
+ * The result is a JSON object such as
+ * `{"statements": 3, "loops": 2, "max_loop_depth": 2, "max_nesting": 2,
+ * "functions": 0, "calls": 3, "recursive_functions": [], "score": 111}`.
+ * `score` is a heuristic for rejecting obviously expensive scripts; see
+ * `Aether::estimate_cost` for how it is computed.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - cost_json: Output parameter for the JSON object (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ */
+int aether_estimate_cost(struct AetherHandle *handle,
+                         const char *code,
+                         char **cost_json,
+                         char **error);
+
+/**
+ * List the user-defined functions in the engine's global scope as a JSON array
+ *
+ * Each entry is `{"name", "params", "line", "column"}`, sorted by name.
+ * Builtins, host functions and lambdas are not included; `line` and `column`
+ * are 0 when the definition site is unknown.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - functions_json: Output parameter (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the functions were listed
+ * - Non-zero error code if failed
+ */
+int aether_functions(struct AetherHandle *handle, char **functions_json);
+
+/**
+ * Report the IO permissions Aether code would need, without executing it
+ *
+ * A permission is required if the code names any of its builtins, even in a
+ * branch or function that never runs. IO reached indirectly (host functions,
+ * imported modules) is not detected, so this does not replace the runtime
+ * permission checks.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - permissions: Output parameter (each field is 1 if required, 0 otherwise)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ */
+int aether_required_permissions(struct AetherHandle *handle,
+                                const char *code,
+                                struct AetherPermissions *permissions,
+                                char **error);
+
+/**
+ * List the variables Aether code reads but never defines, without executing it
+ *
+ * These are the inputs a host must supply (e.g. with aether_set_globals) before
+ * evaluating the code. Names defined by the code itself (`Set`, parameters,
+ * loop variables, imports), builtins, host functions and global functions are
+ * left out.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - names_json: Output parameter for a JSON array of names in order of first
+ *   read (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code parsed
+ * - ParseError (1) if the code could not be parsed
+ */
+int aether_free_variables(struct AetherHandle *handle,
+                          const char *code,
+                          char **names_json,
+                          char **error);
+
+/**
+ * Dump the compiled (parsed + optimized) AST of Aether code
+ *
+ * Read-only: the code is not executed and the engine state is not modified,
+ * so this is safe to call repeatedly.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - dump: Output parameter for the human-readable AST dump (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the code compiled
+ * - ParseError (1) if the code could not be parsed
+ */
+int aether_disassemble(struct AetherHandle *handle,
+                       const char *code,
+                       char **dump,
+                       char **error);
+
+/**
+ * Evaluate Aether code and report how the result was produced
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string);
+ *   an empty string when the script produced no value
+ * - kind: Output parameter for the result kind:
+ *   0 = last statement value, 1 = explicit top-level `Return`, 2 = no value (void)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_with_kind(struct AetherHandle *handle,
+                          const char *code,
+                          char **result,
+                          int *kind,
+                          char **error);
+
+/**
+ * Evaluate Aether code and report the source position of the result
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - line: Output parameter for the 1-based line of the top-level statement
+ *   that produced the result; 0 when the script produced no value
+ * - column: Output parameter for the 1-based column of that statement; 0 when
+ *   the script produced no value
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - Non-zero error code if evaluation failed
+ */
+int aether_eval_with_span(struct AetherHandle *handle,
+                          const char *code,
+                          char **result,
+                          int *line,
+                          int *column,
+                          char **error);
+
+/**
+ * Evaluate Aether code and report failures as a structured JSON error report
+ *
+ * On failure `report_json` receives
+ * `{"phase", "kind", "message", "import_chain", "call_stack"}`, where
+ * `call_stack` lists the calls active when the error occurred, outermost
+ * first, each as `{"name", "signature", "line", "column"}`. `line`/`column`
+ * are the 1-based position of the top-level statement making the call, or 0
+ * when unknown (calls made inside another function).
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - report_json: Output parameter for the error report (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - ParseError (1) if the code could not be parsed
+ * - RuntimeError (2) if evaluation failed
+ */
+int aether_eval_report(struct AetherHandle *handle,
+                       const char *code,
+                       char **result,
+                       char **report_json);
+
+/**
+ * Get the version string of Aether
+ *
+ * Returns: C string with version (must NOT be freed)
+ *
+ * The string is static and does not allocate: every call returns the same
+ * pointer, valid for as long as the library stays loaded, so bindings may
+ * cache it (e.g. once per process) instead of calling this repeatedly.
+ */
+const char *aether_version(void);
+
+/**
+ * Free an Aether engine handle
+ */
+void aether_free(struct AetherHandle *handle);
+
+/**
+ * Free a string allocated by Aether
+ */
+void aether_free_string(char *s);
+
+/**
+ * Set a global variable from host application
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Variable name
+ * - value_json: Variable value as JSON string
+ *
+ * # Returns
+ * - 0 (Success) if variable was set
+ * - Non-zero error code if failed
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `name` must be a valid pointer to a null-terminated C string
+ * - `value_json` must be a valid pointer to a null-terminated C string
+ */
+int aether_set_global(struct AetherHandle *handle,
+                      const char *name,
+                      const char *value_json);
+
+/**
+ * Bind a global constant that scripts can read but not reassign
+ *
+ * A script that `Set`s the name, modifies it by index, defines a function with
+ * the same name or uses it as a loop variable fails with a runtime error.
+ * Constants survive `aether_reset_env`.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Constant name
+ * - value_json: Constant value as JSON string
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the constant was set
+ * - InvalidJSON (5) if `value_json` is not valid JSON
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_set_const(struct AetherHandle *handle,
+                     const char *name,
+                     const char *value_json,
+                     char **error);
+
+/**
+ * Set a global variable to an array of numbers from a C `double` array
+ *
+ * The fast path for large numeric data: the elements are copied into the
+ * engine in a single call, without building or parsing JSON. Later changes to
+ * `data` do not affect the script.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Variable name
+ * - data: Pointer to `len` doubles (may be NULL when `len` is 0)
+ * - len: Number of elements
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the variable was set
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_set_float_array(struct AetherHandle *handle,
+                           const char *name,
+                           const double *data,
+                           uintptr_t len,
+                           char **error);
+
+/**
+ * Set a global variable to an array of numbers from a C `int64_t` array
+ *
+ * Like `aether_set_float_array`. Aether numbers are doubles, so integers
+ * beyond 2^53 in magnitude are rounded.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Variable name
+ * - data: Pointer to `len` integers (may be NULL when `len` is 0)
+ * - len: Number of elements
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the variable was set
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_set_int_array(struct AetherHandle *handle,
+                         const char *name,
+                         const int64_t *data,
+                         uintptr_t len,
+                         char **error);
+
+/**
+ * Evaluate Aether code with variables overlaid for this call only
+ *
+ * The variables live in a child scope that shadows globals during the
+ * evaluation and is discarded afterwards, together with anything the script
+ * defines, so nothing leaks into the next call.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - vars_json: JSON object mapping variable names to values
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - InvalidJSON (5) if `vars_json` is not a JSON object
+ * - InvalidArgument (7) if a key is not a valid variable name
+ * - Other non-zero error codes if evaluation failed
+ */
+int aether_eval_with(struct AetherHandle *handle,
+                     const char *code,
+                     const char *vars_json,
+                     char **result,
+                     char **error);
+
+/**
+ * Evaluate Aether code with its own RNG seed and variables for this call only
+ *
+ * Behaves like `aether_eval_with`, except that RANDOM/RANDOM_INT use a
+ * generator seeded with `seed` during this evaluation. The engine's own RNG
+ * state is restored afterwards, whether or not the evaluation succeeded.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - seed: RNG seed for this evaluation only
+ * - vars_json: JSON object mapping variable names to values (may be `{}`)
+ * - result: Output parameter for result (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if evaluation succeeded
+ * - InvalidJSON (5) if `vars_json` is not a JSON object
+ * - InvalidArgument (7) if a key is not a valid variable name
+ * - Other non-zero error codes if evaluation failed
+ */
+int aether_eval_with_seed(struct AetherHandle *handle,
+                          const char *code,
+                          uint64_t seed,
+                          const char *vars_json,
+                          char **result,
+                          char **error);
+
+/**
+ * Evaluate the same Aether code once per row of variables
+ *
+ * The code is parsed once. Each row is a JSON object overlaid like
+ * `aether_eval_with`, so rows cannot see each other's variables. A failing
+ * row does not stop the others: `results` receives a JSON array with one
+ * entry per row, either `{"value": <result as JSON>}` or
+ * `{"error": "<message>"}`.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - rows_json: JSON array of objects, e.g. `[{"X": 1}, {"X": 2}]`
+ * - results: Output parameter for the per-row results (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if every row was evaluated, even if some rows failed
+ * - InvalidJSON (5) if `rows_json` is not a JSON array of objects
+ */
+int aether_eval_many(struct AetherHandle *handle,
+                     const char *code,
+                     const char *rows_json,
+                     char **results,
+                     char **error);
+
+/**
+ * Evaluate the same Aether code once per CSV record
+ *
+ * Column `i` of every record is bound to the variable named `header[i]`.
+ * Fields that look like decimal numbers (optional minus sign, fraction and
+ * exponent; no leading zeros except a lone `0`) become numbers, all other
+ * fields stay strings. Rows are otherwise isolated like `aether_eval_many`,
+ * and `results` has the same shape: one `{"value": ...}` or
+ * `{"error": "..."}` entry per record. A record whose field count differs
+ * from the header fails on its own.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - header_json: JSON array of column names, e.g. `["NAME", "AGE"]`
+ * - rows_json: JSON array of string arrays, e.g. `[["Ann", "42"]]`
+ * - results: Output parameter for the per-record results (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if every record was evaluated, even if some records failed
+ * - InvalidJSON (5) if `header_json` or `rows_json` has the wrong shape
+ */
+int aether_eval_csv(struct AetherHandle *handle,
+                    const char *code,
+                    const char *header_json,
+                    const char *rows_json,
+                    char **results,
+                    char **error);
+
+/**
+ * Set several global variables at once from a JSON object
+ *
+ * Either all variables are set or none: if any key is not a valid variable
+ * name, nothing is changed and `error` names the offending key.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - vars_json: JSON object mapping variable names to values
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if all variables were set
+ * - InvalidJSON (5) if `vars_json` is not a JSON object
+ * - InvalidArgument (7) if a key is not a valid variable name
+ */
+int aether_set_globals(struct AetherHandle *handle, const char *vars_json, char **error);
+
+/**
+ * Seed global variables that survive aether_reset_env
+ *
+ * Meant to be called right after creating the engine. The variables are set
+ * immediately and restored to these values by every aether_reset_env; scripts
+ * may still reassign them. Each engine keeps its own copy. Replaces any
+ * previously seeded variables. Either all variables are seeded or none.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - vars_json: JSON object mapping variable names to values
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if all variables were seeded
+ * - InvalidJSON (5) if `vars_json` is not a JSON object
+ * - InvalidArgument (7) if a key is not a valid variable name
+ */
+int aether_set_initial_vars(struct AetherHandle *handle, const char *vars_json, char **error);
+
+/**
+ * Define boolean feature flags that scripts can read but not reassign
+ *
+ * Each flag is bound as a constant, so a script can branch on it with
+ * `If (FEATURE_X) { ... }` and fails with a runtime error if it reassigns
+ * it. Flags survive aether_reset_env. Either all flags are defined or none.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - defines_json: JSON object mapping flag names to booleans, e.g. `{"FEATURE_X": true}`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if all flags were defined
+ * - InvalidJSON (5) if `defines_json` is not a JSON object of booleans
+ * - InvalidArgument (7) if a key is not a valid variable name
+ */
+int aether_set_defines(struct AetherHandle *handle,
+                       const char *defines_json,
+                       char **error);
+
+/**
+ * Create an empty variable batch
+ *
+ * A batch collects name/value pairs and sets them on an engine in one call
+ * with `aether_set_var_batch`, avoiding one FFI call and one JSON round trip
+ * per variable. Call `aether_var_batch_clear` and refill it for the next
+ * evaluation; its buffers are reused.
+ *
+ * Returns: Pointer to AetherVarBatch (must be freed with aether_var_batch_free),
+ * or NULL on failure
+ */
+struct AetherVarBatch *aether_var_batch_new(void);
+
+/**
+ * Free a variable batch
+ *
+ * # Parameters
+ * - batch: Batch handle
+ */
+void aether_var_batch_free(struct AetherVarBatch *batch);
+
+/**
+ * Remove all pending assignments from a batch, keeping its buffers
+ *
+ * # Parameters
+ * - batch: Batch handle
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `batch` is NULL
+ */
+int aether_var_batch_clear(struct AetherVarBatch *batch);
+
+/**
+ * Add a number assignment to a batch
+ *
+ * # Parameters
+ * - batch: Batch handle
+ * - name: Variable name
+ * - value: Number value
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if a pointer is NULL
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_var_batch_set_number(struct AetherVarBatch *batch, const char *name, double value);
+
+/**
+ * Add a boolean assignment to a batch
+ *
+ * # Parameters
+ * - batch: Batch handle
+ * - name: Variable name
+ * - value: Non-zero for true, 0 for false
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if a pointer is NULL
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_var_batch_set_bool(struct AetherVarBatch *batch, const char *name, int value);
+
+/**
+ * Add a string assignment to a batch
+ *
+ * # Parameters
+ * - batch: Batch handle
+ * - name: Variable name
+ * - value: UTF-8 string value (copied)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if a pointer is NULL
+ * - InvalidArgument (7) if `name` is not a valid variable name or `value` is not UTF-8
+ */
+int aether_var_batch_set_string(struct AetherVarBatch *batch, const char *name, const char *value);
+
+/**
+ * Add an assignment of any JSON value (arrays, objects, null) to a batch
+ *
+ * # Parameters
+ * - batch: Batch handle
+ * - name: Variable name
+ * - value_json: Value as JSON string
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if a pointer is NULL
+ * - InvalidJSON (5) if `value_json` is not valid JSON
+ * - InvalidArgument (7) if `name` is not a valid variable name
+ */
+int aether_var_batch_set_json(struct AetherVarBatch *batch,
+                              const char *name,
+                              const char *value_json);
+
+/**
+ * Set every variable in a batch as a global, in the order they were added
+ *
+ * The batch is left unchanged, so it can be applied to several engines.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - batch: Batch handle
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if a pointer is NULL
+ */
+int aether_set_var_batch(struct AetherHandle *handle, const struct AetherVarBatch *batch);
+
+/**
+ * Forbid scripts from defining or referencing identifiers with given prefixes
+ *
+ * Checked at parse time: code using a denied name fails with a ParseError
+ * before it runs. Dictionary keys and strings are not affected. An empty
+ * array removes the restriction.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - prefixes_json: JSON array of prefix strings, e.g. `["SYSTEM_"]`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the deny list was set
+ * - InvalidJSON (5) if `prefixes_json` is not a JSON array of strings
+ */
+int aether_set_deny_list(struct AetherHandle *handle, const char *prefixes_json, char **error);
+
+/**
+ * Keep only the builtins in the given groups, disabling the rest
+ *
+ * Group names are "core", "io", "trace", "array", "dict", "string", "math",
+ * "random", "time", "precise", "json", "payroll", "filesystem" and "network".
+ * Calling a disabled builtin fails with an undefined variable error. Disabled
+ * groups cannot be enabled again on the same engine.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - groups_json: JSON array of group names, e.g. `["math", "string"]`
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the groups were applied
+ * - InvalidJSON (5) if `groups_json` is not a JSON array of strings
+ * - InvalidArgument (7) if a group name is unknown
+ */
+int aether_set_builtin_groups(struct AetherHandle *handle, const char *groups_json, char **error);
+
+/**
+ * Register a module whose top-level definitions scripts reach as `NAME.FUNC(...)`
+ *
+ * The module is only parsed here; it is evaluated the first time a script
+ * references it. Modules may reference each other, and a cycle between their
+ * top-level code fails with a `circular import detected` runtime error.
+ * Registering the same name again replaces the module.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Module name (a valid identifier, e.g. `RULES`)
+ * - code: C string containing the module's Aether code
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the module was registered
+ * - ParseError (1) if the module code does not parse
+ * - InvalidArgument (7) if `name` is not a valid identifier
+ */
+int aether_add_module(struct AetherHandle *handle,
+                      const char *name,
+                      const char *code,
+                      char **error);
+
+/**
+ * Call a function by name with JSON-encoded arguments
+ *
+ * The function is resolved like a script identifier (script functions,
+ * builtins, then host functions), so a script defining `Func CALC(A, B)` can
+ * be loaded once with `aether_eval` and then called repeatedly.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Function name
+ * - args_json: Arguments as a JSON array (e.g. `[5, 6]`)
+ * - result: Output parameter for the JSON-encoded result (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - InvalidJSON (5) if `args_json` is not a JSON array
+ * - RuntimeError (2) if the call failed
+ */
+int aether_call(struct AetherHandle *handle,
+                const char *name,
+                const char *args_json,
+                char **result,
+                char **error);
+
+/**
+ * Evaluate code that produces a function and return a callable handle
+ *
+ * The result may be a named function, a lambda (keeping its captured
+ * variables) or a builtin, e.g. `Lambda X -> (X * 2)` or `SCORE` after a
+ * `Func SCORE(...)` definition. The handle must only be called on the engine
+ * that produced it, from the thread that owns that engine.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - func: Output parameter for the function handle (must be freed with aether_function_free)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - ParseError (1) or RuntimeError (2) if evaluation failed or the result is not a function
+ */
+int aether_eval_function(struct AetherHandle *handle,
+                         const char *code,
+                         struct AetherFunction **func,
+                         char **error);
+
+/**
+ * Call a function handle with JSON-encoded arguments
+ *
+ * # Parameters
+ * - handle: Aether engine handle that produced `func`
+ * - func: Function handle from `aether_eval_function`
+ * - args_json: Arguments as a JSON array (e.g. `[5, 6]`)
+ * - result: Output parameter for the JSON-encoded result (must be freed with aether_free_string)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - InvalidJSON (5) if `args_json` is not a JSON array
+ * - RuntimeError (2) if the call failed
+ */
+int aether_function_call(struct AetherHandle *handle,
+                         const struct AetherFunction *func,
+                         const char *args_json,
+                         char **result,
+                         char **error);
+
+/**
+ * Free a function handle
+ *
+ * # Parameters
+ * - func: Function handle from `aether_eval_function`
+ */
+void aether_function_free(struct AetherFunction *func);
+
+/**
+ * Get a variable's value as JSON
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Variable name
+ * - value_json: Output parameter (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if variable was found
+ * - VariableNotFound (6) if variable doesn't exist
+ * - Non-zero error code for other failures
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `name` must be a valid pointer to a null-terminated C string
+ * - `value_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ */
+int aether_get_global(struct AetherHandle *handle,
+                      const char *name,
+                      char **value_json);
+
+/**
+ * Reset the runtime environment (clears all variables)
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ */
+void aether_reset_env(struct AetherHandle *handle);
+
+/**
+ * Load definition-only prelude code that survives `aether_reset_env`
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing only `Func`/`Generator` definitions
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - Success (0) if the prelude was loaded
+ * - ParseError (1) if the code could not be parsed
+ * - InvalidArgument (7) if the code contains non-definition statements
+ */
+int aether_load_prelude(struct AetherHandle *handle, const char *code, char **error);
+
+/**
+ * Get all trace entries as JSON array
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - trace_json: Output parameter (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if trace was retrieved
+ * - Non-zero error code if failed
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ */
+int aether_take_trace(struct AetherHandle *handle,
+                      char **trace_json);
+
+/**
+ * Clear the trace buffer
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ */
+void aether_clear_trace(struct AetherHandle *handle);
+
+/**
+ * Get structured trace entries as JSON
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - trace_json: Output parameter (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if trace was retrieved
+ * - Non-zero error code if failed
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ */
+int aether_trace_records(struct AetherHandle *handle,
+                         char **trace_json);
+
+/**
+ * Get trace statistics as JSON
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - stats_json: Output parameter (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if stats were retrieved
+ * - Non-zero error code if failed
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `stats_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ */
+int aether_trace_stats(struct AetherHandle *handle,
+                       char **stats_json);
+
+/**
+ * Set execution limits
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - limits: Limits configuration
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `limits` must be a valid pointer to an AetherLimits struct
+ */
+void aether_set_limits(struct AetherHandle *handle,
+                       const struct AetherLimits *limits);
+
+/**
+ * Get current execution limits
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - limits: Output parameter
+ *
+ * # Safety
+ * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+ * - `limits` must be a valid pointer to an AetherLimits struct that will be filled with the current limits
+ */
+void aether_get_limits(struct AetherHandle *handle,
+                       struct AetherLimits *limits);
+
+/**
+ * Get every limit configured on the engine as JSON
+ *
+ * Unlike `aether_get_limits`, this also covers the limits set individually
+ * (result size, array length, output bytes, functions, nesting depth), e.g.
+ * `{"max_steps": 100000, "max_array_length": 100000, "max_output_bytes": null, ...}`.
+ * `null` means unlimited.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - limits_json: Output parameter for the JSON object (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_get_configured_limits(struct AetherHandle *handle, char **limits_json);
+
+/**
+ * Set the engine name used to label errors and trace records
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: C string with the name, or NULL to clear it
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_name(struct AetherHandle *handle, const char *name);
+
+/**
+ * Set the maximum size of an evaluation result
+ *
+ * Results whose string form is larger than `max_bytes` are refused with a
+ * RuntimeError before being copied across the FFI boundary.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - max_bytes: Maximum result size in bytes (negative = unlimited)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_max_result_size(struct AetherHandle *handle, int max_bytes);
+
+/**
+ * Set the maximum number of elements a single array may hold
+ *
+ * Building or growing an array past the limit aborts evaluation with a
+ * RuntimeError.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - max_length: Maximum array length (negative = unlimited)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_max_array_length(struct AetherHandle *handle, int max_length);
+
+/**
+ * Set the maximum number of bytes PRINT/PRINTLN may write per evaluation
+ *
+ * Bytes are counted as they are written to stdout, the `aether_set_output`
+ * callback or captured output, and the count restarts with every top-level
+ * evaluation. Output that would exceed the limit is not written; evaluation
+ * aborts with an "Output limit exceeded" RuntimeError instead.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - max_bytes: Maximum output bytes (negative = unlimited)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_max_output_bytes(struct AetherHandle *handle, int max_bytes);
+
+/**
+ * Set the maximum number of functions a script may define per evaluation
+ *
+ * Every evaluated `Func` or `Generator` definition counts once, and the count
+ * restarts with every top-level evaluation. Prelude functions are not counted.
+ * A definition that would exceed the limit is not made; evaluation aborts
+ * with a "Function definition limit exceeded" RuntimeError instead.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - max_functions: Maximum number of definitions (negative = unlimited)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_max_functions(struct AetherHandle *handle, int max_functions);
+
+/**
+ * Set the maximum nesting depth accepted by the parser
+ *
+ * Every `{ }` block and every parenthesis, array, dictionary, call or index
+ * bracket opens one level. Deeper code is rejected with a "Nesting too deep"
+ * ParseError before it can exhaust the parser's stack. Changing the limit
+ * clears the AST cache.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - max_depth: Maximum nesting depth (negative = unlimited)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_max_nesting_depth(struct AetherHandle *handle, int max_depth);
+
+/**
+ * Forbid recursive calls to user functions
+ *
+ * When enabled, calling a function that is already running, directly or
+ * through other functions, fails with a "Recursion is not allowed" runtime
+ * error. This guarantees call chains are finite; loops are unaffected.
+ * Tail-call optimization is skipped while enabled.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - enabled: non-zero to forbid recursion, 0 to allow it (default)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_no_recursion(struct AetherHandle *handle, int enabled);
+
+/**
+ * Call a host callback when evaluation approaches a limit
+ *
+ * The callback fires the first time usage reaches `percent` (clamped to
+ * 1..=100) of a configured limit: steps, recursion depth, duration or array
+ * length. Each kind warns at most once per evaluation. Unset limits never warn.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - percent: Threshold as a percentage of the limit
+ * - callback: Warning callback (see `AetherLimitWarningCallback`); NULL removes the hook
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_limit_warning_hook(struct AetherHandle *handle,
+                                  int percent,
+                                  AetherLimitWarningCallback callback,
+                                  void *user_data);
+
+/**
+ * Call a host callback every `every` steps of an evaluation, e.g. to show progress
+ *
+ * Steps are counted like the step limit and restart with each evaluation;
+ * `every` is raised to at least 1. Pair it with an interrupt handle to cancel
+ * long-running scripts from the callback or another thread.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - every: Number of steps between calls
+ * - callback: Progress callback (see `AetherProgressCallback`); NULL removes the hook
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_progress_hook(struct AetherHandle *handle,
+                             uint64_t every,
+                             AetherProgressCallback callback,
+                             void *user_data);
+
+/**
+ * Call a host callback before every function call, e.g. for audit logging
+ *
+ * Recursive calls fire once per level, except self tail calls that the
+ * optimizer turns into loops (disable it with `aether_set_optimization`).
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - callback: Call hook (see `AetherCallHookCallback`); NULL removes the hook
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_call_hook(struct AetherHandle *handle,
+                         AetherCallHookCallback callback,
+                         void *user_data);
+
+/**
+ * Get the IO permissions of an engine
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - permissions: Output parameter (each field is 1 if enabled, 0 otherwise)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if either pointer is NULL
+ */
+int aether_get_permissions(struct AetherHandle *handle, struct AetherPermissions *permissions);
+
+/**
+ * Set integer overflow behavior for `+`, `-` and `*`
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - mode: 0 = Error (default), 1 = Wrap, 2 = Saturate, 3 = BigInt (promote to
+ *   arbitrary-precision integers; read results with `aether_eval_bigint`)
  *
- * Returns: Pointer to AetherHandle (must be freed with aether_free)
+ * # Returns
+ * - Success (0) on success
+ * - InvalidArgument (7) if `mode` is not a known value
  */
-struct AetherHandle *aether_new(void);
+int aether_set_int_overflow(struct AetherHandle *handle, int mode);
 
 /**
- * Create a new Aether engine with all IO permissions enabled
+ * Set the behavior of `+` between a string and a non-string
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - mode: 0 = Strict (default, type error), 1 = Coerce (stringify the other side)
  *
- * Returns: Pointer to AetherHandle (must be freed with aether_free)
+ * # Returns
+ * - Success (0) on success
+ * - InvalidArgument (7) if `mode` is not a known value
  */
-struct AetherHandle *aether_new_with_permissions(void);
+int aether_set_string_coercion(struct AetherHandle *handle, int mode);
 
 /**
- * Evaluate Aether code
+ * Set the behavior of `/` and `%` when the divisor is zero
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - mode: 0 = Error (default, runtime error), 1 = Infinity (IEEE 754 result:
+ *   +/-infinity, or NaN for `0 / 0` and `%`), 2 = Zero (result is 0)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - InvalidArgument (7) if `mode` is not a known value
+ */
+int aether_set_div_by_zero(struct AetherHandle *handle, int mode);
+
+/**
+ * Make `/` between integers that do not divide evenly yield exact fractions
+ *
+ * When enabled, `(1 / 3)` evaluates to the fraction `1/3` instead of a float,
+ * and later `+`, `-`, `*` and `/` with integers or fractions stay exact.
+ * Results are returned as `"numer/denom"` strings (a JSON string in JSON
+ * output); even quotients such as `(6 / 3)` stay plain numbers. Fractions use
+ * big integers and are much slower than numbers.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - enabled: non-zero to enable, 0 to disable (default)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_rational_division(struct AetherHandle *handle, int enabled);
+
+/**
+ * Seed the engine's RNG used by RANDOM/RANDOM_INT
+ *
+ * The seed only affects this engine; the same seed yields the same sequence.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - seed: RNG seed
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_seed(struct AetherHandle *handle, uint64_t seed);
+
+/**
+ * Freeze the time returned by NOW()
+ *
+ * NOW() returns `seconds` instead of reading the system clock until
+ * aether_clear_clock is called. Combined with aether_set_seed this makes
+ * evaluation fully deterministic.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - seconds: Seconds since the Unix epoch (UTC), may be fractional or negative
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ * - InvalidArgument (7) if `seconds` is not a representable time (NaN, infinite)
+ */
+int aether_set_clock(struct AetherHandle *handle, double seconds);
+
+/**
+ * Make NOW() read the system clock again after aether_set_clock
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_clear_clock(struct AetherHandle *handle);
+
+/**
+ * Register a host function on a single engine
+ *
+ * Script variables and builtins with the same name take precedence.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Function name as seen by scripts
+ * - arity: Number of arguments the function takes
+ * - callback: Host callback (see `AetherHostCallback`)
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle`, `name` or `callback` is NULL
+ */
+int aether_register_function(struct AetherHandle *handle,
+                             const char *name,
+                             int arity,
+                             AetherHostCallback callback,
+                             void *user_data);
+
+/**
+ * Register a context-aware host function on a single engine
+ *
+ * The callback receives the `context` pointer passed to
+ * `aether_eval_with_context`, e.g. a per-request DB handle.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - name: Function name as seen by scripts
+ * - arity: Number of arguments the function takes
+ * - callback: Host callback (see `AetherHostContextCallback`)
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle`, `name` or `callback` is NULL
+ */
+int aether_register_function_with_context(struct AetherHandle *handle,
+                                          const char *name,
+                                          int arity,
+                                          AetherHostContextCallback callback,
+                                          void *user_data);
+
+/**
+ * Evaluate Aether code with a per-call context pointer
+ *
+ * `context` is handed to context-aware host functions (see
+ * `aether_register_function_with_context`) for the duration of this call only.
  *
  * # Parameters
  * - handle: Aether engine handle
  * - code: C string containing Aether code
+ * - context: Opaque pointer passed to context-aware callbacks (may be NULL)
  * - result: Output parameter for result (must be freed with aether_free_string)
  * - error: Output parameter for error message (must be freed with aether_free_string)
  *
@@ -62,165 +2105,354 @@ struct AetherHandle *aether_new_with_permissions(void);
  * - 0 (Success) if evaluation succeeded
  * - Non-zero error code if evaluation failed
  */
-int aether_eval(struct AetherHandle *handle, const char *code, char **result, char **error);
+int aether_eval_with_context(struct AetherHandle *handle,
+                             const char *code,
+                             void *context,
+                             char **result,
+                             char **error);
 
 /**
- * Get the version string of Aether
+ * Get a handle that can interrupt the engine's evaluation from another thread
  *
- * Returns: C string with version (must NOT be freed)
+ * The engine itself must not be used concurrently; pass this handle to the
+ * other thread instead.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ *
+ * Returns: Pointer to AetherInterrupt (must be freed with aether_interrupt_free),
+ * or NULL if `handle` is NULL
  */
-const char *aether_version(void);
+struct AetherInterrupt *aether_interrupt_handle(struct AetherHandle *handle);
 
 /**
- * Free an Aether engine handle
+ * Interrupt the evaluation currently running on the handle's engine
+ *
+ * The evaluation stops before its next statement and fails with
+ * RuntimeError ("Evaluation interrupted"); the engine stays usable. Safe to
+ * call from any thread. Interrupts sent while the engine is idle are ignored.
+ *
+ * # Parameters
+ * - interrupt: Interrupt handle from aether_interrupt_handle
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `interrupt` is NULL
  */
-void aether_free(struct AetherHandle *handle);
+int aether_interrupt(struct AetherInterrupt *interrupt);
 
 /**
- * Free a string allocated by Aether
+ * Free an interrupt handle
+ *
+ * The engine is not affected; this is safe to call before or after aether_free.
+ *
+ * # Parameters
+ * - interrupt: Interrupt handle
  */
-void aether_free_string(char *s);
+void aether_interrupt_free(struct AetherInterrupt *interrupt);
 
 /**
- * Set a global variable from host application
+ * Create a host function registry that can be shared by several engines
+ *
+ * Returns: Pointer to AetherRegistry (must be freed with aether_registry_free),
+ * or null if construction panicked
+ */
+struct AetherRegistry *aether_registry_new(void);
+
+/**
+ * Free a host function registry
+ *
+ * Engines the registry is attached to keep their own reference, so this is
+ * safe to call while they are still alive.
+ *
+ * # Parameters
+ * - registry: Registry handle
+ */
+void aether_registry_free(struct AetherRegistry *registry);
+
+/**
+ * Register a host function in a shared registry
+ *
+ * The function becomes visible immediately to every engine the registry is
+ * attached to. The registry can be read concurrently by engines on other threads.
+ *
+ * # Parameters
+ * - registry: Registry handle
+ * - name: Function name as seen by scripts
+ * - arity: Number of arguments the function takes
+ * - callback: Host callback (see `AetherHostCallback`)
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `registry`, `name` or `callback` is NULL
+ */
+int aether_registry_register(struct AetherRegistry *registry,
+                             const char *name,
+                             int arity,
+                             AetherHostCallback callback,
+                             void *user_data);
+
+/**
+ * Attach a shared host function registry to an engine
  *
  * # Parameters
  * - handle: Aether engine handle
- * - name: Variable name
- * - value_json: Variable value as JSON string
+ * - registry: Registry handle
  *
  * # Returns
- * - 0 (Success) if variable was set
- * - Non-zero error code if failed
+ * - Success (0) on success
+ * - NullPointer (3) if either handle is NULL
+ */
+int aether_attach_registry(struct AetherHandle *handle, const struct AetherRegistry *registry);
+
+/**
+ * Create read-only data that several engines can share without copying
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `name` must be a valid pointer to a null-terminated C string
- * - `value_json` must be a valid pointer to a null-terminated C string
+ * The data is stored once; binding it to engines with `aether_set_shared_data`
+ * does not copy it, and engines on different threads may read it concurrently.
+ *
+ * # Parameters
+ * - value_json: Data as JSON string
+ * - data: Output parameter for the shared data handle (must be freed with aether_shared_data_free)
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) on success
+ * - InvalidJSON (5) if `value_json` is not valid JSON
  */
-int aether_set_global(struct AetherHandle *handle,
-                      const char *name,
-                      const char *value_json);
+int aether_shared_data_new(const char *value_json,
+                           struct AetherSharedData **data,
+                           char **error);
 
 /**
- * Get a variable's value as JSON
+ * Free a shared data handle
+ *
+ * Engines the data is bound to keep their own reference, so this is safe to
+ * call while they are still alive.
+ *
+ * # Parameters
+ * - data: Shared data handle
+ */
+void aether_shared_data_free(struct AetherSharedData *data);
+
+/**
+ * Bind shared data to a global name that scripts can read but not modify
+ *
+ * Indexing the name (`NAME["key"][0]`) reads straight from the shared data and
+ * copies only the selected element. As with constants, scripts cannot rebind
+ * or modify the name, and the binding survives `aether_reset_env`.
  *
  * # Parameters
  * - handle: Aether engine handle
  * - name: Variable name
- * - value_json: Output parameter (must be freed with aether_free_string)
+ * - data: Shared data handle
+ * - error: Output parameter for error message (must be freed with aether_free_string)
  *
  * # Returns
- * - 0 (Success) if variable was found
- * - VariableNotFound (6) if variable doesn't exist
- * - Non-zero error code for other failures
- *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `name` must be a valid pointer to a null-terminated C string
- * - `value_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ * - 0 (Success) on success
+ * - InvalidArgument (7) if `name` is not a valid variable name
  */
-int aether_get_global(struct AetherHandle *handle,
-                      const char *name,
-                      char **value_json);
+int aether_set_shared_data(struct AetherHandle *handle,
+                           const char *name,
+                           const struct AetherSharedData *data,
+                           char **error);
 
 /**
- * Reset the runtime environment (clears all variables)
+ * Send PRINT/PRINTLN output to a host callback instead of stdout
+ *
+ * If the callback rejects a chunk (returns non-zero), the running evaluation
+ * aborts with a RuntimeError whose message starts with "Output error".
  *
  * # Parameters
  * - handle: Aether engine handle
+ * - callback: Output callback (see `AetherOutputCallback`); NULL restores stdout
+ * - user_data: Opaque pointer passed back to the callback
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
  */
-void aether_reset_env(struct AetherHandle *handle);
+int aether_set_output(struct AetherHandle *handle,
+                      AetherOutputCallback callback,
+                      void *user_data);
 
 /**
- * Get all trace entries as JSON array
+ * Treat static analysis warnings as errors
+ *
+ * While enabled, code with any warning reported by validation (such as a
+ * variable that is set but never read) is not evaluated; evaluation fails
+ * with a ParseError listing every warning. Changing the setting clears the
+ * AST cache.
  *
  * # Parameters
  * - handle: Aether engine handle
- * - trace_json: Output parameter (must be freed with aether_free_string)
+ * - enabled: Non-zero to reject code with warnings, 0 to allow it again
  *
  * # Returns
- * - 0 (Success) if trace was retrieved
- * - Non-zero error code if failed
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ */
+int aether_set_warnings_as_errors(struct AetherHandle *handle, int enabled);
+
+/**
+ * Forbid PRINT/PRINTLN output
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ * While enabled, any PRINT or PRINTLN call aborts evaluation with a
+ * RuntimeError ("Output error: ...") instead of printing, which proves a
+ * script is output-free.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - enabled: Non-zero to forbid output, 0 to allow it again
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
  */
-int aether_take_trace(struct AetherHandle *handle,
-                      char **trace_json);
+int aether_set_no_output(struct AetherHandle *handle, int enabled);
 
 /**
- * Clear the trace buffer
+ * Emit dictionary keys in sorted order
+ *
+ * Dictionaries are hash maps, so by default their keys come out in an
+ * unspecified order that can change between runs. While enabled, PRINT,
+ * PRINTLN and every string or JSON result returned by this API list keys in
+ * byte order, including in nested dictionaries.
  *
  * # Parameters
  * - handle: Aether engine handle
+ * - enabled: Non-zero to sort keys, 0 for the default order
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
  */
-void aether_clear_trace(struct AetherHandle *handle);
+int aether_set_sorted_map_keys(struct AetherHandle *handle, int enabled);
 
 /**
- * Get structured trace entries as JSON
+ * Format numbers in PRINT/PRINTLN output and string coercion for a locale
+ *
+ * `tag` is a BCP-47 language tag such as `"en-US"` (`1,234,567.5`) or
+ * `"de-DE"` (`1.234.567,5`). An empty string restores the locale-independent
+ * default (`1234567.5`). Result values and JSON are not affected.
  *
  * # Parameters
  * - handle: Aether engine handle
- * - trace_json: Output parameter (must be freed with aether_free_string)
+ * - tag: BCP-47 language tag, or `""` to reset
+ * - error: Output parameter for error message (must be freed with aether_free_string)
  *
  * # Returns
- * - 0 (Success) if trace was retrieved
- * - Non-zero error code if failed
+ * - Success (0) on success
+ * - NullPointer (3) if `handle`, `tag` or `error` is NULL
+ * - InvalidArgument (7) if `tag` is not valid UTF-8 or names an unsupported locale
+ */
+int aether_set_locale(struct AetherHandle *handle, const char *tag, char **error);
+
+/**
+ * Set the text PRINT/PRINTLN put between their arguments
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ * The default is a single space. Applies to stdout, `aether_set_output`
+ * callbacks and captured output alike.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - separator: Separator text, e.g. `","`
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` or `separator` is NULL
+ * - InvalidArgument (7) if `separator` is not valid UTF-8
  */
-int aether_trace_records(struct AetherHandle *handle,
-                         char **trace_json);
+int aether_set_print_separator(struct AetherHandle *handle, const char *separator);
 
 /**
- * Get trace statistics as JSON
+ * Set the text PRINTLN appends after its arguments
+ *
+ * The default is `"\n"`; PRINT never appends a terminator.
  *
  * # Parameters
  * - handle: Aether engine handle
- * - stats_json: Output parameter (must be freed with aether_free_string)
+ * - terminator: Terminator text, e.g. `""` or `"\r\n"`
  *
  * # Returns
- * - 0 (Success) if stats were retrieved
- * - Non-zero error code if failed
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` or `terminator` is NULL
+ * - InvalidArgument (7) if `terminator` is not valid UTF-8
+ */
+int aether_set_print_terminator(struct AetherHandle *handle, const char *terminator);
+
+/**
+ * Evaluate Aether code and stream the result as JSON to a callback
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `stats_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+ * The JSON is written in chunks through `callback` (see `AetherOutputCallback`)
+ * as it is encoded, so large arrays are never held in memory as one string.
+ * Nothing is written if evaluation fails. If the callback rejects a chunk,
+ * the JSON written so far is incomplete and a RuntimeError is returned.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - code: C string containing Aether code
+ * - callback: Receives the JSON chunks; must not be NULL
+ * - user_data: Opaque pointer passed back to the callback
+ * - error: Output parameter for error message (must be freed with aether_free_string)
+ *
+ * # Returns
+ * - 0 (Success) if the whole result was written
+ * - Non-zero error code if evaluation or writing failed
  */
-int aether_trace_stats(struct AetherHandle *handle,
-                       char **stats_json);
+int aether_eval_json_to(struct AetherHandle *handle,
+                        const char *code,
+                        AetherOutputCallback callback,
+                        void *user_data,
+                        char **error);
 
 /**
- * Set execution limits
+ * Evaluate Aether code and pass the result to a callback one element at a time
+ *
+ * If the result is an array, `callback` receives each element with its index
+ * in order; any other result is passed once with index 0. A non-zero return
+ * from the callback stops the iteration and a RuntimeError naming the index
+ * is returned. The callback is not called if evaluation fails.
  *
  * # Parameters
  * - handle: Aether engine handle
- * - limits: Limits configuration
+ * - code: C string containing Aether code
+ * - callback: Receives the elements as JSON; must not be NULL
+ * - user_data: Opaque pointer passed back to the callback
+ * - error: Output parameter for error message (must be freed with aether_free_string)
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `limits` must be a valid pointer to an AetherLimits struct
+ * # Returns
+ * - 0 (Success) if every element was delivered
+ * - Non-zero error code if evaluation failed or the callback stopped the iteration
  */
-void aether_set_limits(struct AetherHandle *handle,
-                       const struct AetherLimits *limits);
+int aether_eval_for_each(struct AetherHandle *handle,
+                         const char *code,
+                         AetherForEachCallback callback,
+                         void *user_data,
+                         char **error);
 
 /**
- * Get current execution limits
+ * Route the engine's file builtins through host callbacks
+ *
+ * While set, `READ_FILE`, `WRITE_FILE`, `APPEND_FILE` and `FILE_EXISTS` never
+ * touch the disk; the remaining file builtins fail with a runtime error. The
+ * file builtins are only available when the engine has filesystem permission.
  *
  * # Parameters
  * - handle: Aether engine handle
- * - limits: Output parameter
+ * - read: Read callback (see `AetherReadFileCallback`); NULL restores the real file system
+ * - write: Write callback (see `AetherWriteFileCallback`); NULL denies all writes
+ * - user_data: Opaque pointer passed back to the callbacks
  *
- * # Safety
- * - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
- * - `limits` must be a valid pointer to an AetherLimits struct that will be filled with the current limits
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
  */
-void aether_get_limits(struct AetherHandle *handle,
-                       struct AetherLimits *limits);
+int aether_set_file_system(struct AetherHandle *handle,
+                           AetherReadFileCallback read,
+                           AetherWriteFileCallback write,
+                           void *user_data);
 
 /**
  * Clear the AST cache
@@ -258,6 +2490,25 @@ void aether_set_optimization(struct AetherHandle *handle,
                              int dead_code_elimination,
                              int tail_recursion);
 
+/**
+ * Set the optimization level used when compiling code
+ *
+ * Levels: 0 disables all optimizations, 1 only folds constant expressions
+ * (e.g. `(2 + 3)` compiles to `5`), 2 or more enables every optimization
+ * (the default). Use `aether_disassemble` to inspect the result. Clears the
+ * AST cache, since cached programs were optimized with the old settings.
+ *
+ * # Parameters
+ * - handle: Aether engine handle
+ * - level: Optimization level (0, 1 or 2)
+ *
+ * # Returns
+ * - Success (0) on success
+ * - NullPointer (3) if `handle` is NULL
+ * - InvalidArgument (7) if `level` is negative
+ */
+int aether_set_optimization_level(struct AetherHandle *handle, int level);
+
 extern void log(const str *s);
 
 #ifdef __cplusplus
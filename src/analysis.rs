@@ -0,0 +1,1205 @@
+// src/analysis.rs
+//! Static analysis passes over the AST
+//!
+//! These passes never execute code. They report [`Diagnostic`]s that help script
+//! authors catch mistakes, such as setting `SUMM` but reading `SUM`, and infer
+//! the [`TypeKind`] a program would produce.
+
+use std::collections::{HashMap, HashSet};
+
+use serde::Serialize;
+
+use crate::ast::{BinOp, Expr, Position, Program, Stmt, UnaryOp};
+use crate::builtins::{FILESYSTEM_FUNCTIONS, IOPermissions, NETWORK_FUNCTIONS};
+use crate::parser::ParseError;
+use crate::value::Value;
+
+/// Diagnostic severity
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+#[serde(rename_all = "lowercase")]
+pub enum Severity {
+    Error,
+    Warning,
+}
+
+/// A problem found by static analysis
+#[derive(Debug, Clone, PartialEq, Serialize)]
+pub struct Diagnostic {
+    pub severity: Severity,
+    /// Stable machine-readable code, e.g. `unused-variable`
+    pub code: &'static str,
+    pub message: String,
+    /// 1-based line of the offending statement (0 if unknown)
+    pub line: usize,
+    /// 1-based column of the offending statement (0 if unknown)
+    pub column: usize,
+    /// 1-based line where the range ends (same as `line` when only a point is known)
+    pub end_line: usize,
+    /// 1-based column just past the range (same as `column` when only a point is known)
+    pub end_column: usize,
+}
+
+impl Diagnostic {
+    fn at(
+        severity: Severity,
+        code: &'static str,
+        message: String,
+        position: Option<Position>,
+    ) -> Self {
+        let (line, column) = position.map_or((0, 0), |p| (p.line, p.column));
+        Diagnostic {
+            severity,
+            code,
+            message,
+            line,
+            column,
+            end_line: line,
+            end_column: column,
+        }
+    }
+
+    /// Narrow the range to the first whole-word `name` at or after the start
+    fn locate(mut self, source: &str, name: &str) -> Self {
+        if self.line == 0 {
+            return self;
+        }
+        for (offset, text) in source.lines().skip(self.line - 1).enumerate() {
+            let chars: Vec<char> = text.chars().collect();
+            let from = if offset == 0 {
+                self.column.saturating_sub(1)
+            } else {
+                0
+            };
+            if let Some(start) = find_word(&chars, from, name) {
+                self.line += offset;
+                self.column = start + 1;
+                self.end_line = self.line;
+                self.end_column = self.column + name.chars().count();
+                break;
+            }
+        }
+        self
+    }
+}
+
+/// Char index of the first occurrence of identifier `word` in `chars[from..]`
+fn find_word(chars: &[char], from: usize, word: &str) -> Option<usize> {
+    let word: Vec<char> = word.chars().collect();
+    let is_ident = |c: char| c.is_alphanumeric() || c == '_';
+    (from..chars.len()).find(|&i| {
+        chars[i..].starts_with(&word)
+            && (i == 0 || !is_ident(chars[i - 1]))
+            && chars.get(i + word.len()).is_none_or(|c| !is_ident(*c))
+    })
+}
+
+/// How many shorter prefixes to try re-parsing after a parse error
+const PREFIX_ATTEMPTS: usize = 32;
+
+/// A parsed program with its statement positions
+type Parsed = Result<(Program, Vec<Position>), ParseError>;
+
+/// Collect every diagnostic for `source` for editor integration
+///
+/// A parse error is reported as an `Error` with the parse error's code; the
+/// longest run of lines before it that parses on its own (ending at most
+/// 32 lines above the error) is still checked for undefined
+/// identifiers. Otherwise the result combines undefined identifiers (errors)
+/// and unused variables (warnings), with ranges narrowed to the identifier.
+/// `is_known` tells which names exist before the program runs (builtins, host
+/// functions and globals).
+pub fn diagnostics(
+    source: &str,
+    parse: &dyn Fn(&str) -> Parsed,
+    is_known: &dyn Fn(&str) -> bool,
+) -> Vec<Diagnostic> {
+    match parse(source) {
+        Ok((program, positions)) => {
+            let mut diagnostics = undefined_with_names(&program, &positions, is_known);
+            diagnostics.extend(unused_with_names(&program, &positions));
+            diagnostics
+                .into_iter()
+                .map(|(name, diagnostic)| diagnostic.locate(source, &name))
+                .collect()
+        }
+        Err(error) => {
+            let position = error.position();
+            let mut parse_error =
+                Diagnostic::at(Severity::Error, error.code(), error.to_string(), position);
+            if parse_error.line > 0 {
+                parse_error.end_column += 1;
+            }
+            let mut diagnostics = vec![parse_error];
+
+            let lines: Vec<&str> = source.lines().collect();
+            let error_line = position.map_or(0, |p| p.line).min(lines.len() + 1);
+            for end in (1..error_line).rev().take(PREFIX_ATTEMPTS) {
+                let prefix = lines[..end].join("\n");
+                if let Ok((program, positions)) = parse(&prefix) {
+                    diagnostics.extend(
+                        undefined_with_names(&program, &positions, is_known)
+                            .into_iter()
+                            .map(|(name, diagnostic)| diagnostic.locate(&prefix, &name)),
+                    );
+                    break;
+                }
+            }
+            diagnostics
+        }
+    }
+}
+
+/// Report variables that are `Set` but never read anywhere in the program
+///
+/// The check is by name and ignores control flow: a variable counts as read if
+/// it is referenced anywhere (including inside functions) or exported. Each
+/// unused variable is reported once, at its first `Set`.
+///
+/// `positions` are the statement positions returned by
+/// `Parser::parse_program_with_positions`.
+pub fn unused_variables(program: &Program, positions: &[Position]) -> Vec<Diagnostic> {
+    unused_with_names(program, positions)
+        .into_iter()
+        .map(|(_, diagnostic)| diagnostic)
+        .collect()
+}
+
+fn unused_with_names(program: &Program, positions: &[Position]) -> Vec<(String, Diagnostic)> {
+    let mut collector = Collector::new(positions);
+    collector.block(program);
+
+    collector
+        .sets
+        .iter()
+        .filter(|name| !collector.reads.contains(*name))
+        .map(|name| {
+            let diagnostic = Diagnostic::at(
+                Severity::Warning,
+                "unused-variable",
+                format!("Variable '{}' is set but never read", name),
+                collector.first_set[name],
+            );
+            (name.clone(), diagnostic)
+        })
+        .collect()
+}
+
+/// Report identifiers that are read but never defined
+///
+/// Like [`unused_variables`], the check is by name: a name counts as defined if
+/// it is `Set`, declared as a function, parameter, loop variable or import
+/// anywhere in the program, or if `is_known` accepts it. Each name is reported
+/// once, at the first statement reading it.
+pub fn undefined_identifiers(
+    program: &Program,
+    positions: &[Position],
+    is_known: &dyn Fn(&str) -> bool,
+) -> Vec<Diagnostic> {
+    undefined_with_names(program, positions, is_known)
+        .into_iter()
+        .map(|(_, diagnostic)| diagnostic)
+        .collect()
+}
+
+fn undefined_with_names(
+    program: &Program,
+    positions: &[Position],
+    is_known: &dyn Fn(&str) -> bool,
+) -> Vec<(String, Diagnostic)> {
+    let mut collector = Collector::new(positions);
+    collector.block(program);
+
+    collector
+        .first_reads
+        .iter()
+        .filter(|(name, _)| !collector.defined.contains(name) && !is_known(name))
+        .map(|(name, position)| {
+            let diagnostic = Diagnostic::at(
+                Severity::Error,
+                "undefined-identifier",
+                format!("Identifier '{}' is not defined", name),
+                *position,
+            );
+            (name.clone(), diagnostic)
+        })
+        .collect()
+}
+
+/// List the free variables of a program: names it reads but never binds
+///
+/// Names are returned once each, in order of first read. As with
+/// [`undefined_identifiers`] the check is by name, so `Set`, function and
+/// lambda parameters, loop variables and imports anywhere in the program bind
+/// a name everywhere. Names accepted by `is_provided` (for example builtins and
+/// host functions) are left out.
+pub fn free_variables(program: &Program, is_provided: &dyn Fn(&str) -> bool) -> Vec<String> {
+    let mut collector = Collector::new(&[]);
+    collector.block(program);
+
+    collector
+        .first_reads
+        .into_iter()
+        .map(|(name, _)| name)
+        .filter(|name| !collector.defined.contains(name) && !is_provided(name))
+        .collect()
+}
+
+/// Report the IO permissions a program would need to run
+///
+/// A permission is required if the program references any of its builtins by
+/// name anywhere, including inside functions that are never called or when
+/// passing the builtin as a value. IO reached without naming the builtin in
+/// this program, such as through host functions or imported modules, is not
+/// detected.
+pub fn required_permissions(program: &Program) -> IOPermissions {
+    let mut collector = Collector::new(&[]);
+    collector.block(program);
+
+    let uses_any = |names: &[&str]| names.iter().any(|name| collector.reads.contains(*name));
+    IOPermissions {
+        filesystem_enabled: uses_any(FILESYSTEM_FUNCTIONS),
+        network_enabled: uses_any(NETWORK_FUNCTIONS),
+    }
+}
+
+struct Collector<'a> {
+    positions: std::slice::Iter<'a, Position>,
+    /// Set variable names in order of first assignment
+    sets: Vec<String>,
+    first_set: HashMap<String, Option<Position>>,
+    reads: HashSet<String>,
+    /// Read names in order of first read, with the statement reading them
+    first_reads: Vec<(String, Option<Position>)>,
+    /// Names bound anywhere: variables, functions, parameters, loop variables, imports
+    defined: HashSet<String>,
+    /// Position of the statement being visited
+    current: Option<Position>,
+}
+
+impl<'a> Collector<'a> {
+    fn new(positions: &'a [Position]) -> Self {
+        Collector {
+            positions: positions.iter(),
+            sets: Vec::new(),
+            first_set: HashMap::new(),
+            reads: HashSet::new(),
+            first_reads: Vec::new(),
+            defined: HashSet::new(),
+            current: None,
+        }
+    }
+
+    fn read(&mut self, name: &str) {
+        if self.reads.insert(name.to_string()) {
+            self.first_reads.push((name.to_string(), self.current));
+        }
+    }
+
+    fn define<'n>(&mut self, names: impl IntoIterator<Item = &'n String>) {
+        self.defined.extend(names.into_iter().cloned());
+    }
+    fn block(&mut self, stmts: &[Stmt]) {
+        for stmt in stmts {
+            self.stmt(stmt);
+        }
+    }
+
+    fn stmt(&mut self, stmt: &Stmt) {
+        // Positions are in pre-order, so take this one before nested statements
+        let position = self.positions.next().copied();
+        self.current = position;
+
+        match stmt {
+            Stmt::Set { name, value } => {
+                if !self.first_set.contains_key(name) {
+                    self.first_set.insert(name.clone(), position);
+                    self.sets.push(name.clone());
+                }
+                self.define([name]);
+                self.expr(value);
+            }
+            Stmt::SetIndex {
+                object,
+                index,
+                value,
+            } => {
+                self.expr(object);
+                self.expr(index);
+                self.expr(value);
+            }
+            Stmt::FuncDef { name, params, body } | Stmt::GeneratorDef { name, params, body } => {
+                self.define(std::iter::once(name).chain(params));
+                self.block(body);
+            }
+            Stmt::LazyDef { name, expr } => {
+                self.define([name]);
+                self.expr(expr);
+            }
+            Stmt::Return(e) | Stmt::Yield(e) | Stmt::Throw(e) | Stmt::Expression(e) => self.expr(e),
+            Stmt::Break | Stmt::Continue => {}
+            Stmt::Import {
+                names,
+                aliases,
+                namespace,
+                ..
+            } => {
+                let aliased = names
+                    .iter()
+                    .zip(aliases)
+                    .map(|(name, alias)| alias.as_ref().unwrap_or(name));
+                self.define(aliased.chain(namespace));
+            }
+            Stmt::While { condition, body } => {
+                self.expr(condition);
+                self.block(body);
+            }
+            Stmt::For {
+                var,
+                iterable,
+                body,
+            } => {
+                self.define([var]);
+                self.expr(iterable);
+                self.block(body);
+            }
+            Stmt::ForIndexed {
+                index_var,
+                value_var,
+                iterable,
+                body,
+            } => {
+                self.define([index_var, value_var]);
+                self.expr(iterable);
+                self.block(body);
+            }
+            Stmt::Switch {
+                expr,
+                cases,
+                default,
+            } => {
+                self.expr(expr);
+                for (value, body) in cases {
+                    self.expr(value);
+                    self.block(body);
+                }
+                if let Some(body) = default {
+                    self.block(body);
+                }
+            }
+            Stmt::Export(name) => self.read(name),
+        }
+    }
+
+    fn expr(&mut self, expr: &Expr) {
+        match expr {
+            Expr::Number(_)
+            | Expr::BigInteger(_)
+            | Expr::String(_)
+            | Expr::Boolean(_)
+            | Expr::Null => {}
+            Expr::Identifier(name) => self.read(name),
+            Expr::Binary { left, right, .. } => {
+                self.expr(left);
+                self.expr(right);
+            }
+            Expr::Unary { expr, .. } => self.expr(expr),
+            Expr::Call { func, args } => {
+                self.expr(func);
+                for arg in args {
+                    self.expr(arg);
+                }
+            }
+            Expr::Array(items) => {
+                for item in items {
+                    self.expr(item);
+                }
+            }
+            Expr::Dict(entries) => {
+                for (_, value) in entries {
+                    self.expr(value);
+                }
+            }
+            Expr::Index { object, index } => {
+                self.expr(object);
+                self.expr(index);
+            }
+            Expr::If {
+                condition,
+                then_branch,
+                elif_branches,
+                else_branch,
+            } => {
+                self.expr(condition);
+                self.block(then_branch);
+                for (cond, body) in elif_branches {
+                    self.expr(cond);
+                    self.block(body);
+                }
+                if let Some(body) = else_branch {
+                    self.block(body);
+                }
+            }
+            Expr::Lambda { params, body } => {
+                self.define(params);
+                self.block(body);
+            }
+        }
+    }
+}
+
+/// Check that a program is a single expression without side effects or definitions
+///
+/// The program must be exactly one expression statement, and `If` branches
+/// inside it may only contain expressions. Lambdas are rejected as
+/// definitions. `purity` classifies names: `None` for plain variables,
+/// `Some(true)` for functions without side effects and `Some(false)` for the
+/// rest. Calls must name a pure function, and naming an impure function
+/// anywhere (such as passing `PRINT` to `MAP`) is rejected too. Returns a
+/// description of the first violation.
+pub fn check_pure_expression(
+    program: &Program,
+    purity: &dyn Fn(&str) -> Option<bool>,
+) -> Result<(), String> {
+    match program.as_slice() {
+        [Stmt::Expression(expr)] => PurityCheck { purity }.expr(expr),
+        _ => Err("expected a single expression".to_string()),
+    }
+}
+
+struct PurityCheck<'a> {
+    purity: &'a dyn Fn(&str) -> Option<bool>,
+}
+
+impl PurityCheck<'_> {
+    fn block(&self, stmts: &[Stmt]) -> Result<(), String> {
+        for stmt in stmts {
+            match stmt {
+                Stmt::Expression(expr) => self.expr(expr)?,
+                other => {
+                    return Err(format!(
+                        "'{}' statements are not allowed",
+                        other.kind_name()
+                    ));
+                }
+            }
+        }
+        Ok(())
+    }
+
+    fn expr(&self, expr: &Expr) -> Result<(), String> {
+        match expr {
+            Expr::Number(_)
+            | Expr::BigInteger(_)
+            | Expr::String(_)
+            | Expr::Boolean(_)
+            | Expr::Null => Ok(()),
+            Expr::Identifier(name) => match (self.purity)(name) {
+                Some(false) => Err(format!("'{}' may have side effects", name)),
+                _ => Ok(()),
+            },
+            Expr::Binary { left, right, .. } => {
+                self.expr(left)?;
+                self.expr(right)
+            }
+            Expr::Unary { expr, .. } => self.expr(expr),
+            Expr::Call { func, args } => {
+                match func.as_ref() {
+                    Expr::Identifier(name) if (self.purity)(name) == Some(true) => {}
+                    Expr::Identifier(name) => {
+                        return Err(format!("'{}' is not a function without side effects", name));
+                    }
+                    _ => return Err("only functions named directly may be called".to_string()),
+                }
+                args.iter().try_for_each(|arg| self.expr(arg))
+            }
+            Expr::Array(items) => items.iter().try_for_each(|item| self.expr(item)),
+            Expr::Dict(entries) => entries.iter().try_for_each(|(_, value)| self.expr(value)),
+            Expr::Index { object, index } => {
+                self.expr(object)?;
+                self.expr(index)
+            }
+            Expr::If {
+                condition,
+                then_branch,
+                elif_branches,
+                else_branch,
+            } => {
+                self.expr(condition)?;
+                self.block(then_branch)?;
+                for (cond, body) in elif_branches {
+                    self.expr(cond)?;
+                    self.block(body)?;
+                }
+                match else_branch {
+                    Some(body) => self.block(body),
+                    None => Ok(()),
+                }
+            }
+            Expr::Lambda { .. } => Err("lambdas are not allowed".to_string()),
+        }
+    }
+}
+
+/// Heuristic static cost of a program (see [`estimate_cost`])
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct CostEstimate {
+    /// Statements anywhere in the program, including function and lambda bodies
+    pub statements: usize,
+    /// `While`, `For` and indexed `For` loops
+    pub loops: usize,
+    /// Deepest lexical nesting of loops inside loops (0 when there are none)
+    pub max_loop_depth: usize,
+    /// Deepest nesting of blocks: bodies of functions, loops, branches and cases
+    pub max_nesting: usize,
+    /// Function, generator and lambda definitions
+    pub functions: usize,
+    /// Call expressions, including builtin calls
+    pub calls: usize,
+    /// Named functions and generators that can call themselves, directly or
+    /// through other named functions, in order of definition
+    pub recursive_functions: Vec<String>,
+    /// Weighted score for triage; higher means more expensive
+    pub score: u64,
+}
+
+/// Score multiplier applied per level of loop nesting
+const LOOP_WEIGHT: u64 = 10;
+/// Deepest loop level that still raises the multiplier
+const MAX_WEIGHTED_LOOP_DEPTH: u32 = 6;
+/// Score added for each recursive function
+const RECURSION_WEIGHT: u64 = 1000;
+
+/// Estimate the cost of running a program from a static walk of its AST
+///
+/// Exact cost is undecidable, so this is a heuristic for rejecting obviously
+/// expensive scripts before running them. Each statement scores
+/// `10^d`, where `d` is the number of loops lexically enclosing it (capped at
+/// 6), and each recursive function adds 1000. Function bodies start again at
+/// depth 0, while lambda bodies keep the depth of the place they are written.
+///
+/// Recursion is found from a call graph keyed by name: a call through any
+/// other value, such as a lambda or a function passed as an argument, is not
+/// followed.
+pub fn estimate_cost(program: &Program) -> CostEstimate {
+    let mut walker = CostWalker::default();
+    walker.block(program);
+
+    let recursive_functions = walker
+        .defined
+        .iter()
+        .filter(|name| walker.reaches(name, name))
+        .cloned()
+        .collect::<Vec<_>>();
+    let score = walker
+        .score
+        .saturating_add(RECURSION_WEIGHT.saturating_mul(recursive_functions.len() as u64));
+
+    CostEstimate {
+        statements: walker.statements,
+        loops: walker.loops,
+        max_loop_depth: walker.max_loop_depth,
+        max_nesting: walker.max_nesting,
+        functions: walker.functions,
+        calls: walker.calls,
+        recursive_functions,
+        score,
+    }
+}
+
+#[derive(Default)]
+struct CostWalker {
+    statements: usize,
+    loops: usize,
+    max_loop_depth: usize,
+    max_nesting: usize,
+    functions: usize,
+    calls: usize,
+    score: u64,
+    loop_depth: usize,
+    nesting: usize,
+    /// Named function being visited, if any
+    current: Option<String>,
+    /// Named functions in order of first definition
+    defined: Vec<String>,
+    /// Names called directly from each named function
+    edges: HashMap<String, HashSet<String>>,
+}
+
+impl CostWalker {
+    /// Whether `to` can be reached from `from` by following at least one call
+    fn reaches(&self, from: &str, to: &str) -> bool {
+        let mut seen = HashSet::new();
+        let mut pending: Vec<&str> = vec![from];
+        while let Some(name) = pending.pop() {
+            for callee in self.edges.get(name).into_iter().flatten() {
+                if callee == to {
+                    return true;
+                }
+                if seen.insert(callee.as_str()) {
+                    pending.push(callee);
+                }
+            }
+        }
+        false
+    }
+
+    fn block(&mut self, stmts: &[Stmt]) {
+        for stmt in stmts {
+            self.stmt(stmt);
+        }
+    }
+
+    fn nested(&mut self, stmts: &[Stmt]) {
+        self.nesting += 1;
+        self.max_nesting = self.max_nesting.max(self.nesting);
+        self.block(stmts);
+        self.nesting -= 1;
+    }
+
+    fn loop_body(&mut self, body: &[Stmt]) {
+        self.loops += 1;
+        self.loop_depth += 1;
+        self.max_loop_depth = self.max_loop_depth.max(self.loop_depth);
+        self.nested(body);
+        self.loop_depth -= 1;
+    }
+
+    fn stmt(&mut self, stmt: &Stmt) {
+        self.statements += 1;
+        let depth = (self.loop_depth as u32).min(MAX_WEIGHTED_LOOP_DEPTH);
+        self.score = self.score.saturating_add(LOOP_WEIGHT.pow(depth));
+
+        match stmt {
+            Stmt::Set { value, .. } => self.expr(value),
+            Stmt::SetIndex {
+                object,
+                index,
+                value,
+            } => {
+                self.expr(object);
+                self.expr(index);
+                self.expr(value);
+            }
+            Stmt::FuncDef { name, body, .. } | Stmt::GeneratorDef { name, body, .. } => {
+                self.functions += 1;
+                if !self.defined.contains(name) {
+                    self.defined.push(name.clone());
+                }
+                let current = self.current.replace(name.clone());
+                let loop_depth = std::mem::take(&mut self.loop_depth);
+                self.nested(body);
+                self.loop_depth = loop_depth;
+                self.current = current;
+            }
+            Stmt::LazyDef { expr, .. } => self.expr(expr),
+            Stmt::Return(e) | Stmt::Yield(e) | Stmt::Throw(e) | Stmt::Expression(e) => self.expr(e),
+            Stmt::Break | Stmt::Continue | Stmt::Import { .. } | Stmt::Export(_) => {}
+            Stmt::While { condition, body } => {
+                self.expr(condition);
+                self.loop_body(body);
+            }
+            Stmt::For { iterable, body, .. } | Stmt::ForIndexed { iterable, body, .. } => {
+                self.expr(iterable);
+                self.loop_body(body);
+            }
+            Stmt::Switch {
+                expr,
+                cases,
+                default,
+            } => {
+                self.expr(expr);
+                for (value, body) in cases {
+                    self.expr(value);
+                    self.nested(body);
+                }
+                if let Some(body) = default {
+                    self.nested(body);
+                }
+            }
+        }
+    }
+
+    fn expr(&mut self, expr: &Expr) {
+        match expr {
+            Expr::Number(_)
+            | Expr::BigInteger(_)
+            | Expr::String(_)
+            | Expr::Boolean(_)
+            | Expr::Null
+            | Expr::Identifier(_) => {}
+            Expr::Binary { left, right, .. } => {
+                self.expr(left);
+                self.expr(right);
+            }
+            Expr::Unary { expr, .. } => self.expr(expr),
+            Expr::Call { func, args } => {
+                self.calls += 1;
+                if let (Expr::Identifier(callee), Some(caller)) = (func.as_ref(), &self.current) {
+                    self.edges
+                        .entry(caller.clone())
+                        .or_default()
+                        .insert(callee.clone());
+                }
+                self.expr(func);
+                for arg in args {
+                    self.expr(arg);
+                }
+            }
+            Expr::Array(items) => {
+                for item in items {
+                    self.expr(item);
+                }
+            }
+            Expr::Dict(entries) => {
+                for (_, value) in entries {
+                    self.expr(value);
+                }
+            }
+            Expr::Index { object, index } => {
+                self.expr(object);
+                self.expr(index);
+            }
+            Expr::If {
+                condition,
+                then_branch,
+                elif_branches,
+                else_branch,
+            } => {
+                self.expr(condition);
+                self.nested(then_branch);
+                for (cond, body) in elif_branches {
+                    self.expr(cond);
+                    self.nested(body);
+                }
+                if let Some(body) = else_branch {
+                    self.nested(body);
+                }
+            }
+            Expr::Lambda { body, .. } => {
+                self.functions += 1;
+                self.nested(body);
+            }
+        }
+    }
+}
+
+/// Statically inferred result type
+///
+/// Numbers are split by whether their integrality is known: `Int` and `Float`
+/// are only reported when every possible value is (or is not) a whole number;
+/// otherwise the result is `Number`.
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize)]
+pub enum TypeKind {
+    Int,
+    Float,
+    Number,
+    Fraction,
+    String,
+    Boolean,
+    Null,
+    Array,
+    Dict,
+    Function,
+    /// Inference cannot decide without running the code
+    Unknown,
+}
+
+impl TypeKind {
+    /// Kind of an already computed value
+    pub fn of(value: &Value) -> TypeKind {
+        match value {
+            Value::Number(n) if n.fract() == 0.0 => TypeKind::Int,
+            Value::Number(n) if n.is_finite() => TypeKind::Float,
+            Value::Number(_) => TypeKind::Number,
+            Value::Fraction(_) => TypeKind::Fraction,
+            Value::String(_) => TypeKind::String,
+            Value::Boolean(_) => TypeKind::Boolean,
+            Value::Null => TypeKind::Null,
+            Value::Array(_) => TypeKind::Array,
+            Value::Dict(_) => TypeKind::Dict,
+            Value::Function { .. } | Value::Generator { .. } | Value::BuiltIn { .. } => {
+                TypeKind::Function
+            }
+            Value::Lazy { .. } => TypeKind::Unknown,
+        }
+    }
+
+    pub fn name(self) -> &'static str {
+        match self {
+            TypeKind::Int => "Int",
+            TypeKind::Float => "Float",
+            TypeKind::Number => "Number",
+            TypeKind::Fraction => "Fraction",
+            TypeKind::String => "String",
+            TypeKind::Boolean => "Boolean",
+            TypeKind::Null => "Null",
+            TypeKind::Array => "Array",
+            TypeKind::Dict => "Dict",
+            TypeKind::Function => "Function",
+            TypeKind::Unknown => "Unknown",
+        }
+    }
+
+    fn is_numeric(self) -> bool {
+        matches!(self, TypeKind::Int | TypeKind::Float | TypeKind::Number)
+    }
+}
+
+/// Infer the type of the value a program would produce, without running it
+///
+/// `lookup` gives the kind of variables bound before the program runs (for
+/// example host globals); variables `Set` at the top level are tracked in
+/// order. Function calls, loops and anything depending on runtime state yield
+/// `TypeKind::Unknown` rather than a guess.
+pub fn infer_type(program: &Program, lookup: &dyn Fn(&str) -> Option<TypeKind>) -> TypeKind {
+    let mut inference = Inference {
+        lookup,
+        locals: HashMap::new(),
+    };
+    inference.block(program)
+}
+
+struct Inference<'a> {
+    lookup: &'a dyn Fn(&str) -> Option<TypeKind>,
+    locals: HashMap<String, TypeKind>,
+}
+
+impl Inference<'_> {
+    /// Kind of the last statement; `Unknown` if control flow could leave early
+    fn block(&mut self, stmts: &[Stmt]) -> TypeKind {
+        let mut kind = TypeKind::Null;
+        for stmt in stmts {
+            if !matches!(stmt, Stmt::Return(_)) && contains_return(std::slice::from_ref(stmt)) {
+                return TypeKind::Unknown;
+            }
+
+            kind = match stmt {
+                Stmt::Set { name, value } => {
+                    let kind = self.expr(value);
+                    self.locals.insert(name.clone(), kind);
+                    kind
+                }
+                Stmt::Expression(e) => self.expr(e),
+                Stmt::Return(e) => return self.expr(e),
+                Stmt::FuncDef { name, .. } | Stmt::GeneratorDef { name, .. } => {
+                    self.locals.insert(name.clone(), TypeKind::Function);
+                    TypeKind::Unknown
+                }
+                Stmt::While { .. }
+                | Stmt::For { .. }
+                | Stmt::ForIndexed { .. }
+                | Stmt::Switch { .. }
+                | Stmt::LazyDef { .. }
+                | Stmt::Import { .. } => {
+                    // Loops may reassign variables any number of times; for the
+                    // others, which branch runs (or what a module exports) is unknown
+                    self.forget_assigned(std::slice::from_ref(stmt));
+                    TypeKind::Unknown
+                }
+                _ => TypeKind::Unknown,
+            };
+        }
+        kind
+    }
+
+    fn forget_assigned(&mut self, stmts: &[Stmt]) {
+        for stmt in stmts {
+            match stmt {
+                Stmt::Set { name, .. }
+                | Stmt::FuncDef { name, .. }
+                | Stmt::GeneratorDef { name, .. }
+                | Stmt::LazyDef { name, .. } => {
+                    self.locals.insert(name.clone(), TypeKind::Unknown);
+                }
+                Stmt::For { var, body, .. } => {
+                    self.locals.insert(var.clone(), TypeKind::Unknown);
+                    self.forget_assigned(body);
+                }
+                Stmt::ForIndexed {
+                    index_var,
+                    value_var,
+                    body,
+                    ..
+                } => {
+                    self.locals.insert(index_var.clone(), TypeKind::Unknown);
+                    self.locals.insert(value_var.clone(), TypeKind::Unknown);
+                    self.forget_assigned(body);
+                }
+                Stmt::While { body, .. } => self.forget_assigned(body),
+                Stmt::Import {
+                    names,
+                    aliases,
+                    namespace,
+                    ..
+                } => {
+                    let bound = names
+                        .iter()
+                        .zip(aliases)
+                        .map(|(name, alias)| alias.as_ref().unwrap_or(name))
+                        .chain(namespace);
+                    for name in bound {
+                        self.locals.insert(name.clone(), TypeKind::Unknown);
+                    }
+                }
+                Stmt::Expression(Expr::If {
+                    then_branch,
+                    elif_branches,
+                    else_branch,
+                    ..
+                }) => self.forget_branches(then_branch, elif_branches, else_branch.as_deref()),
+                Stmt::Switch { cases, default, .. } => {
+                    for (_, body) in cases {
+                        self.forget_assigned(body);
+                    }
+                    if let Some(body) = default {
+                        self.forget_assigned(body);
+                    }
+                }
+                _ => {}
+            }
+        }
+    }
+
+    fn forget_branches(
+        &mut self,
+        then: &[Stmt],
+        elifs: &[(Expr, Vec<Stmt>)],
+        other: Option<&[Stmt]>,
+    ) {
+        self.forget_assigned(then);
+        for (_, body) in elifs {
+            self.forget_assigned(body);
+        }
+        if let Some(body) = other {
+            self.forget_assigned(body);
+        }
+    }
+
+    fn expr(&mut self, expr: &Expr) -> TypeKind {
+        match expr {
+            Expr::Number(n) => TypeKind::of(&Value::Number(*n)),
+            Expr::BigInteger(_) => TypeKind::Fraction,
+            Expr::String(_) => TypeKind::String,
+            Expr::Boolean(_) => TypeKind::Boolean,
+            Expr::Null => TypeKind::Null,
+            Expr::Array(_) => TypeKind::Array,
+            Expr::Dict(_) => TypeKind::Dict,
+            Expr::Lambda { .. } => TypeKind::Function,
+            Expr::Identifier(name) => self
+                .locals
+                .get(name)
+                .copied()
+                .or_else(|| (self.lookup)(name))
+                .unwrap_or(TypeKind::Unknown),
+            Expr::Unary { op, expr } => {
+                let kind = self.expr(expr);
+                match op {
+                    UnaryOp::Not => TypeKind::Boolean,
+                    UnaryOp::Minus if kind.is_numeric() || kind == TypeKind::Fraction => kind,
+                    UnaryOp::Minus => TypeKind::Unknown,
+                }
+            }
+            Expr::Binary { left, op, right } => {
+                let left = self.expr(left);
+                let right = self.expr(right);
+                binary(left, op, right)
+            }
+            Expr::If {
+                then_branch,
+                elif_branches,
+                else_branch,
+                ..
+            } => {
+                // Without Else the value may be Null; branches may also assign
+                // different kinds to the same variable
+                let Some(else_branch) = else_branch else {
+                    self.forget_branches(then_branch, elif_branches, None);
+                    return TypeKind::Unknown;
+                };
+                let mut branches = vec![then_branch];
+                branches.extend(elif_branches.iter().map(|(_, body)| body));
+                branches.push(else_branch);
+
+                let saved = self.locals.clone();
+                let kinds: Vec<TypeKind> = branches
+                    .into_iter()
+                    .map(|body| {
+                        self.locals = saved.clone();
+                        self.block(body)
+                    })
+                    .collect();
+                self.locals = saved;
+                self.forget_branches(then_branch, elif_branches, Some(else_branch));
+
+                let first = kinds[0];
+                if kinds.iter().all(|k| *k == first) {
+                    first
+                } else if kinds.iter().all(|k| k.is_numeric()) {
+                    TypeKind::Number
+                } else {
+                    TypeKind::Unknown
+                }
+            }
+            Expr::Call { .. } | Expr::Index { .. } => TypeKind::Unknown,
+        }
+    }
+}
+
+fn binary(left: TypeKind, op: &BinOp, right: TypeKind) -> TypeKind {
+    use TypeKind::*;
+
+    match op {
+        BinOp::Equal
+        | BinOp::NotEqual
+        | BinOp::Less
+        | BinOp::LessEqual
+        | BinOp::Greater
+        | BinOp::GreaterEqual => Boolean,
+        // And/Or return one of their operands
+        BinOp::And | BinOp::Or if left == right => left,
+        BinOp::And | BinOp::Or => Unknown,
+        BinOp::Add if left == String && right == String => String,
+        BinOp::Add | BinOp::Subtract => match (left, right) {
+            (Int, Int) => Int,
+            // A whole number plus a fraction is never whole
+            (Int, Float) | (Float, Int) => Float,
+            (Fraction, Fraction) | (Fraction, Int) | (Int, Fraction) => Fraction,
+            (l, r) if l.is_numeric() && r.is_numeric() => Number,
+            _ => Unknown,
+        },
+        BinOp::Multiply | BinOp::Modulo => match (left, right) {
+            (Int, Int) => Int,
+            (Fraction, Fraction) | (Fraction, Int) | (Int, Fraction) if *op == BinOp::Multiply => {
+                Fraction
+            }
+            (l, r) if l.is_numeric() && r.is_numeric() => Number,
+            _ => Unknown,
+        },
+        BinOp::Divide => match (left, right) {
+            (Fraction, Fraction) | (Fraction, Int) | (Int, Fraction) => Fraction,
+            (l, r) if l.is_numeric() && r.is_numeric() => Number,
+            _ => Unknown,
+        },
+    }
+}
+
+fn contains_return(stmts: &[Stmt]) -> bool {
+    stmts.iter().any(|stmt| match stmt {
+        Stmt::Return(_) => true,
+        Stmt::While { body, .. } | Stmt::For { body, .. } | Stmt::ForIndexed { body, .. } => {
+            contains_return(body)
+        }
+        Stmt::Switch { cases, default, .. } => {
+            cases.iter().any(|(_, body)| contains_return(body))
+                || default.as_ref().is_some_and(|body| contains_return(body))
+        }
+        Stmt::Expression(Expr::If {
+            then_branch,
+            elif_branches,
+            else_branch,
+            ..
+        }) => {
+            contains_return(then_branch)
+                || elif_branches.iter().any(|(_, body)| contains_return(body))
+                || else_branch
+                    .as_ref()
+                    .is_some_and(|body| contains_return(body))
+        }
+        _ => false,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::parser::Parser;
+
+    fn warnings(code: &str) -> Vec<Diagnostic> {
+        let (program, positions) = Parser::new(code).parse_program_with_positions().unwrap();
+        unused_variables(&program, &positions)
+    }
+
+    #[test]
+    fn test_typo_is_reported() {
+        let diags = warnings("Set SUMM 1\nSet TOTAL (SUM + 1)\nTOTAL");
+        assert_eq!(diags.len(), 1);
+        assert_eq!(diags[0].severity, Severity::Warning);
+        assert!(diags[0].message.contains("'SUMM'"));
+        assert_eq!((diags[0].line, diags[0].column), (1, 1));
+    }
+
+    #[test]
+    fn test_reads_in_functions_and_exports_count() {
+        let code = "Set A 1\nSet B 2\nFunc F() {\n    Return A\n}\nExport B";
+        assert!(warnings(code).is_empty());
+    }
+
+    #[test]
+    fn test_cost_counts_nested_loops_and_mutual_recursion() {
+        let code = "Func EVEN(N) {\n    If (N == 0) { Return True }\n    Return ODD(N - 1)\n}\nFunc ODD(N) {\n    Return EVEN(N - 1)\n}\nFunc F() { Return 1 }\nFor I In RANGE(10) {\n    For J In RANGE(10) {\n        PRINT(F())\n    }\n}";
+        let cost = estimate_cost(&Parser::new(code).parse_program().unwrap());
+        assert_eq!(cost.loops, 2);
+        assert_eq!(cost.max_loop_depth, 2);
+        assert_eq!(cost.functions, 3);
+        assert_eq!(cost.recursive_functions, vec!["EVEN", "ODD"]);
+        assert!(cost.score > 100 + 2 * RECURSION_WEIGHT);
+    }
+
+    #[test]
+    fn test_pure_expression_rejects_effects_and_definitions() {
+        let purity = |name: &str| match name {
+            "LEN" => Some(true),
+            "PRINT" => Some(false),
+            _ => None,
+        };
+        let check = |code: &str| {
+            check_pure_expression(&Parser::new(code).parse_program().unwrap(), &purity)
+        };
+
+        assert!(check("(LEN(XS) > 0) && (AGE >= 18)").is_ok());
+        assert!(check("If (A) {\n    True\n} Else {\n    False\n}").is_ok());
+
+        for code in [
+            "Set A 1\nA",
+            "PRINT(1)",
+            "LEN(MAP(XS, PRINT))",
+            "F(1)",
+            "(Lambda X -> X)(1)",
+            "If (A) {\n    Set B 1\n}",
+        ] {
+            assert!(check(code).is_err(), "{}", code);
+        }
+    }
+
+    #[test]
+    fn test_io_function_lists_match_registry() {
+        use crate::builtins::BuiltInRegistry;
+
+        let gated = |permissions: IOPermissions| {
+            let base: HashSet<_> = BuiltInRegistry::new().names().into_iter().collect();
+            let mut names: Vec<_> = BuiltInRegistry::with_permissions(permissions)
+                .names()
+                .into_iter()
+                .filter(|name| !base.contains(name))
+                .collect();
+            names.sort();
+            names
+        };
+        let sorted = |names: &[&str]| {
+            let mut names: Vec<_> = names.iter().map(|name| name.to_string()).collect();
+            names.sort();
+            names
+        };
+
+        let filesystem = IOPermissions {
+            filesystem_enabled: true,
+            network_enabled: false,
+        };
+        let network = IOPermissions {
+            filesystem_enabled: false,
+            network_enabled: true,
+        };
+        assert_eq!(gated(filesystem), sorted(FILESYSTEM_FUNCTIONS));
+        assert_eq!(gated(network), sorted(NETWORK_FUNCTIONS));
+    }
+}
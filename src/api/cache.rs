@@ -1,5 +1,6 @@
 use super::Aether;
 use crate::cache::CacheStats;
+use crate::optimizer::Optimizer;
 
 impl Aether {
     /// 获取缓存统计信息
@@ -13,6 +14,8 @@ impl Aether {
     }
 
     /// 设置优化选项
+    ///
+    /// AST 缓存中的程序是按旧选项优化的，因此会被清空。
     pub fn set_optimization(
         &mut self,
         constant_folding: bool,
@@ -22,5 +25,27 @@ impl Aether {
         self.optimizer.constant_folding = constant_folding;
         self.optimizer.dead_code_elimination = dead_code;
         self.optimizer.tail_recursion = tail_recursion;
+        self.cache.clear();
+    }
+
+    /// 按优化级别编译代码（可链式调用）
+    ///
+    /// 级别含义见 [`Optimizer::with_level`]：`0` 不优化，`1` 只做常量折叠，
+    /// `2`（默认）启用全部优化。对 `compile`、`eval` 和 `disassemble` 都生效，
+    /// 可以用 `disassemble` 查看折叠后的语法树。
+    pub fn with_optimization_level(mut self, level: u8) -> Self {
+        self.set_optimization_level(level);
+        self
+    }
+
+    /// 设置优化级别（见 [`Aether::with_optimization_level`]），并清空 AST 缓存
+    pub fn set_optimization_level(&mut self, level: u8) {
+        self.optimizer = Optimizer {
+            rational_division: self.optimizer.rational_division,
+            no_recursion: self.optimizer.no_recursion,
+            int_overflow: self.optimizer.int_overflow,
+            ..Optimizer::with_level(level)
+        };
+        self.cache.clear();
     }
 }
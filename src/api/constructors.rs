@@ -2,7 +2,9 @@ use super::Aether;
 use crate::builtins::IOPermissions;
 use crate::evaluator::Evaluator;
 use crate::optimizer::Optimizer;
+use crate::runtime::ExecutionLimits;
 use crate::stdlib;
+use crate::value::Value;
 
 impl Aether {
     /// 创建新的 Aether 引擎实例
@@ -21,6 +23,12 @@ impl Aether {
             evaluator: Evaluator::with_permissions(permissions),
             cache: crate::cache::ASTCache::new(),
             optimizer: Optimizer::new(),
+            name: None,
+            error_formatter: None,
+            denied_prefixes: Vec::new(),
+            max_nesting_depth: None,
+            warnings_as_errors: false,
+            last_error_kind: std::cell::Cell::new(None),
         }
     }
 
@@ -29,6 +37,164 @@ impl Aether {
         Self::with_permissions(IOPermissions::allow_all())
     }
 
+    /// 创建适合执行不可信脚本的安全模式引擎
+    ///
+    /// 一次性应用一组经过审核的沙箱限制，便于嵌入方审计，具体设置如下：
+    ///
+    /// - IO 权限：全部禁用（与 `new()` 相同，无文件系统和网络访问）
+    /// - 执行限制：`ExecutionLimits::strict()`，即最多 100,000 步、
+    ///   递归深度 100 层、执行时长 5 秒
+    /// - 顶层结果大小：最多 1 MiB（1,048,576 字节）
+    /// - 单个数组长度：最多 100,000 个元素
+    /// - 解析嵌套层数：最多 256 层（括号、代码块、一元运算符等），
+    ///   过深的输入报 `Nesting too deep` 而不是耗尽解析器的栈
+    ///
+    /// 引擎目前没有整体内存限制，内存占用由步数限制和数组长度限制间接约束。
+    /// 返回的引擎仍可按需调用其他 setter 逐项调整。
+    pub fn with_safe_defaults() -> Self {
+        let mut engine = Self::new().with_limits(ExecutionLimits::strict());
+        engine.set_max_result_size(Some(1024 * 1024));
+        engine.set_max_array_length(Some(100_000));
+        engine.set_max_nesting_depth(Some(256));
+        engine
+    }
+
+    /// 为引擎设置名称
+    ///
+    /// 名称会作为 `[名称] ` 前缀出现在 `eval` 返回的错误信息中，
+    /// 并出现在 FFI 导出的结构化跟踪记录里，便于在多个引擎并存时关联日志。
+    pub fn with_name(mut self, name: impl Into<String>) -> Self {
+        self.name = Some(name.into());
+        self
+    }
+
+    /// 设置或清除引擎名称（见 [`Aether::with_name`]）
+    pub fn set_name(&mut self, name: Option<String>) {
+        self.name = name;
+    }
+
+    /// 获取引擎名称
+    pub fn name(&self) -> Option<&str> {
+        self.name.as_deref()
+    }
+
+    /// 创建引擎时预置全局变量，省去之后再调用 `set_globals`
+    ///
+    /// 与其他 `with_*` 选项可以任意组合。每个引擎持有变量值的独立副本：
+    /// 用同一组变量创建多个引擎时，一个引擎修改数组或字典不会影响其他引擎。
+    /// 脚本可以重新赋值这些变量；`reset_env`（包括引擎池每次取出引擎时的重置）
+    /// 之后会恢复为预置的值。任何一个变量名不合法时返回错误。
+    pub fn with_initial_vars<I, K>(mut self, vars: I) -> Result<Self, String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        self.set_initial_vars(vars)?;
+        Ok(self)
+    }
+
+    /// 设置预置全局变量（见 [`Aether::with_initial_vars`]），替换之前预置的变量
+    pub fn set_initial_vars<I, K>(&mut self, vars: I) -> Result<(), String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        let vars = super::eval::checked_vars(vars)?;
+        self.evaluator.set_initial_vars(vars);
+        Ok(())
+    }
+
+    /// 创建引擎时定义布尔开关，供同一份脚本按部署切换功能分支
+    ///
+    /// 开关以常量（见 [`Aether::set_const`]）的形式提供，脚本中可以直接写
+    /// `If (FEATURE_X) { ... }`；对开关重新赋值会产生运行时错误 `Cannot reassign constant`。
+    /// 开关与普通数据变量不同，在 `reset_env` 之后仍然有效。
+    /// 任何一个名称不合法时返回错误，且不会定义任何开关。
+    pub fn with_defines<I, K>(mut self, defines: I) -> Result<Self, String>
+    where
+        I: IntoIterator<Item = (K, bool)>,
+        K: Into<String>,
+    {
+        self.set_defines(defines)?;
+        Ok(self)
+    }
+
+    /// 定义布尔开关（见 [`Aether::with_defines`]），已有同名开关的值会被替换
+    pub fn set_defines<I, K>(&mut self, defines: I) -> Result<(), String>
+    where
+        I: IntoIterator<Item = (K, bool)>,
+        K: Into<String>,
+    {
+        let defines = super::eval::checked_vars(
+            defines
+                .into_iter()
+                .map(|(name, enabled)| (name, Value::Boolean(enabled))),
+        )?;
+        for (name, value) in defines {
+            self.set_const(&name, value)?;
+        }
+        Ok(())
+    }
+
+    /// 禁止脚本定义或引用以指定前缀开头的标识符（见 [`Aether::set_deny_list`]）
+    pub fn with_deny_list(mut self, prefixes: Vec<String>) -> Self {
+        self.set_deny_list(prefixes);
+        self
+    }
+
+    /// 设置禁止脚本使用的标识符前缀（空列表表示不限制）
+    ///
+    /// 在解析阶段检查：定义或引用以这些前缀开头的变量、函数、参数、循环变量、
+    /// 导入和导出名称以及 `M.NAME` 中的成员名都会产生解析错误，脚本不会开始执行；
+    /// 导入的模块（包括设置之前注册的模块）同样按此检查。字典键和字符串不受影响。
+    /// 宿主通过 `set_global` 等 API 注入的名称不受限制。
+    /// 设置后会清空 AST 缓存，以免复用按旧规则解析的代码。
+    pub fn set_deny_list(&mut self, prefixes: Vec<String>) {
+        self.evaluator.set_denied_prefixes(prefixes.clone());
+        self.denied_prefixes = prefixes;
+        self.cache.clear();
+    }
+
+    /// 获取禁止脚本使用的标识符前缀
+    pub fn deny_list(&self) -> &[String] {
+        &self.denied_prefixes
+    }
+
+    /// 把静态分析警告视为错误（类似 `-Werror`），用于在 CI 中强制脚本保持干净
+    ///
+    /// 开启后，代码只要存在 [`Aether::validate_with_warnings`] 报告的警告（例如赋值后
+    /// 从未读取的变量），`eval` 等求值方法就不会执行代码，而是返回列出全部警告的解析错误；
+    /// `validate_with_warnings` 同样返回该错误。
+    pub fn with_warnings_as_errors(mut self) -> Self {
+        self.set_warnings_as_errors(true);
+        self
+    }
+
+    /// 设置是否把静态分析警告视为错误（见 [`Aether::with_warnings_as_errors`]）
+    ///
+    /// 设置后会清空 AST 缓存，以免复用未经检查的代码。
+    pub fn set_warnings_as_errors(&mut self, enabled: bool) {
+        self.warnings_as_errors = enabled;
+        self.cache.clear();
+    }
+
+    /// 是否把静态分析警告视为错误
+    pub fn warnings_as_errors(&self) -> bool {
+        self.warnings_as_errors
+    }
+
+    /// 获取引擎当前的 IO 权限
+    pub fn permissions(&self) -> &IOPermissions {
+        self.evaluator.permissions()
+    }
+
+    /// 引擎是否启用了任意 IO 权限（文件系统或网络）
+    ///
+    /// 在执行不可信输入前，可用它断言引擎处于沙箱状态。
+    pub fn permissions_enabled(&self) -> bool {
+        self.permissions().any_enabled()
+    }
+
     /// 创建预加载标准库的新 Aether 引擎
     ///
     /// 这将创建一个具有所有权限的引擎，并自动加载
@@ -1,66 +1,430 @@
-use super::Aether;
-use crate::evaluator::ErrorReport;
-use crate::parser::Parser;
+use super::{Aether, ErrorKind};
+use crate::ast::{Position, Program, Stmt};
+use crate::cache::DefinitionSites;
+use crate::evaluator::{ErrorReport, RuntimeError};
+use crate::runtime::program::{self, CompiledProgram, ParseSettings};
+use crate::runtime::{EvalPhases, EvalStats, FromValue, ResultKind, SeededRng, SharedData};
 use crate::value::Value;
+use num_bigint::BigInt;
+use num_traits::FromPrimitive;
 
 impl Aether {
     /// 求值 Aether 代码并返回结果
     pub fn eval(&mut self, code: &str) -> Result<Value, String> {
-        // 在开始新的顶级求值之前清除任何之前的调用栈帧。
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
+
+        let compiled = self.compile_cached(code)?;
+        self.run_compiled(&compiled)
+    }
+
+    /// 在开始新的顶级求值之前清除之前的调用栈帧、步数和副作用标记
+    fn begin_eval(&mut self) {
         self.evaluator.clear_call_stack();
         self.evaluator.reset_step_counter();
+        self.evaluator.clear_side_effects();
+    }
 
-        // 尝试从缓存获取AST
-        let program = if let Some(cached_program) = self.cache.get(code) {
-            cached_program
-        } else {
-            // 解析代码
-            let mut parser = Parser::new(code);
-            let program = parser
-                .parse_program()
-                .map_err(|e| format!("Parse error: {}", e))?;
-
-            // 优化AST
-            let optimized = self.optimizer.optimize_program(&program);
-
-            // 将优化后的结果存入缓存
-            self.cache.insert(code, optimized.clone());
-            optimized
-        };
+    /// 求值已编译的程序
+    fn run_compiled(&mut self, compiled: &Compiled) -> Result<Value, String> {
+        let (program, sites, positions) = compiled;
+        self.evaluator.record_function_sites(sites);
+        self.evaluator.record_statement_sites(positions.clone());
 
         // 求值程序
         self.evaluator
-            .eval_program(&program)
-            .map_err(|e| format!("Runtime error: {}", e))
+            .eval_program(program)
+            .and_then(|value| {
+                self.evaluator.check_result_size(&value)?;
+                Ok(value)
+            })
+            .map_err(|e| self.runtime_error_message(e))
+    }
+
+    /// 预先解析并优化代码，结果存入 AST 缓存，之后以相同代码调用 `eval` 时不再解析
+    ///
+    /// 解析很大的脚本可能较慢：与求值一样，可以从其他线程通过
+    /// [`Aether::interrupt_handle`] 中断解析，此时返回 `Parsing interrupted` 解析错误。
+    /// 开始编译之前发出的中断会被忽略。`eval` 自身的解析阶段同样可以被中断。
+    pub fn compile(&mut self, code: &str) -> Result<(), String> {
+        self.evaluator.clear_interrupt();
+        self.compile_cached(code).map(|_| ())
+    }
+
+    /// 编译代码并把编译结果序列化为字节，供其他引擎（包括其他进程中的引擎）用
+    /// [`Aether::import_program`] 加载，从而跳过解析和优化
+    ///
+    /// 字节带有格式版本号和校验和，并记录源码以及编译时的解析设置
+    /// （禁止的标识符前缀、最大嵌套层数、警告是否视为错误、有理数除法和禁止递归）。代码无法解析时返回解析错误。
+    pub fn export_program(&mut self, code: &str) -> Result<Vec<u8>, String> {
+        self.evaluator.clear_interrupt();
+        let (program, sites, positions) = self.compile_cached(code)?;
+        program::save(&CompiledProgram {
+            source: code.to_string(),
+            settings: self.parse_settings(),
+            program,
+            sites,
+            positions,
+        })
+        .map_err(|e| self.label_error(e))
+    }
+
+    /// 加载 [`Aether::export_program`] 生成的字节并存入 AST 缓存，返回对应的源码
+    ///
+    /// 之后以返回的源码调用 `eval` 等方法时直接使用加载的程序，不再解析。
+    /// 字节损坏、校验和不符、格式版本不兼容，或编译时的解析设置与本引擎不同时返回错误，
+    /// 且不会修改缓存。程序按导出方引擎的优化选项优化，加载时不会重新优化。
+    /// 校验和只用于发现损坏，不能防止篡改：加载的程序不会再经过解析阶段的检查，
+    /// 因此只应加载来自可信来源的字节。
+    pub fn import_program(&mut self, bytes: &[u8]) -> Result<String, String> {
+        let compiled = program::load(bytes).map_err(|e| self.label_error(e))?;
+        if compiled.settings != self.parse_settings() {
+            return Err(self.label_error(
+                "Compiled program was built with different parse settings".to_string(),
+            ));
+        }
+        self.cache.insert_with_positions(
+            &compiled.source,
+            compiled.program,
+            compiled.sites,
+            compiled.positions,
+        );
+        Ok(compiled.source)
+    }
+
+    /// 当前影响解析结果的设置，导入的编译结果必须与之一致
+    fn parse_settings(&self) -> ParseSettings {
+        ParseSettings {
+            denied_prefixes: self.denied_prefixes.clone(),
+            max_nesting_depth: self.max_nesting_depth,
+            warnings_as_errors: self.warnings_as_errors,
+            rational_division: self.rational_division(),
+            no_recursion: self.no_recursion(),
+            int_overflow: self.int_overflow(),
+        }
+    }
+
+    /// 从缓存获取代码的 AST，未命中时解析、优化并存入缓存
+    fn compile_cached(&mut self, code: &str) -> Result<Compiled, String> {
+        self.compile_cached_raw(code)
+            .map_err(|e| self.parse_error_message(e))
+    }
+
+    /// 同 [`Aether::compile_cached`]，但返回未经格式化的解析错误信息
+    fn compile_cached_raw(&mut self, code: &str) -> Result<Compiled, String> {
+        if let Some(cached) = self.cache.get_with_positions(code) {
+            return Ok(cached);
+        }
+
+        // 解析代码（可被中断句柄取消）
+        let mut parser = self
+            .parser(code)
+            .with_interrupt(self.evaluator.interrupt_handle());
+        let (program, statement_positions) = parser
+            .parse_program_with_positions()
+            .map_err(|e| e.to_string())?;
+        self.check_warnings(&program, &statement_positions)?;
+        let sites = definition_sites(&program, parser.top_level_positions());
+
+        // 优化AST
+        let (optimized, positions) =
+            self.optimize_with_positions(&program, parser.top_level_positions());
+
+        // 将优化后的结果存入缓存
+        self.cache
+            .insert_with_positions(code, optimized.clone(), sites.clone(), positions.clone());
+        Ok((optimized, sites, positions))
+    }
+
+    /// 优化程序，同时返回优化后每条顶层语句在源码中的位置
+    ///
+    /// 优化按语句进行（可能删除语句），逐条优化以保留到源码语句的映射。
+    fn optimize_with_positions(
+        &self,
+        program: &Program,
+        positions: &[Position],
+    ) -> (Program, Vec<Position>) {
+        let mut optimized = Vec::with_capacity(program.len());
+        let mut optimized_positions = Vec::with_capacity(program.len());
+        for (stmt, position) in program.iter().zip(positions) {
+            for opt in self.optimizer.optimize_program(&vec![stmt.clone()]) {
+                optimized.push(opt);
+                optimized_positions.push(*position);
+            }
+        }
+        (optimized, optimized_positions)
+    }
+
+    /// 按名称调用脚本中定义的函数（或内置/宿主函数），参数直接以 `Value` 传入
+    ///
+    /// 适合先用 `eval` 加载定义函数的脚本，再反复以不同参数调用；
+    /// 参数不经过源码拼接，因此不存在注入问题。
+    pub fn call(&mut self, name: &str, args: Vec<Value>) -> Result<Value, String> {
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
+
+        self.evaluator
+            .call_named(name, args)
+            .and_then(|value| {
+                self.evaluator.check_result_size(&value)?;
+                Ok(value)
+            })
+            .map_err(|e| self.runtime_error_message(e))
+    }
+
+    /// 调用函数值（例如脚本求值返回的 Lambda 或函数），参数直接以 `Value` 传入
+    ///
+    /// 函数值捕获的闭包环境会保留，因此脚本可以把回调交给宿主，由宿主在之后调用。
+    /// 函数值只应在产生它的引擎上调用。
+    pub fn call_value(&mut self, func: &Value, args: Vec<Value>) -> Result<Value, String> {
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
+
+        self.evaluator
+            .call_value(func, args)
+            .and_then(|value| {
+                self.evaluator.check_result_size(&value)?;
+                Ok(value)
+            })
+            .map_err(|e| self.runtime_error_message(e))
+    }
+
+    /// 为错误信息加上引擎名称前缀（未命名时原样返回）
+    fn label_error(&self, message: String) -> String {
+        match &self.name {
+            Some(name) => format!("[{}] {}", name, message),
+            None => message,
+        }
+    }
+
+    /// 生成解析错误的错误字符串（设置了错误格式化函数时交给它处理）
+    fn parse_error_message(&self, error: impl std::fmt::Display) -> String {
+        self.last_error_kind.set(Some(ErrorKind::Parse));
+        match &self.error_formatter {
+            Some(formatter) => formatter(&ErrorReport::parse_error(error.to_string())),
+            None => self.label_error(format!("Parse error: {}", error)),
+        }
+    }
+
+    /// 开启 `warnings_as_errors` 时，代码存在静态分析警告则返回列出全部警告的错误
+    ///
+    /// `positions` 为 `parse_program_with_positions` 返回的语句位置。
+    pub(super) fn check_warnings(
+        &self,
+        program: &Program,
+        positions: &[Position],
+    ) -> Result<(), String> {
+        if !self.warnings_as_errors {
+            return Ok(());
+        }
+        let warnings = crate::analysis::unused_variables(program, positions);
+        if warnings.is_empty() {
+            return Ok(());
+        }
+        let lines: Vec<String> = warnings
+            .iter()
+            .map(|w| {
+                format!(
+                    "  line {}, column {}: {} [{}]",
+                    w.line, w.column, w.message, w.code
+                )
+            })
+            .collect();
+        Err(format!("Warnings treated as errors:\n{}", lines.join("\n")))
+    }
+
+    /// 生成运行时错误的错误字符串（设置了错误格式化函数时交给它处理）
+    fn runtime_error_message(&self, error: RuntimeError) -> String {
+        self.last_error_kind.set(Some(match error {
+            RuntimeError::NoValue => ErrorKind::NoValue,
+            _ => ErrorKind::Runtime,
+        }));
+        match &self.error_formatter {
+            Some(formatter) => formatter(&error.to_error_report()),
+            None => self.label_error(format!("Runtime error: {}", error)),
+        }
     }
 
     /// 求值 Aether 代码并在失败时返回结构化的错误报告。
     ///
     /// 这适用于需要机器可读诊断的集成。
     pub fn eval_report(&mut self, code: &str) -> Result<Value, ErrorReport> {
-        // 在开始新的顶级求值之前清除任何之前的调用栈帧。
-        self.evaluator.clear_call_stack();
-        self.evaluator.reset_step_counter();
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
 
-        // 首先尝试 AST 缓存
-        let program = if let Some(cached_program) = self.cache.get(code) {
-            cached_program
-        } else {
-            let mut parser = Parser::new(code);
-            let program = parser
-                .parse_program()
-                .map_err(|e| ErrorReport::parse_error(e.to_string()))?;
-
-            let optimized = self.optimizer.optimize_program(&program);
-            self.cache.insert(code, optimized.clone());
-            optimized
-        };
+        let (program, sites, positions) = self
+            .compile_cached_raw(code)
+            .map_err(ErrorReport::parse_error)?;
+        self.evaluator.record_function_sites(&sites);
+        self.evaluator.record_statement_sites(positions);
 
         self.evaluator
             .eval_program(&program)
+            .and_then(|value| {
+                self.evaluator.check_result_size(&value)?;
+                Ok(value)
+            })
             .map_err(|e| e.to_error_report())
     }
 
+    /// 最近一次求值是否修改了全局状态（设置全局变量、定义函数等）
+    ///
+    /// 用于拒绝本应只读的脚本（例如谓词）。由解释器在求值时记录，
+    /// 比前后对比全部变量更廉价；求值失败时反映失败前已发生的修改。
+    /// 宿主调用 `set_global` 等方法不计入，函数内部的局部变量也不计入。
+    pub fn last_eval_had_side_effects(&self) -> bool {
+        self.evaluator.last_eval_had_side_effects()
+    }
+
+    /// 最近一次求值调用过的宿主函数名称（去重，按首次调用的顺序）
+    ///
+    /// 用于审计脚本是否用到了宿主能力，比设置调用钩子更廉价。每次求值开始时清空；
+    /// 求值失败时包含失败前已调用的函数。只记录通过 `register_function` 或宿主函数
+    /// 注册表提供的函数，不包括内置函数。
+    pub fn last_eval_called_hosts(&self) -> Vec<String> {
+        self.evaluator.called_hosts().to_vec()
+    }
+
+    /// 求值代码并同时返回结果的来源。
+    ///
+    /// 可以区分顶层 `Return` 显式返回的值、最后一条语句的值，
+    /// 以及脚本没有产生值（`ResultKind::Void`）的情况。
+    pub fn eval_with_kind(&mut self, code: &str) -> Result<(Value, ResultKind), String> {
+        let value = self.eval(code)?;
+        Ok((value, self.evaluator.last_result_kind()))
+    }
+
+    /// 求值代码并同时返回产生结果的顶层语句在源码中的位置（从 1 开始的行列）。
+    ///
+    /// 位置指向最后一条语句，或执行顶层 `Return` 的那条顶层语句；
+    /// 脚本没有产生值（`ResultKind::Void`，例如最后一条语句是 `PRINTLN`）时为 `None`。
+    pub fn eval_with_span(&mut self, code: &str) -> Result<(Value, Option<Position>), String> {
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
+
+        let compiled = self.compile_cached(code)?;
+        let value = self.run_compiled(&compiled)?;
+
+        let (_, _, positions) = compiled;
+        let span = self
+            .evaluator
+            .last_result_index()
+            .map(|index| positions[index]);
+        Ok((value, span))
+    }
+
+    /// 求值代码并返回引擎内部测得的耗时。
+    ///
+    /// 计时只覆盖解析、优化与求值本身，不包含宿主侧（如 FFI 编组）的开销，
+    /// 适合按规则统计执行耗时。
+    pub fn eval_timed(&mut self, code: &str) -> (Result<Value, String>, std::time::Duration) {
+        let start = std::time::Instant::now();
+        let result = self.eval(code);
+        (result, start.elapsed())
+    }
+
+    /// 求值代码并分别返回解析和执行两个阶段的耗时（见 [`EvalPhases`]）
+    ///
+    /// 与 [`Aether::eval_timed`] 一样在引擎内部计时，不包含宿主侧的开销。
+    /// 代码已在 AST 缓存中时不会解析，`cached` 为 true。解析阶段占比高的负载
+    /// 适合先用 [`Aether::compile`] 预编译，或调大 AST 缓存。
+    pub fn eval_phases(&mut self, code: &str) -> (Result<Value, String>, EvalPhases) {
+        self.begin_eval();
+        self.evaluator.clear_interrupt();
+
+        let hits = self.cache.stats().hits;
+        let start = std::time::Instant::now();
+        let compiled = self.compile_cached(code);
+        let mut phases = EvalPhases {
+            parse: start.elapsed(),
+            cached: self.cache.stats().hits > hits,
+            ..EvalPhases::default()
+        };
+
+        let result = compiled.and_then(|compiled| {
+            let start = std::time::Instant::now();
+            let result = self.run_compiled(&compiled);
+            phases.eval = start.elapsed();
+            result
+        });
+        (result, phases)
+    }
+
+    /// 求值代码并返回本次求值的资源统计（步数、最大调用深度、最大数组长度）。
+    ///
+    /// 求值失败（包括触发执行限制）时同样返回统计，
+    /// 便于了解脚本离各项限制还有多远。
+    pub fn eval_with_stats(&mut self, code: &str) -> (Result<Value, String>, EvalStats) {
+        self.evaluator.reset_eval_stats();
+        let result = self.eval(code);
+        (result, self.evaluator.eval_stats())
+    }
+
+    /// 求值代码并把结果转换为 `T`
+    ///
+    /// 目标类型在编译期确定，支持的类型和转换规则见 [`FromValue`]，
+    /// 例如 `engine.eval_as::<Vec<String>>(code)`。结果类型不符时返回类型错误；
+    /// 脚本没有产生值时返回 `Script produced no value` 错误（[`RuntimeError::NoValue`]）。
+    pub fn eval_as<T: FromValue>(&mut self, code: &str) -> Result<T, String> {
+        let value = self.eval(code)?;
+        let converted = if self.evaluator.last_result_kind().is_void() {
+            T::from_void()
+        } else {
+            T::from_value(value)
+        };
+        converted.map_err(|e| self.runtime_error_message(e))
+    }
+
+    /// 求值谓词脚本并返回布尔结果
+    ///
+    /// 结果不是 `Boolean` 时返回类型错误，不做真值转换。
+    pub fn eval_bool(&mut self, code: &str) -> Result<bool, String> {
+        self.eval_as(code)
+    }
+
+    /// 求值代码并返回整数结果
+    ///
+    /// 结果必须是没有小数部分、且在 `i64` 范围内的数字，否则返回类型错误。
+    pub fn eval_int(&mut self, code: &str) -> Result<i64, String> {
+        self.eval_as(code)
+    }
+
+    /// 求值代码并返回任意精度整数结果
+    ///
+    /// 结果可以是没有小数部分的数字，或分母为 1 的分数（`IntOverflowMode::BigInt`
+    /// 下超出范围的整数和大整数字面量都以这种形式表示），否则返回类型错误。
+    pub fn eval_bigint(&mut self, code: &str) -> Result<BigInt, String> {
+        let value = self.eval(code)?;
+        if self.evaluator.last_result_kind().is_void() {
+            return Err(self.runtime_error_message(RuntimeError::NoValue));
+        }
+        let n = match &value {
+            Value::Fraction(f) if f.is_integer() => Some(f.to_integer()),
+            Value::Number(n) if n.fract() == 0.0 => BigInt::from_f64(*n),
+            Value::Number(_) | Value::Fraction(_) => None,
+            other => return Err(self.result_type_error("Number", other)),
+        };
+        n.ok_or_else(|| {
+            self.runtime_error_message(RuntimeError::TypeErrorDetailed {
+                expected: "integer".to_string(),
+                got: value.to_string(),
+            })
+        })
+    }
+
+    /// 求值代码并返回浮点数结果（分数会转换为最接近的浮点数）
+    pub fn eval_float(&mut self, code: &str) -> Result<f64, String> {
+        self.eval_as(code)
+    }
+
+    /// 生成结果类型不符时的错误字符串
+    pub(crate) fn result_type_error(&self, expected: &str, got: &Value) -> String {
+        self.runtime_error_message(RuntimeError::TypeErrorDetailed {
+            expected: expected.to_string(),
+            got: got.type_name().to_string(),
+        })
+    }
+
     /// 配置用于 `Import/Export` 的模块解析器。
     ///
     /// 默认情况下（DSL 嵌入），解析器出于安全考虑被禁用。
@@ -80,6 +444,23 @@ impl Aether {
         self.evaluator.pop_import_base();
     }
 
+    /// 以 `name` 为命名空间注册一个模块。
+    ///
+    /// 模块在脚本第一次引用 `name` 时于独立环境中求值，其所有顶层定义
+    /// 都可以通过 `name.FUNC(...)` 访问（也可以 `Import {FUNC} From "name"`），
+    /// 模块之间可以互相引用；加载时出现循环依赖会返回 `circular import detected` 错误。
+    /// 注册时只检查语法，重复注册同名模块会替换旧模块。
+    pub fn add_module(&mut self, name: &str, code: &str) -> Result<(), String> {
+        if !crate::token::Token::is_identifier(name) {
+            return Err(format!("Invalid module name: {:?}", name));
+        }
+        self.parser(code)
+            .parse_program()
+            .map_err(|e| self.parse_error_message(e))?;
+        self.evaluator.register_module(name, code.to_string());
+        Ok(())
+    }
+
     /// 从文件路径求值 Aether 脚本。
     ///
     /// 这是一个便利包装器，它：
@@ -129,13 +510,154 @@ impl Aether {
         self.evaluator.set_global(name.to_string(), value);
     }
 
+    /// 将浮点数切片作为数字数组设置为全局变量
+    ///
+    /// 一次调用完成转换，不经过 JSON 序列化和解析，适合注入大批数值数据。
+    /// 数据会被复制进引擎，之后修改 `data` 不影响脚本看到的数组。变量名不合法时返回错误。
+    pub fn set_float_slice(&mut self, name: &str, data: &[f64]) -> Result<(), String> {
+        self.set_numbers(name, data.iter().copied())
+    }
+
+    /// 将整数切片作为数字数组设置为全局变量
+    ///
+    /// 与 [`Aether::set_float_slice`] 相同，数据会被复制进引擎。Aether 的数字为 `f64`，
+    /// 绝对值超过 2^53 的整数会按 `as f64` 的规则舍入。
+    pub fn set_int_slice(&mut self, name: &str, data: &[i64]) -> Result<(), String> {
+        self.set_numbers(name, data.iter().map(|&n| n as f64))
+    }
+
+    /// 以给定数字构造数组并设置为全局变量
+    fn set_numbers(
+        &mut self,
+        name: &str,
+        numbers: impl Iterator<Item = f64>,
+    ) -> Result<(), String> {
+        if !crate::token::Token::is_identifier(name) {
+            return Err(format!("Invalid variable name: {:?}", name));
+        }
+        let array = Value::Array(numbers.map(Value::Number).collect());
+        self.evaluator.set_global(name.to_string(), array);
+        Ok(())
+    }
+
+    /// 设置脚本只能读取、不能重新赋值的常量。
+    ///
+    /// 脚本中对该名称的 `Set`（包括 `Set NAME[i] ...` 修改其内容）、同名 `Func`
+    /// 定义或用作循环变量都会产生运行时错误 `Cannot reassign constant`。
+    /// 宿主可以再次调用本方法替换常量的值；常量在 `reset_env` 之后仍然有效。
+    pub fn set_const(&mut self, name: &str, value: Value) -> Result<(), String> {
+        if !crate::token::Token::is_identifier(name) {
+            return Err(format!("Invalid variable name: {:?}", name));
+        }
+        self.evaluator.set_const(name, value);
+        Ok(())
+    }
+
+    /// 把所有常量恢复为普通全局变量（当前值保留）。
+    pub fn clear_constants(&mut self) {
+        self.evaluator.clear_constants();
+    }
+
+    /// 绑定与其他引擎共享的只读数据（见 [`SharedData`]）
+    ///
+    /// 数据不会被复制：由同一个 `SharedData` 克隆出的句柄绑定到多个引擎时，
+    /// 它们读取的是同一份数据，适合大量引擎共用一张较大的查找表。
+    /// 脚本中的 `NAME["key"][i]` 这类索引链只复制选中的元素，直接读取 `NAME`
+    /// 则会复制出完整的值。与常量一样，脚本不能重新赋值或修改该名称，
+    /// 绑定在 `reset_env` 之后仍然有效；同名的全局变量会被替换。变量名不合法时返回错误。
+    pub fn set_shared_data(&mut self, name: &str, data: &SharedData) -> Result<(), String> {
+        if !crate::token::Token::is_identifier(name) {
+            return Err(format!("Invalid variable name: {:?}", name));
+        }
+        self.evaluator.set_shared_data(name, data.clone());
+        Ok(())
+    }
+
+    /// 构造时绑定共享数据，见 [`Aether::set_shared_data`]
+    pub fn with_shared_data(mut self, name: &str, data: &SharedData) -> Result<Self, String> {
+        self.set_shared_data(name, data)?;
+        Ok(self)
+    }
+
+    /// 解除共享数据的绑定，返回该名称之前是否绑定了共享数据
+    pub fn remove_shared_data(&mut self, name: &str) -> bool {
+        self.evaluator.remove_shared_data(name)
+    }
+
+    /// 一次性设置多个全局变量。
+    ///
+    /// 先校验所有变量名，任何一个不是合法标识符时返回包含该名称的错误，
+    /// 且不会设置任何变量。
+    pub fn set_globals<I, K>(&mut self, vars: I) -> Result<(), String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        let vars = checked_vars(vars)?;
+        for (name, value) in vars {
+            self.evaluator.set_global(name, value);
+        }
+        Ok(())
+    }
+
     /// 重置运行时环境（变量/函数），同时保持内置函数注册。
     ///
-    /// 注意：这会清除通过 `eval()` 引入的任何内容（包括 stdlib 代码）。
+    /// 注意：这会清除通过 `eval()` 引入的任何内容（包括 stdlib 代码），
+    /// 但通过 `load_prelude()` 加载的函数会被重新定义。
     pub fn reset_env(&mut self) {
         self.evaluator.reset_env();
     }
 
+    /// 将全局变量和用户定义的函数序列化为字节，供缓存后用 `load_state()` 恢复
+    ///
+    /// 字节带有格式版本号。内置函数和宿主常量属于引擎配置，不会被保存；
+    /// 捕获了局部变量的闭包、生成器和惰性值无法保存，遇到时返回错误。
+    pub fn save_state(&self) -> Result<Vec<u8>, String> {
+        self.evaluator.save_state().map_err(|e| self.label_error(e))
+    }
+
+    /// 恢复 `save_state()` 保存的全局变量和函数，同名的现有变量会被覆盖
+    ///
+    /// 字节损坏或格式版本不兼容时返回错误，且不会修改引擎。
+    /// 恢复的函数绑定到本引擎的全局作用域，与在本引擎中直接定义的效果相同。
+    /// 与本引擎的宿主常量或共享数据同名的变量不会被恢复，它们保持只读。
+    pub fn load_state(&mut self, bytes: &[u8]) -> Result<(), String> {
+        self.evaluator
+            .load_state(bytes)
+            .map_err(|e| self.label_error(e))
+    }
+
+    /// 加载公共函数库（prelude）作为基础层。
+    ///
+    /// `code` 只能包含 `Func`/`Generator` 定义，且函数名不能是常量或共享数据，
+    /// 否则返回错误且不定义任何函数。
+    /// 加载的函数在 `reset_env()` 之后仍然可用，因此每个请求的脚本都可以直接调用，
+    /// 无需重复定义。可多次调用以追加定义。
+    pub fn load_prelude(&mut self, code: &str) -> Result<(), String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| self.parse_error_message(e))?;
+
+        self.evaluator
+            .load_prelude(&program)
+            .map_err(|(index, reason)| {
+                let position = parser.top_level_positions()[index];
+                self.label_error(format!(
+                    "Prelude error: {} at line {}, column {}",
+                    reason, position.line, position.column
+                ))
+            })?;
+        self.evaluator
+            .record_function_sites(&definition_sites(&program, parser.top_level_positions()));
+        Ok(())
+    }
+
+    /// 清除已加载的 prelude（当前环境中的函数保留到下一次 `reset_env()`）
+    pub fn clear_prelude(&mut self) {
+        self.evaluator.clear_prelude();
+    }
+
     /// 在隔离的子作用域内运行闭包。
     ///
     /// 在闭包内注入或定义的所有变量/函数将在返回时被丢弃，而外部环境被保留。
@@ -152,6 +674,108 @@ impl Aether {
         result
     }
 
+    /// 在临时覆盖若干变量的情况下求值代码
+    ///
+    /// `vars` 放在仅用于本次求值的子作用域中，遮蔽同名全局变量；
+    /// 求值结束后连同脚本在其中定义的变量一起丢弃，不会影响下一次调用。
+    /// 适合用不同的数据行反复执行同一条规则（解析结果由 AST 缓存复用）。
+    pub fn eval_with<I, K>(&mut self, code: &str, vars: I) -> Result<Value, String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        self.with_isolated_scope(|engine| {
+            engine.set_globals(vars)?;
+            engine.eval(code)
+        })
+    }
+
+    /// 使用指定随机数种子并临时覆盖若干变量求值代码
+    ///
+    /// 变量的处理与 [`Aether::eval_with`] 相同。`RANDOM/RANDOM_INT` 在本次求值中使用
+    /// 以 `seed` 初始化的生成器，求值结束后（无论成功与否）恢复引擎原来的随机数状态，
+    /// 因此例如以记录编号作为种子即可让每条记录得到可复现的随机序列，而不影响其他求值。
+    pub fn eval_with_seed<I, K>(&mut self, code: &str, seed: u64, vars: I) -> Result<Value, String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        let saved = self.evaluator.replace_rng(SeededRng::new(seed));
+        let result = self.eval_with(code, vars);
+        self.evaluator.replace_rng(saved);
+        result
+    }
+
+    /// 对多行输入逐行求值同一段代码，返回与输入一一对应的结果
+    ///
+    /// 代码只解析和优化一次；每行的变量与 [`Aether::eval_with`] 一样放在仅用于该行的
+    /// 子作用域中，行与行之间互不影响。某一行出错（包括变量名不合法）只会使该行的
+    /// 结果为 `Err`，其余行照常求值；代码无法解析时每一行都返回同一个解析错误。
+    /// 执行限制按行计算。批处理开始后发出的中断会使当前行及其后所有行返回中断错误。
+    pub fn eval_many<I, R, K>(&mut self, code: &str, rows: I) -> Vec<Result<Value, String>>
+    where
+        I: IntoIterator<Item = R>,
+        R: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        self.evaluator.clear_interrupt();
+        let compiled = self.compile_cached(code);
+        rows.into_iter()
+            .map(|vars| {
+                let compiled = compiled.as_ref().map_err(Clone::clone)?;
+                self.with_isolated_scope(|engine| {
+                    engine.begin_eval();
+                    engine.set_globals(vars)?;
+                    engine.run_compiled(compiled)
+                })
+            })
+            .collect()
+    }
+
+    /// 对 CSV 形式的记录逐行求值同一段代码，返回与输入一一对应的结果
+    ///
+    /// 每行的第 i 列绑定到 `header[i]` 命名的变量，其余行为与 [`Aether::eval_many`] 相同。
+    /// 字段按以下规则转换：去掉首尾空白后符合十进制数字写法（可带负号、小数部分和指数，
+    /// 整数部分不可省略，且除 `0` 外不以 `0` 开头）的字段转为数字，其余字段（包括空字段、`007`
+    /// 这类带前导零的编号以及 `inf`/`NaN`）保持为原样的字符串。
+    /// 列数与表头不一致的行返回错误，不会被求值。
+    pub fn eval_csv<H, R, F>(
+        &mut self,
+        code: &str,
+        header: &[H],
+        rows: R,
+    ) -> Vec<Result<Value, String>>
+    where
+        H: AsRef<str>,
+        R: IntoIterator<Item = F>,
+        F: AsRef<[String]>,
+    {
+        self.evaluator.clear_interrupt();
+        let compiled = self.compile_cached(code);
+        rows.into_iter()
+            .map(|fields| {
+                let compiled = compiled.as_ref().map_err(Clone::clone)?;
+                let fields = fields.as_ref();
+                if fields.len() != header.len() {
+                    return Err(format!(
+                        "Record has {} fields, expected {}",
+                        fields.len(),
+                        header.len()
+                    ));
+                }
+                let vars = header
+                    .iter()
+                    .zip(fields)
+                    .map(|(name, field)| (name.as_ref(), csv_field_value(field)));
+                self.with_isolated_scope(|engine| {
+                    engine.begin_eval();
+                    engine.set_globals(vars)?;
+                    engine.run_compiled(compiled)
+                })
+            })
+            .collect()
+    }
+
     /// 异步求值 Aether 代码（需要 "async" 特性）
     ///
     /// 这是围绕 `eval()` 的便利包装器，在后台任务中运行。
@@ -164,3 +788,56 @@ impl Aether {
         self.eval(code)
     }
 }
+
+/// 收集变量，任何一个变量名不是合法标识符时返回包含该名称的错误
+pub(super) fn checked_vars<I, K>(vars: I) -> Result<Vec<(String, Value)>, String>
+where
+    I: IntoIterator<Item = (K, Value)>,
+    K: Into<String>,
+{
+    let vars: Vec<(String, Value)> = vars.into_iter().map(|(k, v)| (k.into(), v)).collect();
+    if let Some((name, _)) = vars
+        .iter()
+        .find(|(name, _)| !crate::token::Token::is_identifier(name))
+    {
+        return Err(format!("Invalid variable name: {:?}", name));
+    }
+    Ok(vars)
+}
+
+/// 按 [`Aether::eval_csv`] 的规则转换 CSV 字段：数字写法的字段转为数字，其余保持字符串
+fn csv_field_value(field: &str) -> Value {
+    let text = field.trim();
+    let unsigned = text.strip_prefix('-').unwrap_or(text);
+    let mantissa = unsigned
+        .split_once(['e', 'E'])
+        .map_or(unsigned, |(mantissa, _)| mantissa);
+    let integer = mantissa
+        .split_once('.')
+        .map_or(mantissa, |(integer, _)| integer);
+    let numeric = !integer.is_empty()
+        && integer.bytes().all(|b| b.is_ascii_digit())
+        && (integer == "0" || !integer.starts_with('0'))
+        && unsigned
+            .bytes()
+            .all(|b| b.is_ascii_digit() || matches!(b, b'.' | b'e' | b'E' | b'+' | b'-'));
+    match text.parse::<f64>() {
+        Ok(n) if numeric && n.is_finite() => Value::Number(n),
+        _ => Value::String(field.to_string()),
+    }
+}
+
+/// 编译结果：优化后的程序、顶层函数定义位置以及每条顶层语句的位置
+type Compiled = (Program, DefinitionSites, Vec<Position>);
+
+/// 顶层 `Func` 定义的名称与位置（`positions` 为各顶层语句的起始位置）
+fn definition_sites(program: &Program, positions: &[Position]) -> DefinitionSites {
+    program
+        .iter()
+        .zip(positions)
+        .filter_map(|(stmt, position)| match stmt {
+            Stmt::FuncDef { name, .. } => Some((name.clone(), *position)),
+            _ => None,
+        })
+        .collect()
+}
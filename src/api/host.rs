@@ -0,0 +1,86 @@
+use super::Aether;
+use crate::runtime::{FileSystem, HostContext, HostData, HostRegistry};
+use crate::value::Value;
+
+impl Aether {
+    /// 设置调用钩子：脚本每次调用用户函数、内置函数或宿主函数之前，以函数名和实参调用
+    ///
+    /// 适合记录审计日志。递归调用每一层都会触发；Lambda 的名称为 `<lambda>`。
+    /// 注意优化器会把自身尾递归改写为循环，这类递归只在首次调用时触发，
+    /// 需要逐层记录时可以用 `set_optimization` 关闭尾递归优化。
+    /// 未设置钩子时没有额外开销。
+    pub fn set_call_hook<F: Fn(&str, &[Value]) + 'static>(&mut self, hook: F) {
+        self.evaluator.set_call_hook(Some(Box::new(hook)));
+    }
+
+    /// 移除调用钩子
+    pub fn clear_call_hook(&mut self) {
+        self.evaluator.set_call_hook(None);
+    }
+
+    // ============================================================
+    // 宿主函数
+    // ============================================================
+
+    /// 注册仅属于当前引擎的宿主函数
+    ///
+    /// 脚本中的同名变量和内置函数优先于宿主函数。
+    /// 宿主函数返回的 `Err` 会作为运行时错误终止本次求值。
+    pub fn register_function<F>(&mut self, name: &str, arity: usize, func: F)
+    where
+        F: Fn(&[Value]) -> Result<Value, String> + Send + Sync + 'static,
+    {
+        self.evaluator.register_host_function(name, arity, func);
+    }
+
+    /// 注册需要求值上下文的宿主函数
+    ///
+    /// 函数调用时会收到 [`HostContext`]，其中包含本次求值的截止时间
+    /// 以及通过 [`Aether::eval_with_context`] 传入的宿主数据。
+    pub fn register_function_with_context<F>(&mut self, name: &str, arity: usize, func: F)
+    where
+        F: Fn(&HostContext, &[Value]) -> Result<Value, String> + Send + Sync + 'static,
+    {
+        self.evaluator
+            .register_host_function_with_context(name, arity, func);
+    }
+
+    /// 携带宿主数据求值
+    ///
+    /// `data` 仅在本次求值期间对带上下文的宿主函数可见（`ctx.get::<T>()`），
+    /// 求值结束后恢复为之前的数据，因此不同请求之间不会互相泄漏。
+    pub fn eval_with_context(&mut self, code: &str, data: HostData) -> Result<Value, String> {
+        let previous = self.evaluator.set_host_data(Some(data));
+        let result = self.eval(code);
+        self.evaluator.set_host_data(previous);
+        result
+    }
+
+    /// 挂载共享的宿主函数注册表
+    ///
+    /// 同一个注册表可以挂载到多个引擎；之后注册到其中的函数对所有引擎立即可见。
+    /// 引擎私有的函数（`register_function`）优先于共享注册表中的同名函数。
+    pub fn with_registry(mut self, registry: HostRegistry) -> Self {
+        self.evaluator.attach_host_registry(registry);
+        self
+    }
+
+    /// 挂载共享的宿主函数注册表（见 [`Aether::with_registry`]）
+    pub fn attach_registry(&mut self, registry: HostRegistry) {
+        self.evaluator.attach_host_registry(registry);
+    }
+
+    /// 让文件内置函数读写宿主提供的文件系统
+    ///
+    /// 挂载后 `READ_FILE`、`WRITE_FILE`、`APPEND_FILE`、`FILE_EXISTS` 只访问 `fs`，
+    /// 不再触及磁盘；其余文件内置函数返回运行时错误。
+    /// 文件内置函数仍需启用文件系统权限才会注册。
+    pub fn set_file_system<F: FileSystem + 'static>(&mut self, fs: F) {
+        self.evaluator.set_file_system(Some(Box::new(fs)));
+    }
+
+    /// 卸载宿主文件系统，恢复访问真实文件系统
+    pub fn clear_file_system(&mut self) {
+        self.evaluator.set_file_system(None);
+    }
+}
@@ -0,0 +1,236 @@
+use super::Aether;
+use crate::analysis::{
+    CostEstimate, Diagnostic, TypeKind, check_pure_expression, diagnostics, estimate_cost,
+    free_variables, infer_type, required_permissions, unused_variables,
+};
+use crate::ast_json::{comments_to_json, program_to_json};
+use crate::builtins::IOPermissions;
+use crate::parser::{OperatorInfo, Parser};
+use crate::runtime::{FunctionInfo, StateChange, diff_globals};
+use crate::value::Value;
+use std::collections::BTreeMap;
+
+impl Aether {
+    /// 返回代码编译后（解析 + 优化）的 AST 文本转储
+    ///
+    /// 输出即 `eval()` 实际执行的语法树，可用于分析不同写法的性能差异。
+    /// 该方法只读：不会执行代码、修改环境或写入 AST 缓存，可重复调用。
+    pub fn disassemble(&self, code: &str) -> Result<String, String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        let optimized = self.optimizer.optimize_program(&program);
+
+        Ok(optimized
+            .iter()
+            .map(|stmt| format!("{:#?}", stmt))
+            .collect::<Vec<_>>()
+            .join("\n"))
+    }
+
+    /// 将代码解析为 JSON 格式的 AST，供外部静态分析工具使用
+    ///
+    /// 返回未经优化的语法树（与源码结构一致）。每个语句和表达式节点都包含 `kind`
+    /// 以及起始位置 `line`/`column`（从 1 开始）。代码无法解析时返回解析错误，
+    /// 不会返回部分语法树。格式见 [`crate::ast_json`]。
+    pub fn parse_ast(&self, code: &str) -> Result<String, String> {
+        let mut parser = self.parser(code);
+        let (program, statements, expressions) = parser
+            .parse_program_with_expression_positions()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        Ok(program_to_json(&program, &statements, &expressions).to_string())
+    }
+
+    /// 解析代码并以 JSON 数组返回其中的注释，供格式化等需要重新输出源码的工具使用
+    ///
+    /// 注释不属于 AST，按源码顺序返回 `{"text": ..., "line": ..., "column": ...}`：
+    /// `text` 含 `//` 或 `/* */` 定界符，位置为注释首字符（从 1 开始）。
+    /// 结合 [`Aether::parse_ast`] 中语句的位置即可把注释放回最近的语句旁。
+    /// 代码无法解析时返回解析错误。
+    pub fn parse_comments(&self, code: &str) -> Result<String, String> {
+        let mut parser = self.parser(code);
+        parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        Ok(comments_to_json(parser.comments()).to_string())
+    }
+
+    /// 校验代码并返回静态分析警告（不执行代码）
+    ///
+    /// 代码无法解析时返回解析错误；否则返回警告列表，目前包括
+    /// 赋值后从未读取的变量（例如把 `SUM` 误写成 `SUMM`）。
+    /// 开启 [`Aether::with_warnings_as_errors`] 时，存在警告即返回列出全部警告的错误。
+    pub fn validate_with_warnings(&self, code: &str) -> Result<Vec<Diagnostic>, String> {
+        let mut parser = self.parser(code);
+        let (program, positions) = parser
+            .parse_program_with_positions()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        self.check_warnings(&program, &positions)
+            .map_err(|e| format!("Parse error: {}", e))?;
+        Ok(unused_variables(&program, &positions))
+    }
+
+    /// 收集代码的全部诊断信息（不执行代码），供编辑器/LSP 使用
+    ///
+    /// 结果合并了解析错误、未定义标识符（错误）和赋值后从未读取的变量（警告），
+    /// 每项包含稳定的 `code`（如 `undefined-identifier`）以及起止位置。
+    /// 该方法不会返回错误：代码无法解析时返回解析错误，并尽量分析出错行之前的代码。
+    /// 当前引擎中已存在的全局变量、内置函数、宿主函数和模块不视为未定义。
+    pub fn diagnostics(&self, code: &str) -> Vec<Diagnostic> {
+        let parse = |source: &str| self.parser(source).parse_program_with_positions();
+        let is_known = |name: &str| self.evaluator.is_defined(name);
+        diagnostics(code, &parse, &is_known)
+    }
+
+    /// 估算引擎全局作用域（变量、常量和用户定义的函数）占用的字节数
+    ///
+    /// 结果是近似值：包括字符串、数组、字典等的堆内存，会随数组增长而增长，
+    /// 但不包括 AST 缓存、宿主函数以及函数体内部的完整语法树。
+    /// 可用于判断长期复用的引擎是否需要 `reset_env()`。
+    pub fn memory_usage(&self) -> usize {
+        self.evaluator.memory_usage()
+    }
+
+    /// 判断代码是否只是尚未输入完整（例如 `{` 未闭合、以运算符结尾）
+    ///
+    /// 用于交互式 shell 判断是否需要继续读取下一行；完整的代码以及
+    /// 在输入结束前就出错的代码都返回 `false`。
+    pub fn is_incomplete(code: &str) -> bool {
+        Parser::is_incomplete(code)
+    }
+
+    /// 列出所有运算符及解析器使用的优先级和结合性，按结合从松到紧排序
+    ///
+    /// 供转译器等工具按与解析器完全一致的规则加括号（见 [`Parser::operator_table`]）。
+    pub fn operator_table() -> Vec<OperatorInfo> {
+        Parser::operator_table()
+    }
+
+    /// 区分“尚未输入完整”和“语法错误”
+    ///
+    /// 代码完整时返回 `Ok(false)`，只是尚未输入完整时返回 `Ok(true)`（见
+    /// [`Aether::is_incomplete`]），无论后续输入什么都无法解析时返回解析错误。
+    pub fn check_incomplete(code: &str) -> Result<bool, String> {
+        Parser::check_incomplete(code).map_err(|e| format!("Parse error: {}", e))
+    }
+
+    /// 列出全局作用域中用户定义的 `Func`（按名称排序），包括 prelude 中的函数
+    ///
+    /// 不包括内置函数、宿主函数和匿名 Lambda。位置为函数最近一次定义所在的
+    /// 顶层语句；不在顶层定义的函数位置为 0。
+    pub fn functions(&self) -> Vec<FunctionInfo> {
+        self.evaluator.functions()
+    }
+
+    /// 返回全局变量和用户定义函数的快照（按名称排序）
+    ///
+    /// 不包括内置函数和宿主设置的常量。可以在求值前后各取一次，用
+    /// [`diff_globals`] 比较脚本的改动，或直接使用 [`Aether::eval_diff`]。
+    pub fn globals(&self) -> BTreeMap<String, Value> {
+        self.evaluator.globals()
+    }
+
+    /// 求值代码并返回它对全局变量造成的改动
+    ///
+    /// 改动按变量名排序，分为新增、删除和修改三种（见 [`StateChange`]）。
+    /// 求值失败时同样返回失败前已经发生的改动，便于断言规则只改动了预期的变量。
+    pub fn eval_diff(&mut self, code: &str) -> (Result<Value, String>, Vec<StateChange>) {
+        let before = self.globals();
+        let result = self.eval(code);
+        let changes = diff_globals(&before, &self.globals());
+        (result, changes)
+    }
+
+    /// 静态扫描代码会用到的 IO 权限（不执行代码）
+    ///
+    /// 只要代码中出现文件系统或网络内置函数的名称即视为需要对应权限，
+    /// 即使所在分支或函数不会执行。通过宿主函数、导入的模块等间接进行的 IO
+    /// 无法被发现，因此结果不能替代运行时的权限检查。
+    pub fn required_permissions(&self, code: &str) -> Result<IOPermissions, String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        Ok(required_permissions(&program))
+    }
+
+    /// 列出代码读取但自身没有定义的变量（不执行代码）
+    ///
+    /// 即求值前需要通过 `set_global` 等方式提供的输入，按首次读取的顺序返回、不重复。
+    /// 代码中 `Set` 的变量、函数和 Lambda 的参数、循环变量以及导入的名称都不算在内；
+    /// 内置函数、宿主函数、模块和全局作用域中的函数也不算在内。
+    /// 已设置的全局变量仍会列出，因为代码确实需要它们。代码无法解析时返回解析错误。
+    pub fn free_variables(&self, code: &str) -> Result<Vec<String>, String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        let is_provided = |name: &str| self.evaluator.is_callable_name(name);
+        Ok(free_variables(&program, &is_provided))
+    }
+
+    /// 推断代码结果的类型（不执行代码）
+    ///
+    /// 已设置的全局变量按其当前值的类型参与推断，例如 `X` 为整数时
+    /// `(X + 1)` 推断为 `Int`。函数调用、循环等依赖运行时的情况返回
+    /// `TypeKind::Unknown`，而不是猜测。代码无法解析时返回解析错误。
+    pub fn infer_type(&self, code: &str) -> Result<TypeKind, String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        let lookup = |name: &str| {
+            self.evaluator
+                .get_global(name)
+                .map(|value| TypeKind::of(&value))
+        };
+        Ok(infer_type(&program, &lookup))
+    }
+
+    /// 校验代码是否为没有副作用的布尔谓词（不执行代码），适合在保存用户编写的过滤条件前调用
+    ///
+    /// 要求代码只有一个表达式：不能有 `Set`、函数或 Lambda 定义等语句，`If`
+    /// 分支中也只能是表达式；只能调用没有副作用的内置函数（输出、跟踪、随机数、
+    /// 文件系统和网络函数除外），脚本函数和宿主函数的副作用无法检查，同样不允许调用。
+    /// 最后按 [`Aether::infer_type`] 推断结果类型，必须为 `Boolean`。函数调用的结果类型
+    /// 无法静态确定，需要写成比较，例如 `(CONTAINS(NAME, "x") == True)`。
+    /// 代码无法解析时返回解析错误，不满足要求时返回 `Invalid predicate: ...` 错误。
+    pub fn validate_predicate(&self, code: &str) -> Result<(), String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+
+        let purity = |name: &str| self.evaluator.function_purity(name);
+        check_pure_expression(&program, &purity)
+            .map_err(|e| format!("Invalid predicate: {}", e))?;
+
+        let lookup = |name: &str| {
+            self.evaluator
+                .get_global(name)
+                .map(|value| TypeKind::of(&value))
+        };
+        match infer_type(&program, &lookup) {
+            TypeKind::Boolean => Ok(()),
+            other => Err(format!(
+                "Invalid predicate: result must be Boolean, found {}",
+                other.name()
+            )),
+        }
+    }
+
+    /// 静态估算代码的执行开销（不执行代码）
+    ///
+    /// 返回循环个数、最深循环嵌套、最深块嵌套、函数和调用个数、可能递归的函数，
+    /// 以及一个启发式的综合分数（见 [`estimate_cost`]）。精确开销不可判定，
+    /// 结果只适合在运行不受信任的脚本之前按阈值粗筛，不能替代执行限制。
+    /// 代码无法解析时返回解析错误。
+    pub fn estimate_cost(&self, code: &str) -> Result<CostEstimate, String> {
+        let mut parser = self.parser(code);
+        let program = parser
+            .parse_program()
+            .map_err(|e| format!("Parse error: {}", e))?;
+        Ok(estimate_cost(&program))
+    }
+}
@@ -1,5 +1,5 @@
 use super::Aether;
-use crate::runtime::ExecutionLimits;
+use crate::runtime::{ConfiguredLimits, ExecutionLimits, InterruptHandle, LimitKind};
 
 impl Aether {
     // ============================================================
@@ -21,4 +21,159 @@ impl Aether {
     pub fn limits(&self) -> &ExecutionLimits {
         self.evaluator.limits()
     }
+
+    /// 获取当前生效的全部限制，包括 [`Aether::limits`] 之外单独设置的各项限制
+    pub fn configured_limits(&self) -> ConfiguredLimits {
+        let limits = self.limits();
+        ConfiguredLimits {
+            max_steps: limits.max_steps,
+            max_recursion_depth: limits.max_recursion_depth,
+            max_duration_ms: limits.max_duration_ms,
+            max_memory_bytes: limits.max_memory_bytes,
+            max_result_bytes: self.max_result_size(),
+            max_array_length: self.max_array_length(),
+            max_output_bytes: self.max_output_bytes(),
+            max_functions: self.max_functions(),
+            max_nesting_depth: self.max_nesting_depth(),
+            no_recursion: self.no_recursion(),
+        }
+    }
+
+    /// 设置顶层结果的最大字节数（按结果的字符串形式计算，`None` 表示不限制）
+    ///
+    /// 超出时 `eval` 返回错误而不是交出整个结果，避免脚本返回超大字符串或数组。
+    pub fn set_max_result_size(&mut self, max_bytes: Option<usize>) {
+        self.evaluator.set_max_result_bytes(max_bytes);
+    }
+
+    /// 获取顶层结果的最大字节数
+    pub fn max_result_size(&self) -> Option<usize> {
+        self.evaluator.max_result_bytes()
+    }
+
+    /// 设置单个数组的最大元素个数（`None` 表示不限制）
+    ///
+    /// 在数组字面量构造时以及内置函数（`PUSH`、`RANGE`、`MAP` 等）返回数组时检查，
+    /// 超出即以执行限制错误终止求值。相比整体内存限制，
+    /// 这可以直接约束 `LEN` 和遍历的最坏开销。
+    pub fn set_max_array_length(&mut self, max: Option<usize>) {
+        self.evaluator.set_max_array_length(max);
+    }
+
+    /// 获取单个数组的最大元素个数
+    pub fn max_array_length(&self) -> Option<usize> {
+        self.evaluator.max_array_length()
+    }
+
+    /// 设置一次求值中 `PRINT/PRINTLN` 输出的最大累计字节数（`None` 表示不限制）
+    ///
+    /// 按实际写入输出目标（stdout、`set_output` 的 writer 或输出捕获）的字节数累计，
+    /// 每次顶层求值重新计数。某次输出会使累计字节数超出上限时，这次输出不会写入，
+    /// 求值以 `Output limit exceeded` 执行限制错误终止。与 [`Aether::set_max_result_size`]
+    /// 限制返回值不同，它限制的是脚本的输出副作用。
+    pub fn set_max_output_bytes(&mut self, max_bytes: Option<usize>) {
+        self.evaluator.set_max_output_bytes(max_bytes);
+    }
+
+    /// 获取一次求值中 `PRINT/PRINTLN` 输出的最大累计字节数
+    pub fn max_output_bytes(&self) -> Option<usize> {
+        self.evaluator.max_output_bytes()
+    }
+
+    /// 设置一次求值中可定义的函数（含生成器）的最大个数（`None` 表示不限制）
+    ///
+    /// 每执行一次 `Func`/`Generator` 定义计数一次，每次顶层求值重新计数；
+    /// 超出上限的定义不会生效，求值以 `Function definition limit exceeded` 执行限制错误终止。
+    /// 通过 [`Aether::load_prelude`] 加载的预置函数不计入。
+    pub fn set_max_functions(&mut self, max: Option<usize>) {
+        self.evaluator.set_max_functions(max);
+    }
+
+    /// 获取一次求值中可定义的函数的最大个数
+    pub fn max_functions(&self) -> Option<usize> {
+        self.evaluator.max_functions()
+    }
+
+    /// 设置解析时允许的最大嵌套层数（`None` 表示不限制）
+    ///
+    /// 每个 `{}` 代码块以及每对圆括号、数组、字典、函数调用或索引的括号各计一层。
+    /// 嵌套更深的代码在解析阶段即以 `Nesting too deep` 解析错误拒绝，不会因递归
+    /// 过深而耗尽解析器的栈；这与运行时的递归深度限制相互独立。导入的模块同样受此限制。
+    /// 设置后会清空 AST 缓存，以免复用按旧限制解析的代码。
+    pub fn set_max_nesting_depth(&mut self, max: Option<usize>) {
+        self.evaluator.set_max_nesting_depth(max);
+        self.max_nesting_depth = max;
+        self.cache.clear();
+    }
+
+    /// 获取解析时允许的最大嵌套层数
+    pub fn max_nesting_depth(&self) -> Option<usize> {
+        self.max_nesting_depth
+    }
+
+    /// 禁止递归调用（可链式调用）
+    ///
+    /// 开启后，调用一个仍在执行中的用户函数（直接自递归或经由其他函数的间接递归）
+    /// 会以 `Recursion is not allowed` 执行限制错误终止求值。与递归深度限制不同，
+    /// 这在结构上保证调用链是有限的，适合要求必然终止的规则 DSL；循环不受影响。
+    /// `Func` 定义的函数按名称识别，Lambda 按其定义位置和函数体识别。
+    /// 开启时不做尾递归优化，以免尾递归被改写为循环而绕过检查。
+    pub fn with_no_recursion(mut self) -> Self {
+        self.set_no_recursion(true);
+        self
+    }
+
+    /// 开启或关闭禁止递归（见 [`Aether::with_no_recursion`]），并清空 AST 缓存
+    pub fn set_no_recursion(&mut self, enabled: bool) {
+        self.evaluator.set_no_recursion(enabled);
+        self.optimizer.no_recursion = enabled;
+        self.cache.clear();
+    }
+
+    /// 是否禁止递归调用
+    pub fn no_recursion(&self) -> bool {
+        self.evaluator.no_recursion()
+    }
+
+    /// 设置资源预警回调：用量首次达到某项限制的 `percent`% 时调用，不会中断求值
+    ///
+    /// 回调参数为资源种类（步数、递归深度、执行时长或数组长度）、当前用量和上限。
+    /// 每种资源在一次顶层求值中最多预警一次，且只针对已配置的限制；
+    /// `percent` 会被限制在 1~100 之间。未设置回调时没有额外开销。
+    pub fn set_limit_warning_hook<F: Fn(LimitKind, u64, u64) + 'static>(
+        &mut self,
+        percent: u8,
+        hook: F,
+    ) {
+        self.evaluator
+            .set_limit_warning_hook(percent, Box::new(hook));
+    }
+
+    /// 移除资源预警回调
+    pub fn clear_limit_warning_hook(&mut self) {
+        self.evaluator.clear_limit_warning_hook();
+    }
+
+    /// 设置进度回调：每执行 `every` 步调用一次，参数为本次求值已执行的步数
+    ///
+    /// 步数与步数限制的计数方式相同，每次顶层求值重新计数；`every` 至少为 1。
+    /// 回调在求值线程上同步调用，应尽量轻量。可以在回调中通过
+    /// [`Aether::interrupt_handle`] 获得的句柄发出中断，求值会在下一条语句之前停止，
+    /// 从而实现带“取消”按钮的进度显示。未设置回调时每一步只多一次分支判断。
+    pub fn set_progress_hook<F: Fn(u64) + 'static>(&mut self, every: u64, hook: F) {
+        self.evaluator.set_progress_hook(every, Box::new(hook));
+    }
+
+    /// 移除进度回调
+    pub fn clear_progress_hook(&mut self) {
+        self.evaluator.clear_progress_hook();
+    }
+
+    /// 获取可以从其他线程中断本引擎当前求值的句柄
+    ///
+    /// 被中断的求值在下一条语句之前以 `Evaluation interrupted` 错误结束，
+    /// 引擎之后可以继续正常使用。引擎空闲时发出的中断会被下一次求值忽略。
+    pub fn interrupt_handle(&self) -> InterruptHandle {
+        self.evaluator.interrupt_handle()
+    }
 }
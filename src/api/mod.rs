@@ -1,11 +1,18 @@
+use std::cell::Cell;
+
 use crate::cache::ASTCache;
-use crate::evaluator::Evaluator;
+use crate::evaluator::{ErrorReport, Evaluator};
 use crate::optimizer::Optimizer;
+use crate::parser::Parser;
 
 mod cache;
 mod constructors;
 mod eval;
+mod host;
+mod inspect;
 mod limits;
+mod numeric;
+mod output;
 mod stdlib;
 mod trace;
 
@@ -14,4 +21,52 @@ pub struct Aether {
     pub(crate) evaluator: Evaluator,
     pub(crate) cache: ASTCache,
     pub(crate) optimizer: Optimizer,
+    /// 引擎名称，用于在错误和跟踪中区分不同引擎
+    pub(crate) name: Option<String>,
+    /// 宿主提供的错误格式化函数（见 [`Aether::set_error_formatter`]）
+    pub(crate) error_formatter: Option<ErrorFormatter>,
+    /// 脚本不允许定义或引用的标识符前缀（见 [`Aether::set_deny_list`]）
+    pub(crate) denied_prefixes: Vec<String>,
+    /// 解析时允许的最大嵌套层数（见 [`Aether::set_max_nesting_depth`]）
+    pub(crate) max_nesting_depth: Option<usize>,
+    /// 是否把静态分析警告视为错误（见 [`Aether::with_warnings_as_errors`]）
+    pub(crate) warnings_as_errors: bool,
+    /// 最近一次生成的错误信息属于哪一类（见 [`Aether::last_error_kind`]）
+    pub(crate) last_error_kind: Cell<Option<ErrorKind>>,
+}
+
+/// 错误信息的类别，供 FFI 按类别而不是按错误文本选择错误码
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub(crate) enum ErrorKind {
+    /// 解析错误（包括被视为错误的警告）
+    Parse,
+    /// 脚本没有产生值（[`RuntimeError::NoValue`](crate::evaluator::RuntimeError::NoValue)）
+    NoValue,
+    /// 其他运行时错误
+    Runtime,
+}
+
+/// 将结构化错误报告格式化为错误字符串的函数
+pub(crate) type ErrorFormatter = Box<dyn Fn(&ErrorReport) -> String>;
+
+impl Aether {
+    /// 创建应用本引擎解析选项（禁止的标识符前缀、最大嵌套层数）的解析器
+    pub(crate) fn parser(&self, code: &str) -> Parser {
+        Parser::new(code)
+            .with_denied_prefixes(self.denied_prefixes.clone())
+            .with_max_nesting_depth(self.max_nesting_depth)
+    }
+
+    /// 清除之前记录的错误类别，之后通过 [`Aether::last_error_kind`] 读取新的类别
+    pub(crate) fn clear_error_kind(&self) {
+        self.last_error_kind.set(None);
+    }
+
+    /// 上次清除之后最近一次生成的解析或运行时错误信息的类别
+    ///
+    /// 由错误信息的生成处记录，与错误格式化函数和错误文本无关；
+    /// 没有经过这两类错误生成的失败（例如宿主传入的参数无效）为 `None`。
+    pub(crate) fn last_error_kind(&self) -> Option<ErrorKind> {
+        self.last_error_kind.get()
+    }
 }
@@ -0,0 +1,94 @@
+use super::Aether;
+use crate::runtime::{DivByZeroMode, IntOverflowMode, StringCoercion};
+
+impl Aether {
+    // ============================================================
+    // 数值语义
+    // ============================================================
+
+    /// 设置整数 `+`、`-`、`*` 溢出 i64 范围时的行为（默认 `Error`），并清空 AST 缓存
+    ///
+    /// 常量折叠不会绕过该模式：会溢出的字面量运算（如 `(1000000 * 1000000 * 1000000 * 1000)`）
+    /// 留到求值时按模式处理。
+    pub fn set_int_overflow(&mut self, mode: IntOverflowMode) {
+        self.evaluator.set_int_overflow(mode);
+        self.optimizer.int_overflow = mode;
+        self.cache.clear();
+    }
+
+    /// 获取当前整数溢出行为
+    pub fn int_overflow(&self) -> IntOverflowMode {
+        self.evaluator.int_overflow()
+    }
+
+    /// 设置 `+` 在字符串与非字符串之间的行为（默认 `Strict`，报类型错误）
+    pub fn set_string_coercion(&mut self, mode: StringCoercion) {
+        self.evaluator.set_string_coercion(mode);
+    }
+
+    /// 获取当前字符串拼接行为
+    pub fn string_coercion(&self) -> StringCoercion {
+        self.evaluator.string_coercion()
+    }
+
+    /// 设置 `/` 和 `%` 的除数为零时的行为（默认 `Error`，报运行时错误）
+    pub fn set_div_by_zero(&mut self, mode: DivByZeroMode) {
+        self.evaluator.set_div_by_zero(mode);
+    }
+
+    /// 获取当前除零行为
+    pub fn div_by_zero(&self) -> DivByZeroMode {
+        self.evaluator.div_by_zero()
+    }
+
+    /// 让整数相除不尽时得到精确分数（可链式调用）
+    ///
+    /// 开启后 `(1 / 3)` 得到 `Fraction` 值 `1/3`，而不是 `0.333...`，后续与整数或分数的
+    /// `+`、`-`、`*`、`/` 运算保持精确，避免浮点误差累积。能整除的结果（如 `(6 / 3)`）
+    /// 以及有小数参与的除法仍得到普通数字。分数打印为 `分子/分母`，`aether_eval`
+    /// 返回同样的字符串，JSON 中为字符串 `"1/3"`；可用 `TO_FLOAT` 转回浮点数。
+    /// 分数使用堆上的大整数，运算比普通数字慢得多，分母也可能随运算不断增大。
+    pub fn with_rational_division(mut self) -> Self {
+        self.set_rational_division(true);
+        self
+    }
+
+    /// 开启或关闭有理数除法（见 [`Aether::with_rational_division`]），并清空 AST 缓存
+    pub fn set_rational_division(&mut self, enabled: bool) {
+        self.evaluator.set_rational_division(enabled);
+        self.optimizer.rational_division = enabled;
+        self.cache.clear();
+    }
+
+    /// 是否开启了有理数除法
+    pub fn rational_division(&self) -> bool {
+        self.evaluator.rational_division()
+    }
+
+    /// 设置 `RANDOM/RANDOM_INT` 的随机数种子
+    ///
+    /// 种子只影响当前引擎。相同种子下，相同脚本产生相同的随机序列；
+    /// 未设置时引擎以时间为种子。
+    pub fn set_seed(&mut self, seed: u64) {
+        self.evaluator.set_seed(seed);
+    }
+
+    /// 固定 `NOW()` 返回的时间
+    ///
+    /// 设置后 `NOW()` 总是返回 `time`（自 Unix 纪元起的秒数），而不是读取系统时钟，
+    /// 便于测试依赖时间的脚本；与 [`Aether::set_seed`] 一起使用可以得到完全确定的求值结果。
+    pub fn with_clock(mut self, time: std::time::SystemTime) -> Self {
+        self.set_clock(Some(time));
+        self
+    }
+
+    /// 设置 `NOW()` 返回的固定时间（见 [`Aether::with_clock`]），`None` 恢复使用系统时钟
+    pub fn set_clock(&mut self, time: Option<std::time::SystemTime>) {
+        self.evaluator.set_clock(time);
+    }
+
+    /// `NOW()` 当前使用的固定时间，未固定时返回 `None`
+    pub fn clock(&self) -> Option<std::time::SystemTime> {
+        self.evaluator.clock()
+    }
+}
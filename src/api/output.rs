@@ -0,0 +1,173 @@
+use std::io::Write;
+
+use super::Aether;
+use crate::evaluator::ErrorReport;
+use crate::runtime::{JsonValue, NumberLocale, SortedJsonValue};
+use crate::value::Value;
+
+impl Aether {
+    /// 求值代码并同时返回结果和脚本打印的内容
+    ///
+    /// 求值期间 `PRINT/PRINTLN` 的输出会被捕获到内存中（不写 stdout），
+    /// 按行返回。即使求值失败，也会返回失败前已经打印的行，
+    /// 便于宿主展示部分进度。
+    pub fn eval_verbose(&mut self, code: &str) -> (Result<Value, String>, Vec<String>) {
+        self.evaluator.begin_output_capture();
+        let result = self.eval(code);
+        let output = self.evaluator.end_output_capture();
+        (result, output)
+    }
+
+    /// 求值代码并返回结果和脚本打印的最后 `n` 行
+    ///
+    /// 与 [`Aether::eval_verbose`] 相同，但内部只保留最近的 `n` 行（环形缓冲区），
+    /// 更早的行随新行到来被丢弃，适合只需要展示最新进度、而脚本可能打印大量内容的场景。
+    pub fn eval_tail(&mut self, code: &str, n: usize) -> (Result<Value, String>, Vec<String>) {
+        self.evaluator.begin_output_capture_tail(n);
+        let result = self.eval(code);
+        let output = self.evaluator.end_output_capture();
+        (result, output)
+    }
+}
+
+impl Aether {
+    /// 求值代码并将结果以 JSON 形式流式写入 `writer`
+    ///
+    /// 编码格式与 FFI 返回的 JSON 相同（见 [`JsonValue`]；开启 `with_sorted_map_keys`
+    /// 时字典按键排序）。数组按元素逐个编码写出，
+    /// 不会先在内存中构造完整的 JSON 文本，适合直接写入 HTTP 响应等场景。
+    /// 求值失败时返回错误且不写入任何内容；写入失败时返回 `Output error: ...`，
+    /// 此时 writer 中可能已有不完整的 JSON。
+    pub fn eval_json_to<W: Write>(&mut self, code: &str, writer: W) -> Result<(), String> {
+        let value = self.eval(code)?;
+        let mut writer = std::io::BufWriter::new(writer);
+        let written = if self.sorted_map_keys() {
+            serde_json::to_writer(&mut writer, &SortedJsonValue(&value))
+        } else {
+            serde_json::to_writer(&mut writer, &JsonValue(&value))
+        };
+        written.map_err(|e| format!("Output error: {}", e))?;
+        writer.flush().map_err(|e| format!("Output error: {}", e))
+    }
+
+    /// 求值代码并把结果逐个元素交给回调处理
+    ///
+    /// 结果为数组时按顺序以 `(下标, 元素)` 调用 `f`，否则以下标 0 对整个结果调用一次。
+    /// 回调返回 `Err` 时立即停止，不再处理剩余元素，并原样返回该错误；
+    /// 求值失败时返回求值错误且不调用回调。
+    pub fn eval_for_each<F>(&mut self, code: &str, mut f: F) -> Result<(), String>
+    where
+        F: FnMut(usize, &Value) -> Result<(), String>,
+    {
+        match self.eval(code)? {
+            Value::Array(items) => items
+                .iter()
+                .enumerate()
+                .try_for_each(|(index, item)| f(index, item)),
+            value => f(0, &value),
+        }
+    }
+
+    /// 将 `PRINT/PRINTLN` 的输出写入宿主提供的 writer（而不是 stdout）
+    ///
+    /// writer 返回错误时求值立即中止，错误信息以 `Output error: ...` 返回。
+    /// 宿主可以借此实现背压，或在输出超过一定字节数后终止失控的脚本。
+    /// `eval_verbose` 的捕获优先于 writer。
+    pub fn set_output<W: Write + 'static>(&mut self, writer: W) {
+        self.evaluator.set_output_writer(Some(Box::new(writer)));
+    }
+
+    /// 移除宿主 writer，恢复输出到 stdout
+    pub fn clear_output(&mut self) {
+        self.evaluator.set_output_writer(None);
+    }
+
+    /// 禁止脚本产生任何输出：`PRINT/PRINTLN` 以 `Output error` 终止求值，而不是静默丢弃
+    ///
+    /// 可用于证明脚本不产生输出；与默认禁用的 IO 权限结合，可以确认脚本是纯计算。
+    pub fn with_no_output(mut self) -> Self {
+        self.set_no_output(true);
+        self
+    }
+
+    /// 设置是否禁止 `PRINT/PRINTLN` 输出（见 [`Aether::with_no_output`]）
+    pub fn set_no_output(&mut self, enabled: bool) {
+        self.evaluator.set_no_output(enabled);
+    }
+
+    /// 是否禁止 `PRINT/PRINTLN` 输出
+    pub fn no_output(&self) -> bool {
+        self.evaluator.no_output()
+    }
+
+    /// 输出字典时按键排序
+    ///
+    /// 字典底层是哈希表，默认按其迭代顺序输出，每次运行可能不同。开启后
+    /// `PRINT/PRINTLN`、`eval_json_to` 以及 FFI 返回的字符串和 JSON 中的字典
+    /// （包括嵌套的字典）都按键的字节序输出，跨运行、跨平台保持一致，便于测试和比对。
+    pub fn with_sorted_map_keys(mut self) -> Self {
+        self.set_sorted_map_keys(true);
+        self
+    }
+
+    /// 设置输出字典时是否按键排序（见 [`Aether::with_sorted_map_keys`]）
+    pub fn set_sorted_map_keys(&mut self, enabled: bool) {
+        self.evaluator.set_sorted_map_keys(enabled);
+    }
+
+    /// 输出字典时是否按键排序
+    pub fn sorted_map_keys(&self) -> bool {
+        self.evaluator.sorted_map_keys()
+    }
+
+    /// 按区域格式输出数字
+    ///
+    /// `tag` 为 BCP-47 语言标签（如 `en-US`、`de-DE`）。设置后 `PRINT/PRINTLN`
+    /// 以及字符串拼接（`Coerce` 模式）中的数字使用该区域的千位分隔符和小数点：
+    /// `en-US` 输出 `1,234,567.5`，`de-DE` 输出 `1.234.567,5`。
+    /// 求值结果、JSON 和 FFI 返回的数值不受影响。默认不设置区域，数字按 `1234567.5` 输出。
+    /// 不支持的标签返回错误。
+    pub fn with_locale(mut self, tag: &str) -> Result<Self, String> {
+        self.set_locale(Some(tag))?;
+        Ok(self)
+    }
+
+    /// 设置数字的区域格式（见 [`Aether::with_locale`]），`None` 恢复默认格式
+    pub fn set_locale(&mut self, tag: Option<&str>) -> Result<(), String> {
+        let locale = tag.map(NumberLocale::from_tag).transpose()?;
+        self.evaluator.set_locale(locale);
+        Ok(())
+    }
+
+    /// 当前数字区域格式的语言标签
+    pub fn locale(&self) -> Option<&str> {
+        self.evaluator.locale().map(|l| l.tag())
+    }
+
+    /// 设置 `PRINT/PRINTLN` 多个参数之间的分隔符（默认为空格）
+    ///
+    /// 对 stdout、`set_output` 的 writer 以及 `eval_verbose` 的捕获同样生效，
+    /// 例如设置为 `","` 即可直接输出 CSV 行。
+    pub fn set_print_separator(&mut self, separator: &str) {
+        self.evaluator.set_print_separator(separator);
+    }
+
+    /// 设置 `PRINTLN` 在参数之后输出的结束符（默认为 `"\n"`，`PRINT` 不输出结束符）
+    pub fn set_print_terminator(&mut self, terminator: &str) {
+        self.evaluator.set_print_terminator(terminator);
+    }
+
+    /// 自定义 `eval`/`call` 等方法返回的错误字符串
+    ///
+    /// 解析和运行时错误会先构造成结构化的 [`ErrorReport`]（与 `eval_report`
+    /// 相同），再交给 `formatter` 生成错误字符串，宿主可以输出 JSON、纯文本等格式。
+    /// 设置后引擎名称前缀不再自动添加。`eval_report` 不受影响。
+    pub fn set_error_formatter<F: Fn(&ErrorReport) -> String + 'static>(&mut self, formatter: F) {
+        self.error_formatter = Some(Box::new(formatter));
+    }
+
+    /// 移除错误格式化函数，恢复默认的 `Parse error: ...`/`Runtime error: ...` 格式
+    pub fn clear_error_formatter(&mut self) {
+        self.error_formatter = None;
+    }
+}
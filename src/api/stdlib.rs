@@ -14,6 +14,31 @@ impl Aether {
         }
     }
 
+    /// 只启用指定分组的内置函数（可链式调用）
+    ///
+    /// 分组名见 [`crate::builtins::BUILTIN_GROUPS`]，例如 `"math"`、`"string"`、`"array"`；
+    /// 其余内置函数被移除，脚本调用时报 `Undefined variable` 错误。`core`（`HELP` 和类型函数）
+    /// 不会自动保留，需要时请显式列出。包含未知分组名时返回错误。
+    ///
+    /// ```
+    /// use aether::Aether;
+    ///
+    /// let mut engine = Aether::new().with_builtin_groups(&["math"]).unwrap();
+    /// assert!(engine.eval("ABS(-1)").is_ok());
+    /// assert!(engine.eval("LEN([1])").is_err());
+    /// ```
+    pub fn with_builtin_groups(mut self, groups: &[&str]) -> Result<Self, String> {
+        self.set_builtin_groups(groups)?;
+        Ok(self)
+    }
+
+    /// 只保留指定分组的内置函数（见 [`Aether::with_builtin_groups`]）
+    ///
+    /// 已禁用的分组不能再次启用；多次调用时，可用的内置函数为各次指定分组的交集。
+    pub fn set_builtin_groups(&mut self, groups: &[&str]) -> Result<(), String> {
+        self.evaluator.retain_builtin_groups(groups)
+    }
+
     /// 加载所有标准库模块
     pub fn load_all_stdlib(&mut self) -> Result<(), String> {
         stdlib::preload_stdlib(self)
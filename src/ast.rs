@@ -3,8 +3,10 @@
 //!
 //! This module defines the structure of Aether programs as a tree of nodes.
 
+use serde::{Deserialize, Serialize};
+
 /// Binary operators
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum BinOp {
     // Arithmetic
     Add,      // +
@@ -27,14 +29,14 @@ pub enum BinOp {
 }
 
 /// Unary operators
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum UnaryOp {
     Minus, // -
     Not,   // !
 }
 
 /// Expressions - things that evaluate to values
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum Expr {
     // Literals
     Number(f64),
@@ -93,7 +95,7 @@ pub enum Expr {
 }
 
 /// Statements - things that perform actions
-#[derive(Debug, Clone, PartialEq)]
+#[derive(Debug, Clone, PartialEq, Serialize, Deserialize)]
 pub enum Stmt {
     // Variable assignment: Set NAME value
     Set {
@@ -192,6 +194,13 @@ pub enum Stmt {
 /// A complete program is a list of statements
 pub type Program = Vec<Stmt>;
 
+/// Source position of a node (1-based line and column)
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Serialize, Deserialize)]
+pub struct Position {
+    pub line: usize,
+    pub column: usize,
+}
+
 impl Expr {
     /// Helper to create a binary expression
     pub fn binary(left: Expr, op: BinOp, right: Expr) -> Self {
@@ -255,3 +264,28 @@ impl std::fmt::Display for UnaryOp {
         }
     }
 }
+
+impl Stmt {
+    /// Name of the statement variant (e.g. "Set", "FuncDef")
+    pub fn kind_name(&self) -> &'static str {
+        match self {
+            Stmt::Set { .. } => "Set",
+            Stmt::SetIndex { .. } => "SetIndex",
+            Stmt::FuncDef { .. } => "FuncDef",
+            Stmt::GeneratorDef { .. } => "GeneratorDef",
+            Stmt::LazyDef { .. } => "LazyDef",
+            Stmt::Return(_) => "Return",
+            Stmt::Yield(_) => "Yield",
+            Stmt::Break => "Break",
+            Stmt::Continue => "Continue",
+            Stmt::While { .. } => "While",
+            Stmt::For { .. } => "For",
+            Stmt::ForIndexed { .. } => "ForIndexed",
+            Stmt::Switch { .. } => "Switch",
+            Stmt::Import { .. } => "Import",
+            Stmt::Export(_) => "Export",
+            Stmt::Throw(_) => "Throw",
+            Stmt::Expression(_) => "Expression",
+        }
+    }
+}
@@ -0,0 +1,342 @@
+// src/ast_json.rs
+//! JSON serialization of the AST for external tooling
+//!
+//! Every node is a JSON object with a `"kind"` field naming its variant, and
+//! `"line"` and `"column"` (1-based) of the token that starts it. See
+//! `Parser::parse_program_with_expression_positions` for where synthesized
+//! expressions (such as the string in `M.NAME`) are located.
+//!
+//! ```json
+//! {"kind": "Set", "line": 1, "column": 1, "name": "X",
+//!  "value": {"kind": "Number", "value": 1.0, "line": 1, "column": 7}}
+//! ```
+//!
+//! Comments are not part of the tree; `comments_to_json` serializes them
+//! separately as `{"text": ..., "line": ..., "column": ...}`.
+
+use serde_json::{Map, Value as Json, json};
+
+use crate::ast::{BinOp, Expr, Position, Program, Stmt, UnaryOp};
+use crate::lexer::Comment;
+
+/// Serialize a program with its statement and expression positions (as
+/// returned by `Parser::parse_program_with_expression_positions`)
+pub fn program_to_json(
+    program: &Program,
+    statement_positions: &[Position],
+    expression_positions: &[Position],
+) -> Json {
+    let mut positions = Positions {
+        statements: statement_positions.iter(),
+        expressions: expression_positions.iter(),
+    };
+    Json::Array(block(program, &mut positions))
+}
+
+/// Serialize source comments (as returned by `Parser::comments`), in source order
+pub fn comments_to_json(comments: &[Comment]) -> Json {
+    comments
+        .iter()
+        .map(|c| json!({"text": c.text, "line": c.line, "column": c.column}))
+        .collect()
+}
+
+/// Positions not yet assigned, consumed in the pre-order the parser recorded them in
+struct Positions<'a> {
+    statements: std::slice::Iter<'a, Position>,
+    expressions: std::slice::Iter<'a, Position>,
+}
+
+fn block(stmts: &[Stmt], positions: &mut Positions) -> Vec<Json> {
+    stmts.iter().map(|s| stmt(s, positions)).collect()
+}
+
+fn node(kind: &str) -> Map<String, Json> {
+    let mut map = Map::new();
+    map.insert("kind".to_string(), json!(kind));
+    map
+}
+
+fn stmt(stmt: &Stmt, positions: &mut Positions) -> Json {
+    // Take this statement's position before visiting any nested statements
+    let position = positions.statements.next().copied();
+
+    let map = match stmt {
+        Stmt::Set { name, value } => {
+            let mut map = node("Set");
+            map.insert("name".to_string(), json!(name));
+            map.insert("value".to_string(), expr(value, positions));
+            map
+        }
+        Stmt::SetIndex {
+            object,
+            index,
+            value,
+        } => {
+            let mut map = node("SetIndex");
+            map.insert("object".to_string(), expr(object, positions));
+            map.insert("index".to_string(), expr(index, positions));
+            map.insert("value".to_string(), expr(value, positions));
+            map
+        }
+        Stmt::FuncDef { name, params, body } => {
+            let mut map = node("FuncDef");
+            map.insert("name".to_string(), json!(name));
+            map.insert("params".to_string(), json!(params));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+        Stmt::GeneratorDef { name, params, body } => {
+            let mut map = node("GeneratorDef");
+            map.insert("name".to_string(), json!(name));
+            map.insert("params".to_string(), json!(params));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+        Stmt::LazyDef { name, expr: e } => {
+            let mut map = node("LazyDef");
+            map.insert("name".to_string(), json!(name));
+            map.insert("expr".to_string(), expr(e, positions));
+            map
+        }
+        Stmt::Return(e) => {
+            let mut map = node("Return");
+            map.insert("value".to_string(), expr(e, positions));
+            map
+        }
+        Stmt::Yield(e) => {
+            let mut map = node("Yield");
+            map.insert("value".to_string(), expr(e, positions));
+            map
+        }
+        Stmt::Break => node("Break"),
+        Stmt::Continue => node("Continue"),
+        Stmt::While { condition, body } => {
+            let mut map = node("While");
+            map.insert("condition".to_string(), expr(condition, positions));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+        Stmt::For {
+            var,
+            iterable,
+            body,
+        } => {
+            let mut map = node("For");
+            map.insert("var".to_string(), json!(var));
+            map.insert("iterable".to_string(), expr(iterable, positions));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+        Stmt::ForIndexed {
+            index_var,
+            value_var,
+            iterable,
+            body,
+        } => {
+            let mut map = node("ForIndexed");
+            map.insert("index_var".to_string(), json!(index_var));
+            map.insert("value_var".to_string(), json!(value_var));
+            map.insert("iterable".to_string(), expr(iterable, positions));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+        Stmt::Switch {
+            expr: e,
+            cases,
+            default,
+        } => {
+            let mut map = node("Switch");
+            map.insert("expr".to_string(), expr(e, positions));
+            let cases = cases
+                .iter()
+                .map(|(value, body)| {
+                    json!({
+                        "value": expr(value, positions),
+                        "body": block(body, positions),
+                    })
+                })
+                .collect();
+            map.insert("cases".to_string(), Json::Array(cases));
+            map.insert(
+                "default".to_string(),
+                default
+                    .as_ref()
+                    .map_or(Json::Null, |body| Json::Array(block(body, positions))),
+            );
+            map
+        }
+        Stmt::Import {
+            names,
+            path,
+            aliases,
+            namespace,
+        } => {
+            let mut map = node("Import");
+            map.insert("names".to_string(), json!(names));
+            map.insert("path".to_string(), json!(path));
+            map.insert("aliases".to_string(), json!(aliases));
+            map.insert("namespace".to_string(), json!(namespace));
+            map
+        }
+        Stmt::Export(name) => {
+            let mut map = node("Export");
+            map.insert("name".to_string(), json!(name));
+            map
+        }
+        Stmt::Throw(e) => {
+            let mut map = node("Throw");
+            map.insert("value".to_string(), expr(e, positions));
+            map
+        }
+        Stmt::Expression(e) => {
+            let mut map = node("Expression");
+            map.insert("expr".to_string(), expr(e, positions));
+            map
+        }
+    };
+
+    with_position(map, position)
+}
+
+fn with_position(mut map: Map<String, Json>, position: Option<Position>) -> Json {
+    if let Some(position) = position {
+        map.insert("line".to_string(), json!(position.line));
+        map.insert("column".to_string(), json!(position.column));
+    }
+    Json::Object(map)
+}
+
+fn expr(expr_node: &Expr, positions: &mut Positions) -> Json {
+    // Take this expression's position before visiting its operands
+    let position = positions.expressions.next().copied();
+
+    let map = match expr_node {
+        Expr::Number(n) => {
+            let mut map = node("Number");
+            map.insert("value".to_string(), json!(n));
+            map
+        }
+        Expr::BigInteger(digits) => {
+            let mut map = node("BigInteger");
+            map.insert("value".to_string(), json!(digits));
+            map
+        }
+        Expr::String(s) => {
+            let mut map = node("String");
+            map.insert("value".to_string(), json!(s));
+            map
+        }
+        Expr::Boolean(b) => {
+            let mut map = node("Boolean");
+            map.insert("value".to_string(), json!(b));
+            map
+        }
+        Expr::Null => node("Null"),
+        Expr::Identifier(name) => {
+            let mut map = node("Identifier");
+            map.insert("name".to_string(), json!(name));
+            map
+        }
+        Expr::Binary { left, op, right } => {
+            let mut map = node("Binary");
+            map.insert("op".to_string(), json!(bin_op_name(op)));
+            map.insert("left".to_string(), expr(left, positions));
+            map.insert("right".to_string(), expr(right, positions));
+            map
+        }
+        Expr::Unary { op, expr: e } => {
+            let mut map = node("Unary");
+            let op = match op {
+                UnaryOp::Minus => "Minus",
+                UnaryOp::Not => "Not",
+            };
+            map.insert("op".to_string(), json!(op));
+            map.insert("expr".to_string(), expr(e, positions));
+            map
+        }
+        Expr::Call { func, args } => {
+            let mut map = node("Call");
+            map.insert("func".to_string(), expr(func, positions));
+            let args = args.iter().map(|a| expr(a, positions)).collect();
+            map.insert("args".to_string(), Json::Array(args));
+            map
+        }
+        Expr::Array(items) => {
+            let mut map = node("Array");
+            let items = items.iter().map(|i| expr(i, positions)).collect();
+            map.insert("items".to_string(), Json::Array(items));
+            map
+        }
+        Expr::Dict(entries) => {
+            let mut map = node("Dict");
+            let entries = entries
+                .iter()
+                .map(|(key, value)| json!({"key": key, "value": expr(value, positions)}))
+                .collect();
+            map.insert("entries".to_string(), Json::Array(entries));
+            map
+        }
+        Expr::Index { object, index } => {
+            let mut map = node("Index");
+            map.insert("object".to_string(), expr(object, positions));
+            map.insert("index".to_string(), expr(index, positions));
+            map
+        }
+        Expr::If {
+            condition,
+            then_branch,
+            elif_branches,
+            else_branch,
+        } => {
+            let mut map = node("If");
+            map.insert("condition".to_string(), expr(condition, positions));
+            map.insert(
+                "then".to_string(),
+                Json::Array(block(then_branch, positions)),
+            );
+            let elifs = elif_branches
+                .iter()
+                .map(|(cond, body)| {
+                    json!({
+                        "condition": expr(cond, positions),
+                        "body": block(body, positions),
+                    })
+                })
+                .collect();
+            map.insert("elif".to_string(), Json::Array(elifs));
+            map.insert(
+                "else".to_string(),
+                else_branch
+                    .as_ref()
+                    .map_or(Json::Null, |body| Json::Array(block(body, positions))),
+            );
+            map
+        }
+        Expr::Lambda { params, body } => {
+            let mut map = node("Lambda");
+            map.insert("params".to_string(), json!(params));
+            map.insert("body".to_string(), Json::Array(block(body, positions)));
+            map
+        }
+    };
+    with_position(map, position)
+}
+
+fn bin_op_name(op: &BinOp) -> &'static str {
+    match op {
+        BinOp::Add => "Add",
+        BinOp::Subtract => "Subtract",
+        BinOp::Multiply => "Multiply",
+        BinOp::Divide => "Divide",
+        BinOp::Modulo => "Modulo",
+        BinOp::Equal => "Equal",
+        BinOp::NotEqual => "NotEqual",
+        BinOp::Less => "Less",
+        BinOp::LessEqual => "LessEqual",
+        BinOp::Greater => "Greater",
+        BinOp::GreaterEqual => "GreaterEqual",
+        BinOp::And => "And",
+        BinOp::Or => "Or",
+    }
+}
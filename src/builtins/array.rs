@@ -190,6 +190,76 @@ pub fn pop(args: &[Value]) -> Result<Value, RuntimeError> {
     }
 }
 
+/// 获取数组的第一个元素
+///
+/// # 功能
+/// 返回数组的第一个元素，不修改数组。
+///
+/// # 参数
+/// - `array`: Array - 目标数组
+///
+/// # 返回值
+/// 数组的第一个元素
+///
+/// # 错误
+/// - 空数组时抛出错误（不会返回 Null，以免与值为 Null 的元素混淆）
+///
+/// # 示例
+/// ```aether
+/// Set arr [10, 20, 30]
+/// Set head FIRST(arr)          # 10
+/// ```
+pub fn first(args: &[Value]) -> Result<Value, RuntimeError> {
+    end_element(args, "FIRST", |arr| arr.first())
+}
+
+/// 获取数组的最后一个元素
+///
+/// # 功能
+/// 返回数组的最后一个元素，不修改数组。
+///
+/// # 参数
+/// - `array`: Array - 目标数组
+///
+/// # 返回值
+/// 数组的最后一个元素
+///
+/// # 错误
+/// - 空数组时抛出错误（不会返回 Null，以免与值为 Null 的元素混淆）
+///
+/// # 示例
+/// ```aether
+/// Set arr [10, 20, 30]
+/// Set tail LAST(arr)           # 30
+/// ```
+pub fn last(args: &[Value]) -> Result<Value, RuntimeError> {
+    end_element(args, "LAST", |arr| arr.last())
+}
+
+/// FIRST/LAST 的公共实现
+fn end_element(
+    args: &[Value],
+    name: &str,
+    pick: impl Fn(&[Value]) -> Option<&Value>,
+) -> Result<Value, RuntimeError> {
+    if args.len() != 1 {
+        return Err(RuntimeError::WrongArity {
+            expected: 1,
+            got: args.len(),
+        });
+    }
+
+    match &args[0] {
+        Value::Array(arr) => pick(arr)
+            .cloned()
+            .ok_or_else(|| RuntimeError::InvalidOperation(format!("{} of empty array", name))),
+        _ => Err(RuntimeError::TypeErrorDetailed {
+            expected: "Array".to_string(),
+            got: format!("{:?}", args[0]),
+        }),
+    }
+}
+
 /// 将数组元素连接成字符串
 ///
 /// # 功能
@@ -310,7 +380,7 @@ pub fn sort(args: &[Value]) -> Result<Value, RuntimeError> {
                     }
                 }
             }
-            numbers.sort_by(|a, b| a.partial_cmp(b).unwrap());
+            numbers.sort_by(f64::total_cmp);
             Ok(Value::Array(
                 numbers.into_iter().map(Value::Number).collect(),
             ))
@@ -500,6 +570,95 @@ pub fn min(args: &[Value]) -> Result<Value, RuntimeError> {
     }
 }
 
+/// 统计嵌套数组中的元素总数
+///
+/// # 功能
+/// 递归展开所有层级的子数组，统计非数组元素的个数。
+/// 与 `LEN` 不同，`LEN` 只返回最外层的长度。
+///
+/// # 参数
+/// - `array`: Array - 输入数组（可以任意嵌套）
+///
+/// # 返回值
+/// Number - 所有层级中非数组元素的总数
+///
+/// # 示例
+/// ```aether
+/// Set n DEEP_LEN([[1, 2], [3]])        # 3
+/// Set n DEEP_LEN([1, [2, [3, 4]], []]) # 4
+/// ```
+pub fn deep_len(args: &[Value]) -> Result<Value, RuntimeError> {
+    if args.len() != 1 {
+        return Err(RuntimeError::WrongArity {
+            expected: 1,
+            got: args.len(),
+        });
+    }
+
+    fn count(arr: &[Value]) -> usize {
+        arr.iter()
+            .map(|v| match v {
+                Value::Array(inner) => count(inner),
+                _ => 1,
+            })
+            .sum()
+    }
+
+    match &args[0] {
+        Value::Array(arr) => Ok(Value::Number(count(arr) as f64)),
+        _ => Err(RuntimeError::TypeErrorDetailed {
+            expected: "Array".to_string(),
+            got: format!("{:?}", args[0]),
+        }),
+    }
+}
+
+/// 获取数组的嵌套深度
+///
+/// # 功能
+/// 返回数组的最大嵌套层数。扁平数组（包括空数组）的深度为 1，
+/// 每多一层子数组深度加 1。
+///
+/// # 参数
+/// - `array`: Array - 输入数组
+///
+/// # 返回值
+/// Number - 最大嵌套深度
+///
+/// # 示例
+/// ```aether
+/// Set d DEPTH([1, 2, 3])           # 1
+/// Set d DEPTH([[1, 2], [3]])       # 2
+/// Set d DEPTH([1, [2, [3]]])       # 3
+/// ```
+pub fn depth(args: &[Value]) -> Result<Value, RuntimeError> {
+    if args.len() != 1 {
+        return Err(RuntimeError::WrongArity {
+            expected: 1,
+            got: args.len(),
+        });
+    }
+
+    fn measure(arr: &[Value]) -> usize {
+        1 + arr
+            .iter()
+            .map(|v| match v {
+                Value::Array(inner) => measure(inner),
+                _ => 0,
+            })
+            .max()
+            .unwrap_or(0)
+    }
+
+    match &args[0] {
+        Value::Array(arr) => Ok(Value::Number(measure(arr) as f64)),
+        _ => Err(RuntimeError::TypeErrorDetailed {
+            expected: "Array".to_string(),
+            got: format!("{:?}", args[0]),
+        }),
+    }
+}
+
 /// Map 函数
 ///
 /// # 功能
@@ -168,6 +168,48 @@ pub fn init_docs() -> HashMap<String, FunctionDocData> {
         },
     );
 
+    // 随机数函数
+    docs.insert(
+        "RANDOM".to_string(),
+        FunctionDocData {
+            name: "RANDOM".to_string(),
+            description:
+                "返回 [0, 1) 区间内的随机数（使用引擎自己的随机数生成器，可由宿主设置种子）"
+                    .to_string(),
+            params: vec![],
+            returns: "随机数".to_string(),
+            example: Some("RANDOM()  => 0.7316...".to_string()),
+        },
+    );
+
+    docs.insert(
+        "RANDOM_INT".to_string(),
+        FunctionDocData {
+            name: "RANDOM_INT".to_string(),
+            description: "返回 [min, max] 闭区间内的随机整数".to_string(),
+            params: vec![
+                ("min".to_string(), "最小值（整数）".to_string()),
+                ("max".to_string(), "最大值（整数，包含）".to_string()),
+            ],
+            returns: "随机整数".to_string(),
+            example: Some("RANDOM_INT(1, 6)  => 4".to_string()),
+        },
+    );
+
+    // 时间函数
+    docs.insert(
+        "NOW".to_string(),
+        FunctionDocData {
+            name: "NOW".to_string(),
+            description:
+                "返回当前时间，即自 Unix 纪元（UTC）起的秒数（宿主可以固定时钟，便于测试）"
+                    .to_string(),
+            params: vec![],
+            returns: "秒数（带小数部分）".to_string(),
+            example: Some("NOW()  => 1760572800.123".to_string()),
+        },
+    );
+
     // I/O 函数
     docs.insert(
         "PRINT".to_string(),
@@ -264,6 +306,28 @@ pub fn init_docs() -> HashMap<String, FunctionDocData> {
         },
     );
 
+    docs.insert(
+        "FIRST".to_string(),
+        FunctionDocData {
+            name: "FIRST".to_string(),
+            description: "返回数组第一个元素，空数组时报错".to_string(),
+            params: vec![("array".to_string(), "目标数组".to_string())],
+            returns: "第一个元素".to_string(),
+            example: Some("FIRST([1,2,3])  => 1".to_string()),
+        },
+    );
+
+    docs.insert(
+        "LAST".to_string(),
+        FunctionDocData {
+            name: "LAST".to_string(),
+            description: "返回数组最后一个元素，空数组时报错".to_string(),
+            params: vec![("array".to_string(), "目标数组".to_string())],
+            returns: "最后一个元素".to_string(),
+            example: Some("LAST([1,2,3])  => 3".to_string()),
+        },
+    );
+
     docs.insert(
         "REVERSE".to_string(),
         FunctionDocData {
@@ -279,10 +343,20 @@ pub fn init_docs() -> HashMap<String, FunctionDocData> {
         "SORT".to_string(),
         FunctionDocData {
             name: "SORT".to_string(),
-            description: "对数组进行排序".to_string(),
-            params: vec![("array".to_string(), "要排序的数组".to_string())],
-            returns: "排序后的数组".to_string(),
-            example: Some("SORT([3,1,2])  => [1,2,3]".to_string()),
+            description: "对数组进行排序；不传比较函数时按数字升序排序".to_string(),
+            params: vec![
+                ("array".to_string(), "要排序的数组".to_string()),
+                (
+                    "compare".to_string(),
+                    "可选，比较函数或其名称（可以是宿主函数），接收两个元素，返回负数、0 或正数"
+                        .to_string(),
+                ),
+            ],
+            returns: "排序后的数组（稳定排序）".to_string(),
+            example: Some(
+                "SORT([3,1,2])  => [1,2,3]\nSORT([1,3,2], Lambda (A, B) -> B - A)  => [3,2,1]"
+                    .to_string(),
+            ),
         },
     );
 
@@ -319,6 +393,28 @@ pub fn init_docs() -> HashMap<String, FunctionDocData> {
         },
     );
 
+    docs.insert(
+        "DEEP_LEN".to_string(),
+        FunctionDocData {
+            name: "DEEP_LEN".to_string(),
+            description: "统计嵌套数组中所有非数组元素的总数".to_string(),
+            params: vec![("array".to_string(), "可嵌套的数组".to_string())],
+            returns: "元素总数".to_string(),
+            example: Some("DEEP_LEN([[1,2],[3]])  => 3".to_string()),
+        },
+    );
+
+    docs.insert(
+        "DEPTH".to_string(),
+        FunctionDocData {
+            name: "DEPTH".to_string(),
+            description: "获取数组的最大嵌套深度".to_string(),
+            params: vec![("array".to_string(), "可嵌套的数组".to_string())],
+            returns: "嵌套深度（扁平数组为 1）".to_string(),
+            example: Some("DEPTH([[1,2],[3]])  => 2".to_string()),
+        },
+    );
+
     // 字符串函数
     docs.insert(
         "SPLIT".to_string(),
@@ -612,7 +708,8 @@ pub fn help(args: &[Value]) -> Result<Value, RuntimeError> {
             (
                 "数组操作",
                 vec![
-                    "RANGE", "LEN", "PUSH", "POP", "REVERSE", "SORT", "SUM", "MAX", "MIN",
+                    "RANGE", "LEN", "PUSH", "POP", "FIRST", "LAST", "REVERSE", "SORT", "SUM",
+                    "MAX", "MIN", "DEEP_LEN", "DEPTH",
                 ],
             ),
             (
@@ -634,6 +731,8 @@ pub fn help(args: &[Value]) -> Result<Value, RuntimeError> {
                 "数学函数 - 基础",
                 vec!["ABS", "SQRT", "POW", "FLOOR", "CEIL", "ROUND"],
             ),
+            ("随机数", vec!["RANDOM", "RANDOM_INT"]),
+            ("时间", vec!["NOW"]),
             (
                 "数学函数 - 三角",
                 vec!["SIN", "COS", "TAN", "ASIN", "ACOS", "ATAN", "ATAN2"],
@@ -1441,7 +1441,7 @@ pub fn median(args: &[Value]) -> Result<Value, RuntimeError> {
                 }
             }
 
-            numbers.sort_by(|a, b| a.partial_cmp(b).unwrap());
+            numbers.sort_by(f64::total_cmp);
             let mid = numbers.len() / 2;
 
             let result = if numbers.len().is_multiple_of(2) {
@@ -1632,7 +1632,7 @@ pub fn quantile(args: &[Value]) -> Result<Value, RuntimeError> {
                 }
             }
 
-            numbers.sort_by(|a, b| a.partial_cmp(b).unwrap());
+            numbers.sort_by(f64::total_cmp);
 
             let index = q * (numbers.len() - 1) as f64;
             let lower = index.floor() as usize;
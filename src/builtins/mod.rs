@@ -16,8 +16,10 @@ pub mod math;
 pub mod network;
 pub mod payroll;
 pub mod precise;
+pub mod random;
 pub mod report;
 pub mod string;
+pub mod time;
 pub mod trace;
 pub mod types;
 
@@ -39,8 +41,46 @@ pub struct FunctionDoc {
     pub example: Option<String>,
 }
 
+/// 需要文件系统权限的内置函数
+pub const FILESYSTEM_FUNCTIONS: &[&str] = &[
+    "READ_FILE",
+    "WRITE_FILE",
+    "APPEND_FILE",
+    "DELETE_FILE",
+    "FILE_EXISTS",
+    "LIST_DIR",
+    "CREATE_DIR",
+];
+
+/// 需要网络权限的内置函数
+pub const NETWORK_FUNCTIONS: &[&str] = &["HTTP_GET", "HTTP_POST", "HTTP_PUT", "HTTP_DELETE"];
+
+/// 内置函数分组，用于按需启用部分内置函数（见 [`BuiltInRegistry::retain_groups`]）
+///
+/// `core` 包含 `HELP` 和类型函数（`TYPE`、`TO_STRING` 等），其余分组与函数的用途对应；
+/// `filesystem` 和 `network` 仍然需要相应的 IO 权限才会注册。
+pub const BUILTIN_GROUPS: &[&str] = &[
+    "core",
+    "io",
+    "trace",
+    "array",
+    "dict",
+    "string",
+    "math",
+    "random",
+    "time",
+    "precise",
+    "json",
+    "payroll",
+    "filesystem",
+    "network",
+];
+
+/// 有副作用的内置函数分组：输出、读取输入、写入跟踪记录、推进随机数状态或进行 IO
+pub const SIDE_EFFECT_GROUPS: &[&str] = &["io", "trace", "random", "filesystem", "network"];
+
 /// IO 权限配置
-#[derive(Debug, Clone, Default)]
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
 pub struct IOPermissions {
     /// 是否允许文件系统操作
     pub filesystem_enabled: bool,
@@ -61,13 +101,19 @@ impl IOPermissions {
     pub fn deny_all() -> Self {
         Self::default()
     }
+
+    /// 是否启用了任意一项 IO 权限
+    pub fn any_enabled(&self) -> bool {
+        self.filesystem_enabled || self.network_enabled
+    }
 }
 
 /// Registry of all built-in functions
 pub struct BuiltInRegistry {
     functions: HashMap<String, (BuiltInFn, usize)>, // (function, arity)
     docs: HashMap<String, FunctionDoc>,             // 函数文档
-    #[allow(dead_code)]
+    groups: HashMap<String, &'static str>,          // 函数所属分组
+    group: &'static str,                            // 注册时的当前分组
     permissions: IOPermissions,
 }
 
@@ -82,6 +128,8 @@ impl BuiltInRegistry {
         let mut registry = Self {
             functions: HashMap::new(),
             docs: HashMap::new(),
+            groups: HashMap::new(),
+            group: "core",
             permissions: permissions.clone(),
         };
 
@@ -89,11 +137,13 @@ impl BuiltInRegistry {
         registry.register("HELP", help::help, 0); // Variadic: 0-1 args
 
         // IO functions
+        registry.group = "io";
         registry.register("PRINT", io::print, 1);
         registry.register("PRINTLN", io::println, 1);
         registry.register("INPUT", io::input, 1);
 
         // Trace (DSL-safe debug buffer; handled by evaluator)
+        registry.group = "trace";
         registry.register("TRACE", trace::trace, 1);
         registry.register("TRACE_DEBUG", trace::trace_debug, 2); // (category, value, ...)
         registry.register("TRACE_INFO", trace::trace_info, 2); // (category, value, ...)
@@ -101,10 +151,13 @@ impl BuiltInRegistry {
         registry.register("TRACE_ERROR", trace::trace_error, 2); // (category, value, ...)
 
         // Array functions
+        registry.group = "array";
         registry.register("RANGE", array::range, 1); // Variadic: 1-3 args
         registry.register("LEN", types::len, 1);
         registry.register("PUSH", array::push, 2);
         registry.register("POP", array::pop, 1);
+        registry.register("FIRST", array::first, 1);
+        registry.register("LAST", array::last, 1);
         registry.register("MAP", array::map, 2);
         registry.register("FILTER", array::filter, 2);
         registry.register("REDUCE", array::reduce, 3);
@@ -114,14 +167,18 @@ impl BuiltInRegistry {
         registry.register("SUM", array::sum, 1);
         registry.register("MAX", array::max, 1);
         registry.register("MIN", array::min, 1);
+        registry.register("DEEP_LEN", array::deep_len, 1);
+        registry.register("DEPTH", array::depth, 1);
 
         // Dict functions
+        registry.group = "dict";
         registry.register("KEYS", dict::keys, 1);
         registry.register("VALUES", dict::values, 1);
         registry.register("HAS", dict::has, 2);
         registry.register("MERGE", dict::merge, 2);
 
         // String functions
+        registry.group = "string";
         registry.register("SPLIT", string::split, 2);
         registry.register("UPPER", string::upper, 1);
         registry.register("LOWER", string::lower, 1);
@@ -137,6 +194,7 @@ impl BuiltInRegistry {
         registry.register("CHARAT", string::char_at, 2);
 
         // Math functions - Basic
+        registry.group = "math";
         registry.register("ABS", math::abs, 1);
         registry.register("FLOOR", math::floor, 1);
         registry.register("CEIL", math::ceil, 1);
@@ -144,7 +202,17 @@ impl BuiltInRegistry {
         registry.register("SQRT", math::sqrt, 1);
         registry.register("POW", math::pow, 2);
 
+        // Random numbers (per-engine RNG; handled by evaluator)
+        registry.group = "random";
+        registry.register("RANDOM", random::random, 0);
+        registry.register("RANDOM_INT", random::random_int, 2);
+
+        // Time (per-engine clock; handled by evaluator)
+        registry.group = "time";
+        registry.register("NOW", time::now, 0);
+
         // Math functions - Trigonometry
+        registry.group = "math";
         registry.register("SIN", math::sin, 1);
         registry.register("COS", math::cos, 1);
         registry.register("TAN", math::tan, 1);
@@ -216,6 +284,7 @@ impl BuiltInRegistry {
         registry.register("SET_PRECISION", math::set_precision, 2);
 
         // Precise (Fraction) arithmetic functions
+        registry.group = "precise";
         registry.register("TO_FRACTION", precise::to_fraction, 1);
         registry.register("TO_FLOAT", precise::to_float, 1);
         registry.register("SIMPLIFY", precise::simplify, 1);
@@ -229,16 +298,19 @@ impl BuiltInRegistry {
         registry.register("LCM", precise::lcm, 2);
 
         // Type functions
+        registry.group = "core";
         registry.register("TYPE", types::type_of, 1);
         registry.register("TO_STRING", types::to_string, 1);
         registry.register("TO_NUMBER", types::to_number, 1);
         registry.register("CLONE", types::clone, 1);
 
         // JSON functions
+        registry.group = "json";
         registry.register("JSON_PARSE", json::json_parse, 1);
         registry.register("JSON_STRINGIFY", json::json_stringify, 1); // Variadic: 1-2 args
 
         // Payroll functions - Basic salary calculations (7个)
+        registry.group = "payroll";
         registry.register("CALC_HOURLY_PAY", payroll::basic::calc_hourly_pay, 2);
         registry.register("CALC_DAILY_PAY", payroll::basic::calc_daily_pay, 2);
         registry.register(
@@ -545,6 +617,7 @@ impl BuiltInRegistry {
         );
 
         // Filesystem functions (根据权限注册)
+        registry.group = "filesystem";
         if permissions.filesystem_enabled {
             registry.register("READ_FILE", filesystem::read_file, 1);
             registry.register("WRITE_FILE", filesystem::write_file, 2);
@@ -556,6 +629,7 @@ impl BuiltInRegistry {
         }
 
         // Network functions (根据权限注册)
+        registry.group = "network";
         if permissions.network_enabled {
             registry.register("HTTP_GET", network::http_get, 1);
             registry.register("HTTP_POST", network::http_post, 2); // Variadic: 2-3 args
@@ -566,9 +640,33 @@ impl BuiltInRegistry {
         registry
     }
 
-    /// Register a built-in function
+    /// Register a built-in function in the current group
     fn register(&mut self, name: &str, func: BuiltInFn, arity: usize) {
         self.functions.insert(name.to_string(), (func, arity));
+        self.groups.insert(name.to_string(), self.group);
+    }
+
+    /// 只保留指定分组中的内置函数，移除其余函数
+    ///
+    /// 分组名见 [`BUILTIN_GROUPS`]；包含未知分组名时返回错误，且不做任何修改。
+    pub fn retain_groups(&mut self, groups: &[&str]) -> Result<(), String> {
+        if let Some(unknown) = groups.iter().find(|g| !BUILTIN_GROUPS.contains(g)) {
+            return Err(format!(
+                "Unknown builtin group: '{}' (available: {})",
+                unknown,
+                BUILTIN_GROUPS.join(", ")
+            ));
+        }
+        let groups_of = &self.groups;
+        self.functions
+            .retain(|name, _| groups_of.get(name).is_some_and(|g| groups.contains(g)));
+        self.groups.retain(|_, g| groups.contains(&&**g));
+        Ok(())
+    }
+
+    /// 获取内置函数所属的分组
+    pub fn group_of(&self, name: &str) -> Option<&'static str> {
+        self.groups.get(name).copied()
     }
 
     /// 注册带文档的函数
@@ -593,6 +691,11 @@ impl BuiltInRegistry {
         self.functions.keys().cloned().collect()
     }
 
+    /// 获取创建注册表时使用的 IO 权限
+    pub fn permissions(&self) -> &IOPermissions {
+        &self.permissions
+    }
+
     /// 获取函数文档
     pub fn get_doc(&self, name: &str) -> Option<&FunctionDoc> {
         self.docs.get(name)
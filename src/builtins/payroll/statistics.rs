@@ -56,7 +56,7 @@ pub fn calc_salary_median(args: &[Value]) -> Result<Value, RuntimeError> {
     for arg in args {
         salaries.push(get_number(arg)?);
     }
-    salaries.sort_by(|a, b| a.partial_cmp(b).unwrap());
+    salaries.sort_by(f64::total_cmp);
 
     let len = salaries.len();
     let median = if len.is_multiple_of(2) {
@@ -127,7 +127,7 @@ pub fn calc_percentile(args: &[Value]) -> Result<Value, RuntimeError> {
     for i in 1..args.len() {
         salaries.push(get_number(&args[i])?);
     }
-    salaries.sort_by(|a, b| a.partial_cmp(b).unwrap());
+    salaries.sort_by(f64::total_cmp);
 
     let index = (percentile / 100.0 * (salaries.len() - 1) as f64).round() as usize;
     Ok(Value::Number(salaries[index]))
@@ -0,0 +1,25 @@
+// src/builtins/random.rs
+//
+// 随机数内置函数。
+//
+// 注意：这些函数在 evaluator 中有特殊处理，以便使用引擎自己的随机数生成器
+// （见 `Aether::set_seed`）。
+
+use crate::evaluator::RuntimeError;
+use crate::value::Value;
+
+/// RANDOM - `[0, 1)` 区间内的随机数
+///
+/// 用法: RANDOM()
+pub fn random(_args: &[Value]) -> Result<Value, RuntimeError> {
+    // 在 evaluator 中有特殊处理
+    Ok(Value::Null)
+}
+
+/// RANDOM_INT - `[min, max]` 闭区间内的随机整数
+///
+/// 用法: RANDOM_INT(min, max)
+pub fn random_int(_args: &[Value]) -> Result<Value, RuntimeError> {
+    // 在 evaluator 中有特殊处理
+    Ok(Value::Null)
+}
@@ -0,0 +1,17 @@
+// src/builtins/time.rs
+//
+// 时间内置函数。
+//
+// 注意：这些函数在 evaluator 中有特殊处理，以便使用引擎自己的时钟
+// （见 `Aether::with_clock`）。
+
+use crate::evaluator::RuntimeError;
+use crate::value::Value;
+
+/// NOW - 当前时间，自 Unix 纪元（UTC）起的秒数
+///
+/// 用法: NOW()
+pub fn now(_args: &[Value]) -> Result<Value, RuntimeError> {
+    // 在 evaluator 中有特殊处理
+    Ok(Value::Null)
+}
@@ -1,17 +1,20 @@
 // src/cache.rs
 //! AST缓存机制,减少重复解析
 
-use crate::ast::Program;
+use crate::ast::{Position, Program};
 use serde::{Deserialize, Serialize};
 use std::collections::HashMap;
 use std::collections::hash_map::DefaultHasher;
 use std::hash::{Hash, Hasher};
 
+/// 顶层函数定义的位置: (函数名, 源码位置)
+pub type DefinitionSites = Vec<(String, Position)>;
+
 /// AST缓存,用于存储已解析的程序
 #[derive(Debug)]
 pub struct ASTCache {
-    /// 缓存存储: hash -> 解析后的AST
-    cache: HashMap<u64, Program>,
+    /// 缓存存储: hash -> (解析后的AST, 顶层函数定义位置, 顶层语句位置)
+    cache: HashMap<u64, (Program, DefinitionSites, Vec<Position>)>,
     /// 缓存大小限制
     max_size: usize,
     /// 缓存命中统计
@@ -45,10 +48,27 @@ impl ASTCache {
 
     /// 从缓存中获取AST
     pub fn get(&mut self, code: &str) -> Option<Program> {
+        self.get_with_sites(code).map(|(program, _)| program)
+    }
+
+    /// 从缓存中获取AST及其顶层函数定义位置
+    pub fn get_with_sites(&mut self, code: &str) -> Option<(Program, DefinitionSites)> {
+        self.get_with_positions(code)
+            .map(|(program, sites, _)| (program, sites))
+    }
+
+    /// 从缓存中获取AST、顶层函数定义位置以及每条顶层语句的位置
+    ///
+    /// 语句位置与缓存的（优化后的）AST 的顶层语句一一对应；
+    /// 以 `insert`/`insert_with_sites` 存入的条目没有语句位置，返回空列表。
+    pub fn get_with_positions(
+        &mut self,
+        code: &str,
+    ) -> Option<(Program, DefinitionSites, Vec<Position>)> {
         let hash = Self::hash_code(code);
-        if let Some(program) = self.cache.get(&hash) {
+        if let Some(entry) = self.cache.get(&hash) {
             self.hits += 1;
-            Some(program.clone())
+            Some(entry.clone())
         } else {
             self.misses += 1;
             None
@@ -57,6 +77,22 @@ impl ASTCache {
 
     /// 将AST存入缓存
     pub fn insert(&mut self, code: &str, program: Program) {
+        self.insert_with_sites(code, program, Vec::new());
+    }
+
+    /// 将AST及其顶层函数定义位置存入缓存
+    pub fn insert_with_sites(&mut self, code: &str, program: Program, sites: DefinitionSites) {
+        self.insert_with_positions(code, program, sites, Vec::new());
+    }
+
+    /// 将AST、顶层函数定义位置以及每条顶层语句的位置存入缓存
+    pub fn insert_with_positions(
+        &mut self,
+        code: &str,
+        program: Program,
+        sites: DefinitionSites,
+        positions: Vec<Position>,
+    ) {
         let hash = Self::hash_code(code);
 
         // 如果缓存已满,使用简单的FIFO策略清理
@@ -69,7 +105,7 @@ impl ASTCache {
             }
         }
 
-        self.cache.insert(hash, program);
+        self.cache.insert(hash, (program, sites, positions));
     }
 
     /// 清空缓存
@@ -12,13 +12,29 @@ pub fn run_repl() {
     let mut engine = Aether::with_all_permissions();
     let mut stdlib_loaded = false;
     let mut line_number = 1;
+    // 尚未输入完整的多行代码
+    let mut pending = String::new();
 
     loop {
-        print!("aether[{}]> ", line_number);
+        if pending.is_empty() {
+            print!("aether[{}]> ", line_number);
+        } else {
+            print!("...> ");
+        }
         io::stdout().flush().unwrap();
 
         let mut input = String::new();
         match io::stdin().read_line(&mut input) {
+            Ok(0) => break,
+            Ok(_) if !pending.is_empty() => {
+                pending.push_str(&input);
+                if Aether::is_incomplete(&pending) {
+                    continue;
+                }
+                let code = std::mem::take(&mut pending);
+                eval_and_print(&mut engine, &code);
+                line_number += 1;
+            }
             Ok(_) => {
                 let input = input.trim();
 
@@ -59,22 +75,13 @@ pub fn run_repl() {
                     _ => {}
                 }
 
-                match engine.eval(input) {
-                    Ok(result) => {
-                        if result != aether::Value::Null {
-                            println!("{}", result);
-                        }
-                    }
-                    Err(e) => {
-                        eprintln!("✗ {}", e);
-                        if let Some((line, col)) =
-                            error_context::extract_line_column(&e.to_string())
-                        {
-                            error_context::print_source_context(input, line, col);
-                        }
-                    }
+                // 代码未输入完整（例如 `{` 未闭合）时继续读取下一行
+                if Aether::is_incomplete(input) {
+                    pending = format!("{}\n", input);
+                    continue;
                 }
 
+                eval_and_print(&mut engine, input);
                 line_number += 1;
             }
             Err(e) => {
@@ -85,6 +92,22 @@ pub fn run_repl() {
     }
 }
 
+fn eval_and_print(engine: &mut Aether, input: &str) {
+    match engine.eval(input) {
+        Ok(result) => {
+            if result != aether::Value::Null {
+                println!("{}", result);
+            }
+        }
+        Err(e) => {
+            eprintln!("✗ {}", e);
+            if let Some((line, col)) = error_context::extract_line_column(&e.to_string()) {
+                error_context::print_source_context(input, line, col);
+            }
+        }
+    }
+}
+
 fn print_help() {
     println!("Aether 语言帮助:");
     println!();
@@ -127,6 +150,9 @@ fn print_help() {
     println!("  MIN_HEAP_NEW()           # 创建最小堆");
     println!("  QUICK_SORT(arr)          # 快速排序");
     println!();
+    println!("多行输入:");
+    println!("  括号未闭合或以运算符结尾时自动进入续行模式（提示符为 ...>）");
+    println!();
     println!("REPL 命令:");
     println!("  help                     # 显示此帮助");
     println!("  :load stdlib             # 加载所有标准库");
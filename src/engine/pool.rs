@@ -6,6 +6,7 @@
 //! **注意**：由于 Aether 使用 `Rc`（非线程安全），引擎池是线程局部的。
 //! 每个线程有独立的引擎池，线程间不共享。
 
+use crate::runtime::HostRegistry;
 use crate::{Aether, Value};
 
 /// 线程局部引擎池
@@ -56,6 +57,8 @@ use crate::{Aether, Value};
 pub struct EnginePool {
     engines: Vec<Aether>,
     available: Vec<bool>,
+    registry: Option<HostRegistry>,
+    initial_vars: Vec<(String, Value)>,
 }
 
 impl EnginePool {
@@ -82,7 +85,70 @@ impl EnginePool {
             engines.push(Aether::new());
         }
 
-        Self { engines, available }
+        Self {
+            engines,
+            available,
+            registry: None,
+            initial_vars: Vec::new(),
+        }
+    }
+
+    /// 创建挂载共享宿主函数注册表的引擎池
+    ///
+    /// 池中所有引擎（包括池满时创建的临时引擎）共享同一个注册表，
+    /// 宿主函数只需注册一次。
+    ///
+    /// # 示例
+    ///
+    /// ```rust
+    /// use aether::HostRegistry;
+    /// use aether::engine::EnginePool;
+    /// use aether::Value;
+    ///
+    /// let registry = HostRegistry::new();
+    /// registry.register("ANSWER", 0, |_| Ok(Value::Number(42.0)));
+    ///
+    /// let mut pool = EnginePool::with_registry(4, registry);
+    /// let mut engine = pool.acquire();
+    /// assert_eq!(engine.eval("ANSWER()").unwrap(), Value::Number(42.0));
+    /// ```
+    pub fn with_registry(capacity: usize, registry: HostRegistry) -> Self {
+        let mut pool = Self::new(capacity);
+        for engine in &mut pool.engines {
+            engine.attach_registry(registry.clone());
+        }
+        pool.registry = Some(registry);
+        pool
+    }
+
+    /// 为池中所有引擎（包括池满时创建的临时引擎）预置全局变量
+    ///
+    /// 见 [`Aether::with_initial_vars`]：每个引擎持有独立的副本，
+    /// 每次取出引擎时的环境重置会恢复预置的值。任何一个变量名不合法时返回错误。
+    ///
+    /// # 示例
+    ///
+    /// ```rust
+    /// use aether::engine::EnginePool;
+    /// use aether::Value;
+    ///
+    /// let mut pool = EnginePool::new(2)
+    ///     .with_initial_vars([("RATE", Value::Number(0.2))])
+    ///     .unwrap();
+    /// let mut engine = pool.acquire();
+    /// assert_eq!(engine.eval("(RATE * 10)").unwrap(), Value::Number(2.0));
+    /// ```
+    pub fn with_initial_vars<I, K>(mut self, vars: I) -> Result<Self, String>
+    where
+        I: IntoIterator<Item = (K, Value)>,
+        K: Into<String>,
+    {
+        let vars: Vec<(String, Value)> = vars.into_iter().map(|(k, v)| (k.into(), v)).collect();
+        for engine in &mut self.engines {
+            engine.set_initial_vars(vars.clone())?;
+        }
+        self.initial_vars = vars;
+        Ok(self)
     }
 
     /// 从池中获取引擎（自动归还）
@@ -112,7 +178,14 @@ impl EnginePool {
         }
 
         // 池中无可用引擎，创建临时引擎
-        let engine = Aether::new();
+        let mut engine = Aether::new();
+        if let Some(registry) = &self.registry {
+            engine.attach_registry(registry.clone());
+        }
+        if !self.initial_vars.is_empty() {
+            // 变量名已在 with_initial_vars 中校验
+            let _ = engine.set_initial_vars(self.initial_vars.clone());
+        }
         PooledEngine {
             engine: Some(engine),
             pool_index: None,
@@ -245,6 +318,24 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_pool_shares_registry() {
+        let registry = HostRegistry::new();
+        let mut pool = EnginePool::with_registry(1, registry.clone());
+
+        // 注册表在创建池之后注册的函数同样可见
+        registry.register("TWICE", 1, |args| match args {
+            [Value::Number(n)] => Ok(Value::Number(n * 2.0)),
+            _ => Err("TWICE expects a number".to_string()),
+        });
+
+        let mut first = pool.acquire();
+        // 池已满，第二个是临时引擎
+        let mut second = pool.acquire();
+        assert_eq!(first.eval("TWICE(3)").unwrap(), Value::Number(6.0));
+        assert_eq!(second.eval("TWICE(4)").unwrap(), Value::Number(8.0));
+    }
+
     #[test]
     fn test_pool_multiple_acquire() {
         let mut pool = EnginePool::new(2);
@@ -63,6 +63,9 @@ pub struct Environment {
 
     /// Parent environment (for nested scopes)
     parent: Option<Rc<RefCell<Environment>>>,
+
+    /// Whether a variable in this scope was set since the last `take_modified`
+    modified: bool,
 }
 
 impl Environment {
@@ -71,6 +74,7 @@ impl Environment {
         Environment {
             store: HashMap::with_capacity(16), // 预分配容量减少rehash
             parent: None,
+            modified: false,
         }
     }
 
@@ -79,12 +83,14 @@ impl Environment {
         Environment {
             store: HashMap::with_capacity(8), // 子环境通常变量较少
             parent: Some(parent),
+            modified: false,
         }
     }
 
     /// Set a variable in the current scope
     pub fn set(&mut self, name: String, value: Value) {
         self.store.insert(name, value);
+        self.modified = true;
     }
 
     /// Get a variable from this scope or parent scopes (优化路径)
@@ -114,6 +120,7 @@ impl Environment {
     pub fn update(&mut self, name: &str, value: Value) -> bool {
         if self.store.contains_key(name) {
             self.store.insert(name.to_string(), value);
+            self.modified = true;
             return true;
         }
 
@@ -124,11 +131,42 @@ impl Environment {
         false
     }
 
+    /// Get all variable names visible from this scope (including parent scopes)
+    pub fn visible_keys(&self) -> Vec<String> {
+        let mut keys = self.keys();
+        if let Some(parent) = &self.parent {
+            keys.extend(parent.borrow().visible_keys());
+        }
+        keys
+    }
+
     /// Get all variable names in this scope
     pub fn keys(&self) -> Vec<String> {
         self.store.keys().cloned().collect()
     }
 
+    /// Approximate number of bytes held by the variables in this scope (not parent scopes)
+    pub fn approx_size(&self) -> usize {
+        self.store
+            .iter()
+            .map(|(name, value)| name.capacity() + value.approx_size())
+            .sum()
+    }
+
+    /// Whether a variable in this scope was set since the last call, resetting the flag
+    pub fn take_modified(&mut self) -> bool {
+        std::mem::take(&mut self.modified)
+    }
+
+    /// Remove a variable from this scope (not parent scopes), returning its value
+    pub fn remove(&mut self, name: &str) -> Option<Value> {
+        let removed = self.store.remove(name);
+        if removed.is_some() {
+            self.modified = true;
+        }
+        removed
+    }
+
     /// Clear all variables in this scope (not parent scopes)
     pub fn clear(&mut self) {
         self.store.clear();
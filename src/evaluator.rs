@@ -18,6 +18,53 @@ use std::rc::Rc;
 pub struct CallFrame {
     pub name: String,
     pub signature: String,
+    /// 1-based line of the top-level statement making the call (0 if unknown,
+    /// e.g. for calls made inside another function)
+    pub line: usize,
+    /// 1-based column of the top-level statement making the call (0 if unknown)
+    pub column: usize,
+}
+
+/// A user function that is currently executing, tracked when recursion is forbidden
+enum ActiveFunction {
+    /// `Func` definitions, identified by their defined name
+    Named(String),
+    /// Lambdas, identified by their captured scope, parameters and body
+    Anonymous(Rc<RefCell<Environment>>, Vec<String>, Vec<Stmt>),
+}
+
+impl ActiveFunction {
+    fn of(func: &Value) -> Option<Self> {
+        match func {
+            Value::Function {
+                name: Some(name), ..
+            } => Some(ActiveFunction::Named(name.clone())),
+            Value::Function {
+                name: None,
+                params,
+                body,
+                env,
+            } => Some(ActiveFunction::Anonymous(
+                Rc::clone(env),
+                params.clone(),
+                body.clone(),
+            )),
+            _ => None,
+        }
+    }
+}
+
+impl PartialEq for ActiveFunction {
+    fn eq(&self, other: &Self) -> bool {
+        match (self, other) {
+            (ActiveFunction::Named(a), ActiveFunction::Named(b)) => a == b,
+            (
+                ActiveFunction::Anonymous(env_a, params_a, body_a),
+                ActiveFunction::Anonymous(env_b, params_b, body_b),
+            ) => Rc::ptr_eq(env_a, env_b) && params_a == params_b && body_a == body_b,
+            _ => false,
+        }
+    }
 }
 
 #[derive(Debug, Clone, PartialEq)]
@@ -148,8 +195,11 @@ impl ImportError {
 /// Runtime errors
 #[derive(Debug, Clone, PartialEq)]
 pub enum RuntimeError {
-    /// Variable not found
-    UndefinedVariable(String),
+    /// Variable not found, with the closest visible name if one is similar
+    UndefinedVariable {
+        name: String,
+        suggestion: Option<String>,
+    },
 
     /// Type mismatch - simple message
     TypeError(String),
@@ -163,6 +213,9 @@ pub enum RuntimeError {
     /// Division by zero
     DivisionByZero,
 
+    /// Integer overflow (only raised under `IntOverflowMode::Error`)
+    IntegerOverflow(String),
+
     /// Function not found or not callable
     NotCallable(String),
 
@@ -199,6 +252,18 @@ pub enum RuntimeError {
     /// Custom error message (用于IO操作等)
     CustomError(String),
 
+    /// The host output writer rejected PRINT/PRINTLN output
+    OutputError(String),
+
+    /// A script tried to rebind or modify a host-defined constant
+    ConstantReassignment(String),
+
+    /// The host interrupted the evaluation through an `InterruptHandle`
+    Interrupted,
+
+    /// A typed result was requested but the script produced no value
+    NoValue,
+
     /// Debugger pause (not a real error, used for control flow)
     DebugPause,
 }
@@ -206,13 +271,20 @@ pub enum RuntimeError {
 impl std::fmt::Display for RuntimeError {
     fn fmt(&self, f: &mut std::fmt::Formatter) -> std::fmt::Result {
         match self {
-            RuntimeError::UndefinedVariable(name) => write!(f, "Undefined variable: {}", name),
+            RuntimeError::UndefinedVariable { name, suggestion } => {
+                write!(f, "Undefined variable: {}", name)?;
+                if let Some(suggestion) = suggestion {
+                    write!(f, " (did you mean {}?)", suggestion)?;
+                }
+                Ok(())
+            }
             RuntimeError::TypeError(msg) => write!(f, "Type error: {}", msg),
             RuntimeError::TypeErrorDetailed { expected, got } => {
                 write!(f, "Type error: expected {}, got {}", expected, got)
             }
             RuntimeError::InvalidOperation(msg) => write!(f, "Invalid operation: {}", msg),
             RuntimeError::DivisionByZero => write!(f, "Division by zero"),
+            RuntimeError::IntegerOverflow(expr) => write!(f, "Integer overflow: {}", expr),
             RuntimeError::NotCallable(name) => write!(f, "Not callable: {}", name),
             RuntimeError::WrongArity { expected, got } => {
                 write!(
@@ -285,6 +357,12 @@ impl std::fmt::Display for RuntimeError {
             }
             RuntimeError::CustomError(msg) => write!(f, "{}", msg),
             RuntimeError::ExecutionLimit(e) => write!(f, "{}", e),
+            RuntimeError::OutputError(msg) => write!(f, "Output error: {}", msg),
+            RuntimeError::ConstantReassignment(name) => {
+                write!(f, "Cannot reassign constant '{}'", name)
+            }
+            RuntimeError::Interrupted => write!(f, "Evaluation interrupted"),
+            RuntimeError::NoValue => write!(f, "Script produced no value"),
             RuntimeError::DebugPause => write!(f, "Debugger pause"),
         }
     }
@@ -332,7 +410,14 @@ impl ErrorReport {
         let call_stack = self
             .call_stack
             .iter()
-            .map(|fr| json!({"name": fr.name, "signature": fr.signature}))
+            .map(|fr| {
+                json!({
+                    "name": fr.name,
+                    "signature": fr.signature,
+                    "line": fr.line,
+                    "column": fr.column,
+                })
+            })
             .collect::<Vec<_>>();
 
         json!({
@@ -368,10 +453,11 @@ impl RuntimeError {
 
     fn kind_name(&self) -> String {
         match self {
-            RuntimeError::UndefinedVariable(_) => "UndefinedVariable",
+            RuntimeError::UndefinedVariable { .. } => "UndefinedVariable",
             RuntimeError::TypeError(_) | RuntimeError::TypeErrorDetailed { .. } => "TypeError",
             RuntimeError::InvalidOperation(_) => "InvalidOperation",
             RuntimeError::DivisionByZero => "DivisionByZero",
+            RuntimeError::IntegerOverflow(_) => "IntegerOverflow",
             RuntimeError::NotCallable(_) => "NotCallable",
             RuntimeError::WrongArity { .. } => "WrongArity",
             RuntimeError::Return(_) => "Return",
@@ -392,6 +478,10 @@ impl RuntimeError {
             },
             RuntimeError::WithCallStack { .. } => "WithCallStack",
             RuntimeError::ExecutionLimit(_) => "ExecutionLimit",
+            RuntimeError::OutputError(_) => "OutputError",
+            RuntimeError::ConstantReassignment(_) => "ConstantReassignment",
+            RuntimeError::Interrupted => "Interrupted",
+            RuntimeError::NoValue => "NoValue",
             RuntimeError::CustomError(_) => "CustomError",
             RuntimeError::DebugPause => "DebugPause",
         }
@@ -470,6 +560,8 @@ pub struct Evaluator {
     env: Rc<RefCell<Environment>>,
     /// Built-in function registry
     registry: BuiltInRegistry,
+    /// Host function registries; index 0 is private to this engine, the rest are shared
+    host_registries: Vec<crate::runtime::HostRegistry>,
     /// In-memory trace buffer (for DSL-safe debugging; no stdout/files/network)
     trace: VecDeque<String>,
     /// Monotonic sequence for trace entries (starts at 1)
@@ -478,6 +570,28 @@ pub struct Evaluator {
     trace_entries: VecDeque<crate::runtime::TraceEntry>,
     /// Maximum number of trace entries to keep in buffer
     trace_buffer_size: usize,
+    /// Captured PRINT/PRINTLN output (None = write to stdout)
+    output_capture: Option<crate::runtime::OutputCapture>,
+    /// Host writer for PRINT/PRINTLN output (used when no capture is active)
+    output_writer: Option<Box<dyn std::io::Write>>,
+    /// Whether PRINT/PRINTLN fail instead of producing output
+    no_output: bool,
+    /// Whether PRINT/PRINTLN emit dictionary keys in sorted order
+    sorted_map_keys: bool,
+    /// Locale used to format numbers in PRINT/PRINTLN and string coercion
+    locale: Option<crate::runtime::NumberLocale>,
+    /// Whether the registry was narrowed to a subset of builtin groups
+    builtins_restricted: bool,
+    /// Text between PRINT/PRINTLN arguments
+    print_separator: String,
+    /// Text PRINTLN appends after its arguments
+    print_terminator: String,
+    /// Per-evaluation data handed to context-aware host functions
+    host_data: Option<crate::runtime::HostData>,
+    /// Per-engine RNG backing RANDOM/RANDOM_INT
+    rng: crate::runtime::SeededRng,
+    /// Fixed time returned by NOW (the real clock when `None`)
+    clock: Option<std::time::SystemTime>,
 
     /// Module resolver (Import/Export). Defaults to disabled for DSL safety.
     module_resolver: Box<dyn ModuleResolver>,
@@ -485,6 +599,8 @@ pub struct Evaluator {
     module_cache: HashMap<String, HashMap<String, Value>>,
     /// Module load stack for cycle detection
     module_stack: Vec<String>,
+    /// Host-registered modules: name -> source, loaded on first reference
+    registered_modules: HashMap<String, String>,
     /// Current module export table stack (only when evaluating an imported module)
     export_stack: Vec<HashMap<String, Value>>,
     /// Optional base directory context for resolving relative imports (e.g. eval_file)
@@ -503,8 +619,76 @@ pub struct Evaluator {
     step_counter: std::cell::Cell<usize>,
     /// Call stack depth counter (for recursion depth limit enforcement)
     call_stack_depth: std::cell::Cell<usize>,
+    /// Deepest call depth reached since the last `reset_eval_stats`
+    peak_call_depth: std::cell::Cell<usize>,
+    /// Longest array seen since the last `reset_eval_stats`
+    peak_array_length: std::cell::Cell<usize>,
+    /// Hook fired before every user-function, builtin and host-function call
+    call_hook: Option<Box<crate::runtime::CallHookFn>>,
+    /// Hook fired when usage crosses a percentage of a limit, with that percentage
+    limit_warning: Option<(u8, Box<crate::runtime::LimitWarningFn>)>,
+    /// Limit kinds already warned about in this evaluation (bit per `LimitKind`)
+    limit_warnings_sent: std::cell::Cell<u8>,
+    /// Hook fired every N steps with the step count so far, with N
+    progress_hook: Option<(u64, Box<crate::runtime::ProgressFn>)>,
     /// Execution start time (for timeout enforcement)
     start_time: std::cell::Cell<Option<std::time::Instant>>,
+    /// Integer overflow behavior for `+`, `-`, `*`
+    int_overflow: crate::runtime::IntOverflowMode,
+    /// Behavior of `+` between a string and a non-string
+    string_coercion: crate::runtime::StringCoercion,
+    /// Behavior of `/` and `%` when the divisor is zero
+    div_by_zero: crate::runtime::DivByZeroMode,
+    /// Whether `/` between integers that do not divide evenly yields an exact Fraction
+    rational_division: bool,
+    /// Whether calling a user function that is already running is an error
+    no_recursion: bool,
+    /// User functions currently executing (only tracked while `no_recursion` is set)
+    active_functions: Vec<ActiveFunction>,
+    /// Identifier prefixes module code may not use (the engine's deny list)
+    denied_prefixes: Vec<String>,
+    /// Deepest block/bracket nesting allowed in module code
+    max_nesting_depth: Option<usize>,
+    /// Host file system used by the file builtins instead of the real one
+    file_system: Option<Box<dyn crate::runtime::FileSystem>>,
+    /// How the last `eval_program` produced its result
+    last_result_kind: crate::runtime::ResultKind,
+    /// Whether the last `eval_program` set or defined anything in its scope
+    last_side_effects: bool,
+    /// Host functions invoked since the last `clear_side_effects`, in first-call order
+    called_hosts: Vec<String>,
+    /// Top-level statement that produced the last program result
+    last_result_index: Option<usize>,
+    /// Maximum size of a top-level result in bytes (None = unlimited)
+    max_result_bytes: Option<usize>,
+    /// Maximum number of elements in a single array (None = unlimited)
+    max_array_length: Option<usize>,
+    /// Maximum PRINT/PRINTLN output per top-level evaluation in bytes (None = unlimited)
+    max_output_bytes: Option<usize>,
+    /// PRINT/PRINTLN bytes written in the current top-level evaluation
+    output_bytes: usize,
+    /// Maximum number of Func/Generator definitions per top-level evaluation (None = unlimited)
+    max_functions: Option<usize>,
+    /// Func/Generator definitions evaluated in the current top-level evaluation
+    defined_functions: usize,
+    /// Prelude definitions re-applied after every `reset_env`
+    prelude: Vec<Stmt>,
+    /// Host-defined constants; scripts may read but never rebind them.
+    /// Re-bound after every `reset_env`.
+    constants: HashMap<String, Value>,
+    /// Read-only data shared with other engines, resolved after script variables
+    shared_data: HashMap<String, crate::runtime::SharedData>,
+    /// Globals seeded by the host when the engine was built; re-bound after
+    /// every `reset_env`
+    initial_vars: Vec<(String, Value)>,
+    /// Where top-level `Func`s were last defined, by name
+    function_sites: HashMap<String, crate::ast::Position>,
+    /// Positions of the top-level statements of the next program to run
+    statement_sites: Vec<crate::ast::Position>,
+    /// Position of the top-level statement being evaluated, if known
+    call_site: Option<crate::ast::Position>,
+    /// Polled before every statement; set from other threads to stop evaluation
+    interrupt: crate::runtime::InterruptHandle,
 }
 
 impl Evaluator {
@@ -531,14 +715,82 @@ impl Evaluator {
         }
 
         self.step_counter.set(steps + 1);
+        if self.limit_warning.is_some() {
+            self.warn_near_limit(
+                crate::runtime::LimitKind::Steps,
+                steps as u64 + 1,
+                self.limits.max_steps.map(|l| l as u64),
+            );
+        }
+        if let Some((every, hook)) = &self.progress_hook
+            && (steps as u64 + 1).is_multiple_of(*every)
+        {
+            hook(steps as u64 + 1);
+        }
         Ok(())
     }
 
+    /// Call the limit warning hook the first time `used` crosses its threshold
+    /// of `limit` in the current evaluation
+    fn warn_near_limit(&self, kind: crate::runtime::LimitKind, used: u64, limit: Option<u64>) {
+        let (Some((percent, hook)), Some(limit)) = (&self.limit_warning, limit) else {
+            return;
+        };
+        let bit = 1u8 << kind as u8;
+        if self.limit_warnings_sent.get() & bit == 0
+            && used.saturating_mul(100) >= limit.saturating_mul(*percent as u64)
+        {
+            self.limit_warnings_sent
+                .set(self.limit_warnings_sent.get() | bit);
+            hook(kind, used, limit);
+        }
+    }
+
+    /// Set the hook called when usage crosses `percent` of a limit (public API)
+    ///
+    /// Each limit kind warns at most once per top-level evaluation, and only
+    /// while that limit is configured. `percent` is clamped to 1..=100.
+    pub fn set_limit_warning_hook(
+        &mut self,
+        percent: u8,
+        hook: Box<crate::runtime::LimitWarningFn>,
+    ) {
+        self.limit_warning = Some((percent.clamp(1, 100), hook));
+    }
+
+    /// Set the hook called before every function call with its name and arguments (public API)
+    pub fn set_call_hook(&mut self, hook: Option<Box<crate::runtime::CallHookFn>>) {
+        self.call_hook = hook;
+    }
+
+    /// Remove the limit warning hook (public API)
+    pub fn clear_limit_warning_hook(&mut self) {
+        self.limit_warning = None;
+    }
+
+    /// Set the hook called every `every` steps with the step count so far (public API)
+    ///
+    /// `every` is raised to at least 1. The count restarts with each top-level
+    /// evaluation, like the step limit.
+    pub fn set_progress_hook(&mut self, every: u64, hook: Box<crate::runtime::ProgressFn>) {
+        self.progress_hook = Some((every.max(1), hook));
+    }
+
+    /// Remove the progress hook (public API)
+    pub fn clear_progress_hook(&mut self) {
+        self.progress_hook = None;
+    }
+
     /// Reset execution step counter (host-facing).
     ///
     /// This is intended to be called at the start of a *top-level* evaluation.
+    /// It also re-arms the limit warnings and resets the output byte and
+    /// function definition counts.
     pub fn reset_step_counter(&mut self) {
         self.step_counter.set(0);
+        self.limit_warnings_sent.set(0);
+        self.output_bytes = 0;
+        self.defined_functions = 0;
     }
 
     /// Return the current execution step count.
@@ -592,29 +844,91 @@ impl Evaluator {
                     },
                 ));
             }
+            if self.limit_warning.is_some() {
+                self.warn_near_limit(crate::runtime::LimitKind::Duration, elapsed, Some(limit_ms));
+            }
         }
         Ok(())
     }
 
+    /// Build an `UndefinedVariable` error, suggesting the closest visible name
+    fn undefined_variable(&self, name: &str) -> RuntimeError {
+        let mut candidates = self.env.borrow().visible_keys();
+        for registry in &self.host_registries {
+            candidates.extend(registry.names());
+        }
+        RuntimeError::UndefinedVariable {
+            name: name.to_string(),
+            suggestion: crate::runtime::suggest::closest_name(
+                name,
+                candidates.iter().map(String::as_str),
+            ),
+        }
+    }
+
+    /// Stop if the host requested an interrupt (the request is consumed)
+    fn check_interrupt(&self) -> Result<(), RuntimeError> {
+        if self.interrupt.take() {
+            return Err(RuntimeError::Interrupted);
+        }
+        Ok(())
+    }
+
+    /// Drop an interrupt requested while no evaluation was running.
+    ///
+    /// Like `reset_step_counter`, call this at the start of a *top-level* evaluation.
+    pub fn clear_interrupt(&mut self) {
+        self.interrupt.take();
+    }
+
+    /// Handle that interrupts this evaluator from any thread (public API)
+    pub fn interrupt_handle(&self) -> crate::runtime::InterruptHandle {
+        self.interrupt.clone()
+    }
+
     /// Enter function call (check recursion depth)
     fn enter_call(&self) -> Result<(), RuntimeError> {
-        if let Some(limit) = self.limits.max_recursion_depth {
-            let depth = self.call_stack_depth.get();
-            if depth >= limit {
-                return Err(RuntimeError::ExecutionLimit(
-                    crate::runtime::ExecutionLimitError::RecursionDepthExceeded { depth, limit },
-                ));
-            }
-            self.call_stack_depth.set(depth + 1);
+        let depth = self.call_stack_depth.get();
+        if let Some(limit) = self.limits.max_recursion_depth
+            && depth >= limit
+        {
+            return Err(RuntimeError::ExecutionLimit(
+                crate::runtime::ExecutionLimitError::RecursionDepthExceeded { depth, limit },
+            ));
+        }
+        self.call_stack_depth.set(depth + 1);
+        self.peak_call_depth
+            .set(self.peak_call_depth.get().max(depth + 1));
+        if self.limit_warning.is_some() {
+            self.warn_near_limit(
+                crate::runtime::LimitKind::RecursionDepth,
+                depth as u64 + 1,
+                self.limits.max_recursion_depth.map(|l| l as u64),
+            );
         }
         Ok(())
     }
 
     /// Exit function call (decrement recursion depth)
     fn exit_call(&self) {
-        if self.limits.max_recursion_depth.is_some() {
-            let depth = self.call_stack_depth.get();
-            self.call_stack_depth.set(depth.saturating_sub(1));
+        let depth = self.call_stack_depth.get();
+        self.call_stack_depth.set(depth.saturating_sub(1));
+    }
+
+    /// Reset the peaks reported by `eval_stats` (public API)
+    ///
+    /// The step count is reset separately by `reset_step_counter`.
+    pub fn reset_eval_stats(&mut self) {
+        self.peak_call_depth.set(0);
+        self.peak_array_length.set(0);
+    }
+
+    /// Resource usage since the last reset (public API)
+    pub fn eval_stats(&self) -> crate::runtime::EvalStats {
+        crate::runtime::EvalStats {
+            steps: self.step_counter.get(),
+            peak_call_depth: self.peak_call_depth.get(),
+            peak_array_length: self.peak_array_length.get(),
         }
     }
 
@@ -628,6 +942,288 @@ impl Evaluator {
         &self.limits
     }
 
+    /// Set the maximum top-level result size in bytes (public API)
+    pub fn set_max_result_bytes(&mut self, max: Option<usize>) {
+        self.max_result_bytes = max;
+    }
+
+    /// Get the maximum top-level result size in bytes (public API)
+    pub fn max_result_bytes(&self) -> Option<usize> {
+        self.max_result_bytes
+    }
+
+    /// Refuse a top-level result whose string form exceeds `max_result_bytes`
+    pub fn check_result_size(&self, value: &Value) -> Result<(), RuntimeError> {
+        let Some(limit) = self.max_result_bytes else {
+            return Ok(());
+        };
+        let bytes = match value {
+            Value::String(s) => s.len(),
+            other => other.to_string().len(),
+        };
+        if bytes > limit {
+            return Err(RuntimeError::ExecutionLimit(
+                crate::runtime::ExecutionLimitError::ResultTooLarge { bytes, limit },
+            ));
+        }
+        Ok(())
+    }
+
+    /// Set the maximum PRINT/PRINTLN output per top-level evaluation in bytes (public API)
+    pub fn set_max_output_bytes(&mut self, max: Option<usize>) {
+        self.max_output_bytes = max;
+    }
+
+    /// Get the maximum PRINT/PRINTLN output per top-level evaluation in bytes (public API)
+    pub fn max_output_bytes(&self) -> Option<usize> {
+        self.max_output_bytes
+    }
+
+    /// Count `len` bytes of PRINT/PRINTLN output, refusing output past `max_output_bytes`
+    fn charge_output(&mut self, len: usize) -> Result<(), RuntimeError> {
+        let bytes = self.output_bytes + len;
+        if let Some(limit) = self.max_output_bytes
+            && bytes > limit
+        {
+            return Err(RuntimeError::ExecutionLimit(
+                crate::runtime::ExecutionLimitError::OutputLimitExceeded { bytes, limit },
+            ));
+        }
+        self.output_bytes = bytes;
+        Ok(())
+    }
+
+    /// Set the maximum number of Func/Generator definitions per top-level evaluation (public API)
+    pub fn set_max_functions(&mut self, max: Option<usize>) {
+        self.max_functions = max;
+    }
+
+    /// Get the maximum number of Func/Generator definitions per top-level evaluation (public API)
+    pub fn max_functions(&self) -> Option<usize> {
+        self.max_functions
+    }
+
+    /// Count one Func/Generator definition, refusing definitions past `max_functions`
+    fn count_function_definition(&mut self) -> Result<(), RuntimeError> {
+        let count = self.defined_functions + 1;
+        if let Some(limit) = self.max_functions
+            && count > limit
+        {
+            return Err(RuntimeError::ExecutionLimit(
+                crate::runtime::ExecutionLimitError::FunctionLimitExceeded { count, limit },
+            ));
+        }
+        self.defined_functions = count;
+        Ok(())
+    }
+
+    /// Set the maximum number of elements in a single array (public API)
+    pub fn set_max_array_length(&mut self, max: Option<usize>) {
+        self.max_array_length = max;
+    }
+
+    /// Get the maximum number of elements in a single array (public API)
+    pub fn max_array_length(&self) -> Option<usize> {
+        self.max_array_length
+    }
+
+    /// Record the array length for `eval_stats` and refuse an array with more
+    /// than `max_array_length` elements
+    fn check_array_length(&self, value: &Value) -> Result<(), RuntimeError> {
+        if let Value::Array(arr) = value {
+            self.peak_array_length
+                .set(self.peak_array_length.get().max(arr.len()));
+        }
+        if let (Some(limit), Value::Array(arr)) = (self.max_array_length, value)
+            && arr.len() > limit
+        {
+            return Err(RuntimeError::ExecutionLimit(
+                crate::runtime::ExecutionLimitError::ArrayTooLarge {
+                    length: arr.len(),
+                    limit,
+                },
+            ));
+        }
+        if let (Some(_), Value::Array(arr)) = (&self.limit_warning, value) {
+            self.warn_near_limit(
+                crate::runtime::LimitKind::ArrayLength,
+                arr.len() as u64,
+                self.max_array_length.map(|l| l as u64),
+            );
+        }
+        Ok(())
+    }
+
+    /// Get the IO permissions this evaluator was created with (public API)
+    pub fn permissions(&self) -> &crate::builtins::IOPermissions {
+        self.registry.permissions()
+    }
+
+    /// Register a host function private to this evaluator (public API)
+    pub fn register_host_function<F>(&mut self, name: impl Into<String>, arity: usize, func: F)
+    where
+        F: Fn(&[Value]) -> Result<Value, String> + Send + Sync + 'static,
+    {
+        self.host_registries[0].register(name, arity, func);
+    }
+
+    /// Register a context-aware host function private to this evaluator (public API)
+    pub fn register_host_function_with_context<F>(
+        &mut self,
+        name: impl Into<String>,
+        arity: usize,
+        func: F,
+    ) where
+        F: Fn(&crate::runtime::HostContext, &[Value]) -> Result<Value, String>
+            + Send
+            + Sync
+            + 'static,
+    {
+        self.host_registries[0].register_with_context(name, arity, func);
+    }
+
+    /// Set the data passed to context-aware host functions (public API)
+    ///
+    /// Returns the previous data so callers can restore it.
+    pub fn set_host_data(
+        &mut self,
+        data: Option<crate::runtime::HostData>,
+    ) -> Option<crate::runtime::HostData> {
+        std::mem::replace(&mut self.host_data, data)
+    }
+
+    /// Build the context for a host function call
+    fn host_context(&self) -> crate::runtime::HostContext {
+        let deadline = self.limits.max_duration_ms.and_then(|ms| {
+            self.start_time
+                .get()
+                .map(|start| start + std::time::Duration::from_millis(ms))
+        });
+        crate::runtime::HostContext::new(deadline, self.host_data.clone())
+    }
+
+    /// Attach a shared host function registry (public API)
+    ///
+    /// Attaching the same registry twice is a no-op.
+    pub fn attach_host_registry(&mut self, registry: crate::runtime::HostRegistry) {
+        if !self.host_registries.iter().any(|r| r.ptr_eq(&registry)) {
+            self.host_registries.push(registry);
+        }
+    }
+
+    /// Look up a host function; private functions win over shared ones
+    fn host_function(&self, name: &str) -> Option<crate::runtime::HostFunction> {
+        self.host_registries.iter().find_map(|r| r.get(name))
+    }
+
+    /// Set integer overflow behavior (public API)
+    pub fn set_int_overflow(&mut self, mode: crate::runtime::IntOverflowMode) {
+        self.int_overflow = mode;
+    }
+
+    /// Seed the RNG used by RANDOM/RANDOM_INT (public API)
+    pub fn set_seed(&mut self, seed: u64) {
+        self.rng.reseed(seed);
+    }
+
+    /// Swap in another RNG, returning the previous one so it can be restored (public API)
+    pub fn replace_rng(&mut self, rng: crate::runtime::SeededRng) -> crate::runtime::SeededRng {
+        std::mem::replace(&mut self.rng, rng)
+    }
+
+    /// Freeze the time returned by NOW; `None` restores the real clock (public API)
+    pub fn set_clock(&mut self, clock: Option<std::time::SystemTime>) {
+        self.clock = clock;
+    }
+
+    /// The fixed time returned by NOW, if any (public API)
+    pub fn clock(&self) -> Option<std::time::SystemTime> {
+        self.clock
+    }
+
+    /// Get integer overflow behavior (public API)
+    pub fn int_overflow(&self) -> crate::runtime::IntOverflowMode {
+        self.int_overflow
+    }
+
+    /// Set string concatenation behavior for `+` (public API)
+    pub fn set_string_coercion(&mut self, mode: crate::runtime::StringCoercion) {
+        self.string_coercion = mode;
+    }
+
+    /// Get string concatenation behavior for `+` (public API)
+    pub fn string_coercion(&self) -> crate::runtime::StringCoercion {
+        self.string_coercion
+    }
+
+    /// Set division-by-zero behavior for `/` and `%` (public API)
+    pub fn set_div_by_zero(&mut self, mode: crate::runtime::DivByZeroMode) {
+        self.div_by_zero = mode;
+    }
+
+    /// Get division-by-zero behavior for `/` and `%` (public API)
+    pub fn div_by_zero(&self) -> crate::runtime::DivByZeroMode {
+        self.div_by_zero
+    }
+
+    /// Make `/` between integers that do not divide evenly yield an exact Fraction (public API)
+    pub fn set_rational_division(&mut self, enabled: bool) {
+        self.rational_division = enabled;
+    }
+
+    /// Whether integer division yields exact Fractions (public API)
+    pub fn rational_division(&self) -> bool {
+        self.rational_division
+    }
+
+    /// Make calling a user function that is already running a runtime error (public API)
+    pub fn set_no_recursion(&mut self, enabled: bool) {
+        self.no_recursion = enabled;
+        self.active_functions.clear();
+    }
+
+    /// Whether recursive calls are forbidden (public API)
+    pub fn no_recursion(&self) -> bool {
+        self.no_recursion
+    }
+
+    /// Apply the engine's deny list when parsing imported modules (public API)
+    ///
+    /// Modules already loaded under the old list are dropped so they are parsed again.
+    pub fn set_denied_prefixes(&mut self, prefixes: Vec<String>) {
+        self.denied_prefixes = prefixes;
+        self.module_cache.clear();
+    }
+
+    /// Apply the engine's nesting limit when parsing imported modules (public API)
+    ///
+    /// Modules already loaded under the old limit are dropped so they are parsed again.
+    pub fn set_max_nesting_depth(&mut self, max: Option<usize>) {
+        self.max_nesting_depth = max;
+        self.module_cache.clear();
+    }
+
+    /// Parser for module source, with the same restrictions as the engine's own parser
+    fn module_parser(&self, source: &str) -> crate::parser::Parser {
+        crate::parser::Parser::new(source)
+            .with_denied_prefixes(self.denied_prefixes.clone())
+            .with_max_nesting_depth(self.max_nesting_depth)
+    }
+
+    /// Route the file builtins through a host file system, or back to the real one (public API)
+    pub fn set_file_system(&mut self, file_system: Option<Box<dyn crate::runtime::FileSystem>>) {
+        self.file_system = file_system;
+    }
+
+    /// Result of `/` or `%` with a zero divisor; `ieee` is the IEEE 754 result
+    fn zero_divisor_result(&self, ieee: f64) -> Result<Value, RuntimeError> {
+        match self.div_by_zero {
+            crate::runtime::DivByZeroMode::Error => Err(RuntimeError::DivisionByZero),
+            crate::runtime::DivByZeroMode::Infinity => Ok(Value::Number(ieee)),
+            crate::runtime::DivByZeroMode::Zero => Ok(Value::Number(0.0)),
+        }
+    }
+
     fn is_control_flow_error(err: &RuntimeError) -> bool {
         matches!(
             err,
@@ -679,13 +1275,26 @@ impl Evaluator {
         Evaluator {
             env,
             registry,
+            host_registries: vec![crate::runtime::HostRegistry::new()],
             trace: VecDeque::new(),
             trace_seq: 0,
             trace_entries: VecDeque::new(),
             trace_buffer_size,
+            output_capture: None,
+            output_writer: None,
+            no_output: false,
+            sorted_map_keys: false,
+            locale: None,
+            builtins_restricted: false,
+            print_separator: " ".to_string(),
+            print_terminator: "\n".to_string(),
+            host_data: None,
+            rng: crate::runtime::SeededRng::from_entropy(),
+            clock: None,
 
             module_resolver: Box::new(DisabledModuleResolver),
             module_cache: HashMap::new(),
+            registered_modules: HashMap::new(),
             module_stack: Vec::new(),
             export_stack: Vec::new(),
             import_base_stack: Vec::new(),
@@ -697,7 +1306,40 @@ impl Evaluator {
             current_line: std::cell::Cell::new(0),
             step_counter: std::cell::Cell::new(0),
             call_stack_depth: std::cell::Cell::new(0),
+            peak_call_depth: std::cell::Cell::new(0),
+            peak_array_length: std::cell::Cell::new(0),
+            call_hook: None,
+            limit_warning: None,
+            limit_warnings_sent: std::cell::Cell::new(0),
+            progress_hook: None,
             start_time: std::cell::Cell::new(None),
+            int_overflow: crate::runtime::IntOverflowMode::default(),
+            string_coercion: crate::runtime::StringCoercion::default(),
+            div_by_zero: crate::runtime::DivByZeroMode::default(),
+            rational_division: false,
+            no_recursion: false,
+            active_functions: Vec::new(),
+            denied_prefixes: Vec::new(),
+            max_nesting_depth: None,
+            file_system: None,
+            last_result_kind: crate::runtime::ResultKind::default(),
+            last_side_effects: false,
+            called_hosts: Vec::new(),
+            last_result_index: None,
+            max_result_bytes: None,
+            max_output_bytes: None,
+            max_functions: None,
+            defined_functions: 0,
+            output_bytes: 0,
+            max_array_length: None,
+            prelude: Vec::new(),
+            constants: HashMap::new(),
+            shared_data: HashMap::new(),
+            initial_vars: Vec::new(),
+            function_sites: HashMap::new(),
+            statement_sites: Vec::new(),
+            call_site: None,
+            interrupt: crate::runtime::InterruptHandle::new(),
         }
     }
 
@@ -707,13 +1349,26 @@ impl Evaluator {
         Evaluator {
             env,
             registry,
+            host_registries: vec![crate::runtime::HostRegistry::new()],
             trace: VecDeque::new(),
             trace_seq: 0,
             trace_entries: VecDeque::new(),
             trace_buffer_size: Self::DEFAULT_TRACE_BUFFER_SIZE,
+            output_capture: None,
+            output_writer: None,
+            no_output: false,
+            sorted_map_keys: false,
+            locale: None,
+            builtins_restricted: false,
+            print_separator: " ".to_string(),
+            print_terminator: "\n".to_string(),
+            host_data: None,
+            rng: crate::runtime::SeededRng::from_entropy(),
+            clock: None,
 
             module_resolver: Box::new(DisabledModuleResolver),
             module_cache: HashMap::new(),
+            registered_modules: HashMap::new(),
             module_stack: Vec::new(),
             export_stack: Vec::new(),
             import_base_stack: Vec::new(),
@@ -725,13 +1380,47 @@ impl Evaluator {
             current_line: std::cell::Cell::new(0),
             step_counter: std::cell::Cell::new(0),
             call_stack_depth: std::cell::Cell::new(0),
+            peak_call_depth: std::cell::Cell::new(0),
+            peak_array_length: std::cell::Cell::new(0),
+            call_hook: None,
+            limit_warning: None,
+            limit_warnings_sent: std::cell::Cell::new(0),
+            progress_hook: None,
             start_time: std::cell::Cell::new(None),
+            int_overflow: crate::runtime::IntOverflowMode::default(),
+            string_coercion: crate::runtime::StringCoercion::default(),
+            div_by_zero: crate::runtime::DivByZeroMode::default(),
+            rational_division: false,
+            no_recursion: false,
+            active_functions: Vec::new(),
+            denied_prefixes: Vec::new(),
+            max_nesting_depth: None,
+            file_system: None,
+            last_result_kind: crate::runtime::ResultKind::default(),
+            last_side_effects: false,
+            called_hosts: Vec::new(),
+            last_result_index: None,
+            max_result_bytes: None,
+            max_output_bytes: None,
+            max_functions: None,
+            defined_functions: 0,
+            output_bytes: 0,
+            max_array_length: None,
+            prelude: Vec::new(),
+            constants: HashMap::new(),
+            shared_data: HashMap::new(),
+            initial_vars: Vec::new(),
+            function_sites: HashMap::new(),
+            statement_sites: Vec::new(),
+            call_site: None,
+            interrupt: crate::runtime::InterruptHandle::new(),
         }
     }
 
     /// Clear the call stack (used by top-level entry points like `Aether::eval`).
     pub fn clear_call_stack(&mut self) {
         self.call_stack.clear();
+        self.active_functions.clear();
     }
 
     /// Configure the module resolver used for `Import/Export`.
@@ -739,6 +1428,16 @@ impl Evaluator {
         self.module_resolver = resolver;
     }
 
+    /// Register a module under `name` (public API)
+    ///
+    /// The module is evaluated in its own environment the first time a script
+    /// references `name`, and all of its top-level definitions become reachable
+    /// as `name.MEMBER`. Registering a name again replaces the module.
+    pub fn register_module(&mut self, name: &str, source: String) {
+        self.module_cache.remove(name);
+        self.registered_modules.insert(name.to_string(), source);
+    }
+
     /// Push a base directory context for resolving relative imports.
     ///
     /// This is typically used by CLI `eval_file()` wrappers.
@@ -889,6 +1588,130 @@ impl Evaluator {
         }
     }
 
+    /// Start capturing PRINT/PRINTLN output into memory instead of stdout.
+    ///
+    /// Any output captured by a previous, unfinished capture is discarded.
+    pub fn begin_output_capture(&mut self) {
+        self.output_capture = Some(crate::runtime::OutputCapture::new());
+    }
+
+    /// Start capturing PRINT/PRINTLN output, keeping only the last `lines` lines.
+    ///
+    /// Earlier lines are dropped as new ones arrive, so memory stays bounded.
+    pub fn begin_output_capture_tail(&mut self, lines: usize) {
+        self.output_capture = Some(crate::runtime::OutputCapture::tail(lines));
+    }
+
+    /// Stop capturing output and return the captured lines.
+    ///
+    /// Returns an empty vector if no capture was active.
+    pub fn end_output_capture(&mut self) -> Vec<String> {
+        self.output_capture
+            .take()
+            .map(|capture| capture.finish())
+            .unwrap_or_default()
+    }
+
+    /// Send PRINT/PRINTLN output to a host writer instead of stdout.
+    ///
+    /// If the writer returns an error, evaluation aborts with
+    /// `RuntimeError::OutputError`, so a writer can apply backpressure or stop
+    /// a runaway script. An active output capture takes precedence.
+    /// Passing `None` restores stdout.
+    pub fn set_output_writer(&mut self, writer: Option<Box<dyn std::io::Write>>) {
+        self.output_writer = writer;
+    }
+
+    /// Make PRINT/PRINTLN fail with an output error instead of printing (public API)
+    pub fn set_no_output(&mut self, enabled: bool) {
+        self.no_output = enabled;
+    }
+
+    /// Whether PRINT/PRINTLN are forbidden (public API)
+    pub fn no_output(&self) -> bool {
+        self.no_output
+    }
+
+    /// Make PRINT/PRINTLN emit dictionary keys in sorted order (public API)
+    pub fn set_sorted_map_keys(&mut self, enabled: bool) {
+        self.sorted_map_keys = enabled;
+    }
+
+    /// Whether PRINT/PRINTLN emit dictionary keys in sorted order (public API)
+    pub fn sorted_map_keys(&self) -> bool {
+        self.sorted_map_keys
+    }
+
+    /// Format numbers in PRINT/PRINTLN and string coercion for a locale (public API)
+    ///
+    /// `None` restores the locale-independent default (`1234567.5`).
+    pub fn set_locale(&mut self, locale: Option<crate::runtime::NumberLocale>) {
+        self.locale = locale;
+    }
+
+    /// The locale used to format numbers, if any (public API)
+    pub fn locale(&self) -> Option<&crate::runtime::NumberLocale> {
+        self.locale.as_ref()
+    }
+
+    /// Render a value as PRINT/PRINTLN output
+    fn display_string(&self, value: &Value) -> String {
+        match &self.locale {
+            Some(locale) => value.to_locale_string(locale, self.sorted_map_keys),
+            None if self.sorted_map_keys => value.to_sorted_string(),
+            None => value.to_string(),
+        }
+    }
+
+    /// Render an operand of string coercion (`"a" + 1`)
+    fn coerce_string(&self, value: &Value) -> String {
+        match &self.locale {
+            Some(locale) => value.to_locale_string(locale, false),
+            None => value.to_string(),
+        }
+    }
+
+    /// Keep only the builtins in the given groups, unbinding the rest (public API)
+    ///
+    /// See [`crate::builtins::BUILTIN_GROUPS`] for the group names. Globals that
+    /// shadow a disabled builtin are left untouched.
+    pub fn retain_builtin_groups(&mut self, groups: &[&str]) -> Result<(), String> {
+        let before = self.registry.names();
+        self.registry.retain_groups(groups)?;
+        self.builtins_restricted = true;
+
+        let mut env = self.env.borrow_mut();
+        for name in before {
+            if self.registry.has(&name) {
+                continue;
+            }
+            if matches!(env.get(&name), Some(Value::BuiltIn { name: ref b, .. }) if *b == name) {
+                env.remove(&name);
+            }
+        }
+        Ok(())
+    }
+
+    /// Set the text PRINT/PRINTLN put between arguments (default `" "`) (public API)
+    pub fn set_print_separator(&mut self, separator: &str) {
+        self.print_separator = separator.to_string();
+    }
+
+    /// Set the text PRINTLN appends after its arguments (default `"\n"`) (public API)
+    pub fn set_print_terminator(&mut self, terminator: &str) {
+        self.print_terminator = terminator.to_string();
+    }
+
+    /// Whether PRINT/PRINTLN use a non-default separator or terminator
+    fn custom_print_format(&self) -> bool {
+        self.print_separator != " " || self.print_terminator != "\n"
+    }
+
+    /// Whether a host output writer is installed.
+    pub fn has_output_writer(&self) -> bool {
+        self.output_writer.is_some()
+    }
+
     /// Reset the environment (clear all variables and re-register built-ins)
     ///
     /// This is useful for engine pooling and global singleton patterns
@@ -909,9 +1732,322 @@ impl Evaluator {
 
         // Avoid leaking call stack across pooled executions
         self.call_stack.clear();
+        self.active_functions.clear();
 
         // Re-register built-in functions
         Self::register_builtins_into_env(&self.registry, &mut self.env.borrow_mut());
+
+        // Re-define prelude functions so they close over the new environment.
+        // They are bound directly rather than evaluated, so a previous run that
+        // hit a limit or was interrupted cannot make them disappear.
+        for stmt in &self.prelude {
+            if let Some((name, value)) = self.prelude_binding(stmt) {
+                self.env.borrow_mut().set(name, value);
+            }
+        }
+
+        // Re-seed initial variables (fresh copies, so earlier mutations do not leak)
+        for (name, value) in &self.initial_vars {
+            self.env.borrow_mut().set(name.clone(), value.clone());
+        }
+
+        // Re-bind host constants
+        for (name, value) in &self.constants {
+            self.env.borrow_mut().set(name.clone(), value.clone());
+        }
+    }
+
+    /// Define prelude functions that survive `reset_env` (public API)
+    ///
+    /// Only `Func`/`Generator` definitions whose names are not constants or
+    /// shared data are accepted; nothing is defined if any statement is
+    /// rejected. On error returns the index of the first offending statement
+    /// and the reason. Prelude functions do not count towards `max_functions`.
+    pub fn load_prelude(&mut self, program: &[Stmt]) -> Result<(), (usize, String)> {
+        for (index, stmt) in program.iter().enumerate() {
+            match stmt {
+                Stmt::FuncDef { name, .. } | Stmt::GeneratorDef { name, .. } => {
+                    if self.is_read_only(name) {
+                        let error = RuntimeError::ConstantReassignment(name.clone());
+                        return Err((index, error.to_string()));
+                    }
+                }
+                other => {
+                    return Err((
+                        index,
+                        format!(
+                            "only Func/Generator definitions are allowed, found {}",
+                            other.kind_name()
+                        ),
+                    ));
+                }
+            }
+        }
+
+        for stmt in program {
+            if let Some((name, value)) = self.prelude_binding(stmt) {
+                self.env.borrow_mut().set(name, value);
+            }
+            self.prelude.push(stmt.clone());
+        }
+        Ok(())
+    }
+
+    /// The global binding a prelude definition creates in the current environment
+    fn prelude_binding(&self, stmt: &Stmt) -> Option<(String, Value)> {
+        match stmt {
+            Stmt::FuncDef { name, params, body } => Some((
+                name.clone(),
+                Value::Function {
+                    name: Some(name.clone()),
+                    params: params.clone(),
+                    body: body.clone(),
+                    env: Rc::clone(&self.env),
+                },
+            )),
+            Stmt::GeneratorDef { name, params, body } => Some((
+                name.clone(),
+                Value::Generator {
+                    params: params.clone(),
+                    body: body.clone(),
+                    env: Rc::clone(&self.env),
+                    state: GeneratorState::NotStarted,
+                },
+            )),
+            _ => None,
+        }
+    }
+
+    /// Forget all prelude definitions; they disappear on the next `reset_env` (public API)
+    pub fn clear_prelude(&mut self) {
+        self.prelude.clear();
+    }
+
+    /// Bind a global that scripts can read but not rebind or modify (public API)
+    ///
+    /// Calling this again for the same name replaces the value. Constants
+    /// survive `reset_env`.
+    pub fn set_const(&mut self, name: impl Into<String>, value: Value) {
+        let name = name.into();
+        self.env.borrow_mut().set(name.clone(), value.clone());
+        self.constants.insert(name, value);
+    }
+
+    /// Seed the global scope with variables that survive `reset_env` (public API)
+    ///
+    /// Unlike constants, scripts may reassign them; `reset_env` restores a
+    /// fresh copy of the seeded values. Replaces any previously seeded list.
+    pub fn set_initial_vars(&mut self, vars: Vec<(String, Value)>) {
+        for (name, value) in &vars {
+            self.env.borrow_mut().set(name.clone(), value.clone());
+        }
+        self.initial_vars = vars;
+    }
+
+    /// Whether `name` is a host-defined constant (public API)
+    pub fn is_const(&self, name: &str) -> bool {
+        self.constants.contains_key(name)
+    }
+
+    /// Turn all constants back into ordinary globals (public API)
+    pub fn clear_constants(&mut self) {
+        self.constants.clear();
+    }
+
+    /// Bind read-only data shared with other engines (public API)
+    ///
+    /// Replaces any global of the same name. Scripts may read the name but
+    /// not rebind or modify it, and the binding survives `reset_env`.
+    pub fn set_shared_data(&mut self, name: impl Into<String>, data: crate::runtime::SharedData) {
+        let name = name.into();
+        self.env.borrow_mut().remove(&name);
+        self.shared_data.insert(name, data);
+    }
+
+    /// Remove a shared data binding, returning whether it existed (public API)
+    pub fn remove_shared_data(&mut self, name: &str) -> bool {
+        self.shared_data.remove(name).is_some()
+    }
+
+    /// Whether scripts are forbidden from rebinding or modifying `name`
+    fn is_read_only(&self, name: &str) -> bool {
+        self.constants.contains_key(name) || self.shared_data.contains_key(name)
+    }
+
+    /// Refuse statements that would rebind or modify a constant
+    fn check_not_constant(&self, stmt: &Stmt) -> Result<(), RuntimeError> {
+        let name = match stmt {
+            Stmt::Set { name, .. }
+            | Stmt::FuncDef { name, .. }
+            | Stmt::GeneratorDef { name, .. }
+            | Stmt::LazyDef { name, .. } => Some(name),
+            Stmt::For { var, .. } => Some(var),
+            Stmt::ForIndexed {
+                index_var,
+                value_var,
+                ..
+            } => [index_var, value_var]
+                .into_iter()
+                .find(|n| self.is_read_only(n)),
+            Stmt::SetIndex { object, .. } => {
+                // `Set CFG["a"]["b"] ...` modifies the root variable
+                let mut root = object.as_ref();
+                while let Expr::Index { object, .. } = root {
+                    root = object.as_ref();
+                }
+                match root {
+                    Expr::Identifier(name) => Some(name),
+                    _ => None,
+                }
+            }
+            _ => None,
+        };
+
+        match name {
+            Some(name) if self.is_read_only(name) => {
+                Err(RuntimeError::ConstantReassignment(name.clone()))
+            }
+            _ => Ok(()),
+        }
+    }
+
+    /// Remember where top-level functions are defined, for `functions` (public API)
+    pub fn record_function_sites(&mut self, sites: &[(String, crate::ast::Position)]) {
+        for (name, position) in sites {
+            self.function_sites.insert(name.clone(), *position);
+        }
+    }
+
+    /// Remember where the top-level statements of the next program start (public API)
+    ///
+    /// `sites[i]` is the source position of the program's `i`-th top-level
+    /// statement. The next `eval_program` consumes them to fill in the call
+    /// site of the frames it pushes; programs run without sites report 0.
+    pub fn record_statement_sites(&mut self, sites: Vec<crate::ast::Position>) {
+        self.statement_sites = sites;
+    }
+
+    /// Whether a script could resolve `name` before defining it (public API)
+    ///
+    /// True for globals, builtins, host functions and registered modules.
+    pub fn is_defined(&self, name: &str) -> bool {
+        self.env.borrow().has(name)
+            || self.host_function(name).is_some()
+            || self.registered_modules.contains_key(name)
+    }
+
+    /// Whether a name resolves to something callable rather than data (public API)
+    ///
+    /// True for builtins, host functions, registered modules and global
+    /// `Func`/`Generator` definitions; false for plain variables and unknown names.
+    pub fn is_callable_name(&self, name: &str) -> bool {
+        matches!(
+            self.env.borrow().get(name),
+            Some(Value::BuiltIn { .. } | Value::Function { .. } | Value::Generator { .. })
+        ) || self.host_function(name).is_some()
+            || self.registered_modules.contains_key(name)
+    }
+
+    /// Whether `name` resolves to a function without side effects (public API)
+    ///
+    /// Returns `None` when the name is not a function. Builtins outside
+    /// `SIDE_EFFECT_GROUPS` are pure; script-defined and host functions are
+    /// treated as impure because their bodies cannot be vetted.
+    pub fn function_purity(&self, name: &str) -> Option<bool> {
+        match self.env.borrow().get(name) {
+            Some(Value::BuiltIn { name, .. }) => Some(
+                self.registry
+                    .group_of(&name)
+                    .is_some_and(|group| !crate::builtins::SIDE_EFFECT_GROUPS.contains(&group)),
+            ),
+            Some(Value::Function { .. } | Value::Generator { .. }) => Some(false),
+            Some(_) => None,
+            None => self.host_function(name).map(|_| false),
+        }
+    }
+
+    /// User-defined `Func`s in the global scope, sorted by name (public API)
+    ///
+    /// Builtins, host functions and anonymous lambdas are not included.
+    pub fn functions(&self) -> Vec<crate::runtime::FunctionInfo> {
+        let env = self.env.borrow();
+        let mut functions: Vec<_> = env
+            .keys()
+            .into_iter()
+            .filter_map(|key| match env.get(&key) {
+                Some(Value::Function {
+                    name: Some(name),
+                    params,
+                    ..
+                }) if name == key => {
+                    let position = self.function_sites.get(&key);
+                    Some(crate::runtime::FunctionInfo {
+                        line: position.map_or(0, |p| p.line),
+                        column: position.map_or(0, |p| p.column),
+                        name,
+                        params,
+                    })
+                }
+                _ => None,
+            })
+            .collect();
+        functions.sort_by(|a, b| a.name.cmp(&b.name));
+        functions
+    }
+
+    /// Approximate bytes held by the global scope and constants (public API)
+    ///
+    /// User-defined functions live in the global scope and are included.
+    /// See `Value::approx_size` for what is counted.
+    pub fn memory_usage(&self) -> usize {
+        self.env.borrow().approx_size()
+            + self
+                .constants
+                .iter()
+                .map(|(name, value)| name.capacity() + value.approx_size())
+                .sum::<usize>()
+    }
+
+    /// Serialize global variables and user-defined functions (public API)
+    ///
+    /// Registered builtins and host constants are left out; they belong to
+    /// the engine configuration. See `runtime::state` for the format.
+    pub fn save_state(&self) -> Result<Vec<u8>, String> {
+        crate::runtime::state::save(self.globals(), &self.env)
+    }
+
+    /// Snapshot global variables and user-defined functions, sorted by name (public API)
+    ///
+    /// Like `save_state`, registered builtins and host constants are left out.
+    pub fn globals(&self) -> std::collections::BTreeMap<String, Value> {
+        let env = self.env.borrow();
+        env.keys()
+            .into_iter()
+            .filter_map(|name| {
+                if self.constants.contains_key(&name) {
+                    return None;
+                }
+                match env.get(&name)? {
+                    Value::BuiltIn { name: builtin, .. } if builtin == name => None,
+                    value => Some((name, value)),
+                }
+            })
+            .collect()
+    }
+
+    /// Restore globals saved by `save_state` into the global scope (public API)
+    ///
+    /// Nothing is bound if the bytes are invalid or from another format version.
+    /// Saved values never replace this engine's host constants or shared data.
+    pub fn load_state(&mut self, bytes: &[u8]) -> Result<(), String> {
+        let globals = crate::runtime::state::load(bytes, &self.env)?;
+        let mut env = self.env.borrow_mut();
+        for (name, value) in globals {
+            if !self.is_read_only(&name) {
+                env.set(name, value);
+            }
+        }
+        Ok(())
     }
 
     /// Set a global variable from the host (without requiring `eval`).
@@ -941,25 +2077,124 @@ impl Evaluator {
 
     /// Evaluate a program
     pub fn eval_program(&mut self, program: &Program) -> EvalResult {
+        self.env.borrow_mut().take_modified();
+        let sites = std::mem::take(&mut self.statement_sites);
+        let outer_site = self.call_site;
+        let result = self.eval_top_level(program, &sites);
+        self.call_site = outer_site;
+        self.last_side_effects = self.env.borrow_mut().take_modified();
+        result
+    }
+
+    /// Whether the last evaluated program set variables or defined functions
+    /// in the global scope, even if it then failed (public API)
+    pub fn last_eval_had_side_effects(&self) -> bool {
+        self.last_side_effects
+    }
+
+    /// Names of the host functions invoked by the last evaluated program,
+    /// in the order of their first call (public API)
+    pub fn called_hosts(&self) -> &[String] {
+        &self.called_hosts
+    }
+
+    /// Forget side effects and host calls of the previous program, e.g. when
+    /// the next one fails to parse
+    pub fn clear_side_effects(&mut self) {
+        self.last_side_effects = false;
+        self.called_hosts.clear();
+    }
+
+    fn eval_top_level(&mut self, program: &Program, sites: &[crate::ast::Position]) -> EvalResult {
         // Record start time for timeout checking
         if self.limits.max_duration_ms.is_some() {
             self.start_time.set(Some(std::time::Instant::now()));
         }
 
+        // A failed run leaves no result behind, not the previous run's
         let mut result = Value::Null;
-
-        for stmt in program {
-            result = self.eval_statement(stmt)?;
+        self.last_result_kind = crate::runtime::ResultKind::Void;
+        self.last_result_index = None;
+
+        for (index, stmt) in program.iter().enumerate() {
+            self.call_site = sites.get(index).copied();
+            match self.eval_statement(stmt) {
+                Ok(val) => result = val,
+                // Top-level `Return` ends the script with an explicit value
+                Err(RuntimeError::Return(val)) => {
+                    self.last_result_kind = crate::runtime::ResultKind::Returned;
+                    self.last_result_index = Some(index);
+                    return Ok(val);
+                }
+                Err(e) => return Err(e),
+            }
         }
 
+        self.last_result_kind = if matches!(result, Value::Null) {
+            crate::runtime::ResultKind::Void
+        } else {
+            self.last_result_index = program.len().checked_sub(1);
+            crate::runtime::ResultKind::LastValue
+        };
         Ok(result)
     }
 
+    /// Call a function visible from the global scope by name (public API)
+    ///
+    /// Resolves `name` the same way a script would (variables, builtins, then
+    /// host functions) and calls it with already-evaluated arguments, so hosts
+    /// never have to splice values into source code.
+    pub fn call_named(&mut self, name: &str, args: Vec<Value>) -> EvalResult {
+        if self.limits.max_duration_ms.is_some() {
+            self.start_time.set(Some(std::time::Instant::now()));
+        }
+
+        let func = self.eval_expression(&Expr::Identifier(name.to_string()))?;
+        match func {
+            Value::Function { .. } | Value::BuiltIn { .. } => {
+                self.call_function(Some(name), &func, args)
+            }
+            other => Err(RuntimeError::NotCallable(format!(
+                "{} is a {}",
+                name,
+                other.type_name()
+            ))),
+        }
+    }
+
+    /// Call a function value, e.g. one returned by an earlier evaluation (public API)
+    pub fn call_value(&mut self, func: &Value, args: Vec<Value>) -> EvalResult {
+        if self.limits.max_duration_ms.is_some() {
+            self.start_time.set(Some(std::time::Instant::now()));
+        }
+
+        match func {
+            Value::Function { .. } | Value::BuiltIn { .. } => self.call_function(None, func, args),
+            other => Err(RuntimeError::NotCallable(other.type_name().to_string())),
+        }
+    }
+
+    /// Index of the top-level statement that produced the last program result
+    ///
+    /// `None` when the result was void (see `ResultKind::Void`) or the program failed.
+    pub fn last_result_index(&self) -> Option<usize> {
+        self.last_result_index
+    }
+
+    /// How the last evaluated program produced its result (`Void` if it failed)
+    pub fn last_result_kind(&self) -> crate::runtime::ResultKind {
+        self.last_result_kind
+    }
+
     /// Evaluate a statement
     pub fn eval_statement(&mut self, stmt: &Stmt) -> EvalResult {
         // Check execution limits before each statement
         self.eval_step()?;
         self.check_timeout()?;
+        self.check_interrupt()?;
+        if !self.constants.is_empty() || !self.shared_data.is_empty() {
+            self.check_not_constant(stmt)?;
+        }
 
         match stmt {
             Stmt::Set { name, value } => {
@@ -983,7 +2218,7 @@ impl Evaluator {
                         .env
                         .borrow()
                         .get(name)
-                        .ok_or_else(|| RuntimeError::UndefinedVariable(name.clone()))?;
+                        .ok_or_else(|| self.undefined_variable(name))?;
 
                     // Evaluate the index
                     let idx_val = self.eval_expression(index)?;
@@ -1028,6 +2263,7 @@ impl Evaluator {
             }
 
             Stmt::FuncDef { name, params, body } => {
+                self.count_function_definition()?;
                 let func = Value::Function {
                     name: Some(name.clone()),
                     params: params.clone(),
@@ -1039,6 +2275,7 @@ impl Evaluator {
             }
 
             Stmt::GeneratorDef { name, params, body } => {
+                self.count_function_definition()?;
                 let r#gen = Value::Generator {
                     params: params.clone(),
                     body: body.clone(),
@@ -1077,6 +2314,10 @@ impl Evaluator {
                 let mut result = Value::Null;
 
                 loop {
+                    // Loops with an empty body (or only `Continue`) never reach
+                    // `eval_statement`, so deadlines and interrupts are polled here too
+                    self.check_timeout()?;
+                    self.check_interrupt()?;
                     let cond = self.eval_expression(condition)?;
                     if !cond.is_truthy() {
                         break;
@@ -1115,6 +2356,10 @@ impl Evaluator {
                     Value::Array(arr) => {
                         let mut should_break = false;
                         for item in arr {
+                            // Same per-iteration poll as `While`, for bodies that never
+                            // reach `eval_statement`
+                            self.check_timeout()?;
+                            self.check_interrupt()?;
                             self.env.borrow_mut().set(var.clone(), item);
                             for stmt in body {
                                 match self.eval_statement(stmt) {
@@ -1156,6 +2401,8 @@ impl Evaluator {
                     Value::Array(arr) => {
                         let mut should_break = false;
                         for (idx, item) in arr.iter().enumerate() {
+                            self.check_timeout()?;
+                            self.check_interrupt()?;
                             self.env
                                 .borrow_mut()
                                 .set(index_var.clone(), Value::Number(idx as f64));
@@ -1234,6 +2481,80 @@ impl Evaluator {
         }
     }
 
+    /// Index a value with `obj[idx]`
+    fn index_value(obj: Value, idx: Value) -> EvalResult {
+        match (obj, idx) {
+            (Value::Array(arr), Value::Number(n)) => {
+                let idx = n as usize;
+                arr.get(idx).cloned().ok_or_else(|| {
+                    RuntimeError::InvalidOperation(format!("Index {} out of bounds", idx))
+                })
+            }
+            (Value::String(s), Value::Number(n)) => {
+                let idx = n as usize;
+                let chars: Vec<char> = s.chars().collect();
+                chars
+                    .get(idx)
+                    .cloned()
+                    .map(|ch| Value::String(ch.to_string()))
+                    .ok_or_else(|| {
+                        RuntimeError::InvalidOperation(format!(
+                            "Index {} out of bounds (string length: {})",
+                            idx,
+                            chars.len()
+                        ))
+                    })
+            }
+            (Value::Dict(dict), Value::String(key)) => dict
+                .get(&key)
+                .cloned()
+                .ok_or_else(|| RuntimeError::InvalidOperation(format!("Key '{}' not found", key))),
+            (obj, idx) => Err(RuntimeError::TypeError(format!(
+                "Cannot index {} with {}",
+                obj.type_name(),
+                idx.type_name()
+            ))),
+        }
+    }
+
+    /// Evaluate `NAME[a][b]...` directly against shared data bound to `NAME`
+    ///
+    /// Only the selected element is copied out of the shared data. Returns
+    /// `None` when the chain is not rooted at shared data (or a script
+    /// variable shadows it), so the caller indexes as usual.
+    fn index_shared_data(
+        &mut self,
+        object: &Expr,
+        index: &Expr,
+    ) -> Result<Option<Value>, RuntimeError> {
+        let mut indices = vec![index];
+        let mut root = object;
+        while let Expr::Index { object, index } = root {
+            indices.push(index);
+            root = object;
+        }
+        let data = match root {
+            Expr::Identifier(name) if !self.env.borrow().has(name) => {
+                match self.shared_data.get(name) {
+                    Some(data) => data.clone(),
+                    None => return Ok(None),
+                }
+            }
+            _ => return Ok(None),
+        };
+
+        let path = indices
+            .into_iter()
+            .rev()
+            .map(|index| self.eval_expression(index))
+            .collect::<Result<Vec<_>, _>>()?;
+        let (mut value, used) = data.select(&path)?;
+        for idx in path.into_iter().skip(used) {
+            value = Self::index_value(value, idx)?;
+        }
+        Ok(Some(value))
+    }
+
     /// Evaluate an expression
     pub fn eval_expression(&mut self, expr: &Expr) -> EvalResult {
         match expr {
@@ -1259,11 +2580,26 @@ impl Evaluator {
 
             Expr::Null => Ok(Value::Null),
 
-            Expr::Identifier(name) => self
-                .env
-                .borrow()
-                .get(name)
-                .ok_or_else(|| RuntimeError::UndefinedVariable(name.clone())),
+            Expr::Identifier(name) => {
+                let found = self.env.borrow().get(name);
+                let found = found
+                    .or_else(|| self.shared_data.get(name).map(|data| data.to_value()))
+                    .or_else(|| {
+                        // Host functions resolve after script variables and builtins
+                        self.host_function(name).map(|f| Value::BuiltIn {
+                            name: name.clone(),
+                            arity: f.arity(),
+                        })
+                    });
+                match found {
+                    Some(value) => Ok(value),
+                    // Registered modules resolve last, so scripts can shadow them
+                    None if self.registered_modules.contains_key(name) => {
+                        self.load_registered_module(name).map(Value::Dict)
+                    }
+                    None => Err(self.undefined_variable(name)),
+                }
+            }
 
             Expr::Binary { left, op, right } => {
                 // Short-circuit evaluation for And and Or
@@ -1318,7 +2654,9 @@ impl Evaluator {
             Expr::Array(elements) => {
                 let vals: Result<Vec<_>, _> =
                     elements.iter().map(|e| self.eval_expression(e)).collect();
-                Ok(Value::Array(vals?))
+                let array = Value::Array(vals?);
+                self.check_array_length(&array)?;
+                Ok(array)
             }
 
             Expr::Dict(pairs) => {
@@ -1331,42 +2669,12 @@ impl Evaluator {
             }
 
             Expr::Index { object, index } => {
+                if let Some(value) = self.index_shared_data(object, index)? {
+                    return Ok(value);
+                }
                 let obj_val = self.eval_expression(object)?;
                 let idx_val = self.eval_expression(index)?;
-
-                match (obj_val, idx_val) {
-                    (Value::Array(arr), Value::Number(n)) => {
-                        let idx = n as usize;
-                        arr.get(idx).cloned().ok_or_else(|| {
-                            RuntimeError::InvalidOperation(format!("Index {} out of bounds", idx))
-                        })
-                    }
-                    (Value::String(s), Value::Number(n)) => {
-                        let idx = n as usize;
-                        let chars: Vec<char> = s.chars().collect();
-                        chars
-                            .get(idx)
-                            .cloned()
-                            .map(|ch| Value::String(ch.to_string()))
-                            .ok_or_else(|| {
-                                RuntimeError::InvalidOperation(format!(
-                                    "Index {} out of bounds (string length: {})",
-                                    idx,
-                                    chars.len()
-                                ))
-                            })
-                    }
-                    (Value::Dict(dict), Value::String(key)) => {
-                        dict.get(&key).cloned().ok_or_else(|| {
-                            RuntimeError::InvalidOperation(format!("Key '{}' not found", key))
-                        })
-                    }
-                    (obj, idx) => Err(RuntimeError::TypeError(format!(
-                        "Cannot index {} with {}",
-                        obj.type_name(),
-                        idx.type_name()
-                    ))),
-                }
+                Self::index_value(obj_val, idx_val)
             }
 
             Expr::If {
@@ -1419,11 +2727,64 @@ impl Evaluator {
         }
     }
 
+    /// Apply the configured overflow mode to integer `a op b`.
+    ///
+    /// Returns `None` if either operand is not an `i64` integer or the exact
+    /// result fits in `i64` (in `BigInt` mode: is exactly representable as
+    /// f64); the caller then uses regular f64 arithmetic.
+    fn check_int_overflow(&self, a: f64, op: &BinOp, b: f64) -> Option<EvalResult> {
+        use crate::runtime::IntOverflowMode;
+        use crate::runtime::numeric::as_exact_i64;
+
+        const MAX_EXACT: u64 = 1 << 53;
+        let (x, y) = (as_exact_i64(a)?, as_exact_i64(b)?);
+        let checked = match op {
+            BinOp::Add => x.checked_add(y),
+            BinOp::Subtract => x.checked_sub(y),
+            BinOp::Multiply => x.checked_mul(y),
+            _ => return None,
+        };
+        let promote = self.int_overflow == IntOverflowMode::BigInt;
+        if checked.is_some_and(|r| !promote || r.unsigned_abs() <= MAX_EXACT) {
+            return None;
+        }
+
+        let result = match (self.int_overflow, op) {
+            (IntOverflowMode::BigInt, _) => {
+                use num_bigint::BigInt;
+                let (x, y) = (BigInt::from(x), BigInt::from(y));
+                let exact = match op {
+                    BinOp::Add => x + y,
+                    BinOp::Subtract => x - y,
+                    _ => x * y,
+                };
+                return Some(Ok(Value::Fraction(num_rational::Ratio::from_integer(
+                    exact,
+                ))));
+            }
+            (IntOverflowMode::Error, _) => {
+                return Some(Err(RuntimeError::IntegerOverflow(format!(
+                    "{} {} {}",
+                    x, op, y
+                ))));
+            }
+            (IntOverflowMode::Wrap, BinOp::Add) => x.wrapping_add(y),
+            (IntOverflowMode::Wrap, BinOp::Subtract) => x.wrapping_sub(y),
+            (IntOverflowMode::Wrap, _) => x.wrapping_mul(y),
+            (IntOverflowMode::Saturate, BinOp::Add) => x.saturating_add(y),
+            (IntOverflowMode::Saturate, BinOp::Subtract) => x.saturating_sub(y),
+            (IntOverflowMode::Saturate, _) => x.saturating_mul(y),
+        };
+        Some(Ok(Value::Number(result as f64)))
+    }
+
     /// Evaluate binary operation
     fn eval_binary_op(&self, left: &Value, op: &BinOp, right: &Value) -> EvalResult {
         match op {
             BinOp::Add => match (left, right) {
-                (Value::Number(a), Value::Number(b)) => Ok(Value::Number(a + b)),
+                (Value::Number(a), Value::Number(b)) => self
+                    .check_int_overflow(*a, op, *b)
+                    .unwrap_or_else(|| Ok(Value::Number(a + b))),
                 (Value::String(a), Value::String(b)) => Ok(Value::String(format!("{}{}", a, b))),
                 (Value::Fraction(a), Value::Fraction(b)) => Ok(Value::Fraction(a + b)),
                 (Value::Number(a), Value::Fraction(b)) | (Value::Fraction(b), Value::Number(a)) => {
@@ -1440,6 +2801,15 @@ impl Evaluator {
                         Ok(Value::Number(a + b_float))
                     }
                 }
+                (Value::String(_), _) | (_, Value::String(_))
+                    if self.string_coercion == crate::runtime::StringCoercion::Coerce =>
+                {
+                    Ok(Value::String(format!(
+                        "{}{}",
+                        self.coerce_string(left),
+                        self.coerce_string(right)
+                    )))
+                }
                 _ => Err(RuntimeError::TypeError(format!(
                     "Cannot add {} and {}",
                     left.type_name(),
@@ -1448,7 +2818,9 @@ impl Evaluator {
             },
 
             BinOp::Subtract => match (left, right) {
-                (Value::Number(a), Value::Number(b)) => Ok(Value::Number(a - b)),
+                (Value::Number(a), Value::Number(b)) => self
+                    .check_int_overflow(*a, op, *b)
+                    .unwrap_or_else(|| Ok(Value::Number(a - b))),
                 (Value::Fraction(a), Value::Fraction(b)) => Ok(Value::Fraction(a - b)),
                 (Value::Number(a), Value::Fraction(b)) => {
                     use num_bigint::BigInt;
@@ -1485,6 +2857,10 @@ impl Evaluator {
 
             BinOp::Multiply => match (left, right) {
                 (Value::Number(a), Value::Number(b)) => {
+                    if let Some(res) = self.check_int_overflow(*a, op, *b) {
+                        return res;
+                    }
+
                     // 如果两个数都是整数，且足够大，使用精确计算
                     if a.fract() == 0.0 && b.fract() == 0.0 {
                         // 检查是否超过 f64 的安全整数范围 (2^53)
@@ -1532,15 +2908,28 @@ impl Evaluator {
             BinOp::Divide => match (left, right) {
                 (Value::Number(a), Value::Number(b)) => {
                     if *b == 0.0 {
-                        Err(RuntimeError::DivisionByZero)
+                        self.zero_divisor_result(a / b)
+                    } else if self.rational_division
+                        && let (Some(n), Some(d)) = (
+                            crate::runtime::numeric::as_exact_i64(*a),
+                            crate::runtime::numeric::as_exact_i64(*b),
+                        )
+                        && n.checked_rem(d).is_some_and(|r| r != 0)
+                    {
+                        use num_bigint::BigInt;
+                        use num_rational::Ratio;
+                        Ok(Value::Fraction(Ratio::new(
+                            BigInt::from(n),
+                            BigInt::from(d),
+                        )))
                     } else {
                         Ok(Value::Number(a / b))
                     }
                 }
                 (Value::Fraction(a), Value::Fraction(b)) => {
-                    use num_traits::Zero;
+                    use num_traits::{ToPrimitive, Zero};
                     if b.is_zero() {
-                        Err(RuntimeError::DivisionByZero)
+                        self.zero_divisor_result(a.to_f64().unwrap_or(f64::NAN) / 0.0)
                     } else {
                         Ok(Value::Fraction(a / b))
                     }
@@ -1550,7 +2939,7 @@ impl Evaluator {
                     use num_rational::Ratio;
                     use num_traits::Zero;
                     if b.is_zero() {
-                        Err(RuntimeError::DivisionByZero)
+                        self.zero_divisor_result(a / 0.0)
                     } else if a.fract() == 0.0 {
                         let a_frac = Ratio::new(BigInt::from(*a as i64), BigInt::from(1));
                         Ok(Value::Fraction(a_frac / b))
@@ -1565,7 +2954,8 @@ impl Evaluator {
                     use num_bigint::BigInt;
                     use num_rational::Ratio;
                     if *b == 0.0 {
-                        Err(RuntimeError::DivisionByZero)
+                        use num_traits::ToPrimitive;
+                        self.zero_divisor_result(a.to_f64().unwrap_or(f64::NAN) / b)
                     } else if b.fract() == 0.0 {
                         let b_frac = Ratio::new(BigInt::from(*b as i64), BigInt::from(1));
                         Ok(Value::Fraction(a / b_frac))
@@ -1586,7 +2976,7 @@ impl Evaluator {
             BinOp::Modulo => match (left, right) {
                 (Value::Number(a), Value::Number(b)) => {
                     if *b == 0.0 {
-                        Err(RuntimeError::DivisionByZero)
+                        self.zero_divisor_result(a % b)
                     } else {
                         Ok(Value::Number(a % b))
                     }
@@ -1678,23 +3068,37 @@ impl Evaluator {
         func: &Value,
         args: Vec<Value>,
     ) -> EvalResult {
+        // Builtin values may outlive the binding of a disabled builtin (e.g. aliases)
+        if self.builtins_restricted
+            && let Value::BuiltIn { name, .. } = func
+            && !self.registry.has(name)
+            && self.host_function(name).is_none()
+        {
+            return Err(RuntimeError::NotCallable(format!(
+                "{} (builtin disabled)",
+                name
+            )));
+        }
+
         // Check recursion depth limit
         self.enter_call()?;
 
-        let frame = match func {
+        let (frame_name, signature) = match func {
             Value::Function { name, params, .. } => {
                 let display_name = name_hint
                     .map(|s| s.to_string())
                     .or_else(|| name.clone())
                     .unwrap_or_else(|| "<lambda>".to_string());
                 let signature = format!("{}({})", display_name, params.join(", "));
-                CallFrame {
-                    name: display_name.clone(),
-                    signature,
-                }
+                (display_name, signature)
             }
             Value::BuiltIn { name, .. } => {
-                let arity = self.registry.get(name).map(|(_, a)| a).unwrap_or(0);
+                let arity = self
+                    .registry
+                    .get(name)
+                    .map(|(_, a)| a)
+                    .or_else(|| self.host_function(name).map(|f| f.arity()))
+                    .unwrap_or(0);
                 let params = if arity == 0 {
                     String::new()
                 } else {
@@ -1704,18 +3108,28 @@ impl Evaluator {
                         .join(", ")
                 };
                 let signature = format!("{}({})", name, params);
-                CallFrame {
-                    name: name.clone(),
-                    signature,
-                }
+                (name.clone(), signature)
             }
             other => {
                 let name = name_hint.unwrap_or("<call>").to_string();
                 let signature = format!("{}(<{}>)", name, other.type_name());
-                CallFrame { name, signature }
+                (name, signature)
             }
         };
+        // Only calls made directly by a top-level statement have a known site
+        let site = self.call_site.filter(|_| self.call_stack.is_empty());
+        let frame = CallFrame {
+            name: frame_name,
+            signature,
+            line: site.map_or(0, |p| p.line),
+            column: site.map_or(0, |p| p.column),
+        };
 
+        if let Some(hook) = &self.call_hook
+            && matches!(func, Value::Function { .. } | Value::BuiltIn { .. })
+        {
+            hook(&frame.name, &args);
+        }
         self.call_stack.push(frame);
 
         match func {
@@ -1733,6 +3147,35 @@ impl Evaluator {
                     return Err(err);
                 }
 
+                // A function that is already running must not be entered again
+                let active = if self.no_recursion {
+                    let active = ActiveFunction::of(func);
+                    if active
+                        .as_ref()
+                        .is_some_and(|f| self.active_functions.contains(f))
+                    {
+                        let function = self
+                            .call_stack
+                            .last()
+                            .map(|frame| frame.name.clone())
+                            .unwrap_or_default();
+                        let err = RuntimeError::ExecutionLimit(
+                            crate::runtime::ExecutionLimitError::RecursionForbidden { function },
+                        );
+                        let err = self.attach_call_stack_if_absent(err);
+                        let _ = self.call_stack.pop();
+                        self.exit_call();
+                        return Err(err);
+                    }
+                    active
+                } else {
+                    None
+                };
+                let tracked = active.is_some();
+                if let Some(active) = active {
+                    self.active_functions.push(active);
+                }
+
                 // Create new environment for function execution
                 let func_env = Rc::new(RefCell::new(Environment::with_parent(Rc::clone(env))));
 
@@ -1755,6 +3198,9 @@ impl Evaluator {
                         }
                         Err(e) => {
                             self.env = prev_env;
+                            if tracked {
+                                self.active_functions.pop();
+                            }
                             let e = self.attach_call_stack_if_absent(e);
                             let _ = self.call_stack.pop();
                             self.exit_call();
@@ -1764,6 +3210,9 @@ impl Evaluator {
                 }
 
                 self.env = prev_env;
+                if tracked {
+                    self.active_functions.pop();
+                }
                 let _ = self.call_stack.pop();
                 self.exit_call();
                 Ok(result)
@@ -1862,14 +3311,124 @@ impl Evaluator {
 
                         Ok(Value::Null)
                     }
+                    "PRINT" | "PRINTLN" if self.no_output => {
+                        Err(RuntimeError::OutputError(format!(
+                            "{} is not allowed: output is disabled for this engine",
+                            name
+                        )))
+                    }
+                    "PRINT" | "PRINTLN"
+                        if self.output_capture.is_some()
+                            || self.output_writer.is_some()
+                            || self.custom_print_format()
+                            || self.sorted_map_keys
+                            || self.locale.is_some()
+                            || self.max_output_bytes.is_some() =>
+                    {
+                        let mut text = args
+                            .iter()
+                            .map(|v| self.display_string(v))
+                            .collect::<Vec<_>>()
+                            .join(&self.print_separator);
+                        if name == "PRINTLN" {
+                            text.push_str(&self.print_terminator);
+                        }
+
+                        if let Err(e) = self.charge_output(text.len()) {
+                            Err(e)
+                        } else if let Some(capture) = self.output_capture.as_mut() {
+                            capture.write(&text);
+                            Ok(Value::Null)
+                        } else if let Some(writer) = self.output_writer.as_mut() {
+                            writer
+                                .write_all(text.as_bytes())
+                                .and_then(|_| writer.flush())
+                                .map(|_| Value::Null)
+                                .map_err(|e| RuntimeError::OutputError(e.to_string()))
+                        } else {
+                            use std::io::Write;
+                            let mut stdout = std::io::stdout();
+                            stdout
+                                .write_all(text.as_bytes())
+                                .and_then(|_| stdout.flush())
+                                .map(|_| Value::Null)
+                                .map_err(|e| RuntimeError::OutputError(e.to_string()))
+                        }
+                    }
+                    "RANDOM" => {
+                        if args.is_empty() {
+                            Ok(Value::Number(self.rng.next_f64()))
+                        } else {
+                            Err(RuntimeError::WrongArity {
+                                expected: 0,
+                                got: args.len(),
+                            })
+                        }
+                    }
+                    "RANDOM_INT" => match args.as_slice() {
+                        [min, max] => {
+                            let as_int = |v: &Value| match v {
+                                Value::Number(n) => crate::runtime::numeric::as_exact_i64(*n),
+                                _ => None,
+                            };
+                            match (as_int(min), as_int(max)) {
+                                (Some(lo), Some(hi)) if lo <= hi => {
+                                    Ok(Value::Number(self.rng.range_i64(lo, hi) as f64))
+                                }
+                                (Some(lo), Some(hi)) => Err(RuntimeError::InvalidOperation(
+                                    format!("RANDOM_INT: min {} is greater than max {}", lo, hi),
+                                )),
+                                _ => Err(RuntimeError::TypeErrorDetailed {
+                                    expected: "Integer, Integer".to_string(),
+                                    got: format!("{}, {}", min.type_name(), max.type_name()),
+                                }),
+                            }
+                        }
+                        _ => Err(RuntimeError::WrongArity {
+                            expected: 2,
+                            got: args.len(),
+                        }),
+                    },
+                    "NOW" => {
+                        if args.is_empty() {
+                            let now = self.clock.unwrap_or_else(std::time::SystemTime::now);
+                            Ok(Value::from_system_time(now))
+                        } else {
+                            Err(RuntimeError::WrongArity {
+                                expected: 0,
+                                got: args.len(),
+                            })
+                        }
+                    }
+                    "SORT" if args.len() == 2 => self.builtin_sort_with(&args),
                     "MAP" => self.builtin_map(&args),
                     "FILTER" => self.builtin_filter(&args),
                     "REDUCE" => self.builtin_reduce(&args),
+                    file_builtin
+                        if crate::builtins::FILESYSTEM_FUNCTIONS.contains(&file_builtin)
+                            && self.file_system.is_some() =>
+                    {
+                        let file_system = self.file_system.as_deref().unwrap();
+                        crate::runtime::file_system::call(file_system, file_builtin, &args)
+                    }
                     _ => {
                         // Get the built-in function from the registry
                         if let Some((func, _arity)) = self.registry.get(name) {
                             // Call the built-in function
                             func(&args)
+                        } else if let Some(host) = self.host_function(name) {
+                            if args.len() != host.arity() {
+                                Err(RuntimeError::WrongArity {
+                                    expected: host.arity(),
+                                    got: args.len(),
+                                })
+                            } else {
+                                if !self.called_hosts.iter().any(|h| h == name) {
+                                    self.called_hosts.push(name.clone());
+                                }
+                                host.call_with_context(&self.host_context(), &args)
+                                    .map_err(RuntimeError::CustomError)
+                            }
                         } else {
                             Err(RuntimeError::NotCallable(format!(
                                 "Built-in function '{}' not found",
@@ -1879,6 +3438,9 @@ impl Evaluator {
                     }
                 };
 
+                // Arrays built or grown by builtins (PUSH, RANGE, MAP, ...) count too
+                let res = res.and_then(|v| self.check_array_length(&v).map(|_| v));
+
                 let _ = self.call_stack.pop();
                 self.exit_call();
                 match res {
@@ -2016,6 +3578,79 @@ impl Evaluator {
 
         Ok(accumulator)
     }
+
+    // 实现 SORT(array, compare)：按比较函数排序
+    //
+    // 比较函数可以是函数值，也可以是脚本函数或宿主函数的名称字符串；
+    // 它接收两个元素，返回负数、0 或正数。排序是稳定的。
+    fn builtin_sort_with(&mut self, args: &[Value]) -> EvalResult {
+        let arr = match &args[0] {
+            Value::Array(a) => a.clone(),
+            other => {
+                return Err(RuntimeError::TypeErrorDetailed {
+                    expected: "Array".to_string(),
+                    got: format!("{:?}", other),
+                });
+            }
+        };
+
+        let func = match &args[1] {
+            Value::String(name) => {
+                let found = self.env.borrow().get(name);
+                found
+                    .or_else(|| {
+                        self.host_function(name).map(|f| Value::BuiltIn {
+                            name: name.clone(),
+                            arity: f.arity(),
+                        })
+                    })
+                    .ok_or_else(|| self.undefined_variable(name))?
+            }
+            other => other.clone(),
+        };
+
+        self.merge_sort_with(arr, &func).map(Value::Array)
+    }
+
+    /// Stable merge sort driven by a script comparator (errors abort the sort)
+    fn merge_sort_with(
+        &mut self,
+        mut items: Vec<Value>,
+        func: &Value,
+    ) -> Result<Vec<Value>, RuntimeError> {
+        if items.len() <= 1 {
+            return Ok(items);
+        }
+        let right = items.split_off(items.len() / 2);
+        let left = self.merge_sort_with(items, func)?;
+        let right = self.merge_sort_with(right, func)?;
+
+        let mut merged = Vec::with_capacity(left.len() + right.len());
+        let mut left = left.into_iter().peekable();
+        let mut right = right.into_iter().peekable();
+        while let (Some(a), Some(b)) = (left.peek(), right.peek()) {
+            let order = self.call_function(None, func, vec![a.clone(), b.clone()])?;
+            // Take from the right only when it is strictly smaller, so equal elements keep their order
+            let right_first = match order {
+                Value::Number(n) => n > 0.0,
+                other => {
+                    return Err(RuntimeError::TypeErrorDetailed {
+                        expected: "Number from SORT comparator".to_string(),
+                        got: other.type_name().to_string(),
+                    });
+                }
+            };
+            let next = if right_first {
+                right.next()
+            } else {
+                left.next()
+            };
+            merged.extend(next);
+        }
+        merged.extend(left);
+        merged.extend(right);
+        Ok(merged)
+    }
 }
 
 impl Evaluator {
@@ -2045,6 +3680,11 @@ impl Evaluator {
     ) -> EvalResult {
         let from_ctx = self.current_import_context();
 
+        if self.registered_modules.contains_key(specifier) {
+            let exports = self.load_registered_module(specifier)?;
+            return self.bind_imports(specifier, exports, names, aliases, namespace);
+        }
+
         let chain_for_resolve = self.import_chain_with(specifier.to_string());
 
         let resolved = self
@@ -2058,8 +3698,19 @@ impl Evaluator {
                 )))
             })?;
 
-        let exports = self.load_module(resolved)?;
+        let exports = self.load_module(resolved, false)?;
+        self.bind_imports(specifier, exports, names, aliases, namespace)
+    }
 
+    /// Bind a loaded module's exports as requested by an `Import` statement
+    fn bind_imports(
+        &mut self,
+        specifier: &str,
+        exports: HashMap<String, Value>,
+        names: &[String],
+        aliases: &[Option<String>],
+        namespace: Option<&String>,
+    ) -> EvalResult {
         if let Some(ns) = namespace {
             self.env.borrow_mut().set(ns.clone(), Value::Dict(exports));
             return Ok(Value::Null);
@@ -2096,9 +3747,26 @@ impl Evaluator {
         Ok(Value::Null)
     }
 
+    /// Load a module registered with `register_module`, exporting every top-level definition
+    fn load_registered_module(
+        &mut self,
+        name: &str,
+    ) -> Result<HashMap<String, Value>, RuntimeError> {
+        let source = self.registered_modules[name].clone();
+        self.load_module(
+            ResolvedModule {
+                module_id: name.to_string(),
+                source,
+                base_dir: None,
+            },
+            true,
+        )
+    }
+
     fn load_module(
         &mut self,
         resolved: ResolvedModule,
+        export_all: bool,
     ) -> Result<HashMap<String, Value>, RuntimeError> {
         let import_chain = self.import_chain_with(resolved.module_id.clone());
 
@@ -2119,7 +3787,7 @@ impl Evaluator {
         self.module_stack.push(resolved.module_id.clone());
 
         // Parse module
-        let mut parser = crate::parser::Parser::new(&resolved.source);
+        let mut parser = self.module_parser(&resolved.source);
         let program = match parser.parse_program() {
             Ok(p) => p,
             Err(e) => {
@@ -2134,7 +3802,7 @@ impl Evaluator {
         let prev_env = Rc::clone(&self.env);
         let module_env = Rc::new(RefCell::new(Environment::new()));
         Self::register_builtins_into_env(&self.registry, &mut module_env.borrow_mut());
-        self.env = module_env;
+        self.env = Rc::clone(&module_env);
 
         // Push module import base (for relative imports inside the module)
         self.import_base_stack.push(ModuleContext {
@@ -2148,7 +3816,18 @@ impl Evaluator {
         let eval_res = self.eval_program(&program);
 
         // Pop stacks and restore env (must happen even on error)
-        let exports = self.export_stack.pop().unwrap_or_default();
+        let mut exports = self.export_stack.pop().unwrap_or_default();
+        if export_all {
+            let env = module_env.borrow();
+            for name in env.keys() {
+                match env.get(&name) {
+                    Some(Value::BuiltIn { .. }) | None => {}
+                    Some(value) => {
+                        exports.entry(name).or_insert(value);
+                    }
+                }
+            }
+        }
         self.import_base_stack.pop();
         self.env = prev_env;
 
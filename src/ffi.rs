@@ -2,12 +2,19 @@
 //!
 //! This module provides C-compatible functions for use with other languages
 //! through Foreign Function Interface (FFI).
+//!
+//! Unwinding across an `extern "C"` boundary is undefined behavior, so every
+//! entry point runs its body under `catch_unwind`: a panic inside the engine
+//! is reported as `AetherErrorCode::Panic` (or a null pointer for
+//! constructors) and the handle stays usable.
 
 use std::ffi::{CStr, CString};
-use std::os::raw::{c_char, c_int};
+use std::os::raw::{c_char, c_int, c_void};
 use std::panic;
 use std::sync::Mutex;
 
+use crate::api::ErrorKind;
+use crate::runtime::{JsonValue, LimitKind, SortedJsonValue, StateChange};
 use crate::{Aether, Value};
 use serde_json::json;
 
@@ -27,6 +34,8 @@ pub enum AetherErrorCode {
     Panic = 4,
     InvalidJSON = 5,
     VariableNotFound = 6,
+    InvalidArgument = 7,
+    NoValue = 8,
 }
 
 /// Execution limits configuration
@@ -45,6 +54,155 @@ pub struct AetherCacheStats {
     pub size: c_int,
 }
 
+/// Resource usage of a single evaluation
+///
+/// Counted the same way as the corresponding execution limits; values that do
+/// not fit in an `int` are clamped to `INT_MAX`.
+#[repr(C)]
+pub struct AetherEvalStats {
+    pub steps: c_int,
+    pub peak_call_depth: c_int,
+    pub peak_array_length: c_int,
+}
+
+/// IO permission state of an engine
+#[repr(C)]
+pub struct AetherPermissions {
+    pub filesystem_enabled: c_int,
+    pub network_enabled: c_int,
+}
+
+/// Opaque handle that interrupts an engine's evaluation from any thread
+#[repr(C)]
+pub struct AetherInterrupt {
+    _opaque: [u8; 0],
+}
+
+/// Opaque handle for a shared host function registry
+#[repr(C)]
+pub struct AetherRegistry {
+    _opaque: [u8; 0],
+}
+
+/// Opaque handle for read-only data shared by several engines (see `aether_shared_data_new`)
+#[repr(C)]
+pub struct AetherSharedData {
+    _opaque: [u8; 0],
+}
+
+/// Opaque handle for a reusable batch of variable assignments (see `aether_var_batch_new`)
+#[repr(C)]
+pub struct AetherVarBatch {
+    _opaque: [u8; 0],
+}
+
+/// Opaque handle for a script function value (see `aether_eval_function`)
+#[repr(C)]
+pub struct AetherFunction {
+    _opaque: [u8; 0],
+}
+
+/// Host function callback
+///
+/// Receives `user_data` and the call arguments as a JSON array, and returns the
+/// JSON-encoded result. On failure, set `*is_error` to non-zero and return the
+/// error message instead. The returned string must be allocated with `malloc`;
+/// the engine releases it with `free`. Returning NULL yields `null` (or a generic
+/// error message when `*is_error` is set).
+///
+/// The callback may be invoked from any thread that evaluates code.
+pub type AetherHostCallback = Option<
+    unsafe extern "C" fn(
+        user_data: *mut c_void,
+        args_json: *const c_char,
+        is_error: *mut c_int,
+    ) -> *mut c_char,
+>;
+
+/// Context-aware host function callback
+///
+/// Same contract as `AetherHostCallback`, but additionally receives the
+/// `context` pointer passed to `aether_eval_with_context` (NULL when the code
+/// was evaluated without a context).
+pub type AetherHostContextCallback = Option<
+    unsafe extern "C" fn(
+        user_data: *mut c_void,
+        context: *mut c_void,
+        args_json: *const c_char,
+        is_error: *mut c_int,
+    ) -> *mut c_char,
+>;
+
+/// Output callback
+///
+/// Receives `user_data` and a chunk of PRINT/PRINTLN output (`len` bytes, not
+/// NUL-terminated). Return 0 to accept the chunk; any other value rejects it and
+/// aborts the running evaluation with an output error.
+pub type AetherOutputCallback =
+    Option<unsafe extern "C" fn(user_data: *mut c_void, data: *const c_char, len: usize) -> c_int>;
+
+/// File read callback
+///
+/// Receives `user_data` and the path passed to `READ_FILE`, and returns the file
+/// content. On failure (e.g. the file does not exist), set `*is_error` to
+/// non-zero and return the error message instead. The returned string must be
+/// allocated with `malloc`; the engine releases it with `free`.
+pub type AetherReadFileCallback = Option<
+    unsafe extern "C" fn(
+        user_data: *mut c_void,
+        path: *const c_char,
+        is_error: *mut c_int,
+    ) -> *mut c_char,
+>;
+
+/// File write callback
+///
+/// Receives `user_data`, the path and the full new content of the file.
+/// Return 0 on success; any other value fails the write with a runtime error.
+pub type AetherWriteFileCallback = Option<
+    unsafe extern "C" fn(
+        user_data: *mut c_void,
+        path: *const c_char,
+        content: *const c_char,
+    ) -> c_int,
+>;
+
+/// Limit warning callback
+///
+/// Receives `user_data`, the limit kind (`"steps"`, `"recursion_depth"`,
+/// `"duration_ms"` or `"array_length"`, a static string), the current usage and
+/// the configured limit. Called on the evaluating thread; it cannot stop the
+/// evaluation.
+pub type AetherLimitWarningCallback = Option<
+    unsafe extern "C" fn(user_data: *mut c_void, kind: *const c_char, used: u64, limit: u64),
+>;
+
+/// Progress callback
+///
+/// Receives `user_data` and the number of steps executed so far in the current
+/// evaluation. Called on the evaluating thread; call `aether_interrupt` on an
+/// interrupt handle to stop the evaluation.
+pub type AetherProgressCallback = Option<unsafe extern "C" fn(user_data: *mut c_void, steps: u64)>;
+
+/// Call hook callback
+///
+/// Receives `user_data`, the name of the function being called (`"<lambda>"`
+/// for anonymous functions) and its arguments as a JSON array. Both strings
+/// are only valid during the call. Called on the evaluating thread before
+/// each user-function, builtin and host-function call.
+pub type AetherCallHookCallback = Option<
+    unsafe extern "C" fn(user_data: *mut c_void, name: *const c_char, args_json: *const c_char),
+>;
+
+/// Per-element result callback
+///
+/// Receives `user_data`, the element index and the element encoded as JSON
+/// (only valid during the call). Return 0 to continue; any other value stops
+/// the iteration.
+pub type AetherForEachCallback = Option<
+    unsafe extern "C" fn(user_data: *mut c_void, index: usize, value_json: *const c_char) -> c_int,
+>;
+
 /// Thread-safe wrapper for Aether engine
 struct ThreadSafeEngine {
     #[allow(dead_code)]
@@ -65,20 +223,43 @@ impl ThreadSafeEngine {
 
 /// Create a new Aether engine instance
 ///
-/// Returns: Pointer to AetherHandle (must be freed with aether_free)
+/// Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+/// if construction panicked
 #[unsafe(no_mangle)]
 pub extern "C" fn aether_new() -> *mut AetherHandle {
-    let engine = Box::new(Aether::new());
-    Box::into_raw(engine) as *mut AetherHandle
+    match panic::catch_unwind(Aether::new) {
+        Ok(engine) => Box::into_raw(Box::new(engine)) as *mut AetherHandle,
+        Err(_) => std::ptr::null_mut(),
+    }
 }
 
 /// Create a new Aether engine with all IO permissions enabled
 ///
-/// Returns: Pointer to AetherHandle (must be freed with aether_free)
+/// Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+/// if construction panicked
 #[unsafe(no_mangle)]
 pub extern "C" fn aether_new_with_permissions() -> *mut AetherHandle {
-    let engine = Box::new(Aether::with_all_permissions());
-    Box::into_raw(engine) as *mut AetherHandle
+    match panic::catch_unwind(Aether::with_all_permissions) {
+        Ok(engine) => Box::into_raw(Box::new(engine)) as *mut AetherHandle,
+        Err(_) => std::ptr::null_mut(),
+    }
+}
+
+/// Create a new Aether engine configured for untrusted scripts
+///
+/// Applies the same bundle as `Aether::with_safe_defaults`: no IO permissions,
+/// at most 100,000 steps, recursion depth 100, 5 seconds of execution time,
+/// a 1 MiB cap on the top-level result, at most 100,000 elements per array
+/// and at most 256 levels of parser nesting.
+///
+/// Returns: Pointer to AetherHandle (must be freed with aether_free), or null
+/// if construction panicked
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_new_safe() -> *mut AetherHandle {
+    match panic::catch_unwind(Aether::with_safe_defaults) {
+        Ok(engine) => Box::into_raw(Box::new(engine)) as *mut AetherHandle,
+        Err(_) => std::ptr::null_mut(),
+    }
 }
 
 /// Evaluate Aether code
@@ -91,7 +272,9 @@ pub extern "C" fn aether_new_with_permissions() -> *mut AetherHandle {
 ///
 /// # Returns
 /// - 0 (Success) if evaluation succeeded
-/// - Non-zero error code if evaluation failed
+/// - ParseError (1) or RuntimeError (2) if evaluation failed, decided by the kind
+///   of error rather than its message
+/// - InvalidArgument (7) if `code` is not valid UTF-8
 #[unsafe(no_mangle)]
 pub extern "C" fn aether_eval(
     handle: *mut AetherHandle,
@@ -104,373 +287,5238 @@ pub extern "C" fn aether_eval(
         return AetherErrorCode::NullPointer as c_int;
     }
 
-    // Catch panics and convert them to errors
-    let panic_result = panic::catch_unwind(|| unsafe {
-        let engine = &mut *(handle as *mut Aether);
-        let code_str = match CStr::from_ptr(code).to_str() {
-            Ok(s) => s,
-            Err(_) => return AetherErrorCode::RuntimeError as c_int,
-        };
-
-        match engine.eval(code_str) {
-            Ok(val) => {
-                let result_str = value_to_string(&val);
-                match CString::new(result_str) {
-                    Ok(cstr) => {
-                        *result = cstr.into_raw();
-                        *error = std::ptr::null_mut();
-                        AetherErrorCode::Success as c_int
-                    }
-                    Err(_) => AetherErrorCode::RuntimeError as c_int,
-                }
-            }
-            Err(e) => {
-                let error_str = e.to_string();
-                match CString::new(error_str) {
-                    Ok(cstr) => {
-                        *error = cstr.into_raw();
-                        *result = std::ptr::null_mut();
-                        // Determine error type from message
-                        if e.contains("Parse error") {
-                            AetherErrorCode::ParseError as c_int
-                        } else {
-                            AetherErrorCode::RuntimeError as c_int
-                        }
-                    }
-                    Err(_) => AetherErrorCode::RuntimeError as c_int,
-                }
-            }
-        }
-    });
-
-    match panic_result {
-        Ok(code) => code,
-        Err(_) => {
-            unsafe {
-                let panic_msg = CString::new("Panic occurred during evaluation").unwrap();
-                *error = panic_msg.into_raw();
-                *result = std::ptr::null_mut();
-            }
-            AetherErrorCode::Panic as c_int
-        }
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let value = engine.eval(code)?;
+                set_result(engine, &value, result)
+            },
+        )
     }
 }
 
-/// Get the version string of Aether
-///
-/// Returns: C string with version (must NOT be freed)
-#[unsafe(no_mangle)]
-pub extern "C" fn aether_version() -> *const c_char {
-    static VERSION: &str = concat!(env!("CARGO_PKG_VERSION"), "\0");
-    VERSION.as_ptr() as *const c_char
+/// Failure of an eval-style entry point (see `run_eval`)
+enum EvalError {
+    /// Error message returned by the engine; the status code follows the kind
+    /// of error the engine recorded
+    Engine(String),
+    /// Failure detected by the entry point itself, with a fixed status code
+    Status(AetherErrorCode, String),
 }
 
-/// Free an Aether engine handle
-#[unsafe(no_mangle)]
-pub extern "C" fn aether_free(handle: *mut AetherHandle) {
-    if !handle.is_null() {
-        unsafe {
-            let _ = Box::from_raw(handle as *mut Aether);
-        }
+impl From<String> for EvalError {
+    fn from(message: String) -> Self {
+        EvalError::Engine(message)
     }
 }
 
-/// Free a string allocated by Aether
-#[unsafe(no_mangle)]
-pub extern "C" fn aether_free_string(s: *mut c_char) {
-    #![allow(clippy::not_unsafe_ptr_arg_deref)]
-    if !s.is_null() {
-        unsafe {
-            let _ = CString::from_raw(s);
-        }
-    }
-}
+/// Shared marshaling for the eval-style entry points
+///
+/// Decodes `code` as UTF-8 and runs `body` under `catch_unwind`. `*error` is
+/// cleared first and receives the message when `body` fails. For engine errors
+/// the status code comes from the kind of error the engine recorded (see
+/// `error_code`), not from the message text, so it is unaffected by custom
+/// error formatters. Code that is not valid UTF-8 is `InvalidArgument` and a
+/// panic is `Panic`.
+///
+/// Callers check their pointers for null and reset their other output
+/// parameters beforehand, since `body` may fail before writing them.
+unsafe fn run_eval(
+    handle: *mut AetherHandle,
+    code: &[u8],
+    error: *mut *mut c_char,
+    body: impl FnOnce(&mut Aether, &str) -> Result<(), EvalError>,
+) -> c_int {
+    let panic_result = panic::catch_unwind(panic::AssertUnwindSafe(|| unsafe {
+        *error = std::ptr::null_mut();
+        let engine = &mut *(handle as *mut Aether);
+        let Ok(code) = std::str::from_utf8(code) else {
+            set_error(error, "Code is not valid UTF-8".to_string());
+            return AetherErrorCode::InvalidArgument as c_int;
+        };
 
-/// Helper function to convert Value to string representation
-fn value_to_string(value: &Value) -> String {
-    match value {
-        Value::Number(n) => {
-            // Format number nicely - remove trailing zeros
-            if n.fract() == 0.0 {
-                format!("{:.0}", n)
-            } else {
-                n.to_string()
+        engine.clear_error_kind();
+        match body(engine, code) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(EvalError::Engine(message)) => {
+                set_error(error, message);
+                error_code(engine, AetherErrorCode::RuntimeError) as c_int
+            }
+            Err(EvalError::Status(status, message)) => {
+                set_error(error, message);
+                status as c_int
             }
         }
-        Value::String(s) => s.clone(),
-        Value::Boolean(b) => b.to_string(),
-        Value::Array(arr) => {
-            let items: Vec<String> = arr.iter().map(value_to_string).collect();
-            format!("[{}]", items.join(", "))
-        }
-        Value::Dict(map) => {
-            let items: Vec<String> = map
-                .iter()
-                .map(|(k, v)| format!("{}: {}", k, value_to_string(v)))
-                .collect();
-            format!("{{{}}}", items.join(", "))
-        }
-        Value::Null => "null".to_string(),
-        Value::Function { .. } => "<function>".to_string(),
-        Value::BuiltIn { name, .. } => format!("<builtin: {}>", name),
-        Value::Generator { .. } => "<generator>".to_string(),
-        Value::Lazy { .. } => "<lazy>".to_string(),
-        Value::Fraction(f) => f.to_string(),
-    }
+    }));
+
+    panic_result.unwrap_or_else(|_| {
+        unsafe { set_error(error, "Panic occurred during evaluation".to_string()) };
+        AetherErrorCode::Panic as c_int
+    })
 }
 
-/// Helper function to convert Value to JSON string
-fn value_to_json(value: &Value) -> String {
-    match value {
-        Value::Number(n) => {
-            // 直接返回数字的 JSON 表示
-            json!(n).to_string()
-        }
-        Value::String(s) => json!(s).to_string(),
-        Value::Boolean(b) => json!(b).to_string(),
-        Value::Array(arr) => {
-            let items: Vec<serde_json::Value> = arr.iter().map(json_from_value).collect();
-            json!(items).to_string()
-        }
-        Value::Dict(map) => {
-            let mut obj = serde_json::Map::new();
-            for (k, v) in map {
-                obj.insert(k.clone(), json_from_value(v));
-            }
-            json!(obj).to_string()
-        }
-        Value::Null => "null".to_string(),
-        Value::Function { .. } => json!("<function>").to_string(),
-        Value::BuiltIn { name, .. } => json!(format!("<builtin: {}>", name)).to_string(),
-        Value::Generator { .. } => json!("<generator>").to_string(),
-        Value::Lazy { .. } => json!("<lazy>").to_string(),
-        Value::Fraction(f) => json!(f.to_string()).to_string(),
+/// Status code for a failed engine call, from the kind of error the engine
+/// recorded since `clear_error_kind`; `other` covers failures that are neither
+/// parse nor runtime errors (e.g. an invalid argument)
+fn error_code(engine: &Aether, other: AetherErrorCode) -> AetherErrorCode {
+    match engine.last_error_kind() {
+        Some(ErrorKind::Parse) => AetherErrorCode::ParseError,
+        Some(ErrorKind::NoValue) => AetherErrorCode::NoValue,
+        Some(ErrorKind::Runtime) => AetherErrorCode::RuntimeError,
+        None => other,
     }
 }
 
-/// Helper function to convert Value to serde_json::Value
-fn json_from_value(value: &Value) -> serde_json::Value {
-    match value {
-        Value::Number(n) => json!(n),
-        Value::String(s) => json!(s),
-        Value::Boolean(b) => json!(b),
-        Value::Array(arr) => {
-            let items: Vec<serde_json::Value> = arr.iter().map(json_from_value).collect();
-            json!(items)
-        }
-        Value::Dict(map) => {
-            let mut obj = serde_json::Map::new();
-            for (k, v) in map {
-                obj.insert(k.clone(), json_from_value(v));
-            }
-            json!(obj)
-        }
-        Value::Null => json!(null),
-        Value::Function { .. } => json!("<function>"),
-        Value::BuiltIn { name, .. } => json!(format!("<builtin: {}>", name)),
-        Value::Generator { .. } => json!("<generator>"),
-        Value::Lazy { .. } => json!("<lazy>"),
-        Value::Fraction(f) => json!(f.to_string()),
+/// Store `message` in `*error`, dropping any NUL bytes
+unsafe fn set_error(error: *mut *mut c_char, message: String) {
+    if let Ok(cstr) = CString::new(message.replace('\0', "")) {
+        unsafe { *error = cstr.into_raw() };
     }
 }
 
-/// Helper function to parse JSON to Value
-fn json_to_value(json_str: &str) -> Result<Value, String> {
-    let v: serde_json::Value =
-        serde_json::from_str(json_str).map_err(|e| format!("Invalid JSON: {}", e))?;
-
-    Ok(match v {
-        serde_json::Value::Number(n) => {
-            if n.is_i64() {
-                Value::Number(n.as_i64().unwrap() as f64)
-            } else {
-                Value::Number(n.as_f64().unwrap())
-            }
-        }
-        serde_json::Value::String(s) => Value::String(s),
-        serde_json::Value::Bool(b) => Value::Boolean(b),
-        serde_json::Value::Array(arr) => {
-            let items: Result<Vec<_>, _> =
-                arr.iter().map(|v| json_to_value(&v.to_string())).collect();
-            Value::Array(items?)
-        }
-        serde_json::Value::Object(obj) => {
-            let mut map = std::collections::HashMap::new();
-            for (k, v) in obj {
-                map.insert(k, json_to_value(&v.to_string())?);
-            }
-            Value::Dict(map)
-        }
-        serde_json::Value::Null => Value::Null,
-    })
+/// Store `text` in `*out` as a newly allocated C string
+unsafe fn set_string(out: *mut *mut c_char, text: String) -> Result<(), EvalError> {
+    let cstr = CString::new(text).map_err(|_| {
+        EvalError::Status(
+            AetherErrorCode::RuntimeError,
+            "Result contains a NUL byte".to_string(),
+        )
+    })?;
+    unsafe { *out = cstr.into_raw() };
+    Ok(())
 }
 
-// ============================================================
-// Variable Operations
-// ============================================================
+/// Store an evaluation result in `*result` as text
+unsafe fn set_result(
+    engine: &Aether,
+    value: &Value,
+    result: *mut *mut c_char,
+) -> Result<(), EvalError> {
+    unsafe { set_string(result, value_to_string(value, engine.sorted_map_keys())) }
+}
 
-/// Set a global variable from host application
+/// Evaluate Aether code and capture everything it prints
+///
+/// `PRINT`/`PRINTLN` output is captured in memory instead of being written to
+/// stdout, and returned as a JSON array of lines. The output is returned even
+/// when evaluation fails, so hosts can show partial progress.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - name: Variable name
-/// - value_json: Variable value as JSON string
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - output_json: Output parameter for printed lines as JSON array (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
 ///
 /// # Returns
-/// - 0 (Success) if variable was set
-/// - Non-zero error code if failed
-///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `name` must be a valid pointer to a null-terminated C string
-/// - `value_json` must be a valid pointer to a null-terminated C string
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_set_global(
+pub extern "C" fn aether_eval_verbose(
     handle: *mut AetherHandle,
-    name: *const c_char,
-    value_json: *const c_char,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    output_json: *mut *mut c_char,
+    error: *mut *mut c_char,
 ) -> c_int {
-    if handle.is_null() || name.is_null() || value_json.is_null() {
-        return AetherErrorCode::NullPointer as c_int;
-    }
-
-    let panic_result = panic::catch_unwind(|| unsafe {
-        let engine = &mut *(handle as *mut Aether);
-        let name_str = match CStr::from_ptr(name).to_str() {
-            Ok(s) => s,
-            Err(_) => return AetherErrorCode::RuntimeError as c_int,
-        };
-        let json_str = match CStr::from_ptr(value_json).to_str() {
-            Ok(s) => s,
-            Err(_) => return AetherErrorCode::RuntimeError as c_int,
-        };
-
-        // Parse JSON to Value
-        let value = match json_to_value(json_str) {
-            Ok(v) => v,
-            Err(_) => return AetherErrorCode::InvalidJSON as c_int,
-        };
-
-        engine.set_global(name_str, value);
-        AetherErrorCode::Success as c_int
-    });
-
-    match panic_result {
-        Ok(code) => code,
-        Err(_) => AetherErrorCode::Panic as c_int,
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe {
+        eval_capturing(handle, code, result, output_json, error, |engine, code| {
+            let (result, output) = engine.eval_verbose(code);
+            (result, json!(output))
+        })
     }
 }
 
-/// Get a variable's value as JSON
+/// Evaluate Aether code and return only the last `n` lines it printed
+///
+/// Like `aether_eval_verbose`, but the engine keeps just the most recent `n`
+/// lines in a ring buffer, so a script that prints a lot does not grow the
+/// captured output without bound.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - name: Variable name
-/// - value_json: Output parameter (must be freed with aether_free_string)
+/// - code: C string containing Aether code
+/// - n: Number of printed lines to keep
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - output_json: Output parameter for the last printed lines as JSON array (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_tail(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    n: usize,
+    result: *mut *mut c_char,
+    output_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe {
+        eval_capturing(handle, code, result, output_json, error, |engine, code| {
+            let (result, output) = engine.eval_tail(code, n);
+            (result, json!(output))
+        })
+    }
+}
+
+/// Evaluate Aether code and report the global variables it changed
+///
+/// `changes_json` receives a JSON array sorted by variable name, with one
+/// entry per added, removed or changed global, e.g.
+/// `{"name": "X", "kind": "changed", "before": 1, "after": 2}`. Added and
+/// removed entries carry a single `value`. Changes are reported even when
+/// evaluation fails.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - changes_json: Output parameter for the changes as JSON array (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_diff(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    changes_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe {
+        eval_capturing(handle, code, result, changes_json, error, |engine, code| {
+            let (result, changes) = engine.eval_diff(code);
+            let changes = changes
+                .iter()
+                .map(|change| match change {
+                    StateChange::Added { value, .. } | StateChange::Removed { value, .. } => {
+                        json!({
+                            "name": change.name(),
+                            "kind": change.kind(),
+                            "value": json_from_value(value),
+                        })
+                    }
+                    StateChange::Changed { before, after, .. } => json!({
+                        "name": change.name(),
+                        "kind": change.kind(),
+                        "before": json_from_value(before),
+                        "after": json_from_value(after),
+                    }),
+                })
+                .collect();
+            (result, serde_json::Value::Array(changes))
+        })
+    }
+}
+
+/// Shared implementation of `aether_eval_verbose`, `aether_eval_tail` and `aether_eval_diff`
+///
+/// `run` evaluates the code and returns the JSON written to `output_json`.
+unsafe fn eval_capturing(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    output_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+    run: impl FnOnce(&mut Aether, &str) -> (Result<Value, String>, serde_json::Value),
+) -> c_int {
+    if handle.is_null()
+        || code.is_null()
+        || result.is_null()
+        || output_json.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        *output_json = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (eval_result, output) = run(engine, code);
+                set_string(output_json, output.to_string())?;
+                set_result(engine, &eval_result?, result)
+            },
+        )
+    }
+}
+
+/// Evaluate Aether code and report how long the interpreter spent on it
+///
+/// The elapsed time is measured inside the engine (parse + optimize + evaluate)
+/// and excludes any marshaling overhead on the caller side.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - elapsed_ns: Output parameter for elapsed time in nanoseconds (set on success and on error)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_timed(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    elapsed_ns: *mut u64,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || code.is_null()
+        || result.is_null()
+        || elapsed_ns.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        *elapsed_ns = 0;
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (eval_result, elapsed) = engine.eval_timed(code);
+                *elapsed_ns = u64::try_from(elapsed.as_nanos()).unwrap_or(u64::MAX);
+                set_result(engine, &eval_result?, result)
+            },
+        )
+    }
+}
+
+/// Evaluate Aether code and report parse and evaluation time separately
+///
+/// Both phases are measured inside the engine. When the code is already in the
+/// AST cache nothing is parsed and `parse_ns` is just the cache lookup; a
+/// workload dominated by `parse_ns` benefits from `aether_compile`.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - parse_ns: Output parameter for parse and optimize time in nanoseconds (set on success and on error)
+/// - eval_ns: Output parameter for evaluation time in nanoseconds (0 if parsing failed)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_phases(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    parse_ns: *mut u64,
+    eval_ns: *mut u64,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || code.is_null()
+        || result.is_null()
+        || parse_ns.is_null()
+        || eval_ns.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        *parse_ns = 0;
+        *eval_ns = 0;
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (eval_result, phases) = engine.eval_phases(code);
+                *parse_ns = u64::try_from(phases.parse.as_nanos()).unwrap_or(u64::MAX);
+                *eval_ns = u64::try_from(phases.eval.as_nanos()).unwrap_or(u64::MAX);
+                set_result(engine, &eval_result?, result)
+            },
+        )
+    }
+}
+
+/// Evaluate Aether code and report how much of the engine's resources it used
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - stats: Output parameter for resource usage (set on success and on error)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_with_stats(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    stats: *mut AetherEvalStats,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || result.is_null() || stats.is_null() || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (eval_result, eval_stats) = engine.eval_with_stats(code);
+                let clamp = |n: usize| c_int::try_from(n).unwrap_or(c_int::MAX);
+                *stats = AetherEvalStats {
+                    steps: clamp(eval_stats.steps),
+                    peak_call_depth: clamp(eval_stats.peak_call_depth),
+                    peak_array_length: clamp(eval_stats.peak_array_length),
+                };
+                set_result(engine, &eval_result?, result)
+            },
+        )
+    }
+}
+
+/// Evaluate code with a typed entry point and store the result in `out`
+fn eval_typed<T>(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    out: *mut T,
+    error: *mut *mut c_char,
+    eval: impl FnOnce(&mut Aether, &str) -> Result<T, String>,
+) -> c_int {
+    if handle.is_null() || code.is_null() || out.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                *out = eval(engine, code)?;
+                Ok(())
+            },
+        )
+    }
+}
+
+/// Evaluate a predicate and return its boolean result
+///
+/// A non-boolean result is a runtime error; it is never coerced.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter set to 1 (true) or 0 (false) on success
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded and produced a Boolean
+/// - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+/// - Non-zero error code otherwise
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_bool(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut c_int,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    eval_typed(handle, code, result, error, |engine, code| {
+        engine.eval_bool(code).map(c_int::from)
+    })
+}
+
+/// Evaluate code and return its integer result
+///
+/// The result must be a whole number within the range of a 64-bit integer.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for the integer result
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded and produced an integer
+/// - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+/// - Non-zero error code otherwise
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_int(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut i64,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    eval_typed(handle, code, result, error, Aether::eval_int)
+}
+
+/// Evaluate code and return its numeric result as a double
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for the numeric result
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded and produced a Number
+/// - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+/// - Non-zero error code otherwise
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_float(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut f64,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    eval_typed(handle, code, result, error, Aether::eval_float)
+}
+
+/// Evaluate code and return its integer result as a decimal string
+///
+/// Unlike `aether_eval_int`, the result may exceed 64 bits; use it together with
+/// overflow mode 3 (BigInt) for exact arbitrary-precision integer math.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for the decimal digits, with a leading `-` if
+///   negative (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded and produced an integer
+/// - NoValue (8) if the script produced no value (e.g. it ends with PRINTLN)
+/// - Non-zero error code otherwise
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_bigint(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    eval_typed(handle, code, result, error, |engine, code| {
+        let digits = engine.eval_bigint(code)?.to_string();
+        CString::new(digits)
+            .map(CString::into_raw)
+            .map_err(|e| e.to_string())
+    })
+}
+
+/// Report whether the most recent evaluation modified global state
+///
+/// Global state is modified when a script sets a global variable or defines a
+/// function at the top level, even if it failed afterwards. Changes made by
+/// the host (e.g. `aether_set_global`) and locals inside functions do not count.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - side_effects: Output parameter, 1 if the last evaluation modified globals, 0 otherwise
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_last_eval_had_side_effects(
+    handle: *mut AetherHandle,
+    side_effects: *mut c_int,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || side_effects.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *side_effects = engine.last_eval_had_side_effects() as c_int;
+        AetherErrorCode::Success as c_int
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Report which host functions the most recent evaluation invoked
+///
+/// Host functions are those added with `aether_register_function` or an
+/// attached registry; builtins are not listed. The list is cleared when each
+/// evaluation starts and includes calls made before a failure.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - names_json: Output parameter for a JSON array of function names in the
+///   order of their first call (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_last_eval_called_hosts(
+    handle: *mut AetherHandle,
+    names_json: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || names_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *names_json = std::ptr::null_mut();
+        let json = serde_json::to_string(&engine.last_eval_called_hosts())
+            .unwrap_or_else(|_| "[]".to_string());
+        match CString::new(json) {
+            Ok(cstr) => {
+                *names_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Serialize the engine's global variables and functions to bytes
+///
+/// The bytes carry a format version and can be cached and passed to
+/// `aether_load_state` later, e.g. to skip re-running a setup script on a cold
+/// start. Builtins and host constants are not saved. Closures over local
+/// variables, generators and lazy values cannot be saved.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - out: Output parameter for the state bytes (must be freed with aether_free_bytes)
+/// - out_len: Output parameter for the number of bytes in `out`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the state was saved
+/// - RuntimeError (2) if a global cannot be saved
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_save_state(
+    handle: *mut AetherHandle,
+    out: *mut *mut u8,
+    out_len: *mut usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || out.is_null() || out_len.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *out = std::ptr::null_mut();
+        *out_len = 0;
+        *error = std::ptr::null_mut();
+
+        match engine.save_state() {
+            Ok(bytes) => {
+                let data = bytes.into_boxed_slice();
+                *out_len = data.len();
+                *out = Box::into_raw(data) as *mut u8;
+                AetherErrorCode::Success as c_int
+            }
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                AetherErrorCode::RuntimeError as c_int
+            }
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Restore globals and functions saved by `aether_save_state`
+///
+/// Existing globals with the same names are replaced. Corrupt bytes or bytes
+/// from an incompatible format version are rejected without changing the engine.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - data: Pointer to the state bytes
+/// - len: Length of `data` in bytes
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the state was restored
+/// - InvalidArgument (7) if the bytes are not a compatible engine state
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_load_state(
+    handle: *mut AetherHandle,
+    data: *const u8,
+    len: usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || data.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let bytes = std::slice::from_raw_parts(data, len);
+        match engine.load_state(bytes) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                AetherErrorCode::InvalidArgument as c_int
+            }
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Compile Aether code and serialize the compiled program to bytes
+///
+/// The bytes can be stored or shipped to other processes and loaded with
+/// `aether_import_program`, which skips parsing. They carry a format version,
+/// a checksum, the source code and the settings they were compiled with
+/// (deny list, nesting limit, warnings as errors, rational division,
+/// no recursion).
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - out: Output parameter for the program bytes (must be freed with aether_free_bytes)
+/// - out_len: Output parameter for the number of bytes in `out`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the program was compiled and serialized
+/// - ParseError (1) if the code cannot be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_export_program(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    out: *mut *mut u8,
+    out_len: *mut usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || out.is_null() || out_len.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *out = std::ptr::null_mut();
+        *out_len = 0;
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let data = engine.export_program(code)?.into_boxed_slice();
+                *out_len = data.len();
+                *out = Box::into_raw(data) as *mut u8;
+                Ok(())
+            },
+        )
+    }
+}
+
+/// Load a program serialized by `aether_export_program` into the AST cache
+///
+/// `source` receives the program's source code; evaluating exactly that code
+/// afterwards uses the loaded program without parsing. Corrupt bytes, a
+/// checksum mismatch, an incompatible format version or different parse
+/// settings are rejected without changing the engine. The checksum detects
+/// corruption only, so load bytes from trusted sources.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - data: Pointer to the program bytes
+/// - len: Length of `data` in bytes
+/// - source: Output parameter for the source code (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the program was loaded
+/// - InvalidArgument (7) if the bytes are not a compatible compiled program
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_import_program(
+    handle: *mut AetherHandle,
+    data: *const u8,
+    len: usize,
+    source: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || data.is_null() || source.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *source = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let bytes = std::slice::from_raw_parts(data, len);
+        let message = match engine.import_program(bytes) {
+            Ok(code) => match CString::new(code) {
+                Ok(cstr) => {
+                    *source = cstr.into_raw();
+                    return AetherErrorCode::Success as c_int;
+                }
+                Err(_) => "Source code contains a NUL byte".to_string(),
+            },
+            Err(e) => e,
+        };
+        if let Ok(cstr) = CString::new(message) {
+            *error = cstr.into_raw();
+        }
+        AetherErrorCode::InvalidArgument as c_int
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Report the approximate memory held by the engine's global scope
+///
+/// Counts global variables, constants and user-defined functions, including
+/// the contents of strings, arrays and dicts, so the figure grows with large
+/// arrays. It is an estimate; use it to decide when to call `aether_reset_env`
+/// on a long-lived engine.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - bytes: Output parameter for the approximate size in bytes
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_memory_usage(handle: *mut AetherHandle, bytes: *mut u64) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || bytes.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *bytes = engine.memory_usage() as u64;
+        AetherErrorCode::Success as c_int
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Evaluate Aether code using a caller-owned scratch buffer
+///
+/// Avoids per-call allocations for small scripts: `code` is passed as a
+/// pointer + length (no NUL terminator required), and the result text (or the
+/// error message on failure) is copied into `buf` as a NUL-terminated string.
+/// If the text does not fit, it is returned through `overflow` instead. A result
+/// containing a NUL byte is reported as an error, and NUL bytes are dropped
+/// from error messages, as in `aether_eval`.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: Pointer to UTF-8 Aether code
+/// - code_len: Length of `code` in bytes
+/// - buf: Caller-owned output buffer
+/// - buf_cap: Capacity of `buf` in bytes (including room for the NUL terminator)
+/// - written: Output parameter for the length of the text in bytes (excluding NUL)
+/// - overflow: Output parameter set to a newly allocated copy of the text when it
+///   does not fit in `buf` (must be freed with aether_free_string), otherwise NULL
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded (`buf`/`overflow` holds the result)
+/// - Non-zero error code if evaluation failed (`buf`/`overflow` holds the error message)
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_into(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    code_len: usize,
+    buf: *mut c_char,
+    buf_cap: usize,
+    written: *mut usize,
+    overflow: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || written.is_null() || overflow.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    if buf.is_null() && buf_cap > 0 {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *written = 0;
+        *overflow = std::ptr::null_mut();
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let bytes = std::slice::from_raw_parts(code as *const u8, code_len);
+        let (text, status) = match std::str::from_utf8(bytes) {
+            Ok(code_str) => {
+                engine.clear_error_kind();
+                match engine.eval(code_str) {
+                    Ok(val) => {
+                        let text = value_to_string(&val, engine.sorted_map_keys());
+                        if text.contains('\0') {
+                            (
+                                "Result contains a NUL byte".to_string(),
+                                AetherErrorCode::RuntimeError,
+                            )
+                        } else {
+                            (text, AetherErrorCode::Success)
+                        }
+                    }
+                    Err(e) => (
+                        e.replace('\0', ""),
+                        error_code(engine, AetherErrorCode::RuntimeError),
+                    ),
+                }
+            }
+            Err(_) => (
+                "Code is not valid UTF-8".to_string(),
+                AetherErrorCode::InvalidArgument,
+            ),
+        };
+
+        // `text` has no NUL bytes, so it always fits in a C string
+        *written = text.len();
+        if text.len() < buf_cap {
+            std::ptr::copy_nonoverlapping(text.as_ptr(), buf as *mut u8, text.len());
+            *buf.add(text.len()) = 0;
+        } else {
+            *overflow = CString::new(text).map_or(std::ptr::null_mut(), CString::into_raw);
+        }
+        status as c_int
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => {
+            unsafe {
+                *written = 0;
+                *overflow = std::ptr::null_mut();
+            }
+            AetherErrorCode::Panic as c_int
+        }
+    }
+}
+
+/// Evaluate Aether code and return the result as raw bytes
+///
+/// Unlike `aether_eval`, the result is returned as a pointer + length instead
+/// of a NUL-terminated string, so results containing NUL bytes are preserved.
+/// `code` is also passed as pointer + length.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: Pointer to UTF-8 Aether code
+/// - code_len: Length of `code` in bytes
+/// - out: Output parameter for the result bytes (must be freed with aether_free_bytes)
+/// - out_len: Output parameter for the number of bytes in `out`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_bytes(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    code_len: usize,
+    out: *mut *mut u8,
+    out_len: *mut usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || out.is_null() || out_len.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *out = std::ptr::null_mut();
+        *out_len = 0;
+        let code = std::slice::from_raw_parts(code as *const u8, code_len);
+        run_eval(handle, code, error, |engine, code| {
+            let data = value_to_string(&engine.eval(code)?, engine.sorted_map_keys())
+                .into_bytes()
+                .into_boxed_slice();
+            *out_len = data.len();
+            *out = Box::into_raw(data) as *mut u8;
+            Ok(())
+        })
+    }
+}
+
+/// Free bytes returned by `aether_eval_bytes`, `aether_save_state` or `aether_export_program`
+///
+/// # Parameters
+/// - ptr: Pointer returned through `out`
+/// - len: Length returned through `out_len`
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_free_bytes(ptr: *mut u8, len: usize) {
+    if !ptr.is_null() {
+        unsafe {
+            let _ = Box::from_raw(std::ptr::slice_from_raw_parts_mut(ptr, len));
+        }
+    }
+}
+
+/// Parse and optimize Aether code ahead of time without running it
+///
+/// The compiled AST is cached, so a later `aether_eval` of the same code skips
+/// parsing. Parsing a huge script can be cancelled from another thread with
+/// `aether_interrupt` on this engine's interrupt handle; interrupts requested
+/// before the call starts are ignored.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code compiled
+/// - ParseError (1) if the code could not be parsed or parsing was interrupted
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_compile(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                engine
+                    .compile(code)
+                    .map_err(|e| EvalError::Status(AetherErrorCode::ParseError, e))
+            },
+        )
+    }
+}
+
+/// Parse Aether code and return its AST as JSON
+///
+/// Every statement and expression node has a `kind` and the 1-based `line`
+/// and `column` where it starts. Invalid code yields a parse error, never a
+/// partial tree.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - ast_json: Output parameter for the JSON AST (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_parse_ast(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    ast_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || ast_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *ast_json = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let json = engine
+                    .parse_ast(code)
+                    .map_err(|e| EvalError::Status(AetherErrorCode::ParseError, e))?;
+                set_string(ast_json, json)
+            },
+        )
+    }
+}
+
+/// Parse Aether code and return its comments as JSON
+///
+/// Comments are not part of the AST. They are returned in source order as
+/// `{"text": ..., "line": ..., "column": ...}`, where `text` includes the
+/// comment delimiters and the 1-based position is that of the first
+/// character. Invalid code yields a parse error.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - comments_json: Output parameter for the JSON comments (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_parse_comments(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    comments_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || comments_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *comments_json = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let json = engine
+                    .parse_comments(code)
+                    .map_err(|e| EvalError::Status(AetherErrorCode::ParseError, e))?;
+                set_string(comments_json, json)
+            },
+        )
+    }
+}
+
+/// Validate Aether code without executing it and collect warnings
+///
+/// Warnings are returned as a JSON array of
+/// `{"severity": "warning", "code": ..., "message": ..., "line": ..., "column": ...}`
+/// (plus `end_line`/`end_column`, see `aether_diagnostics`).
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - warnings_json: Output parameter for the warnings (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed (there may still be warnings)
+/// - ParseError (1) if the code could not be parsed
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_validate(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    warnings_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || warnings_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *warnings_json = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let warnings = engine
+                    .validate_with_warnings(code)
+                    .map_err(|e| EvalError::Status(AetherErrorCode::ParseError, e))?;
+                let json = serde_json::to_string(&warnings).unwrap_or_else(|_| "[]".to_string());
+                set_string(warnings_json, json)
+            },
+        )
+    }
+}
+
+/// Check that Aether code is a pure boolean predicate, without executing it
+///
+/// The code must be a single expression whose inferred type is Boolean, with no
+/// statements, definitions, or calls to functions that may have side effects
+/// (see `Aether::validate_predicate`).
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code is a valid predicate
+/// - ParseError (1) if the code could not be parsed
+/// - InvalidArgument (7) if the code is not a pure boolean predicate
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_validate_predicate(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *error = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.validate_predicate(code_str) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => {
+                let status = if e.starts_with("Parse error") {
+                    AetherErrorCode::ParseError
+                } else {
+                    AetherErrorCode::InvalidArgument
+                };
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                status as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => {
+            unsafe {
+                let panic_msg = CString::new("Panic occurred during validation").unwrap();
+                *error = panic_msg.into_raw();
+            }
+            AetherErrorCode::Panic as c_int
+        }
+    }
+}
+
+/// Collect structured diagnostics for editor integration, without executing code
+///
+/// Diagnostics are returned as a JSON array of
+/// `{"severity": "error"|"warning", "code": ..., "message": ..., "line": ...,
+/// "column": ..., "end_line": ..., "end_column": ...}` combining parse errors,
+/// undefined identifiers and unused variables. Malformed code is not an error:
+/// its parse error is one of the diagnostics.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - diagnostics_json: Output parameter for the diagnostics (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if any pointer is NULL
+/// - InvalidArgument (7) if `code` is not valid UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_diagnostics(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    diagnostics_json: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || diagnostics_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *diagnostics_json = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
+        };
+
+        let json = serde_json::to_string(&engine.diagnostics(code_str))
+            .unwrap_or_else(|_| "[]".to_string());
+        match CString::new(json) {
+            Ok(cstr) => {
+                *diagnostics_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Check whether Aether code fails to parse only because it ends too early
+///
+/// Interactive shells use this to decide whether to read another line (for
+/// example after an unclosed `{` or a trailing operator) instead of reporting
+/// a parse error. Complete code, and code with an error before its end, are
+/// not incomplete.
+///
+/// # Parameters
+/// - code: C string containing Aether code
+/// - incomplete: Output parameter, 1 if more input is needed, 0 otherwise
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_is_incomplete(code: *const c_char, incomplete: *mut c_int) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if code.is_null() || incomplete.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+        *incomplete = Aether::is_incomplete(code_str) as c_int;
+        AetherErrorCode::Success as c_int
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// List every operator with the precedence and associativity the parser uses
+///
+/// `table_json` receives a JSON array sorted from loosest to tightest binding,
+/// e.g. `{"symbol": "+", "kind": "binary", "precedence": 5, "associativity": "left"}`.
+/// `kind` is `binary`, `prefix` or `postfix`; a higher precedence binds tighter.
+///
+/// # Parameters
+/// - table_json: Output parameter for the table (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if `table_json` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_operator_table(table_json: *mut *mut c_char) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if table_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        *table_json = std::ptr::null_mut();
+        let json = serde_json::to_string(&Aether::operator_table()).unwrap_or_default();
+        match CString::new(json) {
+            Ok(cstr) => {
+                *table_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Tell Aether code that ends too early apart from malformed code
+///
+/// Like `aether_is_incomplete`, but code that can never parse is reported as
+/// a ParseError with its message, so a shell can show the error right away
+/// instead of waiting for more lines.
+///
+/// # Parameters
+/// - code: C string containing Aether code
+/// - incomplete: Output parameter, 1 if more input is needed, 0 otherwise
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parses or only needs more input
+/// - ParseError (1) if the code is malformed
+/// - NullPointer (3) if a pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_check_incomplete(
+    code: *const c_char,
+    incomplete: *mut c_int,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if code.is_null() || incomplete.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        *incomplete = 0;
+        *error = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+        match Aether::check_incomplete(code_str) {
+            Ok(more) => {
+                *incomplete = more as c_int;
+                AetherErrorCode::Success as c_int
+            }
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                AetherErrorCode::ParseError as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Infer the type of the value Aether code would produce, without executing it
+///
+/// Globals already set on the engine take part in inference by the type of
+/// their current value.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - kind: Output parameter for the type name, one of `Int`, `Float`, `Number`,
+///   `Fraction`, `String`, `Boolean`, `Null`, `Array`, `Dict`, `Function` or
+///   `Unknown` (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_infer_type(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    kind: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || kind.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.infer_type(code_str) {
+            Ok(type_kind) => match CString::new(type_kind.name()) {
+                Ok(cstr) => {
+                    *kind = cstr.into_raw();
+                    *error = std::ptr::null_mut();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(e) => match CString::new(e) {
+                Ok(cstr) => {
+                    *error = cstr.into_raw();
+                    *kind = std::ptr::null_mut();
+                    AetherErrorCode::ParseError as c_int
+                }
+                Err(_) => AetherErrorCode::ParseError as c_int,
+            },
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => {
+            unsafe {
+                let panic_msg = CString::new("Panic occurred during type inference").unwrap();
+                *error = panic_msg.into_raw();
+                *kind = std::ptr::null_mut();
+            }
+            AetherErrorCode::Panic as c_int
+        }
+    }
+}
+
+/// Estimate the cost of running Aether code from its syntax, without executing it
+///
+/// The result is a JSON object such as
+/// `{"statements": 3, "loops": 2, "max_loop_depth": 2, "max_nesting": 2,
+/// "functions": 0, "calls": 3, "recursive_functions": [], "score": 111}`.
+/// `score` is a heuristic for rejecting obviously expensive scripts; see
+/// `Aether::estimate_cost` for how it is computed.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - cost_json: Output parameter for the JSON object (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_estimate_cost(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    cost_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || cost_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *cost_json = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.estimate_cost(code_str) {
+            Ok(cost) => {
+                let json = serde_json::to_string(&cost).unwrap_or_default();
+                match CString::new(json) {
+                    Ok(cstr) => {
+                        *cost_json = cstr.into_raw();
+                        AetherErrorCode::Success as c_int
+                    }
+                    Err(_) => AetherErrorCode::RuntimeError as c_int,
+                }
+            }
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                AetherErrorCode::ParseError as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => {
+            unsafe {
+                let panic_msg = CString::new("Panic occurred during cost estimation").unwrap();
+                *error = panic_msg.into_raw();
+                *cost_json = std::ptr::null_mut();
+            }
+            AetherErrorCode::Panic as c_int
+        }
+    }
+}
+
+/// List the user-defined functions in the engine's global scope as a JSON array
+///
+/// Each entry is `{"name", "params", "line", "column"}`, sorted by name.
+/// Builtins, host functions and lambdas are not included; `line` and `column`
+/// are 0 when the definition site is unknown.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - functions_json: Output parameter (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the functions were listed
+/// - Non-zero error code if failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_functions(
+    handle: *mut AetherHandle,
+    functions_json: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || functions_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        let json_array = json!(engine.functions()).to_string();
+        match CString::new(json_array) {
+            Ok(cstr) => {
+                *functions_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Report the IO permissions Aether code would need, without executing it
+///
+/// A permission is required if the code names any of its builtins, even in a
+/// branch or function that never runs. IO reached indirectly (host functions,
+/// imported modules) is not detected, so this does not replace the runtime
+/// permission checks.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - permissions: Output parameter (each field is 1 if required, 0 otherwise)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_required_permissions(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    permissions: *mut AetherPermissions,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || permissions.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.required_permissions(code_str) {
+            Ok(required) => {
+                (*permissions).filesystem_enabled = required.filesystem_enabled as c_int;
+                (*permissions).network_enabled = required.network_enabled as c_int;
+                *error = std::ptr::null_mut();
+                AetherErrorCode::Success as c_int
+            }
+            Err(e) => match CString::new(e) {
+                Ok(cstr) => {
+                    *error = cstr.into_raw();
+                    AetherErrorCode::ParseError as c_int
+                }
+                Err(_) => AetherErrorCode::ParseError as c_int,
+            },
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// List the variables Aether code reads but never defines, without executing it
+///
+/// These are the inputs a host must supply (e.g. with aether_set_globals) before
+/// evaluating the code. Names defined by the code itself (`Set`, parameters,
+/// loop variables, imports), builtins, host functions and global functions are
+/// left out.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - names_json: Output parameter for a JSON array of names in order of first
+///   read (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code parsed
+/// - ParseError (1) if the code could not be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_free_variables(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    names_json: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || names_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *names_json = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.free_variables(code_str) {
+            Ok(names) => match CString::new(serde_json::json!(names).to_string()) {
+                Ok(cstr) => {
+                    *names_json = cstr.into_raw();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
+                }
+                AetherErrorCode::ParseError as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Dump the compiled (parsed + optimized) AST of Aether code
+///
+/// Read-only: the code is not executed and the engine state is not modified,
+/// so this is safe to call repeatedly.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - dump: Output parameter for the human-readable AST dump (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the code compiled
+/// - ParseError (1) if the code could not be parsed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_disassemble(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    dump: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || dump.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        match engine.disassemble(code_str) {
+            Ok(text) => match CString::new(text) {
+                Ok(cstr) => {
+                    *dump = cstr.into_raw();
+                    *error = std::ptr::null_mut();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(e) => match CString::new(e) {
+                Ok(cstr) => {
+                    *error = cstr.into_raw();
+                    *dump = std::ptr::null_mut();
+                    AetherErrorCode::ParseError as c_int
+                }
+                Err(_) => AetherErrorCode::ParseError as c_int,
+            },
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => {
+            unsafe {
+                let panic_msg = CString::new("Panic occurred during disassembly").unwrap();
+                *error = panic_msg.into_raw();
+                *dump = std::ptr::null_mut();
+            }
+            AetherErrorCode::Panic as c_int
+        }
+    }
+}
+
+/// Evaluate Aether code and report how the result was produced
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string);
+///   an empty string when the script produced no value
+/// - kind: Output parameter for the result kind:
+///   0 = last statement value, 1 = explicit top-level `Return`, 2 = no value (void)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_with_kind(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    kind: *mut c_int,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || result.is_null() || kind.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (val, result_kind) = engine.eval_with_kind(code)?;
+                let (text, kind_code) = match result_kind {
+                    crate::runtime::ResultKind::LastValue => {
+                        (value_to_string(&val, engine.sorted_map_keys()), 0)
+                    }
+                    crate::runtime::ResultKind::Returned => {
+                        (value_to_string(&val, engine.sorted_map_keys()), 1)
+                    }
+                    crate::runtime::ResultKind::Void => (String::new(), 2),
+                };
+                set_string(result, text)?;
+                *kind = kind_code;
+                Ok(())
+            },
+        )
+    }
+}
+
+/// Evaluate Aether code and report the source position of the result
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - line: Output parameter for the 1-based line of the top-level statement
+///   that produced the result; 0 when the script produced no value
+/// - column: Output parameter for the 1-based column of that statement; 0 when
+///   the script produced no value
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_with_span(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    line: *mut c_int,
+    column: *mut c_int,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || code.is_null()
+        || result.is_null()
+        || line.is_null()
+        || column.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let (val, span) = engine.eval_with_span(code)?;
+                set_result(engine, &val, result)?;
+                *line = span.map_or(0, |p| p.line as c_int);
+                *column = span.map_or(0, |p| p.column as c_int);
+                Ok(())
+            },
+        )
+    }
+}
+
+/// Evaluate Aether code and report failures as a structured JSON error report
+///
+/// On failure `report_json` receives
+/// `{"phase", "kind", "message", "import_chain", "call_stack"}`, where
+/// `call_stack` lists the calls active when the error occurred, outermost
+/// first, each as `{"name", "signature", "line", "column"}`. `line`/`column`
+/// are the 1-based position of the top-level statement making the call, or 0
+/// when unknown (calls made inside another function).
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - report_json: Output parameter for the error report (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - ParseError (1) if the code could not be parsed
+/// - RuntimeError (2) if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_report(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    result: *mut *mut c_char,
+    report_json: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || result.is_null() || report_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *result = std::ptr::null_mut();
+        *report_json = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
+        };
+
+        match engine.eval_report(code_str) {
+            Ok(val) => match CString::new(value_to_string(&val, engine.sorted_map_keys())) {
+                Ok(cstr) => {
+                    *result = cstr.into_raw();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(report) => {
+                if let Ok(cstr) = CString::new(report.to_json_value().to_string()) {
+                    *report_json = cstr.into_raw();
+                }
+                if report.phase == "parse" {
+                    AetherErrorCode::ParseError as c_int
+                } else {
+                    AetherErrorCode::RuntimeError as c_int
+                }
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Get the version string of Aether
+///
+/// Returns: C string with version (must NOT be freed)
+///
+/// The string is static and does not allocate: every call returns the same
+/// pointer, valid for as long as the library stays loaded, so bindings may
+/// cache it (e.g. once per process) instead of calling this repeatedly.
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_version() -> *const c_char {
+    static VERSION: &str = concat!(env!("CARGO_PKG_VERSION"), "\0");
+    VERSION.as_ptr() as *const c_char
+}
+
+/// Free an Aether engine handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_free(handle: *mut AetherHandle) {
+    if !handle.is_null() {
+        // Dropping the engine drops host values; a panic there must not unwind into C
+        let _ = panic::catch_unwind(|| unsafe {
+            let _ = Box::from_raw(handle as *mut Aether);
+        });
+    }
+}
+
+/// Free a string allocated by Aether
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_free_string(s: *mut c_char) {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if !s.is_null() {
+        unsafe {
+            let _ = CString::from_raw(s);
+        }
+    }
+}
+
+/// Helper function to convert Value to string representation
+fn value_to_string(value: &Value, sorted_keys: bool) -> String {
+    match value {
+        Value::Number(n) => {
+            // Format number nicely - remove trailing zeros
+            if n.fract() == 0.0 {
+                format!("{:.0}", n)
+            } else {
+                n.to_string()
+            }
+        }
+        Value::String(s) => s.clone(),
+        Value::Boolean(b) => b.to_string(),
+        Value::Array(arr) => {
+            let items: Vec<String> = arr
+                .iter()
+                .map(|v| value_to_string(v, sorted_keys))
+                .collect();
+            format!("[{}]", items.join(", "))
+        }
+        Value::Dict(map) => {
+            let mut entries: Vec<_> = map.iter().collect();
+            if sorted_keys {
+                entries.sort_by(|a, b| a.0.cmp(b.0));
+            }
+            let items: Vec<String> = entries
+                .into_iter()
+                .map(|(k, v)| format!("{}: {}", k, value_to_string(v, sorted_keys)))
+                .collect();
+            format!("{{{}}}", items.join(", "))
+        }
+        Value::Null => "null".to_string(),
+        Value::Function { .. } => "<function>".to_string(),
+        Value::BuiltIn { name, .. } => format!("<builtin: {}>", name),
+        Value::Generator { .. } => "<generator>".to_string(),
+        Value::Lazy { .. } => "<lazy>".to_string(),
+        Value::Fraction(f) => f.to_string(),
+    }
+}
+
+/// Helper function to convert Value to JSON string
+fn value_to_json(value: &Value, sorted_keys: bool) -> String {
+    let json = if sorted_keys {
+        serde_json::to_string(&SortedJsonValue(value))
+    } else {
+        serde_json::to_string(&JsonValue(value))
+    };
+    json.unwrap_or_else(|_| "null".to_string())
+}
+
+/// Helper function to convert Value to serde_json::Value
+fn json_from_value(value: &Value) -> serde_json::Value {
+    serde_json::to_value(JsonValue(value)).unwrap_or(serde_json::Value::Null)
+}
+
+/// Helper function to parse JSON to Value
+fn json_to_value(json_str: &str) -> Result<Value, String> {
+    let v: serde_json::Value =
+        serde_json::from_str(json_str).map_err(|e| format!("Invalid JSON: {}", e))?;
+
+    Ok(match v {
+        serde_json::Value::Number(n) => {
+            if n.is_i64() {
+                Value::Number(n.as_i64().unwrap() as f64)
+            } else {
+                Value::Number(n.as_f64().unwrap())
+            }
+        }
+        serde_json::Value::String(s) => Value::String(s),
+        serde_json::Value::Bool(b) => Value::Boolean(b),
+        serde_json::Value::Array(arr) => {
+            let items: Result<Vec<_>, _> =
+                arr.iter().map(|v| json_to_value(&v.to_string())).collect();
+            Value::Array(items?)
+        }
+        serde_json::Value::Object(obj) => {
+            let mut map = std::collections::HashMap::new();
+            for (k, v) in obj {
+                map.insert(k, json_to_value(&v.to_string())?);
+            }
+            Value::Dict(map)
+        }
+        serde_json::Value::Null => Value::Null,
+    })
+}
+
+// ============================================================
+// Variable Operations
+// ============================================================
+
+/// Set a global variable from host application
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Variable name
+/// - value_json: Variable value as JSON string
+///
+/// # Returns
+/// - 0 (Success) if variable was set
+/// - Non-zero error code if failed
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `name` must be a valid pointer to a null-terminated C string
+/// - `value_json` must be a valid pointer to a null-terminated C string
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_set_global(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    value_json: *const c_char,
+) -> c_int {
+    if handle.is_null() || name.is_null() || value_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+        let json_str = match CStr::from_ptr(value_json).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        // Parse JSON to Value
+        let value = match json_to_value(json_str) {
+            Ok(v) => v,
+            Err(_) => return AetherErrorCode::InvalidJSON as c_int,
+        };
+
+        engine.set_global(name_str, value);
+        AetherErrorCode::Success as c_int
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Bind a global constant that scripts can read but not reassign
+///
+/// A script that `Set`s the name, modifies it by index, defines a function with
+/// the same name or uses it as a loop variable fails with a runtime error.
+/// Constants survive `aether_reset_env`.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Constant name
+/// - value_json: Constant value as JSON string
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the constant was set
+/// - InvalidJSON (5) if `value_json` is not valid JSON
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_const(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    value_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || name.is_null() || value_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidArgument, e.to_string()),
+        };
+        let json_str = match CStr::from_ptr(value_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e.to_string()),
+        };
+        let value = match json_to_value(json_str) {
+            Ok(v) => v,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.set_const(name_str, value) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(AetherErrorCode::InvalidArgument, e),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set a global variable to an array of numbers from a C `double` array
+///
+/// The fast path for large numeric data: the elements are copied into the
+/// engine in a single call, without building or parsing JSON. Later changes to
+/// `data` do not affect the script.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Variable name
+/// - data: Pointer to `len` doubles (may be NULL when `len` is 0)
+/// - len: Number of elements
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the variable was set
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_float_array(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    data: *const f64,
+    len: usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe { set_numeric_array(handle, name, data, len, error, Aether::set_float_slice) }
+}
+
+/// Set a global variable to an array of numbers from a C `int64_t` array
+///
+/// Like `aether_set_float_array`. Aether numbers are doubles, so integers
+/// beyond 2^53 in magnitude are rounded.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Variable name
+/// - data: Pointer to `len` integers (may be NULL when `len` is 0)
+/// - len: Number of elements
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the variable was set
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_int_array(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    data: *const i64,
+    len: usize,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe { set_numeric_array(handle, name, data, len, error, Aether::set_int_slice) }
+}
+
+/// Shared implementation of `aether_set_float_array` and `aether_set_int_array`
+unsafe fn set_numeric_array<T: panic::RefUnwindSafe>(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    data: *const T,
+    len: usize,
+    error: *mut *mut c_char,
+    set: fn(&mut Aether, &str, &[T]) -> Result<(), String>,
+) -> c_int {
+    if handle.is_null() || name.is_null() || (data.is_null() && len > 0) || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            AetherErrorCode::InvalidArgument as c_int
+        };
+
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(e.to_string()),
+        };
+        let slice = if len == 0 {
+            &[]
+        } else {
+            std::slice::from_raw_parts(data, len)
+        };
+        match set(engine, name_str, slice) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(e),
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Decode a JSON object C string into variable name/value pairs
+unsafe fn json_object_to_vars(json: *const c_char) -> Result<Vec<(String, Value)>, String> {
+    let json_str = unsafe { CStr::from_ptr(json) }
+        .to_str()
+        .map_err(|e| e.to_string())?;
+    let obj = match serde_json::from_str::<serde_json::Value>(json_str) {
+        Ok(serde_json::Value::Object(obj)) => obj,
+        Ok(_) => return Err("Expected a JSON object".to_string()),
+        Err(e) => return Err(format!("Invalid JSON: {}", e)),
+    };
+    json_map_to_vars(obj)
+}
+
+/// Convert a decoded JSON object into variable name/value pairs
+fn json_map_to_vars(
+    obj: serde_json::Map<String, serde_json::Value>,
+) -> Result<Vec<(String, Value)>, String> {
+    obj.into_iter()
+        .map(|(name, v)| match json_to_value(&v.to_string()) {
+            Ok(value) => Ok((name, value)),
+            Err(e) => Err(format!("{:?}: {}", name, e)),
+        })
+        .collect()
+}
+
+/// Evaluate Aether code with variables overlaid for this call only
+///
+/// The variables live in a child scope that shadows globals during the
+/// evaluation and is discarded afterwards, together with anything the script
+/// defines, so nothing leaks into the next call.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - vars_json: JSON object mapping variable names to values
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - InvalidJSON (5) if `vars_json` is not a JSON object
+/// - InvalidArgument (7) if a key is not a valid variable name
+/// - Other non-zero error codes if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_with(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    vars_json: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe {
+        eval_with_overlay(
+            handle,
+            code,
+            vars_json,
+            result,
+            error,
+            |engine, code, vars| engine.eval_with(code, vars),
+        )
+    }
+}
+
+/// Evaluate Aether code with its own RNG seed and variables for this call only
+///
+/// Behaves like `aether_eval_with`, except that RANDOM/RANDOM_INT use a
+/// generator seeded with `seed` during this evaluation. The engine's own RNG
+/// state is restored afterwards, whether or not the evaluation succeeded.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - seed: RNG seed for this evaluation only
+/// - vars_json: JSON object mapping variable names to values (may be `{}`)
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - InvalidJSON (5) if `vars_json` is not a JSON object
+/// - InvalidArgument (7) if a key is not a valid variable name
+/// - Other non-zero error codes if evaluation failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_with_seed(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    seed: u64,
+    vars_json: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    unsafe {
+        eval_with_overlay(
+            handle,
+            code,
+            vars_json,
+            result,
+            error,
+            move |engine, code, vars| engine.eval_with_seed(code, seed, vars),
+        )
+    }
+}
+
+/// Shared body of `aether_eval_with` and `aether_eval_with_seed`: decode and
+/// validate `vars_json`, then hand the engine, code and variables to `run`
+unsafe fn eval_with_overlay(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    vars_json: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+    run: impl FnOnce(&mut Aether, &str, Vec<(String, Value)>) -> Result<Value, String>,
+) -> c_int {
+    if handle.is_null()
+        || code.is_null()
+        || vars_json.is_null()
+        || result.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let vars = json_object_to_vars(vars_json)
+                    .map_err(|e| EvalError::Status(AetherErrorCode::InvalidJSON, e))?;
+                if let Some((name, _)) = vars
+                    .iter()
+                    .find(|(name, _)| !crate::token::Token::is_identifier(name))
+                {
+                    return Err(EvalError::Status(
+                        AetherErrorCode::InvalidArgument,
+                        format!("Invalid variable name: {:?}", name),
+                    ));
+                }
+                let value = run(engine, code, vars)?;
+                set_result(engine, &value, result)
+            },
+        )
+    }
+}
+
+/// Evaluate the same Aether code once per row of variables
+///
+/// The code is parsed once. Each row is a JSON object overlaid like
+/// `aether_eval_with`, so rows cannot see each other's variables. A failing
+/// row does not stop the others: `results` receives a JSON array with one
+/// entry per row, either `{"value": <result as JSON>}` or
+/// `{"error": "<message>"}`.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - rows_json: JSON array of objects, e.g. `[{"X": 1}, {"X": 2}]`
+/// - results: Output parameter for the per-row results (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if every row was evaluated, even if some rows failed
+/// - InvalidJSON (5) if `rows_json` is not a JSON array of objects
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_many(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    rows_json: *const c_char,
+    results: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || code.is_null()
+        || rows_json.is_null()
+        || results.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *results = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+        let rows = match CStr::from_ptr(rows_json).to_str() {
+            Ok(s) => serde_json::from_str::<Vec<serde_json::Map<String, serde_json::Value>>>(s)
+                .map_err(|e| format!("Expected a JSON array of objects: {}", e)),
+            Err(e) => Err(e.to_string()),
+        };
+        let rows = match rows {
+            Ok(rows) => rows,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+        // A row whose values cannot be converted fails on its own
+        let rows: Vec<Result<Vec<(String, Value)>, String>> =
+            rows.into_iter().map(json_map_to_vars).collect();
+        let valid = rows.iter().filter_map(|row| row.as_ref().ok().cloned());
+        let mut evaluated = engine.eval_many(code_str, valid).into_iter();
+
+        let sorted_keys = engine.sorted_map_keys();
+        let entries: Vec<String> = rows
+            .into_iter()
+            .map(|row| {
+                let outcome = row.and_then(|_| evaluated.next().unwrap_or(Ok(Value::Null)));
+                match outcome {
+                    Ok(value) => format!("{{\"value\":{}}}", value_to_json(&value, sorted_keys)),
+                    Err(e) => format!("{{\"error\":{}}}", json_from_value(&Value::String(e))),
+                }
+            })
+            .collect();
+
+        match CString::new(format!("[{}]", entries.join(","))) {
+            Ok(cstr) => {
+                *results = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Evaluate the same Aether code once per CSV record
+///
+/// Column `i` of every record is bound to the variable named `header[i]`.
+/// Fields that look like decimal numbers (optional minus sign, fraction and
+/// exponent; no leading zeros except a lone `0`) become numbers, all other
+/// fields stay strings. Rows are otherwise isolated like `aether_eval_many`,
+/// and `results` has the same shape: one `{"value": ...}` or
+/// `{"error": "..."}` entry per record. A record whose field count differs
+/// from the header fails on its own.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - header_json: JSON array of column names, e.g. `["NAME", "AGE"]`
+/// - rows_json: JSON array of string arrays, e.g. `[["Ann", "42"]]`
+/// - results: Output parameter for the per-record results (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if every record was evaluated, even if some records failed
+/// - InvalidJSON (5) if `header_json` or `rows_json` has the wrong shape
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_csv(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    header_json: *const c_char,
+    rows_json: *const c_char,
+    results: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || code.is_null()
+        || header_json.is_null()
+        || rows_json.is_null()
+        || results.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *results = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+        let header = match CStr::from_ptr(header_json).to_str() {
+            Ok(s) => serde_json::from_str::<Vec<String>>(s)
+                .map_err(|e| format!("Expected a JSON array of column names: {}", e)),
+            Err(e) => Err(e.to_string()),
+        };
+        let header = match header {
+            Ok(header) => header,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+        let rows = match CStr::from_ptr(rows_json).to_str() {
+            Ok(s) => serde_json::from_str::<Vec<Vec<String>>>(s)
+                .map_err(|e| format!("Expected a JSON array of string arrays: {}", e)),
+            Err(e) => Err(e.to_string()),
+        };
+        let rows = match rows {
+            Ok(rows) => rows,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        let sorted_keys = engine.sorted_map_keys();
+        let entries: Vec<String> = engine
+            .eval_csv(code_str, &header, rows)
+            .into_iter()
+            .map(|outcome| match outcome {
+                Ok(value) => format!("{{\"value\":{}}}", value_to_json(&value, sorted_keys)),
+                Err(e) => format!("{{\"error\":{}}}", json_from_value(&Value::String(e))),
+            })
+            .collect();
+
+        match CString::new(format!("[{}]", entries.join(","))) {
+            Ok(cstr) => {
+                *results = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set several global variables at once from a JSON object
+///
+/// Either all variables are set or none: if any key is not a valid variable
+/// name, nothing is changed and `error` names the offending key.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - vars_json: JSON object mapping variable names to values
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if all variables were set
+/// - InvalidJSON (5) if `vars_json` is not a JSON object
+/// - InvalidArgument (7) if a key is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_globals(
+    handle: *mut AetherHandle,
+    vars_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || vars_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let vars = match json_object_to_vars(vars_json) {
+            Ok(vars) => vars,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.set_globals(vars) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(AetherErrorCode::InvalidArgument, e),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Seed global variables that survive aether_reset_env
+///
+/// Meant to be called right after creating the engine. The variables are set
+/// immediately and restored to these values by every aether_reset_env; scripts
+/// may still reassign them. Each engine keeps its own copy. Replaces any
+/// previously seeded variables. Either all variables are seeded or none.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - vars_json: JSON object mapping variable names to values
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if all variables were seeded
+/// - InvalidJSON (5) if `vars_json` is not a JSON object
+/// - InvalidArgument (7) if a key is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_initial_vars(
+    handle: *mut AetherHandle,
+    vars_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || vars_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let vars = match json_object_to_vars(vars_json) {
+            Ok(vars) => vars,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.set_initial_vars(vars) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(AetherErrorCode::InvalidArgument, e),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Define boolean feature flags that scripts can read but not reassign
+///
+/// Each flag is bound as a constant, so a script can branch on it with
+/// `If (FEATURE_X) { ... }` and fails with a runtime error if it reassigns
+/// it. Flags survive aether_reset_env. Either all flags are defined or none.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - defines_json: JSON object mapping flag names to booleans, e.g. `{"FEATURE_X": true}`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if all flags were defined
+/// - InvalidJSON (5) if `defines_json` is not a JSON object of booleans
+/// - InvalidArgument (7) if a key is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_defines(
+    handle: *mut AetherHandle,
+    defines_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || defines_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let defines = match CStr::from_ptr(defines_json).to_str() {
+            Ok(s) => serde_json::from_str::<serde_json::Map<String, serde_json::Value>>(s)
+                .map_err(|e| format!("Expected a JSON object of booleans: {}", e))
+                .and_then(|map| {
+                    map.into_iter()
+                        .map(|(name, value)| match value {
+                            serde_json::Value::Bool(enabled) => Ok((name, enabled)),
+                            other => Err(format!(
+                                "Expected a boolean for {:?}, found {}",
+                                name, other
+                            )),
+                        })
+                        .collect::<Result<Vec<_>, _>>()
+                }),
+            Err(e) => Err(e.to_string()),
+        };
+        let defines = match defines {
+            Ok(defines) => defines,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.set_defines(defines) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(AetherErrorCode::InvalidArgument, e),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Pending variable assignments behind an `AetherVarBatch`
+///
+/// Cleared slots keep their name buffers, so refilling a batch with the same
+/// variables every iteration does not allocate.
+#[derive(Default)]
+struct VarBatch {
+    slots: Vec<(String, Value)>,
+    len: usize,
+}
+
+impl VarBatch {
+    fn push(&mut self, name: &str, value: Value) {
+        match self.slots.get_mut(self.len) {
+            Some((slot_name, slot_value)) => {
+                slot_name.clear();
+                slot_name.push_str(name);
+                *slot_value = value;
+            }
+            None => self.slots.push((name.to_string(), value)),
+        }
+        self.len += 1;
+    }
+
+    fn clear(&mut self) {
+        for (_, value) in &mut self.slots[..self.len] {
+            *value = Value::Null;
+        }
+        self.len = 0;
+    }
+}
+
+/// Create an empty variable batch
+///
+/// A batch collects name/value pairs and sets them on an engine in one call
+/// with `aether_set_var_batch`, avoiding one FFI call and one JSON round trip
+/// per variable. Call `aether_var_batch_clear` and refill it for the next
+/// evaluation; its buffers are reused.
+///
+/// Returns: Pointer to AetherVarBatch (must be freed with aether_var_batch_free),
+/// or NULL on failure
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_new() -> *mut AetherVarBatch {
+    match panic::catch_unwind(VarBatch::default) {
+        Ok(batch) => Box::into_raw(Box::new(batch)) as *mut AetherVarBatch,
+        Err(_) => std::ptr::null_mut(),
+    }
+}
+
+/// Free a variable batch
+///
+/// # Parameters
+/// - batch: Batch handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_free(batch: *mut AetherVarBatch) {
+    if !batch.is_null() {
+        let _ = panic::catch_unwind(|| unsafe {
+            let _ = Box::from_raw(batch as *mut VarBatch);
+        });
+    }
+}
+
+/// Remove all pending assignments from a batch, keeping its buffers
+///
+/// # Parameters
+/// - batch: Batch handle
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `batch` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_clear(batch: *mut AetherVarBatch) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if batch.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        (*(batch as *mut VarBatch)).clear();
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Validate `name` and add an assignment to a batch
+fn var_batch_push(
+    batch: *mut AetherVarBatch,
+    name: *const c_char,
+    value: impl FnOnce() -> Result<Value, AetherErrorCode>,
+) -> c_int {
+    if batch.is_null() || name.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(panic::AssertUnwindSafe(|| unsafe {
+        let batch = &mut *(batch as *mut VarBatch);
+        let name = match CStr::from_ptr(name).to_str() {
+            Ok(s) if crate::token::Token::is_identifier(s) => s,
+            _ => return AetherErrorCode::InvalidArgument as c_int,
+        };
+        match value() {
+            Ok(value) => {
+                batch.push(name, value);
+                AetherErrorCode::Success as c_int
+            }
+            Err(code) => code as c_int,
+        }
+    }));
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Add a number assignment to a batch
+///
+/// # Parameters
+/// - batch: Batch handle
+/// - name: Variable name
+/// - value: Number value
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if a pointer is NULL
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_set_number(
+    batch: *mut AetherVarBatch,
+    name: *const c_char,
+    value: f64,
+) -> c_int {
+    var_batch_push(batch, name, || Ok(Value::Number(value)))
+}
+
+/// Add a boolean assignment to a batch
+///
+/// # Parameters
+/// - batch: Batch handle
+/// - name: Variable name
+/// - value: Non-zero for true, 0 for false
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if a pointer is NULL
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_set_bool(
+    batch: *mut AetherVarBatch,
+    name: *const c_char,
+    value: c_int,
+) -> c_int {
+    var_batch_push(batch, name, || Ok(Value::Boolean(value != 0)))
+}
+
+/// Add a string assignment to a batch
+///
+/// # Parameters
+/// - batch: Batch handle
+/// - name: Variable name
+/// - value: UTF-8 string value (copied)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if a pointer is NULL
+/// - InvalidArgument (7) if `name` is not a valid variable name or `value` is not UTF-8
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_set_string(
+    batch: *mut AetherVarBatch,
+    name: *const c_char,
+    value: *const c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if value.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    var_batch_push(batch, name, || {
+        match unsafe { CStr::from_ptr(value) }.to_str() {
+            Ok(s) => Ok(Value::String(s.to_string())),
+            Err(_) => Err(AetherErrorCode::InvalidArgument),
+        }
+    })
+}
+
+/// Add an assignment of any JSON value (arrays, objects, null) to a batch
+///
+/// # Parameters
+/// - batch: Batch handle
+/// - name: Variable name
+/// - value_json: Value as JSON string
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if a pointer is NULL
+/// - InvalidJSON (5) if `value_json` is not valid JSON
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_var_batch_set_json(
+    batch: *mut AetherVarBatch,
+    name: *const c_char,
+    value_json: *const c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if value_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    var_batch_push(batch, name, || {
+        let json = unsafe { CStr::from_ptr(value_json) }
+            .to_str()
+            .map_err(|_| AetherErrorCode::InvalidJSON)?;
+        json_to_value(json).map_err(|_| AetherErrorCode::InvalidJSON)
+    })
+}
+
+/// Set every variable in a batch as a global, in the order they were added
+///
+/// The batch is left unchanged, so it can be applied to several engines.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - batch: Batch handle
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if a pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_var_batch(
+    handle: *mut AetherHandle,
+    batch: *const AetherVarBatch,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || batch.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let batch = &*(batch as *const VarBatch);
+        for (name, value) in &batch.slots[..batch.len] {
+            engine.set_global(name, value.clone());
+        }
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Forbid scripts from defining or referencing identifiers with given prefixes
+///
+/// Checked at parse time: code using a denied name fails with a ParseError
+/// before it runs. Dictionary keys and strings are not affected. An empty
+/// array removes the restriction.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - prefixes_json: JSON array of prefix strings, e.g. `["SYSTEM_"]`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the deny list was set
+/// - InvalidJSON (5) if `prefixes_json` is not a JSON array of strings
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_deny_list(
+    handle: *mut AetherHandle,
+    prefixes_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || prefixes_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            AetherErrorCode::InvalidJSON as c_int
+        };
+
+        let json_str = match CStr::from_ptr(prefixes_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(e.to_string()),
+        };
+        match serde_json::from_str::<Vec<String>>(json_str) {
+            Ok(prefixes) => {
+                engine.set_deny_list(prefixes);
+                AetherErrorCode::Success as c_int
+            }
+            Err(e) => fail(format!("Expected a JSON array of strings: {}", e)),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Keep only the builtins in the given groups, disabling the rest
+///
+/// Group names are "core", "io", "trace", "array", "dict", "string", "math",
+/// "random", "time", "precise", "json", "payroll", "filesystem" and "network".
+/// Calling a disabled builtin fails with an undefined variable error. Disabled
+/// groups cannot be enabled again on the same engine.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - groups_json: JSON array of group names, e.g. `["math", "string"]`
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the groups were applied
+/// - InvalidJSON (5) if `groups_json` is not a JSON array of strings
+/// - InvalidArgument (7) if a group name is unknown
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_builtin_groups(
+    handle: *mut AetherHandle,
+    groups_json: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || groups_json.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+
+        let fail = |msg: String, code: AetherErrorCode| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let json_str = match CStr::from_ptr(groups_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(e.to_string(), AetherErrorCode::InvalidJSON),
+        };
+        let groups = match serde_json::from_str::<Vec<String>>(json_str) {
+            Ok(groups) => groups,
+            Err(e) => {
+                return fail(
+                    format!("Expected a JSON array of strings: {}", e),
+                    AetherErrorCode::InvalidJSON,
+                );
+            }
+        };
+        let groups: Vec<&str> = groups.iter().map(String::as_str).collect();
+        match engine.set_builtin_groups(&groups) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(e, AetherErrorCode::InvalidArgument),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Register a module whose top-level definitions scripts reach as `NAME.FUNC(...)`
+///
+/// The module is only parsed here; it is evaluated the first time a script
+/// references it. Modules may reference each other, and a cycle between their
+/// top-level code fails with a `circular import detected` runtime error.
+/// Registering the same name again replaces the module.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Module name (a valid identifier, e.g. `RULES`)
+/// - code: C string containing the module's Aether code
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if the module was registered
+/// - ParseError (1) if the module code does not parse
+/// - InvalidArgument (7) if `name` is not a valid identifier
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_add_module(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    code: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || name.is_null() || code.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+        let (Ok(name_str), Ok(code_str)) =
+            (CStr::from_ptr(name).to_str(), CStr::from_ptr(code).to_str())
+        else {
+            return AetherErrorCode::InvalidArgument as c_int;
+        };
+
+        engine.clear_error_kind();
+        match engine.add_module(name_str, code_str) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => {
+                set_error(error, e);
+                error_code(engine, AetherErrorCode::InvalidArgument) as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Call a function by name with JSON-encoded arguments
+///
+/// The function is resolved like a script identifier (script functions,
+/// builtins, then host functions), so a script defining `Func CALC(A, B)` can
+/// be loaded once with `aether_eval` and then called repeatedly.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Function name
+/// - args_json: Arguments as a JSON array (e.g. `[5, 6]`)
+/// - result: Output parameter for the JSON-encoded result (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - Success (0) on success
+/// - InvalidJSON (5) if `args_json` is not a JSON array
+/// - RuntimeError (2) if the call failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_call(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    args_json: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || name.is_null()
+        || args_json.is_null()
+        || result.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *result = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidArgument, e.to_string()),
+        };
+        let json_str = match CStr::from_ptr(args_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e.to_string()),
+        };
+        let args = match json_to_value(json_str) {
+            Ok(Value::Array(args)) => args,
+            Ok(_) => {
+                return fail(
+                    AetherErrorCode::InvalidJSON,
+                    "Expected a JSON array".to_string(),
+                );
+            }
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.call(name_str, args) {
+            Ok(val) => match CString::new(value_to_json(&val, engine.sorted_map_keys())) {
+                Ok(cstr) => {
+                    *result = cstr.into_raw();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(e) => fail(AetherErrorCode::RuntimeError, e),
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Evaluate code that produces a function and return a callable handle
+///
+/// The result may be a named function, a lambda (keeping its captured
+/// variables) or a builtin, e.g. `Lambda X -> (X * 2)` or `SCORE` after a
+/// `Func SCORE(...)` definition. The handle must only be called on the engine
+/// that produced it, from the thread that owns that engine.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - func: Output parameter for the function handle (must be freed with aether_function_free)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - Success (0) on success
+/// - ParseError (1) or RuntimeError (2) if evaluation failed or the result is not a function
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_eval_function(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    func: *mut *mut AetherFunction,
+    error: *mut *mut c_char,
+) -> c_int {
+    eval_typed(handle, code, func, error, |engine, code| {
+        match engine.eval(code)? {
+            value @ (Value::Function { .. } | Value::BuiltIn { .. }) => {
+                Ok(Box::into_raw(Box::new(value)) as *mut AetherFunction)
+            }
+            other => Err(engine.result_type_error("Function", &other)),
+        }
+    })
+}
+
+/// Call a function handle with JSON-encoded arguments
+///
+/// # Parameters
+/// - handle: Aether engine handle that produced `func`
+/// - func: Function handle from `aether_eval_function`
+/// - args_json: Arguments as a JSON array (e.g. `[5, 6]`)
+/// - result: Output parameter for the JSON-encoded result (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - Success (0) on success
+/// - InvalidJSON (5) if `args_json` is not a JSON array
+/// - RuntimeError (2) if the call failed
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_function_call(
+    handle: *mut AetherHandle,
+    func: *const AetherFunction,
+    args_json: *const c_char,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null()
+        || func.is_null()
+        || args_json.is_null()
+        || result.is_null()
+        || error.is_null()
+    {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(panic::AssertUnwindSafe(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let func = &*(func as *const Value);
+        *result = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let json_str = match CStr::from_ptr(args_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e.to_string()),
+        };
+        let args = match json_to_value(json_str) {
+            Ok(Value::Array(args)) => args,
+            Ok(_) => {
+                return fail(
+                    AetherErrorCode::InvalidJSON,
+                    "Expected a JSON array".to_string(),
+                );
+            }
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match engine.call_value(func, args) {
+            Ok(val) => match CString::new(value_to_json(&val, engine.sorted_map_keys())) {
+                Ok(cstr) => {
+                    *result = cstr.into_raw();
+                    AetherErrorCode::Success as c_int
+                }
+                Err(_) => AetherErrorCode::RuntimeError as c_int,
+            },
+            Err(e) => fail(AetherErrorCode::RuntimeError, e),
+        }
+    }));
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Free a function handle
+///
+/// # Parameters
+/// - func: Function handle from `aether_eval_function`
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_function_free(func: *mut AetherFunction) {
+    if !func.is_null() {
+        let _ = panic::catch_unwind(|| unsafe {
+            let _ = Box::from_raw(func as *mut Value);
+        });
+    }
+}
+
+/// Get a variable's value as JSON
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Variable name
+/// - value_json: Output parameter (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if variable was found
+/// - VariableNotFound (6) if variable doesn't exist
+/// - Non-zero error code for other failures
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `name` must be a valid pointer to a null-terminated C string
+/// - `value_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_get_global(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    value_json: *mut *mut c_char,
+) -> c_int {
+    if handle.is_null() || name.is_null() || value_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+        };
+
+        // 直接从环境获取变量值
+        let value = engine.evaluator.get_global(name_str);
+
+        match value {
+            Some(val) => {
+                let json_str = value_to_json(&val, engine.sorted_map_keys());
+                match CString::new(json_str) {
+                    Ok(cstr) => {
+                        *value_json = cstr.into_raw();
+                        AetherErrorCode::Success as c_int
+                    }
+                    Err(_) => AetherErrorCode::RuntimeError as c_int,
+                }
+            }
+            None => AetherErrorCode::VariableNotFound as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Reset the runtime environment (clears all variables)
+///
+/// # Parameters
+/// - handle: Aether engine handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_reset_env(handle: *mut AetherHandle) {
+    if handle.is_null() {
+        return;
+    }
+
+    let _ = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.reset_env();
+    });
+}
+
+/// Load definition-only prelude code that survives `aether_reset_env`
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing only `Func`/`Generator` definitions
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - Success (0) if the prelude was loaded
+/// - ParseError (1) if the code could not be parsed
+/// - InvalidArgument (7) if the code contains non-definition statements
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_load_prelude(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        *error = std::ptr::null_mut();
+        let code_str = match CStr::from_ptr(code).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
+        };
+
+        engine.clear_error_kind();
+        match engine.load_prelude(code_str) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => {
+                set_error(error, e);
+                error_code(engine, AetherErrorCode::InvalidArgument) as c_int
+            }
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+// ============================================================
+// Trace Operations
+// ============================================================
+
+/// Get all trace entries as JSON array
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - trace_json: Output parameter (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if trace was retrieved
+/// - Non-zero error code if failed
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_take_trace(
+    handle: *mut AetherHandle,
+    trace_json: *mut *mut c_char,
+) -> c_int {
+    if handle.is_null() || trace_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let traces = engine.take_trace();
+
+        let json_array = json!(traces).to_string();
+        match CString::new(json_array) {
+            Ok(cstr) => {
+                *trace_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Clear the trace buffer
+///
+/// # Parameters
+/// - handle: Aether engine handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_clear_trace(handle: *mut AetherHandle) {
+    if handle.is_null() {
+        return;
+    }
+
+    let _ = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.clear_trace();
+    });
+}
+
+/// Get structured trace entries as JSON
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - trace_json: Output parameter (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if trace was retrieved
+/// - Non-zero error code if failed
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_trace_records(
+    handle: *mut AetherHandle,
+    trace_json: *mut *mut c_char,
+) -> c_int {
+    if handle.is_null() || trace_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let records = engine.trace_records();
+
+        // Convert TraceEntry to JSON
+        let json_array: Vec<serde_json::Value> = records
+            .iter()
+            .map(|entry| {
+                json!({
+                    "level": format!("{:?}", entry.level),
+                    "category": entry.category,
+                    "timestamp": entry.timestamp.elapsed().as_secs(),
+                    "values": entry
+                        .values
+                        .iter()
+                        .map(|v| value_to_json(v, engine.sorted_map_keys()))
+                        .collect::<Vec<_>>(),
+                    "label": entry.label,
+                    "engine": engine.name(),
+                })
+            })
+            .collect();
+
+        match CString::new(json!(json_array).to_string()) {
+            Ok(cstr) => {
+                *trace_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Get trace statistics as JSON
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - stats_json: Output parameter (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if stats were retrieved
+/// - Non-zero error code if failed
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `stats_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_trace_stats(
+    handle: *mut AetherHandle,
+    stats_json: *mut *mut c_char,
+) -> c_int {
+    if handle.is_null() || stats_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let stats = engine.trace_stats();
+
+        let json_stats = json!({
+            "total_entries": stats.total_entries,
+            "by_level": stats.by_level,
+            "by_category": stats.by_category,
+            "buffer_size": stats.buffer_size,
+            "buffer_full": stats.buffer_full,
+        })
+        .to_string();
+
+        match CString::new(json_stats) {
+            Ok(cstr) => {
+                *stats_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    match panic_result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+// ============================================================
+// Execution Limits
+// ============================================================
+
+/// Set execution limits
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - limits: Limits configuration
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `limits` must be a valid pointer to an AetherLimits struct
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_set_limits(handle: *mut AetherHandle, limits: *const AetherLimits) {
+    if handle.is_null() || limits.is_null() {
+        return;
+    }
+
+    let _ = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let limits_ref = &*limits;
+
+        let rust_limits = crate::runtime::ExecutionLimits {
+            max_steps: if limits_ref.max_steps < 0 {
+                None
+            } else {
+                Some(limits_ref.max_steps as usize)
+            },
+            max_recursion_depth: if limits_ref.max_recursion_depth < 0 {
+                None
+            } else {
+                Some(limits_ref.max_recursion_depth as usize)
+            },
+            max_duration_ms: if limits_ref.max_duration_ms < 0 {
+                None
+            } else {
+                Some(limits_ref.max_duration_ms as u64)
+            },
+            max_memory_bytes: None,
+        };
+
+        engine.set_limits(rust_limits);
+    });
+}
+
+/// Get current execution limits
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - limits: Output parameter
+///
+/// # Safety
+/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
+/// - `limits` must be a valid pointer to an AetherLimits struct that will be filled with the current limits
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn aether_get_limits(handle: *mut AetherHandle, limits: *mut AetherLimits) {
+    if handle.is_null() || limits.is_null() {
+        return;
+    }
+
+    let _ = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let rust_limits = engine.limits();
+
+        (*limits).max_steps = match rust_limits.max_steps {
+            Some(v) => v as c_int,
+            None => -1,
+        };
+        (*limits).max_recursion_depth = match rust_limits.max_recursion_depth {
+            Some(v) => v as c_int,
+            None => -1,
+        };
+        (*limits).max_duration_ms = match rust_limits.max_duration_ms {
+            Some(v) => v as c_int,
+            None => -1,
+        };
+    });
+}
+
+/// Get every limit configured on the engine as JSON
+///
+/// Unlike `aether_get_limits`, this also covers the limits set individually
+/// (result size, array length, output bytes, functions, nesting depth), e.g.
+/// `{"max_steps": 100000, "max_array_length": 100000, "max_output_bytes": null, ...}`.
+/// `null` means unlimited.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - limits_json: Output parameter for the JSON object (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_get_configured_limits(
+    handle: *mut AetherHandle,
+    limits_json: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || limits_json.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        *limits_json = std::ptr::null_mut();
+
+        let json = serde_json::to_string(&engine.configured_limits()).unwrap_or_default();
+        match CString::new(json) {
+            Ok(cstr) => {
+                *limits_json = cstr.into_raw();
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::RuntimeError as c_int,
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Set the engine name used to label errors and trace records
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: C string with the name, or NULL to clear it
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_name(handle: *mut AetherHandle, name: *const c_char) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        if name.is_null() {
+            engine.set_name(None);
+        } else {
+            let name_str = CStr::from_ptr(name).to_string_lossy().into_owned();
+            engine.set_name(Some(name_str));
+        }
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the maximum size of an evaluation result
+///
+/// Results whose string form is larger than `max_bytes` are refused with a
+/// RuntimeError before being copied across the FFI boundary.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - max_bytes: Maximum result size in bytes (negative = unlimited)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_max_result_size(handle: *mut AetherHandle, max_bytes: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let max = if max_bytes < 0 {
+            None
+        } else {
+            Some(max_bytes as usize)
+        };
+        engine.set_max_result_size(max);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the maximum number of elements a single array may hold
+///
+/// Building or growing an array past the limit aborts evaluation with a
+/// RuntimeError.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - max_length: Maximum array length (negative = unlimited)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_max_array_length(
+    handle: *mut AetherHandle,
+    max_length: c_int,
+) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let max = if max_length < 0 {
+            None
+        } else {
+            Some(max_length as usize)
+        };
+        engine.set_max_array_length(max);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the maximum number of bytes PRINT/PRINTLN may write per evaluation
+///
+/// Bytes are counted as they are written to stdout, the `aether_set_output`
+/// callback or captured output, and the count restarts with every top-level
+/// evaluation. Output that would exceed the limit is not written; evaluation
+/// aborts with an "Output limit exceeded" RuntimeError instead.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - max_bytes: Maximum output bytes (negative = unlimited)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_max_output_bytes(
+    handle: *mut AetherHandle,
+    max_bytes: c_int,
+) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let max = if max_bytes < 0 {
+            None
+        } else {
+            Some(max_bytes as usize)
+        };
+        engine.set_max_output_bytes(max);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the maximum number of functions a script may define per evaluation
+///
+/// Every evaluated `Func` or `Generator` definition counts once, and the count
+/// restarts with every top-level evaluation. Prelude functions are not counted.
+/// A definition that would exceed the limit is not made; evaluation aborts
+/// with a "Function definition limit exceeded" RuntimeError instead.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - max_functions: Maximum number of definitions (negative = unlimited)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_max_functions(
+    handle: *mut AetherHandle,
+    max_functions: c_int,
+) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let max = if max_functions < 0 {
+            None
+        } else {
+            Some(max_functions as usize)
+        };
+        engine.set_max_functions(max);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the maximum nesting depth accepted by the parser
+///
+/// Every `{ }` block and every parenthesis, array, dictionary, call or index
+/// bracket opens one level. Deeper code is rejected with a "Nesting too deep"
+/// ParseError before it can exhaust the parser's stack. Changing the limit
+/// clears the AST cache.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - max_depth: Maximum nesting depth (negative = unlimited)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_max_nesting_depth(
+    handle: *mut AetherHandle,
+    max_depth: c_int,
+) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let max = if max_depth < 0 {
+            None
+        } else {
+            Some(max_depth as usize)
+        };
+        engine.set_max_nesting_depth(max);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Forbid recursive calls to user functions
+///
+/// When enabled, calling a function that is already running, directly or
+/// through other functions, fails with a "Recursion is not allowed" runtime
+/// error. This guarantees call chains are finite; loops are unaffected.
+/// Tail-call optimization is skipped while enabled.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - enabled: non-zero to forbid recursion, 0 to allow it (default)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_no_recursion(handle: *mut AetherHandle, enabled: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_no_recursion(enabled != 0);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Call a host callback when evaluation approaches a limit
+///
+/// The callback fires the first time usage reaches `percent` (clamped to
+/// 1..=100) of a configured limit: steps, recursion depth, duration or array
+/// length. Each kind warns at most once per evaluation. Unset limits never warn.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - percent: Threshold as a percentage of the limit
+/// - callback: Warning callback (see `AetherLimitWarningCallback`); NULL removes the hook
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_limit_warning_hook(
+    handle: *mut AetherHandle,
+    percent: c_int,
+    callback: AetherLimitWarningCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        match callback {
+            Some(callback) => {
+                let percent = percent.clamp(1, 100) as u8;
+                engine.set_limit_warning_hook(percent, move |kind, used, limit| {
+                    let kind = match kind {
+                        LimitKind::Steps => c"steps",
+                        LimitKind::RecursionDepth => c"recursion_depth",
+                        LimitKind::Duration => c"duration_ms",
+                        LimitKind::ArrayLength => c"array_length",
+                    };
+                    callback(user_data, kind.as_ptr(), used, limit);
+                });
+            }
+            None => engine.clear_limit_warning_hook(),
+        }
+        AetherErrorCode::Success as c_int
+    });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Call a host callback every `every` steps of an evaluation, e.g. to show progress
+///
+/// Steps are counted like the step limit and restart with each evaluation;
+/// `every` is raised to at least 1. Pair it with an interrupt handle to cancel
+/// long-running scripts from the callback or another thread.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - every: Number of steps between calls
+/// - callback: Progress callback (see `AetherProgressCallback`); NULL removes the hook
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_progress_hook(
+    handle: *mut AetherHandle,
+    every: u64,
+    callback: AetherProgressCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        match callback {
+            Some(callback) => {
+                engine.set_progress_hook(every, move |steps| callback(user_data, steps));
+            }
+            None => engine.clear_progress_hook(),
+        }
+        AetherErrorCode::Success as c_int
+    });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Call a host callback before every function call, e.g. for audit logging
+///
+/// Recursive calls fire once per level, except self tail calls that the
+/// optimizer turns into loops (disable it with `aether_set_optimization`).
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - callback: Call hook (see `AetherCallHookCallback`); NULL removes the hook
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_call_hook(
+    handle: *mut AetherHandle,
+    callback: AetherCallHookCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        match callback {
+            Some(callback) => engine.set_call_hook(move |name, args| {
+                let args_json =
+                    serde_json::Value::Array(args.iter().map(json_from_value).collect());
+                let (Ok(name), Ok(args_json)) =
+                    (CString::new(name), CString::new(args_json.to_string()))
+                else {
+                    return;
+                };
+                callback(user_data, name.as_ptr(), args_json.as_ptr());
+            }),
+            None => engine.clear_call_hook(),
+        }
+        AetherErrorCode::Success as c_int
+    });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Get the IO permissions of an engine
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - permissions: Output parameter (each field is 1 if enabled, 0 otherwise)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if either pointer is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_get_permissions(
+    handle: *mut AetherHandle,
+    permissions: *mut AetherPermissions,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || permissions.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &*(handle as *const Aether);
+        let perms = engine.permissions();
+        (*permissions).filesystem_enabled = perms.filesystem_enabled as c_int;
+        (*permissions).network_enabled = perms.network_enabled as c_int;
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set integer overflow behavior for `+`, `-` and `*`
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - mode: 0 = Error (default), 1 = Wrap, 2 = Saturate, 3 = BigInt (promote to
+///   arbitrary-precision integers; read results with `aether_eval_bigint`)
+///
+/// # Returns
+/// - Success (0) on success
+/// - InvalidArgument (7) if `mode` is not a known value
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_int_overflow(handle: *mut AetherHandle, mode: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let mode = match mode {
+        0 => crate::runtime::IntOverflowMode::Error,
+        1 => crate::runtime::IntOverflowMode::Wrap,
+        2 => crate::runtime::IntOverflowMode::Saturate,
+        3 => crate::runtime::IntOverflowMode::BigInt,
+        _ => return AetherErrorCode::InvalidArgument as c_int,
+    };
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_int_overflow(mode);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the behavior of `+` between a string and a non-string
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - mode: 0 = Strict (default, type error), 1 = Coerce (stringify the other side)
+///
+/// # Returns
+/// - Success (0) on success
+/// - InvalidArgument (7) if `mode` is not a known value
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_string_coercion(handle: *mut AetherHandle, mode: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let mode = match mode {
+        0 => crate::runtime::StringCoercion::Strict,
+        1 => crate::runtime::StringCoercion::Coerce,
+        _ => return AetherErrorCode::InvalidArgument as c_int,
+    };
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_string_coercion(mode);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Set the behavior of `/` and `%` when the divisor is zero
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - mode: 0 = Error (default, runtime error), 1 = Infinity (IEEE 754 result:
+///   +/-infinity, or NaN for `0 / 0` and `%`), 2 = Zero (result is 0)
+///
+/// # Returns
+/// - Success (0) on success
+/// - InvalidArgument (7) if `mode` is not a known value
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_div_by_zero(handle: *mut AetherHandle, mode: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let mode = match mode {
+        0 => crate::runtime::DivByZeroMode::Error,
+        1 => crate::runtime::DivByZeroMode::Infinity,
+        2 => crate::runtime::DivByZeroMode::Zero,
+        _ => return AetherErrorCode::InvalidArgument as c_int,
+    };
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_div_by_zero(mode);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Make `/` between integers that do not divide evenly yield exact fractions
+///
+/// When enabled, `(1 / 3)` evaluates to the fraction `1/3` instead of a float,
+/// and later `+`, `-`, `*` and `/` with integers or fractions stay exact.
+/// Results are returned as `"numer/denom"` strings (a JSON string in JSON
+/// output); even quotients such as `(6 / 3)` stay plain numbers. Fractions use
+/// big integers and are much slower than numbers.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - enabled: non-zero to enable, 0 to disable (default)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_rational_division(handle: *mut AetherHandle, enabled: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_rational_division(enabled != 0);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Seed the engine's RNG used by RANDOM/RANDOM_INT
+///
+/// The seed only affects this engine; the same seed yields the same sequence.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - seed: RNG seed
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_seed(handle: *mut AetherHandle, seed: u64) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_seed(seed);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Freeze the time returned by NOW()
+///
+/// NOW() returns `seconds` instead of reading the system clock until
+/// aether_clear_clock is called. Combined with aether_set_seed this makes
+/// evaluation fully deterministic.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - seconds: Seconds since the Unix epoch (UTC), may be fractional or negative
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+/// - InvalidArgument (7) if `seconds` is not a representable time (NaN, infinite)
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_clock(handle: *mut AetherHandle, seconds: f64) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        match Value::Number(seconds).to_system_time() {
+            Some(time) => {
+                engine.set_clock(Some(time));
+                AetherErrorCode::Success as c_int
+            }
+            None => AetherErrorCode::InvalidArgument as c_int,
+        }
+    });
+
+    match result {
+        Ok(code) => code,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Make NOW() read the system clock again after aether_set_clock
+///
+/// # Parameters
+/// - handle: Aether engine handle
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_clear_clock(handle: *mut AetherHandle) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_clock(None);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+// ============================================================
+// Host Functions
+// ============================================================
+
+unsafe extern "C" {
+    fn free(ptr: *mut c_void);
+}
+
+/// Opaque user data passed back to host callbacks
+///
+/// The host is responsible for making the pointee safe to use from the
+/// threads it evaluates code on.
+#[derive(Clone, Copy)]
+struct HostUserData(*mut c_void);
+
+unsafe impl Send for HostUserData {}
+unsafe impl Sync for HostUserData {}
+
+impl HostUserData {
+    fn get(self) -> *mut c_void {
+        self.0
+    }
+}
+
+/// Wrap a C callback as a host function
+fn host_fn_from_callback(
+    callback: unsafe extern "C" fn(*mut c_void, *const c_char, *mut c_int) -> *mut c_char,
+    user_data: HostUserData,
+) -> impl Fn(&[Value]) -> Result<Value, String> + Send + Sync + 'static {
+    move |args: &[Value]| {
+        let args_json = serde_json::Value::Array(args.iter().map(json_from_value).collect());
+        let args_cstr = CString::new(args_json.to_string()).map_err(|e| e.to_string())?;
+
+        let mut is_error: c_int = 0;
+        let out = unsafe { callback(user_data.get(), args_cstr.as_ptr(), &mut is_error) };
+        host_callback_result(out, is_error)
+    }
+}
+
+/// Decode the string returned by a host callback into a call result
+fn host_callback_result(out: *mut c_char, is_error: c_int) -> Result<Value, String> {
+    let text = if out.is_null() {
+        None
+    } else {
+        let text = unsafe { CStr::from_ptr(out) }
+            .to_string_lossy()
+            .into_owned();
+        unsafe { free(out as *mut c_void) };
+        Some(text)
+    };
+
+    match (is_error != 0, text) {
+        (true, msg) => Err(msg.unwrap_or_else(|| "host function failed".to_string())),
+        (false, None) => Ok(Value::Null),
+        (false, Some(json)) => json_to_value(&json),
+    }
+}
+
+/// Wrap a context-aware C callback as a host function
+fn host_context_fn_from_callback(
+    callback: unsafe extern "C" fn(
+        *mut c_void,
+        *mut c_void,
+        *const c_char,
+        *mut c_int,
+    ) -> *mut c_char,
+    user_data: HostUserData,
+) -> impl Fn(&crate::runtime::HostContext, &[Value]) -> Result<Value, String> + Send + Sync + 'static
+{
+    move |ctx: &crate::runtime::HostContext, args: &[Value]| {
+        let args_json = serde_json::Value::Array(args.iter().map(json_from_value).collect());
+        let args_cstr = CString::new(args_json.to_string()).map_err(|e| e.to_string())?;
+        let context = ctx
+            .get::<HostUserData>()
+            .map_or(std::ptr::null_mut(), |c| c.get());
+
+        let mut is_error: c_int = 0;
+        let out = unsafe { callback(user_data.get(), context, args_cstr.as_ptr(), &mut is_error) };
+        host_callback_result(out, is_error)
+    }
+}
+
+/// Register a host function on a single engine
+///
+/// Script variables and builtins with the same name take precedence.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Function name as seen by scripts
+/// - arity: Number of arguments the function takes
+/// - callback: Host callback (see `AetherHostCallback`)
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle`, `name` or `callback` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_register_function(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    arity: c_int,
+    callback: AetherHostCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    let Some(callback) = callback else {
+        return AetherErrorCode::NullPointer as c_int;
+    };
+    if handle.is_null() || name.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    if arity < 0 {
+        return AetherErrorCode::InvalidArgument as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
+        };
+
+        engine.register_function(
+            name_str,
+            arity as usize,
+            host_fn_from_callback(callback, HostUserData(user_data)),
+        );
+        AetherErrorCode::Success as c_int
+    });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Register a context-aware host function on a single engine
+///
+/// The callback receives the `context` pointer passed to
+/// `aether_eval_with_context`, e.g. a per-request DB handle.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Function name as seen by scripts
+/// - arity: Number of arguments the function takes
+/// - callback: Host callback (see `AetherHostContextCallback`)
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle`, `name` or `callback` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_register_function_with_context(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    arity: c_int,
+    callback: AetherHostContextCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    let Some(callback) = callback else {
+        return AetherErrorCode::NullPointer as c_int;
+    };
+    if handle.is_null() || name.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    if arity < 0 {
+        return AetherErrorCode::InvalidArgument as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let name_str = match CStr::from_ptr(name).to_str() {
+            Ok(s) => s,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
+        };
+
+        engine.register_function_with_context(
+            name_str,
+            arity as usize,
+            host_context_fn_from_callback(callback, HostUserData(user_data)),
+        );
+        AetherErrorCode::Success as c_int
+    });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Evaluate Aether code with a per-call context pointer
 ///
-/// # Returns
-/// - 0 (Success) if variable was found
-/// - VariableNotFound (6) if variable doesn't exist
-/// - Non-zero error code for other failures
+/// `context` is handed to context-aware host functions (see
+/// `aether_register_function_with_context`) for the duration of this call only.
 ///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `name` must be a valid pointer to a null-terminated C string
-/// - `value_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+/// # Parameters
+/// - handle: Aether engine handle
+/// - code: C string containing Aether code
+/// - context: Opaque pointer passed to context-aware callbacks (may be NULL)
+/// - result: Output parameter for result (must be freed with aether_free_string)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) if evaluation succeeded
+/// - Non-zero error code if evaluation failed
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_get_global(
+pub extern "C" fn aether_eval_with_context(
     handle: *mut AetherHandle,
+    code: *const c_char,
+    context: *mut c_void,
+    result: *mut *mut c_char,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || code.is_null() || result.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    unsafe {
+        *result = std::ptr::null_mut();
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let value =
+                    engine.eval_with_context(code, std::sync::Arc::new(HostUserData(context)))?;
+                set_result(engine, &value, result)
+            },
+        )
+    }
+}
+
+/// Get a handle that can interrupt the engine's evaluation from another thread
+///
+/// The engine itself must not be used concurrently; pass this handle to the
+/// other thread instead.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+///
+/// Returns: Pointer to AetherInterrupt (must be freed with aether_interrupt_free),
+/// or NULL if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_interrupt_handle(handle: *mut AetherHandle) -> *mut AetherInterrupt {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return std::ptr::null_mut();
+    }
+
+    let engine = unsafe { &*(handle as *const Aether) };
+    Box::into_raw(Box::new(engine.interrupt_handle())) as *mut AetherInterrupt
+}
+
+/// Interrupt the evaluation currently running on the handle's engine
+///
+/// The evaluation stops before its next statement and fails with
+/// RuntimeError ("Evaluation interrupted"); the engine stays usable. Safe to
+/// call from any thread. Interrupts sent while the engine is idle are ignored.
+///
+/// # Parameters
+/// - interrupt: Interrupt handle from aether_interrupt_handle
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `interrupt` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_interrupt(interrupt: *mut AetherInterrupt) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if interrupt.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let interrupt = unsafe { &*(interrupt as *const crate::runtime::InterruptHandle) };
+    interrupt.interrupt();
+    AetherErrorCode::Success as c_int
+}
+
+/// Free an interrupt handle
+///
+/// The engine is not affected; this is safe to call before or after aether_free.
+///
+/// # Parameters
+/// - interrupt: Interrupt handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_interrupt_free(interrupt: *mut AetherInterrupt) {
+    if !interrupt.is_null() {
+        unsafe {
+            let _ = Box::from_raw(interrupt as *mut crate::runtime::InterruptHandle);
+        }
+    }
+}
+
+/// Create a host function registry that can be shared by several engines
+///
+/// Returns: Pointer to AetherRegistry (must be freed with aether_registry_free),
+/// or null if construction panicked
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_registry_new() -> *mut AetherRegistry {
+    match panic::catch_unwind(crate::runtime::HostRegistry::new) {
+        Ok(registry) => Box::into_raw(Box::new(registry)) as *mut AetherRegistry,
+        Err(_) => std::ptr::null_mut(),
+    }
+}
+
+/// Free a host function registry
+///
+/// Engines the registry is attached to keep their own reference, so this is
+/// safe to call while they are still alive.
+///
+/// # Parameters
+/// - registry: Registry handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_registry_free(registry: *mut AetherRegistry) {
+    if !registry.is_null() {
+        let _ = panic::catch_unwind(|| unsafe {
+            let _ = Box::from_raw(registry as *mut crate::runtime::HostRegistry);
+        });
+    }
+}
+
+/// Register a host function in a shared registry
+///
+/// The function becomes visible immediately to every engine the registry is
+/// attached to. The registry can be read concurrently by engines on other threads.
+///
+/// # Parameters
+/// - registry: Registry handle
+/// - name: Function name as seen by scripts
+/// - arity: Number of arguments the function takes
+/// - callback: Host callback (see `AetherHostCallback`)
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `registry`, `name` or `callback` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_registry_register(
+    registry: *mut AetherRegistry,
     name: *const c_char,
-    value_json: *mut *mut c_char,
+    arity: c_int,
+    callback: AetherHostCallback,
+    user_data: *mut c_void,
 ) -> c_int {
-    if handle.is_null() || name.is_null() || value_json.is_null() {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    let Some(callback) = callback else {
         return AetherErrorCode::NullPointer as c_int;
+    };
+    if registry.is_null() || name.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    if arity < 0 {
+        return AetherErrorCode::InvalidArgument as c_int;
     }
 
-    let panic_result = panic::catch_unwind(|| unsafe {
-        let engine = &mut *(handle as *mut Aether);
+    let result = panic::catch_unwind(|| unsafe {
+        let registry = &*(registry as *const crate::runtime::HostRegistry);
         let name_str = match CStr::from_ptr(name).to_str() {
             Ok(s) => s,
-            Err(_) => return AetherErrorCode::RuntimeError as c_int,
+            Err(_) => return AetherErrorCode::InvalidArgument as c_int,
         };
 
-        // 直接从环境获取变量值
-        let value = engine.evaluator.get_global(name_str);
+        registry.register(
+            name_str,
+            arity as usize,
+            host_fn_from_callback(callback, HostUserData(user_data)),
+        );
+        AetherErrorCode::Success as c_int
+    });
 
-        match value {
-            Some(val) => {
-                let json_str = value_to_json(&val);
-                match CString::new(json_str) {
-                    Ok(cstr) => {
-                        *value_json = cstr.into_raw();
-                        AetherErrorCode::Success as c_int
-                    }
-                    Err(_) => AetherErrorCode::RuntimeError as c_int,
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Attach a shared host function registry to an engine
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - registry: Registry handle
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if either handle is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_attach_registry(
+    handle: *mut AetherHandle,
+    registry: *const AetherRegistry,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || registry.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let registry = &*(registry as *const crate::runtime::HostRegistry);
+        engine.attach_registry(registry.clone());
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Create read-only data that several engines can share without copying
+///
+/// The data is stored once; binding it to engines with `aether_set_shared_data`
+/// does not copy it, and engines on different threads may read it concurrently.
+///
+/// # Parameters
+/// - value_json: Data as JSON string
+/// - data: Output parameter for the shared data handle (must be freed with aether_shared_data_free)
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - InvalidJSON (5) if `value_json` is not valid JSON
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_shared_data_new(
+    value_json: *const c_char,
+    data: *mut *mut AetherSharedData,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if value_json.is_null() || data.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        *data = std::ptr::null_mut();
+        *error = std::ptr::null_mut();
+
+        let fail = |code: AetherErrorCode, msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
+            }
+            code as c_int
+        };
+
+        let json_str = match CStr::from_ptr(value_json).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e.to_string()),
+        };
+        let value = match json_to_value(json_str) {
+            Ok(v) => v,
+            Err(e) => return fail(AetherErrorCode::InvalidJSON, e),
+        };
+
+        match crate::runtime::SharedData::new(&value) {
+            Ok(shared) => {
+                *data = Box::into_raw(Box::new(shared)) as *mut AetherSharedData;
+                AetherErrorCode::Success as c_int
+            }
+            Err(e) => fail(AetherErrorCode::InvalidArgument, e),
+        }
+    });
+
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// Free a shared data handle
+///
+/// Engines the data is bound to keep their own reference, so this is safe to
+/// call while they are still alive.
+///
+/// # Parameters
+/// - data: Shared data handle
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_shared_data_free(data: *mut AetherSharedData) {
+    if !data.is_null() {
+        let _ = panic::catch_unwind(|| unsafe {
+            let _ = Box::from_raw(data as *mut crate::runtime::SharedData);
+        });
+    }
+}
+
+/// Bind shared data to a global name that scripts can read but not modify
+///
+/// Indexing the name (`NAME["key"][0]`) reads straight from the shared data and
+/// copies only the selected element. As with constants, scripts cannot rebind
+/// or modify the name, and the binding survives `aether_reset_env`.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - name: Variable name
+/// - data: Shared data handle
+/// - error: Output parameter for error message (must be freed with aether_free_string)
+///
+/// # Returns
+/// - 0 (Success) on success
+/// - InvalidArgument (7) if `name` is not a valid variable name
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_shared_data(
+    handle: *mut AetherHandle,
+    name: *const c_char,
+    data: *const AetherSharedData,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || name.is_null() || data.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let panic_result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        let shared = &*(data as *const crate::runtime::SharedData);
+        *error = std::ptr::null_mut();
+
+        let result = CStr::from_ptr(name)
+            .to_str()
+            .map_err(|e| e.to_string())
+            .and_then(|name_str| engine.set_shared_data(name_str, shared));
+        match result {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => {
+                if let Ok(cstr) = CString::new(e) {
+                    *error = cstr.into_raw();
                 }
+                AetherErrorCode::InvalidArgument as c_int
             }
-            None => AetherErrorCode::VariableNotFound as c_int,
         }
     });
 
-    match panic_result {
-        Ok(code) => code,
+    panic_result.unwrap_or(AetherErrorCode::Panic as c_int)
+}
+
+/// `io::Write` adapter that forwards output to a C callback
+struct CallbackWriter {
+    callback: unsafe extern "C" fn(*mut c_void, *const c_char, usize) -> c_int,
+    user_data: *mut c_void,
+}
+
+impl std::io::Write for CallbackWriter {
+    fn write(&mut self, buf: &[u8]) -> std::io::Result<usize> {
+        let status =
+            unsafe { (self.callback)(self.user_data, buf.as_ptr() as *const c_char, buf.len()) };
+        if status == 0 {
+            Ok(buf.len())
+        } else {
+            Err(std::io::Error::other(format!(
+                "output callback returned {}",
+                status
+            )))
+        }
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        Ok(())
+    }
+}
+
+/// Send PRINT/PRINTLN output to a host callback instead of stdout
+///
+/// If the callback rejects a chunk (returns non-zero), the running evaluation
+/// aborts with a RuntimeError whose message starts with "Output error".
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - callback: Output callback (see `AetherOutputCallback`); NULL restores stdout
+/// - user_data: Opaque pointer passed back to the callback
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_output(
+    handle: *mut AetherHandle,
+    callback: AetherOutputCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        match callback {
+            Some(callback) => engine.set_output(CallbackWriter {
+                callback,
+                user_data,
+            }),
+            None => engine.clear_output(),
+        }
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Treat static analysis warnings as errors
+///
+/// While enabled, code with any warning reported by validation (such as a
+/// variable that is set but never read) is not evaluated; evaluation fails
+/// with a ParseError listing every warning. Changing the setting clears the
+/// AST cache.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - enabled: Non-zero to reject code with warnings, 0 to allow it again
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_warnings_as_errors(
+    handle: *mut AetherHandle,
+    enabled: c_int,
+) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_warnings_as_errors(enabled != 0);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
+
+/// Forbid PRINT/PRINTLN output
+///
+/// While enabled, any PRINT or PRINTLN call aborts evaluation with a
+/// RuntimeError ("Output error: ...") instead of printing, which proves a
+/// script is output-free.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - enabled: Non-zero to forbid output, 0 to allow it again
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_no_output(handle: *mut AetherHandle, enabled: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_no_output(enabled != 0);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
         Err(_) => AetherErrorCode::Panic as c_int,
     }
 }
 
-/// Reset the runtime environment (clears all variables)
+/// Emit dictionary keys in sorted order
+///
+/// Dictionaries are hash maps, so by default their keys come out in an
+/// unspecified order that can change between runs. While enabled, PRINT,
+/// PRINTLN and every string or JSON result returned by this API list keys in
+/// byte order, including in nested dictionaries.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
+/// - enabled: Non-zero to sort keys, 0 for the default order
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
 #[unsafe(no_mangle)]
-pub extern "C" fn aether_reset_env(handle: *mut AetherHandle) {
+pub extern "C" fn aether_set_sorted_map_keys(handle: *mut AetherHandle, enabled: c_int) -> c_int {
     if handle.is_null() {
-        return;
+        return AetherErrorCode::NullPointer as c_int;
     }
 
-    let _ = panic::catch_unwind(|| unsafe {
+    let result = panic::catch_unwind(|| unsafe {
         let engine = &mut *(handle as *mut Aether);
-        engine.reset_env();
+        engine.set_sorted_map_keys(enabled != 0);
     });
-}
 
-// ============================================================
-// Trace Operations
-// ============================================================
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
 
-/// Get all trace entries as JSON array
+/// Format numbers in PRINT/PRINTLN output and string coercion for a locale
+///
+/// `tag` is a BCP-47 language tag such as `"en-US"` (`1,234,567.5`) or
+/// `"de-DE"` (`1.234.567,5`). An empty string restores the locale-independent
+/// default (`1234567.5`). Result values and JSON are not affected.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - trace_json: Output parameter (must be freed with aether_free_string)
+/// - tag: BCP-47 language tag, or `""` to reset
+/// - error: Output parameter for error message (must be freed with aether_free_string)
 ///
 /// # Returns
-/// - 0 (Success) if trace was retrieved
-/// - Non-zero error code if failed
-///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+/// - Success (0) on success
+/// - NullPointer (3) if `handle`, `tag` or `error` is NULL
+/// - InvalidArgument (7) if `tag` is not valid UTF-8 or names an unsupported locale
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_take_trace(
+pub extern "C" fn aether_set_locale(
     handle: *mut AetherHandle,
-    trace_json: *mut *mut c_char,
+    tag: *const c_char,
+    error: *mut *mut c_char,
 ) -> c_int {
-    if handle.is_null() || trace_json.is_null() {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || tag.is_null() || error.is_null() {
         return AetherErrorCode::NullPointer as c_int;
     }
 
     let panic_result = panic::catch_unwind(|| unsafe {
         let engine = &mut *(handle as *mut Aether);
-        let traces = engine.take_trace();
+        *error = std::ptr::null_mut();
 
-        let json_array = json!(traces).to_string();
-        match CString::new(json_array) {
-            Ok(cstr) => {
-                *trace_json = cstr.into_raw();
-                AetherErrorCode::Success as c_int
+        let fail = |msg: String| {
+            if let Ok(cstr) = CString::new(msg) {
+                *error = cstr.into_raw();
             }
-            Err(_) => AetherErrorCode::RuntimeError as c_int,
+            AetherErrorCode::InvalidArgument as c_int
+        };
+
+        let tag = match CStr::from_ptr(tag).to_str() {
+            Ok(s) => s,
+            Err(e) => return fail(e.to_string()),
+        };
+        let tag = if tag.is_empty() { None } else { Some(tag) };
+        match engine.set_locale(tag) {
+            Ok(()) => AetherErrorCode::Success as c_int,
+            Err(e) => fail(e),
         }
     });
 
@@ -480,205 +5528,267 @@ pub unsafe extern "C" fn aether_take_trace(
     }
 }
 
-/// Clear the trace buffer
+/// Set the text PRINT/PRINTLN put between their arguments
+///
+/// The default is a single space. Applies to stdout, `aether_set_output`
+/// callbacks and captured output alike.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
+/// - separator: Separator text, e.g. `","`
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` or `separator` is NULL
+/// - InvalidArgument (7) if `separator` is not valid UTF-8
 #[unsafe(no_mangle)]
-pub extern "C" fn aether_clear_trace(handle: *mut AetherHandle) {
-    if handle.is_null() {
-        return;
+pub extern "C" fn aether_set_print_separator(
+    handle: *mut AetherHandle,
+    separator: *const c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || separator.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
     }
 
-    let _ = panic::catch_unwind(|| unsafe {
+    let result = panic::catch_unwind(|| unsafe {
         let engine = &mut *(handle as *mut Aether);
-        engine.clear_trace();
+        match CStr::from_ptr(separator).to_str() {
+            Ok(text) => {
+                engine.set_print_separator(text);
+                AetherErrorCode::Success as c_int
+            }
+            Err(_) => AetherErrorCode::InvalidArgument as c_int,
+        }
     });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
 }
 
-/// Get structured trace entries as JSON
+/// Set the text PRINTLN appends after its arguments
+///
+/// The default is `"\n"`; PRINT never appends a terminator.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - trace_json: Output parameter (must be freed with aether_free_string)
+/// - terminator: Terminator text, e.g. `""` or `"\r\n"`
 ///
 /// # Returns
-/// - 0 (Success) if trace was retrieved
-/// - Non-zero error code if failed
-///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `trace_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` or `terminator` is NULL
+/// - InvalidArgument (7) if `terminator` is not valid UTF-8
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_trace_records(
+pub extern "C" fn aether_set_print_terminator(
     handle: *mut AetherHandle,
-    trace_json: *mut *mut c_char,
+    terminator: *const c_char,
 ) -> c_int {
-    if handle.is_null() || trace_json.is_null() {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() || terminator.is_null() {
         return AetherErrorCode::NullPointer as c_int;
     }
 
-    let panic_result = panic::catch_unwind(|| unsafe {
+    let result = panic::catch_unwind(|| unsafe {
         let engine = &mut *(handle as *mut Aether);
-        let records = engine.trace_records();
-
-        // Convert TraceEntry to JSON
-        let json_array: Vec<serde_json::Value> = records
-            .iter()
-            .map(|entry| {
-                json!({
-                    "level": format!("{:?}", entry.level),
-                    "category": entry.category,
-                    "timestamp": entry.timestamp.elapsed().as_secs(),
-                    "values": entry.values.iter().map(value_to_json).collect::<Vec<_>>(),
-                    "label": entry.label,
-                })
-            })
-            .collect();
-
-        match CString::new(json!(json_array).to_string()) {
-            Ok(cstr) => {
-                *trace_json = cstr.into_raw();
+        match CStr::from_ptr(terminator).to_str() {
+            Ok(text) => {
+                engine.set_print_terminator(text);
                 AetherErrorCode::Success as c_int
             }
-            Err(_) => AetherErrorCode::RuntimeError as c_int,
+            Err(_) => AetherErrorCode::InvalidArgument as c_int,
         }
     });
 
-    match panic_result {
-        Ok(code) => code,
-        Err(_) => AetherErrorCode::Panic as c_int,
-    }
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
 }
 
-/// Get trace statistics as JSON
+/// Evaluate Aether code and stream the result as JSON to a callback
+///
+/// The JSON is written in chunks through `callback` (see `AetherOutputCallback`)
+/// as it is encoded, so large arrays are never held in memory as one string.
+/// Nothing is written if evaluation fails. If the callback rejects a chunk,
+/// the JSON written so far is incomplete and a RuntimeError is returned.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - stats_json: Output parameter (must be freed with aether_free_string)
+/// - code: C string containing Aether code
+/// - callback: Receives the JSON chunks; must not be NULL
+/// - user_data: Opaque pointer passed back to the callback
+/// - error: Output parameter for error message (must be freed with aether_free_string)
 ///
 /// # Returns
-/// - 0 (Success) if stats were retrieved
-/// - Non-zero error code if failed
-///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `stats_json` must be a valid pointer to a `*mut c_char` that will be set to point to the result
+/// - 0 (Success) if the whole result was written
+/// - Non-zero error code if evaluation or writing failed
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_trace_stats(
+pub extern "C" fn aether_eval_json_to(
     handle: *mut AetherHandle,
-    stats_json: *mut *mut c_char,
+    code: *const c_char,
+    callback: AetherOutputCallback,
+    user_data: *mut c_void,
+    error: *mut *mut c_char,
 ) -> c_int {
-    if handle.is_null() || stats_json.is_null() {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    let Some(callback) = callback else {
+        return AetherErrorCode::NullPointer as c_int;
+    };
+    if handle.is_null() || code.is_null() || error.is_null() {
         return AetherErrorCode::NullPointer as c_int;
     }
 
-    let panic_result = panic::catch_unwind(|| unsafe {
-        let engine = &mut *(handle as *mut Aether);
-        let stats = engine.trace_stats();
-
-        let json_stats = json!({
-            "total_entries": stats.total_entries,
-            "by_level": stats.by_level,
-            "by_category": stats.by_category,
-            "buffer_size": stats.buffer_size,
-            "buffer_full": stats.buffer_full,
-        })
-        .to_string();
-
-        match CString::new(json_stats) {
-            Ok(cstr) => {
-                *stats_json = cstr.into_raw();
-                AetherErrorCode::Success as c_int
-            }
-            Err(_) => AetherErrorCode::RuntimeError as c_int,
-        }
-    });
-
-    match panic_result {
-        Ok(code) => code,
-        Err(_) => AetherErrorCode::Panic as c_int,
+    unsafe {
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let writer = CallbackWriter {
+                    callback,
+                    user_data,
+                };
+                Ok(engine.eval_json_to(code, writer)?)
+            },
+        )
     }
 }
 
-// ============================================================
-// Execution Limits
-// ============================================================
-
-/// Set execution limits
+/// Evaluate Aether code and pass the result to a callback one element at a time
+///
+/// If the result is an array, `callback` receives each element with its index
+/// in order; any other result is passed once with index 0. A non-zero return
+/// from the callback stops the iteration and a RuntimeError naming the index
+/// is returned. The callback is not called if evaluation fails.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - limits: Limits configuration
+/// - code: C string containing Aether code
+/// - callback: Receives the elements as JSON; must not be NULL
+/// - user_data: Opaque pointer passed back to the callback
+/// - error: Output parameter for error message (must be freed with aether_free_string)
 ///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `limits` must be a valid pointer to an AetherLimits struct
+/// # Returns
+/// - 0 (Success) if every element was delivered
+/// - Non-zero error code if evaluation failed or the callback stopped the iteration
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_set_limits(handle: *mut AetherHandle, limits: *const AetherLimits) {
-    if handle.is_null() || limits.is_null() {
-        return;
+pub extern "C" fn aether_eval_for_each(
+    handle: *mut AetherHandle,
+    code: *const c_char,
+    callback: AetherForEachCallback,
+    user_data: *mut c_void,
+    error: *mut *mut c_char,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    let Some(callback) = callback else {
+        return AetherErrorCode::NullPointer as c_int;
+    };
+    if handle.is_null() || code.is_null() || error.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
     }
 
-    let _ = panic::catch_unwind(|| unsafe {
-        let engine = &mut *(handle as *mut Aether);
-        let limits_ref = &*limits;
-
-        let rust_limits = crate::runtime::ExecutionLimits {
-            max_steps: if limits_ref.max_steps < 0 {
-                None
-            } else {
-                Some(limits_ref.max_steps as usize)
-            },
-            max_recursion_depth: if limits_ref.max_recursion_depth < 0 {
-                None
-            } else {
-                Some(limits_ref.max_recursion_depth as usize)
-            },
-            max_duration_ms: if limits_ref.max_duration_ms < 0 {
-                None
-            } else {
-                Some(limits_ref.max_duration_ms as u64)
+    unsafe {
+        run_eval(
+            handle,
+            CStr::from_ptr(code).to_bytes(),
+            error,
+            |engine, code| {
+                let sorted_keys = engine.sorted_map_keys();
+                let outcome = engine.eval_for_each(code, |index, value| {
+                    let json = CString::new(value_to_json(value, sorted_keys))
+                        .map_err(|e| e.to_string())?;
+                    match callback(user_data, index, json.as_ptr()) {
+                        0 => Ok(()),
+                        status => Err(format!(
+                            "Callback stopped iteration at index {} (status {})",
+                            index, status
+                        )),
+                    }
+                });
+                Ok(outcome?)
             },
-            max_memory_bytes: None,
+        )
+    }
+}
+
+/// File system backed by host callbacks
+struct CallbackFileSystem {
+    read: unsafe extern "C" fn(*mut c_void, *const c_char, *mut c_int) -> *mut c_char,
+    write: AetherWriteFileCallback,
+    user_data: *mut c_void,
+}
+
+impl crate::runtime::FileSystem for CallbackFileSystem {
+    fn read_file(&self, path: &str) -> Result<String, String> {
+        let path = CString::new(path).map_err(|e| e.to_string())?;
+        let mut is_error: c_int = 0;
+        let out = unsafe { (self.read)(self.user_data, path.as_ptr(), &mut is_error) };
+        let text = if out.is_null() {
+            None
+        } else {
+            let text = unsafe { CStr::from_ptr(out) }
+                .to_string_lossy()
+                .into_owned();
+            unsafe { free(out as *mut c_void) };
+            Some(text)
         };
 
-        engine.set_limits(rust_limits);
-    });
+        match (is_error != 0, text) {
+            (true, msg) => Err(msg.unwrap_or_else(|| "file read failed".to_string())),
+            (false, text) => Ok(text.unwrap_or_default()),
+        }
+    }
+
+    fn write_file(&self, path: &str, content: &str) -> Result<(), String> {
+        let Some(write) = self.write else {
+            return Err(format!("file system is read-only, cannot write '{}'", path));
+        };
+        let path = CString::new(path).map_err(|e| e.to_string())?;
+        let content = CString::new(content).map_err(|e| e.to_string())?;
+        match unsafe { write(self.user_data, path.as_ptr(), content.as_ptr()) } {
+            0 => Ok(()),
+            code => Err(format!("write callback failed with code {}", code)),
+        }
+    }
 }
 
-/// Get current execution limits
+/// Route the engine's file builtins through host callbacks
+///
+/// While set, `READ_FILE`, `WRITE_FILE`, `APPEND_FILE` and `FILE_EXISTS` never
+/// touch the disk; the remaining file builtins fail with a runtime error. The
+/// file builtins are only available when the engine has filesystem permission.
 ///
 /// # Parameters
 /// - handle: Aether engine handle
-/// - limits: Output parameter
+/// - read: Read callback (see `AetherReadFileCallback`); NULL restores the real file system
+/// - write: Write callback (see `AetherWriteFileCallback`); NULL denies all writes
+/// - user_data: Opaque pointer passed back to the callbacks
 ///
-/// # Safety
-/// - `handle` must be a valid pointer to an AetherHandle created by `aether_new` or `aether_new_with_permissions`
-/// - `limits` must be a valid pointer to an AetherLimits struct that will be filled with the current limits
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn aether_get_limits(handle: *mut AetherHandle, limits: *mut AetherLimits) {
-    if handle.is_null() || limits.is_null() {
-        return;
+pub extern "C" fn aether_set_file_system(
+    handle: *mut AetherHandle,
+    read: AetherReadFileCallback,
+    write: AetherWriteFileCallback,
+    user_data: *mut c_void,
+) -> c_int {
+    #![allow(clippy::not_unsafe_ptr_arg_deref)]
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
     }
 
-    let _ = panic::catch_unwind(|| unsafe {
+    let result = panic::catch_unwind(|| unsafe {
         let engine = &mut *(handle as *mut Aether);
-        let rust_limits = engine.limits();
-
-        (*limits).max_steps = match rust_limits.max_steps {
-            Some(v) => v as c_int,
-            None => -1,
-        };
-        (*limits).max_recursion_depth = match rust_limits.max_recursion_depth {
-            Some(v) => v as c_int,
-            None => -1,
-        };
-        (*limits).max_duration_ms = match rust_limits.max_duration_ms {
-            Some(v) => v as c_int,
-            None => -1,
-        };
+        match read {
+            Some(read) => engine.set_file_system(CallbackFileSystem {
+                read,
+                write,
+                user_data,
+            }),
+            None => engine.clear_file_system(),
+        }
+        AetherErrorCode::Success as c_int
     });
+
+    result.unwrap_or(AetherErrorCode::Panic as c_int)
 }
 
 // ============================================================
@@ -760,3 +5870,38 @@ pub extern "C" fn aether_set_optimization(
         );
     });
 }
+
+/// Set the optimization level used when compiling code
+///
+/// Levels: 0 disables all optimizations, 1 only folds constant expressions
+/// (e.g. `(2 + 3)` compiles to `5`), 2 or more enables every optimization
+/// (the default). Use `aether_disassemble` to inspect the result. Clears the
+/// AST cache, since cached programs were optimized with the old settings.
+///
+/// # Parameters
+/// - handle: Aether engine handle
+/// - level: Optimization level (0, 1 or 2)
+///
+/// # Returns
+/// - Success (0) on success
+/// - NullPointer (3) if `handle` is NULL
+/// - InvalidArgument (7) if `level` is negative
+#[unsafe(no_mangle)]
+pub extern "C" fn aether_set_optimization_level(handle: *mut AetherHandle, level: c_int) -> c_int {
+    if handle.is_null() {
+        return AetherErrorCode::NullPointer as c_int;
+    }
+    if level < 0 {
+        return AetherErrorCode::InvalidArgument as c_int;
+    }
+
+    let result = panic::catch_unwind(|| unsafe {
+        let engine = &mut *(handle as *mut Aether);
+        engine.set_optimization_level(level.min(u8::MAX as c_int) as u8);
+    });
+
+    match result {
+        Ok(()) => AetherErrorCode::Success as c_int,
+        Err(_) => AetherErrorCode::Panic as c_int,
+    }
+}
@@ -5,6 +5,18 @@
 
 use crate::token::Token;
 
+/// A source comment, kept so that tools can reproduce it
+///
+/// Comments never reach the token stream; they are collected on the side with
+/// the position of their first character.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Comment {
+    /// Full comment text including delimiters (`// ...` or `/* ... */`)
+    pub text: String,
+    pub line: usize,
+    pub column: usize,
+}
+
 /// Lexer state
 pub struct Lexer {
     input: Vec<char>,
@@ -13,7 +25,10 @@ pub struct Lexer {
     ch: char,             // current char under examination
     line: usize,          // current line number (for error reporting)
     column: usize,        // current column number (for error reporting)
+    token_line: usize,    // line where the last token started
+    token_column: usize,  // column where the last token started
     had_whitespace_before_token: bool, // whether whitespace was skipped before current token
+    comments: Vec<Comment>, // comments seen so far, in source order
 }
 
 impl Lexer {
@@ -26,7 +41,10 @@ impl Lexer {
             ch: '\0',
             line: 1,
             column: 0,
+            token_line: 1,
+            token_column: 0,
             had_whitespace_before_token: false,
+            comments: Vec::new(),
         };
         lexer.read_char(); // Initialize by reading the first character
         lexer
@@ -42,6 +60,16 @@ impl Lexer {
         self.column
     }
 
+    /// Get the (line, column) where the last token started
+    pub fn token_position(&self) -> (usize, usize) {
+        (self.token_line, self.token_column)
+    }
+
+    /// Comments skipped so far, in source order
+    pub fn comments(&self) -> &[Comment] {
+        &self.comments
+    }
+
     /// Check if whitespace was skipped before the last token
     pub fn had_whitespace(&self) -> bool {
         self.had_whitespace_before_token
@@ -90,6 +118,8 @@ impl Lexer {
     pub fn next_token(&mut self) -> Token {
         let had_ws = self.skip_whitespace();
         self.had_whitespace_before_token = had_ws;
+        self.token_line = self.line;
+        self.token_column = self.column;
 
         let token = match self.ch {
             // Operators
@@ -176,6 +206,7 @@ impl Lexer {
             ']' => Token::RightBracket,
             ',' => Token::Comma,
             ':' => Token::Colon,
+            '.' => Token::Dot,
             ';' => Token::Semicolon,
 
             // String literals
@@ -223,21 +254,21 @@ impl Lexer {
 
     /// Skip single-line comment (// ...)
     fn skip_line_comment(&mut self) {
+        let (start, line, column) = (self.position, self.line, self.column);
         while self.ch != '\n' && self.ch != '\0' {
             self.read_char();
         }
+        self.record_comment(start, line, column);
     }
 
     /// Skip block comment (/* ... */)
     fn skip_block_comment(&mut self) {
+        let (start, line, column) = (self.position, self.line, self.column);
         self.read_char(); // skip '/'
         self.read_char(); // skip '*'
 
+        // read_char already tracks newlines inside the comment
         while !(self.ch == '*' && self.peek_char() == '/') && self.ch != '\0' {
-            if self.ch == '\n' {
-                self.line += 1;
-                self.column = 0;
-            }
             self.read_char();
         }
 
@@ -245,6 +276,16 @@ impl Lexer {
             self.read_char(); // skip '*'
             self.read_char(); // skip '/'
         }
+        self.record_comment(start, line, column);
+    }
+
+    fn record_comment(&mut self, start: usize, line: usize, column: usize) {
+        let end = self.position.min(self.input.len());
+        self.comments.push(Comment {
+            text: self.input[start..end].iter().collect(),
+            line,
+            column,
+        });
     }
 
     /// Read an identifier or keyword
@@ -168,7 +168,9 @@
 //! aether script.aether
 //! ```
 
+pub mod analysis;
 pub mod ast;
+pub mod ast_json;
 pub mod builtins;
 pub mod cache;
 pub mod debugger;
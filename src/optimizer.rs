@@ -2,6 +2,8 @@
 //! 代码优化器 - 包含尾递归优化、常量折叠等
 
 use crate::ast::{BinOp, Expr, Program, Stmt, UnaryOp};
+use crate::runtime::IntOverflowMode;
+use crate::runtime::numeric::as_exact_i64;
 
 /// 代码优化器
 pub struct Optimizer {
@@ -11,6 +13,15 @@ pub struct Optimizer {
     pub constant_folding: bool,
     /// 是否启用死代码消除
     pub dead_code_elimination: bool,
+    /// 整数相除不尽时是否得到精确分数（与求值器的有理数除法模式一致），
+    /// 开启时这样的除法不在编译期折叠为浮点数
+    pub rational_division: bool,
+    /// 是否禁止递归（与求值器的禁止递归模式一致），开启时不做尾递归优化，
+    /// 以免自递归被改写为循环而绕过检查
+    pub no_recursion: bool,
+    /// 整数溢出处理模式（与求值器一致）：整数 `+`、`-`、`*` 会触发该模式时不在编译期折叠，
+    /// 留给求值器按模式报错、回绕、饱和或提升为大整数
+    pub int_overflow: IntOverflowMode,
 }
 
 impl Optimizer {
@@ -20,6 +31,25 @@ impl Optimizer {
             tail_recursion: true,
             constant_folding: true,
             dead_code_elimination: true,
+            rational_division: false,
+            no_recursion: false,
+            int_overflow: IntOverflowMode::default(),
+        }
+    }
+
+    /// 按优化级别创建优化器
+    ///
+    /// - `0`：不做任何优化，语法树与源码结构一致
+    /// - `1`：只做常量折叠，例如 `(2 + 3)` 编译为 `5`
+    /// - `2` 及以上：全部优化（常量折叠、死代码消除、尾递归优化），与 [`Optimizer::new`] 相同
+    pub fn with_level(level: u8) -> Self {
+        Optimizer {
+            tail_recursion: level >= 2,
+            constant_folding: level >= 1,
+            dead_code_elimination: level >= 2,
+            rational_division: false,
+            no_recursion: false,
+            int_overflow: IntOverflowMode::default(),
         }
     }
 
@@ -38,7 +68,7 @@ impl Optimizer {
         }
 
         // 尾递归优化
-        if self.tail_recursion {
+        if self.tail_recursion && !self.no_recursion {
             optimized = self.optimize_tail_recursion(optimized);
         }
 
@@ -112,7 +142,7 @@ impl Optimizer {
 
                 // 如果两边都是常量,直接计算结果
                 if let (Expr::Number(l), Expr::Number(r)) = (&left, &right)
-                    && let Some(result) = Self::eval_const_binary(*l, &op, *r)
+                    && let Some(result) = self.eval_const_binary(*l, &op, *r)
                 {
                     return Expr::Number(result);
                 }
@@ -165,17 +195,51 @@ impl Optimizer {
     }
 
     /// 计算常量二元运算
-    fn eval_const_binary(left: f64, op: &BinOp, right: f64) -> Option<f64> {
+    fn eval_const_binary(&self, left: f64, op: &BinOp, right: f64) -> Option<f64> {
         match op {
+            BinOp::Add | BinOp::Subtract | BinOp::Multiply
+                if self.overflows_int(left, op, right) =>
+            {
+                None
+            }
             BinOp::Add => Some(left + right),
             BinOp::Subtract => Some(left - right),
             BinOp::Multiply => Some(left * right),
+            // 整数相除不尽时留给求值器产生分数
+            BinOp::Divide
+                if self.rational_division
+                    && left.fract() == 0.0
+                    && right.fract() == 0.0
+                    && left % right != 0.0 =>
+            {
+                None
+            }
             BinOp::Divide if right != 0.0 => Some(left / right),
             BinOp::Modulo if right != 0.0 => Some(left % right),
             _ => None,
         }
     }
 
+    /// 整数 `left op right` 在求值时是否会交给溢出模式处理（与求值器的判断一致）
+    ///
+    /// 两个操作数都是 `i64` 整数且精确结果超出 `i64` 范围时为真；`BigInt` 模式下
+    /// 结果超出 f64 可精确表示的范围（±2^53）时也为真，因为求值器会提升为大整数。
+    fn overflows_int(&self, left: f64, op: &BinOp, right: f64) -> bool {
+        const MAX_EXACT: u64 = 1 << 53;
+        let (Some(x), Some(y)) = (as_exact_i64(left), as_exact_i64(right)) else {
+            return false;
+        };
+        let checked = match op {
+            BinOp::Add => x.checked_add(y),
+            BinOp::Subtract => x.checked_sub(y),
+            _ => x.checked_mul(y),
+        };
+        match checked {
+            None => true,
+            Some(r) => self.int_overflow == IntOverflowMode::BigInt && r.unsigned_abs() > MAX_EXACT,
+        }
+    }
+
     /// 死代码消除
     fn eliminate_dead_code(&self, program: Program) -> Program {
         program
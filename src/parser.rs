@@ -3,8 +3,8 @@
 //!
 //! Converts a stream of tokens into an Abstract Syntax Tree (AST)
 
-use crate::ast::{BinOp, Expr, Program, Stmt, UnaryOp};
-use crate::lexer::Lexer;
+use crate::ast::{BinOp, Expr, Position, Program, Stmt, UnaryOp};
+use crate::lexer::{Comment, Lexer};
 use crate::token::Token;
 
 /// Parse errors with location information
@@ -37,6 +37,14 @@ pub enum ParseError {
         line: usize,
         column: usize,
     },
+    /// Parsing was stopped through the parser's interrupt handle
+    Interrupted,
+    /// Blocks or brackets nested deeper than the parser's nesting limit
+    NestingTooDeep {
+        limit: usize,
+        line: usize,
+        column: usize,
+    },
 }
 
 impl std::fmt::Display for ParseError {
@@ -96,12 +104,56 @@ impl std::fmt::Display for ParseError {
                     line, column, name, reason
                 )
             }
+            ParseError::Interrupted => write!(f, "Parse error: Parsing interrupted"),
+            ParseError::NestingTooDeep {
+                limit,
+                line,
+                column,
+            } => {
+                write!(
+                    f,
+                    "Parse error at line {}, column {}: Nesting too deep (limit: {})",
+                    line, column, limit
+                )
+            }
         }
     }
 }
 
 impl std::error::Error for ParseError {}
 
+impl ParseError {
+    /// Where the error occurred, if known
+    pub fn position(&self) -> Option<crate::ast::Position> {
+        match self {
+            ParseError::UnexpectedToken { line, column, .. }
+            | ParseError::UnexpectedEOF { line, column }
+            | ParseError::InvalidExpression { line, column, .. }
+            | ParseError::InvalidStatement { line, column, .. }
+            | ParseError::InvalidIdentifier { line, column, .. }
+            | ParseError::NestingTooDeep { line, column, .. } => Some(crate::ast::Position {
+                line: *line,
+                column: *column,
+            }),
+            ParseError::InvalidNumber(_) | ParseError::Interrupted => None,
+        }
+    }
+
+    /// Stable machine-readable code for the kind of error, e.g. `unexpected-token`
+    pub fn code(&self) -> &'static str {
+        match self {
+            ParseError::UnexpectedToken { .. } => "unexpected-token",
+            ParseError::UnexpectedEOF { .. } => "unexpected-eof",
+            ParseError::InvalidNumber(_) => "invalid-number",
+            ParseError::InvalidExpression { .. } => "invalid-expression",
+            ParseError::InvalidStatement { .. } => "invalid-statement",
+            ParseError::InvalidIdentifier { .. } => "invalid-identifier",
+            ParseError::Interrupted => "interrupted",
+            ParseError::NestingTooDeep { .. } => "nesting-too-deep",
+        }
+    }
+}
+
 /// Operator precedence (higher number = higher precedence)
 #[derive(Debug, Clone, Copy, PartialEq, PartialOrd)]
 enum Precedence {
@@ -117,6 +169,19 @@ enum Precedence {
     Index = 9,      // array[index]
 }
 
+/// An operator together with how the parser binds it (see `Parser::operator_table`)
+#[derive(Debug, Clone, PartialEq, Eq, serde::Serialize)]
+pub struct OperatorInfo {
+    /// Source spelling, e.g. `+`; calls and indexing are `()` and `[]`
+    pub symbol: &'static str,
+    /// `binary`, `prefix` or `postfix`
+    pub kind: &'static str,
+    /// Binding strength; higher binds tighter
+    pub precedence: u8,
+    /// `left` or `right`
+    pub associativity: &'static str,
+}
+
 /// Parser state
 pub struct Parser {
     lexer: Lexer,
@@ -126,6 +191,15 @@ pub struct Parser {
     current_column: usize,
     current_had_whitespace: bool, // whether whitespace preceded current_token
     peek_had_whitespace: bool,    // whether whitespace preceded peek_token
+    current_position: Position,   // where current_token starts
+    peek_position: Position,      // where peek_token starts
+    statement_positions: Vec<Position>, // statement start positions, in pre-order
+    expression_positions: Option<Vec<Position>>, // expression start positions in pre-order, when requested
+    top_level_positions: Vec<Position>,          // start positions of top-level statements
+    denied_prefixes: Vec<String>,                // identifier prefixes scripts may not use
+    interrupt: Option<crate::runtime::InterruptHandle>, // polled to cancel parsing
+    max_nesting_depth: Option<usize>,            // deepest allowed block/bracket nesting
+    nesting_depth: usize,                        // blocks and brackets currently open
 }
 
 impl Parser {
@@ -134,8 +208,10 @@ impl Parser {
         let mut lexer = Lexer::new(input);
         let current = lexer.next_token();
         let current_ws = lexer.had_whitespace();
+        let current_pos = lexer.token_position();
         let peek = lexer.next_token();
         let peek_ws = lexer.had_whitespace();
+        let peek_pos = lexer.token_position();
         let line = lexer.line();
         let column = lexer.column();
 
@@ -147,6 +223,95 @@ impl Parser {
             current_column: column,
             current_had_whitespace: current_ws,
             peek_had_whitespace: peek_ws,
+            current_position: Position {
+                line: current_pos.0,
+                column: current_pos.1,
+            },
+            peek_position: Position {
+                line: peek_pos.0,
+                column: peek_pos.1,
+            },
+            statement_positions: Vec::new(),
+            expression_positions: None,
+            top_level_positions: Vec::new(),
+            denied_prefixes: Vec::new(),
+            interrupt: None,
+            max_nesting_depth: None,
+            nesting_depth: 0,
+        }
+    }
+
+    /// Reject identifiers starting with any of `prefixes`
+    ///
+    /// Defining or referencing such a name (variables, functions, parameters,
+    /// loop variables, imports and exports) becomes an `InvalidIdentifier`
+    /// parse error. Dictionary keys and strings are not affected.
+    pub fn with_denied_prefixes(mut self, prefixes: Vec<String>) -> Self {
+        self.denied_prefixes = prefixes;
+        self
+    }
+
+    /// Stop with `ParseError::Interrupted` once `handle` is interrupted
+    ///
+    /// The flag is polled before every statement and expression, so even a
+    /// single huge literal can be cancelled. It is only read, never cleared.
+    pub fn with_interrupt(mut self, handle: crate::runtime::InterruptHandle) -> Self {
+        self.interrupt = Some(handle);
+        self
+    }
+
+    /// Reject blocks and brackets nested more than `max` levels deep
+    ///
+    /// Every `{ }` block and every parenthesis, array, dictionary, call or
+    /// index bracket opens one level. Deeper input fails with
+    /// `ParseError::NestingTooDeep` instead of exhausting the parser's stack.
+    pub fn with_max_nesting_depth(mut self, max: Option<usize>) -> Self {
+        self.max_nesting_depth = max;
+        self
+    }
+
+    /// Run `parse` one nesting level deeper, failing past `max_nesting_depth`
+    fn nested<T>(
+        &mut self,
+        parse: impl FnOnce(&mut Self) -> Result<T, ParseError>,
+    ) -> Result<T, ParseError> {
+        if let Some(limit) = self.max_nesting_depth
+            && self.nesting_depth >= limit
+        {
+            return Err(ParseError::NestingTooDeep {
+                limit,
+                line: self.current_position.line,
+                column: self.current_position.column,
+            });
+        }
+        self.nesting_depth += 1;
+        let result = parse(self);
+        self.nesting_depth -= 1;
+        result
+    }
+
+    /// Fail if parsing was interrupted
+    fn check_interrupt(&self) -> Result<(), ParseError> {
+        match &self.interrupt {
+            Some(handle) if handle.is_interrupted() => Err(ParseError::Interrupted),
+            _ => Ok(()),
+        }
+    }
+
+    /// Fail if `name` starts with a denied prefix
+    fn check_denied(&self, name: &str) -> Result<(), ParseError> {
+        match self
+            .denied_prefixes
+            .iter()
+            .find(|prefix| name.starts_with(prefix.as_str()))
+        {
+            Some(prefix) => Err(ParseError::InvalidIdentifier {
+                name: name.to_string(),
+                reason: format!("以 '{}' 开头的标识符已被禁止使用", prefix),
+                line: self.current_line,
+                column: self.current_column,
+            }),
+            None => Ok(()),
         }
     }
 
@@ -154,8 +319,11 @@ impl Parser {
     fn next_token(&mut self) {
         self.current_token = self.peek_token.clone();
         self.current_had_whitespace = self.peek_had_whitespace;
+        self.current_position = self.peek_position;
         self.peek_token = self.lexer.next_token();
         self.peek_had_whitespace = self.lexer.had_whitespace();
+        let (line, column) = self.lexer.token_position();
+        self.peek_position = Position { line, column };
         self.current_line = self.lexer.line();
         self.current_column = self.lexer.column();
     }
@@ -190,6 +358,8 @@ impl Parser {
     /// Helper to check if identifier follows naming convention
     /// For function parameters, we allow more flexible naming (can use lowercase)
     fn validate_identifier_internal(&self, name: &str, is_param: bool) -> Result<(), ParseError> {
+        self.check_denied(name)?;
+
         // Check it doesn't start with a number
         if name.chars().next().is_some_and(|c| c.is_numeric()) {
             return Err(ParseError::InvalidIdentifier {
@@ -237,17 +407,63 @@ impl Parser {
 
     /// Get precedence of current token
     fn current_precedence(&self) -> Precedence {
-        self.token_precedence(&self.current_token)
+        Self::token_precedence(&self.current_token)
     }
 
     /// Get precedence of peek token
     #[allow(dead_code)]
     fn peek_precedence(&self) -> Precedence {
-        self.token_precedence(&self.peek_token)
+        Self::token_precedence(&self.peek_token)
+    }
+
+    /// Every operator with the precedence and associativity the parser uses
+    ///
+    /// Binary operators are left-associative: `A - B - C` parses as
+    /// `(A - B) - C`. Prefix operators bind tighter than any binary operator
+    /// and nest to the right, while calls, indexing and member access bind
+    /// tightest of all. Sorted from loosest to tightest binding.
+    pub fn operator_table() -> Vec<OperatorInfo> {
+        let binary = [
+            (Token::Or, "||"),
+            (Token::And, "&&"),
+            (Token::Equal, "=="),
+            (Token::NotEqual, "!="),
+            (Token::Less, "<"),
+            (Token::LessEqual, "<="),
+            (Token::Greater, ">"),
+            (Token::GreaterEqual, ">="),
+            (Token::Plus, "+"),
+            (Token::Minus, "-"),
+            (Token::Multiply, "*"),
+            (Token::Divide, "/"),
+            (Token::Modulo, "%"),
+        ];
+        let postfix = [
+            (Token::LeftParen, "()"),
+            (Token::LeftBracket, "[]"),
+            (Token::Dot, "."),
+        ];
+
+        let info = |symbol, kind, precedence: Precedence, associativity| OperatorInfo {
+            symbol,
+            kind,
+            precedence: precedence as u8,
+            associativity,
+        };
+        let mut table: Vec<OperatorInfo> = binary
+            .iter()
+            .map(|(token, symbol)| info(*symbol, "binary", Self::token_precedence(token), "left"))
+            .collect();
+        table.push(info("-", "prefix", Precedence::Prefix, "right"));
+        table.push(info("!", "prefix", Precedence::Prefix, "right"));
+        table.extend(postfix.iter().map(|(token, symbol)| {
+            info(*symbol, "postfix", Self::token_precedence(token), "left")
+        }));
+        table
     }
 
     /// Get precedence of a token
-    fn token_precedence(&self, token: &Token) -> Precedence {
+    fn token_precedence(token: &Token) -> Precedence {
         match token {
             Token::Or => Precedence::Or,
             Token::And => Precedence::And,
@@ -258,7 +474,7 @@ impl Parser {
             Token::Plus | Token::Minus => Precedence::Sum,
             Token::Multiply | Token::Divide | Token::Modulo => Precedence::Product,
             Token::LeftParen => Precedence::Call,
-            Token::LeftBracket => Precedence::Index,
+            Token::LeftBracket | Token::Dot => Precedence::Index,
             _ => Precedence::Lowest,
         }
     }
@@ -266,10 +482,12 @@ impl Parser {
     /// Parse a complete program
     pub fn parse_program(&mut self) -> Result<Program, ParseError> {
         let mut statements = Vec::new();
+        self.top_level_positions.clear();
 
         self.skip_newlines();
 
         while self.current_token != Token::EOF {
+            self.top_level_positions.push(self.current_position);
             let stmt = self.parse_statement()?;
             statements.push(stmt);
             self.skip_newlines();
@@ -278,8 +496,102 @@ impl Parser {
         Ok(statements)
     }
 
+    /// Parse a complete program, also returning the start position of every statement
+    ///
+    /// Positions are listed in pre-order: a statement comes before the statements
+    /// nested in it (function bodies, loop bodies, branches, ...), and siblings
+    /// appear in source order.
+    pub fn parse_program_with_positions(&mut self) -> Result<(Program, Vec<Position>), ParseError> {
+        self.statement_positions.clear();
+        let program = self.parse_program()?;
+        Ok((program, std::mem::take(&mut self.statement_positions)))
+    }
+
+    /// Parse a complete program, also returning the start position of every
+    /// statement and of every expression
+    ///
+    /// Both lists are in pre-order, like `parse_program_with_positions`: an
+    /// expression comes before its operands and arguments. An expression starts
+    /// at its first token, so `A + B` starts at `A` and a grouped `(A + B)` is
+    /// located at `A` (parentheses do not form a node). Nodes the parser
+    /// synthesizes take the position of the source they stand for: the member
+    /// name in `M.NAME`, the target name in `Set NAME[I] V`, and the `Return`
+    /// or `Yield` keyword when its value is omitted.
+    pub fn parse_program_with_expression_positions(
+        &mut self,
+    ) -> Result<(Program, Vec<Position>, Vec<Position>), ParseError> {
+        self.expression_positions = Some(Vec::new());
+        let result = self.parse_program_with_positions();
+        let expressions = self.expression_positions.take().unwrap_or_default();
+        let (program, statements) = result?;
+        Ok((program, statements, expressions))
+    }
+
+    /// Record where an expression node starts, if expression positions were requested
+    fn record_expression(&mut self, position: Position) {
+        if let Some(positions) = &mut self.expression_positions {
+            positions.push(position);
+        }
+    }
+
+    /// Index at which the next recorded expression position will go
+    fn expression_slot(&self) -> usize {
+        self.expression_positions.as_ref().map_or(0, Vec::len)
+    }
+
+    /// Record a node that wraps the expressions recorded since `slot` (its left operand)
+    fn record_expression_at(&mut self, slot: usize, position: Position) {
+        if let Some(positions) = &mut self.expression_positions {
+            positions.insert(slot, position);
+        }
+    }
+
+    /// Start positions of the top-level statements from the last parse
+    pub fn top_level_positions(&self) -> &[Position] {
+        &self.top_level_positions
+    }
+
+    /// Comments in the source, in order (complete once the program is parsed)
+    ///
+    /// Comments are not part of the AST; tools that re-emit source can attach
+    /// each one to the nearest statement using the positions returned by
+    /// `parse_program_with_positions`.
+    pub fn comments(&self) -> &[Comment] {
+        self.lexer.comments()
+    }
+
+    /// Whether `input` fails to parse only because it ends too early
+    ///
+    /// True when the parse error is raised at end of input: an unclosed `{`,
+    /// `(` or `[`, a trailing operator, or an unterminated string. Interactive
+    /// shells can use this to read another line instead of reporting the error.
+    pub fn is_incomplete(input: &str) -> bool {
+        matches!(Self::check_incomplete(input), Ok(true))
+    }
+
+    /// Tell input that ends too early apart from malformed input
+    ///
+    /// Returns `Ok(false)` when `input` parses, `Ok(true)` when it is a valid
+    /// prefix awaiting more tokens (see [`Parser::is_incomplete`]), and the
+    /// parse error when it is wrong no matter what follows.
+    pub fn check_incomplete(input: &str) -> Result<bool, ParseError> {
+        let mut parser = Parser::new(input);
+        let err = match parser.parse_program() {
+            Ok(_) => return Ok(false),
+            Err(err) => err,
+        };
+        match parser.current_token {
+            Token::EOF => Ok(true),
+            // The lexer reports a string still open at end of input as Illegal('"')
+            Token::Illegal('"') if parser.peek_token == Token::EOF => Ok(true),
+            _ => Err(err),
+        }
+    }
+
     /// Parse a statement
     fn parse_statement(&mut self) -> Result<Stmt, ParseError> {
+        self.check_interrupt()?;
+        self.statement_positions.push(self.current_position);
         match &self.current_token {
             Token::Set => self.parse_set_statement(),
             Token::Func => self.parse_func_definition(),
@@ -307,6 +619,7 @@ impl Parser {
         // This can be either an identifier or an index expression
         // We manually parse this to avoid consuming array literals as part of the target
 
+        let name_position = self.current_position;
         let name = match &self.current_token {
             Token::Identifier(n) => {
                 self.validate_identifier(n)?;
@@ -347,6 +660,7 @@ impl Parser {
 
             // No space before '[' means this is: Set NAME[index] value
             // This is an index assignment
+            self.record_expression(name_position);
             self.next_token(); // skip '['            // Parse the index expression
             let index = self.parse_expression(Precedence::Lowest)?;
 
@@ -427,7 +741,10 @@ impl Parser {
         self.next_token(); // skip 'Generator'
 
         let name = match &self.current_token {
-            Token::Identifier(name) => name.clone(),
+            Token::Identifier(name) => {
+                self.check_denied(name)?;
+                name.clone()
+            }
             _ => {
                 return Err(ParseError::UnexpectedToken {
                     expected: "identifier".to_string(),
@@ -459,7 +776,10 @@ impl Parser {
         self.next_token(); // skip 'Lazy'
 
         let name = match &self.current_token {
-            Token::Identifier(name) => name.clone(),
+            Token::Identifier(name) => {
+                self.check_denied(name)?;
+                name.clone()
+            }
             _ => {
                 return Err(ParseError::UnexpectedToken {
                     expected: "identifier".to_string(),
@@ -486,10 +806,12 @@ impl Parser {
 
     /// Parse: Return expr
     fn parse_return_statement(&mut self) -> Result<Stmt, ParseError> {
+        let keyword_position = self.current_position;
         self.next_token(); // skip 'Return'
 
         let expr =
             if self.current_token == Token::Newline || self.current_token == Token::RightBrace {
+                self.record_expression(keyword_position);
                 Expr::Null
             } else {
                 self.parse_expression(Precedence::Lowest)?
@@ -504,10 +826,12 @@ impl Parser {
 
     /// Parse: Yield expr
     fn parse_yield_statement(&mut self) -> Result<Stmt, ParseError> {
+        let keyword_position = self.current_position;
         self.next_token(); // skip 'Yield'
 
         let expr =
             if self.current_token == Token::Newline || self.current_token == Token::RightBrace {
+                self.record_expression(keyword_position);
                 Expr::Null
             } else {
                 self.parse_expression(Precedence::Lowest)?
@@ -565,7 +889,10 @@ impl Parser {
         self.next_token(); // skip 'For'
 
         let first_var = match &self.current_token {
-            Token::Identifier(name) => name.clone(),
+            Token::Identifier(name) => {
+                self.check_denied(name)?;
+                name.clone()
+            }
             _ => {
                 return Err(ParseError::UnexpectedToken {
                     expected: "identifier".to_string(),
@@ -583,7 +910,10 @@ impl Parser {
             self.next_token(); // skip comma
 
             let second_var = match &self.current_token {
-                Token::Identifier(name) => name.clone(),
+                Token::Identifier(name) => {
+                    self.check_denied(name)?;
+                    name.clone()
+                }
                 _ => {
                     return Err(ParseError::UnexpectedToken {
                         expected: "identifier".to_string(),
@@ -711,7 +1041,10 @@ impl Parser {
 
             while self.current_token != Token::RightBrace && self.current_token != Token::EOF {
                 let name = match &self.current_token {
-                    Token::Identifier(n) => n.clone(),
+                    Token::Identifier(n) => {
+                        self.check_denied(n)?;
+                        n.clone()
+                    }
                     _ => {
                         return Err(ParseError::UnexpectedToken {
                             expected: "identifier".to_string(),
@@ -728,6 +1061,7 @@ impl Parser {
                 let alias = if self.current_token == Token::As {
                     self.next_token();
                     if let Token::Identifier(a) = &self.current_token.clone() {
+                        self.check_denied(a)?;
                         let alias_name = a.clone();
                         self.next_token();
                         Some(alias_name)
@@ -753,7 +1087,10 @@ impl Parser {
         } else {
             // Import NAME ...
             let name = match &self.current_token {
-                Token::Identifier(n) => n.clone(),
+                Token::Identifier(n) => {
+                    self.check_denied(n)?;
+                    n.clone()
+                }
                 _ => {
                     return Err(ParseError::UnexpectedToken {
                         expected: "identifier".to_string(),
@@ -770,6 +1107,7 @@ impl Parser {
             if self.current_token == Token::As {
                 self.next_token();
                 let alias = if let Token::Identifier(a) = &self.current_token.clone() {
+                    self.check_denied(a)?;
                     let alias_name = a.clone();
                     self.next_token();
                     Some(alias_name)
@@ -817,7 +1155,10 @@ impl Parser {
         self.next_token(); // skip 'Export'
 
         let name = match &self.current_token {
-            Token::Identifier(n) => n.clone(),
+            Token::Identifier(n) => {
+                self.check_denied(n)?;
+                n.clone()
+            }
             _ => {
                 return Err(ParseError::UnexpectedToken {
                     expected: "identifier".to_string(),
@@ -887,20 +1228,25 @@ impl Parser {
 
     /// Parse a block of statements: { stmt1 stmt2 ... }
     fn parse_block(&mut self) -> Result<Vec<Stmt>, ParseError> {
-        let mut statements = Vec::new();
+        self.nested(|parser| {
+            let mut statements = Vec::new();
 
-        self.skip_newlines();
+            parser.skip_newlines();
 
-        while self.current_token != Token::RightBrace && self.current_token != Token::EOF {
-            statements.push(self.parse_statement()?);
-            self.skip_newlines();
-        }
+            while parser.current_token != Token::RightBrace && parser.current_token != Token::EOF {
+                statements.push(parser.parse_statement()?);
+                parser.skip_newlines();
+            }
 
-        Ok(statements)
+            Ok(statements)
+        })
     }
 
     /// Parse an expression using Pratt parsing
     fn parse_expression(&mut self, precedence: Precedence) -> Result<Expr, ParseError> {
+        self.check_interrupt()?;
+        let slot = self.expression_slot();
+        let start = self.current_position;
         let mut left = self.parse_prefix()?;
 
         // After parse_prefix, current_token is at the first token after the prefix expression
@@ -915,6 +1261,7 @@ impl Parser {
             && self.current_token != Token::Colon
         {
             left = self.parse_infix(left)?;
+            self.record_expression_at(slot, start);
         }
 
         Ok(left)
@@ -922,6 +1269,10 @@ impl Parser {
 
     /// Parse prefix expressions
     fn parse_prefix(&mut self) -> Result<Expr, ParseError> {
+        // Parentheses only group; the node inside records its own position
+        if self.current_token != Token::LeftParen {
+            self.record_expression(self.current_position);
+        }
         match &self.current_token.clone() {
             Token::Number(n) => {
                 let num = *n;
@@ -948,13 +1299,14 @@ impl Parser {
                 Ok(Expr::Null)
             }
             Token::Identifier(name) => {
+                self.check_denied(name)?;
                 let ident = name.clone();
                 self.next_token();
                 Ok(Expr::Identifier(ident))
             }
-            Token::LeftParen => self.parse_grouped_expression(),
-            Token::LeftBracket => self.parse_array_literal(),
-            Token::LeftBrace => self.parse_dict_literal(),
+            Token::LeftParen => self.nested(Self::parse_grouped_expression),
+            Token::LeftBracket => self.nested(Self::parse_array_literal),
+            Token::LeftBrace => self.nested(Self::parse_dict_literal),
             Token::Minus => self.parse_unary_expression(UnaryOp::Minus),
             Token::Not => self.parse_unary_expression(UnaryOp::Not),
             Token::If => self.parse_if_expression(),
@@ -984,8 +1336,9 @@ impl Parser {
             | Token::GreaterEqual
             | Token::And
             | Token::Or => self.parse_binary_expression(left),
-            Token::LeftParen => self.parse_call_expression(left),
-            Token::LeftBracket => self.parse_index_expression(left),
+            Token::LeftParen => self.nested(|parser| parser.parse_call_expression(left)),
+            Token::LeftBracket => self.nested(|parser| parser.parse_index_expression(left)),
+            Token::Dot => self.parse_member_expression(left),
             _ => Ok(left),
         }
     }
@@ -1082,11 +1435,13 @@ impl Parser {
 
     /// Parse unary expression: -expr or !expr
     fn parse_unary_expression(&mut self, op: UnaryOp) -> Result<Expr, ParseError> {
-        self.next_token(); // skip operator
+        self.nested(|parser| {
+            parser.next_token(); // skip operator
 
-        let expr = self.parse_expression(Precedence::Prefix)?;
+            let expr = parser.parse_expression(Precedence::Prefix)?;
 
-        Ok(Expr::unary(op, expr))
+            Ok(Expr::unary(op, expr))
+        })
     }
 
     /// Parse binary expression: left op right
@@ -1157,6 +1512,31 @@ impl Parser {
         Ok(Expr::index(object, index))
     }
 
+    /// Parse member access: MODULE.NAME, sugar for MODULE["NAME"]
+    fn parse_member_expression(&mut self, object: Expr) -> Result<Expr, ParseError> {
+        self.next_token(); // skip '.'
+
+        let member_position = self.current_position;
+        let member = match &self.current_token {
+            Token::Identifier(name) => {
+                self.check_denied(name)?;
+                name.clone()
+            }
+            _ => {
+                return Err(ParseError::UnexpectedToken {
+                    expected: "identifier".to_string(),
+                    found: self.current_token.clone(),
+                    line: self.current_line,
+                    column: self.current_column,
+                });
+            }
+        };
+        self.next_token();
+        self.record_expression(member_position);
+
+        Ok(Expr::index(object, Expr::String(member)))
+    }
+
     /// Parse if expression: If (cond) { ... } Elif (cond) { ... } Else { ... }
     fn parse_if_expression(&mut self) -> Result<Expr, ParseError> {
         self.next_token(); // skip 'If'
@@ -1265,8 +1645,12 @@ impl Parser {
         // Expect arrow
         self.expect_token(Token::Arrow)?;
 
-        // Parse the expression body
-        let expr = self.parse_expression(Precedence::Lowest)?;
+        // Parse the expression body; the synthetic Return precedes any statements
+        // nested in the expression, so reserve its position slot first
+        let slot = self.statement_positions.len();
+        let start = self.current_position;
+        let expr = self.nested(|parser| parser.parse_expression(Precedence::Lowest))?;
+        self.statement_positions.insert(slot, start);
 
         // Wrap the expression in a Return statement
         let body = vec![Stmt::Return(expr)];
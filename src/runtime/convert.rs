@@ -0,0 +1,126 @@
+//! 结果值到 Rust 类型的转换
+//!
+//! [`FromValue`] 描述如何把脚本结果转换为宿主类型，`Aether::eval_as::<T>()`
+//! 据此在编译期确定目标类型，调用方无需再对 [`Value`] 做模式匹配。
+//! 转换不做隐式类型转换：字符串不会解析为数字，数字也不会按真值转换为布尔值。
+
+use crate::evaluator::RuntimeError;
+use crate::value::Value;
+
+/// 可以从脚本结果转换得到的类型
+///
+/// 支持的类型和规则：
+/// - `bool`：只接受 `Boolean`
+/// - `i64`、`i32`：接受没有小数部分且在目标范围内的数字或分数
+/// - `f64`：接受数字或分数（分数转换为最接近的浮点数）
+/// - `String`：只接受 `String`
+/// - `Vec<T>`：接受数组，逐个元素按 `T` 的规则转换
+/// - `Value`：原样返回
+///
+/// 类型不符时返回 `RuntimeError::TypeErrorDetailed`。脚本没有产生值时
+/// （例如以 `PRINTLN` 结尾）返回 `RuntimeError::NoValue`，而不是按 `Null` 处理，
+/// 以免把“没有值”误当作 `0` 或 `false`；只有 `Value` 会得到 `Null`。
+pub trait FromValue: Sized {
+    /// 转换脚本结果
+    fn from_value(value: Value) -> Result<Self, RuntimeError>;
+
+    /// 脚本没有产生值时的结果
+    fn from_void() -> Result<Self, RuntimeError> {
+        Err(RuntimeError::NoValue)
+    }
+}
+
+fn type_error(expected: &str, got: &Value) -> RuntimeError {
+    RuntimeError::TypeErrorDetailed {
+        expected: expected.to_string(),
+        got: got.type_name().to_string(),
+    }
+}
+
+/// 取出整数值；`min..max` 为目标类型的范围
+fn integer(value: &Value, min: f64, max: f64) -> Result<f64, RuntimeError> {
+    let n = match value.to_number() {
+        Some(n) if matches!(value, Value::Number(_) | Value::Fraction(_)) => n,
+        _ => return Err(type_error("Number", value)),
+    };
+    if n.fract() != 0.0 || !(min..max).contains(&n) {
+        return Err(RuntimeError::TypeErrorDetailed {
+            expected: "integer".to_string(),
+            got: value.to_string(),
+        });
+    }
+    Ok(n)
+}
+
+impl FromValue for Value {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        Ok(value)
+    }
+
+    fn from_void() -> Result<Self, RuntimeError> {
+        Ok(Value::Null)
+    }
+}
+
+impl FromValue for bool {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        match value {
+            Value::Boolean(b) => Ok(b),
+            other => Err(type_error("Boolean", &other)),
+        }
+    }
+}
+
+impl FromValue for i64 {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        integer(&value, i64::MIN as f64, i64::MAX as f64).map(|n| n as i64)
+    }
+}
+
+impl FromValue for i32 {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        integer(&value, i32::MIN as f64, i32::MAX as f64 + 1.0).map(|n| n as i32)
+    }
+}
+
+impl FromValue for f64 {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        match value {
+            Value::Number(_) | Value::Fraction(_) => Ok(value.to_number().unwrap_or(f64::NAN)),
+            other => Err(type_error("Number", &other)),
+        }
+    }
+}
+
+impl FromValue for String {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        match value {
+            Value::String(s) => Ok(s),
+            other => Err(type_error("String", &other)),
+        }
+    }
+}
+
+impl<T: FromValue> FromValue for Vec<T> {
+    fn from_value(value: Value) -> Result<Self, RuntimeError> {
+        let items = match value {
+            Value::Array(items) => items,
+            other => return Err(type_error("Array", &other)),
+        };
+        items
+            .into_iter()
+            .enumerate()
+            .map(|(i, item)| {
+                T::from_value(item).map_err(|e| match e {
+                    RuntimeError::TypeErrorDetailed { expected, got } => {
+                        RuntimeError::TypeErrorDetailed {
+                            expected: format!("{} at index {}", expected, i),
+                            got,
+                        }
+                    }
+                    other => other,
+                })
+            })
+            .collect()
+    }
+}
@@ -0,0 +1,147 @@
+//! 全局变量的差异
+//!
+//! 宿主可以在求值前后各取一次全局变量快照（`Aether::globals`），比较得到脚本
+//! 新增、删除和修改了哪些变量，用于断言“这条规则只改动了 X 和 Y”之类的测试。
+
+use crate::value::Value;
+use std::collections::BTreeMap;
+
+/// 一个全局变量的变化
+#[derive(Debug, Clone)]
+pub enum StateChange {
+    /// 求值后才存在的变量
+    Added { name: String, value: Value },
+    /// 求值后不再存在的变量
+    Removed { name: String, value: Value },
+    /// 值发生变化的变量
+    Changed {
+        name: String,
+        before: Value,
+        after: Value,
+    },
+}
+
+impl StateChange {
+    /// 发生变化的变量名
+    pub fn name(&self) -> &str {
+        match self {
+            StateChange::Added { name, .. }
+            | StateChange::Removed { name, .. }
+            | StateChange::Changed { name, .. } => name,
+        }
+    }
+
+    /// 变化种类：`added`、`removed` 或 `changed`
+    pub fn kind(&self) -> &'static str {
+        match self {
+            StateChange::Added { .. } => "added",
+            StateChange::Removed { .. } => "removed",
+            StateChange::Changed { .. } => "changed",
+        }
+    }
+}
+
+/// 比较两份全局变量快照，按变量名顺序返回所有变化
+///
+/// 数组和字典按内容逐项比较；函数按名称、参数和函数体比较，不比较捕获的环境。
+pub fn diff_globals(
+    before: &BTreeMap<String, Value>,
+    after: &BTreeMap<String, Value>,
+) -> Vec<StateChange> {
+    let mut names: Vec<&String> = before.keys().chain(after.keys()).collect();
+    names.sort();
+    names.dedup();
+
+    names
+        .into_iter()
+        .filter_map(|name| match (before.get(name), after.get(name)) {
+            (None, Some(value)) => Some(StateChange::Added {
+                name: name.clone(),
+                value: value.clone(),
+            }),
+            (Some(value), None) => Some(StateChange::Removed {
+                name: name.clone(),
+                value: value.clone(),
+            }),
+            (Some(old), Some(new)) if !same_value(old, new) => Some(StateChange::Changed {
+                name: name.clone(),
+                before: old.clone(),
+                after: new.clone(),
+            }),
+            _ => None,
+        })
+        .collect()
+}
+
+/// 判断两个值的内容是否相同（`Value::equals` 不比较字典和函数）
+fn same_value(a: &Value, b: &Value) -> bool {
+    match (a, b) {
+        (Value::Number(x), Value::Number(y)) => x == y || (x.is_nan() && y.is_nan()),
+        (Value::Array(x), Value::Array(y)) => {
+            x.len() == y.len() && x.iter().zip(y).all(|(x, y)| same_value(x, y))
+        }
+        (Value::Dict(x), Value::Dict(y)) => {
+            x.len() == y.len()
+                && x.iter()
+                    .all(|(key, x)| y.get(key).is_some_and(|y| same_value(x, y)))
+        }
+        (
+            Value::Function {
+                name: name_a,
+                params: params_a,
+                body: body_a,
+                ..
+            },
+            Value::Function {
+                name: name_b,
+                params: params_b,
+                body: body_b,
+                ..
+            },
+        ) => name_a == name_b && params_a == params_b && body_a == body_b,
+        (
+            Value::Generator {
+                params: params_a,
+                body: body_a,
+                ..
+            },
+            Value::Generator {
+                params: params_b,
+                body: body_b,
+                ..
+            },
+        ) => params_a == params_b && body_a == body_b,
+        (Value::Lazy { expr: a, .. }, Value::Lazy { expr: b, .. }) => a == b,
+        (Value::BuiltIn { name: a, .. }, Value::BuiltIn { name: b, .. }) => a == b,
+        _ => a.equals(b),
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use std::collections::HashMap;
+
+    #[test]
+    fn test_diff_globals() {
+        let dict = |v: f64| Value::Dict(HashMap::from([("k".to_string(), Value::Number(v))]));
+        let before = BTreeMap::from([
+            ("A".to_string(), Value::Number(1.0)),
+            ("B".to_string(), dict(1.0)),
+            ("C".to_string(), dict(1.0)),
+        ]);
+        let after = BTreeMap::from([
+            ("B".to_string(), dict(1.0)),
+            ("C".to_string(), dict(2.0)),
+            ("D".to_string(), Value::Null),
+        ]);
+
+        let changes = diff_globals(&before, &after);
+        let summary: Vec<_> = changes.iter().map(|c| (c.name(), c.kind())).collect();
+        assert_eq!(
+            summary,
+            vec![("A", "removed"), ("C", "changed"), ("D", "added")]
+        );
+        assert!(diff_globals(&after, &after).is_empty());
+    }
+}
@@ -0,0 +1,133 @@
+//! 虚拟文件系统
+//!
+//! 宿主可以为引擎挂载 [`FileSystem`]，让文件内置函数（`READ_FILE`、`WRITE_FILE` 等）
+//! 读写宿主提供的存储（例如内存中的映射），而不是真实的磁盘，
+//! 便于测试以及在沙箱中运行需要“读文件”的脚本。
+
+use std::cell::RefCell;
+use std::collections::HashMap;
+use std::rc::Rc;
+
+use crate::evaluator::RuntimeError;
+use crate::value::Value;
+
+/// 文件内置函数使用的文件系统
+///
+/// 只有 `read_file` 必须实现；写入默认被拒绝，因此只读的实现只需提供读取。
+/// 挂载后 `DELETE_FILE`、`LIST_DIR`、`CREATE_DIR` 不可用（返回运行时错误）。
+pub trait FileSystem {
+    /// 读取文件内容（`READ_FILE`）
+    fn read_file(&self, path: &str) -> Result<String, String>;
+
+    /// 覆盖写入文件（`WRITE_FILE`，`APPEND_FILE` 也通过它写回），默认拒绝写入
+    fn write_file(&self, path: &str, _content: &str) -> Result<(), String> {
+        Err(format!("file system is read-only, cannot write '{}'", path))
+    }
+
+    /// 文件是否存在（`FILE_EXISTS`），默认以能否读取判断
+    fn file_exists(&self, path: &str) -> bool {
+        self.read_file(path).is_ok()
+    }
+}
+
+/// 内存中的文件系统
+///
+/// 克隆得到的实例共享同一份文件，宿主可以保留一份克隆，
+/// 在求值结束后检查脚本写入的内容。
+#[derive(Debug, Clone, Default)]
+pub struct MemoryFileSystem {
+    files: Rc<RefCell<HashMap<String, String>>>,
+}
+
+impl MemoryFileSystem {
+    /// 创建空的内存文件系统
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// 添加或覆盖一个文件
+    pub fn insert(&self, path: impl Into<String>, content: impl Into<String>) {
+        self.files.borrow_mut().insert(path.into(), content.into());
+    }
+
+    /// 获取文件内容
+    pub fn get(&self, path: &str) -> Option<String> {
+        self.files.borrow().get(path).cloned()
+    }
+}
+
+impl FileSystem for MemoryFileSystem {
+    fn read_file(&self, path: &str) -> Result<String, String> {
+        self.get(path).ok_or_else(|| "file not found".to_string())
+    }
+
+    fn write_file(&self, path: &str, content: &str) -> Result<(), String> {
+        self.insert(path, content);
+        Ok(())
+    }
+
+    fn file_exists(&self, path: &str) -> bool {
+        self.files.borrow().contains_key(path)
+    }
+}
+
+/// 通过 `fs` 执行名为 `name` 的文件内置函数
+pub(crate) fn call(fs: &dyn FileSystem, name: &str, args: &[Value]) -> Result<Value, RuntimeError> {
+    let strings = |count: usize| -> Result<Vec<&str>, RuntimeError> {
+        if args.len() != count {
+            return Err(RuntimeError::WrongArity {
+                expected: count,
+                got: args.len(),
+            });
+        }
+        args.iter()
+            .map(|arg| match arg {
+                Value::String(s) => Ok(s.as_str()),
+                _ => Err(RuntimeError::TypeErrorDetailed {
+                    expected: "String".to_string(),
+                    got: format!("{:?}", arg),
+                }),
+            })
+            .collect()
+    };
+
+    match name {
+        "READ_FILE" => {
+            let path = strings(1)?[0];
+            fs.read_file(path).map(Value::String).map_err(|e| {
+                RuntimeError::CustomError(format!("Failed to read file '{}': {}", path, e))
+            })
+        }
+        "WRITE_FILE" => {
+            let args = strings(2)?;
+            fs.write_file(args[0], args[1])
+                .map(|_| Value::Boolean(true))
+                .map_err(|e| {
+                    RuntimeError::CustomError(format!("Failed to write file '{}': {}", args[0], e))
+                })
+        }
+        "APPEND_FILE" => {
+            let args = strings(2)?;
+            let existing = if fs.file_exists(args[0]) {
+                fs.read_file(args[0]).map_err(|e| {
+                    RuntimeError::CustomError(format!("Failed to open file '{}': {}", args[0], e))
+                })?
+            } else {
+                String::new()
+            };
+            fs.write_file(args[0], &(existing + args[1]))
+                .map(|_| Value::Boolean(true))
+                .map_err(|e| {
+                    RuntimeError::CustomError(format!(
+                        "Failed to append to file '{}': {}",
+                        args[0], e
+                    ))
+                })
+        }
+        "FILE_EXISTS" => Ok(Value::Boolean(fs.file_exists(strings(1)?[0]))),
+        _ => Err(RuntimeError::CustomError(format!(
+            "{} is not supported by the host file system",
+            name
+        ))),
+    }
+}
@@ -0,0 +1,16 @@
+//! 脚本函数信息
+//!
+//! 供宿主列出当前可调用的脚本函数，用于自动补全或生成文档。
+
+use serde::Serialize;
+
+/// 全局作用域中一个用户定义的 `Func`
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct FunctionInfo {
+    pub name: String,
+    pub params: Vec<String>,
+    /// 定义所在行（从 1 开始；位置未知时为 0，例如定义不在顶层）
+    pub line: usize,
+    /// 定义所在列（从 1 开始；位置未知时为 0）
+    pub column: usize,
+}
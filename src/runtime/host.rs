@@ -0,0 +1,244 @@
+//! 宿主函数注册表
+//!
+//! 宿主（Rust 或 C-FFI 调用方）可以注册自定义函数供脚本调用。
+//! 注册表内部由 `Arc<RwLock<..>>` 共享：克隆出来的注册表指向同一份函数表，
+//! 因此可以只注册一次，再挂载到多个引擎（例如引擎池）上，并支持并发读取。
+//!
+//! 需要请求级数据（数据库句柄、截止时间等）的函数可以用
+//! `register_with_context` 注册，调用时会收到本次求值的 [`HostContext`]。
+
+use std::any::Any;
+use std::collections::HashMap;
+use std::fmt;
+use std::sync::{Arc, RwLock};
+use std::time::{Duration, Instant};
+
+use crate::value::Value;
+
+/// 宿主函数签名：接收参数，返回结果或错误信息
+pub type HostFn = dyn Fn(&[Value]) -> Result<Value, String> + Send + Sync;
+
+/// 带上下文的宿主函数签名
+pub type HostContextFn = dyn Fn(&HostContext, &[Value]) -> Result<Value, String> + Send + Sync;
+
+/// 调用钩子签名：接收被调用函数的名称和参数（见 `Aether::set_call_hook`）
+pub type CallHookFn = dyn Fn(&str, &[Value]);
+
+/// 宿主上下文数据（由宿主在求值时传入）
+pub type HostData = Arc<dyn Any + Send + Sync>;
+
+/// 一次求值的上下文，传给带上下文的宿主函数
+#[derive(Clone, Default)]
+pub struct HostContext {
+    deadline: Option<Instant>,
+    data: Option<HostData>,
+}
+
+impl HostContext {
+    /// 创建上下文
+    pub fn new(deadline: Option<Instant>, data: Option<HostData>) -> Self {
+        Self { deadline, data }
+    }
+
+    /// 本次求值的截止时间（来自 `max_duration_ms` 限制），None 表示不限时
+    pub fn deadline(&self) -> Option<Instant> {
+        self.deadline
+    }
+
+    /// 距截止时间的剩余时长，None 表示不限时
+    pub fn remaining(&self) -> Option<Duration> {
+        self.deadline
+            .map(|d| d.saturating_duration_since(Instant::now()))
+    }
+
+    /// 是否已经超过截止时间
+    pub fn is_expired(&self) -> bool {
+        self.deadline.is_some_and(|d| Instant::now() >= d)
+    }
+
+    /// 宿主传入的原始数据
+    pub fn data(&self) -> Option<&HostData> {
+        self.data.as_ref()
+    }
+
+    /// 按类型取出宿主数据，类型不匹配或未设置时返回 None
+    pub fn get<T: Any>(&self) -> Option<&T> {
+        self.data.as_deref().and_then(|d| d.downcast_ref::<T>())
+    }
+}
+
+impl fmt::Debug for HostContext {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("HostContext")
+            .field("deadline", &self.deadline)
+            .field("has_data", &self.data.is_some())
+            .finish()
+    }
+}
+
+/// 已注册的宿主函数
+#[derive(Clone)]
+pub struct HostFunction {
+    arity: usize,
+    func: Arc<HostContextFn>,
+}
+
+impl HostFunction {
+    /// 参数个数
+    pub fn arity(&self) -> usize {
+        self.arity
+    }
+
+    /// 以空上下文调用宿主函数
+    pub fn call(&self, args: &[Value]) -> Result<Value, String> {
+        (self.func)(&HostContext::default(), args)
+    }
+
+    /// 以指定上下文调用宿主函数
+    pub fn call_with_context(&self, ctx: &HostContext, args: &[Value]) -> Result<Value, String> {
+        (self.func)(ctx, args)
+    }
+}
+
+impl fmt::Debug for HostFunction {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("HostFunction")
+            .field("arity", &self.arity)
+            .finish_non_exhaustive()
+    }
+}
+
+/// 可在多个引擎间共享的宿主函数注册表
+#[derive(Clone, Default)]
+pub struct HostRegistry {
+    functions: Arc<RwLock<HashMap<String, HostFunction>>>,
+}
+
+impl HostRegistry {
+    /// 创建空的注册表
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// 注册（或替换）一个宿主函数
+    ///
+    /// 已挂载该注册表的引擎在下一次调用时即可看到新函数。
+    pub fn register<F>(&self, name: impl Into<String>, arity: usize, func: F)
+    where
+        F: Fn(&[Value]) -> Result<Value, String> + Send + Sync + 'static,
+    {
+        self.register_with_context(name, arity, move |_ctx, args| func(args));
+    }
+
+    /// 注册（或替换）一个需要求值上下文的宿主函数
+    pub fn register_with_context<F>(&self, name: impl Into<String>, arity: usize, func: F)
+    where
+        F: Fn(&HostContext, &[Value]) -> Result<Value, String> + Send + Sync + 'static,
+    {
+        let function = HostFunction {
+            arity,
+            func: Arc::new(func),
+        };
+        self.functions
+            .write()
+            .unwrap_or_else(|e| e.into_inner())
+            .insert(name.into(), function);
+    }
+
+    /// 移除一个宿主函数，返回它是否存在
+    pub fn unregister(&self, name: &str) -> bool {
+        self.functions
+            .write()
+            .unwrap_or_else(|e| e.into_inner())
+            .remove(name)
+            .is_some()
+    }
+
+    /// 按名称查找宿主函数
+    pub fn get(&self, name: &str) -> Option<HostFunction> {
+        self.functions
+            .read()
+            .unwrap_or_else(|e| e.into_inner())
+            .get(name)
+            .cloned()
+    }
+
+    /// 是否包含指定函数
+    pub fn contains(&self, name: &str) -> bool {
+        self.functions
+            .read()
+            .unwrap_or_else(|e| e.into_inner())
+            .contains_key(name)
+    }
+
+    /// 所有已注册的函数名
+    pub fn names(&self) -> Vec<String> {
+        self.functions
+            .read()
+            .unwrap_or_else(|e| e.into_inner())
+            .keys()
+            .cloned()
+            .collect()
+    }
+
+    /// 两个句柄是否指向同一份函数表
+    pub fn ptr_eq(&self, other: &HostRegistry) -> bool {
+        Arc::ptr_eq(&self.functions, &other.functions)
+    }
+}
+
+impl fmt::Debug for HostRegistry {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        let mut names = self.names();
+        names.sort();
+        f.debug_struct("HostRegistry")
+            .field("functions", &names)
+            .finish()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_clones_share_functions() {
+        let registry = HostRegistry::new();
+        let shared = registry.clone();
+
+        registry.register("DOUBLE", 1, |args| match args {
+            [Value::Number(n)] => Ok(Value::Number(n * 2.0)),
+            _ => Err("DOUBLE expects a number".to_string()),
+        });
+
+        let func = shared.get("DOUBLE").unwrap();
+        assert_eq!(func.arity(), 1);
+        assert_eq!(func.call(&[Value::Number(2.0)]), Ok(Value::Number(4.0)));
+        assert!(shared.ptr_eq(&registry));
+
+        assert!(shared.unregister("DOUBLE"));
+        assert!(!registry.contains("DOUBLE"));
+    }
+
+    #[test]
+    fn test_context_data_downcast() {
+        let registry = HostRegistry::new();
+        registry.register_with_context("TENANT", 0, |ctx, _args| {
+            ctx.get::<String>()
+                .map(|s| Value::String(s.clone()))
+                .ok_or_else(|| "no tenant".to_string())
+        });
+
+        let func = registry.get("TENANT").unwrap();
+        assert!(func.call(&[]).is_err());
+
+        let ctx = HostContext::new(None, Some(Arc::new("acme".to_string())));
+        assert_eq!(
+            func.call_with_context(&ctx, &[]),
+            Ok(Value::String("acme".to_string()))
+        );
+        assert!(ctx.get::<i32>().is_none());
+        assert!(!ctx.is_expired());
+        assert_eq!(ctx.remaining(), None);
+    }
+}
@@ -0,0 +1,41 @@
+//! 从其他线程中断正在进行的求值
+//!
+//! 引擎本身不是 `Send` 的，因此宿主先取得一个 [`InterruptHandle`]，
+//! 再把它交给其他线程（例如 UI 的"停止"按钮）。解释器在每条语句之前以及
+//! 每次 `While`、`For` 与 `For I, X` 循环迭代开始时检查标志，
+//! 单个内置函数或宿主函数调用期间不会检查。
+
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
+
+/// 可跨线程使用的中断句柄
+///
+/// 克隆得到的句柄共享同一个标志。
+#[derive(Debug, Clone, Default)]
+pub struct InterruptHandle {
+    flag: Arc<AtomicBool>,
+}
+
+impl InterruptHandle {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// 请求中断当前正在进行的求值
+    ///
+    /// 求值会在下一条语句或下一次循环迭代之前以 `Evaluation interrupted` 错误结束。
+    /// 引擎空闲时调用不会影响之后的求值。
+    pub fn interrupt(&self) {
+        self.flag.store(true, Ordering::SeqCst);
+    }
+
+    /// 是否有尚未处理的中断请求
+    pub fn is_interrupted(&self) -> bool {
+        self.flag.load(Ordering::SeqCst)
+    }
+
+    /// 清除中断请求，返回清除前是否有请求
+    pub(crate) fn take(&self) -> bool {
+        self.flag.swap(false, Ordering::SeqCst)
+    }
+}
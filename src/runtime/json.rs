@@ -0,0 +1,126 @@
+//! 结果值的 JSON 编码
+//!
+//! 将 [`Value`] 按宿主约定的 JSON 形式序列化：数组和字典递归展开，
+//! 函数、生成器等不可序列化的值编码为描述字符串，分数编码为 `"numer/denom"`。
+//! 通过 serde 直接写入 writer，大数组不需要先在内存中构造完整的 JSON。
+//! 字典默认按哈希表的迭代顺序输出；[`SortedJsonValue`] 按键排序，输出稳定。
+
+use serde::ser::{Serialize, SerializeMap, SerializeSeq, Serializer};
+
+use crate::value::Value;
+
+/// 以 JSON 形式序列化 [`Value`] 的包装类型
+pub struct JsonValue<'a>(pub &'a Value);
+
+/// 与 [`JsonValue`] 相同，但字典（包括嵌套的字典）按键排序输出
+pub struct SortedJsonValue<'a>(pub &'a Value);
+
+impl Serialize for JsonValue<'_> {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        Json::new(self.0, false).serialize(serializer)
+    }
+}
+
+impl Serialize for SortedJsonValue<'_> {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        Json::new(self.0, true).serialize(serializer)
+    }
+}
+
+struct Json<'a> {
+    value: &'a Value,
+    sorted_keys: bool,
+}
+
+impl<'a> Json<'a> {
+    fn new(value: &'a Value, sorted_keys: bool) -> Self {
+        Json { value, sorted_keys }
+    }
+}
+
+impl Serialize for Json<'_> {
+    fn serialize<S: Serializer>(&self, serializer: S) -> Result<S::Ok, S::Error> {
+        match self.value {
+            Value::Number(n) => serializer.serialize_f64(*n),
+            Value::String(s) => serializer.serialize_str(s),
+            Value::Boolean(b) => serializer.serialize_bool(*b),
+            Value::Null => serializer.serialize_unit(),
+            Value::Array(items) => {
+                let mut seq = serializer.serialize_seq(Some(items.len()))?;
+                for item in items {
+                    seq.serialize_element(&Json::new(item, self.sorted_keys))?;
+                }
+                seq.end()
+            }
+            Value::Dict(entries) => {
+                let mut entries: Vec<_> = entries.iter().collect();
+                if self.sorted_keys {
+                    entries.sort_by(|a, b| a.0.cmp(b.0));
+                }
+                let mut map = serializer.serialize_map(Some(entries.len()))?;
+                for (key, value) in entries {
+                    map.serialize_entry(key, &Json::new(value, self.sorted_keys))?;
+                }
+                map.end()
+            }
+            Value::Fraction(f) => serializer.collect_str(f),
+            Value::Function { .. } => serializer.serialize_str("<function>"),
+            Value::BuiltIn { name, .. } => {
+                serializer.serialize_str(&format!("<builtin: {}>", name))
+            }
+            Value::Generator { .. } => serializer.serialize_str("<generator>"),
+            Value::Lazy { .. } => serializer.serialize_str("<lazy>"),
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_json_encoding() {
+        let value = Value::Array(vec![
+            Value::Number(1.5),
+            Value::String("a\"b".to_string()),
+            Value::Null,
+            Value::Array(vec![Value::Boolean(true)]),
+        ]);
+        assert_eq!(
+            serde_json::to_string(&JsonValue(&value)).unwrap(),
+            r#"[1.5,"a\"b",null,[true]]"#
+        );
+        assert_eq!(
+            serde_json::to_string(&JsonValue(&Value::Number(f64::NAN))).unwrap(),
+            "null"
+        );
+    }
+
+    #[test]
+    fn test_sorted_json_encoding() {
+        let inner = Value::Dict(
+            [("y", 1.0), ("x", 2.0)]
+                .into_iter()
+                .map(|(k, v)| (k.to_string(), Value::Number(v)))
+                .collect(),
+        );
+        let value = Value::Dict(
+            [
+                ("b", inner),
+                ("a", Value::Null),
+                ("c", Value::Boolean(true)),
+            ]
+            .into_iter()
+            .map(|(k, v)| (k.to_string(), v))
+            .collect(),
+        );
+        assert_eq!(
+            serde_json::to_string(&SortedJsonValue(&value)).unwrap(),
+            r#"{"a":null,"b":{"x":2.0,"y":1.0},"c":true}"#
+        );
+        assert_eq!(
+            value.to_sorted_string(),
+            "{a: Null, b: {x: 2, y: 1}, c: true}"
+        );
+    }
+}
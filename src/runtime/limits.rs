@@ -4,6 +4,8 @@
 
 use std::fmt;
 
+use serde::Serialize;
+
 /// 执行限制配置
 ///
 /// 用于控制脚本执行的资源消耗，包括步数、递归深度、执行时长和内存使用。
@@ -19,6 +21,10 @@ pub struct ExecutionLimits {
 
     /// 最大执行时长（毫秒）
     /// None 表示无限制
+    ///
+    /// 解释器在每条语句之前和每次 `While`、`For` 与 `For I, X` 循环迭代开始时检查时长，
+    /// 因此即使是空循环体的死循环，也会在超过时限后的一次迭代内终止；
+    /// 单个内置函数或宿主函数调用期间不会检查。
     pub max_duration_ms: Option<u64>,
 
     /// 最大内存分配（字节）
@@ -69,6 +75,71 @@ impl ExecutionLimits {
     }
 }
 
+/// 引擎当前生效的全部限制（见 `Aether::configured_limits`），`None` 表示不限制
+///
+/// 除 [`ExecutionLimits`] 中的各项外，还包括通过各个 `set_max_*` 单独设置的限制，
+/// 便于调试沙箱配置或在测试中断言 `with_safe_defaults` 等预设的取值。
+#[derive(Debug, Clone, PartialEq, Eq, Serialize)]
+pub struct ConfiguredLimits {
+    /// 最大执行步数
+    pub max_steps: Option<usize>,
+    /// 最大递归深度
+    pub max_recursion_depth: Option<usize>,
+    /// 最大执行时长（毫秒）
+    pub max_duration_ms: Option<u64>,
+    /// 最大内存分配（字节，暂未实施）
+    pub max_memory_bytes: Option<usize>,
+    /// 顶层结果的最大字节数（`Aether::set_max_result_size`）
+    pub max_result_bytes: Option<usize>,
+    /// 单个数组的最大元素个数（`Aether::set_max_array_length`）
+    pub max_array_length: Option<usize>,
+    /// 一次求值中输出的最大累计字节数（`Aether::set_max_output_bytes`）
+    pub max_output_bytes: Option<usize>,
+    /// 一次求值中可定义的函数的最大个数（`Aether::set_max_functions`）
+    pub max_functions: Option<usize>,
+    /// 解析时允许的最大嵌套层数（`Aether::set_max_nesting_depth`）
+    pub max_nesting_depth: Option<usize>,
+    /// 是否禁止递归调用（`Aether::with_no_recursion`）
+    pub no_recursion: bool,
+}
+
+/// 可触发预警的资源种类（见 `Aether::set_limit_warning_hook`）
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Hash)]
+pub enum LimitKind {
+    /// 执行步数（`ExecutionLimits::max_steps`）
+    Steps,
+    /// 递归深度（`ExecutionLimits::max_recursion_depth`）
+    RecursionDepth,
+    /// 执行时长，单位毫秒（`ExecutionLimits::max_duration_ms`）
+    Duration,
+    /// 单个数组的元素个数（`Aether::set_max_array_length`）
+    ArrayLength,
+}
+
+impl LimitKind {
+    /// 稳定的名称：`steps`、`recursion_depth`、`duration_ms` 或 `array_length`
+    pub fn as_str(&self) -> &'static str {
+        match self {
+            LimitKind::Steps => "steps",
+            LimitKind::RecursionDepth => "recursion_depth",
+            LimitKind::Duration => "duration_ms",
+            LimitKind::ArrayLength => "array_length",
+        }
+    }
+}
+
+impl fmt::Display for LimitKind {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.write_str(self.as_str())
+    }
+}
+
+/// 资源预警回调，参数依次为资源种类、当前用量和上限
+pub type LimitWarningFn = dyn Fn(LimitKind, u64, u64);
+
+/// 进度回调，参数为本次求值已执行的步数（见 `Aether::set_progress_hook`）
+pub type ProgressFn = dyn Fn(u64);
+
 /// 执行限制错误
 ///
 /// 当脚本超出配置的资源限制时返回此错误。
@@ -85,6 +156,21 @@ pub enum ExecutionLimitError {
 
     /// 内存限制超出（暂未实现）
     MemoryLimitExceeded { bytes: usize, limit: usize },
+
+    /// 结果大小超出（按结果的字符串形式计算字节数）
+    ResultTooLarge { bytes: usize, limit: usize },
+
+    /// 单个数组的元素个数超出
+    ArrayTooLarge { length: usize, limit: usize },
+
+    /// 一次求值中 `PRINT/PRINTLN` 输出的累计字节数超出
+    OutputLimitExceeded { bytes: usize, limit: usize },
+
+    /// 一次求值中定义的函数（含生成器）个数超出
+    FunctionLimitExceeded { count: usize, limit: usize },
+
+    /// 禁止递归时，函数在自身仍在执行时被再次调用（直接或间接）
+    RecursionForbidden { function: String },
 }
 
 impl fmt::Display for ExecutionLimitError {
@@ -110,6 +196,31 @@ impl fmt::Display for ExecutionLimitError {
                 "Memory limit exceeded: {} bytes (limit: {} bytes)",
                 bytes, limit
             ),
+            ExecutionLimitError::ResultTooLarge { bytes, limit } => write!(
+                f,
+                "Result size limit exceeded: {} bytes (limit: {} bytes)",
+                bytes, limit
+            ),
+            ExecutionLimitError::ArrayTooLarge { length, limit } => write!(
+                f,
+                "Array length limit exceeded: {} elements (limit: {})",
+                length, limit
+            ),
+            ExecutionLimitError::OutputLimitExceeded { bytes, limit } => write!(
+                f,
+                "Output limit exceeded: {} bytes (limit: {} bytes)",
+                bytes, limit
+            ),
+            ExecutionLimitError::FunctionLimitExceeded { count, limit } => write!(
+                f,
+                "Function definition limit exceeded: {} functions (limit: {})",
+                count, limit
+            ),
+            ExecutionLimitError::RecursionForbidden { function } => write!(
+                f,
+                "Recursion is not allowed: {} called while already running",
+                function
+            ),
         }
     }
 }
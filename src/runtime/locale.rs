@@ -0,0 +1,145 @@
+//! 数字的区域格式
+//!
+//! 默认情况下数字按与区域无关的格式输出（`1234567.5`）。宿主可以通过
+//! `Aether::with_locale` 指定 BCP-47 语言标签，使 `PRINT/PRINTLN` 以及字符串拼接中的
+//! 数字带上千位分隔符并使用对应的小数点，例如 `en-US` 为 `1,234,567.5`，
+//! `de-DE` 为 `1.234.567,5`。格式只影响输出文本，不影响数值本身和 JSON 结果。
+
+/// 按区域格式化数字所需的分隔符
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct NumberLocale {
+    tag: String,
+    group: &'static str,
+    decimal: &'static str,
+}
+
+/// 各语言的（千位分隔符, 小数点）；带地区的标签优先于只有语言的标签
+const LOCALES: &[(&str, &str, &str)] = &[
+    ("de-ch", "\u{2019}", "."),
+    ("es-mx", ",", "."),
+    ("es-us", ",", "."),
+    ("pt-pt", "\u{a0}", ","),
+    ("en", ",", "."),
+    ("ja", ",", "."),
+    ("ko", ",", "."),
+    ("zh", ",", "."),
+    ("th", ",", "."),
+    ("he", ",", "."),
+    ("de", ".", ","),
+    ("es", ".", ","),
+    ("it", ".", ","),
+    ("nl", ".", ","),
+    ("pt", ".", ","),
+    ("id", ".", ","),
+    ("tr", ".", ","),
+    ("da", ".", ","),
+    ("fr", "\u{202f}", ","),
+    ("ru", "\u{a0}", ","),
+    ("uk", "\u{a0}", ","),
+    ("pl", "\u{a0}", ","),
+    ("cs", "\u{a0}", ","),
+    ("sv", "\u{a0}", ","),
+    ("fi", "\u{a0}", ","),
+    ("nb", "\u{a0}", ","),
+];
+
+impl NumberLocale {
+    /// 根据 BCP-47 语言标签（如 `en-US`、`de_DE`，不区分大小写）创建区域格式
+    ///
+    /// 先按 `语言-地区` 查找，找不到时退回到语言本身；不支持的语言返回错误。
+    pub fn from_tag(tag: &str) -> Result<Self, String> {
+        let normalized = tag.trim().replace('_', "-").to_ascii_lowercase();
+        let mut subtags = normalized.split('-');
+        let language = subtags.next().unwrap_or_default();
+        let region = subtags
+            .find(|s| s.len() == 2 || (s.len() == 3 && s.chars().all(|c| c.is_ascii_digit())));
+        let with_region = region.map(|r| format!("{}-{}", language, r));
+
+        let found = LOCALES
+            .iter()
+            .find(|(key, _, _)| Some(*key) == with_region.as_deref())
+            .or_else(|| LOCALES.iter().find(|(key, _, _)| *key == language));
+        match found {
+            Some((_, group, decimal)) => Ok(NumberLocale {
+                tag: tag.trim().to_string(),
+                group,
+                decimal,
+            }),
+            None => Err(format!("Unsupported locale: '{}'", tag)),
+        }
+    }
+
+    /// 创建时使用的语言标签
+    pub fn tag(&self) -> &str {
+        &self.tag
+    }
+
+    /// 按区域格式化数字；整数不带小数部分，非有限值原样输出
+    pub fn format_number(&self, n: f64) -> String {
+        let plain = if n.fract() == 0.0 {
+            format!("{:.0}", n)
+        } else {
+            format!("{}", n)
+        };
+        if !n.is_finite() {
+            return plain;
+        }
+
+        let (sign, digits) = match plain.strip_prefix('-') {
+            Some(rest) => ("-", rest),
+            None => ("", plain.as_str()),
+        };
+        let (integer, fraction) = match digits.split_once('.') {
+            Some((integer, fraction)) => (integer, Some(fraction)),
+            None => (digits, None),
+        };
+
+        let mut out = String::with_capacity(plain.len() + integer.len() / 3 * self.group.len());
+        out.push_str(sign);
+        for (i, c) in integer.chars().enumerate() {
+            if i > 0 && (integer.len() - i) % 3 == 0 {
+                out.push_str(self.group);
+            }
+            out.push(c);
+        }
+        if let Some(fraction) = fraction {
+            out.push_str(self.decimal);
+            out.push_str(fraction);
+        }
+        out
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_format_number_by_locale() {
+        let en = NumberLocale::from_tag("en-US").unwrap();
+        assert_eq!(en.format_number(1234567.5), "1,234,567.5");
+        assert_eq!(en.format_number(-1000.0), "-1,000");
+        assert_eq!(en.format_number(999.0), "999");
+        assert_eq!(en.format_number(0.25), "0.25");
+
+        let de = NumberLocale::from_tag("de-DE").unwrap();
+        assert_eq!(de.format_number(1234567.5), "1.234.567,5");
+        assert_eq!(de.format_number(f64::NAN), "NaN");
+    }
+
+    #[test]
+    fn test_from_tag_fallback() {
+        // 地区优先，其次退回到语言；标签不区分大小写，接受下划线
+        let ch = NumberLocale::from_tag("de_CH").unwrap();
+        assert_eq!(ch.format_number(1234.5), "1\u{2019}234.5");
+        assert_eq!(
+            NumberLocale::from_tag("DE-at")
+                .unwrap()
+                .format_number(1234.5),
+            "1.234,5"
+        );
+        assert_eq!(NumberLocale::from_tag("fr").unwrap().tag(), "fr");
+        assert!(NumberLocale::from_tag("xx-YY").is_err());
+        assert!(NumberLocale::from_tag("").is_err());
+    }
+}
@@ -2,8 +2,43 @@
 //!
 //! 本模块提供执行限制、调试器和 TRACE 系统等运行时能力。
 
+pub mod convert;
+pub mod diff;
+pub mod file_system;
+pub mod functions;
+pub mod host;
+pub mod interrupt;
+pub mod json;
 pub mod limits;
+pub mod locale;
+pub mod numeric;
+pub mod outcome;
+pub mod output;
+pub mod program;
+pub mod random;
+pub mod shared;
+pub mod state;
+pub mod stats;
+pub mod suggest;
 pub mod trace;
 
-pub use limits::{ExecutionLimitError, ExecutionLimits};
+pub use convert::FromValue;
+pub use diff::{StateChange, diff_globals};
+pub use file_system::{FileSystem, MemoryFileSystem};
+pub use functions::FunctionInfo;
+pub use host::{CallHookFn, HostContext, HostData, HostFunction, HostRegistry};
+pub use interrupt::InterruptHandle;
+pub use json::{JsonValue, SortedJsonValue};
+pub use limits::{
+    ConfiguredLimits, ExecutionLimitError, ExecutionLimits, LimitKind, LimitWarningFn, ProgressFn,
+};
+pub use locale::NumberLocale;
+pub use numeric::{DivByZeroMode, IntOverflowMode, StringCoercion};
+pub use outcome::ResultKind;
+pub use output::OutputCapture;
+pub use program::PROGRAM_VERSION;
+pub use random::SeededRng;
+pub use shared::SharedData;
+pub use state::STATE_VERSION;
+pub use stats::{EvalPhases, EvalStats};
 pub use trace::{TraceEntry, TraceFilter, TraceLevel, TraceStats};
@@ -0,0 +1,86 @@
+//! 运算语义配置
+//!
+//! 控制运算在边界情况下的行为，例如整数超出 `i64` 范围时如何处理、
+//! 除数为零时的结果，以及 `+` 是否允许字符串与其他类型混合。
+
+use serde::{Deserialize, Serialize};
+
+/// 整数溢出处理模式
+///
+/// 当 `+`、`-`、`*` 的两个操作数都是 `i64` 范围内的整数，
+/// 而精确结果超出 `i64` 范围时，按此模式处理。
+/// 操作数本身已超出 `i64` 范围（或为小数）时不受影响。
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default, Serialize, Deserialize)]
+pub enum IntOverflowMode {
+    /// 产生运行时错误（默认，避免静默得到错误结果）
+    #[default]
+    Error,
+    /// 按二进制补码回绕
+    Wrap,
+    /// 饱和到 `i64::MAX` / `i64::MIN`
+    Saturate,
+    /// 提升为任意精度整数（分母为 1 的 `Fraction`），整数运算永不溢出也不丢失精度
+    ///
+    /// 结果超出 `i64` 范围或超出 `f64` 可精确表示的范围（±2^53）时提升，
+    /// 此后与其他整数的运算都保持精确。代价是提升后的值使用堆上的大整数，
+    /// 运算比普通数字慢一个数量级以上；范围内的整数运算不受影响。
+    BigInt,
+}
+
+/// 除零处理模式
+///
+/// 控制 `/` 和 `%` 的除数为零（包括值为零的分数）时的行为，
+/// 整数与小数操作数一视同仁。
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum DivByZeroMode {
+    /// 产生 `Division by zero` 运行时错误（默认）
+    #[default]
+    Error,
+    /// 按 IEEE 754 浮点语义计算：`(1 / 0)` 为正无穷，`(-1 / 0)` 为负无穷，
+    /// `(0 / 0)` 和 `(X % 0)` 为 NaN
+    Infinity,
+    /// 结果为 0
+    Zero,
+}
+
+/// 字符串拼接模式
+///
+/// 控制 `+` 的一侧是字符串、另一侧不是字符串时的行为。
+/// 两侧都是字符串时总是直接拼接，不受此模式影响。
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum StringCoercion {
+    /// 产生类型错误（默认），例如 `("count: " + 1)` 报
+    /// `Cannot add String and Number`，避免意外的类型混用
+    #[default]
+    Strict,
+    /// 把非字符串一侧按 `TO_STRING` 的格式转换后拼接，
+    /// 例如 `("count: " + 1)` 得到 `"count: 1"`
+    Coerce,
+}
+
+/// 如果 `n` 是可以精确表示为 `i64` 的整数，返回对应的 `i64`
+pub fn as_exact_i64(n: f64) -> Option<i64> {
+    // 2^63 本身不在 i64 范围内，因此上界使用开区间
+    const BOUND: f64 = 9_223_372_036_854_775_808.0;
+    if n.fract() == 0.0 && (-BOUND..BOUND).contains(&n) {
+        Some(n as i64)
+    } else {
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_as_exact_i64() {
+        assert_eq!(as_exact_i64(42.0), Some(42));
+        assert_eq!(as_exact_i64(-1.0), Some(-1));
+        assert_eq!(as_exact_i64(1.5), None);
+        assert_eq!(as_exact_i64(i64::MIN as f64), Some(i64::MIN));
+        assert_eq!(as_exact_i64(9_223_372_036_854_775_808.0), None);
+        assert_eq!(as_exact_i64(f64::NAN), None);
+        assert_eq!(as_exact_i64(f64::INFINITY), None);
+    }
+}
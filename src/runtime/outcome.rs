@@ -0,0 +1,23 @@
+//! 顶层求值结果的来源
+//!
+//! 脚本的结果默认是最后一条语句的值；顶层 `Return` 可以显式返回并提前结束脚本。
+//! 宿主可以据此区分"脚本没有产生值"和"脚本返回了空字符串"等情况。
+
+/// 顶层求值结果的来源
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub enum ResultKind {
+    /// 脚本通过顶层 `Return` 显式返回
+    Returned,
+    /// 最后一条语句产生的值
+    LastValue,
+    /// 没有显式返回，且最后一条语句没有产生值（结果为 `Null`，如以 `PRINTLN` 结尾）
+    #[default]
+    Void,
+}
+
+impl ResultKind {
+    /// 脚本是否没有产生值
+    pub fn is_void(self) -> bool {
+        self == ResultKind::Void
+    }
+}
@@ -0,0 +1,101 @@
+//! PRINT 输出捕获
+//!
+//! 宿主可以让 `PRINT/PRINTLN` 写入内存缓冲区而不是 stdout，
+//! 以便在一次调用中同时拿到结果和脚本打印的内容。也可以只保留最后若干行，
+//! 输出再多也只占用固定的内存。
+
+use std::collections::VecDeque;
+
+/// 按行收集的 PRINT 输出
+#[derive(Debug, Clone, Default)]
+pub struct OutputCapture {
+    /// 已完成的行（不含换行符）
+    lines: VecDeque<String>,
+    /// 尚未遇到换行符的部分行
+    pending: String,
+    /// 最多保留的行数（`None` 表示全部保留）
+    max_lines: Option<usize>,
+}
+
+impl OutputCapture {
+    /// 创建空的输出缓冲区
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// 创建只保留最后 `n` 行的输出缓冲区，更早的行在写入新行时被丢弃
+    pub fn tail(n: usize) -> Self {
+        OutputCapture {
+            max_lines: Some(n),
+            ..Self::default()
+        }
+    }
+
+    /// 写入一段文本，遇到 `\n` 时切分为新行
+    pub fn write(&mut self, text: &str) {
+        let mut parts = text.split('\n');
+        if let Some(first) = parts.next() {
+            self.pending.push_str(first);
+        }
+        for part in parts {
+            let line = std::mem::take(&mut self.pending);
+            self.push_line(line);
+            self.pending.push_str(part);
+        }
+    }
+
+    /// 追加一行，超出 `max_lines` 时丢弃最早的行
+    fn push_line(&mut self, line: String) {
+        if self.max_lines == Some(0) {
+            return;
+        }
+        if self.max_lines == Some(self.lines.len()) {
+            self.lines.pop_front();
+        }
+        self.lines.push_back(line);
+    }
+
+    /// 结束捕获并返回所有行（末尾未换行的部分行也会作为一行返回）
+    pub fn finish(mut self) -> Vec<String> {
+        if !self.pending.is_empty() {
+            let line = std::mem::take(&mut self.pending);
+            self.push_line(line);
+        }
+        self.lines.into()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_split_lines() {
+        let mut out = OutputCapture::new();
+        out.write("a");
+        out.write("b\n");
+        out.write("c\nd");
+        assert_eq!(out.finish(), vec!["ab", "c", "d"]);
+    }
+
+    #[test]
+    fn test_empty_lines_preserved() {
+        let mut out = OutputCapture::new();
+        out.write("\n\nx\n");
+        assert_eq!(out.finish(), vec!["", "", "x"]);
+    }
+
+    #[test]
+    fn test_tail_keeps_last_lines() {
+        let mut out = OutputCapture::tail(2);
+        for i in 0..100 {
+            out.write(&format!("line {}\n", i));
+        }
+        out.write("partial");
+        assert_eq!(out.finish(), vec!["line 99", "partial"]);
+
+        let mut out = OutputCapture::tail(0);
+        out.write("a\nb");
+        assert!(out.finish().is_empty());
+    }
+}
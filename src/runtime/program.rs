@@ -0,0 +1,117 @@
+//! 编译结果的序列化
+//!
+//! 将解析并优化后的程序编码为带版本号和校验和的字节序列，宿主可以在一个进程中编译，
+//! 把字节分发给其他进程加载到 AST 缓存中，从而跳过解析。
+//! 字节内容为 JSON：`{"format": "aether-program", "version": 2, "checksum": "...", "payload": "..."}`，
+//! 其中 `payload` 是编码后的程序文本，`checksum` 是其 FNV-1a 64 位哈希（十六进制）。
+
+use serde::{Deserialize, Serialize};
+
+use crate::ast::{Position, Program};
+use crate::cache::DefinitionSites;
+use crate::runtime::IntOverflowMode;
+
+/// 编译结果字节的格式标识
+const FORMAT: &str = "aether-program";
+
+/// 当前编译结果格式版本，格式或语法树发生不兼容的变化时递增
+pub const PROGRAM_VERSION: u32 = 2;
+
+/// 用于在完整解码之前校验格式和版本
+#[derive(Deserialize)]
+struct Header {
+    format: String,
+    version: u32,
+}
+
+#[derive(Serialize, Deserialize)]
+struct ProgramFile {
+    format: String,
+    version: u32,
+    checksum: String,
+    payload: String,
+}
+
+/// 影响解析结果是否可用的引擎设置，加载时必须与当前引擎一致
+#[derive(Debug, Clone, PartialEq, Eq, Serialize, Deserialize)]
+pub(crate) struct ParseSettings {
+    pub denied_prefixes: Vec<String>,
+    pub max_nesting_depth: Option<usize>,
+    pub warnings_as_errors: bool,
+    /// 常量折叠的结果取决于是否开启有理数除法
+    pub rational_division: bool,
+    /// 禁止递归时不做尾递归优化
+    pub no_recursion: bool,
+    /// 常量折叠是否跳过某个整数运算取决于溢出模式
+    pub int_overflow: IntOverflowMode,
+}
+
+/// 编译结果：源码、编译时的设置、优化后的程序、顶层函数定义位置和顶层语句位置
+#[derive(Serialize, Deserialize)]
+pub(crate) struct CompiledProgram {
+    pub source: String,
+    pub settings: ParseSettings,
+    pub program: Program,
+    pub sites: DefinitionSites,
+    pub positions: Vec<Position>,
+}
+
+/// 将编译结果编码为字节
+pub(crate) fn save(compiled: &CompiledProgram) -> Result<Vec<u8>, String> {
+    let payload = serde_json::to_string(compiled).map_err(|e| e.to_string())?;
+    let file = ProgramFile {
+        format: FORMAT.to_string(),
+        version: PROGRAM_VERSION,
+        checksum: checksum(&payload),
+        payload,
+    };
+    serde_json::to_vec(&file).map_err(|e| e.to_string())
+}
+
+/// 解码编译结果字节
+///
+/// 格式或版本不匹配、校验和不符以及内容损坏时返回错误。
+pub(crate) fn load(bytes: &[u8]) -> Result<CompiledProgram, String> {
+    let header: Header =
+        serde_json::from_slice(bytes).map_err(|e| format!("Invalid compiled program: {}", e))?;
+    if header.format != FORMAT {
+        return Err(format!(
+            "Invalid compiled program: unknown format '{}'",
+            header.format
+        ));
+    }
+    if header.version != PROGRAM_VERSION {
+        return Err(format!(
+            "Unsupported compiled program version {} (expected {})",
+            header.version, PROGRAM_VERSION
+        ));
+    }
+
+    let file: ProgramFile =
+        serde_json::from_slice(bytes).map_err(|e| format!("Invalid compiled program: {}", e))?;
+    if checksum(&file.payload) != file.checksum {
+        return Err("Invalid compiled program: checksum mismatch".to_string());
+    }
+    serde_json::from_str(&file.payload).map_err(|e| format!("Invalid compiled program: {}", e))
+}
+
+/// FNV-1a 64 位哈希，用于发现损坏或被截断的字节（不防篡改）
+fn checksum(payload: &str) -> String {
+    let hash = payload
+        .bytes()
+        .fold(0xcbf2_9ce4_8422_2325u64, |hash, byte| {
+            (hash ^ byte as u64).wrapping_mul(0x0000_0100_0000_01b3)
+        });
+    format!("{:016x}", hash)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_checksum_is_stable() {
+        assert_eq!(checksum(""), "cbf29ce484222325");
+        assert_ne!(checksum("Set X 1"), checksum("Set X 2"));
+    }
+}
@@ -0,0 +1,89 @@
+//! 引擎级随机数生成器
+//!
+//! 每个引擎持有自己的生成器，`RANDOM/RANDOM_INT` 只读写本引擎的状态，
+//! 并发运行的多个引擎互不干扰。设置相同种子后，相同脚本产生相同的序列，
+//! 便于测试复现。算法为 SplitMix64：足够快且无需额外依赖，但不适用于密码学场景。
+
+use std::sync::atomic::{AtomicU64, Ordering};
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// 可设置种子的伪随机数生成器
+#[derive(Debug, Clone)]
+pub struct SeededRng {
+    state: u64,
+}
+
+impl SeededRng {
+    /// 使用指定种子创建
+    pub fn new(seed: u64) -> Self {
+        Self { state: seed }
+    }
+
+    /// 使用时间和进程内计数器生成种子（未设置种子时的默认行为）
+    pub fn from_entropy() -> Self {
+        static COUNTER: AtomicU64 = AtomicU64::new(0);
+        let nanos = SystemTime::now()
+            .duration_since(UNIX_EPOCH)
+            .map(|d| d.as_nanos() as u64)
+            .unwrap_or(0);
+        let count = COUNTER.fetch_add(1, Ordering::Relaxed);
+        Self::new(nanos ^ count.wrapping_mul(0x9E37_79B9_7F4A_7C15))
+    }
+
+    /// 重新设置种子
+    pub fn reseed(&mut self, seed: u64) {
+        self.state = seed;
+    }
+
+    /// 下一个 64 位随机数
+    pub fn next_u64(&mut self) -> u64 {
+        self.state = self.state.wrapping_add(0x9E37_79B9_7F4A_7C15);
+        let mut z = self.state;
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        z ^ (z >> 31)
+    }
+
+    /// `[0, 1)` 区间内的随机浮点数
+    pub fn next_f64(&mut self) -> f64 {
+        (self.next_u64() >> 11) as f64 / (1u64 << 53) as f64
+    }
+
+    /// `[min, max]` 闭区间内的随机整数（要求 `min <= max`）
+    pub fn range_i64(&mut self, min: i64, max: i64) -> i64 {
+        let span = (max as i128 - min as i128 + 1) as u128;
+        (min as i128 + (self.next_u64() as u128 % span) as i128) as i64
+    }
+}
+
+impl Default for SeededRng {
+    fn default() -> Self {
+        Self::from_entropy()
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_same_seed_same_sequence() {
+        let mut a = SeededRng::new(42);
+        let mut b = SeededRng::new(42);
+        for _ in 0..16 {
+            assert_eq!(a.next_u64(), b.next_u64());
+        }
+    }
+
+    #[test]
+    fn test_ranges() {
+        let mut rng = SeededRng::new(7);
+        for _ in 0..1000 {
+            let f = rng.next_f64();
+            assert!((0.0..1.0).contains(&f));
+            let n = rng.range_i64(-3, 3);
+            assert!((-3..=3).contains(&n));
+        }
+        assert_eq!(rng.range_i64(5, 5), 5);
+    }
+}
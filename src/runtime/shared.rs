@@ -0,0 +1,182 @@
+//! 多个引擎共享的只读数据
+//!
+//! 宿主把一份较大的参考数据（查找表、配置等）转换为 [`SharedData`] 一次，
+//! 再绑定到任意多个引擎上。数据保存在 `Arc` 中，克隆句柄和绑定都不会复制数据，
+//! 并且句柄是 `Send + Sync` 的，多个线程上的引擎可以同时读取。
+//!
+//! 脚本通过索引链（`TABLE["key"][0]`）读取时直接在共享数据中查找，只复制选中的元素；
+//! 直接读取整个名称（例如 `LEN(TABLE)` 或 `For X In TABLE`）会复制出完整的值。
+
+use std::collections::HashMap;
+use std::fmt;
+use std::sync::Arc;
+
+use num_bigint::BigInt;
+use num_rational::Ratio;
+
+use crate::evaluator::RuntimeError;
+use crate::value::Value;
+
+/// 可在多个引擎、多个线程间共享的只读数据
+///
+/// 克隆得到的句柄指向同一份数据。
+#[derive(Clone)]
+pub struct SharedData {
+    root: Arc<Node>,
+}
+
+/// 不含闭包和环境的数据节点，因此可以跨线程共享
+enum Node {
+    Number(f64),
+    Fraction(Ratio<BigInt>),
+    String(String),
+    Boolean(bool),
+    Null,
+    Array(Vec<Node>),
+    Dict(HashMap<String, Node>),
+}
+
+impl SharedData {
+    /// 由值构造共享数据
+    ///
+    /// 只接受数字、分数、字符串、布尔值、Null 以及由它们组成的数组和字典；
+    /// 包含函数、生成器或惰性值时返回错误。
+    pub fn new(value: &Value) -> Result<Self, String> {
+        Ok(Self {
+            root: Arc::new(Node::from_value(value)?),
+        })
+    }
+
+    /// 复制出完整的值
+    pub fn to_value(&self) -> Value {
+        self.root.to_value()
+    }
+
+    /// 两个句柄是否指向同一份数据
+    pub fn ptr_eq(&self, other: &SharedData) -> bool {
+        Arc::ptr_eq(&self.root, &other.root)
+    }
+
+    /// 按索引路径查找，只复制最终选中的部分
+    ///
+    /// 沿数组（数字下标）和字典（字符串键）向下查找，到达字符串等非容器值时停止，
+    /// 返回停止处的值和已经使用的索引个数，剩余的索引由调用方按普通值处理。
+    /// 下标越界、键不存在或索引类型不匹配时返回与普通索引相同的错误。
+    pub(crate) fn select(&self, path: &[Value]) -> Result<(Value, usize), RuntimeError> {
+        let mut node = self.root.as_ref();
+        for (used, index) in path.iter().enumerate() {
+            node = match (node, index) {
+                (Node::Array(items), Value::Number(n)) => {
+                    let idx = *n as usize;
+                    items.get(idx).ok_or_else(|| {
+                        RuntimeError::InvalidOperation(format!("Index {} out of bounds", idx))
+                    })?
+                }
+                (Node::Dict(entries), Value::String(key)) => entries.get(key).ok_or_else(|| {
+                    RuntimeError::InvalidOperation(format!("Key '{}' not found", key))
+                })?,
+                (Node::Array(_) | Node::Dict(_), index) => {
+                    return Err(RuntimeError::TypeError(format!(
+                        "Cannot index {} with {}",
+                        node.type_name(),
+                        index.type_name()
+                    )));
+                }
+                _ => return Ok((node.to_value(), used)),
+            };
+        }
+        Ok((node.to_value(), path.len()))
+    }
+}
+
+impl fmt::Debug for SharedData {
+    fn fmt(&self, f: &mut fmt::Formatter<'_>) -> fmt::Result {
+        f.debug_struct("SharedData")
+            .field("type", &self.root.type_name())
+            .field("handles", &Arc::strong_count(&self.root))
+            .finish()
+    }
+}
+
+impl Node {
+    fn from_value(value: &Value) -> Result<Self, String> {
+        Ok(match value {
+            Value::Number(n) => Node::Number(*n),
+            Value::Fraction(f) => Node::Fraction(f.clone()),
+            Value::String(s) => Node::String(s.clone()),
+            Value::Boolean(b) => Node::Boolean(*b),
+            Value::Null => Node::Null,
+            Value::Array(items) => Node::Array(
+                items
+                    .iter()
+                    .map(Node::from_value)
+                    .collect::<Result<_, _>>()?,
+            ),
+            Value::Dict(entries) => Node::Dict(
+                entries
+                    .iter()
+                    .map(|(key, value)| Ok((key.clone(), Node::from_value(value)?)))
+                    .collect::<Result<_, String>>()?,
+            ),
+            other => {
+                return Err(format!(
+                    "Cannot share a {} value between engines",
+                    other.type_name()
+                ));
+            }
+        })
+    }
+
+    fn to_value(&self) -> Value {
+        match self {
+            Node::Number(n) => Value::Number(*n),
+            Node::Fraction(f) => Value::Fraction(f.clone()),
+            Node::String(s) => Value::String(s.clone()),
+            Node::Boolean(b) => Value::Boolean(*b),
+            Node::Null => Value::Null,
+            Node::Array(items) => Value::Array(items.iter().map(Node::to_value).collect()),
+            Node::Dict(entries) => Value::Dict(
+                entries
+                    .iter()
+                    .map(|(key, value)| (key.clone(), value.to_value()))
+                    .collect(),
+            ),
+        }
+    }
+
+    fn type_name(&self) -> &'static str {
+        match self {
+            Node::Number(_) => "Number",
+            Node::Fraction(_) => "Fraction",
+            Node::String(_) => "String",
+            Node::Boolean(_) => "Boolean",
+            Node::Null => "Null",
+            Node::Array(_) => "Array",
+            Node::Dict(_) => "Dict",
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_select_stops_at_non_container() {
+        let value = Value::Array(vec![Value::String("ab".to_string())]);
+        let shared = SharedData::new(&value).unwrap();
+        let path = [Value::Number(0.0), Value::Number(1.0)];
+        assert_eq!(
+            shared.select(&path).unwrap(),
+            (Value::String("ab".to_string()), 1)
+        );
+        assert!(shared.select(&[Value::Number(3.0)]).is_err());
+        assert_eq!(shared.to_value(), value);
+    }
+
+    #[test]
+    fn test_handles_are_send_and_sync() {
+        fn assert_send_sync<T: Send + Sync>() {}
+        assert_send_sync::<SharedData>();
+    }
+}
@@ -0,0 +1,198 @@
+//! 引擎状态的序列化
+//!
+//! 将全局作用域中的变量和用户定义的函数编码为带版本号的字节序列，
+//! 宿主可以缓存这些字节，并在新引擎中恢复，从而跳过重复执行初始化脚本。
+//! 字节内容为 JSON：`{"format": "aether-state", "version": 1, "globals": [...]}`，
+//! 函数以语法树形式保存，数值按 IEEE 754 位模式保存以便精确还原。
+
+use std::cell::RefCell;
+use std::rc::Rc;
+use std::str::FromStr;
+
+use num_bigint::BigInt;
+use num_rational::Ratio;
+use serde::{Deserialize, Serialize};
+
+use crate::ast::Stmt;
+use crate::environment::Environment;
+use crate::value::Value;
+
+/// 状态字节的格式标识
+const FORMAT: &str = "aether-state";
+
+/// 当前状态格式版本，格式发生不兼容的变化时递增
+pub const STATE_VERSION: u32 = 1;
+
+/// 用于在完整解码之前校验格式和版本
+#[derive(Deserialize)]
+struct Header {
+    format: String,
+    version: u32,
+}
+
+#[derive(Serialize, Deserialize)]
+struct State {
+    format: String,
+    version: u32,
+    globals: Vec<(String, StateValue)>,
+}
+
+#[derive(Serialize, Deserialize)]
+enum StateValue {
+    Number(u64),
+    Fraction(String, String),
+    String(String),
+    Boolean(bool),
+    Null,
+    Array(Vec<StateValue>),
+    Dict(Vec<(String, StateValue)>),
+    Function {
+        name: Option<String>,
+        params: Vec<String>,
+        body: Vec<Stmt>,
+    },
+    BuiltIn {
+        name: String,
+        arity: usize,
+    },
+}
+
+/// 将全局变量编码为状态字节
+///
+/// 函数只能捕获全局作用域 `global_env`；捕获了局部变量的闭包、
+/// 生成器和惰性值无法保存，遇到时返回错误。
+pub(crate) fn save(
+    globals: impl IntoIterator<Item = (String, Value)>,
+    global_env: &Rc<RefCell<Environment>>,
+) -> Result<Vec<u8>, String> {
+    let globals = globals
+        .into_iter()
+        .map(|(name, value)| match encode(&value, global_env) {
+            Ok(value) => Ok((name, value)),
+            Err(e) => Err(format!("Cannot save global '{}': {}", name, e)),
+        })
+        .collect::<Result<Vec<_>, _>>()?;
+
+    let state = State {
+        format: FORMAT.to_string(),
+        version: STATE_VERSION,
+        globals,
+    };
+    serde_json::to_vec(&state).map_err(|e| e.to_string())
+}
+
+/// 解码状态字节，返回待绑定的全局变量；函数闭包绑定到 `global_env`
+///
+/// 格式或版本不匹配以及内容损坏时返回错误，此时不会产生任何绑定。
+pub(crate) fn load(
+    bytes: &[u8],
+    global_env: &Rc<RefCell<Environment>>,
+) -> Result<Vec<(String, Value)>, String> {
+    let header: Header =
+        serde_json::from_slice(bytes).map_err(|e| format!("Invalid engine state: {}", e))?;
+    if header.format != FORMAT {
+        return Err(format!(
+            "Invalid engine state: unknown format '{}'",
+            header.format
+        ));
+    }
+    if header.version != STATE_VERSION {
+        return Err(format!(
+            "Unsupported engine state version {} (expected {})",
+            header.version, STATE_VERSION
+        ));
+    }
+
+    let state: State =
+        serde_json::from_slice(bytes).map_err(|e| format!("Invalid engine state: {}", e))?;
+    state
+        .globals
+        .into_iter()
+        .map(|(name, value)| Ok((name, decode(value, global_env)?)))
+        .collect()
+}
+
+fn encode(value: &Value, global_env: &Rc<RefCell<Environment>>) -> Result<StateValue, String> {
+    Ok(match value {
+        Value::Number(n) => StateValue::Number(n.to_bits()),
+        Value::Fraction(f) => StateValue::Fraction(f.numer().to_string(), f.denom().to_string()),
+        Value::String(s) => StateValue::String(s.clone()),
+        Value::Boolean(b) => StateValue::Boolean(*b),
+        Value::Null => StateValue::Null,
+        Value::Array(items) => StateValue::Array(
+            items
+                .iter()
+                .map(|item| encode(item, global_env))
+                .collect::<Result<_, _>>()?,
+        ),
+        Value::Dict(entries) => {
+            let mut entries = entries
+                .iter()
+                .map(|(k, v)| Ok((k.clone(), encode(v, global_env)?)))
+                .collect::<Result<Vec<_>, String>>()?;
+            entries.sort_by(|a, b| a.0.cmp(&b.0));
+            StateValue::Dict(entries)
+        }
+        Value::Function {
+            name,
+            params,
+            body,
+            env,
+        } => {
+            if !Rc::ptr_eq(env, global_env) {
+                return Err("closures that capture local variables cannot be saved".to_string());
+            }
+            StateValue::Function {
+                name: name.clone(),
+                params: params.clone(),
+                body: body.clone(),
+            }
+        }
+        Value::BuiltIn { name, arity } => StateValue::BuiltIn {
+            name: name.clone(),
+            arity: *arity,
+        },
+        Value::Generator { .. } | Value::Lazy { .. } => {
+            return Err(format!("{} values cannot be saved", value.type_name()));
+        }
+    })
+}
+
+fn decode(value: StateValue, global_env: &Rc<RefCell<Environment>>) -> Result<Value, String> {
+    Ok(match value {
+        StateValue::Number(bits) => Value::Number(f64::from_bits(bits)),
+        StateValue::Fraction(numer, denom) => {
+            let parse = |s: &str| {
+                BigInt::from_str(s)
+                    .map_err(|_| format!("Invalid engine state: bad fraction '{}'", s))
+            };
+            let denom = parse(&denom)?;
+            if denom == BigInt::from(0) {
+                return Err("Invalid engine state: zero denominator".to_string());
+            }
+            Value::Fraction(Ratio::new(parse(&numer)?, denom))
+        }
+        StateValue::String(s) => Value::String(s),
+        StateValue::Boolean(b) => Value::Boolean(b),
+        StateValue::Null => Value::Null,
+        StateValue::Array(items) => Value::Array(
+            items
+                .into_iter()
+                .map(|item| decode(item, global_env))
+                .collect::<Result<_, _>>()?,
+        ),
+        StateValue::Dict(entries) => Value::Dict(
+            entries
+                .into_iter()
+                .map(|(k, v)| Ok((k, decode(v, global_env)?)))
+                .collect::<Result<_, String>>()?,
+        ),
+        StateValue::Function { name, params, body } => Value::Function {
+            name,
+            params,
+            body,
+            env: Rc::clone(global_env),
+        },
+        StateValue::BuiltIn { name, arity } => Value::BuiltIn { name, arity },
+    })
+}
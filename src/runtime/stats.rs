@@ -0,0 +1,28 @@
+//! 单次求值的资源统计
+//!
+//! 记录一次顶层求值实际用到的资源，便于与执行限制对照，
+//! 了解脚本离触发限制还有多远；以及各阶段的耗时。
+
+use std::time::Duration;
+
+/// 单次顶层求值的资源统计
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub struct EvalStats {
+    /// 执行的步数（每条语句计一步，与 `max_steps` 的计数方式相同）
+    pub steps: usize,
+    /// 达到的最大函数调用深度（与 `max_recursion_depth` 的计数方式相同）
+    pub peak_call_depth: usize,
+    /// 创建过的最大数组长度（与 `max_array_length` 的检查位置相同）
+    pub peak_array_length: usize,
+}
+
+/// 单次顶层求值各阶段的耗时（见 `Aether::eval_phases`）
+#[derive(Debug, Clone, Copy, PartialEq, Eq, Default)]
+pub struct EvalPhases {
+    /// 解析、警告检查和优化的耗时；命中 AST 缓存时只是查找缓存的耗时
+    pub parse: Duration,
+    /// 执行的耗时；解析失败时为 0
+    pub eval: Duration,
+    /// 是否命中了 AST 缓存（命中时没有解析）
+    pub cached: bool,
+}
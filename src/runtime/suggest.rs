@@ -0,0 +1,65 @@
+//! 拼写建议
+//!
+//! 变量名写错时，从当前可见的名称中找出编辑距离最近的一个，
+//! 用于 `Undefined variable: SUMM (did you mean SUM?)` 这样的提示。
+
+/// 从 `candidates` 中找出与 `name` 最接近的名称
+///
+/// 只返回足够接近的名称（编辑距离不超过 2，且小于名称长度的一半），
+/// 避免给出牵强的建议。距离相同时取字典序最小者，保证结果稳定。
+pub fn closest_name<'a, I>(name: &str, candidates: I) -> Option<String>
+where
+    I: IntoIterator<Item = &'a str>,
+{
+    let max_distance = (name.chars().count() / 2).min(2);
+    candidates
+        .into_iter()
+        .filter(|candidate| *candidate != name)
+        .map(|candidate| (edit_distance(name, candidate), candidate))
+        .filter(|(distance, _)| *distance <= max_distance)
+        .min()
+        .map(|(_, candidate)| candidate.to_string())
+}
+
+/// Levenshtein 编辑距离（按字符计算）
+fn edit_distance(a: &str, b: &str) -> usize {
+    let b: Vec<char> = b.chars().collect();
+    let mut prev: Vec<usize> = (0..=b.len()).collect();
+    let mut curr = vec![0; b.len() + 1];
+
+    for (i, ca) in a.chars().enumerate() {
+        curr[0] = i + 1;
+        for (j, cb) in b.iter().enumerate() {
+            let cost = usize::from(ca != *cb);
+            curr[j + 1] = (prev[j] + cost).min(prev[j + 1] + 1).min(curr[j] + 1);
+        }
+        std::mem::swap(&mut prev, &mut curr);
+    }
+    prev[b.len()]
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn test_edit_distance() {
+        assert_eq!(edit_distance("SUM", "SUM"), 0);
+        assert_eq!(edit_distance("SUMM", "SUM"), 1);
+        assert_eq!(edit_distance("TOTL", "TOTAL"), 1);
+        assert_eq!(edit_distance("ABC", "XYZ"), 3);
+        assert_eq!(edit_distance("", "AB"), 2);
+    }
+
+    #[test]
+    fn test_closest_name() {
+        let names = ["SUM", "TOTAL", "COUNT", "SUB"];
+        assert_eq!(closest_name("SUMM", names), Some("SUM".to_string()));
+        assert_eq!(closest_name("TOTL", names), Some("TOTAL".to_string()));
+        // 距离相同时取字典序最小者
+        assert_eq!(closest_name("SUX", names), Some("SUB".to_string()));
+        assert_eq!(closest_name("PRICE", names), None);
+        // 过短的名称不给建议
+        assert_eq!(closest_name("X", ["Y"]), None);
+    }
+}
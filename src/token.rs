@@ -104,6 +104,7 @@ pub enum Token {
     RightBracket, // ]
     Comma,        // ,
     Colon,        // :
+    Dot,          // . (模块成员访问: NAME.FUNC)
     Semicolon,    // ;
     Newline,      // \n (语句分隔符)
 
@@ -114,6 +115,17 @@ pub enum Token {
 }
 
 impl Token {
+    /// Check if a string is a valid variable name (an identifier that is not a keyword)
+    pub fn is_identifier(name: &str) -> bool {
+        let mut chars = name.chars();
+        match chars.next() {
+            Some(c) if c.is_alphabetic() || c == '_' => {}
+            _ => return false,
+        }
+        chars.all(|c| c.is_alphanumeric() || c == '_')
+            && matches!(Token::lookup_keyword(name), Token::Identifier(_))
+    }
+
     /// Check if a string is a keyword
     pub fn lookup_keyword(ident: &str) -> Token {
         match ident {
@@ -215,6 +227,7 @@ impl Token {
             Token::RightBracket => "]",
             Token::Comma => ",",
             Token::Colon => ":",
+            Token::Dot => ".",
             Token::Semicolon => ";",
             Token::Newline => "\\n",
             Token::Arrow => "->",
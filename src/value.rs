@@ -3,6 +3,7 @@
 
 use crate::ast::{Expr, Stmt};
 use crate::environment::Environment;
+use crate::runtime::NumberLocale;
 use num_bigint::BigInt;
 use num_rational::Ratio;
 use num_traits::Zero;
@@ -107,6 +108,44 @@ impl Value {
         }
     }
 
+    /// Approximate number of bytes held by this value, including nested values
+    ///
+    /// Counts the value itself plus heap storage for strings, arrays, dicts and
+    /// fractions. Functions, generators and lazy values count their parameters
+    /// and the top level of their body but not their captured environment,
+    /// which is shared with (and counted by) the scope that owns it.
+    pub fn approx_size(&self) -> usize {
+        let heap = match self {
+            Value::Fraction(f) => ((f.numer().bits() + f.denom().bits()) / 8) as usize,
+            Value::String(s) => s.capacity(),
+            Value::Array(arr) => {
+                (arr.capacity() - arr.len()) * std::mem::size_of::<Value>()
+                    + arr.iter().map(Value::approx_size).sum::<usize>()
+            }
+            Value::Dict(dict) => dict
+                .iter()
+                .map(|(k, v)| k.capacity() + v.approx_size())
+                .sum(),
+            Value::Function {
+                name, params, body, ..
+            } => {
+                name.as_ref().map_or(0, String::capacity)
+                    + params.iter().map(String::capacity).sum::<usize>()
+                    + body.len() * std::mem::size_of::<Stmt>()
+            }
+            Value::Generator { params, body, .. } => {
+                params.iter().map(String::capacity).sum::<usize>()
+                    + body.len() * std::mem::size_of::<Stmt>()
+            }
+            Value::Lazy { cached, .. } => {
+                std::mem::size_of::<Expr>() + cached.as_ref().map_or(0, |v| v.approx_size())
+            }
+            Value::BuiltIn { name, .. } => name.capacity(),
+            Value::Number(_) | Value::Boolean(_) | Value::Null => 0,
+        };
+        std::mem::size_of::<Value>() + heap
+    }
+
     /// Convert to number if possible
     pub fn to_number(&self) -> Option<f64> {
         match self {
@@ -122,11 +161,77 @@ impl Value {
         }
     }
 
+    /// Convert a timestamp to a Number of seconds since the Unix epoch.
+    ///
+    /// Aether has no date type; timestamps are plain numbers in seconds
+    /// (fractional part for sub-second precision, negative before 1970).
+    /// The epoch is UTC, so values are timezone-independent.
+    pub fn from_system_time(t: std::time::SystemTime) -> Value {
+        match t.duration_since(std::time::UNIX_EPOCH) {
+            Ok(d) => Value::Number(d.as_secs_f64()),
+            Err(e) => Value::Number(-e.duration().as_secs_f64()),
+        }
+    }
+
+    /// Convert a duration to a Number of seconds
+    pub fn from_duration(d: std::time::Duration) -> Value {
+        Value::Number(d.as_secs_f64())
+    }
+
+    /// Interpret a number of seconds since the Unix epoch as a timestamp
+    pub fn to_system_time(&self) -> Option<std::time::SystemTime> {
+        let secs = self.to_number()?;
+        if !secs.is_finite() {
+            return None;
+        }
+        let offset = std::time::Duration::try_from_secs_f64(secs.abs()).ok()?;
+        if secs >= 0.0 {
+            std::time::UNIX_EPOCH.checked_add(offset)
+        } else {
+            std::time::UNIX_EPOCH.checked_sub(offset)
+        }
+    }
+
+    /// Interpret a non-negative number of seconds as a duration
+    pub fn to_duration(&self) -> Option<std::time::Duration> {
+        std::time::Duration::try_from_secs_f64(self.to_number()?).ok()
+    }
+
     /// Convert to string
+    ///
+    /// Numbers have a single runtime type, so rendering follows the value, not
+    /// how it was written: whole numbers (including `4.0` and `(4 / 2)`) never
+    /// contain a decimal point, and every other finite number always does
+    /// (never exponent notation). Hosts can therefore tell integral results
+    /// apart by looking for `.`. Fractions render as `numer/denom`.
     #[allow(clippy::inherent_to_string_shadow_display)]
     pub fn to_string(&self) -> String {
+        self.render(false, None)
+    }
+
+    /// Convert to string with dictionary keys in sorted order
+    ///
+    /// Same as `to_string`, but the output no longer depends on hash map
+    /// iteration order, so it is identical across runs and platforms.
+    pub fn to_sorted_string(&self) -> String {
+        self.render(true, None)
+    }
+
+    /// Convert to string, formatting numbers for the given locale
+    ///
+    /// Numbers (including those nested in arrays and dictionaries) get the
+    /// locale's grouping and decimal separators; everything else renders as in
+    /// `to_string` / `to_sorted_string`.
+    pub fn to_locale_string(&self, locale: &NumberLocale, sorted_keys: bool) -> String {
+        self.render(sorted_keys, Some(locale))
+    }
+
+    fn render(&self, sorted_keys: bool, locale: Option<&NumberLocale>) -> String {
         match self {
             Value::Number(n) => {
+                if let Some(locale) = locale {
+                    return locale.format_number(*n);
+                }
                 // Format number nicely (remove .0 for integers)
                 if n.fract() == 0.0 {
                     format!("{:.0}", n)
@@ -145,13 +250,18 @@ impl Value {
             Value::Boolean(b) => b.to_string(),
             Value::Null => "Null".to_string(),
             Value::Array(arr) => {
-                let elements: Vec<String> = arr.iter().map(|v| v.to_string()).collect();
+                let elements: Vec<String> =
+                    arr.iter().map(|v| v.render(sorted_keys, locale)).collect();
                 format!("[{}]", elements.join(", "))
             }
             Value::Dict(dict) => {
-                let pairs: Vec<String> = dict
-                    .iter()
-                    .map(|(k, v)| format!("{}: {}", k, v.to_string()))
+                let mut entries: Vec<_> = dict.iter().collect();
+                if sorted_keys {
+                    entries.sort_by(|a, b| a.0.cmp(b.0));
+                }
+                let pairs: Vec<String> = entries
+                    .into_iter()
+                    .map(|(k, v)| format!("{}: {}", k, v.render(sorted_keys, locale)))
                     .collect();
                 format!("{{{}}}", pairs.join(", "))
             }
@@ -52,3 +52,464 @@ fn test_unaryop_display() {
     assert_eq!(format!("{}", UnaryOp::Minus), "-");
     assert_eq!(format!("{}", UnaryOp::Not), "!");
 }
+
+fn parse_json(code: &str) -> serde_json::Value {
+    let engine = aether::Aether::new();
+    serde_json::from_str(&engine.parse_ast(code).unwrap()).unwrap()
+}
+
+#[test]
+fn test_parse_ast_kinds_and_positions() {
+    let ast = parse_json("Set X (1 + 2)\n\nPRINTLN(X)");
+    let stmts = ast.as_array().unwrap();
+    assert_eq!(stmts.len(), 2);
+
+    assert_eq!(stmts[0]["kind"], "Set");
+    assert_eq!(stmts[0]["name"], "X");
+    assert_eq!(stmts[0]["line"], 1);
+    assert_eq!(stmts[0]["column"], 1);
+    assert_eq!(stmts[0]["value"]["kind"], "Binary");
+    assert_eq!(stmts[0]["value"]["op"], "Add");
+    assert_eq!(stmts[0]["value"]["left"]["value"], 1.0);
+
+    assert_eq!(stmts[1]["kind"], "Expression");
+    assert_eq!(stmts[1]["line"], 3);
+    assert_eq!(stmts[1]["expr"]["kind"], "Call");
+    assert_eq!(stmts[1]["expr"]["func"]["name"], "PRINTLN");
+
+    // 表达式节点同样带有起始位置；括号本身不是节点
+    let at = |node: &serde_json::Value| (node["line"].clone(), node["column"].clone());
+    let value = &stmts[0]["value"];
+    assert_eq!(at(value), (1.into(), 8.into()));
+    assert_eq!(at(&value["left"]), (1.into(), 8.into()));
+    assert_eq!(at(&value["right"]), (1.into(), 12.into()));
+    assert_eq!(at(&stmts[1]["expr"]), (3.into(), 1.into()));
+    assert_eq!(at(&stmts[1]["expr"]["args"][0]), (3.into(), 9.into()));
+
+    // 成员访问的键位于成员名处
+    let member = &parse_json("Set Y M.NAME")[0]["value"];
+    assert_eq!(member["kind"], "Index");
+    assert_eq!(at(member), (1.into(), 7.into()));
+    assert_eq!(member["index"]["value"], "NAME");
+    assert_eq!(at(&member["index"]), (1.into(), 9.into()));
+}
+
+#[test]
+fn test_parse_ast_nested_statement_positions() {
+    let ast = parse_json(
+        "Func F(A) {\n    Set B Lambda X -> If (X > 0) {\n        Return X\n    }\n    Return B(A)\n}\nF(1)",
+    );
+    let func = &ast[0];
+    assert_eq!(func["kind"], "FuncDef");
+    assert_eq!(func["params"], serde_json::json!(["A"]));
+    assert_eq!(func["line"], 1);
+
+    let body = func["body"].as_array().unwrap();
+    assert_eq!(body[0]["kind"], "Set");
+    assert_eq!(body[0]["line"], 2);
+    assert_eq!(body[0]["column"], 5);
+
+    // 箭头 Lambda 的隐式 Return 排在其内部语句之前
+    let lambda = &body[0]["value"];
+    assert_eq!(lambda["kind"], "Lambda");
+    let implicit_return = &lambda["body"][0];
+    assert_eq!(implicit_return["kind"], "Return");
+    assert_eq!(implicit_return["line"], 2);
+    let inner = &implicit_return["value"]["then"][0];
+    assert_eq!(inner["kind"], "Return");
+    assert_eq!(inner["line"], 3);
+
+    assert_eq!(body[1]["kind"], "Return");
+    assert_eq!(body[1]["line"], 5);
+    assert_eq!(ast[1]["line"], 7);
+}
+
+#[test]
+fn test_parse_comments_round_trip() {
+    let source = "// 总额\nSet X 1 // 初始值\n/* 多行\n注释 */\nSet Y (X + 1)";
+    let engine = aether::Aether::new();
+    let comments: serde_json::Value =
+        serde_json::from_str(&engine.parse_comments(source).unwrap()).unwrap();
+    let comments = comments.as_array().unwrap();
+    assert_eq!(comments.len(), 3);
+
+    // 按行列（字符计）定位每条注释
+    let chars: Vec<char> = source.chars().collect();
+    let mut spans = Vec::new();
+    for comment in comments {
+        let line = comment["line"].as_u64().unwrap() as usize;
+        let column = comment["column"].as_u64().unwrap() as usize;
+        let line_start = source
+            .split('\n')
+            .take(line - 1)
+            .map(|l| l.chars().count() + 1)
+            .sum::<usize>();
+        let start = line_start + column - 1;
+        let text: Vec<char> = comment["text"].as_str().unwrap().chars().collect();
+        assert_eq!(chars[start..start + text.len()], text[..]);
+        spans.push((start, text));
+    }
+    // 去掉注释后再按原位置放回，得到原代码
+    let mut stripped = chars.clone();
+    for (start, text) in spans.iter().rev() {
+        stripped.drain(*start..start + text.len());
+    }
+    let stripped: String = stripped.into_iter().collect();
+    assert_eq!(stripped, "\nSet X 1 \n\nSet Y (X + 1)");
+    assert_eq!(engine.parse_comments(&stripped).unwrap(), "[]");
+
+    let mut rebuilt: Vec<char> = stripped.chars().collect();
+    for (start, text) in &spans {
+        rebuilt.splice(*start..*start, text.iter().copied());
+    }
+    assert_eq!(rebuilt.into_iter().collect::<String>(), source);
+
+    assert!(engine.parse_comments("Set X ( // 未闭合").is_err());
+}
+
+#[test]
+fn test_parse_ast_rejects_invalid_code() {
+    let engine = aether::Aether::new();
+    let err = engine.parse_ast("Set X (1 +").unwrap_err();
+    assert!(err.contains("Parse error"), "{}", err);
+}
+
+#[test]
+fn test_validate_with_warnings_reports_unused_set() {
+    let engine = aether::Aether::new();
+    let warnings = engine
+        .validate_with_warnings(
+            r#"Set SUMM 0
+For X In [1, 2, 3] {
+    Set SUM (SUM + X)
+}
+SUM"#,
+        )
+        .unwrap();
+
+    assert_eq!(warnings.len(), 1);
+    assert_eq!(warnings[0].severity, aether::Severity::Warning);
+    assert_eq!(warnings[0].message, "Variable 'SUMM' is set but never read");
+    assert_eq!((warnings[0].line, warnings[0].column), (1, 1));
+
+    // 没有问题的代码不产生警告；无法解析的代码返回错误
+    assert!(
+        engine
+            .validate_with_warnings("Set A 1\nA")
+            .unwrap()
+            .is_empty()
+    );
+    assert!(engine.validate_with_warnings("Set A (").is_err());
+}
+
+#[test]
+fn test_warnings_as_errors() {
+    let mut engine = aether::Aether::new().with_warnings_as_errors();
+    assert!(engine.warnings_as_errors());
+    let code = "Set A 1\nSet B 2\nSet C 3\nC";
+
+    // 列出全部警告，代码不会执行
+    let err = engine.eval(code).unwrap_err();
+    assert!(err.starts_with("Parse error"), "{}", err);
+    assert!(err.contains("line 1, column 1: Variable 'A' is set but never read [unused-variable]"));
+    assert!(err.contains("line 2, column 1: Variable 'B'"), "{}", err);
+    assert!(engine.eval("C").is_err());
+    assert!(engine.validate_with_warnings(code).is_err());
+    assert!(engine.eval_report(code).is_err());
+
+    // 干净的代码照常求值；关闭后（缓存被清空）恢复为只报告警告
+    assert_eq!(engine.eval("Set D 4\nD").unwrap().to_string(), "4");
+    engine.set_warnings_as_errors(false);
+    assert_eq!(engine.validate_with_warnings(code).unwrap().len(), 2);
+    assert_eq!(engine.eval(code).unwrap().to_string(), "3");
+}
+
+#[test]
+fn test_diagnostics_combine_errors_and_warnings() {
+    use aether::Severity;
+
+    let mut engine = aether::Aether::new();
+    engine.set_global("LIMIT", aether::Value::Number(10.0));
+
+    let diagnostics = engine.diagnostics(
+        r#"Set TOTAL 0
+Set UNUSED 1
+For X In [1, 2] {
+    Set TOTAL (TOTAL + X + MISSING)
+}
+PRINTLN(TOTAL, LIMIT)"#,
+    );
+
+    assert_eq!(diagnostics.len(), 2, "{:?}", diagnostics);
+    let undefined = &diagnostics[0];
+    assert_eq!(undefined.severity, Severity::Error);
+    assert_eq!(undefined.code, "undefined-identifier");
+    assert_eq!(undefined.message, "Identifier 'MISSING' is not defined");
+    // 范围精确到标识符本身
+    assert_eq!((undefined.line, undefined.column), (4, 28));
+    assert_eq!((undefined.end_line, undefined.end_column), (4, 35));
+
+    let unused = &diagnostics[1];
+    assert_eq!(unused.severity, Severity::Warning);
+    assert_eq!(unused.code, "unused-variable");
+    assert_eq!((unused.line, unused.column), (2, 5));
+    assert_eq!(unused.end_column, 11);
+
+    // 参数、循环变量和 Lambda 参数都视为已定义
+    assert!(
+        engine
+            .diagnostics("Func F(A) {\n    Return MAP([A], Lambda(V) -> V * 2)\n}\nF(1)")
+            .is_empty()
+    );
+}
+
+#[test]
+fn test_diagnostics_report_parse_errors() {
+    let engine = aether::Aether::new();
+
+    // 解析错误作为诊断返回，出错行之前的代码仍然会被分析
+    let diagnostics = engine.diagnostics("Set A NOPE\nSet B (1 +\n");
+    assert_eq!(diagnostics[0].severity, aether::Severity::Error);
+    assert_eq!(diagnostics[0].code, "invalid-expression");
+    assert!(diagnostics[0].line >= 2, "{:?}", diagnostics);
+    assert!(
+        diagnostics
+            .iter()
+            .any(|d| d.code == "undefined-identifier" && d.line == 1),
+        "{:?}",
+        diagnostics
+    );
+
+    // 各种畸形输入都不会 panic
+    for code in [
+        "",
+        "Set",
+        "Func (",
+        "\"abc",
+        "}}}",
+        "Set X [1, 2",
+        "A.",
+        "@#$",
+    ] {
+        assert!(
+            !engine.diagnostics(code).is_empty() || code.is_empty(),
+            "{}",
+            code
+        );
+    }
+}
+
+#[test]
+fn test_infer_type() {
+    use aether::{TypeKind, Value};
+
+    let mut engine = aether::Aether::new();
+    engine.set_global("X", Value::Number(2.0));
+    engine.set_global("RATE", Value::Number(0.5));
+
+    let cases = [
+        ("(X + 1)", TypeKind::Int),
+        ("(X + RATE)", TypeKind::Float),
+        ("(RATE + RATE)", TypeKind::Number),
+        ("(X / 2)", TypeKind::Number),
+        ("(\"a\" + \"b\")", TypeKind::String),
+        ("(X > 1)", TypeKind::Boolean),
+        ("Set Y \"n\"\n(Y + \"!\")", TypeKind::String),
+        (
+            "If (X > 1) {\n    \"big\"\n} Else {\n    \"small\"\n}",
+            TypeKind::String,
+        ),
+        ("[1, 2]", TypeKind::Array),
+        // 无法静态确定的情况返回 Unknown
+        ("LEN([1, 2])", TypeKind::Unknown),
+        ("(UNBOUND + 1)", TypeKind::Unknown),
+        ("If (X > 1) {\n    \"big\"\n}", TypeKind::Unknown),
+        (
+            "Set I 0\nWhile (I < 3) {\n    Set I \"s\"\n}\nI",
+            TypeKind::Unknown,
+        ),
+        (
+            "If (X > 1) {\n    Return \"early\"\n}\n1",
+            TypeKind::Unknown,
+        ),
+    ];
+    for (code, expected) in cases {
+        assert_eq!(engine.infer_type(code).unwrap(), expected, "{}", code);
+    }
+
+    // 推断不执行代码
+    engine.infer_type("Set X \"changed\"").unwrap();
+    assert_eq!(engine.eval("X").unwrap(), Value::Number(2.0));
+
+    assert!(engine.infer_type("(X +").is_err());
+}
+
+#[test]
+fn test_validate_predicate() {
+    let mut engine = aether::Aether::new();
+    engine.register_function("LOOKUP", 1, |_args| Ok(aether::Value::Boolean(true)));
+
+    for code in [
+        "(AGE >= 18) && (COUNTRY == \"CN\")",
+        "!CONTAINS(NAME, \"test\")",
+        "(LEN(FILTER(TAGS, UPPER)) > 0)",
+    ] {
+        assert!(engine.validate_predicate(code).is_ok(), "{}", code);
+    }
+
+    for code in [
+        // 有副作用的调用
+        "(PRINT(1) == Null)",
+        "(RANDOM() > 0.5)",
+        "(LEN(MAP(TAGS, PRINTLN)) > 0)",
+        // 宿主函数和脚本函数无法检查
+        "(LOOKUP(1) == True)",
+        // 定义和多条语句
+        "Set X 1\n(X > 0)",
+        "(LEN(MAP(TAGS, Lambda T -> T)) > 0)",
+        // 结果不是布尔值或无法确定
+        "(AGE + 1)",
+        "CONTAINS(NAME, \"test\")",
+    ] {
+        let err = engine.validate_predicate(code).unwrap_err();
+        assert!(err.starts_with("Invalid predicate"), "{}: {}", code, err);
+    }
+
+    // 校验不执行代码
+    engine.eval("Func CHECK() {\n    Return True\n}").unwrap();
+    assert!(engine.validate_predicate("(CHECK() == True)").is_err());
+    assert!(
+        engine
+            .validate_predicate("(1 >")
+            .unwrap_err()
+            .contains("Parse error")
+    );
+}
+
+#[test]
+fn test_estimate_cost() {
+    let engine = aether::Aether::new();
+
+    let flat = engine.estimate_cost("Set X 1\nPRINT(X)").unwrap();
+    assert_eq!(
+        (flat.loops, flat.max_loop_depth, flat.max_nesting),
+        (0, 0, 0)
+    );
+    assert!(flat.recursive_functions.is_empty());
+    assert_eq!(flat.score, 2);
+
+    let code = "Func FACT(N) {\n    If (N <= 1) {\n        Return 1\n    }\n    Return (N * FACT(N - 1))\n}\nFor I In RANGE(100) {\n    Set J 0\n    While (J < I) {\n        Set J (J + 1)\n    }\n}";
+    let cost = engine.estimate_cost(code).unwrap();
+    assert_eq!(cost.loops, 2);
+    assert_eq!(cost.max_loop_depth, 2);
+    assert_eq!(cost.max_nesting, 2);
+    assert_eq!(cost.functions, 1);
+    assert_eq!(cost.recursive_functions, vec!["FACT".to_string()]);
+    // 嵌套循环和递归让分数远高于平铺的代码
+    assert!(cost.score > 1000 + flat.score);
+
+    // 函数体内的循环不乘以定义处外层循环的权重
+    let nested = engine
+        .estimate_cost("For I In [1] {\n    Func F() {\n        Return 1\n    }\n}")
+        .unwrap();
+    assert_eq!(nested.max_loop_depth, 1);
+    assert_eq!(nested.score, 1 + 10 + 1);
+
+    assert!(engine.estimate_cost("While (").is_err());
+}
+
+#[test]
+fn test_functions_lists_user_definitions() {
+    let mut engine = aether::Aether::new();
+    engine
+        .load_prelude("Func DOUBLE(X) {\n    Return (X * 2)\n}")
+        .unwrap();
+    let code = "Set F Lambda(X) -> (X + 1)\n\nFunc ADD(A, B) {\n    Return (A + B)\n}";
+    engine.eval(code).unwrap();
+
+    let functions = engine.functions();
+    let summary: Vec<_> = functions
+        .iter()
+        .map(|f| (f.name.as_str(), f.params.clone(), f.line, f.column))
+        .collect();
+    // 只包含用户定义的 Func，不含内置函数与 Lambda
+    assert_eq!(
+        summary,
+        vec![
+            ("ADD", vec!["A".to_string(), "B".to_string()], 3, 1),
+            ("DOUBLE", vec!["X".to_string()], 1, 1),
+        ]
+    );
+
+    // 命中 AST 缓存时保留定义位置
+    engine.reset_env();
+    engine.eval(code).unwrap();
+    let add = engine
+        .functions()
+        .into_iter()
+        .find(|f| f.name == "ADD")
+        .unwrap();
+    assert_eq!((add.line, add.column), (3, 1));
+}
+
+#[test]
+fn test_required_permissions() {
+    use aether::IOPermissions;
+
+    let engine = aether::Aether::new();
+    let scan = |code: &str| engine.required_permissions(code).unwrap();
+
+    assert_eq!(scan("Set X (1 + 2)\nPRINTLN(X)"), IOPermissions::deny_all());
+    assert_eq!(
+        scan("Set TEXT READ_FILE(\"a.txt\")"),
+        IOPermissions {
+            filesystem_enabled: true,
+            network_enabled: false,
+        }
+    );
+    // 未执行的函数体与作为值传递的内置函数同样计入
+    let code = "Func FETCH(URL) {\n    Return HTTP_GET(URL)\n}\nSet R MAP([\"a\"], FILE_EXISTS)";
+    assert_eq!(scan(code), IOPermissions::allow_all());
+
+    assert!(engine.required_permissions("READ_FILE(").is_err());
+}
+
+#[test]
+fn test_free_variables() {
+    let mut engine = aether::Aether::new();
+    engine.register_function("LOOKUP_RATE", 1, |_| Ok(aether::Value::Number(0.1)));
+    engine
+        .eval("Func DOUBLE(N) {\n    Return (N * 2)\n}")
+        .unwrap();
+
+    let code = r#"
+Set BONUS (SALARY * LOOKUP_RATE(GRADE))
+Func SCALE(X) {
+    Return (X * FACTOR)
+}
+Set F Lambda Y -> (Y + OFFSET)
+For ITEM In ITEMS {
+    PRINTLN(ITEM, DOUBLE(BONUS), SCALE(F(SALARY)))
+}
+"#;
+    // 参数、循环变量、局部 Set、内置/宿主/全局函数都不算自由变量
+    assert_eq!(
+        engine.free_variables(code).unwrap(),
+        vec!["SALARY", "GRADE", "FACTOR", "OFFSET", "ITEMS"]
+    );
+
+    // 已设置的全局变量仍然是脚本的输入
+    engine.set_global("SALARY", aether::Value::Number(1000.0));
+    assert_eq!(
+        engine.free_variables("(SALARY + 1)").unwrap(),
+        vec!["SALARY"]
+    );
+
+    assert!(
+        engine
+            .free_variables("Set X 1\n(X + 1)")
+            .unwrap()
+            .is_empty()
+    );
+    assert!(engine.free_variables("Set X (").is_err());
+}
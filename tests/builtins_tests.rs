@@ -126,6 +126,32 @@ fn test_range() {
     );
 }
 
+#[test]
+fn test_first_last_and_len_edges() {
+    let empty = [Value::Array(vec![])];
+    let single = [Value::Array(vec![Value::Number(7.0)])];
+    let many = [Value::Array(vec![
+        Value::Number(1.0),
+        Value::Null,
+        Value::Number(3.0),
+    ])];
+
+    assert_eq!(array::first(&single).unwrap(), Value::Number(7.0));
+    assert_eq!(array::last(&single).unwrap(), Value::Number(7.0));
+    assert_eq!(array::first(&many).unwrap(), Value::Number(1.0));
+    assert_eq!(array::last(&many).unwrap(), Value::Number(3.0));
+
+    // 空数组报错，而不是返回 Null
+    let err = array::first(&empty).unwrap_err();
+    assert_eq!(err.to_string(), "Invalid operation: FIRST of empty array");
+    let err = array::last(&empty).unwrap_err();
+    assert_eq!(err.to_string(), "Invalid operation: LAST of empty array");
+    assert!(array::first(&[Value::String("ab".to_string())]).is_err());
+
+    assert_eq!(types::len(&empty).unwrap(), Value::Number(0.0));
+    assert_eq!(types::len(&single).unwrap(), Value::Number(1.0));
+}
+
 #[test]
 fn test_push() {
     let arr = Value::Array(vec![Value::Number(1.0)]);
@@ -206,6 +232,30 @@ fn test_min() {
     assert_eq!(array::min(&[arr]).unwrap(), Value::Number(1.0));
 }
 
+#[test]
+fn test_deep_len_and_depth() {
+    // [[1, 2], [3, [4]], []]
+    let arr = Value::Array(vec![
+        Value::Array(vec![Value::Number(1.0), Value::Number(2.0)]),
+        Value::Array(vec![
+            Value::Number(3.0),
+            Value::Array(vec![Value::Number(4.0)]),
+        ]),
+        Value::Array(vec![]),
+    ]);
+    assert_eq!(
+        array::deep_len(std::slice::from_ref(&arr)).unwrap(),
+        Value::Number(4.0)
+    );
+    assert_eq!(array::depth(&[arr]).unwrap(), Value::Number(3.0));
+
+    assert_eq!(
+        array::depth(&[Value::Array(vec![])]).unwrap(),
+        Value::Number(1.0)
+    );
+    assert!(array::deep_len(&[Value::Number(1.0)]).is_err());
+}
+
 #[test]
 fn test_join() {
     let arr = Value::Array(vec![
@@ -0,0 +1,63 @@
+use std::time::{Duration, SystemTime, UNIX_EPOCH};
+
+use aether::{Aether, Value};
+
+#[test]
+fn now_reads_system_clock_by_default() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.clock(), None);
+
+    let before = Value::from_system_time(SystemTime::now())
+        .to_number()
+        .unwrap();
+    let now = engine.eval("NOW()").unwrap().to_number().unwrap();
+    let after = Value::from_system_time(SystemTime::now())
+        .to_number()
+        .unwrap();
+    assert!(
+        before <= now && now <= after,
+        "{} not in [{}, {}]",
+        now,
+        before,
+        after
+    );
+}
+
+#[test]
+fn fixed_clock_freezes_now() {
+    let frozen = UNIX_EPOCH + Duration::from_secs(1_700_000_000);
+    let mut engine = Aether::new().with_clock(frozen);
+    assert_eq!(engine.clock(), Some(frozen));
+
+    // 同一次求值中以及多次求值之间都返回同一时间
+    assert_eq!(
+        engine.eval("[NOW(), NOW()]").unwrap(),
+        Value::Array(vec![Value::Number(1.7e9), Value::Number(1.7e9)])
+    );
+    let code = r#"
+Func IS_EXPIRED(DEADLINE) {
+    Return (NOW() > DEADLINE)
+}
+[IS_EXPIRED(1699999999), IS_EXPIRED(1700000001)]
+"#;
+    assert_eq!(
+        engine.eval(code).unwrap(),
+        Value::Array(vec![Value::Boolean(true), Value::Boolean(false)])
+    );
+
+    engine.set_clock(None);
+    assert_eq!(engine.clock(), None);
+    assert!(engine.eval("NOW()").unwrap().to_number().unwrap() > 1.7e9);
+}
+
+#[test]
+fn clock_and_seed_make_evaluation_deterministic() {
+    let frozen = UNIX_EPOCH + Duration::from_millis(1_234_567_890_500);
+    let run = || {
+        let mut engine = Aether::new().with_clock(frozen);
+        engine.set_seed(7);
+        engine.eval("[NOW(), RANDOM_INT(1, 1000000)]").unwrap()
+    };
+    assert_eq!(run(), run());
+    assert!(Aether::new().eval("NOW(1)").is_err());
+}
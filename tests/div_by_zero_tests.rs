@@ -0,0 +1,60 @@
+use aether::{Aether, DivByZeroMode, Value};
+
+fn eval_number(engine: &mut Aether, code: &str) -> f64 {
+    match engine.eval(code) {
+        Ok(Value::Number(n)) => n,
+        other => panic!("{}: expected a number, got {:?}", code, other),
+    }
+}
+
+#[test]
+fn default_mode_is_error() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.div_by_zero(), DivByZeroMode::Error);
+
+    for code in ["(1 / 0)", "(1.5 / 0)", "(0 / 0)", "(7 % 0)", "(2.5 % 0.0)"] {
+        let err = engine.eval(code).unwrap_err();
+        assert!(err.contains("Division by zero"), "{}: {}", code, err);
+    }
+}
+
+#[test]
+fn infinity_mode_follows_ieee() {
+    let mut engine = Aether::new();
+    engine.set_div_by_zero(DivByZeroMode::Infinity);
+
+    assert_eq!(eval_number(&mut engine, "(1 / 0)"), f64::INFINITY);
+    assert_eq!(eval_number(&mut engine, "(-2.5 / 0)"), f64::NEG_INFINITY);
+    assert_eq!(eval_number(&mut engine, "(3 / 0.0)"), f64::INFINITY);
+    assert!(eval_number(&mut engine, "(0 / 0)").is_nan());
+    assert!(eval_number(&mut engine, "(7 % 0)").is_nan());
+
+    // 分数操作数同样适用
+    assert_eq!(
+        eval_number(&mut engine, "(TO_FRACTION(0.5) / 0)"),
+        f64::INFINITY
+    );
+    assert_eq!(
+        eval_number(&mut engine, "(-1 / TO_FRACTION(0))"),
+        f64::NEG_INFINITY
+    );
+}
+
+#[test]
+fn zero_mode_returns_zero() {
+    let mut engine = Aether::new();
+    engine.set_div_by_zero(DivByZeroMode::Zero);
+
+    for code in ["(1 / 0)", "(-2.5 / 0)", "(0 / 0)", "(7 % 0)", "(2.5 % 0.0)"] {
+        assert_eq!(eval_number(&mut engine, code), 0.0, "{}", code);
+    }
+
+    assert_eq!(
+        eval_number(&mut engine, "(TO_FRACTION(0.5) / TO_FRACTION(0))"),
+        0.0
+    );
+
+    // 除数不为零时不受影响
+    assert_eq!(eval_number(&mut engine, "(5 / 2)"), 2.5);
+    assert_eq!(eval_number(&mut engine, "(7 % 3)"), 1.0);
+}
@@ -41,3 +41,116 @@ MAP(A, BAD)
         "missing BAD(X) frame: {signatures:?}"
     );
 }
+
+#[test]
+fn error_report_frames_carry_call_sites() {
+    let mut engine = Aether::new();
+    let code = "Func INNER(X) {\n    Return (X / 0)\n}\nFunc OUTER(X) {\n    Return INNER(X)\n}\nSet A 1\n  OUTER(A)";
+
+    // 缓存命中时同样带有位置
+    for _ in 0..2 {
+        let report = engine.eval_report(code).unwrap_err();
+        assert_eq!(report.kind, "DivisionByZero");
+
+        let frames: Vec<(&str, usize, usize)> = report
+            .call_stack
+            .iter()
+            .map(|f| (f.name.as_str(), f.line, f.column))
+            .collect();
+        // 顶层语句发起的调用带有调用位置，函数内部发起的调用位置未知
+        assert_eq!(frames, vec![("OUTER", 8, 3), ("INNER", 0, 0)]);
+    }
+
+    let json = engine.eval_report(code).unwrap_err().to_json_value();
+    assert_eq!(json["call_stack"][0]["line"], 8);
+    assert_eq!(json["call_stack"][0]["column"], 3);
+
+    // 宿主直接调用函数之后，下一次求值使用自己的语句位置
+    assert!(
+        engine
+            .call("OUTER", vec![aether::Value::Number(1.0)])
+            .is_err()
+    );
+    let report = engine.eval_report("Set B 2\nOUTER(B)").unwrap_err();
+    assert_eq!(
+        (report.call_stack[0].line, report.call_stack[0].column),
+        (2, 1)
+    );
+}
+
+#[test]
+fn named_engine_prefixes_errors() {
+    let mut engine = Aether::new().with_name("rules-a");
+    assert_eq!(engine.name(), Some("rules-a"));
+
+    let err = engine.eval("UNDEFINED_VAR").unwrap_err();
+    assert!(err.starts_with("[rules-a] Runtime error:"), "{}", err);
+
+    let err = engine.eval("Set X (").unwrap_err();
+    assert!(err.starts_with("[rules-a] Parse error:"), "{}", err);
+
+    engine.set_name(None);
+    let err = engine.eval("UNDEFINED_VAR").unwrap_err();
+    assert!(err.starts_with("Runtime error:"), "{}", err);
+}
+
+#[test]
+fn undefined_variable_suggests_closest_name() {
+    let mut engine = Aether::new();
+
+    let err = engine.eval("Set SUM 10\n(SUMM + 1)").unwrap_err();
+    assert!(
+        err.contains("Undefined variable: SUMM (did you mean SUM?)"),
+        "{}",
+        err
+    );
+
+    // 函数内可以建议参数等局部名称
+    let err = engine
+        .eval("Func AREA(WIDTH, HEIGHT) {\n    Return (WIDTH * HIEGHT)\n}\nAREA(2, 3)")
+        .unwrap_err();
+    assert!(err.contains("did you mean HEIGHT?"), "{}", err);
+
+    // 没有足够接近的名称时不给建议
+    let err = engine.eval("QUANTITY_ORDERED").unwrap_err();
+    assert!(
+        err.contains("Undefined variable: QUANTITY_ORDERED"),
+        "{}",
+        err
+    );
+    assert!(!err.contains("did you mean"), "{}", err);
+}
+
+#[test]
+fn error_formatter_controls_error_strings() {
+    let mut engine = Aether::new().with_name("billing");
+    engine.set_error_formatter(|report| {
+        format!("{}/{}: {}", report.phase, report.kind, report.message)
+    });
+
+    assert_eq!(
+        engine.eval("(1 / 0)").unwrap_err(),
+        "runtime/DivisionByZero: Division by zero"
+    );
+    assert!(
+        engine
+            .eval("(1 +")
+            .unwrap_err()
+            .starts_with("parse/ParseError: ")
+    );
+    assert!(
+        engine
+            .call("MISSING", vec![])
+            .unwrap_err()
+            .starts_with("runtime/")
+    );
+
+    // 清除后恢复默认格式（包括引擎名称前缀）
+    engine.clear_error_formatter();
+    assert!(
+        engine
+            .eval("(1 / 0)")
+            .unwrap_err()
+            .starts_with("[billing] Runtime error: ")
+    );
+}
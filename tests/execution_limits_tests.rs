@@ -304,3 +304,571 @@ fn test_step_counter_with_simple_code() {
     let result2 = engine.eval(code2);
     assert!(result2.is_err(), "Should fail due to step limit");
 }
+
+#[test]
+fn test_max_result_size() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.max_result_size(), None);
+
+    engine.set_max_result_size(Some(100));
+
+    // 在限制内
+    let result = engine.eval(r#"REPEAT("a", 100)"#).unwrap();
+    assert_eq!(result.to_string().len(), 100);
+
+    // 超大字符串被拒绝
+    let err = engine.eval(r#"REPEAT("a", 101)"#).unwrap_err();
+    assert!(err.contains("Result size limit exceeded"), "{}", err);
+
+    // 数组按字符串形式计算
+    let err = engine.eval("RANGE(0, 1000)").unwrap_err();
+    assert!(err.contains("limit: 100 bytes"), "{}", err);
+
+    // 只检查顶层结果，中间值不受限制
+    let result = engine
+        .eval(
+            r#"Set BIG REPEAT("a", 10000)
+STRLEN(BIG)"#,
+        )
+        .unwrap();
+    assert_eq!(result.to_string(), "10000");
+
+    let report = engine.eval_report(r#"REPEAT("a", 101)"#).unwrap_err();
+    assert_eq!(report.kind, "ExecutionLimit");
+
+    engine.set_max_result_size(None);
+    assert!(engine.eval(r#"REPEAT("a", 101)"#).is_ok());
+}
+
+#[test]
+fn test_max_array_length() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.max_array_length(), None);
+
+    engine.set_max_array_length(Some(10));
+
+    // 循环中不断 PUSH，超过上限时终止
+    let err = engine
+        .eval(
+            r#"
+Set ARR []
+Set I 0
+While (I < 100) {
+    Set ARR PUSH(ARR, I)
+    Set I (I + 1)
+}
+LEN(ARR)
+"#,
+        )
+        .unwrap_err();
+    assert!(
+        err.contains("Array length limit exceeded: 11 elements (limit: 10)"),
+        "{}",
+        err
+    );
+
+    // 字面量和内置函数返回的数组同样受限
+    assert!(engine.eval("[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11]").is_err());
+    assert!(engine.eval("RANGE(0, 20)").is_err());
+    assert_eq!(engine.eval("LEN(RANGE(0, 10))").unwrap().to_string(), "10");
+
+    let report = engine.eval_report("RANGE(0, 20)").unwrap_err();
+    assert_eq!(report.kind, "ExecutionLimit");
+
+    engine.set_max_array_length(None);
+    assert!(engine.eval("RANGE(0, 20)").is_ok());
+}
+
+#[test]
+fn test_eval_with_stats_reports_usage() {
+    let mut engine = Aether::new();
+    let code = r#"
+Func SUM(N) {
+    If (N < 1) {
+        Return 0
+    }
+    Return (N + SUM((N - 1)))
+}
+Set ARR RANGE(0, 7)
+Set SMALL [1, 2, 3]
+SUM(4)
+"#;
+
+    let (result, stats) = engine.eval_with_stats(code);
+    assert_eq!(result.unwrap().to_string(), "10");
+    assert_eq!(stats.peak_call_depth, 5);
+    assert_eq!(stats.peak_array_length, 7);
+    assert!(stats.steps > 0);
+
+    // 统计口径与对应的执行限制一致：恰好等于统计值的限制可以通过，少一则失败
+    let limits = ExecutionLimits {
+        max_steps: Some(stats.steps),
+        max_recursion_depth: Some(stats.peak_call_depth),
+        ..Default::default()
+    };
+    engine.set_limits(limits.clone());
+    engine.set_max_array_length(Some(stats.peak_array_length));
+    assert!(engine.eval(code).is_ok());
+
+    for tighten in [
+        |l: &mut ExecutionLimits| l.max_steps = l.max_steps.map(|n| n - 1),
+        |l: &mut ExecutionLimits| l.max_recursion_depth = l.max_recursion_depth.map(|n| n - 1),
+    ] {
+        let mut tight = limits.clone();
+        tighten(&mut tight);
+        engine.set_limits(tight);
+        assert!(engine.eval(code).is_err());
+    }
+    engine.set_limits(limits);
+    engine.set_max_array_length(Some(stats.peak_array_length - 1));
+    assert!(engine.eval(code).is_err());
+}
+
+#[test]
+fn test_eval_with_stats_on_error_and_between_runs() {
+    let mut engine = Aether::new();
+    engine.set_max_array_length(Some(5));
+
+    // 触发限制时同样返回统计
+    let (result, stats) = engine.eval_with_stats("Set A [1, 2]\nRANGE(0, 9)");
+    assert!(result.is_err());
+    assert_eq!(stats.peak_array_length, 9);
+
+    // 每次求值重新统计
+    let (_, stats) = engine.eval_with_stats("1");
+    assert_eq!(stats.peak_array_length, 0);
+    assert_eq!(stats.peak_call_depth, 0);
+}
+
+#[test]
+fn test_interrupt_from_another_thread() {
+    // 超时只是兜底，避免中断失效时测试卡住
+    let mut engine = Aether::new().with_limits(ExecutionLimits {
+        max_steps: None,
+        max_recursion_depth: None,
+        max_duration_ms: Some(10_000),
+        max_memory_bytes: None,
+    });
+    let handle = engine.interrupt_handle();
+
+    let stopper = std::thread::spawn(move || {
+        std::thread::sleep(std::time::Duration::from_millis(50));
+        handle.interrupt();
+    });
+
+    let err = engine
+        .eval("Set I 0\nWhile (True) {\n    Set I (I + 1)\n}")
+        .unwrap_err();
+    stopper.join().unwrap();
+    assert!(err.contains("Evaluation interrupted"), "{}", err);
+
+    // 中断后引擎照常可用，已执行的语句效果保留
+    assert_eq!(engine.eval("(I > 0)").unwrap().to_string(), "true");
+}
+
+#[test]
+fn test_timeout_stops_empty_loop_promptly() {
+    let mut engine = Aether::new().with_limits(ExecutionLimits {
+        max_steps: None,
+        max_recursion_depth: None,
+        max_duration_ms: Some(100),
+        max_memory_bytes: None,
+    });
+    // 宿主函数调用期间不检查时限：SLOW 返回时已超时，只剩循环迭代还能检查
+    engine.register_function("SLOW", 0, |_| {
+        std::thread::sleep(std::time::Duration::from_millis(110));
+        Ok(aether::Value::Array(vec![aether::Value::Number(1.0); 3]))
+    });
+
+    // 空循环体没有语句，也要在超时后及时终止
+    for code in [
+        "While (True) {\n}",
+        "Set I 0\nWhile ((I * 2) >= 0) {\n    Continue\n}",
+        "For X In SLOW() {\n}",
+        "For I, X In SLOW() {\n    Continue\n}",
+    ] {
+        let start = std::time::Instant::now();
+        let err = engine.eval(code).unwrap_err();
+        let elapsed = start.elapsed().as_millis();
+        assert!(err.contains("duration limit exceeded"), "{}: {}", code, err);
+        assert!((100..150).contains(&elapsed), "stopped after {}ms", elapsed);
+    }
+}
+
+#[test]
+fn test_interrupt_stops_empty_loop() {
+    let mut engine = Aether::new().with_limits(ExecutionLimits {
+        max_steps: None,
+        max_recursion_depth: None,
+        max_duration_ms: Some(10_000),
+        max_memory_bytes: None,
+    });
+    let handle = engine.interrupt_handle();
+
+    let stopper = std::thread::spawn(move || {
+        std::thread::sleep(std::time::Duration::from_millis(20));
+        handle.interrupt();
+    });
+
+    let err = engine.eval("While (True) {\n}").unwrap_err();
+    stopper.join().unwrap();
+    assert!(err.contains("Evaluation interrupted"), "{}", err);
+
+    // 中断在求值可迭代对象时到达，之后只剩空循环体的迭代还能检查
+    let handle = engine.interrupt_handle();
+    engine.register_function("STOP", 0, move |_| {
+        handle.interrupt();
+        Ok(aether::Value::Array(vec![aether::Value::Number(1.0); 3]))
+    });
+    for code in ["For X In STOP() {\n}", "For I, X In STOP() {\n}"] {
+        let err = engine.eval(code).unwrap_err();
+        assert!(err.contains("Evaluation interrupted"), "{}: {}", code, err);
+    }
+}
+
+#[test]
+fn test_interrupt_while_idle_is_ignored() {
+    let mut engine = Aether::new();
+    let handle = engine.interrupt_handle();
+
+    handle.interrupt();
+    assert!(handle.is_interrupted());
+    assert_eq!(engine.eval("(1 + 1)").unwrap().to_string(), "2");
+    assert!(!handle.is_interrupted());
+}
+
+#[test]
+fn test_safe_defaults_bundle() {
+    let mut engine = Aether::with_safe_defaults();
+
+    assert_eq!(engine.limits(), &ExecutionLimits::strict());
+    assert_eq!(engine.max_result_size(), Some(1024 * 1024));
+    assert_eq!(engine.max_array_length(), Some(100_000));
+    assert_eq!(engine.max_nesting_depth(), Some(256));
+    assert!(!engine.permissions().filesystem_enabled);
+    assert!(!engine.permissions().network_enabled);
+
+    // 正常脚本不受影响，失控循环和超大数组被拦截
+    assert_eq!(
+        engine.eval("LEN(RANGE(0, 1000))").unwrap().to_string(),
+        "1000"
+    );
+    assert!(
+        engine
+            .eval("Set I 0\nWhile (True) {\n    Set I (I + 1)\n}")
+            .is_err()
+    );
+    assert!(engine.eval("RANGE(0, 200000)").is_err());
+    let deep = format!("{}1{}", "(".repeat(10_000), ")".repeat(10_000));
+    let err = engine.eval(&deep).unwrap_err();
+    assert!(err.contains("Nesting too deep"), "{}", err);
+}
+
+#[test]
+fn test_configured_limits_reports_every_limit() {
+    use aether::ConfiguredLimits;
+
+    let limits = Aether::with_safe_defaults().configured_limits();
+    assert_eq!(
+        limits,
+        ConfiguredLimits {
+            max_steps: Some(100_000),
+            max_recursion_depth: Some(100),
+            max_duration_ms: Some(5_000),
+            max_memory_bytes: None,
+            max_result_bytes: Some(1024 * 1024),
+            max_array_length: Some(100_000),
+            max_output_bytes: None,
+            max_functions: None,
+            max_nesting_depth: Some(256),
+            no_recursion: false,
+        }
+    );
+
+    // 之后单独调整的限制同样反映出来
+    let mut engine = Aether::with_safe_defaults();
+    engine.set_max_output_bytes(Some(4096));
+    engine.set_max_nesting_depth(Some(32));
+    engine.set_max_array_length(None);
+    let limits = engine.configured_limits();
+    assert_eq!(limits.max_output_bytes, Some(4096));
+    assert_eq!(limits.max_nesting_depth, Some(32));
+    assert_eq!(limits.max_array_length, None);
+    assert_eq!(limits.max_steps, Some(100_000));
+}
+
+#[test]
+fn test_progress_hook_reports_steps_and_can_cancel() {
+    use std::cell::RefCell;
+    use std::rc::Rc;
+
+    let mut engine = Aether::new().with_limits(ExecutionLimits::unrestricted());
+    let reports = Rc::new(RefCell::new(Vec::new()));
+    let sink = reports.clone();
+    engine.set_progress_hook(10, move |steps| sink.borrow_mut().push(steps));
+
+    engine
+        .eval("Set I 0\nWhile (I < 20) {\n    Set I (I + 1)\n}")
+        .unwrap();
+    let first = reports.borrow().clone();
+    assert!(!first.is_empty());
+    assert!(
+        first
+            .iter()
+            .enumerate()
+            .all(|(i, s)| *s == (i as u64 + 1) * 10)
+    );
+
+    // 每次顶层求值重新计数
+    reports.borrow_mut().clear();
+    engine.eval("1").unwrap();
+    assert!(reports.borrow().is_empty());
+
+    // 在回调中发出中断即可取消长时间运行的脚本
+    let handle = engine.interrupt_handle();
+    engine.set_progress_hook(100, move |steps| {
+        if steps >= 1000 {
+            handle.interrupt();
+        }
+    });
+    let err = engine.eval("While (True) {\n    Set X 1\n}").unwrap_err();
+    assert!(err.contains("Evaluation interrupted"), "{}", err);
+
+    engine.clear_progress_hook();
+    assert_eq!(engine.eval("(1 + 1)").unwrap().to_string(), "2");
+}
+
+#[test]
+fn test_no_recursion_rejects_direct_and_mutual_recursion() {
+    let mut engine = Aether::new().with_no_recursion();
+    assert!(engine.no_recursion());
+    assert!(engine.configured_limits().no_recursion);
+
+    engine
+        .eval(
+            r#"
+Func FIB(N) {
+    If (N < 2) {
+        Return N
+    }
+    Return (FIB(N - 1) + FIB(N - 2))
+}
+Func FIB_LOOP(N) {
+    Set A 0
+    Set B 1
+    Set I 0
+    While (I < N) {
+        Set NEXT (A + B)
+        Set A B
+        Set B NEXT
+        Set I (I + 1)
+    }
+    Return A
+}
+Func IS_EVEN(N) {
+    If (N == 0) {
+        Return True
+    }
+    Return IS_ODD(N - 1)
+}
+Func IS_ODD(N) {
+    If (N == 0) {
+        Return False
+    }
+    Return IS_EVEN(N - 1)
+}
+Func COUNTDOWN(N) {
+    If (N == 0) {
+        Return 0
+    }
+    Return COUNTDOWN(N - 1)
+}
+"#,
+        )
+        .unwrap();
+
+    let err = engine.eval("FIB(5)").unwrap_err();
+    assert!(err.contains("Recursion is not allowed: FIB"), "{}", err);
+    // 间接递归同样被拒绝
+    let err = engine.eval("IS_EVEN(4)").unwrap_err();
+    assert!(err.contains("Recursion is not allowed: IS_EVEN"), "{}", err);
+    // 尾递归不会被优化为循环而绕过检查
+    assert!(engine.eval("COUNTDOWN(3)").is_err());
+    let err = engine.eval("Set F Lambda(X) -> F(X)\nF(1)").unwrap_err();
+    assert!(err.contains("Recursion is not allowed"), "{}", err);
+
+    // 循环和非递归的调用（包括多次调用同一函数）不受影响
+    assert_eq!(engine.eval("FIB_LOOP(10)").unwrap().to_string(), "55");
+    assert_eq!(engine.eval("FIB(1) + FIB(0)").unwrap().to_string(), "1");
+    assert_eq!(
+        engine
+            .eval("MAP([1, 2], Lambda(X) -> LEN(MAP([X], Lambda(Y) -> Y)))")
+            .unwrap()
+            .to_string(),
+        "[1, 1]"
+    );
+
+    engine.set_no_recursion(false);
+    assert_eq!(engine.eval("FIB(10)").unwrap().to_string(), "55");
+}
+
+#[test]
+fn test_limit_warning_hook_fires_before_limit() {
+    use aether::LimitKind;
+    use std::cell::RefCell;
+    use std::rc::Rc;
+
+    let mut engine = Aether::new().with_limits(ExecutionLimits {
+        max_steps: Some(100),
+        max_recursion_depth: Some(10),
+        max_duration_ms: None,
+        max_memory_bytes: None,
+    });
+    engine.set_max_array_length(Some(50));
+
+    let warnings = Rc::new(RefCell::new(Vec::new()));
+    let sink = warnings.clone();
+    engine.set_limit_warning_hook(80, move |kind, used, limit| {
+        sink.borrow_mut().push((kind, used, limit));
+    });
+
+    // 80 步时预警一次，求值本身照常完成
+    let loop_code = "Set I 0\nWhile (I < 90) {\n    Set I (I + 1)\n}\nI";
+    assert_eq!(engine.eval(loop_code).unwrap().to_string(), "90");
+    assert_eq!(*warnings.borrow(), vec![(LimitKind::Steps, 80, 100)]);
+
+    // 每次顶层求值重新计数
+    warnings.borrow_mut().clear();
+    engine.eval(loop_code).unwrap();
+    assert_eq!(warnings.borrow().len(), 1);
+
+    warnings.borrow_mut().clear();
+    engine
+        .eval("Func DOWN(N) {\n    If (N <= 0) {\n        Return 0\n    }\n    Return (1 + DOWN(N - 1))\n}\nDOWN(8)")
+        .unwrap();
+    engine.eval("LEN(RANGE(0, 45))").unwrap();
+    assert_eq!(
+        *warnings.borrow(),
+        vec![
+            (LimitKind::RecursionDepth, 8, 10),
+            (LimitKind::ArrayLength, 45, 50)
+        ]
+    );
+
+    // 移除回调后不再触发
+    warnings.borrow_mut().clear();
+    engine.clear_limit_warning_hook();
+    engine.eval(loop_code).unwrap();
+    assert!(warnings.borrow().is_empty());
+}
+
+#[test]
+fn test_interrupt_during_compile() {
+    let mut engine = Aether::new();
+    let handle = engine.interrupt_handle();
+    let script = "Set X (1 + 2)\n".repeat(1_000_000);
+
+    let stopper = std::thread::spawn(move || {
+        std::thread::sleep(std::time::Duration::from_millis(20));
+        handle.interrupt();
+    });
+    let started = std::time::Instant::now();
+    let err = engine.compile(&script).unwrap_err();
+    stopper.join().unwrap();
+    assert!(err.contains("Parsing interrupted"), "{}", err);
+    assert!(started.elapsed() < std::time::Duration::from_secs(5));
+
+    // 之后编译照常进行，编译结果被 eval 复用
+    engine.compile("Set Y 41\n(Y + 1)").unwrap();
+    assert_eq!(engine.eval("Set Y 41\n(Y + 1)").unwrap().to_string(), "42");
+    assert_eq!(engine.cache_stats().hits, 1);
+
+    // eval_report 的解析阶段同样可以中断，编译结果同样来自缓存
+    let handle = engine.interrupt_handle();
+    let stopper = std::thread::spawn(move || {
+        std::thread::sleep(std::time::Duration::from_millis(20));
+        handle.interrupt();
+    });
+    let report = engine.eval_report(&script).unwrap_err();
+    stopper.join().unwrap();
+    assert_eq!(report.phase, "parse");
+    assert!(
+        report.message.contains("Parsing interrupted"),
+        "{:?}",
+        report
+    );
+    assert_eq!(
+        engine.eval_report("Set Y 41\n(Y + 1)").unwrap().to_string(),
+        "42"
+    );
+    assert_eq!(engine.cache_stats().hits, 2);
+}
+
+#[test]
+fn test_max_functions() {
+    let mut engine = Aether::new();
+    engine.set_max_functions(Some(2));
+    assert_eq!(engine.max_functions(), Some(2));
+    engine
+        .load_prelude("Func P() { Return 0 }\nFunc Q() { Return 0 }\nFunc R() { Return 0 }")
+        .unwrap();
+
+    // 恰好 n 个定义可以通过（预置函数不计入）
+    let two = "Func A() { Return 1 }\nGenerator G() { Yield 1 }\n(A() + P())";
+    assert_eq!(engine.eval(two).unwrap().to_string(), "1");
+
+    // 第 n+1 个定义报错，且不会生效；每次顶层求值重新计数
+    let err = engine
+        .eval("Func B() { Return 1 }\nFunc C() { Return 2 }\nFunc D() { Return 3 }")
+        .unwrap_err();
+    assert!(
+        err.contains("Function definition limit exceeded"),
+        "{}",
+        err
+    );
+    assert!(engine.eval("D()").is_err());
+
+    engine.set_max_functions(None);
+    assert!(
+        engine
+            .eval("Func B() { Return 1 }\nFunc C() { Return 2 }\nFunc D() { Return 3 }\nD()")
+            .is_ok()
+    );
+}
+
+#[test]
+fn test_max_nesting_depth() {
+    let mut engine = Aether::new();
+    let nested_ifs =
+        |depth: usize| format!("{}1{}", "If (True) {\n".repeat(depth), "\n}".repeat(depth));
+    // 先缓存较深的代码：设置限制会清空缓存，同样的代码会按新限制重新解析
+    assert_eq!(engine.eval(&nested_ifs(4)).unwrap().to_string(), "1");
+    engine.set_max_nesting_depth(Some(3));
+    assert_eq!(engine.max_nesting_depth(), Some(3));
+
+    // n 层通过，n+1 层得到解析错误
+    assert_eq!(engine.eval(&nested_ifs(3)).unwrap().to_string(), "1");
+    let err = engine.eval(&nested_ifs(4)).unwrap_err();
+    assert!(err.contains("Nesting too deep"), "{}", err);
+
+    engine.set_max_nesting_depth(None);
+    assert!(engine.eval(&nested_ifs(4)).is_ok());
+}
+
+#[test]
+fn test_max_nesting_depth_applies_to_modules() {
+    let mut engine = Aether::new();
+    let module = format!(
+        "Func F() {{\n{}Return 1{}\n}}",
+        "If (True) {\n".repeat(4),
+        "\n}".repeat(4)
+    );
+    // 在设置限制之前注册并加载：设置限制后模块按新限制重新解析
+    engine.add_module("DEEP", &module).unwrap();
+    assert_eq!(engine.eval("DEEP.F()").unwrap().to_string(), "1");
+    engine.set_max_nesting_depth(Some(3));
+
+    let err = engine.eval("Import {F} From \"DEEP\"\nF()").unwrap_err();
+    assert!(err.contains("Nesting too deep"), "{}", err);
+    assert!(engine.eval("DEEP.F()").is_err());
+}
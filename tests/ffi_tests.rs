@@ -1,6 +1,40 @@
-use std::ffi::{CStr, CString, c_char, c_int};
+use std::ffi::{CStr, CString, c_char, c_int, c_void};
 
-use aether::ffi::{AetherErrorCode, aether_eval, aether_free, aether_free_string, aether_new};
+use aether::ffi::{
+    AetherErrorCode, AetherEvalStats, AetherFunction, AetherPermissions, aether_add_module,
+    aether_attach_registry, aether_call, aether_check_incomplete, aether_clear_clock,
+    aether_compile, aether_diagnostics, aether_disassemble, aether_estimate_cost, aether_eval,
+    aether_eval_bigint, aether_eval_bool, aether_eval_bytes, aether_eval_csv, aether_eval_diff,
+    aether_eval_float, aether_eval_for_each, aether_eval_function, aether_eval_int,
+    aether_eval_into, aether_eval_json_to, aether_eval_many, aether_eval_phases,
+    aether_eval_report, aether_eval_tail, aether_eval_timed, aether_eval_verbose, aether_eval_with,
+    aether_eval_with_context, aether_eval_with_kind, aether_eval_with_seed, aether_eval_with_span,
+    aether_eval_with_stats, aether_export_program, aether_free, aether_free_bytes,
+    aether_free_string, aether_free_variables, aether_function_call, aether_function_free,
+    aether_functions, aether_get_configured_limits, aether_get_global, aether_get_permissions,
+    aether_import_program, aether_infer_type, aether_interrupt, aether_interrupt_free,
+    aether_interrupt_handle, aether_is_incomplete, aether_last_eval_called_hosts,
+    aether_last_eval_had_side_effects, aether_load_prelude, aether_load_state, aether_memory_usage,
+    aether_new, aether_new_safe, aether_new_with_permissions, aether_operator_table,
+    aether_parse_ast, aether_parse_comments, aether_register_function,
+    aether_register_function_with_context, aether_registry_free, aether_registry_new,
+    aether_registry_register, aether_required_permissions, aether_reset_env, aether_save_state,
+    aether_set_builtin_groups, aether_set_call_hook, aether_set_clock, aether_set_const,
+    aether_set_defines, aether_set_deny_list, aether_set_div_by_zero, aether_set_file_system,
+    aether_set_float_array, aether_set_global, aether_set_globals, aether_set_initial_vars,
+    aether_set_int_array, aether_set_int_overflow, aether_set_limit_warning_hook,
+    aether_set_locale, aether_set_max_array_length, aether_set_max_functions,
+    aether_set_max_nesting_depth, aether_set_max_output_bytes, aether_set_max_result_size,
+    aether_set_name, aether_set_no_output, aether_set_no_recursion, aether_set_optimization_level,
+    aether_set_output, aether_set_print_separator, aether_set_print_terminator,
+    aether_set_progress_hook, aether_set_rational_division, aether_set_seed,
+    aether_set_shared_data, aether_set_sorted_map_keys, aether_set_string_coercion,
+    aether_set_var_batch, aether_set_warnings_as_errors, aether_shared_data_free,
+    aether_shared_data_new, aether_validate, aether_validate_predicate, aether_var_batch_clear,
+    aether_var_batch_free, aether_var_batch_new, aether_var_batch_set_bool,
+    aether_var_batch_set_json, aether_var_batch_set_number, aether_var_batch_set_string,
+    aether_version,
+};
 
 #[test]
 fn test_ffi_basic_eval() {
@@ -26,6 +60,35 @@ fn test_ffi_basic_eval() {
     aether_free(handle);
 }
 
+#[test]
+fn test_ffi_error_codes_follow_error_kind() {
+    let handle = aether_new();
+    let eval = |code: &[u8]| {
+        let code = CString::new(code).unwrap();
+        let mut result: *mut c_char = std::ptr::null_mut();
+        let mut error: *mut c_char = std::ptr::null_mut();
+        let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+        assert!(result.is_null());
+        let message = unsafe { CStr::from_ptr(error).to_string_lossy().into_owned() };
+        aether_free_string(error);
+        (status, message)
+    };
+
+    // The status comes from the kind of error, not from the message text
+    let (status, message) = eval(b"Set D {\"a\": 1}\nD[\"Parse error\"]");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(message.contains("Parse error"), "{}", message);
+    let (status, _) = eval(b"Set X (");
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+
+    // Invalid UTF-8 is an invalid argument and comes with a message
+    let (status, message) = eval(b"\xff");
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    assert!(message.contains("UTF-8"), "{}", message);
+
+    aether_free(handle);
+}
+
 #[test]
 fn test_ffi_error_handling() {
     let handle = aether_new();
@@ -46,3 +109,3089 @@ fn test_ffi_error_handling() {
 
     aether_free(handle);
 }
+
+#[test]
+fn test_ffi_eval_verbose_returns_output() {
+    let handle = aether_new();
+    let code = CString::new("PRINTLN(\"hi\")\nPRINTLN(1, 2)\n(40 + 2)").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut output: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_verbose(handle, code.as_ptr(), &mut result, &mut output, &mut error);
+
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(error.is_null());
+
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "42");
+        assert_eq!(CStr::from_ptr(output).to_str().unwrap(), r#"["hi","1 2"]"#);
+        aether_free_string(result);
+        aether_free_string(output);
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_verbose_returns_output_on_error() {
+    let handle = aether_new();
+    let code = CString::new("PRINTLN(\"before\")\nUNDEFINED_VAR").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut output: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_verbose(handle, code.as_ptr(), &mut result, &mut output, &mut error);
+
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(result.is_null());
+    assert!(!error.is_null());
+
+    unsafe {
+        assert_eq!(CStr::from_ptr(output).to_str().unwrap(), r#"["before"]"#);
+        aether_free_string(output);
+        aether_free_string(error);
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_diff() {
+    let handle = aether_new();
+    assert_eq!(eval_str(handle, "Set A 1\nSet B 2"), (0, "2".to_string()));
+    let code = CString::new("Set A 5\nSet C [1]\nA").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut changes: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_diff(handle, code.as_ptr(), &mut result, &mut changes, &mut error);
+
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "5");
+        let parsed: serde_json::Value =
+            serde_json::from_str(CStr::from_ptr(changes).to_str().unwrap()).unwrap();
+        assert_eq!(parsed.as_array().unwrap().len(), 2);
+        assert_eq!(parsed[0]["name"], "A");
+        assert_eq!(parsed[0]["kind"], "changed");
+        assert_eq!(parsed[0]["before"].as_f64(), Some(1.0));
+        assert_eq!(parsed[0]["after"].as_f64(), Some(5.0));
+        assert_eq!(parsed[1]["name"], "C");
+        assert_eq!(parsed[1]["kind"], "added");
+        assert!(parsed[1]["value"].is_array());
+        aether_free_string(result);
+        aether_free_string(changes);
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_tail() {
+    let handle = aether_new();
+    let code = CString::new("For I In RANGE(50) {\n    PRINTLN(I)\n}\n(40 + 2)").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut output: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_tail(
+        handle,
+        code.as_ptr(),
+        2,
+        &mut result,
+        &mut output,
+        &mut error,
+    );
+
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "42");
+        assert_eq!(CStr::from_ptr(output).to_str().unwrap(), r#"["48","49"]"#);
+        aether_free_string(result);
+        aether_free_string(output);
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_int_overflow() {
+    let handle = aether_new();
+    let code = CString::new("(POW(2, 32) * POW(2, 32))").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    aether_free_string(error);
+
+    assert_eq!(
+        aether_set_int_overflow(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    error = std::ptr::null_mut();
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "0");
+        aether_free_string(result);
+    }
+
+    assert_eq!(
+        aether_set_int_overflow(handle, 3),
+        AetherErrorCode::Success as c_int
+    );
+    let mut digits: *mut c_char = std::ptr::null_mut();
+    let status = aether_eval_bigint(handle, code.as_ptr(), &mut digits, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(
+            CStr::from_ptr(digits).to_str().unwrap(),
+            "18446744073709551616"
+        );
+        aether_free_string(digits);
+    }
+
+    assert_eq!(
+        aether_set_int_overflow(handle, 9),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert_eq!(
+        aether_set_int_overflow(std::ptr::null_mut(), 0),
+        AetherErrorCode::NullPointer as c_int
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_phases_reports_parse_and_eval_time() {
+    let handle = aether_new();
+    let code = CString::new("Set S 0\nFor I In RANGE(2000) {\n    Set S (S + I)\n}\nS").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let mut parse_ns: u64 = 0;
+    let mut eval_ns: u64 = 0;
+
+    let status = aether_eval_phases(
+        handle,
+        code.as_ptr(),
+        &mut result,
+        &mut parse_ns,
+        &mut eval_ns,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(parse_ns > 0);
+    assert!(eval_ns > 0);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "1999000");
+    }
+    aether_free_string(result);
+
+    let bad = CString::new("Set X (1 +").unwrap();
+    let status = aether_eval_phases(
+        handle,
+        bad.as_ptr(),
+        &mut result,
+        &mut parse_ns,
+        &mut eval_ns,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert_eq!(eval_ns, 0);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_timed_reports_elapsed() {
+    let handle = aether_new();
+    let code = CString::new("Set S 0\nFor I In RANGE(0, 2000) {\n    Set S (S + I)\n}\nS").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let mut elapsed_ns: u64 = 0;
+
+    let status = aether_eval_timed(
+        handle,
+        code.as_ptr(),
+        &mut result,
+        &mut elapsed_ns,
+        &mut error,
+    );
+
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(elapsed_ns > 0);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "1999000");
+    }
+    aether_free_string(result);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_nested_array_round_trip() {
+    let handle = aether_new();
+    let input = r#"[[[1,2],[3]],[["a"],[]],[[true,null]]]"#;
+    let name = CString::new("NESTED").unwrap();
+    let json = CString::new(input).unwrap();
+
+    let status = unsafe { aether_set_global(handle, name.as_ptr(), json.as_ptr()) };
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    // Inspect the structure from inside the script to make sure it decoded as-is
+    let code =
+        CString::new("[LEN(NESTED), DEEP_LEN(NESTED), DEPTH(NESTED), NESTED[1][0][0]]").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "[3, 6, 3, a]");
+    }
+    aether_free_string(result);
+
+    let mut out: *mut c_char = std::ptr::null_mut();
+    let status = unsafe { aether_get_global(handle, name.as_ptr(), &mut out) };
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let got: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(out) }.to_str().unwrap()).unwrap();
+    aether_free_string(out);
+
+    let expected: serde_json::Value = serde_json::from_str(input).unwrap();
+    assert_same_shape(&got, &expected);
+
+    aether_free(handle);
+}
+
+/// Numbers are f64 inside the engine, so compare them by value rather than by JSON form
+fn assert_same_shape(got: &serde_json::Value, expected: &serde_json::Value) {
+    match (got, expected) {
+        (serde_json::Value::Array(a), serde_json::Value::Array(b)) => {
+            assert_eq!(a.len(), b.len(), "{} vs {}", got, expected);
+            for (x, y) in a.iter().zip(b) {
+                assert_same_shape(x, y);
+            }
+        }
+        (serde_json::Value::Number(a), serde_json::Value::Number(b)) => {
+            assert_eq!(a.as_f64(), b.as_f64());
+        }
+        _ => assert_eq!(got, expected),
+    }
+}
+
+#[test]
+fn test_ffi_eval_into_scratch_buffer() {
+    let handle = aether_new();
+    let mut buf = [0 as c_char; 64];
+    let mut written: usize = 0;
+    let mut overflow: *mut c_char = std::ptr::null_mut();
+
+    // Code is passed by length; the trailing garbage must be ignored
+    let code = b"(40 + 2)XXXX";
+    let status = aether_eval_into(
+        handle,
+        code.as_ptr() as *const c_char,
+        8,
+        buf.as_mut_ptr(),
+        buf.len(),
+        &mut written,
+        &mut overflow,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(written, 2);
+    assert!(overflow.is_null());
+    unsafe {
+        assert_eq!(CStr::from_ptr(buf.as_ptr()).to_str().unwrap(), "42");
+    }
+
+    // Result larger than the buffer falls back to an allocated string
+    let code = b"REPEAT(\"ab\", 100)";
+    let status = aether_eval_into(
+        handle,
+        code.as_ptr() as *const c_char,
+        code.len(),
+        buf.as_mut_ptr(),
+        buf.len(),
+        &mut written,
+        &mut overflow,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(written, 200);
+    assert!(!overflow.is_null());
+    unsafe {
+        assert_eq!(CStr::from_ptr(overflow).to_bytes().len(), 200);
+    }
+    aether_free_string(overflow);
+
+    // Errors are delivered through the same buffer
+    let code = b"UNDEFINED_VAR";
+    let status = aether_eval_into(
+        handle,
+        code.as_ptr() as *const c_char,
+        code.len(),
+        buf.as_mut_ptr(),
+        buf.len(),
+        &mut written,
+        &mut overflow,
+    );
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(overflow.is_null());
+    unsafe {
+        assert!(
+            CStr::from_ptr(buf.as_ptr())
+                .to_str()
+                .unwrap()
+                .contains("UNDEFINED_VAR")
+        );
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_into_invalid_utf8_and_nul() {
+    let handle = aether_new();
+    let mut buf = [0 as c_char; 64];
+    let eval_into = |code: &[u8], buf: &mut [c_char]| {
+        // Stale values must not survive any return path
+        let mut written: usize = usize::MAX;
+        let mut overflow = 1 as *mut c_char;
+        let status = aether_eval_into(
+            handle,
+            code.as_ptr() as *const c_char,
+            code.len(),
+            buf.as_mut_ptr(),
+            buf.len(),
+            &mut written,
+            &mut overflow,
+        );
+        assert!(overflow.is_null());
+        let text = unsafe { CStr::from_ptr(buf.as_ptr()).to_str().unwrap().to_string() };
+        assert_eq!(written, text.len());
+        (status, text)
+    };
+
+    // Invalid UTF-8 is reported like the eval entry points report it
+    let (status, text) = eval_into(b"\xff", &mut buf);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    assert!(text.contains("UTF-8"), "{}", text);
+
+    // A result with a NUL byte cannot be a C string and is rejected
+    let (status, text) = eval_into(br#""a\u0000b""#, &mut buf);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(text.contains("NUL"), "{}", text);
+
+    // NUL bytes are dropped from error messages; the status is kept
+    let (status, text) = eval_into(b"Set D {\"a\": 1}\nD[\"x\\u0000y\"]", &mut buf);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(text.contains("xy"), "{}", text);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_disassemble() {
+    let handle = aether_new();
+    let code = CString::new("Set X (1 + 2)\nX").unwrap();
+    let mut dump: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_disassemble(handle, code.as_ptr(), &mut dump, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(dump) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    aether_free_string(dump);
+    assert!(text.contains("Set"));
+
+    // The code was not executed
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let x = CString::new("X").unwrap();
+    let status = aether_eval(handle, x.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    aether_free_string(error);
+
+    let bad = CString::new("Set X (").unwrap();
+    let status = aether_disassemble(handle, bad.as_ptr(), &mut dump, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(dump.is_null());
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_with_kind_distinguishes_void() {
+    let handle = aether_new();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let mut kind: c_int = -1;
+
+    let cases = [
+        ("Set S \"\"\nS", 0, ""),
+        ("Return \"\"\nPRINTLN(\"unreachable\")", 1, ""),
+        ("Set X 1", 0, "1"),
+        ("PRINT(\"\")", 2, ""),
+    ];
+    for (src, expected_kind, expected_text) in cases {
+        let code = CString::new(src).unwrap();
+        let status =
+            aether_eval_with_kind(handle, code.as_ptr(), &mut result, &mut kind, &mut error);
+        assert_eq!(status, AetherErrorCode::Success as c_int, "{}", src);
+        assert_eq!(kind, expected_kind, "{}", src);
+        unsafe {
+            assert_eq!(CStr::from_ptr(result).to_str().unwrap(), expected_text);
+        }
+        aether_free_string(result);
+    }
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_with_stats() {
+    let handle = aether_new();
+    let code = CString::new("Func F(N) {\n    Return [N]\n}\nSet A RANGE(0, 4)\nF(1)").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let mut stats = AetherEvalStats {
+        steps: -1,
+        peak_call_depth: -1,
+        peak_array_length: -1,
+    };
+
+    let status = aether_eval_with_stats(handle, code.as_ptr(), &mut result, &mut stats, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(stats.steps > 0);
+    assert_eq!(stats.peak_call_depth, 1);
+    assert_eq!(stats.peak_array_length, 4);
+    aether_free_string(result);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_version_is_static() {
+    let first = aether_version();
+    assert_eq!(first, aether_version());
+    unsafe {
+        assert_eq!(
+            CStr::from_ptr(first).to_str().unwrap(),
+            env!("CARGO_PKG_VERSION")
+        );
+    }
+}
+
+#[test]
+fn test_ffi_set_string_coercion() {
+    let handle = aether_new();
+    let code = CString::new("(\"n=\" + 1)").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    aether_free_string(error);
+
+    assert_eq!(
+        aether_set_string_coercion(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    error = std::ptr::null_mut();
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "n=1");
+        aether_free_string(result);
+    }
+
+    assert_eq!(
+        aether_set_string_coercion(handle, 2),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert_eq!(
+        aether_set_string_coercion(std::ptr::null_mut(), 0),
+        AetherErrorCode::NullPointer as c_int
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_with_span_reports_result_position() {
+    let handle = aether_new();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let mut line: c_int = -1;
+    let mut column: c_int = -1;
+
+    let cases = [
+        ("Set X 1\n  (X + 1)", 2, 3, "2"),
+        ("PRINT(\"\")", 0, 0, "null"),
+    ];
+    for (src, expected_line, expected_column, expected_text) in cases {
+        let code = CString::new(src).unwrap();
+        let status = aether_eval_with_span(
+            handle,
+            code.as_ptr(),
+            &mut result,
+            &mut line,
+            &mut column,
+            &mut error,
+        );
+        assert_eq!(status, AetherErrorCode::Success as c_int, "{}", src);
+        assert_eq!((line, column), (expected_line, expected_column), "{}", src);
+        unsafe {
+            assert_eq!(CStr::from_ptr(result).to_str().unwrap(), expected_text);
+        }
+        aether_free_string(result);
+    }
+
+    aether_free(handle);
+}
+
+unsafe extern "C" {
+    fn malloc(size: usize) -> *mut c_void;
+}
+
+/// Allocate a C string with `malloc`, as required for host callback results
+fn malloc_string(s: &str) -> *mut c_char {
+    unsafe {
+        let ptr = malloc(s.len() + 1) as *mut u8;
+        std::ptr::copy_nonoverlapping(s.as_ptr(), ptr, s.len());
+        *ptr.add(s.len()) = 0;
+        ptr as *mut c_char
+    }
+}
+
+/// Sums a JSON array of numbers, offset by the integer behind `user_data`
+unsafe extern "C" fn sum_callback(
+    user_data: *mut c_void,
+    args_json: *const c_char,
+    is_error: *mut c_int,
+) -> *mut c_char {
+    let offset = unsafe { *(user_data as *const f64) };
+    let args: Vec<serde_json::Value> =
+        serde_json::from_str(unsafe { CStr::from_ptr(args_json) }.to_str().unwrap()).unwrap();
+    let mut total = offset;
+    for arg in args {
+        match arg.as_f64() {
+            Some(n) => total += n,
+            None => {
+                unsafe { *is_error = 1 };
+                return malloc_string("SUM2 expects numbers");
+            }
+        }
+    }
+    malloc_string(&total.to_string())
+}
+
+fn eval_str(handle: *mut aether::ffi::AetherHandle, src: &str) -> (c_int, String) {
+    let code = CString::new(src).unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_eval(handle, code.as_ptr(), &mut result, &mut error);
+    let out = if status == AetherErrorCode::Success as c_int {
+        result
+    } else {
+        error
+    };
+    let text = unsafe { CStr::from_ptr(out) }.to_str().unwrap().to_string();
+    aether_free_string(out);
+    (status, text)
+}
+
+#[test]
+fn test_ffi_register_function() {
+    let handle = aether_new();
+    let mut offset: f64 = 0.0;
+    let name = CString::new("SUM2").unwrap();
+
+    let status = aether_register_function(
+        handle,
+        name.as_ptr(),
+        2,
+        Some(sum_callback),
+        &mut offset as *mut f64 as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    assert_eq!(eval_str(handle, "SUM2(1, 2)"), (0, "3".to_string()));
+    let (status, msg) = eval_str(handle, "SUM2(1, \"x\")");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("SUM2 expects numbers"), "{}", msg);
+
+    assert_eq!(
+        aether_register_function(handle, name.as_ptr(), 2, None, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_last_eval_called_hosts() {
+    let handle = aether_new();
+    let mut offset: f64 = 0.0;
+    let name = CString::new("SUM2").unwrap();
+    aether_register_function(
+        handle,
+        name.as_ptr(),
+        2,
+        Some(sum_callback),
+        &mut offset as *mut f64 as *mut c_void,
+    );
+
+    let mut names: *mut c_char = std::ptr::null_mut();
+    eval_str(handle, "SUM2(1, 2) + LEN([1])");
+    let status = aether_last_eval_called_hosts(handle, &mut names);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(
+        unsafe { CStr::from_ptr(names) }.to_str().unwrap(),
+        r#"["SUM2"]"#
+    );
+    aether_free_string(names);
+
+    eval_str(handle, "1");
+    aether_last_eval_called_hosts(handle, &mut names);
+    assert_eq!(unsafe { CStr::from_ptr(names) }.to_str().unwrap(), "[]");
+    aether_free_string(names);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_shared_registry() {
+    let registry = aether_registry_new();
+    let mut offset: f64 = 100.0;
+    let name = CString::new("SUM2").unwrap();
+    let status = aether_registry_register(
+        registry,
+        name.as_ptr(),
+        2,
+        Some(sum_callback),
+        &mut offset as *mut f64 as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let a = aether_new();
+    let b = aether_new();
+    assert_eq!(
+        aether_attach_registry(a, registry),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(
+        aether_attach_registry(b, registry),
+        AetherErrorCode::Success as c_int
+    );
+
+    // Engines keep the registry alive after the handle is freed
+    aether_registry_free(registry);
+
+    assert_eq!(eval_str(a, "SUM2(1, 2)"), (0, "103".to_string()));
+    assert_eq!(eval_str(b, "SUM2(3, 4)"), (0, "107".to_string()));
+
+    aether_free(a);
+    aether_free(b);
+}
+
+#[test]
+fn test_ffi_get_permissions() {
+    let mut perms = AetherPermissions {
+        filesystem_enabled: -1,
+        network_enabled: -1,
+    };
+
+    let sandboxed = aether_new();
+    assert_eq!(
+        aether_get_permissions(sandboxed, &mut perms),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!((perms.filesystem_enabled, perms.network_enabled), (0, 0));
+    aether_free(sandboxed);
+
+    let open = aether_new_with_permissions();
+    aether_get_permissions(open, &mut perms);
+    assert_eq!((perms.filesystem_enabled, perms.network_enabled), (1, 1));
+    aether_free(open);
+}
+
+#[test]
+fn test_ffi_new_safe() {
+    let handle = aether_new_safe();
+    assert!(!handle.is_null());
+
+    let mut perms = AetherPermissions {
+        filesystem_enabled: -1,
+        network_enabled: -1,
+    };
+    aether_get_permissions(handle, &mut perms);
+    assert_eq!((perms.filesystem_enabled, perms.network_enabled), (0, 0));
+
+    assert_eq!(eval_str(handle, "(1 + 2)"), (0, "3".to_string()));
+    let (status, msg) = eval_str(handle, "Set I 0\nWhile (True) {\n    Set I (I + 1)\n}");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("limit"), "{}", msg);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_numeric_arrays() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let name = CString::new("XS").unwrap();
+
+    let mut floats = [1.5, -2.0, 0.25];
+    let status = aether_set_float_array(
+        handle,
+        name.as_ptr(),
+        floats.as_ptr(),
+        floats.len(),
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    // The data is copied, so later host changes are not visible
+    floats[0] = 100.0;
+    assert_eq!(eval_str(handle, "XS"), (0, "[1.5, -2, 0.25]".to_string()));
+
+    let ints: [i64; 2] = [7, -3];
+    let status = aether_set_int_array(handle, name.as_ptr(), ints.as_ptr(), 2, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(eval_str(handle, "XS[0] + XS[1]"), (0, "4".to_string()));
+
+    // An empty array may be passed as NULL
+    let status = aether_set_int_array(handle, name.as_ptr(), std::ptr::null(), 0, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(eval_str(handle, "LEN(XS)"), (0, "0".to_string()));
+
+    let bad = CString::new("not valid").unwrap();
+    let status = aether_set_float_array(handle, bad.as_ptr(), floats.as_ptr(), 1, &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_globals() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let vars = CString::new(r#"{"A": 1, "B": [true, null], "C": {"k": "v"}}"#).unwrap();
+    let status = aether_set_globals(handle, vars.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(error.is_null());
+    assert_eq!(
+        eval_str(handle, "[A, B, C[\"k\"]]"),
+        (0, "[1, [true, null], v]".to_string())
+    );
+
+    let vars = CString::new(r#"{"D": 4, "not valid": 5}"#).unwrap();
+    let status = aether_set_globals(handle, vars.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    let msg = unsafe { CStr::from_ptr(error) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    aether_free_string(error);
+    assert!(msg.contains("not valid"), "{}", msg);
+    assert_eq!(
+        eval_str(handle, "D").0,
+        AetherErrorCode::RuntimeError as c_int
+    );
+
+    let vars = CString::new("[1, 2]").unwrap();
+    let status = aether_set_globals(handle, vars.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_defines() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let defines = CString::new(r#"{"FEATURE_X": true}"#).unwrap();
+    let status = aether_set_defines(handle, defines.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(
+        eval_str(handle, "If (FEATURE_X) { 1 } Else { 2 }"),
+        (0, "1".to_string())
+    );
+    let (status, msg) = eval_str(handle, "Set FEATURE_X False");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Cannot reassign constant"), "{}", msg);
+
+    let defines = CString::new(r#"{"FEATURE_Y": 1}"#).unwrap();
+    let status = aether_set_defines(handle, defines.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+
+    let defines = CString::new(r#"{"not valid": true}"#).unwrap();
+    let status = aether_set_defines(handle, defines.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_initial_vars() {
+    let a = aether_new();
+    let b = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let vars = CString::new(r#"{"LIST": [1, 2], "NAME": "base"}"#).unwrap();
+    for handle in [a, b] {
+        let status = aether_set_initial_vars(handle, vars.as_ptr(), &mut error);
+        assert_eq!(status, AetherErrorCode::Success as c_int);
+        assert!(error.is_null());
+    }
+
+    // Each engine owns its copy, and a reset restores the seeded values
+    assert_eq!(
+        eval_str(a, "Set LIST[0] 9\nLIST"),
+        (0, "[9, 2]".to_string())
+    );
+    assert_eq!(eval_str(b, "LIST"), (0, "[1, 2]".to_string()));
+    aether_reset_env(a);
+    assert_eq!(
+        eval_str(a, "[LIST, NAME]"),
+        (0, "[[1, 2], base]".to_string())
+    );
+
+    let vars = CString::new(r#"{"not valid": 1}"#).unwrap();
+    let status = aether_set_initial_vars(a, vars.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    aether_free_string(error);
+
+    let vars = CString::new("[1]").unwrap();
+    let status = aether_set_initial_vars(a, vars.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+
+    assert_eq!(
+        aether_set_initial_vars(std::ptr::null_mut(), vars.as_ptr(), &mut error),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(a);
+    aether_free(b);
+}
+
+#[test]
+fn test_ffi_boolean_and_null_results() {
+    let handle = aether_new();
+
+    assert_eq!(eval_str(handle, "(1 > 0)"), (0, "true".to_string()));
+    assert_eq!(eval_str(handle, "(1 < 0)"), (0, "false".to_string()));
+    assert_eq!(
+        eval_str(handle, "((1 < 2) && (2 < 3) && !(3 == 4))"),
+        (0, "true".to_string())
+    );
+    assert_eq!(
+        eval_str(handle, "((1 < 2) && (3 < 2))"),
+        (0, "false".to_string())
+    );
+    assert_eq!(eval_str(handle, "Null"), (0, "null".to_string()));
+    assert_eq!(eval_str(handle, "\"null\""), (0, "null".to_string()));
+
+    // Structured decode keeps booleans as JSON booleans and null as JSON null
+    eval_str(handle, "Set FLAGS [(1 > 0), (1 < 0), Null, \"null\"]");
+    let name = CString::new("FLAGS").unwrap();
+    let mut out: *mut c_char = std::ptr::null_mut();
+    let status = unsafe { aether_get_global(handle, name.as_ptr(), &mut out) };
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(
+        unsafe { CStr::from_ptr(out) }.to_str().unwrap(),
+        r#"[true,false,null,"null"]"#
+    );
+    aether_free_string(out);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_max_result_size() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_max_result_size(handle, 8),
+        AetherErrorCode::Success as c_int
+    );
+
+    assert_eq!(
+        eval_str(handle, "\"12345678\""),
+        (0, "12345678".to_string())
+    );
+    let (status, msg) = eval_str(handle, "REPEAT(\"x\", 1000000)");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Result size limit exceeded"), "{}", msg);
+
+    aether_set_max_result_size(handle, -1);
+    assert_eq!(
+        eval_str(handle, "STRLEN(REPEAT(\"x\", 9))"),
+        (0, "9".to_string())
+    );
+    assert_eq!(
+        eval_str(handle, "REPEAT(\"x\", 9)"),
+        (0, "xxxxxxxxx".to_string())
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_named_engine() {
+    let handle = aether_new();
+    let name = CString::new("pool-3").unwrap();
+    assert_eq!(
+        aether_set_name(handle, name.as_ptr()),
+        AetherErrorCode::Success as c_int
+    );
+
+    let (status, msg) = eval_str(handle, "UNDEFINED_VAR");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.starts_with("[pool-3] Runtime error"), "{}", msg);
+
+    aether_set_name(handle, std::ptr::null());
+    let (_, msg) = eval_str(handle, "UNDEFINED_VAR");
+    assert!(msg.starts_with("Runtime error"), "{}", msg);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_bytes_preserves_nul() {
+    let handle = aether_new();
+    let code = r#""a\u0000b""#;
+    let mut out: *mut u8 = std::ptr::null_mut();
+    let mut out_len: usize = 0;
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_bytes(
+        handle,
+        code.as_ptr() as *const c_char,
+        code.len(),
+        &mut out,
+        &mut out_len,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let bytes = unsafe { std::slice::from_raw_parts(out, out_len) };
+    assert_eq!(bytes, b"a\0b");
+    aether_free_bytes(out, out_len);
+
+    let code = "UNDEFINED_VAR";
+    let status = aether_eval_bytes(
+        handle,
+        code.as_ptr() as *const c_char,
+        code.len(),
+        &mut out,
+        &mut out_len,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(out.is_null());
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+/// Accepts at most `*user_data` bytes of output, then rejects further chunks
+unsafe extern "C" fn limited_output(
+    user_data: *mut c_void,
+    _data: *const c_char,
+    len: usize,
+) -> c_int {
+    let remaining = unsafe { &mut *(user_data as *mut usize) };
+    if len > *remaining {
+        return 1;
+    }
+    *remaining -= len;
+    0
+}
+
+#[test]
+fn test_ffi_set_output_backpressure() {
+    let handle = aether_new();
+    let mut remaining: usize = 32;
+    let status = aether_set_output(
+        handle,
+        Some(limited_output),
+        &mut remaining as *mut usize as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let (status, err) = eval_str(handle, "While (True) { PRINTLN(\"spam\") }");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(err.contains("Output error"), "unexpected error: {}", err);
+    assert!(remaining < 5);
+
+    // Restoring stdout lets evaluation continue normally
+    assert_eq!(
+        aether_set_output(handle, None, std::ptr::null_mut()),
+        AetherErrorCode::Success as c_int
+    );
+    let (status, result) = eval_str(handle, "(1 + 1)");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(result, "2");
+
+    aether_free(handle);
+}
+
+/// Returns the i64 stored behind `context` as JSON, or null without a context
+unsafe extern "C" fn context_callback(
+    _user_data: *mut c_void,
+    context: *mut c_void,
+    _args_json: *const c_char,
+    _is_error: *mut c_int,
+) -> *mut c_char {
+    if context.is_null() {
+        return std::ptr::null_mut();
+    }
+    let id = unsafe { *(context as *const i64) };
+    malloc_string(&id.to_string())
+}
+
+#[test]
+fn test_ffi_eval_with_context() {
+    let handle = aether_new();
+    let name = CString::new("REQUEST_ID").unwrap();
+    let status = aether_register_function_with_context(
+        handle,
+        name.as_ptr(),
+        0,
+        Some(context_callback),
+        std::ptr::null_mut(),
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let code = CString::new("REQUEST_ID()").unwrap();
+    let mut request_id: i64 = 7;
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_eval_with_context(
+        handle,
+        code.as_ptr(),
+        &mut request_id as *mut i64 as *mut c_void,
+        &mut result,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(unsafe { CStr::from_ptr(result) }.to_str().unwrap(), "7");
+    aether_free_string(result);
+
+    // Without a context the callback sees NULL
+    let (status, result) = eval_str(handle, "REQUEST_ID()");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(result, "null");
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_with_seed() {
+    let handle = aether_new();
+    aether_set_seed(handle, 9);
+    let reference = aether_new();
+    aether_set_seed(reference, 9);
+
+    let code = CString::new("RANDOM_INT(1, 1000000) + ROW * 0").unwrap();
+    let vars = CString::new(r#"{"ROW": 3}"#).unwrap();
+    let run = |seed: u64| {
+        let mut result: *mut c_char = std::ptr::null_mut();
+        let mut error: *mut c_char = std::ptr::null_mut();
+        let status = aether_eval_with_seed(
+            handle,
+            code.as_ptr(),
+            seed,
+            vars.as_ptr(),
+            &mut result,
+            &mut error,
+        );
+        assert_eq!(status, AetherErrorCode::Success as c_int);
+        let text = unsafe { CStr::from_ptr(result) }
+            .to_str()
+            .unwrap()
+            .to_string();
+        aether_free_string(result);
+        text
+    };
+    let first = run(77);
+    assert_eq!(run(77), first);
+
+    // The engine's own sequence is untouched by per-call seeds
+    assert_eq!(
+        eval_str(handle, "RANDOM()"),
+        eval_str(reference, "RANDOM()")
+    );
+
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_eval_with_seed(
+        std::ptr::null_mut(),
+        code.as_ptr(),
+        1,
+        vars.as_ptr(),
+        &mut result,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::NullPointer as c_int);
+
+    aether_free(handle);
+    aether_free(reference);
+}
+
+#[test]
+fn test_ffi_set_seed() {
+    let a = aether_new();
+    let b = aether_new();
+    assert_eq!(aether_set_seed(a, 123), AetherErrorCode::Success as c_int);
+    assert_eq!(aether_set_seed(b, 123), AetherErrorCode::Success as c_int);
+
+    let code = "[RANDOM(), RANDOM_INT(0, 1000000)]";
+    let (status_a, result_a) = eval_str(a, code);
+    let (status_b, result_b) = eval_str(b, code);
+    assert_eq!(status_a, AetherErrorCode::Success as c_int);
+    assert_eq!(status_b, AetherErrorCode::Success as c_int);
+    assert_eq!(result_a, result_b);
+
+    assert_eq!(
+        aether_set_seed(std::ptr::null_mut(), 1),
+        AetherErrorCode::NullPointer as c_int
+    );
+
+    aether_free(a);
+    aether_free(b);
+}
+
+#[test]
+fn test_ffi_set_clock() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_clock(handle, 1_700_000_000.5),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(
+        eval_str(handle, "[NOW(), NOW()]"),
+        (0, "[1700000000.5, 1700000000.5]".to_string())
+    );
+
+    assert_eq!(
+        aether_set_clock(handle, f64::NAN),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert_eq!(
+        aether_clear_clock(handle),
+        AetherErrorCode::Success as c_int
+    );
+    let (status, now) = eval_str(handle, "NOW()");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(now.parse::<f64>().unwrap() > 1_700_000_000.5);
+
+    assert_eq!(
+        aether_set_clock(std::ptr::null_mut(), 0.0),
+        AetherErrorCode::NullPointer as c_int
+    );
+    assert_eq!(
+        aether_clear_clock(std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_parse_ast() {
+    let handle = aether_new();
+    let code = CString::new("Set X 1\nWhile (X < 3) {\n    Set X (X + 1)\n}").unwrap();
+    let mut ast: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_parse_ast(handle, code.as_ptr(), &mut ast, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(ast) }.to_str().unwrap().to_string();
+    aether_free_string(ast);
+
+    let json: serde_json::Value = serde_json::from_str(&text).unwrap();
+    assert_eq!(json[1]["kind"], "While");
+    assert_eq!(json[1]["line"], 2);
+    assert_eq!(json[1]["body"][0]["kind"], "Set");
+    assert_eq!(json[1]["body"][0]["line"], 3);
+
+    let bad = CString::new("While (").unwrap();
+    let status = aether_parse_ast(handle, bad.as_ptr(), &mut ast, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(ast.is_null());
+    aether_free_string(error);
+
+    // Invalid UTF-8 is reported like the eval entry points report it
+    let bad = CString::new(b"\xff".to_vec()).unwrap();
+    let status = aether_parse_ast(handle, bad.as_ptr(), &mut ast, &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    assert!(ast.is_null());
+    let message = unsafe { CStr::from_ptr(error).to_string_lossy().into_owned() };
+    assert!(message.contains("UTF-8"), "{}", message);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_parse_comments() {
+    let handle = aether_new();
+    let code = CString::new("// 总额\nSet X 1 /* 元 */").unwrap();
+    let mut comments: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_parse_comments(handle, code.as_ptr(), &mut comments, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(comments) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    aether_free_string(comments);
+
+    let json: serde_json::Value = serde_json::from_str(&text).unwrap();
+    assert_eq!(json[0]["text"], "// 总额");
+    assert_eq!(json[0]["line"], 1);
+    assert_eq!(json[1]["text"], "/* 元 */");
+    assert_eq!(
+        (json[1]["line"].clone(), json[1]["column"].clone()),
+        (2.into(), 9.into())
+    );
+
+    let bad = CString::new("Set X (").unwrap();
+    let status = aether_parse_comments(handle, bad.as_ptr(), &mut comments, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(comments.is_null());
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_max_array_length() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_max_array_length(handle, 3),
+        AetherErrorCode::Success as c_int
+    );
+
+    assert_eq!(eval_str(handle, "[1, 2, 3]"), (0, "[1, 2, 3]".to_string()));
+    let (status, msg) = eval_str(handle, "PUSH([1, 2, 3], 4)");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Array length limit exceeded"), "{}", msg);
+
+    aether_set_max_array_length(handle, -1);
+    assert_eq!(
+        eval_str(handle, "LEN(PUSH([1, 2, 3], 4))"),
+        (0, "4".to_string())
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_max_output_bytes() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_max_output_bytes(handle, 8),
+        AetherErrorCode::Success as c_int
+    );
+
+    let (status, msg) = eval_str(handle, "While (True) {\n    PRINT(\"abc\")\n}");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Output limit exceeded"), "{}", msg);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_max_functions() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_max_functions(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+
+    assert_eq!(
+        eval_str(handle, "Func A() { Return 1 }\nA()"),
+        (0, "1".to_string())
+    );
+    let (status, msg) = eval_str(handle, "Func A() { Return 1 }\nFunc B() { Return 2 }");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(
+        msg.contains("Function definition limit exceeded"),
+        "{}",
+        msg
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_max_nesting_depth() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_max_nesting_depth(handle, 2),
+        AetherErrorCode::Success as c_int
+    );
+
+    assert_eq!(eval_str(handle, "[[1]][0][0]"), (0, "1".to_string()));
+    let (status, msg) = eval_str(handle, "[[[1]]]");
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(msg.contains("Nesting too deep"), "{}", msg);
+
+    aether_free(handle);
+}
+
+fn call_str(handle: *mut aether::ffi::AetherHandle, name: &str, args: &str) -> (c_int, String) {
+    let name = CString::new(name).unwrap();
+    let args = CString::new(args).unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_call(
+        handle,
+        name.as_ptr(),
+        args.as_ptr(),
+        &mut result,
+        &mut error,
+    );
+    let out = if status == AetherErrorCode::Success as c_int {
+        result
+    } else {
+        error
+    };
+    let text = unsafe { CStr::from_ptr(out) }.to_str().unwrap().to_string();
+    aether_free_string(out);
+    (status, text)
+}
+
+#[test]
+fn test_ffi_call_function_by_name() {
+    let handle = aether_new();
+    let (status, _) = eval_str(
+        handle,
+        "Func PAIR(A, B) {\n    Return {\"sum\": (A + B), \"items\": [A, B]}\n}",
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let (status, result) = call_str(handle, "PAIR", "[5, 6]");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value = serde_json::from_str(&result).unwrap();
+    assert_eq!(json["sum"], 11.0);
+    assert_eq!(json["items"], serde_json::json!([5.0, 6.0]));
+
+    let (status, _) = call_str(handle, "PAIR", "{\"a\": 1}");
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+
+    let (status, msg) = call_str(handle, "NOPE", "[]");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Undefined variable"), "{}", msg);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_validate_warnings() {
+    let handle = aether_new();
+    let code = CString::new("Set USED 1\nSet UNUSED 2\nUSED").unwrap();
+    let mut warnings: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_validate(handle, code.as_ptr(), &mut warnings, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(warnings) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    aether_free_string(warnings);
+
+    let json: serde_json::Value = serde_json::from_str(&text).unwrap();
+    assert_eq!(json.as_array().unwrap().len(), 1);
+    assert_eq!(json[0]["severity"], "warning");
+    assert_eq!(json[0]["line"], 2);
+    assert!(json[0]["message"].as_str().unwrap().contains("UNUSED"));
+
+    let bad = CString::new("Set (").unwrap();
+    let status = aether_validate(handle, bad.as_ptr(), &mut warnings, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    // Invalid UTF-8 is reported like the eval entry points report it
+    let bad = CString::new(b"\xff".to_vec()).unwrap();
+    let status = aether_validate(handle, bad.as_ptr(), &mut warnings, &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    assert!(warnings.is_null());
+    let message = unsafe { CStr::from_ptr(error).to_string_lossy().into_owned() };
+    assert!(message.contains("UTF-8"), "{}", message);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_warnings_as_errors() {
+    let handle = aether_new();
+    let code = "Set USED 1\nSet UNUSED 2\nUSED";
+    assert_eq!(eval_str(handle, code), (0, "1".to_string()));
+
+    assert_eq!(
+        aether_set_warnings_as_errors(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    let (status, msg) = eval_str(handle, code);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(
+        msg.contains("Variable 'UNUSED' is set but never read"),
+        "{}",
+        msg
+    );
+
+    let mut warnings: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let code = CString::new(code).unwrap();
+    let status = aether_validate(handle, code.as_ptr(), &mut warnings, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_load_prelude() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let prelude = CString::new("Func INC(X) {\n    Return (X + 1)\n}").unwrap();
+    assert_eq!(
+        aether_load_prelude(handle, prelude.as_ptr(), &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    aether_reset_env(handle);
+    assert_eq!(eval_str(handle, "INC(41)"), (0, "42".to_string()));
+
+    let bad = CString::new("Set X 1").unwrap();
+    assert_eq!(
+        aether_load_prelude(handle, bad.as_ptr(), &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    let msg = unsafe { CStr::from_ptr(error) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    aether_free_string(error);
+    assert!(msg.contains("Prelude error"), "{}", msg);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_const() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let name = CString::new("RATE").unwrap();
+    let value = CString::new("0.5").unwrap();
+    assert_eq!(
+        aether_set_const(handle, name.as_ptr(), value.as_ptr(), &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(eval_str(handle, "(RATE * 4)"), (0, "2".to_string()));
+
+    let (status, msg) = eval_str(handle, "Set RATE 1");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Cannot reassign constant 'RATE'"), "{}", msg);
+
+    let bad_name = CString::new("1X").unwrap();
+    assert_eq!(
+        aether_set_const(handle, bad_name.as_ptr(), value.as_ptr(), &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    aether_free_string(error);
+
+    let bad_json = CString::new("{").unwrap();
+    assert_eq!(
+        aether_set_const(handle, name.as_ptr(), bad_json.as_ptr(), &mut error),
+        AetherErrorCode::InvalidJSON as c_int
+    );
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_interrupt() {
+    let handle = aether_new();
+    let interrupt = aether_interrupt_handle(handle);
+    assert!(!interrupt.is_null());
+
+    // Only a timeout as a backstop, so the loop can only end by interruption
+    let limits = aether::ffi::AetherLimits {
+        max_steps: -1,
+        max_recursion_depth: -1,
+        max_duration_ms: 10_000,
+    };
+    unsafe { aether::ffi::aether_set_limits(handle, &limits) };
+
+    // Raw pointers are not Send; the handle itself is safe to use from any thread
+    let interrupt_addr = interrupt as usize;
+    let stopper = std::thread::spawn(move || {
+        std::thread::sleep(std::time::Duration::from_millis(50));
+        aether_interrupt(interrupt_addr as *mut aether::ffi::AetherInterrupt)
+    });
+
+    let (status, msg) = eval_str(handle, "While (True) {\n    Set X 1\n}");
+    assert_eq!(stopper.join().unwrap(), AetherErrorCode::Success as c_int);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Evaluation interrupted"), "{}", msg);
+
+    // The engine stays usable
+    assert_eq!(eval_str(handle, "(1 + 1)"), (0, "2".to_string()));
+
+    assert_eq!(
+        aether_interrupt(std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_interrupt_free(interrupt);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_infer_type() {
+    let handle = aether_new();
+    let mut kind: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("(\"a\" + \"b\")").unwrap();
+    let status = aether_infer_type(handle, code.as_ptr(), &mut kind, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    unsafe {
+        assert_eq!(CStr::from_ptr(kind).to_str().unwrap(), "String");
+    }
+    aether_free_string(kind);
+
+    let bad = CString::new("(1 +").unwrap();
+    let status = aether_infer_type(handle, bad.as_ptr(), &mut kind, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(kind.is_null());
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_validate_predicate() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let ok = CString::new("(AGE >= 18) && (LEN(NAME) > 0)").unwrap();
+    let status = aether_validate_predicate(handle, ok.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(error.is_null());
+
+    let impure = CString::new("(PRINT(AGE) == Null)").unwrap();
+    let status = aether_validate_predicate(handle, impure.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    unsafe {
+        assert!(
+            CStr::from_ptr(error)
+                .to_str()
+                .unwrap()
+                .contains("'PRINT' is not a function without side effects")
+        );
+    }
+    aether_free_string(error);
+
+    let bad = CString::new("(1 +").unwrap();
+    let status = aether_validate_predicate(handle, bad.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_estimate_cost() {
+    let handle = aether_new();
+    let mut cost: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code =
+        CString::new("For I In RANGE(2) {\n    For J In RANGE(2) {\n        PRINT(J)\n    }\n}")
+            .unwrap();
+    let status = aether_estimate_cost(handle, code.as_ptr(), &mut cost, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(cost) }.to_str().unwrap()).unwrap();
+    assert_eq!(json["loops"], 2);
+    assert_eq!(json["max_loop_depth"], 2);
+    assert_eq!(json["calls"], 3);
+    assert_eq!(json["score"], 111);
+    assert_eq!(json["recursive_functions"], serde_json::json!([]));
+    aether_free_string(cost);
+
+    let bad = CString::new("(1 +").unwrap();
+    let status = aether_estimate_cost(handle, bad.as_ptr(), &mut cost, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(cost.is_null());
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_shared_data() {
+    let json = CString::new(r#"{"CN": [0.13, 0.06]}"#).unwrap();
+    let mut data = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_shared_data_new(json.as_ptr(), &mut data, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let first = aether_new();
+    let second = aether_new();
+    let name = CString::new("RATES").unwrap();
+    for handle in [first, second] {
+        let status = aether_set_shared_data(handle, name.as_ptr(), data, &mut error);
+        assert_eq!(status, AetherErrorCode::Success as c_int);
+    }
+    // Engines keep their own reference to the data
+    aether_shared_data_free(data);
+
+    for handle in [first, second] {
+        assert_eq!(
+            eval_str(handle, "RATES[\"CN\"][1]"),
+            (AetherErrorCode::Success as c_int, "0.06".to_string())
+        );
+        let (status, _) = eval_str(handle, "Set RATES 1");
+        assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    }
+
+    let bad = CString::new("{").unwrap();
+    let status = aether_shared_data_new(bad.as_ptr(), &mut data, &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    assert!(data.is_null());
+    aether_free_string(error);
+
+    aether_free(first);
+    aether_free(second);
+}
+
+#[test]
+fn test_ffi_functions() {
+    let handle = aether_new();
+    let (status, _) = eval_str(handle, "Func ADD(A, B) {\n    Return (A + B)\n}");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let mut functions: *mut c_char = std::ptr::null_mut();
+    let status = aether_functions(handle, &mut functions);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(functions).to_str().unwrap() }).unwrap();
+    assert_eq!(
+        json,
+        serde_json::json!([{"name": "ADD", "params": ["A", "B"], "line": 1, "column": 1}])
+    );
+    aether_free_string(functions);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_panic_is_reported_as_error_code() {
+    let handle = aether_new();
+
+    // A C callback cannot unwind (a panic in an `extern "C"` function aborts), so
+    // the panicking host function is registered on the engine behind the handle
+    let engine = unsafe { &mut *(handle as *mut aether::Aether) };
+    engine.register_function("BOOM", 0, |_| panic!("host function bug"));
+
+    // The panic must not unwind into the caller
+    let (status, message) = eval_str(handle, "BOOM()");
+    assert_eq!(status, AetherErrorCode::Panic as c_int);
+    assert_eq!(message, "Panic occurred during evaluation");
+
+    // The handle is still usable afterwards
+    let (status, result) = eval_str(handle, "(1 + 2)");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(result, "3");
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_required_permissions() {
+    let handle = aether_new();
+    let mut permissions = AetherPermissions {
+        filesystem_enabled: 0,
+        network_enabled: 0,
+    };
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("HTTP_POST(\"http://example.com\", \"{}\")").unwrap();
+    let status = aether_required_permissions(handle, code.as_ptr(), &mut permissions, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(permissions.filesystem_enabled, 0);
+    assert_eq!(permissions.network_enabled, 1);
+
+    let bad = CString::new("HTTP_GET(").unwrap();
+    let status = aether_required_permissions(handle, bad.as_ptr(), &mut permissions, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_report() {
+    let handle = aether_new();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut report: *mut c_char = std::ptr::null_mut();
+
+    let ok = CString::new("(1 + 2)").unwrap();
+    let status = aether_eval_report(handle, ok.as_ptr(), &mut result, &mut report);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(report.is_null());
+    unsafe {
+        assert_eq!(CStr::from_ptr(result).to_str().unwrap(), "3");
+        aether_free_string(result);
+    }
+
+    // Frames are listed outermost first with the call site of top-level calls
+    let code = CString::new(
+        "Func F(N) {\n    Return G(N)\n}\nFunc G(N) {\n    Return (N + MISSING)\n}\nF(1)",
+    )
+    .unwrap();
+    let status = aether_eval_report(handle, code.as_ptr(), &mut result, &mut report);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(result.is_null());
+    unsafe {
+        let json: serde_json::Value =
+            serde_json::from_str(CStr::from_ptr(report).to_str().unwrap()).unwrap();
+        assert_eq!(json["kind"], "UndefinedVariable");
+        assert_eq!(
+            json["call_stack"],
+            serde_json::json!([
+                {"name": "F", "signature": "F(N)", "line": 7, "column": 1},
+                {"name": "G", "signature": "G(N)", "line": 0, "column": 0},
+            ])
+        );
+        aether_free_string(report);
+    }
+
+    let bad = CString::new("Set X (").unwrap();
+    let status = aether_eval_report(handle, bad.as_ptr(), &mut result, &mut report);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    unsafe {
+        let json: serde_json::Value =
+            serde_json::from_str(CStr::from_ptr(report).to_str().unwrap()).unwrap();
+        assert_eq!(json["phase"], "parse");
+        aether_free_string(report);
+    }
+
+    let status = aether_eval_report(std::ptr::null_mut(), ok.as_ptr(), &mut result, &mut report);
+    assert_eq!(status, AetherErrorCode::NullPointer as c_int);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_free_variables() {
+    let handle = aether_new();
+    let mut names: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code =
+        CString::new("Set TOTAL (PRICE * QTY)\nFunc F(X) {\n    Return X\n}\nF(TOTAL)").unwrap();
+    let status = aether_free_variables(handle, code.as_ptr(), &mut names, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(error.is_null());
+    unsafe {
+        let json = CStr::from_ptr(names).to_str().unwrap();
+        assert_eq!(json, r#"["PRICE","QTY"]"#);
+        aether_free_string(names);
+    }
+
+    let bad = CString::new("Set X (").unwrap();
+    let status = aether_free_variables(handle, bad.as_ptr(), &mut names, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert!(names.is_null());
+    assert!(!error.is_null());
+    aether_free_string(error);
+
+    let status = aether_free_variables(std::ptr::null_mut(), code.as_ptr(), &mut names, &mut error);
+    assert_eq!(status, AetherErrorCode::NullPointer as c_int);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_is_incomplete() {
+    let mut incomplete: c_int = -1;
+
+    let open = CString::new("While (I < 3) {").unwrap();
+    let status = aether_is_incomplete(open.as_ptr(), &mut incomplete);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(incomplete, 1);
+
+    let complete = CString::new("While (I < 3) {\n    Set I (I + 1)\n}").unwrap();
+    aether_is_incomplete(complete.as_ptr(), &mut incomplete);
+    assert_eq!(incomplete, 0);
+
+    let status = aether_is_incomplete(std::ptr::null(), &mut incomplete);
+    assert_eq!(status, AetherErrorCode::NullPointer as c_int);
+}
+
+#[test]
+fn test_ffi_operator_table() {
+    let mut table: *mut c_char = std::ptr::null_mut();
+    let status = aether_operator_table(&mut table);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let parsed: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(table) }.to_str().unwrap()).unwrap();
+    aether_free_string(table);
+    let precedence = |symbol: &str, kind: &str| {
+        parsed
+            .as_array()
+            .unwrap()
+            .iter()
+            .find(|op| op["symbol"] == symbol && op["kind"] == kind)
+            .and_then(|op| op["precedence"].as_u64())
+            .unwrap()
+    };
+    assert!(precedence("*", "binary") > precedence("+", "binary"));
+    assert!(precedence("-", "prefix") > precedence("-", "binary"));
+
+    let status = aether_operator_table(std::ptr::null_mut());
+    assert_eq!(status, AetherErrorCode::NullPointer as c_int);
+}
+
+#[test]
+fn test_ffi_check_incomplete() {
+    let mut incomplete: c_int = -1;
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let open = CString::new("While (I < 3) {").unwrap();
+    let status = aether_check_incomplete(open.as_ptr(), &mut incomplete, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(incomplete, 1);
+    assert!(error.is_null());
+
+    // Malformed code is an error rather than "not incomplete"
+    let bad = CString::new("Set A )").unwrap();
+    let status = aether_check_incomplete(bad.as_ptr(), &mut incomplete, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    assert_eq!(incomplete, 0);
+    let msg = unsafe { CStr::from_ptr(error) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert!(msg.contains("Parse error"), "{}", msg);
+    aether_free_string(error);
+}
+
+#[test]
+fn test_ffi_get_configured_limits() {
+    let handle = aether_new_safe();
+    aether_set_max_functions(handle, 20);
+    let mut json: *mut c_char = std::ptr::null_mut();
+    assert_eq!(
+        aether_get_configured_limits(handle, &mut json),
+        AetherErrorCode::Success as c_int
+    );
+    let limits: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(json) }.to_str().unwrap()).unwrap();
+    aether_free_string(json);
+
+    assert_eq!(limits["max_steps"], 100_000);
+    assert_eq!(limits["max_array_length"], 100_000);
+    assert_eq!(limits["max_functions"], 20);
+    assert!(limits["max_output_bytes"].is_null());
+
+    assert_eq!(
+        aether_get_configured_limits(std::ptr::null_mut(), &mut json),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_no_recursion() {
+    let handle = aether_new();
+    eval_str(
+        handle,
+        "Func FACT(N) {\n    If (N < 2) {\n        Return 1\n    }\n    Return (N * FACT(N - 1))\n}",
+    );
+    assert_eq!(eval_str(handle, "FACT(5)"), (0, "120".to_string()));
+
+    assert_eq!(
+        aether_set_no_recursion(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    let (status, msg) = eval_str(handle, "FACT(5)");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Recursion is not allowed"), "{}", msg);
+    assert_eq!(eval_str(handle, "FACT(1)"), (0, "1".to_string()));
+
+    assert_eq!(
+        aether_set_no_recursion(std::ptr::null_mut(), 1),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_div_by_zero() {
+    let handle = aether_new();
+
+    let (status, _) = eval_str(handle, "(1 / 0)");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+
+    assert_eq!(
+        aether_set_div_by_zero(handle, 2),
+        AetherErrorCode::Success as c_int
+    );
+    let (status, result) = eval_str(handle, "(1 / 0)");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(result, "0");
+
+    assert_eq!(
+        aether_set_div_by_zero(handle, 3),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_rational_division() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_rational_division(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(eval_str(handle, "(2 / 6)"), (0, "1/3".to_string()));
+    assert_eq!(eval_str(handle, "(6 / 2)"), (0, "3".to_string()));
+
+    aether_set_rational_division(handle, 0);
+    assert_eq!(eval_str(handle, "(1 / 4)"), (0, "0.25".to_string()));
+
+    assert_eq!(
+        aether_set_rational_division(std::ptr::null_mut(), 1),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_deny_list() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let prefixes = CString::new("[\"SYSTEM_\"]").unwrap();
+    let status = aether_set_deny_list(handle, prefixes.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let (status, _) = eval_str(handle, "Set SYSTEM_X 1");
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    let (status, _) = eval_str(handle, "Set USER_X 1");
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let bad = CString::new("{\"SYSTEM_\": 1}").unwrap();
+    let status = aether_set_deny_list(handle, bad.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_builtin_groups() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let groups = CString::new("[\"math\"]").unwrap();
+    let status = aether_set_builtin_groups(handle, groups.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let (status, value) = eval_str(handle, "ABS(-2)");
+    assert_eq!(
+        (status, value.as_str()),
+        (AetherErrorCode::Success as c_int, "2")
+    );
+    let (status, _) = eval_str(handle, "UPPER(\"a\")");
+    assert_ne!(status, AetherErrorCode::Success as c_int);
+
+    // Unknown groups are rejected with a message listing the valid ones
+    let bad = CString::new("[\"maths\"]").unwrap();
+    let status = aether_set_builtin_groups(handle, bad.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    let msg = unsafe { CStr::from_ptr(error) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert!(msg.contains("Unknown builtin group"), "{}", msg);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_optimization_level() {
+    let handle = aether_new();
+    let code = CString::new("(2 + 3)").unwrap();
+    let mut dump: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    assert_eq!(
+        aether_set_optimization_level(handle, 0),
+        AetherErrorCode::Success as c_int
+    );
+    aether_disassemble(handle, code.as_ptr(), &mut dump, &mut error);
+    let text = unsafe { CStr::from_ptr(dump) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert!(text.contains("Add"), "{}", text);
+    aether_free_string(dump);
+
+    assert_eq!(
+        aether_set_optimization_level(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+    aether_disassemble(handle, code.as_ptr(), &mut dump, &mut error);
+    let text = unsafe { CStr::from_ptr(dump) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert!(!text.contains("Add"), "{}", text);
+    aether_free_string(dump);
+
+    assert_eq!(
+        aether_set_optimization_level(handle, -1),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_many() {
+    let handle = aether_new();
+    let code = CString::new("10 / X").unwrap();
+    let rows = CString::new(r#"[{"X": 2}, {"X": "a"}, {"X": 5}]"#).unwrap();
+    let mut results: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_many(
+        handle,
+        code.as_ptr(),
+        rows.as_ptr(),
+        &mut results,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(results) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    let parsed: serde_json::Value = serde_json::from_str(&text).unwrap();
+    assert_eq!(parsed[0]["value"].as_f64(), Some(5.0));
+    assert!(parsed[1]["error"].is_string(), "{}", text);
+    assert_eq!(parsed[2]["value"].as_f64(), Some(2.0));
+    aether_free_string(results);
+
+    let rows = CString::new(r#"{"X": 1}"#).unwrap();
+    let status = aether_eval_many(
+        handle,
+        code.as_ptr(),
+        rows.as_ptr(),
+        &mut results,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_csv() {
+    let handle = aether_new();
+    let code = CString::new("PRICE * QTY").unwrap();
+    let header = CString::new(r#"["PRICE", "QTY"]"#).unwrap();
+    let rows = CString::new(r#"[["2.5", "4"], ["x", "1"], ["3"]]"#).unwrap();
+    let mut results: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let status = aether_eval_csv(
+        handle,
+        code.as_ptr(),
+        header.as_ptr(),
+        rows.as_ptr(),
+        &mut results,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let text = unsafe { CStr::from_ptr(results) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    let parsed: serde_json::Value = serde_json::from_str(&text).unwrap();
+    assert_eq!(parsed[0]["value"].as_f64(), Some(10.0));
+    assert!(parsed[1]["error"].is_string(), "{}", text);
+    assert!(parsed[2]["error"].is_string(), "{}", text);
+    aether_free_string(results);
+
+    let header = CString::new(r#"{"PRICE": 0}"#).unwrap();
+    let status = aether_eval_csv(
+        handle,
+        code.as_ptr(),
+        header.as_ptr(),
+        rows.as_ptr(),
+        &mut results,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+    aether_free(handle);
+}
+
+/// Appends each chunk to the `Vec<u8>` behind `user_data`
+unsafe extern "C" fn collect_output(
+    user_data: *mut c_void,
+    data: *const c_char,
+    len: usize,
+) -> c_int {
+    let out = unsafe { &mut *(user_data as *mut Vec<u8>) };
+    out.extend_from_slice(unsafe { std::slice::from_raw_parts(data as *const u8, len) });
+    0
+}
+
+/// Collects elements into the `Vec<(usize, String)>` behind `user_data`, stopping after 3
+unsafe extern "C" fn collect_elements(
+    user_data: *mut c_void,
+    index: usize,
+    value_json: *const c_char,
+) -> c_int {
+    let seen = unsafe { &mut *(user_data as *mut Vec<(usize, String)>) };
+    let json = unsafe { CStr::from_ptr(value_json) }.to_str().unwrap();
+    seen.push((index, json.to_string()));
+    if seen.len() == 3 { 1 } else { 0 }
+}
+
+#[test]
+fn test_ffi_eval_for_each() {
+    let handle = aether_new();
+    let mut seen: Vec<(usize, String)> = Vec::new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("[\"a\", [1]]").unwrap();
+    let status = aether_eval_for_each(
+        handle,
+        code.as_ptr(),
+        Some(collect_elements),
+        &mut seen as *mut Vec<(usize, String)> as *mut c_void,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(
+        seen,
+        vec![(0, "\"a\"".to_string()), (1, "[1.0]".to_string())]
+    );
+
+    // A non-zero return stops the iteration
+    seen.clear();
+    let code = CString::new("RANGE(10)").unwrap();
+    let status = aether_eval_for_each(
+        handle,
+        code.as_ptr(),
+        Some(collect_elements),
+        &mut seen as *mut Vec<(usize, String)> as *mut c_void,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert_eq!(seen.len(), 3);
+    let msg = unsafe { CStr::from_ptr(error) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert!(msg.contains("index 2"), "{}", msg);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_json_to() {
+    let handle = aether_new();
+    let mut out: Vec<u8> = Vec::new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("RANGE(1000)").unwrap();
+    let status = aether_eval_json_to(
+        handle,
+        code.as_ptr(),
+        Some(collect_output),
+        &mut out as *mut Vec<u8> as *mut c_void,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value = serde_json::from_slice(&out).unwrap();
+    assert_eq!(json.as_array().unwrap().len(), 1000);
+
+    // Nothing is written when evaluation fails
+    out.clear();
+    let bad = CString::new("(1 / 0)").unwrap();
+    let status = aether_eval_json_to(
+        handle,
+        bad.as_ptr(),
+        Some(collect_output),
+        &mut out as *mut Vec<u8> as *mut c_void,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(out.is_empty());
+    aether_free_string(error);
+
+    // Rejected chunks abort the write
+    let mut remaining: usize = 16;
+    let status = aether_eval_json_to(
+        handle,
+        code.as_ptr(),
+        Some(limited_output),
+        &mut remaining as *mut usize as *mut c_void,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    unsafe {
+        assert!(
+            CStr::from_ptr(error)
+                .to_str()
+                .unwrap()
+                .starts_with("Output error")
+        );
+    }
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+/// Reads from the `HashMap<String, String>` behind `user_data`
+unsafe extern "C" fn map_read_file(
+    user_data: *mut c_void,
+    path: *const c_char,
+    is_error: *mut c_int,
+) -> *mut c_char {
+    let files = unsafe { &*(user_data as *const std::collections::HashMap<String, String>) };
+    let path = unsafe { CStr::from_ptr(path) }.to_str().unwrap();
+    match files.get(path) {
+        Some(content) => malloc_string(content),
+        None => {
+            unsafe { *is_error = 1 };
+            malloc_string("no such file")
+        }
+    }
+}
+
+/// Writes into the `HashMap<String, String>` behind `user_data`
+unsafe extern "C" fn map_write_file(
+    user_data: *mut c_void,
+    path: *const c_char,
+    content: *const c_char,
+) -> c_int {
+    let files = unsafe { &mut *(user_data as *mut std::collections::HashMap<String, String>) };
+    let path = unsafe { CStr::from_ptr(path) }.to_str().unwrap();
+    let content = unsafe { CStr::from_ptr(content) }.to_str().unwrap();
+    files.insert(path.to_string(), content.to_string());
+    0
+}
+
+#[test]
+fn test_ffi_set_file_system() {
+    let handle = aether_new_with_permissions();
+    let mut files = std::collections::HashMap::new();
+    files.insert("in.txt".to_string(), "hello".to_string());
+    let user_data = &mut files as *mut _ as *mut c_void;
+
+    // Read-only: writes are denied
+    let status = aether_set_file_system(handle, Some(map_read_file), None, user_data);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(
+        eval_str(handle, r#"READ_FILE("in.txt")"#),
+        (AetherErrorCode::Success as c_int, "hello".to_string())
+    );
+    let (status, message) = eval_str(handle, r#"READ_FILE("missing.txt")"#);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(message.contains("no such file"), "{}", message);
+    let (status, _) = eval_str(handle, r#"WRITE_FILE("out.txt", "x")"#);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+
+    // Writable
+    aether_set_file_system(handle, Some(map_read_file), Some(map_write_file), user_data);
+    let (status, _) = eval_str(
+        handle,
+        r#"WRITE_FILE("out.txt", READ_FILE("in.txt") + "!")"#,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(files.get("out.txt").map(String::as_str), Some("hello!"));
+
+    // NULL read callback restores the real file system
+    aether_set_file_system(handle, None, None, std::ptr::null_mut());
+    let (status, _) = eval_str(handle, r#"READ_FILE("in.txt")"#);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+
+    assert_eq!(
+        aether_set_file_system(std::ptr::null_mut(), None, None, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_typed_eval() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("3 > 2").unwrap();
+    let mut flag: c_int = -1;
+    let status = aether_eval_bool(handle, code.as_ptr(), &mut flag, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(flag, 1);
+
+    let code = CString::new("6 * 7").unwrap();
+    let mut int: i64 = 0;
+    let status = aether_eval_int(handle, code.as_ptr(), &mut int, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(int, 42);
+
+    let mut float: f64 = 0.0;
+    let status = aether_eval_float(handle, code.as_ptr(), &mut float, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(float, 42.0);
+    assert!(error.is_null());
+
+    // Comparisons combined with logical operators marshal as 0/1
+    for (src, expected) in [("(10 > 5) && (2 <= 1)", 0), ("(10 > 5) Or (2 <= 1)", 1)] {
+        let code = CString::new(src).unwrap();
+        let status = aether_eval_bool(handle, code.as_ptr(), &mut flag, &mut error);
+        assert_eq!(status, AetherErrorCode::Success as c_int);
+        assert_eq!(flag, expected, "{}", src);
+    }
+    assert_eq!(
+        eval_str(handle, "(10 > 5) And Not (2 <= 1)"),
+        (0, "true".to_string())
+    );
+
+    // A script without a value is reported distinctly, not as 0
+    let void = CString::new("PRINT(\"\")").unwrap();
+    int = 7;
+    let status = aether_eval_int(handle, void.as_ptr(), &mut int, &mut error);
+    assert_eq!(status, AetherErrorCode::NoValue as c_int);
+    assert_eq!(int, 7);
+    aether_free_string(error);
+    error = std::ptr::null_mut();
+
+    // A number is not a boolean
+    let status = aether_eval_bool(handle, code.as_ptr(), &mut flag, &mut error);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    unsafe {
+        assert!(
+            CStr::from_ptr(error)
+                .to_str()
+                .unwrap()
+                .contains("expected Boolean")
+        );
+    }
+    aether_free_string(error);
+
+    let code = CString::new("1 +").unwrap();
+    let status = aether_eval_int(handle, code.as_ptr(), &mut int, &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    assert_eq!(
+        aether_eval_bool(handle, code.as_ptr(), std::ptr::null_mut(), &mut error),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_add_module() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let name = CString::new("MATHS").unwrap();
+    let code = CString::new("Func SQUARE(X) {\n    Return X * X\n}").unwrap();
+    let status = aether_add_module(handle, name.as_ptr(), code.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(error.is_null());
+    assert_eq!(
+        eval_str(handle, "MATHS.SQUARE(7)"),
+        (AetherErrorCode::Success as c_int, "49".to_string())
+    );
+
+    let bad = CString::new("Func (").unwrap();
+    let status = aether_add_module(handle, name.as_ptr(), bad.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::ParseError as c_int);
+    aether_free_string(error);
+
+    let bad_name = CString::new("not a name").unwrap();
+    let status = aether_add_module(handle, bad_name.as_ptr(), code.as_ptr(), &mut error);
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_diagnostics() {
+    let handle = aether_new();
+    let mut json_ptr: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("Set X 1\nY").unwrap();
+    let status = aether_diagnostics(handle, code.as_ptr(), &mut json_ptr);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(json_ptr) }.to_str().unwrap()).unwrap();
+    aether_free_string(json_ptr);
+    assert_eq!(json.as_array().unwrap().len(), 2);
+    assert_eq!(json[0]["severity"], "error");
+    assert_eq!(json[0]["code"], "undefined-identifier");
+    assert_eq!(json[0]["line"], 2);
+    assert_eq!(json[0]["end_column"], 2);
+    assert_eq!(json[1]["code"], "unused-variable");
+
+    // Malformed code still succeeds, with the parse error as a diagnostic
+    let code = CString::new("Set X (").unwrap();
+    let status = aether_diagnostics(handle, code.as_ptr(), &mut json_ptr);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    let json: serde_json::Value =
+        serde_json::from_str(unsafe { CStr::from_ptr(json_ptr) }.to_str().unwrap()).unwrap();
+    aether_free_string(json_ptr);
+    assert_eq!(json[0]["severity"], "error");
+
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_print_separator_and_terminator() {
+    let handle = aether_new();
+    let mut out: Vec<u8> = Vec::new();
+    aether_set_output(
+        handle,
+        Some(collect_output),
+        &mut out as *mut Vec<u8> as *mut c_void,
+    );
+
+    let sep = CString::new("|").unwrap();
+    let term = CString::new("").unwrap();
+    assert_eq!(
+        aether_set_print_separator(handle, sep.as_ptr()),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(
+        aether_set_print_terminator(handle, term.as_ptr()),
+        AetherErrorCode::Success as c_int
+    );
+
+    let (status, _) = eval_str(
+        handle,
+        r#"PRINTLN(1, 2, 3)
+PRINTLN("x")"#,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert_eq!(String::from_utf8(out.clone()).unwrap(), "1|2|3x");
+
+    assert_eq!(
+        aether_set_print_separator(handle, std::ptr::null()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_set_output(handle, None, std::ptr::null_mut());
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_last_eval_had_side_effects() {
+    let handle = aether_new();
+    let mut side_effects: c_int = -1;
+
+    eval_str(handle, "1 + 2");
+    assert_eq!(
+        aether_last_eval_had_side_effects(handle, &mut side_effects),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(side_effects, 0);
+
+    eval_str(handle, "Set X 1");
+    aether_last_eval_had_side_effects(handle, &mut side_effects);
+    assert_eq!(side_effects, 1);
+
+    assert_eq!(
+        aether_last_eval_had_side_effects(handle, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_memory_usage() {
+    let handle = aether_new();
+    let mut before: u64 = 0;
+    let mut after: u64 = 0;
+
+    assert_eq!(
+        aether_memory_usage(handle, &mut before),
+        AetherErrorCode::Success as c_int
+    );
+    eval_str(handle, "Set BIG RANGE(0, 10000)");
+    aether_memory_usage(handle, &mut after);
+    assert!(after > before + 10000, "{} -> {}", before, after);
+
+    assert_eq!(
+        aether_memory_usage(handle, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_save_and_load_state() {
+    let setup = aether_new();
+    eval_str(
+        setup,
+        "Set BASE 40\nFunc ADD(X) {\n    Return (X + BASE)\n}",
+    );
+    let mut data: *mut u8 = std::ptr::null_mut();
+    let mut len: usize = 0;
+    let mut error: *mut c_char = std::ptr::null_mut();
+    assert_eq!(
+        aether_save_state(setup, &mut data, &mut len, &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert!(error.is_null());
+    aether_free(setup);
+
+    let handle = aether_new();
+    assert_eq!(
+        aether_load_state(handle, data, len, &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert_eq!(eval_str(handle, "ADD(2)"), (0, "42".to_string()));
+    aether_free_bytes(data, len);
+
+    let garbage = b"{}";
+    assert_eq!(
+        aether_load_state(handle, garbage.as_ptr(), garbage.len(), &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert!(!error.is_null());
+    aether_free_string(error);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_export_and_import_program() {
+    let compiler = aether_new();
+    let code = CString::new("Set Y (X * 2)\nY + 1").unwrap();
+    let mut data: *mut u8 = std::ptr::null_mut();
+    let mut len: usize = 0;
+    let mut error: *mut c_char = std::ptr::null_mut();
+    assert_eq!(
+        aether_export_program(compiler, code.as_ptr(), &mut data, &mut len, &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert!(error.is_null());
+
+    let bad = CString::new("Set Y (").unwrap();
+    let mut bad_data: *mut u8 = std::ptr::null_mut();
+    let mut bad_len: usize = 0;
+    assert_eq!(
+        aether_export_program(
+            compiler,
+            bad.as_ptr(),
+            &mut bad_data,
+            &mut bad_len,
+            &mut error
+        ),
+        AetherErrorCode::ParseError as c_int
+    );
+    assert!(bad_data.is_null());
+    aether_free_string(error);
+    aether_free(compiler);
+
+    // The returned source evaluates using the loaded program
+    let handle = aether_new();
+    let mut source: *mut c_char = std::ptr::null_mut();
+    assert_eq!(
+        aether_import_program(handle, data, len, &mut source, &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    let source_str = unsafe { CStr::from_ptr(source) }
+        .to_str()
+        .unwrap()
+        .to_string();
+    assert_eq!(source_str, "Set Y (X * 2)\nY + 1");
+    aether_free_string(source);
+    eval_str(handle, "Set X 20");
+    assert_eq!(eval_str(handle, &source_str), (0, "41".to_string()));
+
+    // Truncated bytes are rejected
+    assert_eq!(
+        aether_import_program(handle, data, len - 1, &mut source, &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert!(source.is_null());
+    assert!(!error.is_null());
+    aether_free_string(error);
+    aether_free_bytes(data, len);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_eval_with() {
+    let handle = aether_new();
+    eval_str(handle, "Set BASE 100");
+    let code = CString::new("BASE + X").unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    for (x, expected) in [("1", "101"), ("2", "102")] {
+        let vars = CString::new(format!(r#"{{"X": {}}}"#, x)).unwrap();
+        let status = aether_eval_with(
+            handle,
+            code.as_ptr(),
+            vars.as_ptr(),
+            &mut result,
+            &mut error,
+        );
+        assert_eq!(status, AetherErrorCode::Success as c_int);
+        assert_eq!(
+            unsafe { CStr::from_ptr(result) }.to_str().unwrap(),
+            expected
+        );
+        aether_free_string(result);
+    }
+
+    // The overlay does not leak into the globals
+    let (status, _) = eval_str(handle, "X");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+
+    let vars = CString::new("[1]").unwrap();
+    let status = aether_eval_with(
+        handle,
+        code.as_ptr(),
+        vars.as_ptr(),
+        &mut result,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    aether_free_string(error);
+
+    let vars = CString::new(r#"{"x y": 1}"#).unwrap();
+    let status = aether_eval_with(
+        handle,
+        code.as_ptr(),
+        vars.as_ptr(),
+        &mut result,
+        &mut error,
+    );
+    assert_eq!(status, AetherErrorCode::InvalidArgument as c_int);
+    aether_free_string(error);
+
+    aether_free(handle);
+}
+
+/// Records each warning into the `Vec<(String, u64, u64)>` behind `user_data`
+unsafe extern "C" fn record_limit_warning(
+    user_data: *mut c_void,
+    kind: *const c_char,
+    used: u64,
+    limit: u64,
+) {
+    let warnings = unsafe { &mut *(user_data as *mut Vec<(String, u64, u64)>) };
+    let kind = unsafe { CStr::from_ptr(kind) }.to_str().unwrap();
+    warnings.push((kind.to_string(), used, limit));
+}
+
+#[test]
+fn test_ffi_set_limit_warning_hook() {
+    let handle = aether_new();
+    let mut warnings: Vec<(String, u64, u64)> = Vec::new();
+    aether_set_max_array_length(handle, 10);
+
+    let status = aether_set_limit_warning_hook(
+        handle,
+        90,
+        Some(record_limit_warning),
+        &mut warnings as *mut _ as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    assert_eq!(eval_str(handle, "LEN(RANGE(0, 9))"), (0, "9".to_string()));
+    assert_eq!(warnings, vec![("array_length".to_string(), 9, 10)]);
+
+    // Removing the hook stops the warnings
+    aether_set_limit_warning_hook(handle, 90, None, std::ptr::null_mut());
+    eval_str(handle, "LEN(RANGE(0, 9))");
+    assert_eq!(warnings.len(), 1);
+
+    assert_eq!(
+        aether_set_limit_warning_hook(std::ptr::null_mut(), 90, None, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+/// Records each report into the `(Vec<u64>, *mut AetherInterrupt)` behind
+/// `user_data` and interrupts the evaluation once 500 steps have run
+unsafe extern "C" fn record_progress(user_data: *mut c_void, steps: u64) {
+    let (reports, interrupt) =
+        unsafe { &mut *(user_data as *mut (Vec<u64>, *mut aether::ffi::AetherInterrupt)) };
+    reports.push(steps);
+    if steps >= 500 {
+        aether_interrupt(*interrupt);
+    }
+}
+
+#[test]
+fn test_ffi_set_progress_hook() {
+    let handle = aether_new();
+    let interrupt = aether_interrupt_handle(handle);
+    let mut state: (Vec<u64>, _) = (Vec::new(), interrupt);
+
+    let status = aether_set_progress_hook(
+        handle,
+        100,
+        Some(record_progress),
+        &mut state as *mut _ as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    let (status, msg) = eval_str(handle, "While (True) {\n    Set X 1\n}");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("Evaluation interrupted"), "{}", msg);
+    assert_eq!(state.0, vec![100, 200, 300, 400, 500]);
+
+    // Removing the hook stops the reports
+    aether_set_progress_hook(handle, 100, None, std::ptr::null_mut());
+    assert_eq!(eval_str(handle, "(1 + 1)"), (0, "2".to_string()));
+    assert_eq!(state.0.len(), 5);
+
+    assert_eq!(
+        aether_set_progress_hook(std::ptr::null_mut(), 1, None, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_interrupt_free(interrupt);
+    aether_free(handle);
+}
+
+unsafe extern "C" fn record_call(user_data: *mut c_void, name: *const c_char, args: *const c_char) {
+    let calls = unsafe { &mut *(user_data as *mut Vec<(String, String)>) };
+    let name = unsafe { CStr::from_ptr(name) }.to_str().unwrap();
+    let args = unsafe { CStr::from_ptr(args) }.to_str().unwrap();
+    calls.push((name.to_string(), args.to_string()));
+}
+
+#[test]
+fn test_ffi_set_call_hook() {
+    let handle = aether_new();
+    let mut calls: Vec<(String, String)> = Vec::new();
+
+    let status = aether_set_call_hook(
+        handle,
+        Some(record_call),
+        &mut calls as *mut _ as *mut c_void,
+    );
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+
+    assert_eq!(
+        eval_str(handle, "Func PICK(A, B) {\n    Return B\n}\nPICK(1, \"x\")"),
+        (0, "x".to_string())
+    );
+    assert_eq!(calls, vec![("PICK".to_string(), "[1.0,\"x\"]".to_string())]);
+
+    // Removing the hook stops the callbacks
+    aether_set_call_hook(handle, None, std::ptr::null_mut());
+    eval_str(handle, "PICK(1, 2)");
+    assert_eq!(calls.len(), 1);
+
+    assert_eq!(
+        aether_set_call_hook(std::ptr::null_mut(), None, std::ptr::null_mut()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+fn call_handle(
+    handle: *mut aether::ffi::AetherHandle,
+    func: *const AetherFunction,
+    args: &str,
+) -> (c_int, String) {
+    let args = CString::new(args).unwrap();
+    let mut result: *mut c_char = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    let status = aether_function_call(handle, func, args.as_ptr(), &mut result, &mut error);
+    let out = if status == AetherErrorCode::Success as c_int {
+        result
+    } else {
+        error
+    };
+    let text = unsafe { CStr::from_ptr(out) }.to_str().unwrap().to_string();
+    aether_free_string(out);
+    (status, text)
+}
+
+#[test]
+fn test_ffi_function_handle() {
+    let handle = aether_new();
+    let mut func: *mut AetherFunction = std::ptr::null_mut();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    // A lambda keeps the variables it captured
+    let code =
+        CString::new("Func MAKE_SCALER(K) {\n    Return Lambda X -> X * K\n}\nMAKE_SCALER(3)")
+            .unwrap();
+    let status = aether_eval_function(handle, code.as_ptr(), &mut func, &mut error);
+    assert_eq!(status, AetherErrorCode::Success as c_int);
+    assert!(!func.is_null());
+    assert_eq!(call_handle(handle, func, "[2]"), (0, "6.0".to_string()));
+    assert_eq!(call_handle(handle, func, "[5]"), (0, "15.0".to_string()));
+
+    let (status, _) = call_handle(handle, func, "{}");
+    assert_eq!(status, AetherErrorCode::InvalidJSON as c_int);
+    let (status, msg) = call_handle(handle, func, "[1, 2]");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(!msg.is_empty());
+    aether_function_free(func);
+
+    // Builtins are callable values too
+    let code = CString::new("UPPER").unwrap();
+    aether_eval_function(handle, code.as_ptr(), &mut func, &mut error);
+    assert_eq!(
+        call_handle(handle, func, "[\"ab\"]"),
+        (0, "\"AB\"".to_string())
+    );
+    aether_function_free(func);
+
+    // Non-function results are rejected
+    let code = CString::new("42").unwrap();
+    let status = aether_eval_function(handle, code.as_ptr(), &mut func, &mut error);
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    let msg = unsafe { CStr::from_ptr(error) }.to_str().unwrap();
+    assert!(msg.contains("expected Function, got Number"), "{}", msg);
+    aether_free_string(error);
+
+    aether_function_free(std::ptr::null_mut());
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_compile() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+
+    let code = CString::new("Set X 20\n(X + 22)").unwrap();
+    assert_eq!(
+        aether_compile(handle, code.as_ptr(), &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert!(error.is_null());
+    assert_eq!(
+        eval_str(handle, "Set X 20\n(X + 22)"),
+        (0, "42".to_string())
+    );
+
+    let code = CString::new("Set X (").unwrap();
+    assert_eq!(
+        aether_compile(handle, code.as_ptr(), &mut error),
+        AetherErrorCode::ParseError as c_int
+    );
+    assert!(!error.is_null());
+    aether_free_string(error);
+
+    // Invalid UTF-8 is reported like the eval entry points report it
+    let code = CString::new(b"\xff".to_vec()).unwrap();
+    assert_eq!(
+        aether_compile(handle, code.as_ptr(), &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    let message = unsafe { CStr::from_ptr(error).to_string_lossy().into_owned() };
+    assert!(message.contains("UTF-8"), "{}", message);
+    aether_free_string(error);
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_sorted_map_keys() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_sorted_map_keys(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+
+    let code = r#"{"h": 1, "c": 2, "f": 3, "a": 4, "g": 5, "b": 6, "e": 7, "d": 8}"#;
+    assert_eq!(
+        eval_str(handle, code),
+        (
+            0,
+            "{a: 4, b: 6, c: 2, d: 8, e: 7, f: 3, g: 5, h: 1}".to_string()
+        )
+    );
+
+    assert_eq!(
+        aether_set_sorted_map_keys(std::ptr::null_mut(), 1),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_locale() {
+    let handle = aether_new();
+    let mut error: *mut c_char = std::ptr::null_mut();
+    assert_eq!(
+        aether_set_string_coercion(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+
+    // Numbers coerced into strings follow the locale's separators
+    let tag = CString::new("de-DE").unwrap();
+    assert_eq!(
+        aether_set_locale(handle, tag.as_ptr(), &mut error),
+        AetherErrorCode::Success as c_int
+    );
+    assert!(error.is_null());
+    assert_eq!(
+        eval_str(handle, "\"\" + 1234567.5"),
+        (0, "1.234.567,5".to_string())
+    );
+    // Plain numeric results are unaffected
+    assert_eq!(eval_str(handle, "1234567.5"), (0, "1234567.5".to_string()));
+
+    let tag = CString::new("en-US").unwrap();
+    aether_set_locale(handle, tag.as_ptr(), &mut error);
+    assert_eq!(
+        eval_str(handle, "\"\" + 1234567.5"),
+        (0, "1,234,567.5".to_string())
+    );
+
+    // An empty tag restores the default
+    let tag = CString::new("").unwrap();
+    aether_set_locale(handle, tag.as_ptr(), &mut error);
+    assert_eq!(
+        eval_str(handle, "\"\" + 1234567.5"),
+        (0, "1234567.5".to_string())
+    );
+
+    let tag = CString::new("xx-YY").unwrap();
+    assert_eq!(
+        aether_set_locale(handle, tag.as_ptr(), &mut error),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert!(!error.is_null());
+    unsafe {
+        let msg = CStr::from_ptr(error).to_str().unwrap();
+        assert!(msg.contains("Unsupported locale"), "{}", msg);
+        aether_free_string(error);
+    }
+
+    assert_eq!(
+        aether_set_locale(std::ptr::null_mut(), tag.as_ptr(), &mut error),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_var_batch() {
+    let handle = aether_new();
+    let batch = aether_var_batch_new();
+    assert!(!batch.is_null());
+
+    let (x, name, flag, items) = (c"X", c"NAME", c"FLAG", c"ITEMS");
+    let ok = AetherErrorCode::Success as c_int;
+    assert_eq!(aether_var_batch_set_number(batch, x.as_ptr(), 1.5), ok);
+    assert_eq!(
+        aether_var_batch_set_string(batch, name.as_ptr(), c"ann".as_ptr()),
+        ok
+    );
+    assert_eq!(aether_var_batch_set_bool(batch, flag.as_ptr(), 1), ok);
+    assert_eq!(
+        aether_var_batch_set_json(batch, items.as_ptr(), c"[1, 2, 3]".as_ptr()),
+        ok
+    );
+    assert_eq!(aether_set_var_batch(handle, batch), ok);
+    assert_eq!(
+        eval_str(
+            handle,
+            "If (FLAG) {\n    NAME + \":\" + TO_STRING(X + LEN(ITEMS))\n}"
+        ),
+        (0, "ann:4.5".to_string())
+    );
+
+    // Invalid input is rejected when added, before anything is set
+    assert_eq!(
+        aether_var_batch_set_number(batch, c"1BAD".as_ptr(), 0.0),
+        AetherErrorCode::InvalidArgument as c_int
+    );
+    assert_eq!(
+        aether_var_batch_set_json(batch, items.as_ptr(), c"[1,".as_ptr()),
+        AetherErrorCode::InvalidJSON as c_int
+    );
+
+    // A cleared batch is refilled and applied again
+    assert_eq!(aether_var_batch_clear(batch), ok);
+    aether_var_batch_set_number(batch, x.as_ptr(), 10.0);
+    aether_set_var_batch(handle, batch);
+    assert_eq!(eval_str(handle, "X"), (0, "10".to_string()));
+
+    assert_eq!(
+        aether_set_var_batch(handle, std::ptr::null()),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_var_batch_free(batch);
+    aether_var_batch_free(std::ptr::null_mut());
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_first_last_on_empty_array() {
+    let handle = aether_new();
+    assert_eq!(eval_str(handle, "FIRST([5])"), (0, "5".to_string()));
+    assert_eq!(eval_str(handle, "LAST([4, 5])"), (0, "5".to_string()));
+    assert_eq!(eval_str(handle, "LEN([])"), (0, "0".to_string()));
+
+    // An empty array is an error, never an empty result that looks like success
+    for code in ["FIRST([])", "LAST([])"] {
+        let (status, msg) = eval_str(handle, code);
+        assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+        assert!(msg.contains("of empty array"), "{}", msg);
+    }
+    aether_free(handle);
+}
+
+#[test]
+fn test_ffi_set_no_output() {
+    let handle = aether_new();
+    assert_eq!(
+        aether_set_no_output(handle, 1),
+        AetherErrorCode::Success as c_int
+    );
+
+    let (status, msg) = eval_str(handle, "PRINTLN(\"side effect\")");
+    assert_eq!(status, AetherErrorCode::RuntimeError as c_int);
+    assert!(msg.contains("output is disabled"), "{}", msg);
+    assert_eq!(eval_str(handle, "(6 * 7)"), (0, "42".to_string()));
+
+    assert_eq!(
+        aether_set_no_output(std::ptr::null_mut(), 1),
+        AetherErrorCode::NullPointer as c_int
+    );
+    aether_free(handle);
+}
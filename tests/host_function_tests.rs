@@ -0,0 +1,251 @@
+use std::sync::Arc;
+use std::sync::atomic::{AtomicUsize, Ordering};
+
+use aether::{Aether, ExecutionLimits, HostRegistry, Value};
+
+fn add_one(args: &[Value]) -> Result<Value, String> {
+    match args {
+        [Value::Number(n)] => Ok(Value::Number(n + 1.0)),
+        _ => Err("ADD_ONE expects a number".to_string()),
+    }
+}
+
+#[test]
+fn engine_private_function() {
+    let mut engine = Aether::new();
+    engine.register_function("ADD_ONE", 1, add_one);
+
+    assert_eq!(engine.eval("ADD_ONE(41)").unwrap(), Value::Number(42.0));
+    // 可以像内置函数一样作为值传递
+    assert_eq!(
+        engine.eval("MAP([1, 2], ADD_ONE)").unwrap(),
+        Value::Array(vec![Value::Number(2.0), Value::Number(3.0)])
+    );
+
+    // reset_env 不会清除宿主函数
+    engine.reset_env();
+    assert_eq!(engine.eval("ADD_ONE(1)").unwrap(), Value::Number(2.0));
+}
+
+#[test]
+fn host_function_as_sort_comparator() {
+    let mut engine = Aether::new();
+    engine.register_function("BY_LEN", 2, |args: &[Value]| match args {
+        [Value::String(a), Value::String(b)] => Ok(Value::Number(a.len() as f64 - b.len() as f64)),
+        _ => Err("BY_LEN expects strings".to_string()),
+    });
+
+    // 按名称引用宿主函数作为比较函数
+    let result = engine
+        .eval(r#"SORT(["ccc", "a", "bb"], "BY_LEN")"#)
+        .unwrap();
+    assert_eq!(result.to_string(), "[a, bb, ccc]");
+
+    // 宿主函数的错误中止排序
+    let err = engine.eval(r#"SORT(["a", 1], "BY_LEN")"#).unwrap_err();
+    assert!(err.contains("BY_LEN expects strings"), "{}", err);
+}
+
+#[test]
+fn last_eval_called_hosts_lists_invoked_functions() {
+    let mut engine = Aether::new();
+    engine.register_function("ADD_ONE", 1, add_one);
+    engine.register_function("NEVER", 0, |_: &[Value]| Ok(Value::Null));
+
+    // 去重并按首次调用顺序记录，不包括内置函数
+    engine
+        .eval("Set X ADD_ONE(1)\nMAP([1, 2], ADD_ONE)\nLEN([X])")
+        .unwrap();
+    assert_eq!(engine.last_eval_called_hosts(), vec!["ADD_ONE".to_string()]);
+
+    // 每次求值开始时清空；只引用而不调用不计入
+    engine.eval("Set F ADD_ONE\n1").unwrap();
+    assert!(engine.last_eval_called_hosts().is_empty());
+
+    // 求值失败时保留失败前的调用
+    assert!(engine.eval("ADD_ONE(1)\nADD_ONE(\"x\")").is_err());
+    assert_eq!(engine.last_eval_called_hosts(), vec!["ADD_ONE".to_string()]);
+}
+
+#[test]
+fn host_errors_and_arity() {
+    let mut engine = Aether::new();
+    engine.register_function("ADD_ONE", 1, add_one);
+
+    let err = engine.eval("ADD_ONE(\"x\")").unwrap_err();
+    assert!(err.contains("ADD_ONE expects a number"), "{}", err);
+
+    let err = engine.eval("ADD_ONE(1, 2)").unwrap_err();
+    assert!(err.contains("expected 1, got 2"), "{}", err);
+}
+
+#[test]
+fn script_names_shadow_host_functions() {
+    let mut engine = Aether::new();
+    engine.register_function("ADD_ONE", 1, add_one);
+
+    assert_eq!(
+        engine.eval("Set ADD_ONE 5\nADD_ONE").unwrap(),
+        Value::Number(5.0)
+    );
+}
+
+#[test]
+fn shared_registry_across_engines() {
+    let registry = HostRegistry::new();
+    let calls = Arc::new(AtomicUsize::new(0));
+    let counter = Arc::clone(&calls);
+    registry.register("TICK", 0, move |_| {
+        Ok(Value::Number(
+            (counter.fetch_add(1, Ordering::SeqCst) + 1) as f64,
+        ))
+    });
+
+    let mut a = Aether::new().with_registry(registry.clone());
+    let mut b = Aether::new().with_registry(registry.clone());
+    a.eval("TICK()").unwrap();
+    b.eval("TICK()").unwrap();
+    assert_eq!(calls.load(Ordering::SeqCst), 2);
+
+    // 挂载之后注册的函数同样可见
+    registry.register("ADD_ONE", 1, add_one);
+    assert_eq!(b.eval("ADD_ONE(1)").unwrap(), Value::Number(2.0));
+
+    // 引擎私有函数优先
+    a.register_function("ADD_ONE", 1, |_| Ok(Value::Number(-1.0)));
+    assert_eq!(a.eval("ADD_ONE(1)").unwrap(), Value::Number(-1.0));
+    assert_eq!(b.eval("ADD_ONE(1)").unwrap(), Value::Number(2.0));
+}
+
+#[test]
+fn shared_registry_across_threads() {
+    let registry = HostRegistry::new();
+    registry.register("ADD_ONE", 1, add_one);
+
+    let handles: Vec<_> = (0..4)
+        .map(|i| {
+            let registry = registry.clone();
+            std::thread::spawn(move || {
+                let mut engine = Aether::new().with_registry(registry);
+                // Value 不是 Send，转成字符串再返回
+                engine.eval(&format!("ADD_ONE({})", i)).unwrap().to_string()
+            })
+        })
+        .collect();
+
+    for (i, h) in handles.into_iter().enumerate() {
+        assert_eq!(h.join().unwrap(), (i + 1).to_string());
+    }
+}
+
+/// 模拟请求级数据
+struct Request {
+    user: String,
+}
+
+#[test]
+fn context_function_sees_per_eval_data() {
+    let mut engine = Aether::new();
+    engine.register_function_with_context("CURRENT_USER", 0, |ctx, _args| {
+        ctx.get::<Request>()
+            .map(|req| Value::String(req.user.clone()))
+            .ok_or_else(|| "no request in context".to_string())
+    });
+
+    let alice = Arc::new(Request {
+        user: "alice".to_string(),
+    });
+    let bob = Arc::new(Request {
+        user: "bob".to_string(),
+    });
+
+    assert_eq!(
+        engine.eval_with_context("CURRENT_USER()", alice).unwrap(),
+        Value::String("alice".to_string())
+    );
+    assert_eq!(
+        engine.eval_with_context("CURRENT_USER()", bob).unwrap(),
+        Value::String("bob".to_string())
+    );
+
+    // 数据只在对应的求值期间可见
+    let err = engine.eval("CURRENT_USER()").unwrap_err();
+    assert!(err.contains("no request in context"), "{}", err);
+}
+
+#[test]
+fn context_function_sees_deadline() {
+    let mut engine = Aether::new();
+    engine.register_function_with_context("HAS_DEADLINE", 0, |ctx, _args| {
+        Ok(Value::Boolean(
+            ctx.remaining().is_some_and(|r| !r.is_zero()) && !ctx.is_expired(),
+        ))
+    });
+
+    engine.set_limits(ExecutionLimits {
+        max_duration_ms: Some(60_000),
+        ..ExecutionLimits::default()
+    });
+    assert_eq!(engine.eval("HAS_DEADLINE()").unwrap(), Value::Boolean(true));
+
+    engine.set_limits(ExecutionLimits::unrestricted());
+    assert_eq!(
+        engine.eval("HAS_DEADLINE()").unwrap(),
+        Value::Boolean(false)
+    );
+}
+
+#[test]
+fn shared_registry_context_function() {
+    let registry = HostRegistry::new();
+    registry.register_with_context("TAG", 0, |ctx, _args| {
+        Ok(ctx
+            .get::<String>()
+            .map(|s| Value::String(s.clone()))
+            .unwrap_or(Value::Null))
+    });
+
+    let mut engine = Aether::new().with_registry(registry);
+    assert_eq!(engine.eval("TAG()").unwrap(), Value::Null);
+    assert_eq!(
+        engine
+            .eval_with_context("TAG()", Arc::new("req-1".to_string()))
+            .unwrap(),
+        Value::String("req-1".to_string())
+    );
+}
+
+#[test]
+fn call_hook_records_every_call() {
+    use std::cell::RefCell;
+    use std::rc::Rc;
+
+    let calls = Rc::new(RefCell::new(Vec::new()));
+    let mut engine = Aether::new();
+    engine.register_function("ADD_ONE", 1, add_one);
+    let log = Rc::clone(&calls);
+    engine.set_call_hook(move |name, args| {
+        log.borrow_mut().push((name.to_string(), args.to_vec()));
+    });
+
+    // 非尾递归的每一层都会触发，内置函数和宿主函数同样会触发
+    let code = r#"
+Func SUM_TO(N) {
+    If (N <= 0) {
+        Return 0
+    }
+    Return (N + SUM_TO(N - 1))
+}
+ADD_ONE(LEN([SUM_TO(2)]))
+"#;
+    assert_eq!(engine.eval(code).unwrap(), Value::Number(2.0));
+    let names: Vec<String> = calls.borrow().iter().map(|(n, _)| n.clone()).collect();
+    assert_eq!(names, ["SUM_TO", "SUM_TO", "SUM_TO", "LEN", "ADD_ONE"]);
+    assert_eq!(calls.borrow()[1].1, vec![Value::Number(1.0)]);
+
+    // 移除钩子后不再触发
+    engine.clear_call_hook();
+    calls.borrow_mut().clear();
+    engine.eval("LEN([1])").unwrap();
+    assert!(calls.borrow().is_empty());
+}
@@ -56,3 +56,110 @@ fn can_inject_rust_dict_as_global() {
     // Not leaked
     assert!(engine.eval("DATA").is_err());
 }
+
+#[test]
+fn set_globals_binds_all_or_nothing() {
+    let mut engine = Aether::new();
+
+    engine
+        .set_globals([
+            ("A", Value::Number(1.0)),
+            ("B", Value::String("x".to_string())),
+        ])
+        .unwrap();
+    assert_eq!(engine.eval("A").unwrap(), Value::Number(1.0));
+    assert_eq!(engine.eval("B").unwrap(), Value::String("x".to_string()));
+
+    let err = engine
+        .set_globals([("C", Value::Number(3.0)), ("BAD NAME", Value::Null)])
+        .unwrap_err();
+    assert!(err.contains("BAD NAME"), "{}", err);
+    // Nothing was bound
+    assert!(engine.eval("C").is_err());
+}
+
+#[test]
+fn initial_vars_are_copied_per_engine() {
+    let seed = vec![
+        (
+            "RATES",
+            Value::Array(vec![Value::Number(1.0), Value::Number(2.0)]),
+        ),
+        ("LIMIT", Value::Number(100.0)),
+    ];
+    let mut a = Aether::new()
+        .with_name("a")
+        .with_initial_vars(seed.clone())
+        .unwrap();
+    let mut b = Aether::new().with_initial_vars(seed).unwrap();
+
+    // Mutating the seeded array in one engine does not touch the other
+    a.eval("Set RATES[0] 99").unwrap();
+    assert_eq!(a.eval("RATES[0]").unwrap(), Value::Number(99.0));
+    assert_eq!(b.eval("RATES[0]").unwrap(), Value::Number(1.0));
+
+    // reset_env restores a fresh copy of the seeded values
+    a.eval("Set LIMIT 5").unwrap();
+    a.reset_env();
+    assert_eq!(
+        a.eval("[RATES[0], LIMIT]").unwrap(),
+        b.eval("[RATES[0], LIMIT]").unwrap()
+    );
+
+    let err = Aether::new()
+        .with_initial_vars([("OK", Value::Null), ("BAD NAME", Value::Null)])
+        .err()
+        .unwrap();
+    assert!(err.contains("BAD NAME"), "{}", err);
+}
+
+#[test]
+fn pooled_engines_keep_initial_vars() {
+    use aether::engine::EnginePool;
+
+    let mut pool = EnginePool::new(1)
+        .with_initial_vars([("ITEMS", Value::Array(vec![Value::Number(1.0)]))])
+        .unwrap();
+    {
+        let mut engine = pool.acquire();
+        engine.eval("Set ITEMS PUSH(ITEMS, 2)").unwrap();
+        assert_eq!(engine.eval("LEN(ITEMS)").unwrap(), Value::Number(2.0));
+    }
+    // The next acquisition starts from the seeded value again
+    let mut engine = pool.acquire();
+    assert_eq!(engine.eval("LEN(ITEMS)").unwrap(), Value::Number(1.0));
+
+    // Temporary engines created when the pool is exhausted are seeded too
+    let mut extra = pool.acquire();
+    assert_eq!(extra.eval("LEN(ITEMS)").unwrap(), Value::Number(1.0));
+}
+
+#[test]
+fn defines_are_immutable_flags() {
+    let mut engine = Aether::new()
+        .with_defines([("FEATURE_X", true), ("FEATURE_Y", false)])
+        .unwrap();
+    let script = "If (FEATURE_X) { \"x\" } Elif (FEATURE_Y) { \"y\" } Else { \"none\" }";
+    assert_eq!(engine.eval(script).unwrap(), Value::String("x".to_string()));
+
+    // Flags cannot be reassigned and survive a reset
+    let err = engine.eval("Set FEATURE_X False").unwrap_err();
+    assert!(err.contains("Cannot reassign constant"), "{}", err);
+    engine.reset_env();
+    engine.set_defines([("FEATURE_X", false)]).unwrap();
+    assert_eq!(
+        engine.eval(script).unwrap(),
+        Value::String("none".to_string())
+    );
+
+    // An invalid name defines nothing
+    assert!(
+        engine
+            .set_defines([("FEATURE_Y", true), ("BAD NAME", true)])
+            .is_err()
+    );
+    assert_eq!(
+        engine.eval(script).unwrap(),
+        Value::String("none".to_string())
+    );
+}
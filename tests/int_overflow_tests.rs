@@ -0,0 +1,152 @@
+use aether::{Aether, IntOverflowMode, Value};
+
+// POW(2, 62) 是精确的 f64 整数；两者相加正好越过 i64::MAX
+const ADD_AT_MAX: &str = "(POW(2, 62) + POW(2, 62))";
+const SUB_AT_MIN: &str = "((0 - POW(2, 62)) - POW(2, 62) - 1)";
+const MUL_PAST_MAX: &str = "(POW(2, 32) * POW(2, 32))";
+
+#[test]
+fn default_mode_is_error() {
+    let engine = Aether::new();
+    assert_eq!(engine.int_overflow(), IntOverflowMode::Error);
+}
+
+#[test]
+fn error_mode_reports_overflow() {
+    let mut engine = Aether::new();
+
+    for code in [ADD_AT_MAX, SUB_AT_MIN, MUL_PAST_MAX] {
+        let err = engine.eval(code).unwrap_err();
+        assert!(err.contains("Integer overflow"), "{}: {}", code, err);
+    }
+}
+
+#[test]
+fn constant_folding_does_not_bypass_overflow_mode() {
+    let mut engine = Aether::new();
+
+    // 纯字面量表达式会在编译期折叠，溢出时也必须按模式处理
+    let err = engine
+        .eval("(1000000 * 1000000 * 1000000 * 1000)")
+        .unwrap_err();
+    assert!(err.contains("Integer overflow"), "{}", err);
+
+    // 切换模式会清空缓存，同一段代码按新模式重新编译
+    engine.set_int_overflow(IntOverflowMode::Saturate);
+    assert_eq!(
+        engine.eval("(1000000 * 1000000 * 1000000 * 1000)").unwrap(),
+        Value::Number(i64::MAX as f64)
+    );
+
+    // 不溢出的字面量照常折叠
+    assert_eq!(
+        engine.eval("(1000000 * 1000000)").unwrap(),
+        Value::Number(1e12)
+    );
+}
+
+#[test]
+fn error_mode_allows_values_at_boundary() {
+    let mut engine = Aether::new();
+
+    // -2^63 正好等于 i64::MIN，不算溢出
+    let result = engine.eval("((0 - POW(2, 62)) - POW(2, 62))").unwrap();
+    assert_eq!(result, Value::Number(i64::MIN as f64));
+}
+
+#[test]
+fn wrap_mode_wraps_around() {
+    let mut engine = Aether::new();
+    engine.set_int_overflow(IntOverflowMode::Wrap);
+
+    assert_eq!(
+        engine.eval(ADD_AT_MAX).unwrap(),
+        Value::Number(i64::MIN as f64)
+    );
+    assert_eq!(
+        engine.eval(SUB_AT_MIN).unwrap(),
+        Value::Number(i64::MAX as f64)
+    );
+    assert_eq!(engine.eval(MUL_PAST_MAX).unwrap(), Value::Number(0.0));
+}
+
+#[test]
+fn saturate_mode_clamps_to_bounds() {
+    let mut engine = Aether::new();
+    engine.set_int_overflow(IntOverflowMode::Saturate);
+
+    assert_eq!(
+        engine.eval(ADD_AT_MAX).unwrap(),
+        Value::Number(i64::MAX as f64)
+    );
+    assert_eq!(
+        engine.eval(SUB_AT_MIN).unwrap(),
+        Value::Number(i64::MIN as f64)
+    );
+    assert_eq!(
+        engine.eval(MUL_PAST_MAX).unwrap(),
+        Value::Number(i64::MAX as f64)
+    );
+}
+
+#[test]
+fn bigint_mode_is_exact() {
+    let mut engine = Aether::new();
+    engine.set_int_overflow(IntOverflowMode::BigInt);
+
+    assert_eq!(
+        engine.eval(ADD_AT_MAX).unwrap().to_string(),
+        "9223372036854775808"
+    );
+    assert_eq!(
+        engine.eval(SUB_AT_MIN).unwrap().to_string(),
+        "-9223372036854775809"
+    );
+    assert_eq!(
+        engine.eval(MUL_PAST_MAX).unwrap().to_string(),
+        "18446744073709551616"
+    );
+
+    // 超出 2^53 后 f64 已无法精确表示，同样提升
+    assert_eq!(
+        engine.eval("(POW(2, 53) + 1)").unwrap().to_string(),
+        "9007199254740993"
+    );
+
+    // 纯字面量表达式不会在编译期折叠成不精确的浮点数
+    assert_eq!(
+        engine
+            .eval("(3000000000 * 3000000000 * 3000000000)")
+            .unwrap()
+            .to_string(),
+        "27000000000000000000000000000"
+    );
+    assert_eq!(
+        engine.eval("(9007199254740992 + 1)").unwrap().to_string(),
+        "9007199254740993"
+    );
+
+    // 提升后继续累乘仍然精确
+    let code = "Set F 1\nFor I In RANGE(1, 26) {\n    Set F (F * I)\n}\nF";
+    assert_eq!(
+        engine.eval_bigint(code).unwrap().to_string(),
+        "15511210043330985984000000"
+    );
+
+    // 范围内的整数保持普通数字
+    assert_eq!(engine.eval("(2 + 3)").unwrap(), Value::Number(5.0));
+    assert_eq!(engine.eval_bigint("(2 + 3)").unwrap().to_string(), "5");
+    assert!(engine.eval_bigint("(1 / 2)").is_err());
+    assert!(engine.eval_bigint("\"1\"").is_err());
+}
+
+#[test]
+fn non_integer_arithmetic_is_unaffected() {
+    let mut engine = Aether::new();
+
+    assert_eq!(engine.eval("(1.5 + 2)").unwrap(), Value::Number(3.5));
+    assert_eq!(
+        engine.eval("(POW(2, 62) + 0.5)").unwrap(),
+        Value::Number(2f64.powi(62) + 0.5)
+    );
+}
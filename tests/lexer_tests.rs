@@ -1,4 +1,4 @@
-use aether::{Lexer, Token};
+use aether::{Comment, Lexer, Token};
 
 #[test]
 fn test_basic_tokens() {
@@ -142,6 +142,37 @@ fn test_block_comment() {
     assert_eq!(lexer.next_token(), Token::Number(10.0));
 }
 
+#[test]
+fn test_comments_are_collected() {
+    let input = "// header\nSet X /* inline\nspans */ 10 // trailing\nSet Y 20";
+    let mut lexer = Lexer::new(input);
+    while lexer.next_token() != Token::EOF {}
+
+    let comment = |text: &str, line, column| Comment {
+        text: text.to_string(),
+        line,
+        column,
+    };
+    assert_eq!(
+        lexer.comments(),
+        &[
+            comment("// header", 1, 1),
+            comment("/* inline\nspans */", 2, 7),
+            comment("// trailing", 3, 13),
+        ]
+    );
+}
+
+#[test]
+fn test_block_comment_keeps_line_numbers() {
+    let input = "/* one\ntwo\nthree */\nSet X 1";
+    let mut lexer = Lexer::new(input);
+
+    assert_eq!(lexer.next_token(), Token::Newline);
+    assert_eq!(lexer.next_token(), Token::Set);
+    assert_eq!(lexer.token_position(), (4, 1));
+}
+
 #[test]
 fn test_newlines() {
     let input = "Set X 10\nSet Y 20";
@@ -1,4 +1,5 @@
-use aether::{Aether, Value};
+use aether::runtime::diff_globals;
+use aether::{Aether, IntOverflowMode, StateChange, Value};
 
 #[test]
 fn test_aether_creation() {
@@ -23,3 +24,753 @@ fn test_cache_usage() {
     assert_eq!(stats.hits, 1);
     assert_eq!(stats.misses, 1);
 }
+
+#[test]
+fn test_eval_phases_separates_parse_from_eval() {
+    use std::time::Duration;
+
+    let mut engine = Aether::new();
+    let code = "Set S 0\nFor I In RANGE(2000) {\n    Set S (S + I)\n}\nS";
+
+    let (result, phases) = engine.eval_phases(code);
+    assert_eq!(result.unwrap(), Value::Number(1999000.0));
+    assert!(!phases.cached);
+    assert!(phases.parse > Duration::ZERO);
+    assert!(phases.eval > Duration::ZERO);
+
+    // 第二次命中 AST 缓存，不再解析
+    let (result, phases) = engine.eval_phases(code);
+    assert_eq!(result.unwrap(), Value::Number(1999000.0));
+    assert!(phases.cached);
+
+    // 解析失败时没有执行阶段
+    let (result, phases) = engine.eval_phases("Set X (1 +");
+    assert!(result.unwrap_err().contains("Parse error"));
+    assert_eq!(phases.eval, Duration::ZERO);
+}
+
+#[test]
+fn test_call_function_value() {
+    let mut engine = Aether::new();
+    let scaler = engine
+        .eval("Func MAKE_SCALER(K) {\n    Return Lambda X -> X * K\n}\nMAKE_SCALER(3)")
+        .unwrap();
+
+    // 闭包捕获的变量在之后调用时仍然有效
+    assert_eq!(
+        engine.call_value(&scaler, vec![Value::Number(4.0)]),
+        Ok(Value::Number(12.0))
+    );
+
+    let err = engine.call_value(&Value::Number(1.0), vec![]).unwrap_err();
+    assert!(err.contains("Not callable"), "{}", err);
+}
+
+#[test]
+fn test_call_named_function() {
+    let mut engine = Aether::new();
+    engine
+        .eval(
+            r#"
+Func CALCULATE(A, B) {
+    Return (A * B + 1)
+}
+Set NOT_A_FUNC 42
+"#,
+        )
+        .unwrap();
+
+    let result = engine
+        .call("CALCULATE", vec![Value::Number(5.0), Value::Number(6.0)])
+        .unwrap();
+    assert_eq!(result, Value::Number(31.0));
+
+    // 字符串参数不会被当作源码解析
+    let err = engine
+        .call(
+            "CALCULATE",
+            vec![Value::String("1) + EVIL(".to_string()), Value::Number(2.0)],
+        )
+        .unwrap_err();
+    assert!(err.contains("Runtime error"), "{}", err);
+
+    // 内置函数同样可以调用
+    assert_eq!(
+        engine
+            .call("UPPER", vec![Value::String("abc".to_string())])
+            .unwrap(),
+        Value::String("ABC".to_string())
+    );
+
+    let err = engine.call("MISSING", vec![]).unwrap_err();
+    assert!(err.contains("Undefined variable: MISSING"), "{}", err);
+
+    let err = engine.call("NOT_A_FUNC", vec![]).unwrap_err();
+    assert!(err.contains("Not callable"), "{}", err);
+
+    let err = engine
+        .call("CALCULATE", vec![Value::Number(1.0)])
+        .unwrap_err();
+    assert!(err.contains("expected 2, got 1"), "{}", err);
+}
+
+#[test]
+fn test_prelude_survives_reset() {
+    let mut engine = Aether::new();
+    engine
+        .load_prelude(
+            r#"
+Func DOUBLE(X) {
+    Return (X * 2)
+}
+Func QUAD(X) {
+    Return DOUBLE(DOUBLE(X))
+}
+"#,
+        )
+        .unwrap();
+
+    assert_eq!(engine.eval("QUAD(3)").unwrap(), Value::Number(12.0));
+
+    // 请求级变量在 reset 后被清除，prelude 函数保留
+    engine.eval("Set RATE 10").unwrap();
+    engine.reset_env();
+    assert!(engine.eval("RATE").is_err());
+    assert_eq!(engine.eval("QUAD(1)").unwrap(), Value::Number(4.0));
+
+    // prelude 函数读取的是新环境中的全局变量
+    engine
+        .load_prelude("Func SCALED(X) {\n    Return (X * RATE)\n}")
+        .unwrap();
+    engine.reset_env();
+    engine.eval("Set RATE 3").unwrap();
+    assert_eq!(engine.eval("SCALED(2)").unwrap(), Value::Number(6.0));
+
+    engine.clear_prelude();
+    engine.reset_env();
+    assert!(engine.eval("QUAD(1)").is_err());
+}
+
+#[test]
+fn test_prelude_survives_reset_after_failed_eval() {
+    use aether::ExecutionLimits;
+
+    let mut engine = Aether::new();
+    engine
+        .load_prelude("Func DOUBLE(X) {\n    Return (X * 2)\n}")
+        .unwrap();
+    engine.set_limits(ExecutionLimits {
+        max_steps: Some(50),
+        ..ExecutionLimits::default()
+    });
+
+    // 上一次求值触发步数限制或留下中断请求，都不影响 reset 时重新定义 prelude
+    let err = engine.eval("While (True) {\n    Set X 1\n}").unwrap_err();
+    assert!(err.contains("step limit"), "{}", err);
+    engine.reset_env();
+    assert_eq!(engine.eval("DOUBLE(2)").unwrap(), Value::Number(4.0));
+
+    engine.interrupt_handle().interrupt();
+    engine.reset_env();
+    assert_eq!(engine.eval("DOUBLE(3)").unwrap(), Value::Number(6.0));
+
+    // 与常量同名的 prelude 函数被拒绝
+    engine.set_const("LIMIT", Value::Number(1.0)).unwrap();
+    let err = engine
+        .load_prelude("Func LIMIT() {\n    Return 2\n}")
+        .unwrap_err();
+    assert!(
+        err.contains("Prelude error: Cannot reassign constant 'LIMIT' at line 1"),
+        "{}",
+        err
+    );
+    assert_eq!(engine.eval("LIMIT").unwrap(), Value::Number(1.0));
+}
+
+#[test]
+fn test_prelude_rejects_non_definitions() {
+    let mut engine = Aether::new();
+    let err = engine
+        .load_prelude("Func OK() {\n    Return 1\n}\nPRINTLN(\"side effect\")")
+        .unwrap_err();
+    assert!(err.contains("Prelude error"), "{}", err);
+    assert!(err.contains("found Expression at line 4"), "{}", err);
+
+    // 出错时不定义任何函数
+    assert!(engine.eval("OK()").is_err());
+
+    let err = engine.load_prelude("Func (").unwrap_err();
+    assert!(err.contains("Parse error"), "{}", err);
+}
+
+#[test]
+fn test_constants_cannot_be_reassigned() {
+    let mut engine = Aether::new();
+    engine.set_const("MAX_RETRIES", Value::Number(3.0)).unwrap();
+    engine
+        .set_const("LIMITS", Value::Array(vec![Value::Number(1.0)]))
+        .unwrap();
+
+    assert_eq!(
+        engine.eval("(MAX_RETRIES + 1)").unwrap(),
+        Value::Number(4.0)
+    );
+
+    for code in [
+        "Set MAX_RETRIES 10",
+        "Set LIMITS[0] 2",
+        "Func MAX_RETRIES() {\n    Return 1\n}",
+        "For MAX_RETRIES In [1, 2] {\n    PRINTLN(MAX_RETRIES)\n}",
+        // 函数内部同样不能遮蔽常量
+        "Func F() {\n    Set MAX_RETRIES 0\n}\nF()",
+    ] {
+        let err = engine.eval(code).unwrap_err();
+        assert!(
+            err.contains("Cannot reassign constant"),
+            "{}: {}",
+            code,
+            err
+        );
+    }
+    assert_eq!(engine.eval("MAX_RETRIES").unwrap(), Value::Number(3.0));
+
+    // 常量在 reset 后保留，宿主可以替换其值
+    engine.reset_env();
+    assert_eq!(engine.eval("MAX_RETRIES").unwrap(), Value::Number(3.0));
+    engine.set_const("MAX_RETRIES", Value::Number(5.0)).unwrap();
+    assert_eq!(engine.eval("MAX_RETRIES").unwrap(), Value::Number(5.0));
+
+    assert!(engine.set_const("not valid", Value::Null).is_err());
+
+    engine.clear_constants();
+    assert_eq!(
+        engine.eval("Set MAX_RETRIES 1\nMAX_RETRIES").unwrap(),
+        Value::Number(1.0)
+    );
+}
+
+#[test]
+fn test_shared_data_is_read_only_and_shared_across_threads() {
+    use aether::SharedData;
+    use std::collections::HashMap;
+
+    let rates = HashMap::from([
+        (
+            "CN".to_string(),
+            Value::Array(vec![Value::Number(0.13), Value::Number(0.06)]),
+        ),
+        ("US".to_string(), Value::Array(vec![Value::Number(0.07)])),
+    ]);
+    let data = SharedData::new(&Value::Dict(rates)).unwrap();
+
+    let handles: Vec<_> = (0..4)
+        .map(|_| {
+            let data = data.clone();
+            std::thread::spawn(move || {
+                let mut engine = Aether::new().with_shared_data("RATES", &data).unwrap();
+                engine.eval("RATES[\"CN\"][1]").unwrap().to_string()
+            })
+        })
+        .collect();
+    for h in handles {
+        assert_eq!(h.join().unwrap(), "0.06");
+    }
+
+    let mut engine = Aether::new();
+    engine.eval("Set RATES 1").unwrap();
+    engine.set_shared_data("RATES", &data).unwrap();
+    assert_eq!(
+        engine.eval("LEN(RATES[\"US\"])").unwrap(),
+        Value::Number(1.0)
+    );
+    assert_eq!(engine.eval("LEN(RATES)").unwrap(), Value::Number(2.0));
+    assert!(
+        engine
+            .eval("RATES[\"JP\"]")
+            .unwrap_err()
+            .contains("Key 'JP' not found")
+    );
+    assert!(
+        engine
+            .eval("RATES[0]")
+            .unwrap_err()
+            .contains("Cannot index Dict")
+    );
+
+    for code in ["Set RATES 1", "Set RATES[\"US\"] []"] {
+        let err = engine.eval(code).unwrap_err();
+        assert!(
+            err.contains("Cannot reassign constant"),
+            "{}: {}",
+            code,
+            err
+        );
+    }
+    // 读取出的副本可以修改，不影响共享数据
+    engine
+        .eval("Set MINE RATES[\"US\"]\nSet MINE[0] 1")
+        .unwrap();
+    assert_eq!(
+        engine.eval("RATES[\"US\"][0]").unwrap(),
+        Value::Number(0.07)
+    );
+
+    engine.reset_env();
+    assert_eq!(
+        engine.eval("RATES[\"CN\"][0]").unwrap(),
+        Value::Number(0.13)
+    );
+    assert!(engine.remove_shared_data("RATES"));
+    assert!(engine.eval("RATES").is_err());
+
+    assert!(engine.set_shared_data("not valid", &data).is_err());
+    assert!(SharedData::new(&engine.eval("Lambda(X) -> X").unwrap()).is_err());
+}
+
+#[test]
+fn test_load_state_keeps_shared_data_read_only() {
+    use aether::SharedData;
+
+    let mut setup = Aether::new();
+    setup.eval("Set RATES {\"US\": 1}\nSet OTHER 2").unwrap();
+    let bytes = setup.save_state().unwrap();
+
+    let data = SharedData::new(&Value::Array(vec![Value::Number(0.07)])).unwrap();
+    let mut engine = Aether::new().with_shared_data("RATES", &data).unwrap();
+    engine.load_state(&bytes).unwrap();
+
+    // 同名的保存值不会遮蔽共享数据，共享数据仍然只读
+    assert_eq!(engine.eval("RATES[0]").unwrap(), Value::Number(0.07));
+    assert_eq!(engine.eval("OTHER").unwrap(), Value::Number(2.0));
+    let err = engine.eval("Set RATES[0] 1").unwrap_err();
+    assert!(err.contains("Cannot reassign constant"), "{}", err);
+    assert_eq!(engine.eval("RATES[0]").unwrap(), Value::Number(0.07));
+}
+
+#[test]
+fn test_deny_list_rejects_names_at_parse_time() {
+    let mut engine = Aether::new().with_deny_list(vec!["SYSTEM_".to_string()]);
+
+    assert_eq!(
+        engine.eval("Set USER_X 1\nUSER_X").unwrap(),
+        Value::Number(1.0)
+    );
+
+    let err = engine.eval("Set SYSTEM_X 1").unwrap_err();
+    assert!(err.starts_with("Parse error"), "{}", err);
+    assert!(err.contains("SYSTEM_X"), "{}", err);
+
+    // 引用、函数名、参数和循环变量同样被拒绝，且代码不会执行
+    for code in [
+        "Set Y SYSTEM_SECRET",
+        "Func SYSTEM_RUN() {\n    Return 1\n}",
+        "Func RUN(SYSTEM_ARG) {\n    Return 1\n}",
+        "For SYSTEM_I In [1] {\n    Set Z 1\n}",
+        "Set USER_Y 2\nSYSTEM_CALL()",
+    ] {
+        assert!(engine.eval(code).is_err(), "{}", code);
+    }
+    assert!(engine.eval("USER_Y").is_err());
+
+    // 字典键和字符串不受影响
+    assert!(engine.eval("Set D {SYSTEM_KEY: \"SYSTEM_X\"}").is_ok());
+
+    // 已缓存的代码在设置禁止列表后重新检查
+    let mut engine = Aether::new();
+    assert!(engine.eval("Set SYSTEM_X 1").is_ok());
+    engine.set_deny_list(vec!["SYSTEM_".to_string()]);
+    assert!(engine.eval("Set SYSTEM_X 1").is_err());
+}
+
+#[test]
+fn test_deny_list_applies_to_modules_and_members() {
+    let mut engine = Aether::new();
+    engine
+        .add_module(
+            "LIB",
+            "Func SYSTEM_F() {\n    Return 1\n}\nFunc OK() {\n    Return 2\n}",
+        )
+        .unwrap();
+    assert_eq!(engine.eval("LIB.OK()").unwrap(), Value::Number(2.0));
+
+    // 设置禁止列表之前注册（甚至已加载）的模块在导入时同样被检查
+    engine.set_deny_list(vec!["SYSTEM_".to_string()]);
+    let err = engine.eval("LIB.OK()").unwrap_err();
+    assert!(err.contains("SYSTEM_F"), "{}", err);
+
+    // 成员名同样被检查
+    engine
+        .add_module("CLEAN", "Func OK() {\n    Return 3\n}")
+        .unwrap();
+    assert_eq!(engine.eval("CLEAN.OK()").unwrap(), Value::Number(3.0));
+    let err = engine.eval("CLEAN.SYSTEM_F()").unwrap_err();
+    assert!(err.starts_with("Parse error"), "{}", err);
+    assert!(err.contains("SYSTEM_F"), "{}", err);
+}
+
+#[test]
+fn test_typed_eval() {
+    let mut engine = Aether::new();
+    engine.eval("Set AGE 20").unwrap();
+
+    assert_eq!(engine.eval_bool("AGE >= 18"), Ok(true));
+    assert_eq!(engine.eval_bool("AGE < 18"), Ok(false));
+    assert_eq!(engine.eval_int("AGE * 2"), Ok(40));
+    assert_eq!(engine.eval_float("AGE / 8"), Ok(2.5));
+
+    // 结果类型不符时报错，不做隐式转换
+    let err = engine.eval_bool("AGE").unwrap_err();
+    assert!(err.contains("expected Boolean, got Number"), "{}", err);
+    assert!(engine.eval_bool("\"true\"").is_err());
+    assert!(engine.eval_int("TRUE").is_err());
+    assert!(engine.eval_int("\"42\"").is_err());
+    assert!(engine.eval_float("NULL").is_err());
+
+    // 整数结果必须没有小数部分
+    let err = engine.eval_int("AGE / 8").unwrap_err();
+    assert!(err.contains("expected integer, got 2.5"), "{}", err);
+
+    // 求值错误原样返回
+    assert!(engine.eval_bool("UNDEFINED_VAR").is_err());
+}
+
+#[test]
+fn test_typed_eval_without_value() {
+    let mut engine = Aether::new();
+    engine.set_output(std::io::sink());
+
+    // 没有产生值的脚本报 NoValue，而不是当作 0 或 false
+    for code in ["PRINTLN(1)", "Set X 1\nPRINT(X)", ""] {
+        let err = engine.eval_int(code).unwrap_err();
+        assert!(err.contains("Script produced no value"), "{}", err);
+        assert!(engine.eval_bool(code).is_err());
+        assert!(engine.eval_float(code).is_err());
+        assert!(engine.eval_bigint(code).is_err());
+        assert!(engine.eval_as::<Vec<i64>>(code).is_err());
+    }
+    assert_eq!(engine.eval_as::<Value>("PRINTLN(1)"), Ok(Value::Null));
+
+    assert_eq!(
+        aether::RuntimeError::NoValue.to_error_report().kind,
+        "NoValue"
+    );
+}
+
+#[test]
+fn test_eval_as_generic() {
+    let mut engine = Aether::new();
+
+    assert_eq!(engine.eval_as::<i64>("(6 * 7)"), Ok(42));
+    assert_eq!(engine.eval_as::<i32>("(0 - 7)"), Ok(-7));
+    assert_eq!(engine.eval_as::<f64>("TO_FRACTION(0.75)"), Ok(0.75));
+    assert_eq!(
+        engine.eval_as::<String>("\"a\" + \"b\""),
+        Ok("ab".to_string())
+    );
+    assert_eq!(engine.eval_as::<bool>("(1 < 2)"), Ok(true));
+    assert_eq!(engine.eval_as::<Vec<i64>>("[1, 2, 3]"), Ok(vec![1, 2, 3]));
+    assert_eq!(
+        engine.eval_as::<Vec<Vec<String>>>("[[\"x\"], []]"),
+        Ok(vec![vec!["x".to_string()], vec![]])
+    );
+    assert_eq!(
+        engine.eval_as::<Value>("[1]"),
+        Ok(Value::Array(vec![Value::Number(1.0)]))
+    );
+
+    // 类型不符时报错，数组元素的错误带有下标
+    let err = engine.eval_as::<String>("42").unwrap_err();
+    assert!(err.contains("expected String, got Number"), "{}", err);
+    let err = engine.eval_as::<Vec<i64>>("[1, \"2\"]").unwrap_err();
+    assert!(
+        err.contains("expected Number at index 1, got String"),
+        "{}",
+        err
+    );
+    let err = engine.eval_as::<i32>("3000000000").unwrap_err();
+    assert!(err.contains("expected integer"), "{}", err);
+    assert!(engine.eval_as::<Vec<i64>>("1").is_err());
+}
+
+#[test]
+fn test_comparison_and_logical_predicates() {
+    let mut engine = Aether::new();
+    engine.eval("Set A 3\nSet B 12").unwrap();
+
+    assert_eq!(engine.eval("(10 > 5)").unwrap().to_string(), "true");
+    assert_eq!(engine.eval_bool("(10 > 5)"), Ok(true));
+    assert_eq!(engine.eval_bool("(A <= 3)"), Ok(true));
+    assert_eq!(engine.eval_bool("(A != 3)"), Ok(false));
+
+    // 逻辑运算符既有关键字形式，也有符号形式
+    for (code, expected) in [
+        ("(A > 0) And (B < 10)", false),
+        ("(A > 0) Or (B < 10)", true),
+        ("(A > 0) && (B > 10)", true),
+        ("(A > 5) || (B < 10)", false),
+        ("Not (A > 5)", true),
+        ("!(A > 0) || ((B >= 12) And (A == 3))", true),
+    ] {
+        assert_eq!(engine.eval_bool(code), Ok(expected), "{}", code);
+        assert_eq!(engine.eval(code).unwrap().to_string(), expected.to_string());
+    }
+}
+
+#[test]
+fn test_last_eval_had_side_effects() {
+    let mut engine = Aether::new();
+    engine.set_global("AGE", Value::Number(20.0));
+
+    // 只读的谓词没有副作用，宿主设置的全局变量不计入
+    assert_eq!(engine.eval_bool("AGE >= 18"), Ok(true));
+    assert!(!engine.last_eval_had_side_effects());
+
+    engine.eval("Set AGE 1").unwrap();
+    assert!(engine.last_eval_had_side_effects());
+
+    engine
+        .eval("Func F(X) {\n    Set LOCAL X\n    Return LOCAL\n}")
+        .unwrap();
+    assert!(engine.last_eval_had_side_effects());
+
+    // 函数内部的局部变量不算修改全局状态
+    engine.eval("F(3)").unwrap();
+    assert!(!engine.last_eval_had_side_effects());
+
+    // 失败前发生的修改同样被记录；解析失败则没有副作用
+    assert!(engine.eval("Set B 1\nUNDEFINED_VAR").is_err());
+    assert!(engine.last_eval_had_side_effects());
+    assert!(engine.eval("Set (").is_err());
+    assert!(!engine.last_eval_had_side_effects());
+}
+
+#[test]
+fn test_memory_usage_tracks_globals() {
+    let mut engine = Aether::new();
+    let baseline = engine.memory_usage();
+
+    // 大数组使占用明显增长，且增长量与元素个数相当
+    engine.eval("Set BIG RANGE(0, 10000)").unwrap();
+    let with_array = engine.memory_usage();
+    assert!(with_array >= baseline + 10000 * std::mem::size_of::<Value>());
+
+    engine.eval("Func F(X) {\n    Return X\n}").unwrap();
+    assert!(engine.memory_usage() > with_array);
+
+    // 重置环境后回落
+    engine.reset_env();
+    assert!(engine.memory_usage() < with_array);
+}
+
+#[test]
+fn test_export_and_import_program() {
+    let code = "Func TAX(X) {\n    Return (X * 0.25)\n}\nTAX(BASE)";
+    let bytes = Aether::new().export_program(code).unwrap();
+
+    // 加载后以返回的源码求值，直接命中缓存而不解析
+    let mut engine = Aether::new();
+    let source = engine.import_program(&bytes).unwrap();
+    assert_eq!(source, code);
+    engine.set_global("BASE", Value::Number(100.0));
+    assert_eq!(engine.eval(&source).unwrap(), Value::Number(25.0));
+    assert_eq!(engine.cache_stats().misses, 0);
+
+    // 版本不兼容、内容被改动或损坏时报错，且不写入缓存
+    let text = String::from_utf8(bytes.clone()).unwrap();
+    let future = text.replacen("\"version\":2", "\"version\":99", 1);
+    let err = engine.import_program(future.as_bytes()).unwrap_err();
+    assert!(
+        err.contains("Unsupported compiled program version 99"),
+        "{}",
+        err
+    );
+    let tampered = text.replacen("0.25", "0.50", 1);
+    let err = engine.import_program(tampered.as_bytes()).unwrap_err();
+    assert!(err.contains("checksum mismatch"), "{}", err);
+    assert!(engine.import_program(&bytes[..bytes.len() / 2]).is_err());
+    assert_eq!(engine.cache_stats().size, 1);
+
+    // 解析设置不同的引擎拒绝加载，避免绕过禁止列表等解析期检查
+    let mut restricted = Aether::new().with_deny_list(vec!["TA".to_string()]);
+    let err = restricted.import_program(&bytes).unwrap_err();
+    assert!(err.contains("different parse settings"), "{}", err);
+    let mut wrapping = Aether::new();
+    wrapping.set_int_overflow(IntOverflowMode::Wrap);
+    let err = wrapping.import_program(&bytes).unwrap_err();
+    assert!(err.contains("different parse settings"), "{}", err);
+
+    // 无法解析的代码不能导出
+    assert!(Aether::new().export_program("Set X (").is_err());
+}
+
+#[test]
+fn test_save_and_load_state() {
+    let mut setup = Aether::new();
+    setup
+        .eval(
+            "Set RATE 0.25\nSet TAGS [\"a\", {\"k\": TO_FRACTION(0.75)}]\n\
+             Func TAX(X) {\n    Return (X * RATE)\n}\nSet DOUBLE Lambda(X) -> (X * 2)",
+        )
+        .unwrap();
+    let bytes = setup.save_state().unwrap();
+
+    // 恢复到新引擎后，函数读取的是新引擎中的全局变量
+    let mut engine = Aether::new();
+    engine.load_state(&bytes).unwrap();
+    assert_eq!(engine.eval("TAX(100)").unwrap().to_string(), "25");
+    assert_eq!(engine.eval("DOUBLE(21)").unwrap().to_string(), "42");
+    assert_eq!(engine.eval("TAGS[1][\"k\"]").unwrap().to_string(), "3/4");
+    engine.eval("Set RATE 0.5").unwrap();
+    assert_eq!(engine.eval("TAX(100)").unwrap().to_string(), "50");
+
+    // 版本不兼容或内容损坏时报错，且不修改引擎
+    let text = String::from_utf8(bytes).unwrap();
+    let future = text.replacen("\"version\":1", "\"version\":99", 1);
+    let err = engine.load_state(future.as_bytes()).unwrap_err();
+    assert!(
+        err.contains("Unsupported engine state version 99"),
+        "{}",
+        err
+    );
+    assert!(engine.load_state(b"not state").is_err());
+    assert_eq!(engine.eval("RATE").unwrap().to_string(), "0.5");
+
+    // 捕获局部变量的闭包无法保存
+    let mut closures = Aether::new();
+    closures
+        .eval("Func ADDER(N) {\n    Return Lambda(X) -> (X + N)\n}\nSet ADD2 ADDER(2)")
+        .unwrap();
+    let err = closures.save_state().unwrap_err();
+    assert!(err.contains("Cannot save global 'ADD2'"), "{}", err);
+}
+
+#[test]
+fn test_eval_with_overlay() {
+    let mut engine = Aether::new();
+    engine.set_global("THRESHOLD", Value::Number(10.0));
+    engine.set_global("SCORE", Value::Number(0.0));
+    let rule = "Set PASSED (SCORE >= THRESHOLD)\nPASSED";
+
+    // 覆盖变量只在本次求值中生效，并遮蔽同名全局变量
+    for (score, expected) in [(12.0, true), (3.0, false)] {
+        let result = engine.eval_with(rule, [("SCORE", Value::Number(score))]);
+        assert_eq!(result, Ok(Value::Boolean(expected)));
+    }
+
+    // 覆盖变量和脚本定义的变量都不会泄漏到全局
+    assert_eq!(engine.eval("SCORE").unwrap(), Value::Number(0.0));
+    assert!(engine.eval("PASSED").is_err());
+
+    assert!(
+        engine
+            .eval_with(rule, [("bad name", Value::Null)])
+            .unwrap_err()
+            .contains("Invalid variable name")
+    );
+}
+
+#[test]
+fn test_eval_many_rows() {
+    let mut engine = Aether::new();
+    engine.set_global("THRESHOLD", Value::Number(10.0));
+    let rule = "Set PASSED (SCORE >= THRESHOLD)\nPASSED";
+
+    let rows = vec![
+        vec![("SCORE", Value::Number(12.0))],
+        vec![("SCORE", Value::String("x".to_string()))],
+        vec![],
+        vec![("SCORE", Value::Number(3.0))],
+    ];
+    let results = engine.eval_many(rule, rows);
+
+    // 出错的行不影响其他行，结果与输入一一对应
+    assert_eq!(results.len(), 4);
+    assert_eq!(results[0], Ok(Value::Boolean(true)));
+    assert!(results[1].is_err());
+    assert!(results[2].as_ref().unwrap_err().contains("SCORE"));
+    assert_eq!(results[3], Ok(Value::Boolean(false)));
+
+    // 行变量不会泄漏到全局，代码只解析一次
+    assert!(engine.eval("SCORE").is_err());
+    assert_eq!(engine.cache_stats().misses, 2);
+
+    // 代码无法解析时每行都返回解析错误
+    let results = engine.eval_many("Set X (", vec![vec![("A", Value::Null)]; 2]);
+    assert!(
+        results
+            .iter()
+            .all(|r| r.as_ref().is_err_and(|e| e.contains("Parse error")))
+    );
+}
+
+#[test]
+fn test_eval_csv_records() {
+    let mut engine = Aether::new();
+    let rule = "If (AGE >= 18) { NAME + \" \" + ZIP } Else { AGE + 1 }";
+    let header = ["NAME", "AGE", "ZIP"];
+    let rows = vec![
+        vec!["Ann".to_string(), " 42 ".to_string(), "007".to_string()],
+        vec!["Bob".to_string(), "1.5e1".to_string(), "".to_string()],
+        vec!["Eve".to_string(), "42".to_string()],
+        vec!["Max".to_string(), "NaN".to_string(), "1".to_string()],
+    ];
+    let results = engine.eval_csv(rule, &header, rows);
+
+    // 数字写法的字段转为数字，带前导零的编号和空字段保持字符串
+    assert_eq!(results.len(), 4);
+    assert_eq!(results[0], Ok(Value::String("Ann 007".to_string())));
+    assert_eq!(results[1], Ok(Value::Number(16.0)));
+    assert!(
+        results[2]
+            .as_ref()
+            .unwrap_err()
+            .contains("2 fields, expected 3")
+    );
+    assert!(results[3].is_err());
+
+    // 行变量不会泄漏到全局，代码只解析一次
+    assert!(engine.eval("NAME").is_err());
+    assert_eq!(engine.cache_stats().misses, 2);
+}
+
+#[test]
+fn test_set_numeric_slices() {
+    let mut engine = Aether::new();
+    let data: Vec<f64> = (0..1000).map(|i| i as f64 * 0.5).collect();
+    engine.set_float_slice("DATA", &data).unwrap();
+    engine.set_int_slice("IDS", &[3, -1, 4]).unwrap();
+
+    assert_eq!(engine.eval("LEN(DATA)").unwrap(), Value::Number(1000.0));
+    assert_eq!(engine.eval("DATA[999]").unwrap(), Value::Number(499.5));
+    assert_eq!(engine.eval("IDS[0] + IDS[1]").unwrap(), Value::Number(2.0));
+    assert!(engine.set_int_slice("1BAD", &[1]).is_err());
+}
+
+#[test]
+fn test_eval_diff_reports_changes() {
+    let mut engine = Aether::new();
+    engine
+        .eval("Set TOTAL 1\nSet CONFIG {\"mode\": \"a\"}\nSet TEMP 0")
+        .unwrap();
+    let before = engine.globals();
+    assert_eq!(before.len(), 3);
+
+    // 重新赋相同内容的字典不算改动
+    let (result, changes) = engine.eval_diff(
+        "Set TOTAL (TOTAL + 1)\nSet CONFIG {\"mode\": \"a\"}\nFunc HELPER() { Return 1 }\nTOTAL",
+    );
+    assert_eq!(result.unwrap(), Value::Number(2.0));
+    let summary: Vec<_> = changes.iter().map(|c| (c.name(), c.kind())).collect();
+    assert_eq!(summary, vec![("HELPER", "added"), ("TOTAL", "changed")]);
+    assert!(matches!(
+        &changes[1],
+        StateChange::Changed { before, after, .. }
+            if *before == Value::Number(1.0) && *after == Value::Number(2.0)
+    ));
+
+    // 与手动比较两次快照的结果一致；失败前发生的改动同样会报告
+    let (result, changes) = engine.eval_diff("Set TEMP 5\nUNDEFINED_VAR");
+    assert!(result.is_err());
+    assert_eq!(changes.len(), 1);
+    assert_eq!(diff_globals(&before, &engine.globals()).len(), 3);
+}
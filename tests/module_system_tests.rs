@@ -216,3 +216,74 @@ fn dsl_default_disables_import() {
         "unexpected error: {err}"
     );
 }
+
+#[test]
+fn registered_modules_support_qualified_calls() {
+    let mut engine = Aether::new();
+
+    engine
+        .add_module(
+            "RULES",
+            r#"
+Func IS_ADULT(AGE) {
+    Return AGE >= LIMITS.ADULT_AGE
+}
+"#,
+        )
+        .unwrap();
+    engine
+        .add_module(
+            "LIMITS",
+            "Set ADULT_AGE 18\nFunc DOUBLE(X) {\n    Return X * 2\n}",
+        )
+        .unwrap();
+
+    // Modules can reference each other, and are loaded lazily.
+    assert_eq!(
+        engine.eval("RULES.IS_ADULT(20)").unwrap(),
+        Value::Boolean(true)
+    );
+    assert_eq!(
+        engine.eval("RULES.IS_ADULT(12)").unwrap(),
+        Value::Boolean(false)
+    );
+    assert_eq!(
+        engine.eval("LIMITS.DOUBLE(LIMITS.ADULT_AGE)").unwrap(),
+        Value::Number(36.0)
+    );
+
+    // Registered modules can also be imported by name.
+    assert_eq!(
+        engine
+            .eval("Import {DOUBLE} From \"LIMITS\"\nDOUBLE(4)")
+            .unwrap(),
+        Value::Number(8.0)
+    );
+
+    // Module definitions do not leak into the global scope.
+    assert!(engine.eval("ADULT_AGE").is_err());
+
+    // Re-registering replaces the module.
+    engine.add_module("LIMITS", "Set ADULT_AGE 21").unwrap();
+    assert_eq!(
+        engine.eval("RULES.IS_ADULT(20)").unwrap(),
+        Value::Boolean(false)
+    );
+}
+
+#[test]
+fn registered_module_errors_are_reported() {
+    let mut engine = Aether::new();
+
+    let err = engine.add_module("BROKEN", "Set X (").unwrap_err();
+    assert!(err.starts_with("Parse error"), "unexpected error: {err}");
+    assert!(engine.add_module("lower-case", "Set X 1").is_err());
+
+    engine.add_module("A", "Set X B.Y").unwrap();
+    engine.add_module("B", "Set Y A.X").unwrap();
+    let err = engine.eval("A.X").unwrap_err();
+    assert!(
+        err.contains("circular import detected: A -> B -> A"),
+        "unexpected error: {err}"
+    );
+}
@@ -403,6 +403,64 @@ fn test_reduce_type_error_on_callback() {
     assert!(err.is_err());
 }
 
+#[test]
+fn test_sort_with_comparator() {
+    let mut engine = Aether::new();
+
+    // 比较函数可以是 Lambda，也可以是函数名；排序是稳定的
+    let result = engine
+        .eval(
+            r#"
+        Func BY_AGE(A, B) {
+            Return A["age"] - B["age"]
+        }
+        Set PEOPLE [{name: "a", age: 30}, {name: "b", age: 20}, {name: "c", age: 30}]
+        Set SORTED SORT(PEOPLE, "BY_AGE")
+        [SORT([3, 1, 2], Lambda (A, B) -> B - A), MAP(SORTED, Lambda P -> P["name"])]
+    "#,
+        )
+        .unwrap();
+    assert_eq!(result.to_string(), "[[3, 2, 1], [b, a, c]]");
+
+    // 不传比较函数时保持原有的数字排序
+    assert_eq!(engine.eval("SORT([2, 1])").unwrap().to_string(), "[1, 2]");
+
+    let err = engine
+        .eval(r#"SORT([1, 2], Lambda (A, B) -> "x")"#)
+        .unwrap_err();
+    assert!(err.contains("Number from SORT comparator"), "{}", err);
+    assert!(engine.eval(r#"SORT([1, 2], "MISSING")"#).is_err());
+}
+
+#[test]
+fn test_numeric_sorts_accept_nan() {
+    let mut engine = Aether::new();
+    engine.eval("Set NAN POW(-8, 0.5)").unwrap();
+
+    // NaN 参与排序时不会使内置函数崩溃
+    let sorted = engine.eval("SORT([2, NAN, 1])").unwrap();
+    let Value::Array(items) = sorted else {
+        panic!("expected an array, got {:?}", sorted);
+    };
+    let numbers: Vec<f64> = items
+        .iter()
+        .filter_map(|v| match v {
+            Value::Number(n) if !n.is_nan() => Some(*n),
+            _ => None,
+        })
+        .collect();
+    assert_eq!((items.len(), numbers), (3, vec![1.0, 2.0]));
+
+    for code in [
+        "MEDIAN([2, NAN, 1])",
+        "QUANTILE([2, NAN, 1], 0.5)",
+        "CALC_SALARY_MEDIAN(2, NAN, 1)",
+        "CALC_PERCENTILE(50, 2, NAN, 1)",
+    ] {
+        assert!(engine.eval(code).is_ok(), "{}", code);
+    }
+}
+
 #[test]
 fn test_combined_nested_and_lambda() {
     let mut engine = Aether::new();
@@ -20,3 +20,45 @@ fn test_optimize_program() {
         assert_eq!(*value, Expr::Number(5.0));
     }
 }
+
+#[test]
+fn test_disassemble_shows_optimized_ast() {
+    let engine = aether::Aether::new();
+
+    let dump = engine.disassemble("Set X (2 * 3)").unwrap();
+    // 常量折叠后只剩下结果
+    assert!(dump.contains("6.0"), "{}", dump);
+    assert!(!dump.contains("Multiply"), "{}", dump);
+
+    // 可重复调用，结果一致
+    assert_eq!(engine.disassemble("Set X (2 * 3)").unwrap(), dump);
+    assert!(engine.disassemble("Set X (").is_err());
+}
+
+#[test]
+fn test_optimization_level_folds_constants() {
+    let unfolded = Expr::Binary {
+        left: Box::new(Expr::Number(2.0)),
+        op: BinOp::Add,
+        right: Box::new(Expr::Number(3.0)),
+    };
+    let program: Program = vec![Stmt::Expression(unfolded.clone())];
+
+    // 级别 0 不做任何优化，级别 1 折叠常量
+    let before = Optimizer::with_level(0).optimize_program(&program);
+    let after = Optimizer::with_level(1).optimize_program(&program);
+    assert_eq!(before, vec![Stmt::Expression(unfolded)]);
+    assert_eq!(after, vec![Stmt::Expression(Expr::Number(5.0))]);
+
+    // disassemble 反映引擎的优化级别
+    let mut engine = aether::Aether::new().with_optimization_level(0);
+    let dump = engine.disassemble("(2 + 3)").unwrap();
+    assert!(dump.contains("Add"), "{}", dump);
+    assert_eq!(engine.eval("(2 + 3)").unwrap().to_string(), "5");
+
+    // 切换级别后不会复用按旧级别缓存的程序
+    engine.set_optimization_level(1);
+    let dump = engine.disassemble("(2 + 3)").unwrap();
+    assert!(!dump.contains("Add") && dump.contains("5.0"), "{}", dump);
+    assert_eq!(engine.cache_stats().size, 0);
+}
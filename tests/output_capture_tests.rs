@@ -0,0 +1,458 @@
+use aether::{Aether, StringCoercion, Value};
+
+#[test]
+fn eval_verbose_returns_result_and_output() {
+    let mut engine = Aether::new();
+
+    let (result, output) = engine.eval_verbose(
+        r#"
+PRINTLN("start")
+PRINT("a", 1)
+PRINTLN(" b")
+(1 + 2)
+"#,
+    );
+
+    assert_eq!(result.unwrap(), Value::Number(3.0));
+    assert_eq!(output, vec!["start".to_string(), "a 1 b".to_string()]);
+}
+
+#[test]
+fn eval_verbose_keeps_partial_output_on_error() {
+    let mut engine = Aether::new();
+
+    let (result, output) = engine.eval_verbose(
+        r#"
+PRINTLN("step 1")
+PRINTLN("step 2")
+UNDEFINED_VAR
+PRINTLN("never")
+"#,
+    );
+
+    assert!(result.is_err());
+    assert_eq!(output, vec!["step 1".to_string(), "step 2".to_string()]);
+}
+
+#[test]
+fn eval_verbose_does_not_leak_into_next_call() {
+    let mut engine = Aether::new();
+
+    let (_, first) = engine.eval_verbose(r#"PRINTLN("first")"#);
+    assert_eq!(first, vec!["first".to_string()]);
+
+    let (result, second) = engine.eval_verbose("(2 * 21)");
+    assert_eq!(result.unwrap(), Value::Number(42.0));
+    assert!(second.is_empty());
+}
+
+#[test]
+fn eval_verbose_captures_output_inside_functions() {
+    let mut engine = Aether::new();
+
+    let (result, output) = engine.eval_verbose(
+        r#"
+Func GREET(name) {
+    PRINTLN("hello", name)
+    Return name
+}
+GREET("aether")
+"#,
+    );
+
+    assert_eq!(result.unwrap(), Value::String("aether".to_string()));
+    assert_eq!(output, vec!["hello aether".to_string()]);
+}
+
+/// 把写入内容收集到共享缓冲区；超过 `limit` 字节后返回错误
+struct LimitedWriter {
+    buf: std::rc::Rc<std::cell::RefCell<Vec<u8>>>,
+    limit: usize,
+}
+
+impl std::io::Write for LimitedWriter {
+    fn write(&mut self, data: &[u8]) -> std::io::Result<usize> {
+        let mut buf = self.buf.borrow_mut();
+        if buf.len() + data.len() > self.limit {
+            return Err(std::io::Error::new(
+                std::io::ErrorKind::WriteZero,
+                "output limit reached",
+            ));
+        }
+        buf.extend_from_slice(data);
+        Ok(data.len())
+    }
+
+    fn flush(&mut self) -> std::io::Result<()> {
+        Ok(())
+    }
+}
+
+#[test]
+fn set_output_receives_print_output() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: usize::MAX,
+    });
+
+    let result = engine.eval(
+        r#"
+PRINTLN("hello", 1)
+PRINT("x")
+42
+"#,
+    );
+
+    assert_eq!(result.unwrap(), Value::Number(42.0));
+    assert_eq!(
+        String::from_utf8(buf.borrow().clone()).unwrap(),
+        "hello 1\nx"
+    );
+}
+
+#[test]
+fn set_output_writer_error_aborts_evaluation() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: 64,
+    });
+
+    // 没有写入错误时这是一个死循环
+    let err = engine
+        .eval(
+            r#"
+Set I 0
+While (True) {
+    PRINTLN("line", I)
+    Set I (I + 1)
+}
+"#,
+        )
+        .unwrap_err();
+
+    assert!(err.contains("Output error"), "unexpected error: {}", err);
+    assert!(err.contains("output limit reached"));
+    assert!(buf.borrow().len() <= 64);
+    assert!(buf.borrow().starts_with(b"line 0\n"));
+}
+
+#[test]
+fn max_output_bytes_stops_printing_loop() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: usize::MAX,
+    });
+    engine.set_max_output_bytes(Some(20));
+
+    // 每次输出 "tick\n"（5 字节），第 5 次会超出上限
+    let err = engine
+        .eval(
+            r#"
+While (True) {
+    PRINTLN("tick")
+}
+"#,
+        )
+        .unwrap_err();
+
+    assert!(
+        err.contains("Output limit exceeded: 25 bytes (limit: 20 bytes)"),
+        "unexpected error: {}",
+        err
+    );
+    assert_eq!(buf.borrow().as_slice(), b"tick\ntick\ntick\ntick\n");
+
+    // 每次顶层求值重新计数
+    buf.borrow_mut().clear();
+    assert!(engine.eval(r#"PRINTLN("again")"#).is_ok());
+    assert_eq!(buf.borrow().as_slice(), b"again\n");
+
+    // 输出捕获同样计数
+    let (result, output) = engine.eval_verbose(r#"PRINT("0123456789", "0123456789")"#);
+    assert!(result.unwrap_err().contains("Output limit exceeded"));
+    assert!(output.is_empty());
+}
+
+#[test]
+fn eval_verbose_takes_precedence_over_output_writer() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: 0,
+    });
+
+    let (result, output) = engine.eval_verbose(r#"PRINTLN("captured")"#);
+    assert!(result.is_ok());
+    assert_eq!(output, vec!["captured".to_string()]);
+    assert!(buf.borrow().is_empty());
+
+    engine.clear_output();
+    assert!(engine.eval("1").is_ok());
+}
+
+#[test]
+fn output_writer_error_inside_function_unwinds_call_stack() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: 0,
+    });
+
+    let err = engine
+        .eval(
+            r#"
+Func SAY(X) {
+    PRINTLN(X)
+}
+SAY("hi")
+"#,
+        )
+        .unwrap_err();
+    assert!(err.contains("Output error"), "unexpected error: {}", err);
+
+    // 调用栈已正确弹出，引擎可以继续使用
+    engine.clear_output();
+    assert_eq!(engine.eval("(1 + 1)").unwrap(), Value::Number(2.0));
+}
+
+#[test]
+fn eval_json_to_streams_result() {
+    let mut engine = Aether::new();
+
+    let mut out = Vec::new();
+    engine
+        .eval_json_to("MAP(RANGE(3), Lambda X -> (X * 1.5))", &mut out)
+        .unwrap();
+    assert_eq!(String::from_utf8(out).unwrap(), "[0.0,1.5,3.0]");
+
+    let mut out = Vec::new();
+    engine
+        .eval_json_to("[\"a\", Null, [True]]", &mut out)
+        .unwrap();
+    assert_eq!(String::from_utf8(out).unwrap(), r#"["a",null,[true]]"#);
+
+    // 求值失败时不写入任何内容
+    let mut out = Vec::new();
+    let err = engine.eval_json_to("[1, (1 / 0)]", &mut out).unwrap_err();
+    assert!(err.contains("Division by zero"), "{}", err);
+    assert!(out.is_empty());
+}
+
+#[test]
+fn eval_json_to_reports_writer_errors() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+
+    let err = engine
+        .eval_json_to(
+            "RANGE(100000)",
+            LimitedWriter {
+                buf: buf.clone(),
+                limit: 64,
+            },
+        )
+        .unwrap_err();
+    assert!(err.starts_with("Output error"), "{}", err);
+    assert!(buf.borrow().len() <= 64);
+}
+
+#[test]
+fn print_separator_and_terminator_are_configurable() {
+    let mut engine = Aether::new();
+    let buf = std::rc::Rc::new(std::cell::RefCell::new(Vec::new()));
+    engine.set_output(LimitedWriter {
+        buf: buf.clone(),
+        limit: usize::MAX,
+    });
+
+    // 默认行为不变
+    engine.eval(r#"PRINTLN("a", 1)"#).unwrap();
+    assert_eq!(String::from_utf8(buf.borrow().clone()).unwrap(), "a 1\n");
+    buf.borrow_mut().clear();
+
+    // CSV 风格输出：逗号分隔，PRINTLN 不换行
+    engine.set_print_separator(",");
+    engine.set_print_terminator(";");
+    engine
+        .eval(
+            r#"
+PRINTLN("id", "name")
+PRINT(1, "x")
+PRINTLN()
+"#,
+        )
+        .unwrap();
+    assert_eq!(
+        String::from_utf8(buf.borrow().clone()).unwrap(),
+        "id,name;1,x;"
+    );
+
+    // 捕获输出同样使用自定义格式
+    engine.set_print_terminator("\n");
+    let (_, output) = engine.eval_verbose(r#"PRINTLN("a", "b")"#);
+    assert_eq!(output, vec!["a,b".to_string()]);
+}
+
+#[test]
+fn no_output_mode_rejects_print() {
+    let mut engine = Aether::new().with_no_output();
+    assert!(engine.no_output());
+
+    // 纯计算脚本不受影响
+    assert_eq!(engine.eval("(1 + 2)").unwrap(), Value::Number(3.0));
+
+    // 任何输出都以错误终止，即使处于捕获模式
+    let err = engine.eval("Set X 1\nPRINTLN(X)\n(X + 1)").unwrap_err();
+    assert!(err.contains("PRINTLN is not allowed"), "{}", err);
+    let (result, output) = engine.eval_verbose("PRINT(\"hi\")");
+    assert!(result.is_err());
+    assert!(output.is_empty());
+
+    engine.set_no_output(false);
+    let (result, output) = engine.eval_verbose("PRINTLN(\"hi\")");
+    assert!(result.is_ok());
+    assert_eq!(output, vec!["hi".to_string()]);
+}
+
+#[test]
+fn sorted_map_keys_are_deterministic() {
+    let mut engine = Aether::new().with_sorted_map_keys();
+    assert!(engine.sorted_map_keys());
+
+    let code =
+        r#"Set D {"h": 1, "c": 2, "f": 3, "a": 4, "g": 5, "b": {"z": 1, "y": 2}, "e": 6, "d": 7}"#;
+    engine.eval(code).unwrap();
+
+    // PRINT 输出的字典（包括嵌套字典）按键排序
+    let (_, output) = engine.eval_verbose("PRINTLN(D)");
+    assert_eq!(
+        output,
+        vec!["{a: 4, b: {y: 2, z: 1}, c: 2, d: 7, e: 6, f: 3, g: 5, h: 1}".to_string()]
+    );
+
+    // JSON 输出同样按键排序
+    let mut json = Vec::new();
+    engine.eval_json_to("D", &mut json).unwrap();
+    assert_eq!(
+        String::from_utf8(json).unwrap(),
+        r#"{"a":4.0,"b":{"y":2.0,"z":1.0},"c":2.0,"d":7.0,"e":6.0,"f":3.0,"g":5.0,"h":1.0}"#
+    );
+
+    engine.set_sorted_map_keys(false);
+    assert!(!engine.sorted_map_keys());
+}
+
+#[test]
+fn locale_formats_printed_numbers() {
+    // 默认与区域无关
+    let mut engine = Aether::new();
+    assert_eq!(engine.locale(), None);
+    let (_, output) = engine.eval_verbose("PRINTLN(1234567.5)");
+    assert_eq!(output, vec!["1234567.5".to_string()]);
+
+    let mut engine = Aether::new().with_locale("en-US").unwrap();
+    assert_eq!(engine.locale(), Some("en-US"));
+    let (_, output) = engine.eval_verbose("PRINTLN(1234567.5, [1000, -2500.25])");
+    assert_eq!(output, vec!["1,234,567.5 [1,000, -2,500.25]".to_string()]);
+
+    engine.set_locale(Some("de-DE")).unwrap();
+    let (_, output) = engine.eval_verbose("PRINTLN(1234567.5, [1000, -2500.25])");
+    assert_eq!(output, vec!["1.234.567,5 [1.000, -2.500,25]".to_string()]);
+
+    // 求值结果本身不受影响
+    assert_eq!(engine.eval("1234567.5").unwrap(), Value::Number(1234567.5));
+
+    // 字符串拼接中的数字同样按区域格式化
+    engine.set_string_coercion(StringCoercion::Coerce);
+    assert_eq!(
+        engine.eval("\"Total: \" + 1234567.5").unwrap(),
+        Value::String("Total: 1.234.567,5".to_string())
+    );
+
+    engine.set_locale(None).unwrap();
+    assert_eq!(
+        engine.eval("\"Total: \" + 1234567.5").unwrap(),
+        Value::String("Total: 1234567.5".to_string())
+    );
+
+    let err = engine.set_locale(Some("xx-YY")).unwrap_err();
+    assert!(err.contains("Unsupported locale"), "{}", err);
+    assert!(Aether::new().with_locale("").is_err());
+}
+
+#[test]
+fn eval_tail_keeps_only_last_lines() {
+    let mut engine = Aether::new();
+
+    let (result, tail) = engine.eval_tail(
+        r#"
+For I In RANGE(1000) {
+    PRINTLN("progress", I)
+}
+"done"
+"#,
+        3,
+    );
+
+    assert_eq!(result.unwrap(), Value::String("done".to_string()));
+    assert_eq!(tail, vec!["progress 997", "progress 998", "progress 999"]);
+
+    // 失败时同样返回最后几行；n 为 0 时不保留任何输出
+    let (result, tail) = engine.eval_tail("PRINTLN(\"a\")\nPRINTLN(\"b\")\nUNDEFINED_VAR", 1);
+    assert!(result.is_err());
+    assert_eq!(tail, vec!["b"]);
+    let (_, tail) = engine.eval_tail("PRINTLN(\"a\")", 0);
+    assert!(tail.is_empty());
+}
+
+#[test]
+fn eval_for_each_visits_elements() {
+    let mut engine = Aether::new();
+
+    let mut seen = Vec::new();
+    engine
+        .eval_for_each("MAP(RANGE(4), Lambda X -> (X * 10))", |index, value| {
+            seen.push((index, value.clone()));
+            Ok(())
+        })
+        .unwrap();
+    assert_eq!(seen.len(), 4);
+    assert_eq!(seen[3], (3, Value::Number(30.0)));
+
+    // 非数组结果以下标 0 调用一次
+    let mut seen = Vec::new();
+    engine
+        .eval_for_each("\"done\"", |index, value| {
+            seen.push((index, value.clone()));
+            Ok(())
+        })
+        .unwrap();
+    assert_eq!(seen, vec![(0, Value::String("done".to_string()))]);
+
+    // 回调出错时立即停止并返回该错误；求值失败时不调用回调
+    let mut calls = 0;
+    let err = engine
+        .eval_for_each("RANGE(100)", |index, _| {
+            calls += 1;
+            if index == 2 {
+                Err("stop".to_string())
+            } else {
+                Ok(())
+            }
+        })
+        .unwrap_err();
+    assert_eq!((err.as_str(), calls), ("stop", 3));
+    assert!(
+        engine
+            .eval_for_each("(1 / 0)", |_, _| panic!("not called"))
+            .is_err()
+    );
+}
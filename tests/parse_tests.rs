@@ -168,3 +168,202 @@ fn test_parse_for_loop() {
         _ => panic!("Expected For statement"),
     }
 }
+
+#[test]
+fn test_parser_keeps_comments() {
+    let mut parser = Parser::new("// 计算总额\nSet TOTAL 10 // 元\nTOTAL");
+    let (program, positions) = parser.parse_program_with_positions().unwrap();
+    assert_eq!(program.len(), 2);
+
+    let comments = parser.comments();
+    assert_eq!(comments.len(), 2);
+    assert_eq!(comments[0].text, "// 计算总额");
+    // 行尾注释与其所在语句同一行
+    assert_eq!(comments[1].line, positions[0].line);
+}
+
+#[test]
+fn test_parser_detects_incomplete_input() {
+    let incomplete = [
+        "If (X > 1) {",
+        "Func ADD(A, B) {\n    Return (A +",
+        "Set A [1, 2",
+        "Set D {a: 1,",
+        "Set A (1 +",
+        "Set S \"\"\"first line",
+    ];
+    for code in incomplete {
+        assert!(Parser::is_incomplete(code), "{:?}", code);
+    }
+
+    // 完整的代码以及在输入结束前出错的代码都不算未完成
+    let not_incomplete = [
+        "Set A 1",
+        "If (X > 1) {\n    1\n}",
+        "(1 + 2))",
+        "Set A )",
+        "",
+    ];
+    for code in not_incomplete {
+        assert!(!Parser::is_incomplete(code), "{:?}", code);
+    }
+}
+
+#[test]
+fn test_parser_check_incomplete_reports_malformed_input() {
+    assert_eq!(Parser::check_incomplete("Set A 1"), Ok(false));
+    assert_eq!(Parser::check_incomplete("If (X > 1) {"), Ok(true));
+    assert_eq!(Parser::check_incomplete("Set S \"abc"), Ok(true));
+
+    // 无论后续输入什么都无法解析的代码返回解析错误
+    for code in ["Set A )", "(1 + 2))", "If (X > 1) {\n    Set )"] {
+        assert!(Parser::check_incomplete(code).is_err(), "{:?}", code);
+    }
+}
+
+#[test]
+fn test_parse_member_call() {
+    let mut parser = Parser::new("RULES.CHECK(1)");
+    let program = parser.parse_program().unwrap();
+
+    // NAME.MEMBER is sugar for NAME["MEMBER"]
+    assert_eq!(
+        program[0],
+        Stmt::Expression(Expr::call(
+            Expr::index(
+                Expr::Identifier("RULES".to_string()),
+                Expr::String("CHECK".to_string())
+            ),
+            vec![Expr::Number(1.0)]
+        ))
+    );
+
+    assert!(Parser::new("RULES.").parse_program().is_err());
+    assert!(Parser::new("RULES.1").parse_program().is_err());
+}
+
+#[test]
+fn test_parser_stops_when_interrupted() {
+    let handle = aether::InterruptHandle::new();
+    handle.interrupt();
+
+    let mut parser = Parser::new("Set X [1, 2, 3]").with_interrupt(handle.clone());
+    let err = parser.parse_program().unwrap_err();
+    assert_eq!(err, aether::ParseError::Interrupted);
+    assert_eq!(err.code(), "interrupted");
+
+    // The parser only reads the flag; without a handle parsing is unaffected
+    assert!(handle.is_interrupted());
+    assert!(Parser::new("Set X 1").parse_program().is_ok());
+}
+
+#[test]
+fn test_parser_rejects_deep_nesting() {
+    let nested_ifs =
+        |depth: usize| format!("{}1{}", "If (True) {\n".repeat(depth), "\n}".repeat(depth));
+
+    let parse = |code: &str| {
+        Parser::new(code)
+            .with_max_nesting_depth(Some(4))
+            .parse_program()
+    };
+    assert!(parse(&nested_ifs(4)).is_ok());
+    let err = parse(&nested_ifs(5)).unwrap_err();
+    assert_eq!(err.code(), "nesting-too-deep");
+    // Reported at the first token inside the block that is one level too deep
+    assert_eq!(err.position().map(|p| p.line), Some(6));
+    assert!(err.to_string().contains("Nesting too deep (limit: 4)"));
+
+    // Brackets count as well, and far deeper input fails instead of overflowing the stack
+    assert!(parse("[[[[1]]]]").is_ok());
+    assert!(parse("((((([1])))))").is_err());
+    assert!(parse(&format!("{}1{}", "(".repeat(100_000), ")".repeat(100_000))).is_err());
+
+    // So do unary operators and arrow-lambda bodies, which recurse without brackets
+    let too_deep = |code: &str| parse(code).map_err(|e| e.code()) == Err("nesting-too-deep");
+    assert!(parse("- - - -X").is_ok());
+    assert!(too_deep("- - - - -X"));
+    assert!(too_deep(&format!("{}True", "!".repeat(100_000))));
+    assert!(too_deep(&format!("{}X", "- ".repeat(100_000))));
+    assert!(parse("Lambda A -> Lambda B -> Lambda C -> Lambda D -> 1").is_ok());
+    assert!(too_deep(&format!("{}1", "Lambda X -> ".repeat(100_000))));
+}
+
+#[test]
+fn test_operator_table_matches_parsing() {
+    let table = Parser::operator_table();
+    let binary = |symbol: &str| {
+        table
+            .iter()
+            .find(|op| op.symbol == symbol && op.kind == "binary")
+            .unwrap()
+    };
+
+    // Agrees with how `5 + 3 * 2` and `A || B && C` are grouped
+    assert!(binary("*").precedence > binary("+").precedence);
+    assert!(binary("&&").precedence > binary("||").precedence);
+    assert_eq!(binary("<").precedence, binary(">=").precedence);
+    assert!(
+        table
+            .iter()
+            .filter(|op| op.kind == "binary")
+            .all(|op| op.associativity == "left")
+    );
+
+    // Sorted loosest first; calls and indexing bind tightest
+    assert!(table.windows(2).all(|w| w[0].precedence <= w[1].precedence));
+    assert_eq!(table.last().unwrap().kind, "postfix");
+}
+
+#[test]
+fn test_expression_positions_cover_every_node() {
+    fn count_nodes(json: &serde_json::Value, unpositioned: &mut Vec<String>) -> usize {
+        match json {
+            serde_json::Value::Array(items) => {
+                items.iter().map(|i| count_nodes(i, unpositioned)).sum()
+            }
+            serde_json::Value::Object(map) => {
+                let is_node = map.contains_key("kind");
+                if is_node && !(map.contains_key("line") && map.contains_key("column")) {
+                    unpositioned.push(map["kind"].to_string());
+                }
+                usize::from(is_node)
+                    + map
+                        .values()
+                        .map(|v| count_nodes(v, unpositioned))
+                        .sum::<usize>()
+            }
+            _ => 0,
+        }
+    }
+
+    // Every recorded position belongs to exactly one node, including nodes the
+    // parser synthesizes (member access, index targets, omitted return values)
+    let mut sources = vec![
+        "Set D {\"a\": [1, -X]}\nSet D[\"b\"] M.NAME(1)(2)[0]\nFunc F() {\n    Return\n}"
+            .to_string(),
+    ];
+    for dir in ["stdlib", "examples"] {
+        for entry in std::fs::read_dir(dir).unwrap() {
+            let path = entry.unwrap().path();
+            if path.extension().is_some_and(|ext| ext == "aether") {
+                sources.push(std::fs::read_to_string(path).unwrap());
+            }
+        }
+    }
+    let mut parsed = 0;
+    for source in &sources {
+        let Ok((program, statements, expressions)) =
+            Parser::new(source).parse_program_with_expression_positions()
+        else {
+            continue;
+        };
+        parsed += 1;
+        let json = aether::ast_json::program_to_json(&program, &statements, &expressions);
+        let mut unpositioned = Vec::new();
+        let nodes = count_nodes(&json, &mut unpositioned);
+        assert!(unpositioned.is_empty(), "{:?}", unpositioned);
+        assert_eq!(nodes, statements.len() + expressions.len());
+    }
+    assert!(parsed > 10, "only {} sources parsed", parsed);
+}
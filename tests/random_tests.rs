@@ -0,0 +1,113 @@
+use aether::{Aether, Value};
+
+fn sequence(engine: &mut Aether) -> Value {
+    engine
+        .eval(
+            r#"
+Set OUT []
+Set I 0
+While (I < 8) {
+    Set OUT PUSH(OUT, RANDOM())
+    Set I (I + 1)
+}
+OUT
+"#,
+        )
+        .unwrap()
+}
+
+#[test]
+fn same_seed_same_sequence() {
+    let mut a = Aether::new();
+    let mut b = Aether::new();
+    a.set_seed(2024);
+    b.set_seed(2024);
+
+    assert_eq!(sequence(&mut a), sequence(&mut b));
+}
+
+#[test]
+fn different_seeds_diverge() {
+    let mut a = Aether::new();
+    let mut b = Aether::new();
+    a.set_seed(1);
+    b.set_seed(2);
+
+    assert_ne!(sequence(&mut a), sequence(&mut b));
+}
+
+#[test]
+fn reseeding_restarts_sequence() {
+    let mut engine = Aether::new();
+    engine.set_seed(99);
+    let first = sequence(&mut engine);
+    engine.set_seed(99);
+    assert_eq!(sequence(&mut engine), first);
+}
+
+#[test]
+fn engines_do_not_share_rng_state() {
+    let mut a = Aether::new();
+    let mut b = Aether::new();
+    a.set_seed(7);
+    b.set_seed(7);
+
+    // 在 a 上多取几个随机数，不影响 b 的序列
+    a.eval("RANDOM()").unwrap();
+    a.eval("RANDOM()").unwrap();
+
+    let mut c = Aether::new();
+    c.set_seed(7);
+    assert_eq!(sequence(&mut b), sequence(&mut c));
+}
+
+#[test]
+fn per_call_seed_is_reproducible_and_restores_engine_rng() {
+    let mut engine = Aether::new();
+    engine.set_seed(5);
+    let mut reference = Aether::new();
+    reference.set_seed(5);
+
+    let code = "[RANDOM_INT(1, 1000000), RANDOM_INT(1, 1000000), ID]";
+    let row = |id: f64| vec![("ID", Value::Number(id))];
+    let first = engine.eval_with_seed(code, 42, row(1.0)).unwrap();
+    assert_eq!(engine.eval_with_seed(code, 42, row(1.0)).unwrap(), first);
+    assert_ne!(engine.eval_with_seed(code, 43, row(1.0)).unwrap(), first);
+
+    // 按记录设置种子不会推进引擎自身的序列，失败的求值同样会恢复
+    assert!(
+        engine
+            .eval_with_seed("RANDOM() + NOPE", 1, row(2.0))
+            .is_err()
+    );
+    assert_eq!(sequence(&mut engine), sequence(&mut reference));
+    assert!(engine.eval("ID").is_err());
+}
+
+#[test]
+fn random_int_stays_in_range() {
+    let mut engine = Aether::new();
+    engine.set_seed(42);
+
+    let result = engine
+        .eval(
+            r#"
+Set OK True
+Set I 0
+While (I < 200) {
+    Set N RANDOM_INT(1, 6)
+    If (N < 1 || N > 6 || N != FLOOR(N)) {
+        Set OK False
+    }
+    Set I (I + 1)
+}
+OK
+"#,
+        )
+        .unwrap();
+    assert_eq!(result, Value::Boolean(true));
+
+    assert!(engine.eval("RANDOM_INT(5, 1)").is_err());
+    assert!(engine.eval("RANDOM_INT(1.5, 3)").is_err());
+    assert!(engine.eval("RANDOM(1)").is_err());
+}
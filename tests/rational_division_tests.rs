@@ -0,0 +1,67 @@
+use aether::{Aether, Value};
+
+fn eval_string(engine: &mut Aether, code: &str) -> String {
+    engine.eval(code).unwrap().to_string()
+}
+
+#[test]
+fn default_mode_divides_as_floats() {
+    let mut engine = Aether::new();
+    assert!(!engine.rational_division());
+    assert_eq!(engine.eval("(1 / 4)").unwrap(), Value::Number(0.25));
+}
+
+#[test]
+fn uneven_integer_division_is_exact() {
+    let mut engine = Aether::new().with_rational_division();
+
+    assert!(matches!(
+        engine.eval("(1 / 3)").unwrap(),
+        Value::Fraction(_)
+    ));
+    assert_eq!(eval_string(&mut engine, "(1 / 3)"), "1/3");
+    assert_eq!(eval_string(&mut engine, "(-4 / 6)"), "-2/3");
+
+    // 分数参与后续运算保持精确，不会累积浮点误差
+    assert_eq!(eval_string(&mut engine, "((1 / 3) * 3)"), "1");
+    assert_eq!(eval_string(&mut engine, "((1 / 10) + (2 / 10))"), "3/10");
+    assert_eq!(
+        engine.eval("((1 / 10) + (2 / 10)) == (3 / 10)").unwrap(),
+        Value::Boolean(true)
+    );
+
+    // 变量之间的除法与常量一样，不会在编译期被折叠成浮点数
+    engine.eval("Set A 2\nSet B 7").unwrap();
+    assert_eq!(eval_string(&mut engine, "(A / B)"), "2/7");
+}
+
+#[test]
+fn even_and_fractional_division_stay_numbers() {
+    let mut engine = Aether::new().with_rational_division();
+
+    assert_eq!(engine.eval("(6 / 3)").unwrap(), Value::Number(2.0));
+    assert_eq!(engine.eval("(1.5 / 3)").unwrap(), Value::Number(0.5));
+    assert!(
+        engine
+            .eval("(1 / 0)")
+            .unwrap_err()
+            .contains("Division by zero")
+    );
+    assert_eq!(engine.eval("TO_FLOAT(1 / 4)").unwrap(), Value::Number(0.25));
+}
+
+#[test]
+fn toggling_discards_programs_folded_under_the_old_mode() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.eval("(1 / 4)").unwrap(), Value::Number(0.25));
+
+    engine.set_rational_division(true);
+    assert_eq!(eval_string(&mut engine, "(1 / 4)"), "1/4");
+
+    // 调整优化级别不会关闭有理数除法
+    engine.set_optimization_level(1);
+    assert_eq!(eval_string(&mut engine, "(1 / 4)"), "1/4");
+
+    engine.set_rational_division(false);
+    assert_eq!(engine.eval("(1 / 4)").unwrap(), Value::Number(0.25));
+}
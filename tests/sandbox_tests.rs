@@ -3,7 +3,8 @@
 //! 测试路径验证、沙箱配置和文件系统安全
 
 use aether::{
-    Aether, IOPermissions, PathRestriction, PathValidator, SandboxConfig, ScopedValidator,
+    Aether, FileSystem, IOPermissions, MemoryFileSystem, PathRestriction, PathValidator,
+    SandboxConfig, ScopedValidator,
 };
 use std::collections::HashSet;
 use std::fs;
@@ -249,3 +250,77 @@ fn test_no_validator_allows_anything() {
     // 清理
     let _ = fs::remove_file(&test_file);
 }
+
+#[test]
+fn test_engine_reports_permissions() {
+    let engine = Aether::new();
+    assert!(!engine.permissions_enabled());
+    assert!(!engine.permissions().filesystem_enabled);
+
+    let engine = Aether::with_all_permissions();
+    assert!(engine.permissions_enabled());
+    assert!(engine.permissions().network_enabled);
+
+    let engine = Aether::with_permissions(IOPermissions {
+        filesystem_enabled: true,
+        network_enabled: false,
+    });
+    assert!(engine.permissions_enabled());
+    assert!(!engine.permissions().network_enabled);
+}
+
+#[test]
+fn test_memory_file_system_replaces_disk() {
+    let fs = MemoryFileSystem::new();
+    fs.insert("config.txt", "debug=true");
+
+    let mut engine = Aether::with_all_permissions();
+    engine.set_file_system(fs.clone());
+
+    // 读取只访问内存中的文件
+    let result = engine.eval(r#"READ_FILE("config.txt")"#).unwrap();
+    assert_eq!(result.to_string(), "debug=true");
+    assert!(engine.eval(r#"READ_FILE("Cargo.toml")"#).is_err());
+    assert_eq!(
+        engine
+            .eval(r#"[FILE_EXISTS("config.txt"), FILE_EXISTS("missing.txt")]"#)
+            .unwrap()
+            .to_string(),
+        "[true, false]"
+    );
+
+    // 写入和追加落在内存中，不会创建真实文件
+    engine
+        .eval(r#"WRITE_FILE("vfs_out.txt", "a") APPEND_FILE("vfs_out.txt", "b")"#)
+        .unwrap();
+    assert_eq!(fs.get("vfs_out.txt").as_deref(), Some("ab"));
+    assert!(!std::path::Path::new("vfs_out.txt").exists());
+
+    // 不支持的文件操作报错
+    assert!(engine.eval(r#"LIST_DIR(".")"#).is_err());
+
+    // 卸载后恢复真实文件系统
+    engine.clear_file_system();
+    assert!(engine.eval(r#"READ_FILE("Cargo.toml")"#).is_ok());
+}
+
+#[test]
+fn test_read_only_file_system_denies_writes() {
+    struct Fixed;
+
+    impl FileSystem for Fixed {
+        fn read_file(&self, path: &str) -> Result<String, String> {
+            Ok(format!("content of {}", path))
+        }
+    }
+
+    let mut engine = Aether::with_all_permissions();
+    engine.set_file_system(Fixed);
+
+    assert_eq!(
+        engine.eval(r#"READ_FILE("a")"#).unwrap().to_string(),
+        "content of a"
+    );
+    let err = engine.eval(r#"WRITE_FILE("a", "x")"#).unwrap_err();
+    assert!(err.contains("read-only"), "{}", err);
+}
@@ -178,3 +178,45 @@ fn test_datetime_module() {
     let result = engine.eval(code).expect("Failed to eval");
     assert_eq!(result.to_string(), "true");
 }
+
+#[test]
+fn test_builtin_groups_disable_other_builtins() {
+    // 只启用 math 和 string 分组
+    let mut engine = Aether::new()
+        .with_builtin_groups(&["math", "string"])
+        .expect("Failed to select builtin groups");
+
+    assert_eq!(engine.eval("ABS(-3)").unwrap().to_string(), "3");
+    assert_eq!(engine.eval(r#"UPPER("ab")"#).unwrap().to_string(), "AB");
+
+    // 其余分组的内置函数不可用
+    let err = engine.eval("LEN([1, 2])").unwrap_err();
+    assert!(err.contains("Undefined variable"), "{}", err);
+    let err = engine.eval(r#"MAP([1], Lambda X -> X)"#).unwrap_err();
+    assert!(err.contains("Undefined variable"), "{}", err);
+
+    // 用户变量可以复用被禁用的名字
+    assert_eq!(engine.eval("Set LEN 5\nLEN").unwrap().to_string(), "5");
+
+    // 重置环境后仍然保持禁用
+    engine.reset_env();
+    assert!(engine.eval("TYPE(1)").is_err());
+}
+
+#[test]
+fn test_builtin_groups_alias_of_disabled_builtin() {
+    // 禁用前保存的别名也不能再调用
+    let mut engine = Aether::new();
+    engine.eval("Set L LEN").unwrap();
+    let mut engine = engine.with_builtin_groups(&["math"]).unwrap();
+
+    let err = engine.eval("L([1])").unwrap_err();
+    assert!(err.contains("builtin disabled"), "{}", err);
+}
+
+#[test]
+fn test_builtin_groups_unknown_group() {
+    let err = Aether::new().with_builtin_groups(&["maths"]).err().unwrap();
+    assert!(err.contains("Unknown builtin group: 'maths'"), "{}", err);
+    assert!(err.contains("math"), "{}", err);
+}
@@ -0,0 +1,57 @@
+use aether::{Aether, StringCoercion, Value};
+
+const MIXED: [(&str, &str); 6] = [
+    ("(\"count: \" + 3)", "count: 3"),
+    ("(3 + \" items\")", "3 items"),
+    ("(\"price: \" + 2.5)", "price: 2.5"),
+    ("(\"ok: \" + True)", "ok: true"),
+    ("(\"items: \" + [1, 2])", "items: [1, 2]"),
+    ("(\"value: \" + Null)", "value: Null"),
+];
+
+#[test]
+fn default_mode_is_strict() {
+    let engine = Aether::new();
+    assert_eq!(engine.string_coercion(), StringCoercion::Strict);
+}
+
+#[test]
+fn strict_mode_rejects_mixed_types() {
+    let mut engine = Aether::new();
+
+    for (code, _) in MIXED {
+        let err = engine.eval(code).unwrap_err();
+        assert!(err.contains("Cannot add"), "{}: {}", code, err);
+    }
+}
+
+#[test]
+fn coerce_mode_stringifies_other_side() {
+    let mut engine = Aether::new();
+    engine.set_string_coercion(StringCoercion::Coerce);
+
+    for (code, expected) in MIXED {
+        assert_eq!(
+            engine.eval(code).unwrap(),
+            Value::String(expected.to_string()),
+            "{}",
+            code
+        );
+    }
+}
+
+#[test]
+fn modes_do_not_affect_other_additions() {
+    for mode in [StringCoercion::Strict, StringCoercion::Coerce] {
+        let mut engine = Aether::new();
+        engine.set_string_coercion(mode);
+
+        assert_eq!(
+            engine.eval("(\"a\" + \"b\")").unwrap(),
+            Value::String("ab".to_string())
+        );
+        assert_eq!(engine.eval("(1 + 2)").unwrap(), Value::Number(3.0));
+        // 不涉及字符串的非法加法仍然报错
+        assert!(engine.eval("([1] + True)").is_err());
+    }
+}
@@ -16,6 +16,17 @@ fn test_keyword_lookup() {
     }
 }
 
+#[test]
+fn test_is_identifier() {
+    assert!(Token::is_identifier("MY_VAR"));
+    assert!(Token::is_identifier("_x1"));
+    assert!(Token::is_identifier("金额"));
+    assert!(!Token::is_identifier(""));
+    assert!(!Token::is_identifier("1X"));
+    assert!(!Token::is_identifier("A-B"));
+    assert!(!Token::is_identifier("Set"));
+}
+
 #[test]
 fn test_token_type() {
     assert_eq!(Token::Set.token_type(), "Set");
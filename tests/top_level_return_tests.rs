@@ -0,0 +1,124 @@
+use aether::{Aether, EvalResult, Evaluator, Parser, ResultKind, Value};
+
+#[test]
+fn top_level_return_stops_script() {
+    let mut engine = Aether::new();
+
+    let (value, kind) = engine
+        .eval_with_kind(
+            r#"
+Set X 10
+If (X > 5) {
+    Return "big"
+}
+Set X 0
+"small"
+"#,
+        )
+        .unwrap();
+
+    assert_eq!(value, Value::String("big".to_string()));
+    assert_eq!(kind, ResultKind::Returned);
+    // Return 之后的语句没有执行
+    assert_eq!(engine.eval("X").unwrap(), Value::Number(10.0));
+}
+
+#[test]
+fn last_value_and_void_are_distinguished() {
+    let mut engine = Aether::new();
+
+    let (value, kind) = engine.eval_with_kind("\"\"").unwrap();
+    assert_eq!(value, Value::String(String::new()));
+    assert_eq!(kind, ResultKind::LastValue);
+    assert!(!kind.is_void());
+
+    let (value, kind) = engine.eval_with_kind("PRINTLN(\"done\")").unwrap();
+    assert_eq!(value, Value::Null);
+    assert!(kind.is_void());
+
+    let (_, kind) = engine.eval_with_kind("").unwrap();
+    assert!(kind.is_void());
+}
+
+#[test]
+fn failed_eval_does_not_report_previous_result() {
+    fn run(evaluator: &mut Evaluator, code: &str) -> EvalResult {
+        let program = Parser::new(code).parse_program().unwrap();
+        evaluator.eval_program(&program)
+    }
+    let mut evaluator = Evaluator::new();
+
+    run(&mut evaluator, "Set X 1\nReturn X").unwrap();
+    assert!(run(&mut evaluator, "Set Y 2\nUNDEFINED_VAR").is_err());
+    assert_eq!(evaluator.last_result_kind(), ResultKind::Void);
+    assert_eq!(evaluator.last_result_index(), None);
+
+    run(&mut evaluator, "Set X 1\nX").unwrap();
+    assert_eq!(evaluator.last_result_kind(), ResultKind::LastValue);
+    assert!(run(&mut evaluator, "UNDEFINED_VAR").is_err());
+    assert_eq!(evaluator.last_result_kind(), ResultKind::Void);
+}
+
+#[test]
+fn return_inside_function_does_not_end_script() {
+    let mut engine = Aether::new();
+
+    let (value, kind) = engine
+        .eval_with_kind(
+            r#"
+Func F() {
+    Return 1
+}
+(F() + 1)
+"#,
+        )
+        .unwrap();
+
+    assert_eq!(value, Value::Number(2.0));
+    assert_eq!(kind, ResultKind::LastValue);
+}
+
+#[test]
+fn plain_eval_accepts_top_level_return() {
+    let mut engine = Aether::new();
+    assert_eq!(engine.eval("Return 7\n8").unwrap(), Value::Number(7.0));
+}
+
+#[test]
+fn eval_with_span_points_at_result_statement() {
+    let mut engine = Aether::new();
+
+    let (value, span) = engine.eval_with_span("Set X 1\n  (X + 1)").unwrap();
+    assert_eq!(value, Value::Number(2.0));
+    let span = span.unwrap();
+    assert_eq!((span.line, span.column), (2, 3));
+
+    // 嵌套在 If 中的 Return 报告其所在的顶层语句
+    let (value, span) = engine
+        .eval_with_span("Set X 10\nIf (X > 5) {\n    Return \"big\"\n}\n\"small\"")
+        .unwrap();
+    assert_eq!(value, Value::String("big".to_string()));
+    assert_eq!(span.unwrap().line, 2);
+
+    // 没有值时不报告位置
+    let (_, span) = engine.eval_with_span("Set Y 1\nPRINTLN(\"done\")").unwrap();
+    assert!(span.is_none());
+
+    // 位置随 AST 缓存保存，命中缓存时同样可用
+    let hits = engine.cache_stats().hits;
+    let (_, span) = engine.eval_with_span("Set X 1\n  (X + 1)").unwrap();
+    assert_eq!(engine.cache_stats().hits, hits + 1);
+    let span = span.unwrap();
+    assert_eq!((span.line, span.column), (2, 3));
+}
+
+#[test]
+fn eval_with_span_ignores_optimized_out_statements() {
+    let mut engine = Aether::new();
+
+    // While (False) 会被优化器删除，但不影响后续语句的位置
+    let (_, span) = engine
+        .eval_with_span("While (False) {\n    Set X 1\n}\nSet Z 3\nZ")
+        .unwrap();
+    assert_eq!(span.unwrap().line, 5);
+}
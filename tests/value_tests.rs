@@ -82,3 +82,63 @@ fn test_array_equality() {
     assert!(arr1.equals(&arr2));
     assert!(!arr1.equals(&arr3));
 }
+
+#[test]
+fn test_value_time_conversions() {
+    use std::time::{Duration, UNIX_EPOCH};
+
+    let t = UNIX_EPOCH + Duration::from_millis(1_700_000_000_500);
+    let v = Value::from_system_time(t);
+    assert_eq!(v, Value::Number(1_700_000_000.5));
+    assert_eq!(v.to_system_time(), Some(t));
+
+    let before_epoch = UNIX_EPOCH - Duration::from_secs(60);
+    assert_eq!(Value::from_system_time(before_epoch), Value::Number(-60.0));
+    assert_eq!(Value::Number(-60.0).to_system_time(), Some(before_epoch));
+
+    let d = Duration::from_millis(1500);
+    assert_eq!(Value::from_duration(d), Value::Number(1.5));
+    assert_eq!(Value::Number(1.5).to_duration(), Some(d));
+    assert_eq!(Value::Number(-1.0).to_duration(), None);
+    assert_eq!(Value::String("x".to_string()).to_duration(), None);
+}
+
+#[test]
+fn test_time_values_in_script() {
+    use aether::Aether;
+    use std::time::{Duration, SystemTime};
+
+    let mut engine = Aether::new();
+    let now = SystemTime::now();
+    engine.set_global("NOW", Value::from_system_time(now));
+    engine.set_global(
+        "CREATED",
+        Value::from_system_time(now - Duration::from_secs(7200)),
+    );
+    engine.set_global("TTL", Value::from_duration(Duration::from_secs(3600)));
+
+    assert_eq!(
+        engine.eval("((NOW - CREATED) > TTL)").unwrap(),
+        Value::Boolean(true)
+    );
+}
+
+#[test]
+fn test_number_rendering_distinguishes_whole_numbers() {
+    let mut engine = aether::Aether::new();
+    let render = |engine: &mut aether::Aether, code: &str| engine.eval(code).unwrap().to_string();
+
+    // 整数值不含小数点，与写法无关
+    assert_eq!(render(&mut engine, "(4 / 2)"), "2");
+    assert_eq!(render(&mut engine, "4.0"), "4");
+    assert_eq!(render(&mut engine, "(0.5 + 0.5)"), "1");
+    assert_eq!(render(&mut engine, "(-6 / 3)"), "-2");
+    // 非整数值总是含小数点，且不使用科学计数法
+    assert_eq!(render(&mut engine, "(5 / 2)"), "2.5");
+    assert_eq!(render(&mut engine, "(1 / 4)"), "0.25");
+    assert_eq!(render(&mut engine, "(1 / 10000000)"), "0.0000001");
+    assert_eq!(
+        render(&mut engine, "(1000000 * 1000000 * 1000000)"),
+        "1000000000000000000"
+    );
+}